@@ -0,0 +1,55 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/axwilliams/book-api/internal/business/access"
+	"github.com/axwilliams/book-api/internal/platform/auth"
+	"github.com/axwilliams/book-api/internal/platform/policy"
+	"github.com/axwilliams/book-api/internal/platform/web"
+)
+
+type AccessHandler struct {
+	as access.Service
+}
+
+func NewAccessHandler(as access.Service) AccessHandler {
+	return AccessHandler{
+		as,
+	}
+}
+
+// Policies lists the loaded policies.
+func (h *AccessHandler) Policies(w http.ResponseWriter, r *http.Request) {
+	web.Respond(w, h.as.Policies(), http.StatusOK)
+}
+
+// Explain answers how the policies would decide a request, and why.
+func (h *AccessHandler) Explain(w http.ResponseWriter, r *http.Request) {
+	ex := access.Explain{}
+	if err := web.Decode(r, &ex); err != nil {
+		web.RespondError(w, err)
+		return
+	}
+
+	d, err := h.as.Explain(ex)
+	if err != nil {
+		web.RespondError(w, err)
+		return
+	}
+
+	web.Respond(w, d, http.StatusOK)
+}
+
+// subject is the caller as access policies see it. Its attributes are
+// loaded by the policy engine.
+func subject(r *http.Request) policy.Subject {
+	claims, _ := auth.ClaimsFromContext(r.Context())
+	perms, _ := auth.PermissionsFromContext(r.Context())
+
+	return policy.Subject{
+		ID:          claims.UserID,
+		Roles:       claims.Roles,
+		Permissions: perms,
+	}
+}
@@ -0,0 +1,152 @@
+package handlers_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/axwilliams/book-api/cmd/book-api/handlers"
+	"github.com/axwilliams/book-api/internal/business/access"
+	"github.com/axwilliams/book-api/internal/business/book"
+	"github.com/axwilliams/book-api/internal/business/enrich"
+	"github.com/axwilliams/book-api/internal/business/tag"
+	"github.com/axwilliams/book-api/internal/platform/auth"
+	"github.com/axwilliams/book-api/internal/platform/policy"
+	"github.com/axwilliams/book-api/internal/test"
+	"github.com/axwilliams/book-api/internal/test/mock"
+	"github.com/gorilla/mux"
+)
+
+const categoryPolicies = `{
+	"policies": [
+		{
+			"id": "authors-edit-their-categories",
+			"effect": "allow",
+			"actions": ["create", "update", "delete", "merge", "tag"],
+			"resource": "book",
+			"condition": "resource.category in subject.categories"
+		},
+		{
+			"id": "admins-edit-everything",
+			"effect": "allow",
+			"actions": ["*"],
+			"resource": "book",
+			"condition": "'ADMIN' in subject.roles"
+		}
+	]
+}`
+
+func newPolicyEngine(t *testing.T) (*policy.Engine, func()) {
+	dir, err := ioutil.TempDir("", "policies")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, "books.json"), []byte(categoryPolicies), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	pe := policy.NewEngine(dir)
+	pe.UseAttributes(access.Attributes(mock.NewMockUser()))
+	if _, err := pe.Load(); err != nil {
+		t.Fatal(err)
+	}
+	return pe, func() { os.RemoveAll(dir) }
+}
+
+func TestExplain(t *testing.T) {
+	pe, cleanup := newPolicyEngine(t)
+	defer cleanup()
+
+	h := handlers.NewAccessHandler(access.NewService(pe, mock.NewMockUser(), mock.NewMockBook()))
+
+	samples := []struct {
+		name       string
+		payload    string
+		statusCode int
+		allowed    bool
+		reason     string
+	}{
+		{"Subject in full", `{"subject": {"id": "x", "roles": ["AUTHOR"], "attributes": {"categories": ["Fiction"]}}, "action": "update", "resource": {"type": "book", "id": "f4ac7e14-fc8e-4096-b956-34e5a33040f2"}}`, http.StatusOK, true, "authors-edit-their-categories allows update on book"},
+		{"User without categories", `{"user_id": "69a47775-6d89-4d38-ad38-acdb2928f6a1", "action": "update", "resource": {"type": "book", "id": "f4ac7e14-fc8e-4096-b956-34e5a33040f2"}}`, http.StatusOK, false, "no policy allows update on book"},
+		{"Resource in full", `{"subject": {"roles": ["ADMIN"]}, "action": "approve", "resource": {"type": "book", "attributes": {"category": "Poetry"}}}`, http.StatusOK, true, "admins-edit-everything allows approve on book"},
+		{"User and subject", `{"user_id": "69a47775-6d89-4d38-ad38-acdb2928f6a1", "subject": {"roles": []}, "action": "update", "resource": {"type": "book", "attributes": {}}}`, http.StatusUnprocessableEntity, false, ""},
+		{"Unknown user", `{"user_id": "562e1fe0-0dde-4717-a008-cd2a699301d3", "action": "update", "resource": {"type": "book", "attributes": {}}}`, http.StatusNotFound, false, ""},
+		{"Unknown book", `{"action": "update", "resource": {"type": "book", "id": "7b6807c2-1e11-4e38-bdfd-281186885c3f"}}`, http.StatusNotFound, false, ""},
+		{"Resource without attributes", `{"action": "update", "resource": {"type": "series", "id": "7b6807c2-1e11-4e38-bdfd-281186885c3f"}}`, http.StatusUnprocessableEntity, false, ""},
+		{"No action", `{"resource": {"type": "book", "attributes": {}}}`, http.StatusUnprocessableEntity, false, ""},
+	}
+
+	for _, sample := range samples {
+		r, err := http.NewRequest("POST", "/api/v1/policies/explain", bytes.NewBufferString(sample.payload))
+		if err != nil {
+			t.Errorf("\t%s\tRequest failed: %v\n", test.Failed, err)
+		}
+
+		rr := httptest.NewRecorder()
+		http.HandlerFunc(h.Explain).ServeHTTP(rr, r)
+
+		if sample.statusCode != rr.Code {
+			t.Fatalf("\t%s\t%s: want %v got %v %s", test.Failed, sample.name, sample.statusCode, rr.Code, rr.Body.String())
+		}
+		if rr.Code == http.StatusOK {
+			var d policy.Decision
+			json.NewDecoder(rr.Body).Decode(&d)
+			if d.Allowed != sample.allowed || d.Reason != sample.reason {
+				t.Fatalf("\t%s\t%s: want %v %q got %v %q", test.Failed, sample.name, sample.allowed, sample.reason, d.Allowed, d.Reason)
+			}
+		}
+		t.Logf("\t%s\t%s", test.Success, sample.name)
+	}
+}
+
+func TestPolicyEnforced(t *testing.T) {
+	pe, cleanup := newPolicyEngine(t)
+	defer cleanup()
+
+	bookService := book.NewService(mock.NewMockBook(), pe)
+	h := handlers.NewBookHandler(bookService, enrich.NewService(bookService, nil))
+	th := handlers.NewTagHandler(tag.NewService(mock.NewMockTag(), mock.NewMockBook(), pe))
+
+	author := auth.Claims{UserID: "69a47775-6d89-4d38-ad38-acdb2928f6a1", Roles: []string{auth.RoleAuthor}}
+	admin := auth.Claims{UserID: "a72bec75-0a5f-49af-a844-5763d188788e", Roles: []string{auth.RoleAdmin}}
+
+	samples := []struct {
+		name       string
+		hf         http.HandlerFunc
+		claims     auth.Claims
+		payload    string
+		statusCode int
+	}{
+		{"Author edits outside their categories", h.Edit, author, `{"title": "The Trial"}`, http.StatusForbidden},
+		{"Author deletes outside their categories", h.Delete, author, "", http.StatusForbidden},
+		{"Admin edits", h.Edit, admin, `{"title": "The Trial"}`, http.StatusOK},
+		{"Author adds outside their categories", h.Add, author, `{"isbn": "978-0441172719", "title": "Dune", "author": "Frank Herbert", "category": "Fiction"}`, http.StatusForbidden},
+		{"Admin adds", h.Add, admin, `{"isbn": "978-0441172719", "title": "Dune", "author": "Frank Herbert", "category": "Fiction"}`, http.StatusCreated},
+		{"Author relates outside their categories", h.Relate, author, `{"type": "companion_to", "book_id": "562e1fe0-0dde-4717-a008-cd2a699301d2"}`, http.StatusForbidden},
+		{"Author merges outside their categories", h.Merge, author, `{"source": "562e1fe0-0dde-4717-a008-cd2a699301d2"}`, http.StatusForbidden},
+		{"Author tags outside their categories", th.Add, author, `{"tags": ["classic"]}`, http.StatusForbidden},
+		{"Admin tags", th.Add, admin, `{"tags": ["classic"]}`, http.StatusOK},
+	}
+
+	for _, sample := range samples {
+		r, err := http.NewRequest("PATCH", "/api/v1/books", bytes.NewBufferString(sample.payload))
+		if err != nil {
+			t.Errorf("\t%s\tRequest failed: %v\n", test.Failed, err)
+		}
+		r = r.WithContext(auth.ContextWithUser(r.Context(), sample.claims))
+		r = mux.SetURLVars(r, map[string]string{"id": "f4ac7e14-fc8e-4096-b956-34e5a33040f2"})
+
+		rr := httptest.NewRecorder()
+		sample.hf.ServeHTTP(rr, r)
+
+		if sample.statusCode != rr.Code {
+			t.Fatalf("\t%s\t%s: want %v got %v %s", test.Failed, sample.name, sample.statusCode, rr.Code, rr.Body.String())
+		}
+		t.Logf("\t%s\t%s", test.Success, sample.name)
+	}
+}
@@ -0,0 +1,60 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/axwilliams/book-api/internal/business/apikey"
+	"github.com/axwilliams/book-api/internal/platform/auth"
+	"github.com/axwilliams/book-api/internal/platform/web"
+	"github.com/gorilla/mux"
+)
+
+type APIKeyHandler struct {
+	ks apikey.Service
+}
+
+func NewAPIKeyHandler(ks apikey.Service) APIKeyHandler {
+	return APIKeyHandler{
+		ks,
+	}
+}
+
+// Add creates a key. The response is the only time the key is shown.
+func (h *APIKeyHandler) Add(w http.ResponseWriter, r *http.Request) {
+	na := apikey.NewAPIKey{}
+	if err := web.Decode(r, &na); err != nil {
+		web.RespondError(w, err)
+		return
+	}
+
+	actorID, _ := auth.UserFromContext(r.Context())
+
+	k, err := h.ks.Create(na, actorID)
+	if err != nil {
+		web.RespondError(w, err)
+		return
+	}
+
+	web.Respond(w, k, http.StatusCreated)
+}
+
+func (h *APIKeyHandler) FindAll(w http.ResponseWriter, r *http.Request) {
+	ks, err := h.ks.FindAll()
+	if err != nil {
+		web.RespondError(w, err)
+		return
+	}
+
+	web.Respond(w, ks, http.StatusOK)
+}
+
+func (h *APIKeyHandler) Delete(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+
+	if err := h.ks.Revoke(vars["id"]); err != nil {
+		web.RespondError(w, err)
+		return
+	}
+
+	web.Respond(w, nil, http.StatusOK)
+}
@@ -0,0 +1,80 @@
+package handlers_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/axwilliams/book-api/cmd/book-api/handlers"
+	"github.com/axwilliams/book-api/internal/business/apikey"
+	"github.com/axwilliams/book-api/internal/platform/auth"
+	"github.com/axwilliams/book-api/internal/test"
+	"github.com/axwilliams/book-api/internal/test/mock"
+	"github.com/gorilla/mux"
+)
+
+func TestAPIKeys(t *testing.T) {
+	h := handlers.NewAPIKeyHandler(apikey.NewService(mock.NewMockAPIKey(), mock.NewMockUser()))
+	admin := auth.Claims{UserID: "a72bec75-0a5f-49af-a844-5763d188788e", Roles: []string{auth.RoleAdmin}}
+
+	serve := func(hf http.HandlerFunc, method, payload, id string) *httptest.ResponseRecorder {
+		r, err := http.NewRequest(method, "/api/v1/api-keys", bytes.NewBufferString(payload))
+		if err != nil {
+			t.Errorf("\t%s\tRequest failed: %v\n", test.Failed, err)
+		}
+		r = r.WithContext(auth.ContextWithUser(r.Context(), admin))
+		r = mux.SetURLVars(r, map[string]string{"id": id})
+
+		rr := httptest.NewRecorder()
+		hf.ServeHTTP(rr, r)
+		return rr
+	}
+
+	samples := []struct {
+		payload    string
+		statusCode int
+	}{
+		// Missing scopes
+		{`{"name": "import"}`, http.StatusUnprocessableEntity},
+		// Unknown field
+		{`{"name": "import", "scopes": ["AUTHOR"], "secret": "x"}`, http.StatusBadRequest},
+		// Admin user unknown to the user repository
+		{`{"name": "import", "scopes": ["ADMIN"]}`, http.StatusUnprocessableEntity},
+		// Success
+		{`{"name": "import", "user_id": "69a47775-6d89-4d38-ad38-acdb2928f6a1", "scopes": ["AUTHOR"]}`, http.StatusCreated},
+	}
+
+	var created map[string]interface{}
+	for _, sample := range samples {
+		rr := serve(h.Add, "POST", sample.payload, "")
+		if sample.statusCode != rr.Code {
+			t.Fatalf("\t%s\tWrong status code: want %v got %v", test.Failed, sample.statusCode, rr.Code)
+		}
+		t.Logf("\t%s\tStatus code correct: %v", test.Success, rr.Code)
+
+		if rr.Code == http.StatusCreated {
+			json.NewDecoder(rr.Body).Decode(&created)
+			if key, _ := created["key"].(string); !strings.HasPrefix(key, "bk_") {
+				t.Fatalf("\t%s\tKey missing from the response: %v", test.Failed, created)
+			}
+			t.Logf("\t%s\tResponse data correct", test.Success)
+		}
+	}
+
+	rr := serve(h.FindAll, "GET", "", "")
+	if rr.Code != http.StatusOK || strings.Contains(rr.Body.String(), created["key"].(string)) || strings.Contains(rr.Body.String(), `"key"`) {
+		t.Fatalf("\t%s\tListing shows the key: %s", test.Failed, rr.Body.String())
+	}
+	t.Logf("\t%s\tListing hides the key", test.Success)
+
+	if rr := serve(h.Delete, "DELETE", "", created["id"].(string)); rr.Code != http.StatusOK {
+		t.Fatalf("\t%s\tRevoking failed: %v", test.Failed, rr.Code)
+	}
+	if rr := serve(h.Delete, "DELETE", "", "abc"); rr.Code != http.StatusBadRequest {
+		t.Fatalf("\t%s\tInvalid ID: want 400 got %v", test.Failed, rr.Code)
+	}
+	t.Logf("\t%s\tKey revoked", test.Success)
+}
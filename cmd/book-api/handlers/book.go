@@ -2,30 +2,46 @@ package handlers
 
 import (
 	"net/http"
+	"strconv"
 	"strings"
 
 	"github.com/axwilliams/book-api/internal/business/book"
+	"github.com/axwilliams/book-api/internal/business/enrich"
+	"github.com/axwilliams/book-api/internal/business/tag"
+	"github.com/axwilliams/book-api/internal/platform/auth"
 	"github.com/axwilliams/book-api/internal/platform/web"
 	"github.com/gorilla/mux"
 )
 
 type BookHandler struct {
 	bs book.Service
+	es enrich.Service
 }
 
-func NewBookHandler(bs book.Service) BookHandler {
+func NewBookHandler(bs book.Service, es enrich.Service) BookHandler {
 	return BookHandler{
 		bs,
+		es,
 	}
 }
 
 func (h *BookHandler) FindAll(w http.ResponseWriter, r *http.Request) {
-	bks, err := h.bs.GetAll()
+	status := book.StatusPublished
+	if isEditor(r) {
+		status = strings.TrimSpace(r.URL.Query().Get("status"))
+	}
+
+	bks, err := h.bs.GetAll(status)
 	if err != nil {
 		web.RespondError(w, err)
 		return
 	}
 
+	if isAnonymous(r) {
+		web.Respond(w, book.Public(bks), http.StatusOK)
+		return
+	}
+
 	web.Respond(w, bks, http.StatusOK)
 }
 
@@ -38,6 +54,38 @@ func (h *BookHandler) FindById(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if err == book.ErrNoBookFound {
+		to, err := h.bs.Redirect(vars["id"])
+		if err != nil && err != book.ErrNoBookFound {
+			web.RespondError(w, err)
+			return
+		}
+
+		if to != "" {
+			u := *r.URL
+			u.Path = strings.TrimSuffix(u.Path, vars["id"]) + to
+			http.Redirect(w, r, u.String(), http.StatusPermanentRedirect)
+			return
+		}
+	}
+
+	if bk != nil && bk.Status != book.StatusPublished && !isEditor(r) {
+		bk = nil
+	}
+
+	if bk != nil && embeds(r, "relations") {
+		bk.Relations, err = h.bs.Relations(bk.ID, visibleStatus(r))
+		if err != nil {
+			web.RespondError(w, err)
+			return
+		}
+	}
+
+	if bk != nil && isAnonymous(r) {
+		web.Respond(w, bk.Public(), http.StatusOK)
+		return
+	}
+
 	web.Respond(w, bk, http.StatusOK)
 }
 
@@ -45,10 +93,18 @@ func (h *BookHandler) Search(w http.ResponseWriter, r *http.Request) {
 	q := r.URL.Query()
 
 	params := book.SearchParams{}
+	params.Query = strings.TrimSpace(q.Get("q"))
 	params.ISBN = strings.TrimSpace(q.Get("isbn"))
 	params.Title = strings.TrimSpace(q.Get("title"))
 	params.Author = strings.TrimSpace(q.Get("author"))
 	params.Category = strings.TrimSpace(q.Get("category"))
+	params.Status = book.StatusPublished
+	if isEditor(r) {
+		params.Status = strings.TrimSpace(q.Get("status"))
+	}
+	params.SeriesID = strings.TrimSpace(q.Get("series"))
+	params.Tags = tagParams(q["tags"])
+	params.TagMatch = strings.ToLower(strings.TrimSpace(q.Get("tags_match")))
 
 	sort := strings.TrimSpace(q.Get("sort"))
 	order := strings.TrimSpace(q.Get("order"))
@@ -61,6 +117,11 @@ func (h *BookHandler) Search(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if isAnonymous(r) {
+		web.Respond(w, book.Public(bks), http.StatusOK)
+		return
+	}
+
 	web.Respond(w, bks, http.StatusOK)
 }
 
@@ -72,7 +133,12 @@ func (h *BookHandler) Add(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	bk, err := h.bs.Create(&nb)
+	if ok, _ := strconv.ParseBool(r.URL.Query().Get("enrich")); ok {
+		h.addEnriched(w, &nb, subject(r))
+		return
+	}
+
+	bk, err := h.bs.Create(&nb, subject(r))
 	if err != nil {
 		web.RespondError(w, err)
 		return
@@ -90,7 +156,7 @@ func (h *BookHandler) Edit(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if err := h.bs.Update(vars["id"], ub); err != nil {
+	if err := h.bs.Update(vars["id"], ub, subject(r)); err != nil {
 		web.RespondError(w, err)
 		return
 	}
@@ -101,10 +167,176 @@ func (h *BookHandler) Edit(w http.ResponseWriter, r *http.Request) {
 func (h *BookHandler) Delete(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 
-	if err := h.bs.Destroy(vars["id"]); err != nil {
+	if err := h.bs.Destroy(vars["id"], subject(r)); err != nil {
+		web.RespondError(w, err)
+		return
+	}
+
+	web.Respond(w, nil, http.StatusOK)
+}
+
+func (h *BookHandler) Submit(w http.ResponseWriter, r *http.Request) {
+	h.transition(w, r, book.ActionSubmit, false)
+}
+
+func (h *BookHandler) Approve(w http.ResponseWriter, r *http.Request) {
+	h.transition(w, r, book.ActionApprove, true)
+}
+
+func (h *BookHandler) Reject(w http.ResponseWriter, r *http.Request) {
+	h.transition(w, r, book.ActionReject, true)
+}
+
+func (h *BookHandler) History(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+
+	ts, err := h.bs.History(vars["id"])
+	if err != nil {
+		web.RespondError(w, err)
+		return
+	}
+
+	web.Respond(w, ts, http.StatusOK)
+}
+
+func (h *BookHandler) Relations(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+
+	rls, err := h.bs.Relations(vars["id"], visibleStatus(r))
+	if err != nil {
+		web.RespondError(w, err)
+		return
+	}
+
+	web.Respond(w, rls, http.StatusOK)
+}
+
+func (h *BookHandler) Relate(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+
+	nr := book.NewRelation{}
+	if err := web.Decode(r, &nr); err != nil {
+		web.RespondError(w, err)
+		return
+	}
+
+	rl, err := h.bs.Relate(vars["id"], nr, subject(r))
+	if err != nil {
+		web.RespondError(w, err)
+		return
+	}
+
+	web.Respond(w, web.Message("id", rl.ID), http.StatusCreated)
+}
+
+func (h *BookHandler) Unrelate(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+
+	if err := h.bs.Unrelate(vars["id"], vars["relation"], subject(r)); err != nil {
+		web.RespondError(w, err)
+		return
+	}
+
+	web.Respond(w, nil, http.StatusOK)
+}
+
+func (h *BookHandler) Duplicates(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+
+	dups, err := h.bs.Duplicates(strings.TrimSpace(q.Get("min_score")), strings.TrimSpace(q.Get("limit")))
+	if err != nil {
+		web.RespondError(w, err)
+		return
+	}
+
+	web.Respond(w, dups, http.StatusOK)
+}
+
+func (h *BookHandler) Merge(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+
+	nm := book.NewMerge{}
+	if err := web.Decode(r, &nm); err != nil {
+		web.RespondError(w, err)
+		return
+	}
+
+	m, err := h.bs.Merge(vars["id"], nm.Source, subject(r))
+	if err != nil {
+		web.RespondError(w, err)
+		return
+	}
+
+	web.Respond(w, m, http.StatusOK)
+}
+
+func (h *BookHandler) transition(w http.ResponseWriter, r *http.Request, action string, review bool) {
+	vars := mux.Vars(r)
+
+	rv := book.Review{}
+	if review {
+		if err := web.Decode(r, &rv); err != nil {
+			web.RespondError(w, err)
+			return
+		}
+	}
+
+	if err := h.bs.Transition(vars["id"], action, subject(r), rv.Comment); err != nil {
 		web.RespondError(w, err)
 		return
 	}
 
 	web.Respond(w, nil, http.StatusOK)
 }
+
+// tagParams accepts tags both as repeated parameters and as a comma separated
+// list, normalized and without duplicates.
+func tagParams(values []string) []string {
+	seen := map[string]bool{}
+	tags := []string{}
+
+	for _, v := range values {
+		for _, name := range strings.Split(v, ",") {
+			name = tag.Normalize(name)
+			if name == "" || seen[name] {
+				continue
+			}
+			seen[name] = true
+			tags = append(tags, name)
+		}
+	}
+
+	return tags
+}
+
+// embeds reports whether the comma separated embed parameter asks for name.
+func embeds(r *http.Request, name string) bool {
+	for _, v := range strings.Split(r.URL.Query().Get("embed"), ",") {
+		if strings.TrimSpace(v) == name {
+			return true
+		}
+	}
+	return false
+}
+
+// visibleStatus is the status filter for books listed alongside another one:
+// editors see every status, everyone else only published books.
+func visibleStatus(r *http.Request) string {
+	if isEditor(r) {
+		return ""
+	}
+	return book.StatusPublished
+}
+
+// isEditor reports whether the requesting user may see books that have not
+// been published yet.
+func isEditor(r *http.Request) bool {
+	return auth.Can(r.Context(), auth.PermBooksDrafts)
+}
+
+// isAnonymous reports whether the request came through a public route
+// without a token.
+func isAnonymous(r *http.Request) bool {
+	_, ok := auth.UserFromContext(r.Context())
+	return !ok
+}
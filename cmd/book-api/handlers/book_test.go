@@ -3,12 +3,16 @@ package handlers_test
 import (
 	"bytes"
 	"encoding/json"
+	"io"
 	"net/http"
 	"net/http/httptest"
 	"testing"
 
 	"github.com/axwilliams/book-api/cmd/book-api/handlers"
 	"github.com/axwilliams/book-api/internal/business/book"
+	"github.com/axwilliams/book-api/internal/business/enrich"
+	"github.com/axwilliams/book-api/internal/platform/auth"
+	"github.com/axwilliams/book-api/internal/platform/policy"
 	"github.com/axwilliams/book-api/internal/test"
 	"github.com/axwilliams/book-api/internal/test/mock"
 	"github.com/gorilla/mux"
@@ -19,12 +23,31 @@ var bookHandler handlers.BookHandler
 
 func init() {
 	mockBook := mock.NewMockBook()
-	bookService := book.NewService(mockBook)
-	bookHandler = handlers.NewBookHandler(bookService)
+	bookService := book.NewService(mockBook, policy.NewEngine(""))
+
+	metadata, err := enrich.LoadFixtures("../../../internal/business/enrich/testdata/fixtures.json")
+	if err != nil {
+		panic(err)
+	}
+
+	bookHandler = handlers.NewBookHandler(bookService, enrich.NewService(bookService, metadata))
+}
+
+// newUserRequest builds a request as it would look after authentication for a
+// user without any roles.
+func newUserRequest(method, url string, body io.Reader) (*http.Request, error) {
+	r, err := http.NewRequest(method, url, body)
+	if err != nil {
+		return nil, err
+	}
+
+	claims := auth.Claims{UserID: "bad069ce-4afa-4a53-a673-14ae7b627d06", Roles: []string{}}
+
+	return r.WithContext(auth.ContextWithUser(r.Context(), claims)), nil
 }
 
 func TestFindAllBooks(t *testing.T) {
-	r, err := http.NewRequest("GET", "/api/v1/books", nil)
+	r, err := newUserRequest("GET", "/api/v1/books", nil)
 	if err != nil {
 		t.Errorf("\t%s\tRequest failed: %v\n", test.Failed, err)
 	}
@@ -39,7 +62,7 @@ func TestFindAllBooks(t *testing.T) {
 	t.Logf("\t%s\tStatus code correct: 200", test.Success)
 
 	res := rr.Body.String()
-	expected := `[{"id":"f4ac7e14-fc8e-4096-b956-34e5a33040f2","isbn":"978-0241372579","title":"The Castle","author":"Franz Kafka","category":"Fiction"},{"id":"71432eb9-58da-4eae-aa20-ccc49064246f","isbn":"978-1451673319","title":"Fahrenheit 451","author":"Ray Bradbury","category":"Fiction"},{"id":"562e1fe0-0dde-4717-a008-cd2a699301d2","isbn":"978-0465025275","title":"Six Easy Pieces","author":"Richard Feynman","category":"Science"}]`
+	expected := `[{"id":"f4ac7e14-fc8e-4096-b956-34e5a33040f2","isbn":"978-0241372579","title":"The Castle","author":"Franz Kafka","category":"Fiction","status":"published"},{"id":"71432eb9-58da-4eae-aa20-ccc49064246f","isbn":"978-1451673319","title":"Fahrenheit 451","author":"Ray Bradbury","category":"Fiction","status":"published"},{"id":"562e1fe0-0dde-4717-a008-cd2a699301d2","isbn":"978-0465025275","title":"Six Easy Pieces","author":"Richard Feynman","category":"Science","status":"published"}]`
 	if res != expected {
 		t.Fatalf("\t%s\tWrong response: want %v got %v", test.Failed, expected, res)
 	}
@@ -64,16 +87,22 @@ func TestFindBookById(t *testing.T) {
 			statusCode: http.StatusOK,
 			expected:   "",
 		},
+		// Not published
+		{
+			id:         "d2b4a1c7-5e33-4b8a-9c1e-6f0d3a2b7c91",
+			statusCode: http.StatusOK,
+			expected:   "",
+		},
 		// Success
 		{
 			id:         "f4ac7e14-fc8e-4096-b956-34e5a33040f2",
 			statusCode: http.StatusOK,
-			expected:   `{"id":"f4ac7e14-fc8e-4096-b956-34e5a33040f2","isbn":"978-0241372579","title":"The Castle","author":"Franz Kafka","category":"Fiction"}`,
+			expected:   `{"id":"f4ac7e14-fc8e-4096-b956-34e5a33040f2","isbn":"978-0241372579","title":"The Castle","author":"Franz Kafka","category":"Fiction","status":"published"}`,
 		},
 	}
 
 	for _, sample := range samples {
-		r, err := http.NewRequest("GET", "/api/v1/books", nil)
+		r, err := newUserRequest("GET", "/api/v1/books", nil)
 		if err != nil {
 			t.Errorf("\t%s\tRequest failed: %v\n", test.Failed, err)
 		}
@@ -108,42 +137,42 @@ func TestSearchBook(t *testing.T) {
 		{
 			query:      map[string]string{"isbn": "978-0241372579"},
 			statusCode: http.StatusOK,
-			expected:   `[{"id":"f4ac7e14-fc8e-4096-b956-34e5a33040f2","isbn":"978-0241372579","title":"The Castle","author":"Franz Kafka","category":"Fiction"}]`,
+			expected:   `[{"id":"f4ac7e14-fc8e-4096-b956-34e5a33040f2","isbn":"978-0241372579","title":"The Castle","author":"Franz Kafka","category":"Fiction","status":"published"}]`,
 		},
 		// Title found
 		{
 			query:      map[string]string{"title": "The Castle"},
 			statusCode: http.StatusOK,
-			expected:   `[{"id":"f4ac7e14-fc8e-4096-b956-34e5a33040f2","isbn":"978-0241372579","title":"The Castle","author":"Franz Kafka","category":"Fiction"}]`,
+			expected:   `[{"id":"f4ac7e14-fc8e-4096-b956-34e5a33040f2","isbn":"978-0241372579","title":"The Castle","author":"Franz Kafka","category":"Fiction","status":"published"}]`,
 		},
 		// Author found
 		{
 			query:      map[string]string{"author": "Franz Kafka"},
 			statusCode: http.StatusOK,
-			expected:   `[{"id":"f4ac7e14-fc8e-4096-b956-34e5a33040f2","isbn":"978-0241372579","title":"The Castle","author":"Franz Kafka","category":"Fiction"}]`,
+			expected:   `[{"id":"f4ac7e14-fc8e-4096-b956-34e5a33040f2","isbn":"978-0241372579","title":"The Castle","author":"Franz Kafka","category":"Fiction","status":"published"}]`,
 		},
 		// Category found
 		{
 			query:      map[string]string{"category": "Fiction"},
 			statusCode: http.StatusOK,
-			expected:   `[{"id":"f4ac7e14-fc8e-4096-b956-34e5a33040f2","isbn":"978-0241372579","title":"The Castle","author":"Franz Kafka","category":"Fiction"},{"id":"71432eb9-58da-4eae-aa20-ccc49064246f","isbn":"978-1451673319","title":"Fahrenheit 451","author":"Ray Bradbury","category":"Fiction"}]`,
+			expected:   `[{"id":"f4ac7e14-fc8e-4096-b956-34e5a33040f2","isbn":"978-0241372579","title":"The Castle","author":"Franz Kafka","category":"Fiction","status":"published"},{"id":"71432eb9-58da-4eae-aa20-ccc49064246f","isbn":"978-1451673319","title":"Fahrenheit 451","author":"Ray Bradbury","category":"Fiction","status":"published"}]`,
 		},
 		// Sort order
 		{
 			query:      map[string]string{"sort": "author", "order": "desc"},
 			statusCode: http.StatusOK,
-			expected:   `[{"id":"f4ac7e14-fc8e-4096-b956-34e5a33040f2","isbn":"978-0241372579","title":"The Castle","author":"Franz Kafka","category":"Fiction"},{"id":"562e1fe0-0dde-4717-a008-cd2a699301d2","isbn":"978-0465025275","title":"Six Easy Pieces","author":"Richard Feynman","category":"Science"},{"id":"71432eb9-58da-4eae-aa20-ccc49064246f","isbn":"978-1451673319","title":"Fahrenheit 451","author":"Ray Bradbury","category":"Fiction"}]`,
+			expected:   `[{"id":"f4ac7e14-fc8e-4096-b956-34e5a33040f2","isbn":"978-0241372579","title":"The Castle","author":"Franz Kafka","category":"Fiction","status":"published"},{"id":"562e1fe0-0dde-4717-a008-cd2a699301d2","isbn":"978-0465025275","title":"Six Easy Pieces","author":"Richard Feynman","category":"Science","status":"published"},{"id":"71432eb9-58da-4eae-aa20-ccc49064246f","isbn":"978-1451673319","title":"Fahrenheit 451","author":"Ray Bradbury","category":"Fiction","status":"published"}]`,
 		},
 		// Limit and offset
 		{
 			query:      map[string]string{"limit": "2", "offset": "1"},
 			statusCode: http.StatusOK,
-			expected:   `[{"id":"71432eb9-58da-4eae-aa20-ccc49064246f","isbn":"978-1451673319","title":"Fahrenheit 451","author":"Ray Bradbury","category":"Fiction"},{"id":"562e1fe0-0dde-4717-a008-cd2a699301d2","isbn":"978-0465025275","title":"Six Easy Pieces","author":"Richard Feynman","category":"Science"}]`,
+			expected:   `[{"id":"71432eb9-58da-4eae-aa20-ccc49064246f","isbn":"978-1451673319","title":"Fahrenheit 451","author":"Ray Bradbury","category":"Fiction","status":"published"},{"id":"562e1fe0-0dde-4717-a008-cd2a699301d2","isbn":"978-0465025275","title":"Six Easy Pieces","author":"Richard Feynman","category":"Science","status":"published"}]`,
 		},
 	}
 
 	for _, sample := range samples {
-		r, err := http.NewRequest("GET", "/api/v1/search/books", nil)
+		r, err := newUserRequest("GET", "/api/v1/search/books", nil)
 		if err != nil {
 			t.Errorf("\t%s\tRequest failed: %v\n", test.Failed, err)
 		}
@@ -213,6 +242,24 @@ func TestAddBook(t *testing.T) {
 			statusCode: http.StatusUnprocessableEntity,
 			expected:   `{"message":"Validation failed","errors":["author is a required field"]}`,
 		},
+		// Unknown series
+		{
+			payload:    `{"isbn":"978-0099448792","title":"The Wind-Up Bird Chronicle","author":"Haruki Murakami","series_id":"7b6807c2-1e11-4e38-bdfd-281186885c3f","series_position":1}`,
+			statusCode: http.StatusUnprocessableEntity,
+			expected:   `{"message":"` + book.ErrNoSeriesFound.Error() + `"}`,
+		},
+		// Position without series
+		{
+			payload:    `{"isbn":"978-0099448792","title":"The Wind-Up Bird Chronicle","author":"Haruki Murakami","series_position":2.5}`,
+			statusCode: http.StatusUnprocessableEntity,
+			expected:   `{"message":"` + book.ErrPositionNoSeries.Error() + `"}`,
+		},
+		// Valid insert in a series
+		{
+			payload:    `{"isbn":"978-0099448792","title":"The Wind-Up Bird Chronicle","author":"Haruki Murakami","series_id":"3c9d2e71-6b4a-4f8e-9d0c-1a2b3c4d5e6f","series_position":2.5}`,
+			statusCode: http.StatusCreated,
+			expected:   "",
+		},
 		// Valid insert
 		{
 			payload:    `{"isbn":"978-0099448792","title":"The Wind-Up Bird Chronicle","author":"Haruki Murakami","category":"Fiction"}`,
@@ -222,7 +269,7 @@ func TestAddBook(t *testing.T) {
 	}
 
 	for _, sample := range samples {
-		r, err := http.NewRequest("POST", "/api/v1/books", bytes.NewBufferString(sample.payload))
+		r, err := newUserRequest("POST", "/api/v1/books", bytes.NewBufferString(sample.payload))
 		if err != nil {
 			t.Errorf("\t%s\tRequest failed: %v\n", test.Failed, err)
 		}
@@ -309,7 +356,7 @@ func TestEditBook(t *testing.T) {
 	}
 
 	for _, sample := range samples {
-		r, err := http.NewRequest("PATCH", "/api/v1/books", bytes.NewBufferString(sample.payload))
+		r, err := newUserRequest("PATCH", "/api/v1/books", bytes.NewBufferString(sample.payload))
 		if err != nil {
 			t.Errorf("\t%s\tRequest failed: %v\n", test.Failed, err)
 		}
@@ -361,7 +408,7 @@ func TestDeleteBook(t *testing.T) {
 	}
 
 	for _, sample := range samples {
-		r, err := http.NewRequest("DELETE", "/api/v1/books", nil)
+		r, err := newUserRequest("DELETE", "/api/v1/books", nil)
 		if err != nil {
 			t.Errorf("\t%s\tRequest failed: %v\n", test.Failed, err)
 		}
@@ -384,3 +431,366 @@ func TestDeleteBook(t *testing.T) {
 		t.Logf("\t%s\tResponse data correct", test.Success)
 	}
 }
+
+func TestReviewBook(t *testing.T) {
+	samples := []struct {
+		id         string
+		handler    http.HandlerFunc
+		payload    string
+		statusCode int
+		expected   string
+	}{
+		// Invalid ID
+		{
+			id:         "f4ac7e14-fc8e-4096-b956-34e5a",
+			handler:    bookHandler.Submit,
+			statusCode: http.StatusBadRequest,
+			expected:   `{"message":"` + book.ErrInvalidID.Error() + `"}`,
+		},
+		// Not found
+		{
+			id:         "7b6807c2-1e11-4e38-bdfd-281186885c3f",
+			handler:    bookHandler.Submit,
+			statusCode: http.StatusGone,
+			expected:   `{"message":"` + book.ErrNoAffect.Error() + `"}`,
+		},
+		// Already published
+		{
+			id:         "f4ac7e14-fc8e-4096-b956-34e5a33040f2",
+			handler:    bookHandler.Submit,
+			statusCode: http.StatusConflict,
+			expected:   `{"message":"` + book.ErrInvalidTransition.Error() + `"}`,
+		},
+		// Reject without comment
+		{
+			id:         "d2b4a1c7-5e33-4b8a-9c1e-6f0d3a2b7c91",
+			handler:    bookHandler.Reject,
+			payload:    `{"comment":""}`,
+			statusCode: http.StatusUnprocessableEntity,
+			expected:   `{"message":"` + book.ErrCommentRequired.Error() + `"}`,
+		},
+		// Reject
+		{
+			id:         "d2b4a1c7-5e33-4b8a-9c1e-6f0d3a2b7c91",
+			handler:    bookHandler.Reject,
+			payload:    `{"comment":"Wrong ISBN"}`,
+			statusCode: http.StatusOK,
+			expected:   "",
+		},
+		// Approve
+		{
+			id:         "d2b4a1c7-5e33-4b8a-9c1e-6f0d3a2b7c91",
+			handler:    bookHandler.Approve,
+			payload:    `{}`,
+			statusCode: http.StatusOK,
+			expected:   "",
+		},
+	}
+
+	for _, sample := range samples {
+		r, err := newUserRequest("POST", "/api/v1/books", bytes.NewBufferString(sample.payload))
+		if err != nil {
+			t.Errorf("\t%s\tRequest failed: %v\n", test.Failed, err)
+		}
+
+		r = mux.SetURLVars(r, map[string]string{"id": sample.id})
+
+		rr := httptest.NewRecorder()
+		sample.handler.ServeHTTP(rr, r)
+
+		if sample.statusCode != rr.Code {
+			t.Fatalf("\t%s\tWrong status code: want %v got %v", test.Failed, sample.statusCode, rr.Code)
+		}
+		t.Logf("\t%s\tStatus code correct: %v", test.Success, rr.Code)
+
+		res := rr.Body.String()
+		if res != sample.expected {
+			t.Fatalf("\t%s\tWrong response: want %v got %v", test.Failed, sample.expected, res)
+		}
+		t.Logf("\t%s\tResponse data correct", test.Success)
+	}
+}
+
+func TestBookRelations(t *testing.T) {
+	samples := []struct {
+		id         string
+		relation   string
+		handler    http.HandlerFunc
+		path       string
+		payload    string
+		statusCode int
+		expected   string
+	}{
+		// Invalid ID
+		{
+			id:         "f4ac7e14-fc8e-4096-b956-34e5a33040f2",
+			handler:    bookHandler.Relate,
+			payload:    `{"type":"sequel_of","book_id":"d2b4a1c7-5e33"}`,
+			statusCode: http.StatusBadRequest,
+			expected:   `{"message":"` + book.ErrInvalidID.Error() + `"}`,
+		},
+		// Unknown type
+		{
+			id:         "f4ac7e14-fc8e-4096-b956-34e5a33040f2",
+			handler:    bookHandler.Relate,
+			payload:    `{"type":"parody_of","book_id":"d2b4a1c7-5e33-4b8a-9c1e-6f0d3a2b7c91"}`,
+			statusCode: http.StatusBadRequest,
+			expected:   `{"message":"` + book.ErrInvalidRelation.Error() + `"}`,
+		},
+		// Self
+		{
+			id:         "f4ac7e14-fc8e-4096-b956-34e5a33040f2",
+			handler:    bookHandler.Relate,
+			payload:    `{"type":"companion_to","book_id":"f4ac7e14-fc8e-4096-b956-34e5a33040f2"}`,
+			statusCode: http.StatusUnprocessableEntity,
+			expected:   `{"message":"` + book.ErrSelfRelation.Error() + `"}`,
+		},
+		// Related book not found
+		{
+			id:         "f4ac7e14-fc8e-4096-b956-34e5a33040f2",
+			handler:    bookHandler.Relate,
+			payload:    `{"type":"companion_to","book_id":"7b6807c2-1e11-4e38-bdfd-281186885c3f"}`,
+			statusCode: http.StatusUnprocessableEntity,
+			expected:   `{"message":"` + book.ErrNoRelatedBook.Error() + `"}`,
+		},
+		// Already related
+		{
+			id:         "f4ac7e14-fc8e-4096-b956-34e5a33040f2",
+			handler:    bookHandler.Relate,
+			payload:    `{"type":"companion_to","book_id":"d2b4a1c7-5e33-4b8a-9c1e-6f0d3a2b7c91"}`,
+			statusCode: http.StatusConflict,
+			expected:   `{"message":"` + book.ErrRelationExists.Error() + `"}`,
+		},
+		// Sequel cycle
+		{
+			id:         "f4ac7e14-fc8e-4096-b956-34e5a33040f2",
+			handler:    bookHandler.Relate,
+			payload:    `{"type":"sequel_of","book_id":"d2b4a1c7-5e33-4b8a-9c1e-6f0d3a2b7c91"}`,
+			statusCode: http.StatusUnprocessableEntity,
+			expected:   `{"message":"` + book.ErrSequelCycle.Error() + `"}`,
+		},
+		// Prequel, stored from the other book
+		{
+			id:         "f4ac7e14-fc8e-4096-b956-34e5a33040f2",
+			handler:    bookHandler.Relate,
+			payload:    `{"type":"prequel_of","book_id":"d2b4a1c7-5e33-4b8a-9c1e-6f0d3a2b7c91"}`,
+			statusCode: http.StatusCreated,
+		},
+		// Remove unknown
+		{
+			id:         "f4ac7e14-fc8e-4096-b956-34e5a33040f2",
+			relation:   "7b6807c2-1e11-4e38-bdfd-281186885c3f",
+			handler:    bookHandler.Unrelate,
+			statusCode: http.StatusGone,
+			expected:   `{"message":"` + book.ErrNoAffect.Error() + `"}`,
+		},
+		// Remove
+		{
+			id:         "f4ac7e14-fc8e-4096-b956-34e5a33040f2",
+			relation:   "5b1e9c0a-2f4d-4c3b-8a6e-7d9f0e1a2b3c",
+			handler:    bookHandler.Unrelate,
+			statusCode: http.StatusOK,
+			expected:   "",
+		},
+		// Embedded, published only
+		{
+			id:         "f4ac7e14-fc8e-4096-b956-34e5a33040f2",
+			handler:    bookHandler.FindById,
+			path:       "/api/v1/books?embed=relations",
+			statusCode: http.StatusOK,
+			expected:   `{"id":"f4ac7e14-fc8e-4096-b956-34e5a33040f2","isbn":"978-0241372579","title":"The Castle","author":"Franz Kafka","category":"Fiction","status":"published","relations":[{"id":"5b1e9c0a-2f4d-4c3b-8a6e-7d9f0e1a2b3c","type":"companion_to","book_id":"71432eb9-58da-4eae-aa20-ccc49064246f","book":{"id":"71432eb9-58da-4eae-aa20-ccc49064246f","isbn":"978-1451673319","title":"Fahrenheit 451","author":"Ray Bradbury","category":"Fiction","status":"published"}}]}`,
+		},
+	}
+
+	for _, sample := range samples {
+		path := sample.path
+		if path == "" {
+			path = "/api/v1/books"
+		}
+
+		r, err := newUserRequest("POST", path, bytes.NewBufferString(sample.payload))
+		if err != nil {
+			t.Errorf("\t%s\tRequest failed: %v\n", test.Failed, err)
+		}
+
+		r = mux.SetURLVars(r, map[string]string{"id": sample.id, "relation": sample.relation})
+
+		rr := httptest.NewRecorder()
+		sample.handler.ServeHTTP(rr, r)
+
+		if sample.statusCode != rr.Code {
+			t.Fatalf("\t%s\tWrong status code: want %v got %v", test.Failed, sample.statusCode, rr.Code)
+		}
+		t.Logf("\t%s\tStatus code correct: %v", test.Success, rr.Code)
+
+		res := rr.Body.String()
+		if sample.expected != "" && res != sample.expected {
+			t.Fatalf("\t%s\tWrong response: want %v got %v", test.Failed, sample.expected, res)
+		}
+		t.Logf("\t%s\tResponse data correct", test.Success)
+	}
+}
+
+func TestMergeBook(t *testing.T) {
+	samples := []struct {
+		id         string
+		payload    string
+		statusCode int
+		expected   string
+	}{
+		// Invalid source ID
+		{
+			id:         "f4ac7e14-fc8e-4096-b956-34e5a33040f2",
+			payload:    `{"source":"d2b4a1c7"}`,
+			statusCode: http.StatusBadRequest,
+			expected:   `{"message":"` + book.ErrInvalidID.Error() + `"}`,
+		},
+		// Into itself
+		{
+			id:         "f4ac7e14-fc8e-4096-b956-34e5a33040f2",
+			payload:    `{"source":"f4ac7e14-fc8e-4096-b956-34e5a33040f2"}`,
+			statusCode: http.StatusUnprocessableEntity,
+			expected:   `{"message":"` + book.ErrMergeSelf.Error() + `"}`,
+		},
+		// Target not found
+		{
+			id:         "7b6807c2-1e11-4e38-bdfd-281186885c3f",
+			payload:    `{"source":"d2b4a1c7-5e33-4b8a-9c1e-6f0d3a2b7c91"}`,
+			statusCode: http.StatusGone,
+			expected:   `{"message":"` + book.ErrNoAffect.Error() + `"}`,
+		},
+		// Source not found
+		{
+			id:         "f4ac7e14-fc8e-4096-b956-34e5a33040f2",
+			payload:    `{"source":"7b6807c2-1e11-4e38-bdfd-281186885c3f"}`,
+			statusCode: http.StatusUnprocessableEntity,
+			expected:   `{"message":"` + book.ErrNoMergeSource.Error() + `"}`,
+		},
+		// Merged
+		{
+			id:         "f4ac7e14-fc8e-4096-b956-34e5a33040f2",
+			payload:    `{"source":"d2b4a1c7-5e33-4b8a-9c1e-6f0d3a2b7c91"}`,
+			statusCode: http.StatusOK,
+		},
+	}
+
+	for _, sample := range samples {
+		r, err := newUserRequest("POST", "/api/v1/books", bytes.NewBufferString(sample.payload))
+		if err != nil {
+			t.Errorf("\t%s\tRequest failed: %v\n", test.Failed, err)
+		}
+
+		r = mux.SetURLVars(r, map[string]string{"id": sample.id})
+
+		rr := httptest.NewRecorder()
+		h := http.HandlerFunc(bookHandler.Merge)
+		h.ServeHTTP(rr, r)
+
+		if sample.statusCode != rr.Code {
+			t.Fatalf("\t%s\tWrong status code: want %v got %v", test.Failed, sample.statusCode, rr.Code)
+		}
+		t.Logf("\t%s\tStatus code correct: %v", test.Success, rr.Code)
+
+		res := rr.Body.String()
+		if sample.expected != "" && res != sample.expected {
+			t.Fatalf("\t%s\tWrong response: want %v got %v", test.Failed, sample.expected, res)
+		}
+		t.Logf("\t%s\tResponse data correct", test.Success)
+
+		if sample.statusCode == http.StatusOK {
+			var m book.Merge
+			if err := json.NewDecoder(rr.Body).Decode(&m); err != nil {
+				t.Fatalf("\t%s\tFailed to decode JSON response: %v", test.Failed, err)
+			}
+			if m.TargetID != sample.id || m.Source.Title != "The Trial" {
+				t.Fatalf("\t%s\tWrong merge: got %+v", test.Failed, m)
+			}
+			t.Logf("\t%s\tMerge recorded", test.Success)
+		}
+	}
+}
+
+func TestMergedBookRedirect(t *testing.T) {
+	r, err := newUserRequest("GET", "/api/v1/books/9a3f5c2e-8b1d-4e6f-a7c9-0d2e4f6a8b1c?embed=relations", nil)
+	if err != nil {
+		t.Errorf("\t%s\tRequest failed: %v\n", test.Failed, err)
+	}
+
+	r = mux.SetURLVars(r, map[string]string{"id": "9a3f5c2e-8b1d-4e6f-a7c9-0d2e4f6a8b1c"})
+
+	rr := httptest.NewRecorder()
+	h := http.HandlerFunc(bookHandler.FindById)
+	h.ServeHTTP(rr, r)
+
+	if rr.Code != http.StatusPermanentRedirect {
+		t.Fatalf("\t%s\tWrong status code: want %v got %v", test.Failed, http.StatusPermanentRedirect, rr.Code)
+	}
+	t.Logf("\t%s\tStatus code correct: %v", test.Success, rr.Code)
+
+	expected := "/api/v1/books/f4ac7e14-fc8e-4096-b956-34e5a33040f2?embed=relations"
+	if loc := rr.Header().Get("Location"); loc != expected {
+		t.Fatalf("\t%s\tWrong location: want %v got %v", test.Failed, expected, loc)
+	}
+	t.Logf("\t%s\tRedirected to the surviving book", test.Success)
+}
+
+func TestAnonymousBooks(t *testing.T) {
+	samples := []struct {
+		path     string
+		vars     map[string]string
+		handler  http.HandlerFunc
+		expected string
+	}{
+		// List
+		{
+			path:     "/api/v1/books",
+			handler:  bookHandler.FindAll,
+			expected: `[{"id":"f4ac7e14-fc8e-4096-b956-34e5a33040f2","isbn":"978-0241372579","title":"The Castle","author":"Franz Kafka","category":"Fiction"},{"id":"71432eb9-58da-4eae-aa20-ccc49064246f","isbn":"978-1451673319","title":"Fahrenheit 451","author":"Ray Bradbury","category":"Fiction"},{"id":"562e1fe0-0dde-4717-a008-cd2a699301d2","isbn":"978-0465025275","title":"Six Easy Pieces","author":"Richard Feynman","category":"Science"}]`,
+		},
+		// Published
+		{
+			path:     "/api/v1/books",
+			vars:     map[string]string{"id": "f4ac7e14-fc8e-4096-b956-34e5a33040f2"},
+			handler:  bookHandler.FindById,
+			expected: `{"id":"f4ac7e14-fc8e-4096-b956-34e5a33040f2","isbn":"978-0241372579","title":"The Castle","author":"Franz Kafka","category":"Fiction"}`,
+		},
+		// Not published
+		{
+			path:     "/api/v1/books",
+			vars:     map[string]string{"id": "d2b4a1c7-5e33-4b8a-9c1e-6f0d3a2b7c91"},
+			handler:  bookHandler.FindById,
+			expected: "",
+		},
+		// Search
+		{
+			path:     "/api/v1/search/books?isbn=978-0241372579",
+			handler:  bookHandler.Search,
+			expected: `[{"id":"f4ac7e14-fc8e-4096-b956-34e5a33040f2","isbn":"978-0241372579","title":"The Castle","author":"Franz Kafka","category":"Fiction"}]`,
+		},
+	}
+
+	for _, sample := range samples {
+		r, err := http.NewRequest("GET", sample.path, nil)
+		if err != nil {
+			t.Errorf("\t%s\tRequest failed: %v\n", test.Failed, err)
+		}
+
+		if sample.vars != nil {
+			r = mux.SetURLVars(r, sample.vars)
+		}
+
+		rr := httptest.NewRecorder()
+		sample.handler.ServeHTTP(rr, r)
+
+		if rr.Code != http.StatusOK {
+			t.Fatalf("\t%s\tWrong status code: want %v got %v", test.Failed, http.StatusOK, rr.Code)
+		}
+		t.Logf("\t%s\tStatus code correct: %v", test.Success, rr.Code)
+
+		res := rr.Body.String()
+		if res != sample.expected {
+			t.Fatalf("\t%s\tWrong response: want %v got %v", test.Failed, sample.expected, res)
+		}
+		t.Logf("\t%s\tReduced fields returned", test.Success)
+	}
+}
@@ -0,0 +1,72 @@
+package handlers
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/axwilliams/book-api/internal/business/citation"
+	"github.com/axwilliams/book-api/internal/platform/web"
+	"github.com/gorilla/mux"
+)
+
+type CitationHandler struct {
+	cs citation.Service
+}
+
+func NewCitationHandler(cs citation.Service) CitationHandler {
+	return CitationHandler{
+		cs,
+	}
+}
+
+func (h *CitationHandler) Cite(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	q := r.URL.Query()
+
+	req := citation.Request{
+		Style:  q.Get("style"),
+		Format: q.Get("format"),
+		HTML:   wantsHTML(r),
+	}
+
+	c, err := h.cs.Cite(vars["id"], req, visibleStatus(r))
+	if err != nil {
+		web.RespondError(w, err)
+		return
+	}
+
+	writeCitation(w, c)
+}
+
+func (h *CitationHandler) Bibliography(w http.ResponseWriter, r *http.Request) {
+	nb := citation.NewBibliography{}
+	if err := web.Decode(r, &nb); err != nil {
+		web.RespondError(w, err)
+		return
+	}
+
+	req := citation.Request{
+		Style:  nb.Style,
+		Format: nb.Format,
+		HTML:   wantsHTML(r),
+	}
+
+	c, err := h.cs.Bibliography(nb.IDs, req, visibleStatus(r))
+	if err != nil {
+		web.RespondError(w, err)
+		return
+	}
+
+	writeCitation(w, c)
+}
+
+// wantsHTML reports whether the client prefers HTML to plain text.
+func wantsHTML(r *http.Request) bool {
+	return strings.Contains(r.Header.Get("Accept"), "text/html")
+}
+
+func writeCitation(w http.ResponseWriter, c *citation.Citation) {
+	w.Header().Set("Content-Type", c.ContentType)
+	w.WriteHeader(http.StatusOK)
+	w.Write(c.Body)
+}
@@ -0,0 +1,160 @@
+package handlers_test
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/axwilliams/book-api/cmd/book-api/handlers"
+	"github.com/axwilliams/book-api/internal/business/book"
+	"github.com/axwilliams/book-api/internal/business/citation"
+	"github.com/axwilliams/book-api/internal/test"
+	"github.com/axwilliams/book-api/internal/test/mock"
+	"github.com/gorilla/mux"
+)
+
+var citationHandler handlers.CitationHandler
+
+func init() {
+	citationService := citation.NewService(mock.NewMockBook())
+	citationHandler = handlers.NewCitationHandler(citationService)
+}
+
+func TestCite(t *testing.T) {
+	samples := []struct {
+		id          string
+		query       string
+		accept      string
+		statusCode  int
+		contentType string
+		expected    string
+	}{
+		// Invalid ID
+		{
+			id:         "f4ac7e14",
+			statusCode: http.StatusBadRequest,
+			expected:   `{"message":"` + book.ErrInvalidID.Error() + `"}`,
+		},
+		// Unknown style
+		{
+			id:         "f4ac7e14-fc8e-4096-b956-34e5a33040f2",
+			query:      "?style=harvard",
+			statusCode: http.StatusBadRequest,
+			expected:   `{"message":"` + citation.ErrInvalidStyle.Error() + `"}`,
+		},
+		// Style and format
+		{
+			id:         "f4ac7e14-fc8e-4096-b956-34e5a33040f2",
+			query:      "?style=apa&format=ris",
+			statusCode: http.StatusBadRequest,
+			expected:   `{"message":"` + citation.ErrStyleOrFormat.Error() + `"}`,
+		},
+		// Not published
+		{
+			id:         "d2b4a1c7-5e33-4b8a-9c1e-6f0d3a2b7c91",
+			statusCode: http.StatusNotFound,
+			expected:   `{"message":"` + book.ErrNoBookFound.Error() + `"}`,
+		},
+		// Default style
+		{
+			id:          "f4ac7e14-fc8e-4096-b956-34e5a33040f2",
+			statusCode:  http.StatusOK,
+			contentType: citation.ContentTypeText,
+			expected:    "Kafka, F. (n.d.). The Castle.\n",
+		},
+		// HTML
+		{
+			id:          "f4ac7e14-fc8e-4096-b956-34e5a33040f2",
+			query:       "?style=chicago",
+			accept:      "text/html",
+			statusCode:  http.StatusOK,
+			contentType: citation.ContentTypeHTML,
+			expected:    "<div class=\"csl-bib-body\">\n  <div class=\"csl-entry\">Kafka, Franz. <i>The Castle.</i> n.d.</div>\n</div>\n",
+		},
+		// Machine format
+		{
+			id:          "f4ac7e14-fc8e-4096-b956-34e5a33040f2",
+			query:       "?format=ris",
+			statusCode:  http.StatusOK,
+			contentType: citation.ContentTypeRIS,
+			expected:    "TY  - BOOK\r\nID  - f4ac7e14-fc8e-4096-b956-34e5a33040f2\r\nAU  - Kafka, Franz\r\nTI  - The Castle\r\nSN  - 978-0241372579\r\nKW  - Fiction\r\nER  - \r\n",
+		},
+	}
+
+	for _, sample := range samples {
+		r, err := newUserRequest("GET", "/api/v1/books/"+sample.id+"/cite"+sample.query, nil)
+		if err != nil {
+			t.Errorf("\t%s\tRequest failed: %v\n", test.Failed, err)
+		}
+
+		r.Header.Set("Accept", sample.accept)
+		r = mux.SetURLVars(r, map[string]string{"id": sample.id})
+
+		rr := httptest.NewRecorder()
+		h := http.HandlerFunc(citationHandler.Cite)
+		h.ServeHTTP(rr, r)
+
+		if sample.statusCode != rr.Code {
+			t.Fatalf("\t%s\tWrong status code: want %v got %v", test.Failed, sample.statusCode, rr.Code)
+		}
+		t.Logf("\t%s\tStatus code correct: %v", test.Success, rr.Code)
+
+		if sample.contentType != "" && rr.Header().Get("Content-Type") != sample.contentType {
+			t.Fatalf("\t%s\tWrong content type: want %v got %v", test.Failed, sample.contentType, rr.Header().Get("Content-Type"))
+		}
+
+		if res := rr.Body.String(); res != sample.expected {
+			t.Fatalf("\t%s\tWrong response: want %q got %q", test.Failed, sample.expected, res)
+		}
+		t.Logf("\t%s\tResponse data correct", test.Success)
+	}
+}
+
+func TestBibliography(t *testing.T) {
+	samples := []struct {
+		payload    string
+		statusCode int
+		expected   string
+	}{
+		// No books
+		{
+			payload:    `{"ids":[]}`,
+			statusCode: http.StatusUnprocessableEntity,
+			expected:   `{"message":"` + citation.ErrNoBooks.Error() + `"}`,
+		},
+		// Unknown book
+		{
+			payload:    `{"ids":["f4ac7e14-fc8e-4096-b956-34e5a33040f2","7b6807c2-1e11-4e38-bdfd-281186885c3f"]}`,
+			statusCode: http.StatusUnprocessableEntity,
+			expected:   `{"message":"` + citation.ErrUnknownBooks.Error() + `"}`,
+		},
+		// Duplicates cited once
+		{
+			payload:    `{"ids":["f4ac7e14-fc8e-4096-b956-34e5a33040f2","f4ac7e14-fc8e-4096-b956-34e5a33040f2"],"style":"mla"}`,
+			statusCode: http.StatusOK,
+			expected:   "Kafka, Franz. The Castle.\n",
+		},
+	}
+
+	for _, sample := range samples {
+		r, err := newUserRequest("POST", "/api/v1/cite", bytes.NewBufferString(sample.payload))
+		if err != nil {
+			t.Errorf("\t%s\tRequest failed: %v\n", test.Failed, err)
+		}
+
+		rr := httptest.NewRecorder()
+		h := http.HandlerFunc(citationHandler.Bibliography)
+		h.ServeHTTP(rr, r)
+
+		if sample.statusCode != rr.Code {
+			t.Fatalf("\t%s\tWrong status code: want %v got %v", test.Failed, sample.statusCode, rr.Code)
+		}
+		t.Logf("\t%s\tStatus code correct: %v", test.Success, rr.Code)
+
+		if res := rr.Body.String(); res != sample.expected {
+			t.Fatalf("\t%s\tWrong response: want %q got %q", test.Failed, sample.expected, res)
+		}
+		t.Logf("\t%s\tResponse data correct", test.Success)
+	}
+}
@@ -0,0 +1,48 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/axwilliams/book-api/internal/business/book"
+	"github.com/axwilliams/book-api/internal/business/enrich"
+	"github.com/axwilliams/book-api/internal/platform/policy"
+	"github.com/axwilliams/book-api/internal/platform/web"
+	"github.com/gorilla/mux"
+)
+
+// Enrich lists what the metadata provider suggests for a book. Fields named
+// in an optional {"accept": [...]} body are applied.
+func (h *BookHandler) Enrich(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+
+	acc := enrich.Accept{}
+	if r.ContentLength != 0 {
+		if err := web.Decode(r, &acc); err != nil {
+			web.RespondError(w, err)
+			return
+		}
+	}
+
+	en, err := h.es.Enrich(vars["id"], acc.Fields, subject(r))
+	if err != nil {
+		web.RespondError(w, err)
+		return
+	}
+
+	web.Respond(w, en, http.StatusOK)
+}
+
+// addEnriched creates a book with its empty fields filled from the metadata
+// provider and answers with the remaining suggestions next to its ID.
+func (h *BookHandler) addEnriched(w http.ResponseWriter, nb *book.NewBook, sub policy.Subject) {
+	bk, en, err := h.es.Create(nb, sub)
+	if err != nil {
+		web.RespondError(w, err)
+		return
+	}
+
+	web.Respond(w, struct {
+		ID         string             `json:"id"`
+		Enrichment *enrich.Enrichment `json:"enrichment"`
+	}{bk.ID, en}, http.StatusCreated)
+}
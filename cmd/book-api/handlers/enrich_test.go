@@ -0,0 +1,96 @@
+package handlers_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/axwilliams/book-api/internal/business/enrich"
+	"github.com/axwilliams/book-api/internal/test"
+	"github.com/gorilla/mux"
+)
+
+func TestEnrichBook(t *testing.T) {
+	samples := []struct {
+		id         string
+		payload    string
+		statusCode int
+		applied    int
+	}{
+		// Unknown book
+		{"562e1fe0-0dde-4717-a008-cd2a699301d3", ``, http.StatusNotFound, 0},
+		// No metadata for the ISBN
+		{"d2b4a1c7-5e33-4b8a-9c1e-6f0d3a2b7c91", ``, http.StatusNotFound, 0},
+		// Unknown field
+		{"f4ac7e14-fc8e-4096-b956-34e5a33040f2", `{"accept":["isbn"]}`, http.StatusBadRequest, 0},
+		// Suggestions only
+		{"f4ac7e14-fc8e-4096-b956-34e5a33040f2", ``, http.StatusOK, 0},
+		// Accept a suggestion
+		{"f4ac7e14-fc8e-4096-b956-34e5a33040f2", `{"accept":["description"]}`, http.StatusOK, 1},
+	}
+
+	for _, sample := range samples {
+		r, err := newUserRequest("POST", "/api/v1/books/"+sample.id+"/enrich", bytes.NewBufferString(sample.payload))
+		if err != nil {
+			t.Errorf("\t%s\tRequest failed: %v\n", test.Failed, err)
+		}
+		r = mux.SetURLVars(r, map[string]string{"id": sample.id})
+
+		rr := httptest.NewRecorder()
+		h := http.HandlerFunc(bookHandler.Enrich)
+		h.ServeHTTP(rr, r)
+
+		if sample.statusCode != rr.Code {
+			t.Fatalf("\t%s\tWrong status code: want %v got %v: %s", test.Failed, sample.statusCode, rr.Code, rr.Body.String())
+		}
+		t.Logf("\t%s\tStatus code correct: %v", test.Success, rr.Code)
+
+		if rr.Code != http.StatusOK {
+			continue
+		}
+
+		en := enrich.Enrichment{}
+		if err := json.NewDecoder(rr.Body).Decode(&en); err != nil {
+			t.Fatalf("\t%s\tUnable to decode response: %v", test.Failed, err)
+		}
+
+		if en.Provider != "fixtures" || len(en.Applied) != sample.applied || len(en.Suggestions)+len(en.Applied) != 2 {
+			t.Fatalf("\t%s\tWrong enrichment: %+v", test.Failed, en)
+		}
+		t.Logf("\t%s\tEnrichment correct", test.Success)
+	}
+}
+
+func TestAddEnrichedBook(t *testing.T) {
+	payload := `{"isbn":"978-0099448792","title":"The Wind-Up Bird Chronicle","author":"Haruki Murakami"}`
+
+	r, err := newUserRequest("POST", "/api/v1/books?enrich=true", bytes.NewBufferString(payload))
+	if err != nil {
+		t.Errorf("\t%s\tRequest failed: %v\n", test.Failed, err)
+	}
+
+	rr := httptest.NewRecorder()
+	h := http.HandlerFunc(bookHandler.Add)
+	h.ServeHTTP(rr, r)
+
+	if rr.Code != http.StatusCreated {
+		t.Fatalf("\t%s\tWrong status code: want %v got %v: %s", test.Failed, http.StatusCreated, rr.Code, rr.Body.String())
+	}
+	t.Logf("\t%s\tStatus code correct: %v", test.Success, rr.Code)
+
+	res := struct {
+		ID         string            `json:"id"`
+		Enrichment enrich.Enrichment `json:"enrichment"`
+	}{}
+	if err := json.NewDecoder(rr.Body).Decode(&res); err != nil {
+		t.Fatalf("\t%s\tUnable to decode response: %v", test.Failed, err)
+	}
+
+	en := res.Enrichment
+	if res.ID == "" || en.BookID != res.ID || len(en.Applied) != 2 || len(en.Suggestions) != 1 || en.Suggestions[0].Field != enrich.FieldAuthor {
+		t.Fatalf("\t%s\tWrong response: %+v", test.Failed, res)
+	}
+	t.Logf("\t%s\tEmpty fields filled and the author suggested", test.Success)
+}
@@ -0,0 +1,114 @@
+package handlers
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/axwilliams/book-api/internal/business/book"
+	"github.com/axwilliams/book-api/internal/platform/web"
+	"github.com/gorilla/mux"
+)
+
+const maxEPUBSize = 50 << 20
+
+// FromEPUB takes the EPUB either as the request body or as the file field
+// of a multipart form.
+func (h *BookHandler) FromEPUB(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	create, _ := strconv.ParseBool(q.Get("create"))
+	attach, _ := strconv.ParseBool(q.Get("attach"))
+
+	r.Body = http.MaxBytesReader(w, r.Body, maxEPUBSize)
+
+	var raw []byte
+	var err error
+	filename := q.Get("filename")
+
+	if strings.HasPrefix(r.Header.Get("Content-Type"), "multipart/form-data") {
+		f, fh, ferr := r.FormFile("file")
+		if ferr != nil {
+			web.RespondError(w, web.NewRequestError(book.ErrInvalidEPUB, http.StatusBadRequest))
+			return
+		}
+		defer f.Close()
+
+		filename = fh.Filename
+		raw, err = ioutil.ReadAll(f)
+	} else {
+		raw, err = ioutil.ReadAll(r.Body)
+	}
+	if err != nil {
+		web.RespondError(w, web.NewRequestError(book.ErrInvalidEPUB, http.StatusBadRequest))
+		return
+	}
+
+	imp, err := h.bs.FromEPUB(raw, filename, create, attach, subject(r))
+	if err != nil {
+		web.RespondError(w, err)
+		return
+	}
+
+	if imp.Created != nil {
+		web.Respond(w, imp, http.StatusCreated)
+		return
+	}
+
+	web.Respond(w, imp, http.StatusOK)
+}
+
+func (h *BookHandler) Attachments(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+
+	bk, as, err := h.bs.Attachments(vars["id"])
+	if err == book.ErrNoBookFound || (err == nil && bk.Status != book.StatusPublished && !isEditor(r)) {
+		web.RespondError(w, web.NewRequestError(book.ErrNoBookFound, http.StatusNotFound))
+		return
+	}
+	if err != nil {
+		web.RespondError(w, err)
+		return
+	}
+
+	web.Respond(w, as, http.StatusOK)
+}
+
+func (h *BookHandler) Attachment(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+
+	bk, a, err := h.bs.Attachment(vars["id"], vars["attachment"])
+	writeAttachment(w, r, bk, a, err, "attachment")
+}
+
+func (h *BookHandler) Cover(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+
+	bk, a, err := h.bs.Cover(vars["id"])
+	writeAttachment(w, r, bk, a, err, "inline")
+}
+
+func writeAttachment(w http.ResponseWriter, r *http.Request, bk *book.Book, a *book.Attachment, err error, disposition string) {
+	if err == book.ErrNoBookFound || (err == nil && bk.Status != book.StatusPublished && !isEditor(r)) {
+		web.RespondError(w, web.NewRequestError(book.ErrNoBookFound, http.StatusNotFound))
+		return
+	}
+	if err != nil {
+		web.RespondError(w, err)
+		return
+	}
+
+	// Only images that cannot carry scripts are shown inline, and browsers
+	// must not guess another type for them.
+	if !book.Inline(a.ContentType) {
+		disposition = "attachment"
+	}
+
+	w.Header().Set("Content-Type", a.ContentType)
+	w.Header().Set("Content-Length", strconv.Itoa(len(a.Data)))
+	w.Header().Set("Content-Disposition", fmt.Sprintf("%s; filename=%q", disposition, a.Filename))
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(http.StatusOK)
+	w.Write(a.Data)
+}
@@ -0,0 +1,249 @@
+package handlers_test
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/json"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/axwilliams/book-api/internal/business/book"
+	"github.com/axwilliams/book-api/internal/test"
+	"github.com/gorilla/mux"
+)
+
+// sampleEPUB builds a minimal EPUB 3 with the given package metadata.
+func sampleEPUB(t *testing.T, metadata string) []byte {
+	files := []struct{ name, content string }{
+		{"mimetype", "application/epub+zip"},
+		{"META-INF/container.xml", `<container xmlns="urn:oasis:names:tc:opendocument:xmlns:container">
+			<rootfiles><rootfile full-path="content.opf" media-type="application/oebps-package+xml"/></rootfiles>
+		</container>`},
+		{"content.opf", `<package xmlns="http://www.idpf.org/2007/opf" version="3.0">
+			<metadata xmlns:dc="http://purl.org/dc/elements/1.1/">` + metadata + `</metadata>
+			<manifest><item id="c" href="cover.png" media-type="image/png" properties="cover-image"/></manifest>
+		</package>`},
+		{"cover.png", "\x89PNG\r\n\x1a\n"},
+	}
+
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for _, f := range files {
+		w, err := zw.Create(f.name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		io.WriteString(w, f.content)
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	return buf.Bytes()
+}
+
+func TestFromEPUB(t *testing.T) {
+	complete := sampleEPUB(t, `<dc:title>The Castle</dc:title><dc:creator>Franz Kafka</dc:creator>
+		<dc:identifier>urn:isbn:9780241372579</dc:identifier><dc:subject>Fiction</dc:subject><dc:language>en</dc:language>`)
+	untitled := sampleEPUB(t, `<dc:creator>Franz Kafka</dc:creator><dc:identifier>urn:isbn:9780241372579</dc:identifier>`)
+
+	samples := []struct {
+		query      string
+		payload    []byte
+		multipart  bool
+		statusCode int
+		title      string
+		created    bool
+	}{
+		// Not an EPUB
+		{
+			payload:    []byte("not an epub"),
+			statusCode: http.StatusBadRequest,
+		},
+		// Attach without creating
+		{
+			query:      "?attach=true",
+			payload:    complete,
+			statusCode: http.StatusBadRequest,
+		},
+		// Preview
+		{
+			payload:    complete,
+			statusCode: http.StatusOK,
+			title:      "The Castle",
+		},
+		// Preview of an incomplete EPUB
+		{
+			payload:    untitled,
+			statusCode: http.StatusOK,
+		},
+		// Create from an incomplete EPUB
+		{
+			query:      "?create=true",
+			payload:    untitled,
+			statusCode: http.StatusUnprocessableEntity,
+		},
+		// Filename too long to store
+		{
+			query:      "?create=true&attach=true&filename=" + strings.Repeat("a", 256),
+			payload:    complete,
+			statusCode: http.StatusUnprocessableEntity,
+		},
+		// Create and attach, uploaded as a form
+		{
+			query:      "?create=true&attach=true",
+			payload:    complete,
+			multipart:  true,
+			statusCode: http.StatusCreated,
+			title:      "The Castle",
+			created:    true,
+		},
+	}
+
+	for _, sample := range samples {
+		body := bytes.NewBuffer(sample.payload)
+		contentType := "application/epub+zip"
+
+		if sample.multipart {
+			body = &bytes.Buffer{}
+			mw := multipart.NewWriter(body)
+			fw, _ := mw.CreateFormFile("file", "castle.epub")
+			fw.Write(sample.payload)
+			mw.Close()
+			contentType = mw.FormDataContentType()
+		}
+
+		r, err := newUserRequest("POST", "/api/v1/books/from-epub"+sample.query, body)
+		if err != nil {
+			t.Errorf("\t%s\tRequest failed: %v\n", test.Failed, err)
+		}
+		r.Header.Set("Content-Type", contentType)
+
+		rr := httptest.NewRecorder()
+		h := http.HandlerFunc(bookHandler.FromEPUB)
+		h.ServeHTTP(rr, r)
+
+		if sample.statusCode != rr.Code {
+			t.Fatalf("\t%s\tWrong status code: want %v got %v: %s", test.Failed, sample.statusCode, rr.Code, rr.Body.String())
+		}
+		t.Logf("\t%s\tStatus code correct: %v", test.Success, rr.Code)
+
+		if rr.Code >= http.StatusBadRequest {
+			continue
+		}
+
+		imp := book.EPUBImport{}
+		if err := json.NewDecoder(rr.Body).Decode(&imp); err != nil {
+			t.Fatalf("\t%s\tUnable to decode response: %v", test.Failed, err)
+		}
+
+		if imp.Book.Title != sample.title || !imp.Cover || (imp.Created != nil) != sample.created {
+			t.Fatalf("\t%s\tWrong import: %+v", test.Failed, imp)
+		}
+		t.Logf("\t%s\tResponse data correct", test.Success)
+	}
+}
+
+func TestCover(t *testing.T) {
+	samples := []struct {
+		id          string
+		statusCode  int
+		contentType string
+		disposition string
+	}{
+		// Book with a cover
+		{
+			id:          "f4ac7e14-fc8e-4096-b956-34e5a33040f2",
+			statusCode:  http.StatusOK,
+			contentType: "image/png",
+			disposition: `inline; filename="cover.png"`,
+		},
+		// SVG cover, which could run scripts inline
+		{
+			id:          "562e1fe0-0dde-4717-a008-cd2a699301d2",
+			statusCode:  http.StatusOK,
+			contentType: "image/svg+xml",
+			disposition: `attachment; filename="cover.svg"`,
+		},
+		// Book without a cover
+		{
+			id:         "71432eb9-58da-4eae-aa20-ccc49064246f",
+			statusCode: http.StatusNotFound,
+		},
+		// Unpublished book
+		{
+			id:         "d2b4a1c7-5e33-4b8a-9c1e-6f0d3a2b7c91",
+			statusCode: http.StatusNotFound,
+		},
+	}
+
+	for _, sample := range samples {
+		r, err := newUserRequest("GET", "/api/v1/books/"+sample.id+"/cover", nil)
+		if err != nil {
+			t.Errorf("\t%s\tRequest failed: %v\n", test.Failed, err)
+		}
+
+		r = mux.SetURLVars(r, map[string]string{"id": sample.id})
+
+		rr := httptest.NewRecorder()
+		h := http.HandlerFunc(bookHandler.Cover)
+		h.ServeHTTP(rr, r)
+
+		if sample.statusCode != rr.Code {
+			t.Fatalf("\t%s\tWrong status code: want %v got %v", test.Failed, sample.statusCode, rr.Code)
+		}
+		t.Logf("\t%s\tStatus code correct: %v", test.Success, rr.Code)
+
+		if sample.contentType != "" && rr.Header().Get("Content-Type") != sample.contentType {
+			t.Fatalf("\t%s\tWrong content type: want %v got %v", test.Failed, sample.contentType, rr.Header().Get("Content-Type"))
+		}
+		if sample.disposition != "" && (rr.Header().Get("Content-Disposition") != sample.disposition || rr.Header().Get("X-Content-Type-Options") != "nosniff") {
+			t.Fatalf("\t%s\tWrong disposition: want %v got %v", test.Failed, sample.disposition, rr.Header())
+		}
+	}
+}
+
+func TestAttachments(t *testing.T) {
+	id := "f4ac7e14-fc8e-4096-b956-34e5a33040f2"
+
+	r, err := newUserRequest("GET", "/api/v1/books/"+id+"/attachments", nil)
+	if err != nil {
+		t.Errorf("\t%s\tRequest failed: %v\n", test.Failed, err)
+	}
+
+	r = mux.SetURLVars(r, map[string]string{"id": id})
+
+	rr := httptest.NewRecorder()
+	h := http.HandlerFunc(bookHandler.Attachments)
+	h.ServeHTTP(rr, r)
+
+	if rr.Code != http.StatusOK {
+		t.Fatalf("\t%s\tWrong status code: want %v got %v", test.Failed, http.StatusOK, rr.Code)
+	}
+
+	as := []book.Attachment{}
+	if err := json.NewDecoder(rr.Body).Decode(&as); err != nil {
+		t.Fatalf("\t%s\tUnable to decode response: %v", test.Failed, err)
+	}
+
+	if len(as) != 1 || as[0].Kind != book.AttachmentCover {
+		t.Fatalf("\t%s\tWrong attachments: %+v", test.Failed, as)
+	}
+	t.Logf("\t%s\tAttachments listed", test.Success)
+
+	r, _ = newUserRequest("GET", "/api/v1/books/"+id+"/attachments/"+as[0].ID, nil)
+	r = mux.SetURLVars(r, map[string]string{"id": id, "attachment": as[0].ID})
+
+	rr = httptest.NewRecorder()
+	h = http.HandlerFunc(bookHandler.Attachment)
+	h.ServeHTTP(rr, r)
+
+	if rr.Code != http.StatusOK || rr.Header().Get("Content-Disposition") != `attachment; filename="cover.png"` {
+		t.Fatalf("\t%s\tWrong download: %v %v", test.Failed, rr.Code, rr.Header())
+	}
+	t.Logf("\t%s\tAttachment downloaded", test.Success)
+}
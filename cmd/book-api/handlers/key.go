@@ -0,0 +1,27 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/axwilliams/book-api/internal/platform/auth"
+	"github.com/axwilliams/book-api/internal/platform/web"
+)
+
+// jwksMaxAge is how long verifiers may cache the key set. A new key has to
+// be published for at least this long before it starts signing.
+const jwksMaxAge = "max-age=300"
+
+type KeyHandler struct {
+	km *auth.KeyManager
+}
+
+func NewKeyHandler(km *auth.KeyManager) KeyHandler {
+	return KeyHandler{
+		km,
+	}
+}
+
+func (h *KeyHandler) JWKS(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Cache-Control", jwksMaxAge)
+	web.Respond(w, h.km.JWKS(), http.StatusOK)
+}
@@ -0,0 +1,50 @@
+package handlers_test
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/axwilliams/book-api/cmd/book-api/handlers"
+	"github.com/axwilliams/book-api/internal/platform/auth"
+	"github.com/axwilliams/book-api/internal/test"
+)
+
+func TestJWKS(t *testing.T) {
+	_, edKey, _ := ed25519.GenerateKey(rand.Reader)
+	der, _ := x509.MarshalPKCS8PrivateKey(edKey)
+	k, err := auth.ParseKey("2020-06", pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	km := auth.NewKeyManager(auth.DefaultAlgorithms)
+	if err := km.SetKeys([]*auth.Key{k}, ""); err != nil {
+		t.Fatal(err)
+	}
+	h := handlers.NewKeyHandler(km)
+
+	r, err := http.NewRequest("GET", "/.well-known/jwks.json", nil)
+	if err != nil {
+		t.Errorf("\t%s\tRequest failed: %v\n", test.Failed, err)
+	}
+
+	rr := httptest.NewRecorder()
+	http.HandlerFunc(h.JWKS).ServeHTTP(rr, r)
+
+	if rr.Code != http.StatusOK || rr.Header().Get("Cache-Control") == "" {
+		t.Fatalf("\t%s\tWrong response: %v %v", test.Failed, rr.Code, rr.Header())
+	}
+	t.Logf("\t%s\tStatus code correct: %v", test.Success, rr.Code)
+
+	var set auth.JWKS
+	if err := json.NewDecoder(rr.Body).Decode(&set); err != nil || len(set.Keys) != 1 || set.Keys[0].KeyID != "2020-06" || set.Keys[0].Algorithm != "EdDSA" {
+		t.Fatalf("\t%s\tWrong key set: %v %+v", test.Failed, err, set)
+	}
+	t.Logf("\t%s\tResponse data correct", test.Success)
+}
@@ -0,0 +1,90 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/axwilliams/book-api/internal/business/label"
+	"github.com/axwilliams/book-api/internal/platform/web"
+	"github.com/gorilla/mux"
+)
+
+type LabelHandler struct {
+	ls        label.Service
+	publicURL string
+}
+
+// NewLabelHandler encodes book addresses under publicURL in QR codes. When
+// it is empty the address the request came in on is used.
+func NewLabelHandler(ls label.Service, publicURL string) LabelHandler {
+	return LabelHandler{
+		ls,
+		publicURL,
+	}
+}
+
+func (h *LabelHandler) Barcode(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+
+	f, err := h.ls.Barcode(vars["id"], vars["format"], visibleStatus(r))
+	if err != nil {
+		web.RespondError(w, err)
+		return
+	}
+
+	writeLabel(w, f, "")
+}
+
+func (h *LabelHandler) QR(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+
+	base := h.publicURL
+	if base == "" {
+		scheme := "http"
+		if r.TLS != nil {
+			scheme = "https"
+		}
+		base = scheme + "://" + r.Host + strings.TrimSuffix(r.URL.Path, "/books/"+vars["id"]+"/qr."+vars["format"])
+	}
+
+	f, err := h.ls.QR(vars["id"], base, vars["format"], visibleStatus(r))
+	if err != nil {
+		web.RespondError(w, err)
+		return
+	}
+
+	writeLabel(w, f, "")
+}
+
+func (h *LabelHandler) Sheet(w http.ResponseWriter, r *http.Request) {
+	ns := label.NewSheet{}
+	if err := web.Decode(r, &ns); err != nil {
+		web.RespondError(w, err)
+		return
+	}
+
+	f, err := h.ls.Sheet(ns, visibleStatus(r))
+	if err != nil {
+		web.RespondError(w, err)
+		return
+	}
+
+	writeLabel(w, f, "labels.pdf")
+}
+
+func (h *LabelHandler) Templates(w http.ResponseWriter, r *http.Request) {
+	web.Respond(w, label.Templates(), http.StatusOK)
+}
+
+// writeLabel sends a rendered file, as a download when it has a filename.
+func writeLabel(w http.ResponseWriter, f *label.File, filename string) {
+	w.Header().Set("Content-Type", f.ContentType)
+	w.Header().Set("Content-Length", strconv.Itoa(len(f.Body)))
+	if filename != "" {
+		w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename))
+	}
+	w.WriteHeader(http.StatusOK)
+	w.Write(f.Body)
+}
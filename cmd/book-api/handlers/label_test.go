@@ -0,0 +1,101 @@
+package handlers_test
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/axwilliams/book-api/cmd/book-api/handlers"
+	"github.com/axwilliams/book-api/internal/business/label"
+	"github.com/axwilliams/book-api/internal/test"
+	"github.com/axwilliams/book-api/internal/test/mock"
+	"github.com/gorilla/mux"
+)
+
+var labelHandler handlers.LabelHandler
+
+func init() {
+	labelService := label.NewService(mock.NewMockBook())
+	labelHandler = handlers.NewLabelHandler(labelService, "")
+}
+
+func TestBarcode(t *testing.T) {
+	samples := []struct {
+		id          string
+		format      string
+		qr          bool
+		statusCode  int
+		contentType string
+	}{
+		// Unknown book
+		{"562e1fe0-0dde-4717-a008-cd2a699301d3", "svg", false, http.StatusNotFound, ""},
+		// Not published
+		{"d2b4a1c7-5e33-4b8a-9c1e-6f0d3a2b7c91", "png", false, http.StatusNotFound, ""},
+		// EAN-13
+		{"f4ac7e14-fc8e-4096-b956-34e5a33040f2", "svg", false, http.StatusOK, "image/svg+xml"},
+		{"f4ac7e14-fc8e-4096-b956-34e5a33040f2", "png", false, http.StatusOK, "image/png"},
+		// QR code
+		{"f4ac7e14-fc8e-4096-b956-34e5a33040f2", "png", true, http.StatusOK, "image/png"},
+	}
+
+	for _, sample := range samples {
+		name, h := "barcode", labelHandler.Barcode
+		if sample.qr {
+			name, h = "qr", labelHandler.QR
+		}
+
+		r, err := newUserRequest("GET", "/api/v1/books/"+sample.id+"/"+name+"."+sample.format, nil)
+		if err != nil {
+			t.Errorf("\t%s\tRequest failed: %v\n", test.Failed, err)
+		}
+		r = mux.SetURLVars(r, map[string]string{"id": sample.id, "format": sample.format})
+
+		rr := httptest.NewRecorder()
+		http.HandlerFunc(h).ServeHTTP(rr, r)
+
+		if sample.statusCode != rr.Code {
+			t.Fatalf("\t%s\tWrong status code: want %v got %v", test.Failed, sample.statusCode, rr.Code)
+		}
+		t.Logf("\t%s\tStatus code correct: %v", test.Success, rr.Code)
+
+		if rr.Code == http.StatusOK && rr.Header().Get("Content-Type") != sample.contentType {
+			t.Fatalf("\t%s\tWrong content type: want %s got %s", test.Failed, sample.contentType, rr.Header().Get("Content-Type"))
+		}
+	}
+}
+
+func TestLabelSheet(t *testing.T) {
+	samples := []struct {
+		payload    string
+		statusCode int
+	}{
+		// Missing template
+		{`{"ids":["f4ac7e14-fc8e-4096-b956-34e5a33040f2"]}`, http.StatusUnprocessableEntity},
+		// Too many copies
+		{`{"template":"avery-5160","ids":["f4ac7e14-fc8e-4096-b956-34e5a33040f2"],"copies":101}`, http.StatusUnprocessableEntity},
+		// Unknown template
+		{`{"template":"avery-1","ids":["f4ac7e14-fc8e-4096-b956-34e5a33040f2"]}`, http.StatusBadRequest},
+		// Valid
+		{`{"template":"avery-5160","kind":"spine","ids":["f4ac7e14-fc8e-4096-b956-34e5a33040f2"],"copies":3,"skip":4}`, http.StatusOK},
+	}
+
+	for _, sample := range samples {
+		r, err := newUserRequest("POST", "/api/v1/labels", bytes.NewBufferString(sample.payload))
+		if err != nil {
+			t.Errorf("\t%s\tRequest failed: %v\n", test.Failed, err)
+		}
+
+		rr := httptest.NewRecorder()
+		http.HandlerFunc(labelHandler.Sheet).ServeHTTP(rr, r)
+
+		if sample.statusCode != rr.Code {
+			t.Fatalf("\t%s\tWrong status code: want %v got %v: %s", test.Failed, sample.statusCode, rr.Code, rr.Body.String())
+		}
+		t.Logf("\t%s\tStatus code correct: %v", test.Success, rr.Code)
+
+		if rr.Code == http.StatusOK && (rr.Header().Get("Content-Type") != "application/pdf" || !bytes.HasPrefix(rr.Body.Bytes(), []byte("%PDF-"))) {
+			t.Fatalf("\t%s\tResponse is not a PDF", test.Failed)
+		}
+	}
+}
@@ -0,0 +1,74 @@
+package handlers
+
+import (
+	"io/ioutil"
+	"net/http"
+	"strings"
+
+	"github.com/axwilliams/book-api/internal/business/library"
+	"github.com/axwilliams/book-api/internal/platform/auth"
+	"github.com/axwilliams/book-api/internal/platform/web"
+	"github.com/gorilla/mux"
+)
+
+const maxLibrarySize = 100 << 20
+
+type LibraryHandler struct {
+	ls library.Service
+}
+
+func NewLibraryHandler(ls library.Service) LibraryHandler {
+	return LibraryHandler{
+		ls,
+	}
+}
+
+// Import takes a Calibre metadata.db or a Goodreads CSV export, either as
+// the request body or as the file field of a multipart form, and answers
+// with the queued job.
+func (h *LibraryHandler) Import(w http.ResponseWriter, r *http.Request) {
+	r.Body = http.MaxBytesReader(w, r.Body, maxLibrarySize)
+
+	var raw []byte
+	var err error
+
+	if strings.HasPrefix(r.Header.Get("Content-Type"), "multipart/form-data") {
+		f, _, ferr := r.FormFile("file")
+		if ferr != nil {
+			web.RespondError(w, web.NewRequestError(library.ErrInvalidFile, http.StatusBadRequest))
+			return
+		}
+		defer f.Close()
+
+		raw, err = ioutil.ReadAll(f)
+	} else {
+		raw, err = ioutil.ReadAll(r.Body)
+	}
+	if err != nil {
+		web.RespondError(w, web.NewRequestError(library.ErrInvalidFile, http.StatusBadRequest))
+		return
+	}
+
+	j, err := h.ls.Start(strings.ToLower(r.URL.Query().Get("source")), raw, subject(r))
+	if err != nil {
+		web.RespondError(w, err)
+		return
+	}
+
+	w.Header().Set("Location", "/api/v1/imports/"+j.ID)
+	web.Respond(w, j, http.StatusAccepted)
+}
+
+func (h *LibraryHandler) Job(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+
+	actorID, _ := auth.UserFromContext(r.Context())
+
+	j, err := h.ls.Job(vars["id"], actorID, auth.Can(r.Context(), auth.PermImportsManage))
+	if err != nil {
+		web.RespondError(w, err)
+		return
+	}
+
+	web.Respond(w, j, http.StatusOK)
+}
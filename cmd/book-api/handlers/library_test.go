@@ -0,0 +1,113 @@
+package handlers_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/axwilliams/book-api/cmd/book-api/handlers"
+	"github.com/axwilliams/book-api/internal/business/book"
+	"github.com/axwilliams/book-api/internal/business/library"
+	"github.com/axwilliams/book-api/internal/business/tag"
+	"github.com/axwilliams/book-api/internal/platform/policy"
+	"github.com/axwilliams/book-api/internal/test"
+	"github.com/axwilliams/book-api/internal/test/mock"
+	"github.com/gorilla/mux"
+)
+
+var libraryHandler handlers.LibraryHandler
+
+func init() {
+	mockBook := mock.NewMockBook()
+	libraryService := library.NewService(
+		mock.NewMockLibrary(),
+		book.NewService(mockBook, policy.NewEngine("")),
+		mockBook,
+		tag.NewService(mock.NewMockTag(), mockBook, policy.NewEngine("")),
+		mock.NewMockSeries(),
+		policy.NewEngine(""),
+	)
+	libraryHandler = handlers.NewLibraryHandler(libraryService)
+}
+
+func TestImportLibrary(t *testing.T) {
+	goodreads, err := ioutil.ReadFile("../../../internal/business/library/testdata/goodreads_library_export.csv")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	samples := []struct {
+		source     string
+		payload    []byte
+		statusCode int
+	}{
+		// Unknown source
+		{"kindle", goodreads, http.StatusBadRequest},
+		// Not a Calibre library
+		{"calibre", goodreads, http.StatusBadRequest},
+		// Queued
+		{"goodreads", goodreads, http.StatusAccepted},
+	}
+
+	for _, sample := range samples {
+		r, err := newUserRequest("POST", "/api/v1/imports?source="+sample.source, bytes.NewReader(sample.payload))
+		if err != nil {
+			t.Errorf("\t%s\tRequest failed: %v\n", test.Failed, err)
+		}
+
+		rr := httptest.NewRecorder()
+		h := http.HandlerFunc(libraryHandler.Import)
+		h.ServeHTTP(rr, r)
+
+		if sample.statusCode != rr.Code {
+			t.Fatalf("\t%s\tWrong status code: want %v got %v: %s", test.Failed, sample.statusCode, rr.Code, rr.Body.String())
+		}
+		t.Logf("\t%s\tStatus code correct: %v", test.Success, rr.Code)
+
+		if rr.Code != http.StatusAccepted {
+			continue
+		}
+
+		j := library.Job{}
+		if err := json.NewDecoder(rr.Body).Decode(&j); err != nil {
+			t.Fatalf("\t%s\tUnable to decode response: %v", test.Failed, err)
+		}
+
+		if j.Status != library.StatusQueued || j.Total != 4 || rr.Header().Get("Location") != "/api/v1/imports/"+j.ID {
+			t.Fatalf("\t%s\tWrong job: %+v %v", test.Failed, j, rr.Header())
+		}
+		t.Logf("\t%s\tJob queued", test.Success)
+	}
+}
+
+func TestImportJob(t *testing.T) {
+	samples := []struct {
+		id         string
+		statusCode int
+	}{
+		{"9b1e4c2d-7a3f-4e6b", http.StatusBadRequest},
+		{"0e9a6d55-3c7b-4f2e-8a1d-6b5c4d3e2f10", http.StatusNotFound},
+		{"9b1e4c2d-7a3f-4e6b-8c5d-0f2a1b3c4d5e", http.StatusOK},
+	}
+
+	for _, sample := range samples {
+		r, err := newUserRequest("GET", "/api/v1/imports/"+sample.id, nil)
+		if err != nil {
+			t.Errorf("\t%s\tRequest failed: %v\n", test.Failed, err)
+		}
+
+		r = mux.SetURLVars(r, map[string]string{"id": sample.id})
+
+		rr := httptest.NewRecorder()
+		h := http.HandlerFunc(libraryHandler.Job)
+		h.ServeHTTP(rr, r)
+
+		if sample.statusCode != rr.Code {
+			t.Fatalf("\t%s\tWrong status code: want %v got %v", test.Failed, sample.statusCode, rr.Code)
+		}
+		t.Logf("\t%s\tStatus code correct: %v", test.Success, rr.Code)
+	}
+}
@@ -0,0 +1,157 @@
+package handlers
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+
+	"github.com/axwilliams/book-api/internal/business/book"
+	"github.com/axwilliams/book-api/internal/platform/marc"
+	"github.com/axwilliams/book-api/internal/platform/web"
+	"github.com/gorilla/mux"
+)
+
+const (
+	formatMARC    = "marc"
+	formatMARCXML = "marcxml"
+
+	contentTypeMARC    = "application/marc"
+	contentTypeMARCXML = "application/marcxml+xml"
+
+	maxImportSize = 10 << 20
+)
+
+func marcFormat(r *http.Request) (string, error) {
+	format := strings.ToLower(strings.TrimSpace(r.URL.Query().Get("format")))
+	switch format {
+	case "":
+		return formatMARC, nil
+	case formatMARC, formatMARCXML:
+		return format, nil
+	}
+	return "", web.NewRequestError(book.ErrInvalidFormat, http.StatusBadRequest)
+}
+
+func readMARC(body io.Reader, format string) ([]*marc.Record, error) {
+	if format == formatMARCXML {
+		return marc.DecodeXML(body)
+	}
+
+	rd := marc.NewReader(body)
+
+	recs := []*marc.Record{}
+	for {
+		rec, err := rd.Read()
+		if err == io.EOF {
+			return recs, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		recs = append(recs, rec)
+	}
+}
+
+func writeMARC(w http.ResponseWriter, format, filename string, recs ...*marc.Record) {
+	var buf bytes.Buffer
+	contentType := contentTypeMARC
+
+	var err error
+	if format == formatMARCXML {
+		contentType = contentTypeMARCXML
+		err = marc.EncodeXML(&buf, recs...)
+	} else {
+		wr := marc.NewWriter(&buf)
+		for _, rec := range recs {
+			if err = wr.Write(rec); err != nil {
+				break
+			}
+		}
+	}
+
+	if err != nil {
+		web.RespondError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename))
+	w.WriteHeader(http.StatusOK)
+	w.Write(buf.Bytes())
+}
+
+func (h *BookHandler) Import(w http.ResponseWriter, r *http.Request) {
+	format, err := marcFormat(r)
+	if err != nil {
+		web.RespondError(w, err)
+		return
+	}
+
+	body, err := ioutil.ReadAll(http.MaxBytesReader(w, r.Body, maxImportSize))
+	if err != nil {
+		web.RespondError(w, web.NewRequestError(book.ErrInvalidMARC, http.StatusBadRequest))
+		return
+	}
+
+	recs, err := readMARC(bytes.NewReader(body), format)
+	if err != nil {
+		web.RespondError(w, web.NewRequestError(book.ErrInvalidMARC, http.StatusBadRequest))
+		return
+	}
+
+	rep, err := h.bs.Import(recs, subject(r))
+	if err != nil {
+		web.RespondError(w, err)
+		return
+	}
+
+	web.Respond(w, rep, http.StatusOK)
+}
+
+func (h *BookHandler) MARC(w http.ResponseWriter, r *http.Request) {
+	h.exportRecord(w, r, formatMARC, ".mrc")
+}
+
+func (h *BookHandler) MARCXML(w http.ResponseWriter, r *http.Request) {
+	h.exportRecord(w, r, formatMARCXML, ".xml")
+}
+
+func (h *BookHandler) exportRecord(w http.ResponseWriter, r *http.Request, format, ext string) {
+	vars := mux.Vars(r)
+
+	bk, rec, err := h.bs.MARC(vars["id"])
+	if err == book.ErrNoBookFound || (err == nil && bk.Status != book.StatusPublished && !isEditor(r)) {
+		web.RespondError(w, web.NewRequestError(book.ErrNoBookFound, http.StatusNotFound))
+		return
+	}
+	if err != nil {
+		web.RespondError(w, err)
+		return
+	}
+
+	writeMARC(w, format, bk.ID+ext, rec)
+}
+
+func (h *BookHandler) Export(w http.ResponseWriter, r *http.Request) {
+	format, err := marcFormat(r)
+	if err != nil {
+		web.RespondError(w, err)
+		return
+	}
+
+	recs, err := h.bs.ExportMARC(strings.TrimSpace(r.URL.Query().Get("status")))
+	if err != nil {
+		web.RespondError(w, err)
+		return
+	}
+
+	ext := ".mrc"
+	if format == formatMARCXML {
+		ext = ".xml"
+	}
+
+	writeMARC(w, format, "books"+ext, recs...)
+}
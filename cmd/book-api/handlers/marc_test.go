@@ -0,0 +1,166 @@
+package handlers_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/axwilliams/book-api/internal/business/book"
+	"github.com/axwilliams/book-api/internal/platform/marc"
+	"github.com/axwilliams/book-api/internal/test"
+	"github.com/gorilla/mux"
+)
+
+const marcXML = `<?xml version="1.0" encoding="UTF-8"?>
+<collection xmlns="http://www.loc.gov/MARC21/slim">
+  <record>
+    <leader>00000cam a2200000 a 4500</leader>
+    <controlfield tag="001">12345678</controlfield>
+    <datafield tag="020" ind1=" " ind2=" "><subfield code="a">9780805211061 (pbk.)</subfield></datafield>
+    <datafield tag="100" ind1="1" ind2=" "><subfield code="a">Kafka, Franz,</subfield><subfield code="d">1883-1924.</subfield></datafield>
+    <datafield tag="245" ind1="1" ind2="4"><subfield code="a">The castle /</subfield><subfield code="c">Franz Kafka.</subfield></datafield>
+    <datafield tag="650" ind1=" " ind2="0"><subfield code="a">Fiction.</subfield></datafield>
+  </record>
+  <record>
+    <leader>00000cam a2200000 a 4500</leader>
+    <datafield tag="245" ind1="0" ind2="0"><subfield code="a">Untitled notes</subfield></datafield>
+  </record>
+</collection>`
+
+func TestImportMARC(t *testing.T) {
+	samples := []struct {
+		format     string
+		payload    string
+		statusCode int
+		imported   int
+		failed     int
+	}{
+		// Unknown format
+		{
+			format:     "unimarc",
+			payload:    marcXML,
+			statusCode: http.StatusBadRequest,
+		},
+		// Not MARC
+		{
+			format:     "marc",
+			payload:    "not a record",
+			statusCode: http.StatusBadRequest,
+		},
+		// MARCXML, one record without ISBN or author
+		{
+			format:     "marcxml",
+			payload:    marcXML,
+			statusCode: http.StatusOK,
+			imported:   1,
+			failed:     1,
+		},
+	}
+
+	for _, sample := range samples {
+		r, err := newUserRequest("POST", "/api/v1/books/import?format="+sample.format, bytes.NewBufferString(sample.payload))
+		if err != nil {
+			t.Errorf("\t%s\tRequest failed: %v\n", test.Failed, err)
+		}
+
+		rr := httptest.NewRecorder()
+		h := http.HandlerFunc(bookHandler.Import)
+		h.ServeHTTP(rr, r)
+
+		if sample.statusCode != rr.Code {
+			t.Fatalf("\t%s\tWrong status code: want %v got %v", test.Failed, sample.statusCode, rr.Code)
+		}
+		t.Logf("\t%s\tStatus code correct: %v", test.Success, rr.Code)
+
+		if rr.Code != http.StatusOK {
+			continue
+		}
+
+		rep := book.ImportReport{}
+		if err := json.NewDecoder(rr.Body).Decode(&rep); err != nil {
+			t.Fatalf("\t%s\tFailed to decode JSON response: %v", test.Failed, err)
+		}
+
+		if len(rep.Imported) != sample.imported || len(rep.Failed) != sample.failed || rep.Failed[0].Record != 2 {
+			t.Fatalf("\t%s\tWrong import report: got %+v", test.Failed, rep)
+		}
+		t.Logf("\t%s\tImport report correct", test.Success)
+	}
+}
+
+func TestExportMARC(t *testing.T) {
+	samples := []struct {
+		id          string
+		handler     http.HandlerFunc
+		statusCode  int
+		contentType string
+	}{
+		// Not published
+		{
+			id:         "d2b4a1c7-5e33-4b8a-9c1e-6f0d3a2b7c91",
+			handler:    bookHandler.MARC,
+			statusCode: http.StatusNotFound,
+		},
+		// Binary
+		{
+			id:          "f4ac7e14-fc8e-4096-b956-34e5a33040f2",
+			handler:     bookHandler.MARC,
+			statusCode:  http.StatusOK,
+			contentType: "application/marc",
+		},
+		// MARCXML
+		{
+			id:          "f4ac7e14-fc8e-4096-b956-34e5a33040f2",
+			handler:     bookHandler.MARCXML,
+			statusCode:  http.StatusOK,
+			contentType: "application/marcxml+xml",
+		},
+	}
+
+	for _, sample := range samples {
+		r, err := newUserRequest("GET", "/api/v1/books", nil)
+		if err != nil {
+			t.Errorf("\t%s\tRequest failed: %v\n", test.Failed, err)
+		}
+
+		r = mux.SetURLVars(r, map[string]string{"id": sample.id})
+
+		rr := httptest.NewRecorder()
+		sample.handler.ServeHTTP(rr, r)
+
+		if sample.statusCode != rr.Code {
+			t.Fatalf("\t%s\tWrong status code: want %v got %v", test.Failed, sample.statusCode, rr.Code)
+		}
+		t.Logf("\t%s\tStatus code correct: %v", test.Success, rr.Code)
+
+		if rr.Code != http.StatusOK {
+			continue
+		}
+
+		if ct := rr.Header().Get("Content-Type"); ct != sample.contentType {
+			t.Fatalf("\t%s\tWrong content type: want %v got %v", test.Failed, sample.contentType, ct)
+		}
+
+		var rec *marc.Record
+		if sample.contentType == "application/marc" {
+			rec, err = marc.Decode(rr.Body.Bytes())
+		} else {
+			var recs []*marc.Record
+			recs, err = marc.DecodeXML(rr.Body)
+			if err == nil && len(recs) == 1 {
+				rec = recs[0]
+			}
+		}
+		if err != nil || rec == nil {
+			t.Fatalf("\t%s\tExported record unreadable: %v", test.Failed, err)
+		}
+
+		nb := book.FromMARC(rec)
+		if nb.ISBN != "978-0241372579" || nb.Title != "The Castle" || nb.Author != "Franz Kafka" || nb.Category != "Fiction" {
+			t.Fatalf("\t%s\tWrong exported fields: got %+v", test.Failed, nb)
+		}
+		t.Logf("\t%s\tExported record maps back to the book", test.Success)
+	}
+}
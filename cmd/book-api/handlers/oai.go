@@ -0,0 +1,52 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/axwilliams/book-api/internal/business/oai"
+	"github.com/axwilliams/book-api/internal/platform/web"
+)
+
+type OAIHandler struct {
+	os oai.Service
+}
+
+func NewOAIHandler(os oai.Service) OAIHandler {
+	return OAIHandler{
+		os,
+	}
+}
+
+// Handle serves every verb. Harvesters may send arguments either in the
+// query string or as a form POST.
+func (h *OAIHandler) Handle(w http.ResponseWriter, r *http.Request) {
+	args := r.URL.Query()
+	if r.Method == http.MethodPost {
+		if err := r.ParseForm(); err != nil {
+			web.RespondError(w, web.NewRequestError(err, http.StatusBadRequest))
+			return
+		}
+		args = r.PostForm
+	}
+
+	scheme := "http"
+	if r.TLS != nil {
+		scheme = "https"
+	}
+
+	resp, err := h.os.Handle(args, scheme+"://"+r.Host+r.URL.Path)
+	if err != nil {
+		web.RespondError(w, err)
+		return
+	}
+
+	body, err := oai.Encode(resp)
+	if err != nil {
+		web.RespondError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", oai.ContentType)
+	w.WriteHeader(http.StatusOK)
+	w.Write(body)
+}
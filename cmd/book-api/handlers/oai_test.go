@@ -0,0 +1,185 @@
+package handlers_test
+
+import (
+	"encoding/base64"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/axwilliams/book-api/cmd/book-api/handlers"
+	"github.com/axwilliams/book-api/internal/business/oai"
+	"github.com/axwilliams/book-api/internal/test"
+	"github.com/axwilliams/book-api/internal/test/mock"
+)
+
+var oaiHandler handlers.OAIHandler
+
+func init() {
+	oaiService := oai.NewService(mock.NewMockBook(), oai.Config{
+		Name:       "Book API",
+		Identifier: "books.example.org",
+		AdminEmail: "admin@example.org",
+	})
+	oaiHandler = handlers.NewOAIHandler(oaiService)
+}
+
+func TestOAI(t *testing.T) {
+	// A token resuming after The Castle, as the last page of a harvest.
+	resumed := base64.RawURLEncoding.EncodeToString([]byte(
+		`{"p":"oai_dc","h":{"AfterTime":"2020-01-10T10:00:00Z","AfterID":"f4ac7e14-fc8e-4096-b956-34e5a33040f2"},"c":1}`))
+	tampered := base64.RawURLEncoding.EncodeToString([]byte(
+		`{"p":"oai_dc","h":{"AfterTime":"2020-01-10T10:00:00Z","AfterID":"not-a-book"},"c":1}`))
+
+	samples := []struct {
+		query    string
+		post     bool
+		contains []string
+		excludes []string
+	}{
+		// No verb
+		{
+			query:    "",
+			contains: []string{`<error code="badVerb">`, `<request>http://example.com/api/v1/oai</request>`},
+		},
+		// Unknown verb
+		{
+			query:    "verb=ListBooks",
+			contains: []string{`<error code="badVerb">`},
+		},
+		// Illegal argument
+		{
+			query:    "verb=Identify&metadataPrefix=oai_dc",
+			contains: []string{`<error code="badArgument">Illegal argument metadataPrefix</error>`},
+		},
+		// Repeated argument
+		{
+			query:    "verb=ListRecords&metadataPrefix=oai_dc&metadataPrefix=oai_dc",
+			contains: []string{`<error code="badArgument">Repeated argument metadataPrefix</error>`},
+		},
+		// Identify
+		{
+			query: "verb=Identify",
+			contains: []string{
+				`<request verb="Identify">http://example.com/api/v1/oai</request>`,
+				"<repositoryName>Book API</repositoryName>",
+				"<earliestDatestamp>2020-01-10T10:00:00Z</earliestDatestamp>",
+				"<granularity>YYYY-MM-DDThh:mm:ssZ</granularity>",
+			},
+		},
+		// Metadata formats for an unknown record
+		{
+			query:    "verb=ListMetadataFormats&identifier=oai:books.example.org:7b6807c2-1e11-4e38-bdfd-281186885c3f",
+			contains: []string{`<error code="idDoesNotExist">`},
+		},
+		// Sets from categories
+		{
+			query:    "verb=ListSets",
+			contains: []string{"<setSpec>fiction</setSpec>", "<setName>Science</setName>"},
+		},
+		// Unsupported format
+		{
+			query:    "verb=GetRecord&identifier=oai:books.example.org:f4ac7e14-fc8e-4096-b956-34e5a33040f2&metadataPrefix=marc21",
+			contains: []string{`<error code="cannotDisseminateFormat">`},
+		},
+		// Unpublished record
+		{
+			query:    "verb=GetRecord&identifier=oai:books.example.org:d2b4a1c7-5e33-4b8a-9c1e-6f0d3a2b7c91&metadataPrefix=oai_dc",
+			contains: []string{`<error code="idDoesNotExist">`},
+		},
+		// Dublin Core record
+		{
+			query: "verb=GetRecord&identifier=oai:books.example.org:f4ac7e14-fc8e-4096-b956-34e5a33040f2&metadataPrefix=oai_dc",
+			contains: []string{
+				`<oai_dc:dc xmlns:oai_dc="http://www.openarchives.org/OAI/2.0/oai_dc/" xmlns:dc="http://purl.org/dc/elements/1.1/"`,
+				"<dc:title>The Castle</dc:title>",
+				"<dc:creator>Franz Kafka</dc:creator>",
+				"<dc:identifier>urn:isbn:978-0241372579</dc:identifier>",
+			},
+		},
+		// Selective harvest by date and set, as a POST
+		{
+			query:    "verb=ListIdentifiers&metadataPrefix=oai_dc&from=2020-01-11&until=2020-02-01&set=fiction",
+			post:     true,
+			contains: []string{"oai:books.example.org:71432eb9-58da-4eae-aa20-ccc49064246f", "<datestamp>2020-02-01T08:30:00Z</datestamp>"},
+			excludes: []string{"f4ac7e14-fc8e-4096-b956-34e5a33040f2", "<resumptionToken"},
+		},
+		// Mixed granularity
+		{
+			query:    "verb=ListRecords&metadataPrefix=oai_dc&from=2020-01-11&until=2020-02-01T00:00:00Z",
+			contains: []string{`<error code="badArgument">`},
+		},
+		// Unknown set
+		{
+			query:    "verb=ListRecords&metadataPrefix=oai_dc&set=poetry",
+			contains: []string{`<error code="noRecordsMatch">`},
+		},
+		// Nothing in range
+		{
+			query:    "verb=ListRecords&metadataPrefix=oai_dc&from=2021-01-01",
+			contains: []string{`<error code="noRecordsMatch">`},
+		},
+		// Token with other arguments
+		{
+			query:    "verb=ListRecords&metadataPrefix=oai_dc&resumptionToken=" + resumed,
+			contains: []string{`<error code="badArgument">`},
+		},
+		// Bad token
+		{
+			query:    "verb=ListRecords&resumptionToken=nonsense",
+			contains: []string{`<error code="badResumptionToken">`},
+		},
+		// Token with a book ID that is not one
+		{
+			query:    "verb=ListRecords&resumptionToken=" + tampered,
+			contains: []string{`<error code="badResumptionToken">`},
+		},
+		// Last page of a resumed harvest
+		{
+			query:    "verb=ListRecords&resumptionToken=" + resumed,
+			contains: []string{"<dc:title>Fahrenheit 451</dc:title>", "<dc:title>Six Easy Pieces</dc:title>", `<resumptionToken cursor="1"></resumptionToken>`},
+			excludes: []string{"<dc:title>The Castle</dc:title>"},
+		},
+	}
+
+	for _, sample := range samples {
+		var r *http.Request
+		var err error
+		if sample.post {
+			r, err = http.NewRequest("POST", "http://example.com/api/v1/oai", strings.NewReader(sample.query))
+			r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		} else {
+			r, err = http.NewRequest("GET", "http://example.com/api/v1/oai?"+sample.query, nil)
+		}
+		if err != nil {
+			t.Fatalf("\t%s\tRequest failed: %v\n", test.Failed, err)
+		}
+
+		rr := httptest.NewRecorder()
+		h := http.HandlerFunc(oaiHandler.Handle)
+		h.ServeHTTP(rr, r)
+
+		if rr.Code != http.StatusOK {
+			t.Fatalf("\t%s\tWrong status code: want %v got %v", test.Failed, http.StatusOK, rr.Code)
+		}
+
+		if ct := rr.Header().Get("Content-Type"); ct != oai.ContentType {
+			t.Fatalf("\t%s\tWrong content type: want %v got %v", test.Failed, oai.ContentType, ct)
+		}
+		t.Logf("\t%s\tStatus code correct: %v", test.Success, rr.Code)
+
+		res := rr.Body.String()
+		for _, c := range sample.contains {
+			if !strings.Contains(res, c) {
+				t.Fatalf("\t%s\tResponse to %q is missing %q: got %s", test.Failed, sample.query, c, res)
+			}
+		}
+		for _, e := range sample.excludes {
+			if strings.Contains(res, e) {
+				t.Fatalf("\t%s\tResponse to %q should not contain %q: got %s", test.Failed, sample.query, e, res)
+			}
+		}
+		t.Logf("\t%s\tResponse data correct for %s", test.Success, url.QueryEscape(sample.query))
+	}
+}
@@ -0,0 +1,250 @@
+package handlers
+
+import (
+	"net/http"
+	"net/url"
+
+	"github.com/axwilliams/book-api/internal/business/oauth"
+	"github.com/axwilliams/book-api/internal/business/user"
+	"github.com/axwilliams/book-api/internal/platform/auth"
+	"github.com/axwilliams/book-api/internal/platform/web"
+	"github.com/gorilla/mux"
+)
+
+type OAuthHandler struct {
+	os oauth.Service
+	us user.Service
+}
+
+func NewOAuthHandler(os oauth.Service, us user.Service) OAuthHandler {
+	return OAuthHandler{
+		os,
+		us,
+	}
+}
+
+// AddClient registers a client. The response is the only time the secret
+// of a confidential client is shown.
+func (h *OAuthHandler) AddClient(w http.ResponseWriter, r *http.Request) {
+	nc := oauth.NewClient{}
+	if err := web.Decode(r, &nc); err != nil {
+		web.RespondError(w, err)
+		return
+	}
+
+	actorID, _ := auth.UserFromContext(r.Context())
+
+	c, err := h.os.Register(nc, actorID)
+	if err != nil {
+		web.RespondError(w, err)
+		return
+	}
+
+	web.Respond(w, c, http.StatusCreated)
+}
+
+func (h *OAuthHandler) FindClients(w http.ResponseWriter, r *http.Request) {
+	cs, err := h.os.FindClients()
+	if err != nil {
+		web.RespondError(w, err)
+		return
+	}
+
+	web.Respond(w, cs, http.StatusOK)
+}
+
+func (h *OAuthHandler) DeleteClient(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+
+	if err := h.os.DeleteClient(vars["id"]); err != nil {
+		web.RespondError(w, err)
+		return
+	}
+
+	web.Respond(w, nil, http.StatusOK)
+}
+
+// Authorize shows the consent page of an authorization request.
+func (h *OAuthHandler) Authorize(w http.ResponseWriter, r *http.Request) {
+	ar := oauth.NewAuthorizeRequest(r.URL.Query())
+
+	c, err := h.os.Authorize(ar)
+	if err != nil {
+		respondAuthorizeError(w, r, err)
+		return
+	}
+
+	pageHeaders(w)
+	w.WriteHeader(http.StatusOK)
+	oauth.RenderConsent(w, c, "")
+}
+
+// Consent handles the consent form: the user either denies the request or
+// logs in to allow it, and is sent back to the client either way.
+func (h *OAuthHandler) Consent(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		respondAuthorizeError(w, r, &oauth.Error{Code: "invalid_request", Description: "Form is malformed", Status: http.StatusBadRequest})
+		return
+	}
+
+	ar := oauth.NewAuthorizeRequest(r.PostForm)
+
+	if r.PostForm.Get("decision") != "allow" {
+		uri, err := h.os.Deny(ar)
+		if err != nil {
+			respondAuthorizeError(w, r, err)
+			return
+		}
+		http.Redirect(w, r, uri, http.StatusSeeOther)
+		return
+	}
+
+	claims, err := h.us.Authenticate(r.PostForm.Get("username"), r.PostForm.Get("password"))
+	if re, ok := err.(*web.RequestError); ok && re.Status == http.StatusUnauthorized {
+		c, err := h.os.Authorize(ar)
+		if err != nil {
+			respondAuthorizeError(w, r, err)
+			return
+		}
+
+		pageHeaders(w)
+		w.WriteHeader(http.StatusUnauthorized)
+		oauth.RenderConsent(w, c, re.Error())
+		return
+	}
+	if err != nil {
+		web.RespondError(w, err)
+		return
+	}
+
+	uri, err := h.os.Approve(ar, claims)
+	if err != nil {
+		respondAuthorizeError(w, r, err)
+		return
+	}
+
+	http.Redirect(w, r, uri, http.StatusSeeOther)
+}
+
+func (h *OAuthHandler) Token(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		respondOAuthError(w, &oauth.Error{Code: "invalid_request", Description: "Form is malformed", Status: http.StatusBadRequest})
+		return
+	}
+
+	id, secret := clientCredentials(r)
+
+	t, err := h.os.Token(oauth.TokenRequest{
+		GrantType:    r.PostForm.Get("grant_type"),
+		Code:         r.PostForm.Get("code"),
+		RedirectURI:  r.PostForm.Get("redirect_uri"),
+		CodeVerifier: r.PostForm.Get("code_verifier"),
+		Scope:        r.PostForm.Get("scope"),
+		ClientID:     id,
+		ClientSecret: secret,
+	})
+	if err != nil {
+		respondOAuthError(w, err)
+		return
+	}
+
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("Pragma", "no-cache")
+	web.Respond(w, t, http.StatusOK)
+}
+
+func (h *OAuthHandler) Introspect(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		respondOAuthError(w, &oauth.Error{Code: "invalid_request", Description: "Form is malformed", Status: http.StatusBadRequest})
+		return
+	}
+
+	id, secret := clientCredentials(r)
+
+	in, err := h.os.Introspect(id, secret, r.PostForm.Get("token"))
+	if err != nil {
+		respondOAuthError(w, err)
+		return
+	}
+
+	w.Header().Set("Cache-Control", "no-store")
+	web.Respond(w, in, http.StatusOK)
+}
+
+func (h *OAuthHandler) Revoke(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		respondOAuthError(w, &oauth.Error{Code: "invalid_request", Description: "Form is malformed", Status: http.StatusBadRequest})
+		return
+	}
+
+	id, secret := clientCredentials(r)
+
+	if err := h.os.Revoke(id, secret, r.PostForm.Get("token")); err != nil {
+		respondOAuthError(w, err)
+		return
+	}
+
+	web.Respond(w, nil, http.StatusOK)
+}
+
+// clientCredentials reads HTTP Basic authentication, whose parts are form
+// encoded (RFC 6749 section 2.3.1), or else the client_id and
+// client_secret form fields.
+func clientCredentials(r *http.Request) (string, string) {
+	id, secret, ok := r.BasicAuth()
+	if !ok {
+		return r.PostForm.Get("client_id"), r.PostForm.Get("client_secret")
+	}
+
+	if s, err := url.QueryUnescape(id); err == nil {
+		id = s
+	}
+	if s, err := url.QueryUnescape(secret); err == nil {
+		secret = s
+	}
+	return id, secret
+}
+
+// respondOAuthError answers in the error format of RFC 6749 section 5.2.
+func respondOAuthError(w http.ResponseWriter, err error) {
+	oe, ok := err.(*oauth.Error)
+	if !ok {
+		web.RespondError(w, err)
+		return
+	}
+
+	if oe.Status == http.StatusUnauthorized {
+		w.Header().Set("WWW-Authenticate", `Basic realm="book-api"`)
+	}
+	w.Header().Set("Cache-Control", "no-store")
+	web.Respond(w, oe, oe.Status)
+}
+
+// respondAuthorizeError sends the user agent back to the client when the
+// error allows it, and shows an error page otherwise.
+func respondAuthorizeError(w http.ResponseWriter, r *http.Request, err error) {
+	oe, ok := err.(*oauth.Error)
+	if !ok {
+		web.RespondError(w, err)
+		return
+	}
+
+	if uri, ok := oe.Redirect(); ok {
+		http.Redirect(w, r, uri, http.StatusFound)
+		return
+	}
+
+	pageHeaders(w)
+	w.WriteHeader(oe.Status)
+	oauth.RenderError(w, oe)
+}
+
+// pageHeaders keep the consent page out of frames, where a user could be
+// tricked into allowing a client, and out of caches.
+func pageHeaders(w http.ResponseWriter) {
+	w.Header().Set("Content-Type", oauth.ContentTypeHTML)
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("X-Frame-Options", "DENY")
+	w.Header().Set("Content-Security-Policy", "default-src 'none'; frame-ancestors 'none'")
+	w.Header().Set("Referrer-Policy", "no-referrer")
+}
@@ -0,0 +1,175 @@
+package handlers_test
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/axwilliams/book-api/cmd/book-api/handlers"
+	"github.com/axwilliams/book-api/internal/business/oauth"
+	"github.com/axwilliams/book-api/internal/business/role"
+	"github.com/axwilliams/book-api/internal/business/session"
+	"github.com/axwilliams/book-api/internal/business/user"
+	"github.com/axwilliams/book-api/internal/platform/auth"
+	"github.com/axwilliams/book-api/internal/test"
+	"github.com/axwilliams/book-api/internal/test/mock"
+)
+
+func TestOAuth(t *testing.T) {
+	mockSession := mock.NewMockSession()
+	mockUser := mock.NewMockUser()
+	rl := session.NewRevocationList(mockSession)
+	sessionService := session.NewService(mockSession, mockUser, rl, session.DefaultPolicy)
+	h := handlers.NewOAuthHandler(oauth.NewService(mock.NewMockOAuth(), mockUser, rl), user.NewService(mockUser, sessionService, role.NewRegistry(mock.NewMockRole())))
+
+	admin := auth.Claims{UserID: "a72bec75-0a5f-49af-a844-5763d188788e", Roles: []string{auth.RoleAdmin}}
+
+	register := func(payload string) map[string]interface{} {
+		r := httptest.NewRequest("POST", "/api/v1/oauth/clients", bytes.NewBufferString(payload))
+		r = r.WithContext(auth.ContextWithUser(r.Context(), admin))
+
+		rr := httptest.NewRecorder()
+		h.AddClient(rr, r)
+		if rr.Code != http.StatusCreated {
+			t.Fatalf("\t%s\tRegistering failed: %v %s", test.Failed, rr.Code, rr.Body.String())
+		}
+
+		c := map[string]interface{}{}
+		json.NewDecoder(rr.Body).Decode(&c)
+		return c
+	}
+
+	form := func(hf http.HandlerFunc, target string, v url.Values, user, password string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest("POST", target, strings.NewReader(v.Encode()))
+		r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		if user != "" {
+			r.SetBasicAuth(url.QueryEscape(user), url.QueryEscape(password))
+		}
+
+		rr := httptest.NewRecorder()
+		hf.ServeHTTP(rr, r)
+		return rr
+	}
+
+	app := register(`{"name": "Reading list", "grant_types": ["authorization_code"], "redirect_uris": ["https://app.example.com/cb"], "scopes": ["AUTHOR"]}`)
+	appID := app["client_id"].(string)
+
+	verifier := strings.Repeat("v", 64)
+	sum := sha256.Sum256([]byte(verifier))
+	ar := url.Values{
+		"response_type":         {"code"},
+		"client_id":             {appID},
+		"redirect_uri":          {"https://app.example.com/cb"},
+		"state":                 {"s1"},
+		"code_challenge":        {base64.RawURLEncoding.EncodeToString(sum[:])},
+		"code_challenge_method": {"S256"},
+	}
+
+	rr := httptest.NewRecorder()
+	h.Authorize(rr, httptest.NewRequest("GET", "/api/v1/oauth/authorize?"+ar.Encode(), nil))
+	switch {
+	case rr.Code != http.StatusOK || rr.Header().Get("Content-Type") != oauth.ContentTypeHTML:
+		t.Fatalf("\t%s\tConsent page not shown: %v", test.Failed, rr.Code)
+	case rr.Header().Get("X-Frame-Options") != "DENY" || !strings.Contains(rr.Body.String(), `value="`+appID+`"`):
+		t.Fatalf("\t%s\tWrong consent page: %v %s", test.Failed, rr.Header(), rr.Body.String())
+	}
+	t.Logf("\t%s\tConsent page shown", test.Success)
+
+	evil := url.Values{"response_type": {"code"}, "client_id": {appID}, "redirect_uri": {"https://evil.example.com/"}}
+	rr = httptest.NewRecorder()
+	h.Authorize(rr, httptest.NewRequest("GET", "/api/v1/oauth/authorize?"+evil.Encode(), nil))
+	if rr.Code != http.StatusBadRequest || rr.Header().Get("Location") != "" {
+		t.Fatalf("\t%s\tUnregistered redirect followed: %v %v", test.Failed, rr.Code, rr.Header())
+	}
+	t.Logf("\t%s\tUnregistered redirect not followed", test.Success)
+
+	consent := func(decision, password string) *httptest.ResponseRecorder {
+		v := url.Values{"decision": {decision}, "username": {"author"}, "password": {password}}
+		for k := range ar {
+			v.Set(k, ar.Get(k))
+		}
+		return form(h.Consent, "/api/v1/oauth/authorize", v, "", "")
+	}
+
+	if rr := consent("allow", "wrong"); rr.Code != http.StatusUnauthorized || !strings.Contains(rr.Body.String(), "<form") {
+		t.Fatalf("\t%s\tWrong password: want the form again got %v", test.Failed, rr.Code)
+	}
+	if rr := consent("deny", ""); rr.Code != http.StatusSeeOther || !strings.Contains(rr.Header().Get("Location"), "error=access_denied") {
+		t.Fatalf("\t%s\tDenied: wrong redirect %v %v", test.Failed, rr.Code, rr.Header())
+	}
+
+	rr = consent("allow", "Author#1")
+	loc, _ := url.Parse(rr.Header().Get("Location"))
+	if rr.Code != http.StatusSeeOther || loc.Host != "app.example.com" || loc.Query().Get("state") != "s1" || loc.Query().Get("code") == "" {
+		t.Fatalf("\t%s\tAllowed: wrong redirect %v %v", test.Failed, rr.Code, rr.Header())
+	}
+	t.Logf("\t%s\tConsent handled", test.Success)
+
+	exchange := url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {loc.Query().Get("code")},
+		"redirect_uri":  {"https://app.example.com/cb"},
+		"code_verifier": {verifier},
+		"client_id":     {appID},
+	}
+
+	rr = form(h.Token, "/api/v1/oauth/token", exchange, "", "")
+	tkn := oauth.Token{}
+	json.NewDecoder(rr.Body).Decode(&tkn)
+	if rr.Code != http.StatusOK || rr.Header().Get("Cache-Control") != "no-store" || tkn.Scope != "AUTHOR" {
+		t.Fatalf("\t%s\tExchange failed: %v %+v", test.Failed, rr.Code, tkn)
+	}
+	if claims, err := auth.ParseWithClaims(tkn.AccessToken); err != nil || claims.UserID != "69a47775-6d89-4d38-ad38-acdb2928f6a1" {
+		t.Fatalf("\t%s\tToken not accepted: %v", test.Failed, err)
+	}
+	t.Logf("\t%s\tCode exchanged", test.Success)
+
+	rr = form(h.Token, "/api/v1/oauth/token", exchange, "", "")
+	body := map[string]string{}
+	json.NewDecoder(rr.Body).Decode(&body)
+	if rr.Code != http.StatusBadRequest || body["error"] != "invalid_grant" {
+		t.Fatalf("\t%s\tReplay: want invalid_grant got %v %v", test.Failed, rr.Code, body)
+	}
+	t.Logf("\t%s\tReplay rejected", test.Success)
+
+	rs := register(`{"name": "Catalog", "grant_types": ["client_credentials"], "scopes": ["CURATOR"], "confidential": true}`)
+	rsID, rsSecret := rs["client_id"].(string), rs["client_secret"].(string)
+
+	if rr := form(h.Token, "/api/v1/oauth/token", url.Values{"grant_type": {"client_credentials"}}, rsID, "wrong"); rr.Code != http.StatusUnauthorized || rr.Header().Get("WWW-Authenticate") == "" {
+		t.Fatalf("\t%s\tWrong secret: want 401 got %v", test.Failed, rr.Code)
+	}
+
+	rr = form(h.Token, "/api/v1/oauth/token", url.Values{"grant_type": {"client_credentials"}}, rsID, rsSecret)
+	json.NewDecoder(rr.Body).Decode(&tkn)
+	if rr.Code != http.StatusOK || tkn.Scope != "CURATOR" {
+		t.Fatalf("\t%s\tClient credentials failed: %v %+v", test.Failed, rr.Code, tkn)
+	}
+	t.Logf("\t%s\tClient credentials handled", test.Success)
+
+	introspect := func() oauth.Introspection {
+		rr := form(h.Introspect, "/api/v1/oauth/introspect", url.Values{"token": {tkn.AccessToken}}, rsID, rsSecret)
+		if rr.Code != http.StatusOK {
+			t.Fatalf("\t%s\tIntrospection failed: %v", test.Failed, rr.Code)
+		}
+		in := oauth.Introspection{}
+		json.NewDecoder(rr.Body).Decode(&in)
+		return in
+	}
+
+	if in := introspect(); !in.Active || in.ClientID != rsID {
+		t.Fatalf("\t%s\tWrong introspection: %+v", test.Failed, in)
+	}
+	if rr := form(h.Revoke, "/api/v1/oauth/revoke", url.Values{"token": {tkn.AccessToken}}, rsID, rsSecret); rr.Code != http.StatusOK {
+		t.Fatalf("\t%s\tRevoking failed: %v", test.Failed, rr.Code)
+	}
+	if in := introspect(); in.Active {
+		t.Fatalf("\t%s\tRevoked token is active", test.Failed)
+	}
+	t.Logf("\t%s\tToken introspected and revoked", test.Success)
+}
@@ -0,0 +1,106 @@
+package handlers
+
+import (
+	"crypto/subtle"
+	"net/http"
+
+	"github.com/axwilliams/book-api/internal/business/oidc"
+	"github.com/axwilliams/book-api/internal/business/session"
+	"github.com/axwilliams/book-api/internal/platform/auth"
+	"github.com/axwilliams/book-api/internal/platform/web"
+)
+
+// oidcStateCookie binds a login to the browser that started it, so that
+// nobody can make a victim's browser complete a login of theirs.
+const oidcStateCookie = "oidc_state"
+
+type OIDCHandler struct {
+	os     oidc.Service
+	ss     session.Service
+	secure bool
+}
+
+// NewOIDCHandler sets the state cookie with the Secure flag when secure is
+// true, i.e. when the callback is served over https.
+func NewOIDCHandler(os oidc.Service, ss session.Service, secure bool) OIDCHandler {
+	return OIDCHandler{
+		os,
+		ss,
+		secure,
+	}
+}
+
+// Login sends the browser to the identity provider.
+func (h *OIDCHandler) Login(w http.ResponseWriter, r *http.Request) {
+	l, err := h.os.Login("")
+	if err != nil {
+		web.RespondError(w, err)
+		return
+	}
+
+	h.setState(w, l.State, int(oidc.StateLifetime.Seconds()))
+	http.Redirect(w, r, l.URL, http.StatusFound)
+}
+
+// Link starts a login that links the account at the identity provider to
+// the user making the request. The client opens the returned URL.
+func (h *OIDCHandler) Link(w http.ResponseWriter, r *http.Request) {
+	userID, _ := auth.UserFromContext(r.Context())
+
+	l, err := h.os.Login(userID)
+	if err != nil {
+		web.RespondError(w, err)
+		return
+	}
+
+	h.setState(w, l.State, int(oidc.StateLifetime.Seconds()))
+	web.Respond(w, l, http.StatusOK)
+}
+
+// Callback completes the login and answers with tokens, like
+// POST /users/token.
+func (h *OIDCHandler) Callback(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+
+	if q.Get("error") != "" {
+		web.RespondError(w, web.NewRequestError(oidc.ErrLoginFailed, http.StatusUnauthorized))
+		return
+	}
+
+	c, err := r.Cookie(oidcStateCookie)
+	if err != nil || q.Get("state") == "" || subtle.ConstantTimeCompare([]byte(c.Value), []byte(q.Get("state"))) != 1 {
+		web.RespondError(w, web.NewRequestError(oidc.ErrInvalidState, http.StatusBadRequest))
+		return
+	}
+	h.setState(w, "", -1)
+
+	claims, err := h.os.Callback(q.Get("state"), q.Get("code"))
+	if err != nil {
+		web.RespondError(w, err)
+		return
+	}
+
+	tk, err := h.ss.Issue(claims, session.NewSession{Device: "SSO"})
+	if err != nil {
+		web.RespondError(w, err)
+		return
+	}
+
+	w.Header().Set("Cache-Control", "no-store")
+	web.Respond(w, tk, http.StatusOK)
+}
+
+// setState sets the state cookie, or deletes it when maxAge is negative.
+// SameSite=Lax still sends it on the provider's redirect back, which is a
+// top-level navigation.
+func (h *OIDCHandler) setState(w http.ResponseWriter, state string, maxAge int) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     oidcStateCookie,
+		Value:    state,
+		Path:     "/api/v1/oidc",
+		MaxAge:   maxAge,
+		Secure:   h.secure,
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+	})
+}
@@ -0,0 +1,94 @@
+package handlers_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/axwilliams/book-api/cmd/book-api/handlers"
+	"github.com/axwilliams/book-api/internal/business/oidc"
+	"github.com/axwilliams/book-api/internal/business/role"
+	"github.com/axwilliams/book-api/internal/business/session"
+	"github.com/axwilliams/book-api/internal/business/user"
+	"github.com/axwilliams/book-api/internal/platform/auth"
+	"github.com/axwilliams/book-api/internal/test"
+	"github.com/axwilliams/book-api/internal/test/mock"
+)
+
+func TestOIDC(t *testing.T) {
+	p := mock.NewOIDCProvider("book-api", "s3cret")
+	srv := httptest.NewServer(p)
+	defer srv.Close()
+	p.SetIssuer(srv.URL)
+	p.SetUser(mock.OIDCUser{Subject: "author-sso", Email: "author@corp.example.com", EmailVerified: true})
+
+	mockSession := mock.NewMockSession()
+	mockUser := mock.NewMockUser()
+	sessionService := session.NewService(mockSession, mockUser, session.NewRevocationList(mockSession), session.DefaultPolicy)
+	oidcService := oidc.NewService(oidc.Config{
+		Issuer:       srv.URL,
+		ClientID:     "book-api",
+		ClientSecret: "s3cret",
+		RedirectURL:  "https://books.example.com/api/v1/oidc/callback",
+	}, mock.NewMockOIDC(), mockUser, user.NewService(mockUser, sessionService, role.NewRegistry(mock.NewMockRole())))
+	h := handlers.NewOIDCHandler(oidcService, sessionService, true)
+
+	// The author links their account: the response names the provider's
+	// login page and sets the state cookie.
+	r := httptest.NewRequest("POST", "/api/v1/oidc/link", nil)
+	r = r.WithContext(auth.ContextWithUser(r.Context(), auth.Claims{UserID: "69a47775-6d89-4d38-ad38-acdb2928f6a1", Roles: []string{auth.RoleAuthor}}))
+	rr := httptest.NewRecorder()
+	h.Link(rr, r)
+
+	body := map[string]string{}
+	json.NewDecoder(rr.Body).Decode(&body)
+	cookies := rr.Result().Cookies()
+	if rr.Code != http.StatusOK || len(cookies) != 1 || !cookies[0].HttpOnly || !cookies[0].Secure || body["authorization_url"] == "" {
+		t.Fatalf("\t%s\tLink not started: %v %v %v", test.Failed, rr.Code, cookies, body)
+	}
+	t.Logf("\t%s\tLink started", test.Success)
+
+	client := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error {
+		return http.ErrUseLastResponse
+	}}
+	res, err := client.Get(body["authorization_url"])
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+	loc, _ := url.Parse(res.Header.Get("Location"))
+	callback := "/api/v1/oidc/callback?" + loc.RawQuery
+
+	// Another browser cannot complete the login.
+	rr = httptest.NewRecorder()
+	h.Callback(rr, httptest.NewRequest("GET", callback, nil))
+	if rr.Code != http.StatusBadRequest {
+		t.Fatalf("\t%s\tCallback without the cookie: want 400 got %v", test.Failed, rr.Code)
+	}
+	t.Logf("\t%s\tCallback without the cookie rejected", test.Success)
+
+	r = httptest.NewRequest("GET", callback, nil)
+	r.AddCookie(cookies[0])
+	rr = httptest.NewRecorder()
+	h.Callback(rr, r)
+
+	tk := session.Tokens{}
+	json.NewDecoder(rr.Body).Decode(&tk)
+	if rr.Code != http.StatusOK || tk.RefreshToken == "" {
+		t.Fatalf("\t%s\tCallback failed: %v %+v", test.Failed, rr.Code, tk)
+	}
+	claims, err := auth.ParseWithClaims(tk.Token)
+	if err != nil || claims.UserID != "69a47775-6d89-4d38-ad38-acdb2928f6a1" {
+		t.Fatalf("\t%s\tWrong user: %+v %v", test.Failed, claims, err)
+	}
+	t.Logf("\t%s\tAccount linked and logged in", test.Success)
+
+	rr = httptest.NewRecorder()
+	h.Callback(rr, httptest.NewRequest("GET", "/api/v1/oidc/callback?"+url.Values{"error": {"access_denied"}}.Encode(), nil))
+	if rr.Code != http.StatusUnauthorized {
+		t.Fatalf("\t%s\tProvider error: want 401 got %v", test.Failed, rr.Code)
+	}
+	t.Logf("\t%s\tProvider error reported", test.Success)
+}
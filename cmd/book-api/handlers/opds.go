@@ -0,0 +1,100 @@
+package handlers
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/axwilliams/book-api/internal/business/opds"
+	"github.com/axwilliams/book-api/internal/platform/web"
+)
+
+type OPDSHandler struct {
+	os opds.Service
+}
+
+func NewOPDSHandler(os opds.Service) OPDSHandler {
+	return OPDSHandler{
+		os,
+	}
+}
+
+func (h *OPDSHandler) Root(w http.ResponseWriter, r *http.Request) {
+	writeFeed(w, r, h.os.Root())
+}
+
+func (h *OPDSHandler) Categories(w http.ResponseWriter, r *http.Request) {
+	h.navigation(w, r, "categories")
+}
+
+func (h *OPDSHandler) Authors(w http.ResponseWriter, r *http.Request) {
+	h.navigation(w, r, "authors")
+}
+
+func (h *OPDSHandler) navigation(w http.ResponseWriter, r *http.Request, section string) {
+	f, err := h.os.Navigation(section)
+	if err != nil {
+		web.RespondError(w, err)
+		return
+	}
+
+	writeFeed(w, r, f)
+}
+
+func (h *OPDSHandler) Books(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+
+	f, err := h.os.Books(opds.Query{
+		Category: q.Get("category"),
+		Author:   q.Get("author"),
+		Search:   q.Get("q"),
+		New:      q.Get("sort") == "new",
+		Page:     q.Get("page"),
+	})
+	if err != nil {
+		web.RespondError(w, err)
+		return
+	}
+
+	writeFeed(w, r, f)
+}
+
+func (h *OPDSHandler) OpenSearch(w http.ResponseWriter, r *http.Request) {
+	body, err := h.os.OpenSearch()
+	if err != nil {
+		web.RespondError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", opds.ContentTypeOpenSearch)
+	w.WriteHeader(http.StatusOK)
+	w.Write(body)
+}
+
+// writeFeed renders OPDS 2.0 for clients that ask for it and OPDS 1.2
+// otherwise, which is what most e-reader apps, KOReader among them, expect.
+func writeFeed(w http.ResponseWriter, r *http.Request, f *opds.Feed) {
+	var (
+		body        []byte
+		err         error
+		contentType string
+	)
+
+	if strings.Contains(r.Header.Get("Accept"), opds.ContentTypeOPDS2) {
+		body, err = opds.JSON(f)
+		contentType = opds.ContentTypeOPDS2
+	} else {
+		body, err = opds.Atom(f)
+		contentType = opds.ContentTypeNavigation
+		if f.Kind == opds.KindAcquisition {
+			contentType = opds.ContentTypeAcquisition
+		}
+	}
+	if err != nil {
+		web.RespondError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", contentType)
+	w.WriteHeader(http.StatusOK)
+	w.Write(body)
+}
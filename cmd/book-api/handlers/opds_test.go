@@ -0,0 +1,127 @@
+package handlers_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/axwilliams/book-api/cmd/book-api/handlers"
+	"github.com/axwilliams/book-api/internal/business/book"
+	"github.com/axwilliams/book-api/internal/business/opds"
+	"github.com/axwilliams/book-api/internal/platform/policy"
+	"github.com/axwilliams/book-api/internal/test"
+	"github.com/axwilliams/book-api/internal/test/mock"
+)
+
+var opdsHandler handlers.OPDSHandler
+
+func init() {
+	opdsService := opds.NewService(book.NewService(mock.NewMockBook(), policy.NewEngine("")))
+	opdsHandler = handlers.NewOPDSHandler(opdsService)
+}
+
+func TestOPDS(t *testing.T) {
+	samples := []struct {
+		url         string
+		handler     http.HandlerFunc
+		accept      string
+		statusCode  int
+		contentType string
+		contains    []string
+	}{
+		// Root navigation feed
+		{
+			url:         "/api/v1/opds",
+			handler:     opdsHandler.Root,
+			statusCode:  http.StatusOK,
+			contentType: opds.ContentTypeNavigation,
+			contains:    []string{`<link rel="http://opds-spec.org/sort/new" href="/api/v1/opds/books?sort=new"`, `type="application/opensearchdescription+xml"`},
+		},
+		// Categories with counts
+		{
+			url:         "/api/v1/opds/categories",
+			handler:     opdsHandler.Categories,
+			statusCode:  http.StatusOK,
+			contentType: opds.ContentTypeNavigation,
+			contains:    []string{`href="/api/v1/opds/books?category=Fiction"`, `thr:count="2"`},
+		},
+		// Authors as OPDS 2
+		{
+			url:         "/api/v1/opds/authors",
+			handler:     opdsHandler.Authors,
+			accept:      opds.ContentTypeOPDS2,
+			statusCode:  http.StatusOK,
+			contentType: opds.ContentTypeOPDS2,
+			contains:    []string{`"navigation":[`, `"href":"/api/v1/opds/books?author=Franz+Kafka"`},
+		},
+		// Category acquisition feed
+		{
+			url:         "/api/v1/opds/books?category=Fiction",
+			handler:     opdsHandler.Books,
+			statusCode:  http.StatusOK,
+			contentType: opds.ContentTypeAcquisition,
+			contains:    []string{"<title>The Castle</title>", "<title>Fahrenheit 451</title>", "<dc:identifier>urn:isbn:978-0241372579</dc:identifier>"},
+		},
+		// Search
+		{
+			url:         "/api/v1/opds/books?q=Kafka",
+			handler:     opdsHandler.Books,
+			statusCode:  http.StatusOK,
+			contentType: opds.ContentTypeAcquisition,
+			contains:    []string{"<title>Search results for Kafka</title>", "<title>The Castle</title>"},
+		},
+		// Later page links back
+		{
+			url:         "/api/v1/opds/books?q=Kafka&page=2",
+			handler:     opdsHandler.Books,
+			statusCode:  http.StatusOK,
+			contentType: opds.ContentTypeAcquisition,
+			contains:    []string{`<link rel="previous" href="/api/v1/opds/books?q=Kafka"`, "<opensearch:startIndex>51</opensearch:startIndex>"},
+		},
+		// Invalid page
+		{
+			url:        "/api/v1/opds/books?page=0",
+			handler:    opdsHandler.Books,
+			statusCode: http.StatusBadRequest,
+			contains:   []string{`{"message":"` + opds.ErrInvalidPage.Error() + `"}`},
+		},
+		// OpenSearch description
+		{
+			url:         "/api/v1/opds/opensearch.xml",
+			handler:     opdsHandler.OpenSearch,
+			statusCode:  http.StatusOK,
+			contentType: opds.ContentTypeOpenSearch,
+			contains:    []string{`template="/api/v1/opds/books?q={searchTerms}&amp;page={startPage?}"`},
+		},
+	}
+
+	for _, sample := range samples {
+		r, err := http.NewRequest("GET", sample.url, nil)
+		if err != nil {
+			t.Errorf("\t%s\tRequest failed: %v\n", test.Failed, err)
+		}
+
+		r.Header.Set("Accept", sample.accept)
+
+		rr := httptest.NewRecorder()
+		sample.handler.ServeHTTP(rr, r)
+
+		if sample.statusCode != rr.Code {
+			t.Fatalf("\t%s\tWrong status code for %s: want %v got %v", test.Failed, sample.url, sample.statusCode, rr.Code)
+		}
+		t.Logf("\t%s\tStatus code correct: %v", test.Success, rr.Code)
+
+		if sample.contentType != "" && rr.Header().Get("Content-Type") != sample.contentType {
+			t.Fatalf("\t%s\tWrong content type: want %v got %v", test.Failed, sample.contentType, rr.Header().Get("Content-Type"))
+		}
+
+		res := rr.Body.String()
+		for _, c := range sample.contains {
+			if !strings.Contains(res, c) {
+				t.Fatalf("\t%s\tResponse for %s is missing %q: got %s", test.Failed, sample.url, c, res)
+			}
+		}
+		t.Logf("\t%s\tResponse data correct", test.Success)
+	}
+}
@@ -0,0 +1,37 @@
+package handlers
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/axwilliams/book-api/internal/business/recommend"
+	"github.com/axwilliams/book-api/internal/platform/web"
+	"github.com/gorilla/mux"
+)
+
+type RecommendHandler struct {
+	rs recommend.Service
+}
+
+func NewRecommendHandler(rs recommend.Service) RecommendHandler {
+	return RecommendHandler{
+		rs,
+	}
+}
+
+func (h *RecommendHandler) Similar(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+
+	recs, err := h.rs.Similar(vars["id"], visibleStatus(r), strings.TrimSpace(r.URL.Query().Get("limit")))
+	if err != nil {
+		web.RespondError(w, err)
+		return
+	}
+
+	if isAnonymous(r) {
+		web.Respond(w, recommend.Public(recs), http.StatusOK)
+		return
+	}
+
+	web.Respond(w, recs, http.StatusOK)
+}
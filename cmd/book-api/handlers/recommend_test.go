@@ -0,0 +1,78 @@
+package handlers_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/axwilliams/book-api/cmd/book-api/handlers"
+	"github.com/axwilliams/book-api/internal/business/book"
+	"github.com/axwilliams/book-api/internal/business/recommend"
+	"github.com/axwilliams/book-api/internal/test"
+	"github.com/axwilliams/book-api/internal/test/mock"
+	"github.com/gorilla/mux"
+)
+
+var recommendHandler handlers.RecommendHandler
+
+func init() {
+	recommendService := recommend.NewService(mock.NewMockRecommend(), mock.NewMockBook())
+	recommendHandler = handlers.NewRecommendHandler(recommendService)
+}
+
+func TestSimilarBooks(t *testing.T) {
+	samples := []struct {
+		id         string
+		statusCode int
+		expected   string
+	}{
+		// Invalid ID
+		{
+			id:         "f4ac7e14-fc8e-4096-b956-34e5a",
+			statusCode: http.StatusBadRequest,
+			expected:   `{"message":"` + book.ErrInvalidID.Error() + `"}`,
+		},
+		// Not found
+		{
+			id:         "7b6807c2-1e11-4e38-bdfd-281186885c3f",
+			statusCode: http.StatusNotFound,
+			expected:   `{"message":"` + book.ErrNoBookFound.Error() + `"}`,
+		},
+		// Not published
+		{
+			id:         "d2b4a1c7-5e33-4b8a-9c1e-6f0d3a2b7c91",
+			statusCode: http.StatusNotFound,
+			expected:   `{"message":"` + book.ErrNoBookFound.Error() + `"}`,
+		},
+		// Success
+		{
+			id:         "562e1fe0-0dde-4717-a008-cd2a699301d2",
+			statusCode: http.StatusOK,
+			expected:   `[{"book":{"id":"f4ac7e14-fc8e-4096-b956-34e5a33040f2","isbn":"978-0241372579","title":"The Castle","author":"Franz Kafka","category":"Fiction","status":"published"},"score":0.5,"reasons":["same author","same category"]}]`,
+		},
+	}
+
+	for _, sample := range samples {
+		r, err := newUserRequest("GET", "/api/v1/books/similar", nil)
+		if err != nil {
+			t.Errorf("\t%s\tRequest failed: %v\n", test.Failed, err)
+		}
+
+		r = mux.SetURLVars(r, map[string]string{"id": sample.id})
+
+		rr := httptest.NewRecorder()
+		h := http.HandlerFunc(recommendHandler.Similar)
+		h.ServeHTTP(rr, r)
+
+		if sample.statusCode != rr.Code {
+			t.Fatalf("\t%s\tWrong status code: want %v got %v", test.Failed, sample.statusCode, rr.Code)
+		}
+		t.Logf("\t%s\tStatus code correct: %v", test.Success, rr.Code)
+
+		res := rr.Body.String()
+		if res != sample.expected {
+			t.Fatalf("\t%s\tWrong response: want %v got %v", test.Failed, sample.expected, res)
+		}
+		t.Logf("\t%s\tResponse data correct", test.Success)
+	}
+}
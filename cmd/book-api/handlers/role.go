@@ -0,0 +1,91 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/axwilliams/book-api/internal/business/role"
+	"github.com/axwilliams/book-api/internal/platform/web"
+	"github.com/gorilla/mux"
+)
+
+type RoleHandler struct {
+	rs role.Service
+}
+
+func NewRoleHandler(rs role.Service) RoleHandler {
+	return RoleHandler{
+		rs,
+	}
+}
+
+// Permissions lists every permission a role can grant.
+func (h *RoleHandler) Permissions(w http.ResponseWriter, r *http.Request) {
+	web.Respond(w, h.rs.Permissions(), http.StatusOK)
+}
+
+func (h *RoleHandler) FindAll(w http.ResponseWriter, r *http.Request) {
+	rs, err := h.rs.FindAll()
+	if err != nil {
+		web.RespondError(w, err)
+		return
+	}
+
+	web.Respond(w, rs, http.StatusOK)
+}
+
+func (h *RoleHandler) FindByName(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+
+	ro, err := h.rs.FindByName(vars["name"])
+	if err != nil {
+		web.RespondError(w, err)
+		return
+	}
+
+	web.Respond(w, ro, http.StatusOK)
+}
+
+func (h *RoleHandler) Add(w http.ResponseWriter, r *http.Request) {
+	nr := role.NewRole{}
+	if err := web.Decode(r, &nr); err != nil {
+		web.RespondError(w, err)
+		return
+	}
+
+	ro, err := h.rs.Create(nr)
+	if err != nil {
+		web.RespondError(w, err)
+		return
+	}
+
+	web.Respond(w, ro, http.StatusCreated)
+}
+
+func (h *RoleHandler) Edit(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+
+	ur := role.UpdateRole{}
+	if err := web.Decode(r, &ur); err != nil {
+		web.RespondError(w, err)
+		return
+	}
+
+	ro, err := h.rs.Update(vars["name"], ur)
+	if err != nil {
+		web.RespondError(w, err)
+		return
+	}
+
+	web.Respond(w, ro, http.StatusOK)
+}
+
+func (h *RoleHandler) Delete(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+
+	if err := h.rs.Delete(vars["name"]); err != nil {
+		web.RespondError(w, err)
+		return
+	}
+
+	web.Respond(w, nil, http.StatusOK)
+}
@@ -0,0 +1,75 @@
+package handlers_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/axwilliams/book-api/cmd/book-api/handlers"
+	"github.com/axwilliams/book-api/internal/business/role"
+	"github.com/axwilliams/book-api/internal/test"
+	"github.com/axwilliams/book-api/internal/test/mock"
+	"github.com/gorilla/mux"
+)
+
+func TestRoles(t *testing.T) {
+	rr := mock.NewMockRole()
+	h := handlers.NewRoleHandler(role.NewService(rr, role.NewRegistry(rr)))
+
+	serve := func(hf http.HandlerFunc, method, payload, name string) *httptest.ResponseRecorder {
+		r, err := http.NewRequest(method, "/api/v1/roles", bytes.NewBufferString(payload))
+		if err != nil {
+			t.Errorf("\t%s\tRequest failed: %v\n", test.Failed, err)
+		}
+		r = mux.SetURLVars(r, map[string]string{"name": name})
+
+		rec := httptest.NewRecorder()
+		hf.ServeHTTP(rec, r)
+		return rec
+	}
+
+	samples := []struct {
+		name       string
+		hf         http.HandlerFunc
+		method     string
+		payload    string
+		role       string
+		statusCode int
+	}{
+		{"Unknown field", h.Add, "POST", `{"name": "EDITOR", "perms": []}`, "", http.StatusBadRequest},
+		{"Missing name", h.Add, "POST", `{"permissions": ["books:review"]}`, "", http.StatusUnprocessableEntity},
+		{"Created", h.Add, "POST", `{"name": "EDITOR", "permissions": ["books:review"], "inherits": ["AUTHOR"]}`, "", http.StatusCreated},
+		{"Edited", h.Edit, "PATCH", `{"description": "Reviews books"}`, "EDITOR", http.StatusOK},
+		{"ADMIN edited", h.Edit, "PATCH", `{"permissions": []}`, "ADMIN", http.StatusConflict},
+		{"Found", h.FindByName, "GET", "", "editor", http.StatusOK},
+		{"Built-in deleted", h.Delete, "DELETE", "", "AUTHOR", http.StatusConflict},
+		{"Deleted", h.Delete, "DELETE", "", "EDITOR", http.StatusOK},
+		{"Not found", h.FindByName, "GET", "", "EDITOR", http.StatusNotFound},
+	}
+
+	for _, sample := range samples {
+		rec := serve(sample.hf, sample.method, sample.payload, sample.role)
+		if sample.statusCode != rec.Code {
+			t.Fatalf("\t%s\t%s: want %v got %v", test.Failed, sample.name, sample.statusCode, rec.Code)
+		}
+
+		if sample.name == "Found" {
+			var r role.Role
+			json.NewDecoder(rec.Body).Decode(&r)
+			if r.Description != "Reviews books" || len(r.Effective) != 7 {
+				t.Fatalf("\t%s\tWrong role: %+v", test.Failed, r)
+			}
+		}
+		t.Logf("\t%s\t%s", test.Success, sample.name)
+	}
+
+	rec := serve(h.Permissions, "GET", "", "")
+	var ps []role.Permission
+	json.NewDecoder(rec.Body).Decode(&ps)
+	if rec.Code != http.StatusOK || len(ps) == 0 || ps[0].Description == "" {
+		t.Fatalf("\t%s\tWrong permissions: %v", test.Failed, ps)
+	}
+	t.Logf("\t%s\tPermissions listed", test.Success)
+}
@@ -0,0 +1,97 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/axwilliams/book-api/internal/business/book"
+	"github.com/axwilliams/book-api/internal/business/series"
+	"github.com/axwilliams/book-api/internal/platform/web"
+	"github.com/gorilla/mux"
+)
+
+type SeriesHandler struct {
+	ss series.Service
+}
+
+func NewSeriesHandler(ss series.Service) SeriesHandler {
+	return SeriesHandler{
+		ss,
+	}
+}
+
+func (h *SeriesHandler) FindAll(w http.ResponseWriter, r *http.Request) {
+	srs, err := h.ss.GetAll()
+	if err != nil {
+		web.RespondError(w, err)
+		return
+	}
+
+	web.Respond(w, srs, http.StatusOK)
+}
+
+func (h *SeriesHandler) FindById(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+
+	status := book.StatusPublished
+	if isEditor(r) {
+		status = ""
+	}
+
+	sr, err := h.ss.GetById(vars["id"], status)
+	if err != nil && err != series.ErrNoSeriesFound {
+		web.RespondError(w, err)
+		return
+	}
+
+	if sr != nil && isAnonymous(r) {
+		web.Respond(w, sr.Public(), http.StatusOK)
+		return
+	}
+
+	web.Respond(w, sr, http.StatusOK)
+}
+
+func (h *SeriesHandler) Add(w http.ResponseWriter, r *http.Request) {
+	ns := series.NewSeries{}
+
+	if err := web.Decode(r, &ns); err != nil {
+		web.RespondError(w, err)
+		return
+	}
+
+	sr, err := h.ss.Create(&ns)
+	if err != nil {
+		web.RespondError(w, err)
+		return
+	}
+
+	web.Respond(w, web.Message("id", sr.ID), http.StatusCreated)
+}
+
+func (h *SeriesHandler) Edit(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+
+	us := series.UpdateSeries{}
+	if err := web.Decode(r, &us); err != nil {
+		web.RespondError(w, err)
+		return
+	}
+
+	if err := h.ss.Update(vars["id"], us); err != nil {
+		web.RespondError(w, err)
+		return
+	}
+
+	web.Respond(w, nil, http.StatusOK)
+}
+
+func (h *SeriesHandler) Delete(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+
+	if err := h.ss.Destroy(vars["id"]); err != nil {
+		web.RespondError(w, err)
+		return
+	}
+
+	web.Respond(w, nil, http.StatusOK)
+}
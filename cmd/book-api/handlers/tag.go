@@ -0,0 +1,125 @@
+package handlers
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/axwilliams/book-api/internal/business/tag"
+	"github.com/axwilliams/book-api/internal/platform/auth"
+	"github.com/axwilliams/book-api/internal/platform/web"
+	"github.com/gorilla/mux"
+)
+
+type TagHandler struct {
+	ts tag.Service
+}
+
+func NewTagHandler(ts tag.Service) TagHandler {
+	return TagHandler{
+		ts,
+	}
+}
+
+func (h *TagHandler) FindByBook(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+
+	ts, err := h.ts.GetByBook(vars["id"], visibleStatus(r))
+	if err != nil {
+		web.RespondError(w, err)
+		return
+	}
+
+	web.Respond(w, ts, http.StatusOK)
+}
+
+func (h *TagHandler) Add(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+
+	nt := tag.NewTags{}
+	if err := web.Decode(r, &nt); err != nil {
+		web.RespondError(w, err)
+		return
+	}
+
+	ts, err := h.ts.Tag(vars["id"], visibleStatus(r), nt.Tags, subject(r))
+	if err != nil {
+		web.RespondError(w, err)
+		return
+	}
+
+	web.Respond(w, ts, http.StatusOK)
+}
+
+func (h *TagHandler) Remove(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+
+	curator := auth.Can(r.Context(), auth.PermTagsManage)
+
+	if err := h.ts.Untag(vars["id"], visibleStatus(r), vars["tag"], subject(r), curator); err != nil {
+		web.RespondError(w, err)
+		return
+	}
+
+	web.Respond(w, nil, http.StatusOK)
+}
+
+func (h *TagHandler) Popular(w http.ResponseWriter, r *http.Request) {
+	ts, err := h.ts.Popular(strings.TrimSpace(r.URL.Query().Get("limit")))
+	if err != nil {
+		web.RespondError(w, err)
+		return
+	}
+
+	web.Respond(w, ts, http.StatusOK)
+}
+
+func (h *TagHandler) Edit(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+
+	ut := tag.UpdateTag{}
+	if err := web.Decode(r, &ut); err != nil {
+		web.RespondError(w, err)
+		return
+	}
+
+	if err := h.ts.Rename(vars["id"], ut); err != nil {
+		web.RespondError(w, err)
+		return
+	}
+
+	web.Respond(w, nil, http.StatusOK)
+}
+
+func (h *TagHandler) Merge(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+
+	mt := tag.MergeTag{}
+	if err := web.Decode(r, &mt); err != nil {
+		web.RespondError(w, err)
+		return
+	}
+
+	if err := h.ts.Merge(vars["id"], mt); err != nil {
+		web.RespondError(w, err)
+		return
+	}
+
+	web.Respond(w, nil, http.StatusOK)
+}
+
+func (h *TagHandler) AddSynonym(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+
+	ns := tag.NewSynonym{}
+	if err := web.Decode(r, &ns); err != nil {
+		web.RespondError(w, err)
+		return
+	}
+
+	if err := h.ts.AddSynonym(vars["id"], ns); err != nil {
+		web.RespondError(w, err)
+		return
+	}
+
+	web.Respond(w, nil, http.StatusCreated)
+}
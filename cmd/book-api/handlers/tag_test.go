@@ -0,0 +1,159 @@
+package handlers_test
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/axwilliams/book-api/cmd/book-api/handlers"
+	"github.com/axwilliams/book-api/internal/business/book"
+	"github.com/axwilliams/book-api/internal/business/tag"
+	"github.com/axwilliams/book-api/internal/platform/policy"
+	"github.com/axwilliams/book-api/internal/test"
+	"github.com/axwilliams/book-api/internal/test/mock"
+	"github.com/gorilla/mux"
+)
+
+var tagHandler handlers.TagHandler
+
+func init() {
+	tagService := tag.NewService(mock.NewMockTag(), mock.NewMockBook(), policy.NewEngine(""))
+	tagHandler = handlers.NewTagHandler(tagService)
+}
+
+func TestTagHandlers(t *testing.T) {
+	samples := []struct {
+		name       string
+		handler    http.HandlerFunc
+		vars       map[string]string
+		payload    string
+		statusCode int
+		expected   string
+	}{
+		{
+			name:       "Tag unknown book",
+			handler:    tagHandler.Add,
+			vars:       map[string]string{"id": "7b6807c2-1e11-4e38-bdfd-281186885c3f"},
+			payload:    `{"tags":["dystopia"]}`,
+			statusCode: http.StatusNotFound,
+			expected:   `{"message":"` + book.ErrNoBookFound.Error() + `"}`,
+		},
+		{
+			name:       "Tags of an unpublished book",
+			handler:    tagHandler.FindByBook,
+			vars:       map[string]string{"id": "d2b4a1c7-5e33-4b8a-9c1e-6f0d3a2b7c91"},
+			statusCode: http.StatusNotFound,
+			expected:   `{"message":"` + book.ErrNoBookFound.Error() + `"}`,
+		},
+		{
+			name:       "Tag an unpublished book",
+			handler:    tagHandler.Add,
+			vars:       map[string]string{"id": "d2b4a1c7-5e33-4b8a-9c1e-6f0d3a2b7c91"},
+			payload:    `{"tags":["dystopia"]}`,
+			statusCode: http.StatusNotFound,
+			expected:   `{"message":"` + book.ErrNoBookFound.Error() + `"}`,
+		},
+		{
+			name:       "Tag with an empty name",
+			handler:    tagHandler.Add,
+			vars:       map[string]string{"id": "f4ac7e14-fc8e-4096-b956-34e5a33040f2"},
+			payload:    `{"tags":["dystopia","  # "]}`,
+			statusCode: http.StatusUnprocessableEntity,
+			expected:   `{"message":"` + tag.ErrInvalidName.Error() + `"}`,
+		},
+		{
+			name:       "Tag book",
+			handler:    tagHandler.Add,
+			vars:       map[string]string{"id": "f4ac7e14-fc8e-4096-b956-34e5a33040f2"},
+			payload:    `{"tags":["  Dystopia "]}`,
+			statusCode: http.StatusOK,
+			expected:   `[{"id":"5f0c3a44-9e0b-4c3f-8a61-2d7e1c7b9a01","name":"dystopia"}]`,
+		},
+		{
+			name:       "Untag by synonym never added",
+			handler:    tagHandler.Remove,
+			vars:       map[string]string{"id": "f4ac7e14-fc8e-4096-b956-34e5a33040f2", "tag": "Sci Fi"},
+			statusCode: http.StatusGone,
+			expected:   `{"message":"` + tag.ErrNoAffect.Error() + `"}`,
+		},
+		{
+			name:       "Untag",
+			handler:    tagHandler.Remove,
+			vars:       map[string]string{"id": "f4ac7e14-fc8e-4096-b956-34e5a33040f2", "tag": "#dystopia"},
+			statusCode: http.StatusOK,
+			expected:   "",
+		},
+		{
+			name:       "Popular",
+			handler:    tagHandler.Popular,
+			statusCode: http.StatusOK,
+			expected:   `[{"id":"5f0c3a44-9e0b-4c3f-8a61-2d7e1c7b9a01","name":"dystopia","count":2},{"id":"8e2d1b6f-4a7c-4f0e-b3d5-9c1a2e4f6b02","name":"science fiction","count":1}]`,
+		},
+		{
+			name:       "Rename",
+			handler:    tagHandler.Edit,
+			vars:       map[string]string{"id": "5f0c3a44-9e0b-4c3f-8a61-2d7e1c7b9a01"},
+			payload:    `{"name":"Sci-Fi"}`,
+			statusCode: http.StatusOK,
+			expected:   "",
+		},
+		{
+			name:       "Rename onto another tag",
+			handler:    tagHandler.Edit,
+			vars:       map[string]string{"id": "5f0c3a44-9e0b-4c3f-8a61-2d7e1c7b9a01"},
+			payload:    `{"name":"Sci Fi"}`,
+			statusCode: http.StatusConflict,
+			expected:   `{"message":"` + tag.ErrTagExists.Error() + `"}`,
+		},
+		{
+			name:       "Merge into itself",
+			handler:    tagHandler.Merge,
+			vars:       map[string]string{"id": "5f0c3a44-9e0b-4c3f-8a61-2d7e1c7b9a01"},
+			payload:    `{"into":"5f0c3a44-9e0b-4c3f-8a61-2d7e1c7b9a01"}`,
+			statusCode: http.StatusUnprocessableEntity,
+			expected:   `{"message":"` + tag.ErrMergeSelf.Error() + `"}`,
+		},
+		{
+			name:       "Merge",
+			handler:    tagHandler.Merge,
+			vars:       map[string]string{"id": "5f0c3a44-9e0b-4c3f-8a61-2d7e1c7b9a01"},
+			payload:    `{"into":"8e2d1b6f-4a7c-4f0e-b3d5-9c1a2e4f6b02"}`,
+			statusCode: http.StatusOK,
+			expected:   "",
+		},
+		{
+			name:       "Synonym already taken",
+			handler:    tagHandler.AddSynonym,
+			vars:       map[string]string{"id": "5f0c3a44-9e0b-4c3f-8a61-2d7e1c7b9a01"},
+			payload:    `{"name":"SCIENCE  FICTION"}`,
+			statusCode: http.StatusConflict,
+			expected:   `{"message":"` + tag.ErrTagExists.Error() + `"}`,
+		},
+	}
+
+	for _, sample := range samples {
+		r, err := newUserRequest("POST", "/api/v1/tags", bytes.NewBufferString(sample.payload))
+		if err != nil {
+			t.Errorf("\t%s\tRequest failed: %v\n", test.Failed, err)
+		}
+
+		if sample.vars != nil {
+			r = mux.SetURLVars(r, sample.vars)
+		}
+
+		rr := httptest.NewRecorder()
+		sample.handler.ServeHTTP(rr, r)
+
+		if sample.statusCode != rr.Code {
+			t.Fatalf("\t%s\t%s: wrong status code: want %v got %v", test.Failed, sample.name, sample.statusCode, rr.Code)
+		}
+		t.Logf("\t%s\t%s: status code correct: %v", test.Success, sample.name, rr.Code)
+
+		res := rr.Body.String()
+		if res != sample.expected {
+			t.Fatalf("\t%s\t%s: wrong response: want %v got %v", test.Failed, sample.name, sample.expected, res)
+		}
+		t.Logf("\t%s\t%s: response data correct", test.Success, sample.name)
+	}
+}
@@ -2,7 +2,9 @@ package handlers
 
 import (
 	"net/http"
+	"time"
 
+	"github.com/axwilliams/book-api/internal/business/session"
 	"github.com/axwilliams/book-api/internal/business/user"
 	"github.com/axwilliams/book-api/internal/platform/auth"
 	"github.com/axwilliams/book-api/internal/platform/web"
@@ -11,11 +13,13 @@ import (
 
 type UserHandler struct {
 	us user.Service
+	ss session.Service
 }
 
-func NewUserHandler(us user.Service) UserHandler {
+func NewUserHandler(us user.Service, ss session.Service) UserHandler {
 	return UserHandler{
 		us,
+		ss,
 	}
 }
 
@@ -27,7 +31,9 @@ func (h *UserHandler) Add(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	u, err := h.us.Create(&nu)
+	actorID, _ := auth.UserFromContext(r.Context())
+
+	u, err := h.us.Create(&nu, actorID)
 	if err != nil {
 		web.RespondError(w, err)
 		return
@@ -45,7 +51,9 @@ func (h *UserHandler) Edit(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if err := h.us.Update(vars["id"], uu); err != nil {
+	actorID, _ := auth.UserFromContext(r.Context())
+
+	if err := h.us.Update(vars["id"], uu, actorID); err != nil {
 		web.RespondError(w, err)
 		return
 	}
@@ -55,8 +63,9 @@ func (h *UserHandler) Edit(w http.ResponseWriter, r *http.Request) {
 
 func (h *UserHandler) Delete(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
+	actorID, _ := auth.UserFromContext(r.Context())
 
-	if err := h.us.Destroy(vars["id"]); err != nil {
+	if err := h.us.Destroy(vars["id"], actorID); err != nil {
 		web.RespondError(w, err)
 		return
 	}
@@ -64,6 +73,47 @@ func (h *UserHandler) Delete(w http.ResponseWriter, r *http.Request) {
 	web.Respond(w, nil, http.StatusOK)
 }
 
+func (h *UserHandler) GrantRole(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	actorID, _ := auth.UserFromContext(r.Context())
+
+	u, err := h.us.Grant(vars["id"], vars["role"], actorID)
+	if err != nil {
+		web.RespondError(w, err)
+		return
+	}
+
+	web.Respond(w, web.Message("roles", u.Roles), http.StatusOK)
+}
+
+func (h *UserHandler) RevokeRole(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	actorID, _ := auth.UserFromContext(r.Context())
+
+	u, err := h.us.Revoke(vars["id"], vars["role"], actorID)
+	if err != nil {
+		web.RespondError(w, err)
+		return
+	}
+
+	web.Respond(w, web.Message("roles", u.Roles), http.StatusOK)
+}
+
+func (h *UserHandler) RoleHistory(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+
+	cs, err := h.us.RoleChanges(vars["id"])
+	if err != nil {
+		web.RespondError(w, err)
+		return
+	}
+
+	web.Respond(w, cs, http.StatusOK)
+}
+
+// Token logs a user in with Basic auth. The optional device and ttl
+// parameters name the device and shorten how long its refresh token may sit
+// unused.
 func (h *UserHandler) Token(w http.ResponseWriter, r *http.Request) {
 	username, password, ok := r.BasicAuth()
 	if !ok {
@@ -71,17 +121,79 @@ func (h *UserHandler) Token(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	ns := session.NewSession{Device: r.URL.Query().Get("device")}
+	if ttl := r.URL.Query().Get("ttl"); ttl != "" {
+		d, err := time.ParseDuration(ttl)
+		if err != nil || d <= 0 {
+			web.RespondError(w, web.NewRequestError(session.ErrInvalidTTL, http.StatusBadRequest))
+			return
+		}
+		ns.TTL = d
+	}
+
 	claims, err := h.us.Authenticate(username, password)
 	if err != nil {
 		web.RespondError(w, err)
 		return
 	}
 
-	token, err := auth.CreateToken(claims)
+	tk, err := h.ss.Issue(claims, ns)
+	if err != nil {
+		web.RespondError(w, err)
+		return
+	}
+
+	web.Respond(w, tk, http.StatusOK)
+}
+
+func (h *UserHandler) Refresh(w http.ResponseWriter, r *http.Request) {
+	rr := session.RefreshRequest{}
+	if err := web.Decode(r, &rr); err != nil {
+		web.RespondError(w, err)
+		return
+	}
+
+	tk, err := h.ss.Refresh(rr.RefreshToken)
 	if err != nil {
 		web.RespondError(w, err)
 		return
 	}
 
-	web.Respond(w, web.Message("token", token), http.StatusOK)
+	web.Respond(w, tk, http.StatusOK)
+}
+
+// Logout ends the login the request's token belongs to and revokes the
+// token itself.
+func (h *UserHandler) Logout(w http.ResponseWriter, r *http.Request) {
+	claims, _ := auth.ClaimsFromContext(r.Context())
+
+	if err := h.ss.Logout(claims); err != nil {
+		web.RespondError(w, err)
+		return
+	}
+
+	web.Respond(w, nil, http.StatusOK)
+}
+
+func (h *UserHandler) Sessions(w http.ResponseWriter, r *http.Request) {
+	claims, _ := auth.ClaimsFromContext(r.Context())
+
+	ss, err := h.ss.List(claims.UserID, claims.SessionID)
+	if err != nil {
+		web.RespondError(w, err)
+		return
+	}
+
+	web.Respond(w, ss, http.StatusOK)
+}
+
+func (h *UserHandler) RevokeSession(w http.ResponseWriter, r *http.Request) {
+	claims, _ := auth.ClaimsFromContext(r.Context())
+
+	if err := h.ss.Revoke(claims.UserID, mux.Vars(r)["id"]); err != nil {
+		web.RespondError(w, err)
+		return
+	}
+
+	web.Respond(w, nil, http.StatusOK)
 }
@@ -9,7 +9,10 @@ import (
 	"testing"
 
 	"github.com/axwilliams/book-api/cmd/book-api/handlers"
+	"github.com/axwilliams/book-api/internal/business/role"
+	"github.com/axwilliams/book-api/internal/business/session"
 	"github.com/axwilliams/book-api/internal/business/user"
+	"github.com/axwilliams/book-api/internal/platform/auth"
 	"github.com/axwilliams/book-api/internal/test"
 	"github.com/axwilliams/book-api/internal/test/mock"
 	"github.com/dgrijalva/jwt-go"
@@ -21,8 +24,10 @@ var userHandler handlers.UserHandler
 
 func init() {
 	mockUser := mock.NewMockUser()
-	userService := user.NewService(mockUser)
-	userHandler = handlers.NewUserHandler(userService)
+	mockSession := mock.NewMockSession()
+	sessionService := session.NewService(mockSession, mockUser, session.NewRevocationList(mockSession), session.DefaultPolicy)
+	userService := user.NewService(mockUser, sessionService, role.NewRegistry(mock.NewMockRole()))
+	userHandler = handlers.NewUserHandler(userService, sessionService)
 }
 
 func TestAddUser(t *testing.T) {
@@ -379,3 +384,233 @@ func TestToken(t *testing.T) {
 		}
 	}
 }
+
+func TestRefreshToken(t *testing.T) {
+	login := func(query string) (int, map[string]string) {
+		r, err := http.NewRequest("POST", "http://localhost:8080/api/v1/users/token"+query, nil)
+		if err != nil {
+			t.Errorf("\t%s\tRequest failed: %v\n", test.Failed, err)
+		}
+		r.SetBasicAuth("author", "Author#1")
+
+		rr := httptest.NewRecorder()
+		http.HandlerFunc(userHandler.Token).ServeHTTP(rr, r)
+
+		resp := map[string]string{}
+		json.NewDecoder(rr.Body).Decode(&resp)
+		return rr.Code, resp
+	}
+
+	refresh := func(payload string) (int, map[string]string) {
+		r, err := http.NewRequest("POST", "http://localhost:8080/api/v1/users/token/refresh", bytes.NewBufferString(payload))
+		if err != nil {
+			t.Errorf("\t%s\tRequest failed: %v\n", test.Failed, err)
+		}
+
+		rr := httptest.NewRecorder()
+		http.HandlerFunc(userHandler.Refresh).ServeHTTP(rr, r)
+
+		resp := map[string]string{}
+		json.NewDecoder(rr.Body).Decode(&resp)
+		return rr.Code, resp
+	}
+
+	if code, _ := login("?ttl=soon"); code != http.StatusBadRequest {
+		t.Fatalf("\t%s\tInvalid ttl: want %v got %v", test.Failed, http.StatusBadRequest, code)
+	}
+	t.Logf("\t%s\tInvalid ttl rejected", test.Success)
+
+	code, first := login("?device=Kobo+Libra&ttl=24h")
+	if code != http.StatusOK || first["refresh_token"] == "" {
+		t.Fatalf("\t%s\tLogin did not return a refresh token: %v %v", test.Failed, code, first)
+	}
+	t.Logf("\t%s\tRefresh token issued", test.Success)
+
+	samples := []struct {
+		payload    string
+		statusCode int
+		expected   string
+	}{
+		// Missing token
+		{`{}`, http.StatusUnprocessableEntity, ""},
+		// Unknown token
+		{`{"refresh_token":"abc"}`, http.StatusUnauthorized, session.ErrInvalidRefresh.Error()},
+		// Valid token
+		{`{"refresh_token":"` + first["refresh_token"] + `"}`, http.StatusOK, ""},
+		// Reused token
+		{`{"refresh_token":"` + first["refresh_token"] + `"}`, http.StatusUnauthorized, session.ErrRefreshReused.Error()},
+	}
+
+	for _, sample := range samples {
+		code, resp := refresh(sample.payload)
+
+		if sample.statusCode != code {
+			t.Fatalf("\t%s\tWrong status code: want %v got %v", test.Failed, sample.statusCode, code)
+		}
+		t.Logf("\t%s\tStatus code correct: %v", test.Success, code)
+
+		if sample.expected != "" && resp["message"] != sample.expected {
+			t.Fatalf("\t%s\tWrong response: want %v got %v", test.Failed, sample.expected, resp["message"])
+		}
+		if code == http.StatusOK && (resp["token"] == "" || resp["refresh_token"] == first["refresh_token"]) {
+			t.Fatalf("\t%s\tTokens were not rotated: %v", test.Failed, resp)
+		}
+	}
+}
+
+func TestSessions(t *testing.T) {
+	mockUser := mock.NewMockUser()
+	mockSession := mock.NewMockSession()
+	sessionService := session.NewService(mockSession, mockUser, session.NewRevocationList(mockSession), session.DefaultPolicy)
+	h := handlers.NewUserHandler(user.NewService(mockUser, sessionService, role.NewRegistry(mock.NewMockRole())), sessionService)
+
+	login := func(device string) (auth.Claims, string) {
+		tk, err := sessionService.Issue(auth.NewClaims("69a47775-6d89-4d38-ad38-acdb2928f6a1", []string{auth.RoleAuthor}), session.NewSession{Device: device})
+		if err != nil {
+			t.Fatalf("\t%s\tLogin failed: %v", test.Failed, err)
+		}
+		claims, err := auth.ParseWithClaims(tk.Token)
+		if err != nil {
+			t.Fatalf("\t%s\tInvalid access token: %v", test.Failed, err)
+		}
+		return claims, tk.RefreshToken
+	}
+
+	serve := func(hf http.HandlerFunc, method, id string, claims auth.Claims) *httptest.ResponseRecorder {
+		r, err := http.NewRequest(method, "/api/v1/users/me/sessions", nil)
+		if err != nil {
+			t.Errorf("\t%s\tRequest failed: %v\n", test.Failed, err)
+		}
+		r = r.WithContext(auth.ContextWithUser(r.Context(), claims))
+		r = mux.SetURLVars(r, map[string]string{"id": id})
+
+		rr := httptest.NewRecorder()
+		hf.ServeHTTP(rr, r)
+		return rr
+	}
+
+	laptop, refreshToken := login("Laptop")
+	phone, _ := login("Phone")
+
+	rr := serve(h.Sessions, "GET", "", laptop)
+	var list []session.Session
+	if err := json.NewDecoder(rr.Body).Decode(&list); err != nil || rr.Code != http.StatusOK || len(list) != 2 {
+		t.Fatalf("\t%s\tWrong sessions: %v %v %+v", test.Failed, rr.Code, err, list)
+	}
+	if list[0].Current == list[1].Current {
+		t.Fatalf("\t%s\tExactly one session should be current: %+v", test.Failed, list)
+	}
+	t.Logf("\t%s\tSessions listed", test.Success)
+
+	samples := []struct {
+		id         string
+		statusCode int
+	}{
+		// Invalid ID
+		{"phone", http.StatusBadRequest},
+		// Revoked
+		{phone.SessionID, http.StatusOK},
+		// Already revoked
+		{phone.SessionID, http.StatusNotFound},
+	}
+
+	for _, sample := range samples {
+		rr := serve(h.RevokeSession, "DELETE", sample.id, laptop)
+		if sample.statusCode != rr.Code {
+			t.Fatalf("\t%s\tWrong status code: want %v got %v", test.Failed, sample.statusCode, rr.Code)
+		}
+		t.Logf("\t%s\tStatus code correct: %v", test.Success, rr.Code)
+	}
+
+	if rr := serve(h.Logout, "POST", "", laptop); rr.Code != http.StatusOK {
+		t.Fatalf("\t%s\tLogout failed: %v", test.Failed, rr.Code)
+	}
+	if _, err := sessionService.Refresh(refreshToken); err == nil {
+		t.Fatalf("\t%s\tSession refreshed after logout", test.Failed)
+	}
+	t.Logf("\t%s\tLogout ends the session", test.Success)
+
+	_, refreshToken = login("Tablet")
+	uu := bytes.NewBufferString(`{"password": "Author#4"}`)
+	r, _ := http.NewRequest("PATCH", "/api/v1/users", uu)
+	r = mux.SetURLVars(r, map[string]string{"id": "69a47775-6d89-4d38-ad38-acdb2928f6a1"})
+	rr = httptest.NewRecorder()
+	http.HandlerFunc(h.Edit).ServeHTTP(rr, r)
+
+	if _, err := sessionService.Refresh(refreshToken); rr.Code != http.StatusOK || err == nil {
+		t.Fatalf("\t%s\tPassword change left the session valid: %v", test.Failed, rr.Code)
+	}
+	t.Logf("\t%s\tPassword change ends existing sessions", test.Success)
+}
+
+func TestUserRoles(t *testing.T) {
+	mockUser := mock.NewMockUser()
+	mockSession := mock.NewMockSession()
+	sessionService := session.NewService(mockSession, mockUser, session.NewRevocationList(mockSession), session.DefaultPolicy)
+	h := handlers.NewUserHandler(user.NewService(mockUser, sessionService, role.NewRegistry(mock.NewMockRole())), sessionService)
+	admin := auth.Claims{UserID: "a72bec75-0a5f-49af-a844-5763d188788e", Roles: []string{auth.RoleAdmin}}
+
+	serve := func(hf http.HandlerFunc, method, id, name string) *httptest.ResponseRecorder {
+		r, err := http.NewRequest(method, "/api/v1/users/"+id+"/roles/"+name, nil)
+		if err != nil {
+			t.Errorf("\t%s\tRequest failed: %v\n", test.Failed, err)
+		}
+		r = r.WithContext(auth.ContextWithUser(r.Context(), admin))
+		r = mux.SetURLVars(r, map[string]string{"id": id, "role": name})
+
+		rr := httptest.NewRecorder()
+		hf.ServeHTTP(rr, r)
+		return rr
+	}
+
+	const authorID = "69a47775-6d89-4d38-ad38-acdb2928f6a1"
+
+	samples := []struct {
+		name       string
+		hf         http.HandlerFunc
+		id         string
+		role       string
+		statusCode int
+		expected   string
+	}{
+		{"Invalid ID", h.GrantRole, "69a47775", "CURATOR", http.StatusBadRequest, `{"message":"` + user.ErrInvalidID.Error() + `"}`},
+		{"Unknown user", h.GrantRole, "3defcc36-9a52-4274-8b72-47cd2d0b3e5c", "CURATOR", http.StatusNotFound, `{"message":"` + user.ErrNoUserFound.Error() + `"}`},
+		{"Unknown role", h.GrantRole, authorID, "AUTHR", http.StatusUnprocessableEntity, `{"message":"` + user.ErrUnknownRole.Error() + `: \"AUTHR\""}`},
+		{"Grant", h.GrantRole, authorID, "curator", http.StatusOK, `{"roles":["AUTHOR","CURATOR"]}`},
+		{"Grant held role", h.GrantRole, authorID, "CURATOR", http.StatusOK, `{"roles":["AUTHOR","CURATOR"]}`},
+		{"Grant ADMIN", h.GrantRole, authorID, "ADMIN", http.StatusOK, `{"roles":["AUTHOR","CURATOR","ADMIN"]}`},
+		{"Revoke", h.RevokeRole, authorID, "CURATOR", http.StatusOK, `{"roles":["AUTHOR","ADMIN"]}`},
+		{"Revoke last ADMIN", h.RevokeRole, authorID, "ADMIN", http.StatusConflict, `{"message":"` + user.ErrLastAdmin.Error() + `"}`},
+		{"Revoke role not held", h.RevokeRole, authorID, "CURATOR", http.StatusOK, `{"roles":["AUTHOR","ADMIN"]}`},
+	}
+
+	for _, sample := range samples {
+		rr := serve(sample.hf, "PUT", sample.id, sample.role)
+		if sample.statusCode != rr.Code {
+			t.Fatalf("\t%s\t%s: wrong status code: want %v got %v", test.Failed, sample.name, sample.statusCode, rr.Code)
+		}
+		if res := rr.Body.String(); res != sample.expected {
+			t.Fatalf("\t%s\t%s: wrong response: want %v got %v", test.Failed, sample.name, sample.expected, res)
+		}
+		t.Logf("\t%s\t%s", test.Success, sample.name)
+	}
+
+	r, _ := http.NewRequest("PATCH", "/api/v1/users", bytes.NewBufferString(`{"roles": ["AUTHOR"]}`))
+	r = mux.SetURLVars(r, map[string]string{"id": authorID})
+	rr := httptest.NewRecorder()
+	http.HandlerFunc(h.Edit).ServeHTTP(rr, r)
+	if rr.Code != http.StatusConflict {
+		t.Fatalf("\t%s\tReplacing roles took the last ADMIN: %v", test.Failed, rr.Code)
+	}
+	t.Logf("\t%s\tReplacing roles keeps the last ADMIN", test.Success)
+
+	rr = serve(h.RoleHistory, "GET", authorID, "")
+	var cs []user.RoleChange
+	if err := json.NewDecoder(rr.Body).Decode(&cs); err != nil || rr.Code != http.StatusOK || len(cs) != 3 {
+		t.Fatalf("\t%s\tWrong role changes: %v %v %+v", test.Failed, rr.Code, err, cs)
+	}
+	if cs[0].Role != "CURATOR" || cs[0].Action != user.RoleGranted || cs[2].Action != user.RoleRevoked || cs[2].ActorID != admin.UserID {
+		t.Fatalf("\t%s\tWrong role changes: %+v", test.Failed, cs)
+	}
+	t.Logf("\t%s\tRole changes recorded", test.Success)
+}
@@ -7,16 +7,34 @@ import (
 	"net/http"
 	"os"
 	"os/signal"
+	"strconv"
+	"strings"
 	"syscall"
 	"time"
 
 	"github.com/axwilliams/book-api/cmd/book-api/handlers"
+	"github.com/axwilliams/book-api/internal/business/access"
+	"github.com/axwilliams/book-api/internal/business/apikey"
 	"github.com/axwilliams/book-api/internal/business/book"
+	"github.com/axwilliams/book-api/internal/business/citation"
+	"github.com/axwilliams/book-api/internal/business/enrich"
+	"github.com/axwilliams/book-api/internal/business/label"
+	"github.com/axwilliams/book-api/internal/business/library"
+	"github.com/axwilliams/book-api/internal/business/oai"
+	"github.com/axwilliams/book-api/internal/business/oauth"
+	"github.com/axwilliams/book-api/internal/business/oidc"
+	"github.com/axwilliams/book-api/internal/business/opds"
+	"github.com/axwilliams/book-api/internal/business/recommend"
+	"github.com/axwilliams/book-api/internal/business/role"
+	"github.com/axwilliams/book-api/internal/business/series"
+	"github.com/axwilliams/book-api/internal/business/session"
+	"github.com/axwilliams/book-api/internal/business/tag"
 	"github.com/axwilliams/book-api/internal/business/user"
 	"github.com/axwilliams/book-api/internal/middleware"
 	"github.com/axwilliams/book-api/internal/platform/auth"
 	"github.com/axwilliams/book-api/internal/platform/database"
 	"github.com/axwilliams/book-api/internal/platform/database/postgres"
+	"github.com/axwilliams/book-api/internal/platform/policy"
 	"github.com/axwilliams/book-api/internal/platform/web"
 	"github.com/axwilliams/book-api/internal/schema"
 	"github.com/gorilla/mux"
@@ -71,45 +89,292 @@ func run(log *log.Logger) error {
 		return fmt.Errorf("Seeding data: %+v", err)
 	}
 
-	bookRepository := book.NewRepository(db)
-	bookService := book.NewService(bookRepository)
-	bookHandler := handlers.NewBookHandler(bookService)
+	keyManager, err := newKeyManager()
+	if err != nil {
+		return fmt.Errorf("Loading signing keys: %+v", err)
+	}
+	auth.UseKeys(keyManager)
+
+	leeway, err := time.ParseDuration(os.Getenv("JWT_LEEWAY"))
+	if err != nil || leeway < 0 {
+		leeway = 30 * time.Second
+	}
+	auth.Configure(auth.Config{
+		Issuer:   os.Getenv("JWT_ISSUER"),
+		Audience: os.Getenv("JWT_AUDIENCE"),
+		Leeway:   leeway,
+	})
+	keyHandler := handlers.NewKeyHandler(keyManager)
 
 	userRepository := user.NewRepository(db)
-	userService := user.NewService(userRepository)
-	userHandler := handlers.NewUserHandler(userService)
+
+	policyEngine := policy.NewEngine(os.Getenv("POLICY_DIR"))
+	policyEngine.UseAttributes(access.Attributes(userRepository))
+	if _, err := policyEngine.Load(); err != nil {
+		return fmt.Errorf("Loading policies: %+v", err)
+	}
+
+	bookRepository := book.NewRepository(db)
+	bookService := book.NewService(bookRepository, policyEngine)
+
+	metadataProvider, err := newMetadataProvider()
+	if err != nil {
+		return fmt.Errorf("Configuring metadata provider: %+v", err)
+	}
+
+	enrichService := enrich.NewService(bookService, metadataProvider)
+	bookHandler := handlers.NewBookHandler(bookService, enrichService)
+
+	recommendRepository := recommend.NewRepository(db)
+	recommendService := recommend.NewService(recommendRepository, bookRepository)
+	recommendHandler := handlers.NewRecommendHandler(recommendService)
+
+	tagRepository := tag.NewRepository(db)
+	tagService := tag.NewService(tagRepository, bookRepository, policyEngine)
+	tagHandler := handlers.NewTagHandler(tagService)
+
+	citationService := citation.NewService(bookRepository)
+	citationHandler := handlers.NewCitationHandler(citationService)
+
+	opdsService := opds.NewService(bookService)
+	opdsHandler := handlers.NewOPDSHandler(opdsService)
+
+	oaiService := oai.NewService(bookRepository, oai.Config{
+		Name:       os.Getenv("OAI_REPOSITORY_NAME"),
+		Identifier: os.Getenv("OAI_REPOSITORY_ID"),
+		AdminEmail: os.Getenv("OAI_ADMIN_EMAIL"),
+	})
+	oaiHandler := handlers.NewOAIHandler(oaiService)
+
+	seriesRepository := series.NewRepository(db)
+	seriesService := series.NewService(seriesRepository, bookRepository)
+	seriesHandler := handlers.NewSeriesHandler(seriesService)
+
+	libraryRepository := library.NewRepository(db)
+	libraryService := library.NewService(libraryRepository, bookService, bookRepository, tagService, seriesRepository, policyEngine)
+	libraryHandler := handlers.NewLibraryHandler(libraryService)
+
+	unfinished, err := libraryService.FailUnfinished()
+	if err != nil {
+		return fmt.Errorf("Failing unfinished imports: %+v", err)
+	}
+	if unfinished > 0 {
+		log.Printf("[main] Marked %d unfinished imports as failed", unfinished)
+	}
+
+	labelService := label.NewService(bookRepository)
+	labelHandler := handlers.NewLabelHandler(labelService, os.Getenv("PUBLIC_URL"))
+
+	refreshPolicy, err := newRefreshPolicy()
+	if err != nil {
+		return err
+	}
+
+	sessionRepository := session.NewRepository(db)
+	revocations := session.NewRevocationList(sessionRepository)
+	if _, err := revocations.Sync(); err != nil {
+		return fmt.Errorf("Loading revoked tokens: %+v", err)
+	}
+
+	roleRepository := role.NewRepository(db)
+	if err := roleRepository.Seed(role.Defaults(), time.Now().UTC()); err != nil {
+		return fmt.Errorf("Seeding roles: %+v", err)
+	}
+	roleRegistry := role.NewRegistry(roleRepository)
+	if _, err := roleRegistry.Load(); err != nil {
+		return fmt.Errorf("Loading roles: %+v", err)
+	}
+	auth.UsePermissions(roleRegistry)
+	roleHandler := handlers.NewRoleHandler(role.NewService(roleRepository, roleRegistry))
+
+	accessHandler := handlers.NewAccessHandler(access.NewService(policyEngine, userRepository, bookRepository))
+
+	sessionService := session.NewService(sessionRepository, userRepository, revocations, refreshPolicy)
+	oauthService := oauth.NewService(oauth.NewRepository(db), userRepository, revocations)
+	userService := user.NewService(userRepository, user.JoinSessions(sessionService, oauthService), roleRegistry)
+	userHandler := handlers.NewUserHandler(userService, sessionService)
+
+	apiKeyService := apikey.NewService(apikey.NewRepository(db), userRepository)
+	apiKeyHandler := handlers.NewAPIKeyHandler(apiKeyService)
+
+	oauthHandler := handlers.NewOAuthHandler(oauthService, userService)
+
+	oidcConfig, err := newOIDCConfig()
+	if err != nil {
+		return fmt.Errorf("Configuring OpenID Connect: %+v", err)
+	}
+
+	public, _ := strconv.ParseBool(os.Getenv("PUBLIC_CATALOG"))
+	authn := middleware.NewAuthenticator(public)
+	authn.UseRevocations(revocations)
+	authn.UseAPIKeys(apiKeyService)
 
 	mux := mux.NewRouter()
+	mux.HandleFunc("/.well-known/jwks.json", keyHandler.JWKS).Methods("GET")
+
 	api := mux.PathPrefix("/api/v1").Subrouter()
 
-	api.Use(middleware.Authenticate)
+	api.Use(authn.Authenticate)
+	api.Use(middleware.RateLimit(
+		newRateLimiter("ANON_RATE_LIMIT", "ANON_RATE_BURST"),
+		newRateLimiter("USER_RATE_LIMIT", "USER_RATE_BURST"),
+	))
 	api.Use(middleware.Logger)
 
-	api.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+	authn.Route(api.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
 		web.Respond(w, "Books API v1", http.StatusOK)
-	})
+	}), middleware.PolicyPublic)
+
+	authn.Route(api.HandleFunc("/books", bookHandler.FindAll).Methods("GET"), middleware.PolicyPublic)
+	authn.Route(api.HandleFunc("/books/{id}.mrc", bookHandler.MARC).Methods("GET"), middleware.PolicyPublic)
+	authn.Route(api.HandleFunc("/books/{id}.xml", bookHandler.MARCXML).Methods("GET"), middleware.PolicyPublic)
+	api.HandleFunc("/books/export", middleware.RequirePermission(bookHandler.Export, auth.PermBooksExport)).Methods("GET")
+	api.HandleFunc("/books/import", middleware.RequirePermission(bookHandler.Import, auth.PermBooksWrite)).Methods("POST")
+	api.HandleFunc("/books/from-epub", middleware.RequirePermission(bookHandler.FromEPUB, auth.PermBooksWrite)).Methods("POST")
+	authn.Route(api.HandleFunc("/books/{id}", bookHandler.FindById).Methods("GET"), middleware.PolicyPublic)
+	authn.Route(api.HandleFunc("/search/books", bookHandler.Search).Methods("GET"), middleware.PolicyPublic)
+	authn.Route(api.HandleFunc("/books/{id}/similar", recommendHandler.Similar).Methods("GET"), middleware.PolicyPublic)
+	api.HandleFunc("/books", middleware.RequirePermission(bookHandler.Add, auth.PermBooksWrite)).Methods("POST")
+	api.HandleFunc("/books/{id}", middleware.RequirePermission(bookHandler.Edit, auth.PermBooksWrite)).Methods("PATCH")
+	api.HandleFunc("/books/{id}", middleware.RequirePermission(bookHandler.Delete, auth.PermBooksWrite)).Methods("DELETE")
+	api.HandleFunc("/books/{id}/enrich", middleware.RequirePermission(bookHandler.Enrich, auth.PermBooksWrite)).Methods("POST")
+	api.HandleFunc("/books/{id}/submit", middleware.RequirePermission(bookHandler.Submit, auth.PermBooksWrite)).Methods("POST")
+	api.HandleFunc("/books/{id}/approve", middleware.RequirePermission(bookHandler.Approve, auth.PermBooksReview)).Methods("POST")
+	api.HandleFunc("/books/{id}/reject", middleware.RequirePermission(bookHandler.Reject, auth.PermBooksReview)).Methods("POST")
+	authn.Route(api.HandleFunc("/books/{id}/cite", citationHandler.Cite).Methods("GET"), middleware.PolicyPublic)
+	authn.Route(api.HandleFunc("/cite", citationHandler.Bibliography).Methods("POST"), middleware.PolicyPublic)
+	authn.Route(api.HandleFunc("/opds", opdsHandler.Root).Methods("GET"), middleware.PolicyPublic)
+	authn.Route(api.HandleFunc("/opds/categories", opdsHandler.Categories).Methods("GET"), middleware.PolicyPublic)
+	authn.Route(api.HandleFunc("/opds/authors", opdsHandler.Authors).Methods("GET"), middleware.PolicyPublic)
+	authn.Route(api.HandleFunc("/opds/books", opdsHandler.Books).Methods("GET"), middleware.PolicyPublic)
+	authn.Route(api.HandleFunc("/opds/opensearch.xml", opdsHandler.OpenSearch).Methods("GET"), middleware.PolicyPublic)
+	authn.Route(api.HandleFunc("/oai", oaiHandler.Handle).Methods("GET", "POST"), middleware.PolicyPublic)
+	authn.Route(api.HandleFunc("/books/{id}/cover", bookHandler.Cover).Methods("GET"), middleware.PolicyPublic)
+	authn.Route(api.HandleFunc("/books/{id}/barcode.{format:svg|png}", labelHandler.Barcode).Methods("GET"), middleware.PolicyPublic)
+	authn.Route(api.HandleFunc("/books/{id}/qr.{format:svg|png}", labelHandler.QR).Methods("GET"), middleware.PolicyPublic)
+	authn.Route(api.HandleFunc("/books/{id}/attachments", bookHandler.Attachments).Methods("GET"), middleware.PolicyPublic)
+	authn.Route(api.HandleFunc("/books/{id}/attachments/{attachment}", bookHandler.Attachment).Methods("GET"), middleware.PolicyPublic)
+	authn.Route(api.HandleFunc("/books/{id}/relations", bookHandler.Relations).Methods("GET"), middleware.PolicyPublic)
+	api.HandleFunc("/books/{id}/relations", middleware.RequirePermission(bookHandler.Relate, auth.PermBooksCurate)).Methods("POST")
+	api.HandleFunc("/books/{id}/relations/{relation}", middleware.RequirePermission(bookHandler.Unrelate, auth.PermBooksCurate)).Methods("DELETE")
+	api.HandleFunc("/books/{id}/merge", middleware.RequirePermission(bookHandler.Merge, auth.PermBooksCurate)).Methods("POST")
+	api.HandleFunc("/admin/books/duplicates", middleware.RequirePermission(bookHandler.Duplicates, auth.PermBooksCurate)).Methods("GET")
+	api.HandleFunc("/books/{id}/history", middleware.RequirePermission(bookHandler.History, auth.PermBooksHistory)).Methods("GET")
+
+	authn.Route(api.HandleFunc("/books/{id}/tags", tagHandler.FindByBook).Methods("GET"), middleware.PolicyPublic)
+	api.HandleFunc("/books/{id}/tags", middleware.RequirePermission(tagHandler.Add, auth.PermTagsWrite)).Methods("POST")
+	api.HandleFunc("/books/{id}/tags/{tag}", middleware.RequirePermission(tagHandler.Remove, auth.PermTagsWrite)).Methods("DELETE")
+	authn.Route(api.HandleFunc("/tags/popular", tagHandler.Popular).Methods("GET"), middleware.PolicyPublic)
+	api.HandleFunc("/tags/{id}", middleware.RequirePermission(tagHandler.Edit, auth.PermTagsManage)).Methods("PATCH")
+	api.HandleFunc("/tags/{id}/merge", middleware.RequirePermission(tagHandler.Merge, auth.PermTagsManage)).Methods("POST")
+	api.HandleFunc("/tags/{id}/synonyms", middleware.RequirePermission(tagHandler.AddSynonym, auth.PermTagsManage)).Methods("POST")
+
+	authn.Route(api.HandleFunc("/series", seriesHandler.FindAll).Methods("GET"), middleware.PolicyPublic)
+	authn.Route(api.HandleFunc("/series/{id}", seriesHandler.FindById).Methods("GET"), middleware.PolicyPublic)
+	api.HandleFunc("/series", middleware.RequirePermission(seriesHandler.Add, auth.PermBooksWrite)).Methods("POST")
+	api.HandleFunc("/series/{id}", middleware.RequirePermission(seriesHandler.Edit, auth.PermBooksWrite)).Methods("PATCH")
+	api.HandleFunc("/series/{id}", middleware.RequirePermission(seriesHandler.Delete, auth.PermBooksWrite)).Methods("DELETE")
+
+	api.HandleFunc("/labels", middleware.RequirePermission(labelHandler.Sheet, auth.PermLabelsPrint)).Methods("POST")
+	api.HandleFunc("/labels/templates", middleware.RequirePermission(labelHandler.Templates, auth.PermLabelsPrint)).Methods("GET")
+
+	api.HandleFunc("/imports", middleware.RequirePermission(libraryHandler.Import, auth.PermBooksWrite)).Methods("POST")
+	api.HandleFunc("/imports/{id}", middleware.RequirePermission(libraryHandler.Job, auth.PermBooksWrite)).Methods("GET")
+
+	api.HandleFunc("/users", middleware.RequirePermission(userHandler.Add, auth.PermUsersManage)).Methods("POST")
+	api.HandleFunc("/users/{id}", middleware.RequirePermission(userHandler.Edit, auth.PermUsersManage)).Methods("PATCH")
+	api.HandleFunc("/users/{id}", middleware.RequirePermission(userHandler.Delete, auth.PermUsersManage)).Methods("DELETE")
+	api.HandleFunc("/users/{id}/roles/history", middleware.RequirePermission(userHandler.RoleHistory, auth.PermUsersManage)).Methods("GET")
+	api.HandleFunc("/users/{id}/roles/{role}", middleware.RequirePermission(userHandler.GrantRole, auth.PermUsersManage)).Methods("PUT")
+	api.HandleFunc("/users/{id}/roles/{role}", middleware.RequirePermission(userHandler.RevokeRole, auth.PermUsersManage)).Methods("DELETE")
+
+	api.HandleFunc("/permissions", middleware.RequirePermission(roleHandler.Permissions, auth.PermRolesManage)).Methods("GET")
+	api.HandleFunc("/roles", middleware.RequirePermission(roleHandler.FindAll, auth.PermRolesManage)).Methods("GET")
+	api.HandleFunc("/roles", middleware.RequirePermission(roleHandler.Add, auth.PermRolesManage)).Methods("POST")
+	api.HandleFunc("/roles/{name}", middleware.RequirePermission(roleHandler.FindByName, auth.PermRolesManage)).Methods("GET")
+	api.HandleFunc("/roles/{name}", middleware.RequirePermission(roleHandler.Edit, auth.PermRolesManage)).Methods("PATCH")
+	api.HandleFunc("/roles/{name}", middleware.RequirePermission(roleHandler.Delete, auth.PermRolesManage)).Methods("DELETE")
+
+	api.HandleFunc("/policies", middleware.RequirePermission(accessHandler.Policies, auth.PermPolicies)).Methods("GET")
+	api.HandleFunc("/policies/explain", middleware.RequirePermission(accessHandler.Explain, auth.PermPolicies)).Methods("POST")
+
+	api.HandleFunc("/api-keys", middleware.RequirePermission(apiKeyHandler.Add, auth.PermAPIKeysManage)).Methods("POST")
+	api.HandleFunc("/api-keys", middleware.RequirePermission(apiKeyHandler.FindAll, auth.PermAPIKeysManage)).Methods("GET")
+	api.HandleFunc("/api-keys/{id}", middleware.RequirePermission(apiKeyHandler.Delete, auth.PermAPIKeysManage)).Methods("DELETE")
+
+	api.HandleFunc("/oauth/clients", middleware.RequirePermission(oauthHandler.AddClient, auth.PermClientsManage)).Methods("POST")
+	api.HandleFunc("/oauth/clients", middleware.RequirePermission(oauthHandler.FindClients, auth.PermClientsManage)).Methods("GET")
+	api.HandleFunc("/oauth/clients/{id}", middleware.RequirePermission(oauthHandler.DeleteClient, auth.PermClientsManage)).Methods("DELETE")
+	authn.Route(api.HandleFunc("/oauth/authorize", oauthHandler.Authorize).Methods("GET"), middleware.PolicyAnonymous)
+	authn.Route(api.HandleFunc("/oauth/authorize", oauthHandler.Consent).Methods("POST"), middleware.PolicyAnonymous)
+	authn.Route(api.HandleFunc("/oauth/token", oauthHandler.Token).Methods("POST"), middleware.PolicyAnonymous)
+	authn.Route(api.HandleFunc("/oauth/introspect", oauthHandler.Introspect).Methods("POST"), middleware.PolicyAnonymous)
+	authn.Route(api.HandleFunc("/oauth/revoke", oauthHandler.Revoke).Methods("POST"), middleware.PolicyAnonymous)
+
+	authn.Route(api.HandleFunc("/users/token", userHandler.Token).Methods("POST"), middleware.PolicyAnonymous)
+	authn.Route(api.HandleFunc("/users/token/refresh", userHandler.Refresh).Methods("POST"), middleware.PolicyAnonymous)
+	api.HandleFunc("/users/logout", userHandler.Logout).Methods("POST")
+	api.HandleFunc("/users/me/sessions", userHandler.Sessions).Methods("GET")
+	api.HandleFunc("/users/me/sessions/{id}", userHandler.RevokeSession).Methods("DELETE")
+
+	if oidcConfig.Issuer != "" {
+		oidcService := oidc.NewService(oidcConfig, oidc.NewRepository(db), userRepository, userService)
+		oidcHandler := handlers.NewOIDCHandler(oidcService, sessionService, strings.HasPrefix(oidcConfig.RedirectURL, "https://"))
+
+		authn.Route(api.HandleFunc("/oidc/login", oidcHandler.Login).Methods("GET"), middleware.PolicyAnonymous)
+		authn.Route(api.HandleFunc("/oidc/callback", oidcHandler.Callback).Methods("GET"), middleware.PolicyAnonymous)
+		api.HandleFunc("/oidc/link", oidcHandler.Link).Methods("POST")
+	}
+
+	interval, err := time.ParseDuration(os.Getenv("RECOMMEND_INTERVAL"))
+	if err != nil {
+		interval = 5 * time.Minute
+	}
+
+	fullEvery, err := strconv.Atoi(os.Getenv("RECOMMEND_FULL_EVERY"))
+	if err != nil {
+		fullEvery = 12
+	}
+
+	stop := make(chan struct{})
+	defer close(stop)
+
+	go recommend.Run(recommendService, interval, fullEvery, stop, log)
+	go library.Run(libraryService, stop, log)
 
-	api.HandleFunc("/books", bookHandler.FindAll).Methods("GET")
-	api.HandleFunc("/books/{id}", bookHandler.FindById).Methods("GET")
-	api.HandleFunc("/search/books", bookHandler.Search).Methods("GET")
-	api.HandleFunc("/books", middleware.HasRole(bookHandler.Add, auth.RoleAuthor)).Methods("POST")
-	api.HandleFunc("/books/{id}", middleware.HasRole(bookHandler.Edit, auth.RoleAuthor)).Methods("PATCH")
-	api.HandleFunc("/books/{id}", middleware.HasRole(bookHandler.Delete, auth.RoleAuthor)).Methods("DELETE")
+	revokeInterval, err := time.ParseDuration(os.Getenv("REVOCATION_SYNC_INTERVAL"))
+	if err != nil || revokeInterval <= 0 {
+		revokeInterval = 30 * time.Second
+	}
+	go session.Run(revocations, revokeInterval, stop, log)
+	go apikey.Run(apiKeyService, time.Minute, stop, log)
+	go role.Run(roleRegistry, revokeInterval, stop, log)
 
-	api.HandleFunc("/users", middleware.HasRole(userHandler.Add, auth.RoleAdmin)).Methods("POST")
-	api.HandleFunc("/users/{id}", middleware.HasRole(userHandler.Edit, auth.RoleAdmin)).Methods("PATCH")
-	api.HandleFunc("/users/{id}", middleware.HasRole(userHandler.Delete, auth.RoleAdmin)).Methods("DELETE")
+	policyInterval, err := time.ParseDuration(os.Getenv("POLICY_RELOAD_INTERVAL"))
+	if err != nil || policyInterval <= 0 {
+		policyInterval = 10 * time.Second
+	}
+	go reloadPolicies(policyEngine, policyInterval, stop, log)
 
-	api.HandleFunc("/users/token", userHandler.Token).Methods("POST")
+	reload := make(chan os.Signal, 1)
+	signal.Notify(reload, syscall.SIGHUP)
+	go reloadKeys(keyManager, reload, stop, log)
 
 	shutdown := make(chan os.Signal, 1)
 	signal.Notify(shutdown, os.Interrupt, syscall.SIGTERM)
 
+	// CORS wraps the router so that preflight requests and rejected requests
+	// get its headers too.
+	var handler http.Handler = mux
+	if origins := os.Getenv("CORS_ORIGINS"); origins != "" {
+		handler = middleware.CORS(strings.Split(origins, ","))(mux)
+	}
+
 	svrErrs := make(chan error, 1)
 
 	srv := http.Server{
 		Addr:         os.Getenv("SVR_PORT"),
-		Handler:      api,
+		Handler:      handler,
 		WriteTimeout: 10 * time.Second,
 		ReadTimeout:  10 * time.Second,
 	}
@@ -133,7 +398,197 @@ func run(log *log.Logger) error {
 			srv.Close()
 			return fmt.Errorf("Graceful shutdown failed: %+v", err)
 		}
+
+		if _, err := apiKeyService.Flush(); err != nil {
+			log.Printf("[error] Recording API key usage: %+v", err)
+		}
 	}
 
 	return nil
 }
+
+// newRateLimiter reads a requests per second rate and burst size from the
+// environment. An unset or zero rate disables the limit.
+func newRateLimiter(rateKey, burstKey string) *middleware.RateLimiter {
+	rate, err := strconv.ParseFloat(os.Getenv(rateKey), 64)
+	if err != nil || rate <= 0 {
+		return nil
+	}
+
+	burst, err := strconv.Atoi(os.Getenv(burstKey))
+	if err != nil || burst <= 0 {
+		burst = 1
+	}
+
+	return middleware.NewRateLimiter(rate, burst)
+}
+
+// newMetadataProvider picks the provider named by METADATA_PROVIDER, Open
+// Library unless told otherwise, and puts a cache in front of it. "none"
+// disables enrichment.
+func newMetadataProvider() (enrich.MetadataProvider, error) {
+	var p enrich.MetadataProvider
+
+	switch os.Getenv("METADATA_PROVIDER") {
+	case "none":
+		return nil, nil
+	case "fixtures":
+		fp, err := enrich.LoadFixtures(os.Getenv("METADATA_FIXTURES"))
+		if err != nil {
+			return nil, err
+		}
+		p = fp
+	case "", "openlibrary":
+		url := os.Getenv("OPENLIBRARY_URL")
+		if url == "" {
+			url = enrich.DefaultOpenLibraryURL
+		}
+		p = enrich.NewOpenLibrary(url, 5*time.Second)
+	default:
+		return nil, fmt.Errorf("Unknown metadata provider %q", os.Getenv("METADATA_PROVIDER"))
+	}
+
+	ttl, err := time.ParseDuration(os.Getenv("METADATA_CACHE_TTL"))
+	if err != nil || ttl <= 0 {
+		ttl = 24 * time.Hour
+	}
+
+	size, err := strconv.Atoi(os.Getenv("METADATA_CACHE_SIZE"))
+	if err != nil || size <= 0 {
+		size = 1000
+	}
+
+	return enrich.NewCache(p, ttl, size), nil
+}
+
+// newRefreshPolicy reads the refresh token lifetimes, falling back to the
+// defaults for the ones that are not set.
+func newRefreshPolicy() (session.Policy, error) {
+	p := session.DefaultPolicy
+
+	for key, d := range map[string]*time.Duration{
+		"REFRESH_TOKEN_TTL":     &p.TTL,
+		"REFRESH_TOKEN_MAX_AGE": &p.MaxAge,
+	} {
+		v := os.Getenv(key)
+		if v == "" {
+			continue
+		}
+		parsed, err := time.ParseDuration(v)
+		if err != nil || parsed <= 0 {
+			return p, fmt.Errorf("Invalid %s %q", key, v)
+		}
+		*d = parsed
+	}
+
+	return p, nil
+}
+
+// newOIDCConfig reads the identity provider for SSO login. Login is off
+// when OIDC_ISSUER is empty.
+func newOIDCConfig() (oidc.Config, error) {
+	cfg := oidc.Config{
+		Issuer:       os.Getenv("OIDC_ISSUER"),
+		ClientID:     os.Getenv("OIDC_CLIENT_ID"),
+		ClientSecret: os.Getenv("OIDC_CLIENT_SECRET"),
+		RedirectURL:  os.Getenv("OIDC_REDIRECT_URL"),
+		GroupsClaim:  os.Getenv("OIDC_GROUPS_CLAIM"),
+		Leeway:       30 * time.Second,
+	}
+	if cfg.Issuer == "" {
+		return cfg, nil
+	}
+	if cfg.ClientID == "" || cfg.RedirectURL == "" {
+		return cfg, fmt.Errorf("OIDC_CLIENT_ID and OIDC_REDIRECT_URL are required")
+	}
+
+	if scopes := os.Getenv("OIDC_SCOPES"); scopes != "" {
+		cfg.Scopes = strings.Fields(scopes)
+	}
+
+	roles, err := oidc.ParseGroupRoles(os.Getenv("OIDC_GROUP_ROLES"))
+	if err != nil {
+		return cfg, err
+	}
+	cfg.GroupRoles = roles
+
+	return cfg, nil
+}
+
+// newKeyManager loads the token signing keys from the PEM files in
+// JWT_KEYS_DIR and signs with JWT_SIGNING_KEY. Without a key directory
+// tokens are signed with the API_KEY secret as before.
+func newKeyManager() (*auth.KeyManager, error) {
+	dir := os.Getenv("JWT_KEYS_DIR")
+	if dir == "" {
+		return auth.NewHMACKeyManager([]byte(os.Getenv("API_KEY"))), nil
+	}
+
+	algs := auth.DefaultAlgorithms
+	if v := os.Getenv("JWT_ALGORITHMS"); v != "" {
+		algs = nil
+		for _, alg := range strings.Split(v, ",") {
+			algs = append(algs, strings.TrimSpace(alg))
+		}
+	}
+
+	km := auth.NewKeyManager(algs)
+	if err := km.Load(dir, os.Getenv("JWT_SIGNING_KEY")); err != nil {
+		return nil, err
+	}
+
+	return km, nil
+}
+
+// reloadKeys rereads the env file and the key directory on SIGHUP, so that
+// keys can be added, switched and retired without a restart. A reload that
+// fails keeps the current keys.
+func reloadKeys(km *auth.KeyManager, reload <-chan os.Signal, stop <-chan struct{}, log *log.Logger) {
+	for {
+		select {
+		case <-stop:
+			return
+		case <-reload:
+		}
+
+		if err := godotenv.Overload("../../.env"); err != nil {
+			log.Printf("[error] Reloading env file: %+v", err)
+			continue
+		}
+
+		dir := os.Getenv("JWT_KEYS_DIR")
+		if dir == "" {
+			log.Printf("[error] Reloading signing keys: JWT_KEYS_DIR is not set")
+			continue
+		}
+
+		if err := km.Load(dir, os.Getenv("JWT_SIGNING_KEY")); err != nil {
+			log.Printf("[error] Reloading signing keys: %+v", err)
+			continue
+		}
+		log.Printf("[main] Reloaded signing keys, signing with %q", km.SigningKey())
+	}
+}
+
+// reloadPolicies loads the policy files again whenever one of them was
+// added, changed or removed.
+func reloadPolicies(pe *policy.Engine, interval time.Duration, stop <-chan struct{}, log *log.Logger) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+		}
+
+		reloaded, err := pe.Reload()
+		switch {
+		case err != nil:
+			log.Printf("[error] Reloading policies: %+v", err)
+		case reloaded:
+			log.Printf("[main] Reloaded %d policies", len(pe.Policies()))
+		}
+	}
+}
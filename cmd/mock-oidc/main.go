@@ -0,0 +1,45 @@
+// Command mock-oidc serves a mock OpenID provider for trying SSO login
+// locally. It logs in one user, set by flags, without asking.
+//
+//	go run ./cmd/mock-oidc -email jane@example.com -groups library-admins
+package main
+
+import (
+	"flag"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/axwilliams/book-api/internal/test/mock"
+	"github.com/joho/godotenv"
+)
+
+func main() {
+	log := log.New(os.Stdout, "OIDC : ", log.LstdFlags|log.Lmicroseconds|log.Lshortfile)
+
+	addr := flag.String("addr", "localhost:9000", "address to listen on")
+	sub := flag.String("sub", "mock-user-1", "subject of the user")
+	email := flag.String("email", "jane@example.com", "email address of the user")
+	username := flag.String("username", "", "preferred_username of the user")
+	groups := flag.String("groups", "", "comma separated groups of the user")
+	flag.Parse()
+
+	// The client is the one the API is configured with.
+	godotenv.Load("../../.env", ".env")
+
+	p := mock.NewOIDCProvider(os.Getenv("OIDC_CLIENT_ID"), os.Getenv("OIDC_CLIENT_SECRET"))
+	p.SetIssuer("http://" + *addr)
+
+	u := mock.OIDCUser{Subject: *sub, Email: *email, EmailVerified: true, PreferredUsername: *username}
+	if *groups != "" {
+		u.Groups = strings.Split(*groups, ",")
+	}
+	p.SetUser(u)
+
+	log.Printf("[main] Issuer http://%s logs in %s", *addr, *email)
+	if err := http.ListenAndServe(*addr, p); err != nil {
+		log.Println("[error]", err)
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,15 @@
+package access
+
+import (
+	"github.com/axwilliams/book-api/internal/platform/policy"
+)
+
+// Explain asks how the policies would decide a request without making it.
+// The subject is a user, by UserID, or given in full. A book resource given
+// by ID is read from the database; other resources need their attributes.
+type Explain struct {
+	UserID   string          `json:"user_id"`
+	Subject  *policy.Subject `json:"subject"`
+	Action   string          `json:"action" validate:"required"`
+	Resource policy.Resource `json:"resource"`
+}
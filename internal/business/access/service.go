@@ -0,0 +1,148 @@
+package access
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/axwilliams/book-api/internal/business/book"
+	"github.com/axwilliams/book-api/internal/business/user"
+	"github.com/axwilliams/book-api/internal/platform/auth"
+	"github.com/axwilliams/book-api/internal/platform/policy"
+	"github.com/axwilliams/book-api/internal/platform/web"
+	"github.com/google/uuid"
+)
+
+var (
+	ErrInvalidID       = errors.New("ID is not in the correct form")
+	ErrSubject         = errors.New("Give either user_id or subject")
+	ErrUnknownResource = errors.New("resource needs a type, and attributes unless it is a book given by id")
+)
+
+type Service interface {
+	Policies() []policy.Policy
+	Explain(ex Explain) (*policy.Decision, error)
+}
+
+type service struct {
+	pe *policy.Engine
+	ur user.Repository
+	br book.Repository
+}
+
+func NewService(pe *policy.Engine, ur user.Repository, br book.Repository) Service {
+	return &service{
+		pe,
+		ur,
+		br,
+	}
+}
+
+// Attributes loads the attributes of subjects from their user record.
+// Subjects that are not users, such as OAuth clients, have none.
+func Attributes(ur user.Repository) policy.AttributeSource {
+	return func(id string) (map[string]interface{}, error) {
+		if _, err := uuid.Parse(id); err != nil {
+			return map[string]interface{}{}, nil
+		}
+
+		u, err := ur.GetById(id)
+		switch {
+		case err == user.ErrNoUserFound:
+			return map[string]interface{}{}, nil
+		case err != nil:
+			return nil, err
+		}
+
+		return attributes(u), nil
+	}
+}
+
+func attributes(u *user.User) map[string]interface{} {
+	if u.Attributes == nil {
+		return map[string]interface{}{}
+	}
+	return u.Attributes
+}
+
+func (s *service) Policies() []policy.Policy {
+	return s.pe.Policies()
+}
+
+func (s *service) Explain(ex Explain) (*policy.Decision, error) {
+	in := policy.Input{
+		Action:   strings.TrimSpace(ex.Action),
+		Resource: ex.Resource,
+	}
+
+	switch {
+	case ex.UserID != "" && ex.Subject != nil:
+		return nil, web.NewRequestError(ErrSubject, http.StatusUnprocessableEntity)
+	case ex.UserID != "":
+		sub, err := s.subject(ex.UserID)
+		if err != nil {
+			return nil, err
+		}
+		in.Subject = *sub
+	case ex.Subject != nil:
+		in.Subject = *ex.Subject
+		if in.Subject.Permissions == nil {
+			in.Subject.Permissions = auth.PermissionsFor(in.Subject.Roles)
+		}
+	}
+
+	res, err := s.resource(ex.Resource)
+	if err != nil {
+		return nil, err
+	}
+	in.Resource = *res
+
+	return s.pe.Evaluate(in)
+}
+
+func (s *service) subject(id string) (*policy.Subject, error) {
+	if _, err := uuid.Parse(id); err != nil {
+		return nil, web.NewRequestError(ErrInvalidID, http.StatusBadRequest)
+	}
+
+	u, err := s.ur.GetById(id)
+	switch {
+	case err == user.ErrNoUserFound:
+		return nil, web.NewRequestError(user.ErrNoUserFound, http.StatusNotFound)
+	case err != nil:
+		return nil, err
+	}
+
+	return &policy.Subject{
+		ID:          u.ID,
+		Roles:       u.Roles,
+		Permissions: auth.PermissionsFor(u.Roles),
+		Attributes:  attributes(u),
+	}, nil
+}
+
+func (s *service) resource(res policy.Resource) (*policy.Resource, error) {
+	switch {
+	case res.Type == "":
+		return nil, web.NewRequestError(ErrUnknownResource, http.StatusUnprocessableEntity)
+	case res.Attributes != nil:
+		return &res, nil
+	case res.Type != book.ResourceBook || res.ID == "":
+		return nil, web.NewRequestError(ErrUnknownResource, http.StatusUnprocessableEntity)
+	}
+
+	if _, err := uuid.Parse(res.ID); err != nil {
+		return nil, web.NewRequestError(ErrInvalidID, http.StatusBadRequest)
+	}
+
+	bk, err := s.br.GetById(res.ID)
+	switch {
+	case err == book.ErrNoBookFound:
+		return nil, web.NewRequestError(book.ErrNoBookFound, http.StatusNotFound)
+	case err != nil:
+		return nil, err
+	}
+
+	r := bk.Resource()
+	return &r, nil
+}
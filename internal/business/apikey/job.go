@@ -0,0 +1,24 @@
+package apikey
+
+import (
+	"log"
+	"time"
+)
+
+// Run writes API key usage every interval until stop is closed.
+func Run(s Service, interval time.Duration, stop <-chan struct{}, log *log.Logger) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+		}
+
+		if _, err := s.Flush(); err != nil {
+			log.Printf("[error] Recording API key usage: %+v", err)
+		}
+	}
+}
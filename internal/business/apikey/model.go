@@ -0,0 +1,40 @@
+package apikey
+
+import (
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// APIKey lets a machine client, e.g. an import script, act as a user
+// without a password. Only a hash of the key is stored; Prefix is kept in
+// the clear so a key can be recognized in logs and listings.
+type APIKey struct {
+	ID         string         `db:"id" json:"id"`
+	Name       string         `db:"name" json:"name"`
+	Prefix     string         `db:"prefix" json:"prefix"`
+	Hash       []byte         `db:"key_hash" json:"-"`
+	UserID     string         `db:"user_id" json:"user_id"`
+	Scopes     pq.StringArray `db:"scopes" json:"scopes"`
+	CreatedBy  string         `db:"created_by" json:"created_by"`
+	CreatedAt  time.Time      `db:"created_at" json:"created_at"`
+	ExpiresAt  time.Time      `db:"expires_at" json:"expires_at"`
+	LastUsedAt *time.Time     `db:"last_used_at" json:"last_used_at"`
+	UseCount   int64          `db:"use_count" json:"use_count"`
+	RevokedAt  *time.Time     `db:"revoked_at" json:"revoked_at,omitempty"`
+}
+
+// NewAPIKey describes a key to create. UserID defaults to the admin
+// creating it and ExpiresAt to DefaultLifetime from now.
+type NewAPIKey struct {
+	Name      string     `json:"name" validate:"required"`
+	UserID    string     `json:"user_id"`
+	Scopes    []string   `json:"scopes" validate:"required"`
+	ExpiresAt *time.Time `json:"expires_at"`
+}
+
+// Created is the one response that carries the secret key.
+type Created struct {
+	APIKey
+	Key string `json:"key"`
+}
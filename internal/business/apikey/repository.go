@@ -0,0 +1,112 @@
+package apikey
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+)
+
+var ErrNoKeyFound = errors.New("No API key found")
+
+type Repository interface {
+	Create(k *APIKey) error
+	GetAll() ([]APIKey, error)
+	GetByPrefix(prefix string) (*APIKey, error)
+	Revoke(id string, at time.Time) error
+	RecordUsage(id string, at time.Time, count int64) error
+}
+
+type repository struct {
+	db *sql.DB
+}
+
+func NewRepository(db *sql.DB) Repository {
+	return &repository{
+		db,
+	}
+}
+
+const columns = "id, name, prefix, key_hash, user_id, scopes, created_by, created_at, expires_at, last_used_at, use_count, revoked_at"
+
+func scan(row interface{ Scan(...interface{}) error }) (*APIKey, error) {
+	k := &APIKey{}
+	err := row.Scan(&k.ID, &k.Name, &k.Prefix, &k.Hash, &k.UserID, &k.Scopes, &k.CreatedBy,
+		&k.CreatedAt, &k.ExpiresAt, &k.LastUsedAt, &k.UseCount, &k.RevokedAt)
+	return k, err
+}
+
+func (r *repository) Create(k *APIKey) error {
+	_, err := r.db.Exec("INSERT INTO api_key ("+columns+") VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12)",
+		k.ID, k.Name, k.Prefix, k.Hash, k.UserID, k.Scopes, k.CreatedBy, k.CreatedAt, k.ExpiresAt, k.LastUsedAt, k.UseCount, k.RevokedAt)
+	if err != nil {
+		return fmt.Errorf("Creating API key: %w", err)
+	}
+
+	return nil
+}
+
+func (r *repository) GetAll() ([]APIKey, error) {
+	rows, err := r.db.Query("SELECT " + columns + " FROM api_key ORDER BY created_at DESC")
+	if err != nil {
+		return nil, fmt.Errorf("Retrieving API keys: %w", err)
+	}
+	defer rows.Close()
+
+	ks := []APIKey{}
+	for rows.Next() {
+		k, err := scan(rows)
+		if err != nil {
+			return nil, fmt.Errorf("Scanning API key rows: %w", err)
+		}
+		ks = append(ks, *k)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("Iterating API key rows: %w", err)
+	}
+
+	return ks, nil
+}
+
+func (r *repository) GetByPrefix(prefix string) (*APIKey, error) {
+	k, err := scan(r.db.QueryRow("SELECT "+columns+" FROM api_key WHERE prefix = $1", prefix))
+
+	switch {
+	case err == sql.ErrNoRows:
+		return nil, ErrNoKeyFound
+	case err != nil:
+		return nil, fmt.Errorf("Retrieving API key: %w", err)
+	}
+
+	return k, nil
+}
+
+// Revoke returns ErrNoKeyFound when there is no such key or it was already
+// revoked.
+func (r *repository) Revoke(id string, at time.Time) error {
+	res, err := r.db.Exec("UPDATE api_key SET revoked_at = $1 WHERE id = $2 AND revoked_at IS NULL", at, id)
+	if err != nil {
+		return fmt.Errorf("Revoking API key: %w", err)
+	}
+
+	count, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("Counting revoked API keys: %w", err)
+	}
+	if count == 0 {
+		return ErrNoKeyFound
+	}
+
+	return nil
+}
+
+// RecordUsage adds count uses, the last of them at at.
+func (r *repository) RecordUsage(id string, at time.Time, count int64) error {
+	_, err := r.db.Exec(`UPDATE api_key SET use_count = use_count + $1,
+		last_used_at = GREATEST(COALESCE(last_used_at, $2), $2) WHERE id = $3`, count, at, id)
+	if err != nil {
+		return fmt.Errorf("Recording API key usage: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,278 @@
+package apikey
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/axwilliams/book-api/internal/business/user"
+	"github.com/axwilliams/book-api/internal/platform/auth"
+	"github.com/axwilliams/book-api/internal/platform/web"
+	"github.com/google/uuid"
+)
+
+const (
+	// DefaultLifetime is how long a key is valid when no expiry is given.
+	DefaultLifetime = 90 * 24 * time.Hour
+	// MaxLifetime caps the expiry of a key.
+	MaxLifetime = 365 * 24 * time.Hour
+)
+
+// Keys look like bk_<prefix>_<secret>: the prefix identifies the key and the
+// secret is 32 random bytes.
+const (
+	keyTag    = "bk_"
+	prefixLen = 8
+)
+
+var (
+	ErrInvalidID     = errors.New("ID is not in the correct form")
+	ErrInvalidKey    = errors.New("API key is invalid or has been revoked")
+	ErrKeyExpired    = errors.New("API key has expired")
+	ErrUnknownUser   = errors.New("user_id does not belong to a user")
+	ErrInvalidScope  = errors.New("scopes must be roles the key's user holds")
+	ErrInvalidExpiry = errors.New("expires_at must be in the future and within a year")
+)
+
+type Service interface {
+	Create(na NewAPIKey, createdBy string) (*Created, error)
+	FindAll() ([]APIKey, error)
+	Revoke(id string) error
+	Authenticate(raw string) (auth.Claims, error)
+	Flush() (int, error)
+}
+
+// usage counts the uses of a key since the last Flush.
+type usage struct {
+	count int64
+	last  time.Time
+}
+
+type service struct {
+	kr Repository
+	ur user.Repository
+
+	mu    sync.Mutex
+	usage map[string]usage
+}
+
+func NewService(kr Repository, ur user.Repository) Service {
+	return &service{
+		kr:    kr,
+		ur:    ur,
+		usage: map[string]usage{},
+	}
+}
+
+func (s *service) Create(na NewAPIKey, createdBy string) (*Created, error) {
+	userID := strings.TrimSpace(na.UserID)
+	if userID == "" {
+		userID = createdBy
+	}
+	if _, err := uuid.Parse(userID); err != nil {
+		return nil, web.NewRequestError(ErrUnknownUser, http.StatusUnprocessableEntity)
+	}
+
+	u, err := s.ur.GetById(userID)
+	switch {
+	case err == user.ErrNoUserFound:
+		return nil, web.NewRequestError(ErrUnknownUser, http.StatusUnprocessableEntity)
+	case err != nil:
+		return nil, err
+	}
+
+	scopes := []string{}
+	for _, sc := range na.Scopes {
+		sc = strings.ToUpper(strings.TrimSpace(sc))
+		if !auth.HasRole(u.Roles, sc) {
+			return nil, web.NewRequestError(ErrInvalidScope, http.StatusUnprocessableEntity)
+		}
+		if !auth.HasRole(scopes, sc) {
+			scopes = append(scopes, sc)
+		}
+	}
+	if len(scopes) == 0 {
+		return nil, web.NewRequestError(ErrInvalidScope, http.StatusUnprocessableEntity)
+	}
+
+	now := time.Now().UTC()
+	expires := now.Add(DefaultLifetime)
+	if na.ExpiresAt != nil {
+		expires = na.ExpiresAt.UTC()
+		if !expires.After(now) || expires.After(now.Add(MaxLifetime)) {
+			return nil, web.NewRequestError(ErrInvalidExpiry, http.StatusUnprocessableEntity)
+		}
+	}
+
+	raw, prefix, err := newKey()
+	if err != nil {
+		return nil, err
+	}
+
+	k := APIKey{
+		ID:        uuid.New().String(),
+		Name:      strings.TrimSpace(na.Name),
+		Prefix:    prefix,
+		Hash:      hashKey(raw),
+		UserID:    u.ID,
+		Scopes:    scopes,
+		CreatedBy: createdBy,
+		CreatedAt: now,
+		ExpiresAt: expires,
+	}
+
+	if err := s.kr.Create(&k); err != nil {
+		return nil, err
+	}
+
+	return &Created{APIKey: k, Key: raw}, nil
+}
+
+func (s *service) FindAll() ([]APIKey, error) {
+	return s.kr.GetAll()
+}
+
+func (s *service) Revoke(id string) error {
+	if _, err := uuid.Parse(id); err != nil {
+		return web.NewRequestError(ErrInvalidID, http.StatusBadRequest)
+	}
+
+	err := s.kr.Revoke(id, time.Now().UTC())
+	if err == ErrNoKeyFound {
+		return web.NewRequestError(ErrNoKeyFound, http.StatusNotFound)
+	}
+	return err
+}
+
+// Authenticate turns a key into the claims of its user, limited to the
+// key's scopes. Roles the user has lost since the key was created are
+// dropped as well.
+func (s *service) Authenticate(raw string) (auth.Claims, error) {
+	prefix, ok := parseKey(raw)
+	if !ok {
+		return auth.Claims{}, web.NewRequestError(ErrInvalidKey, http.StatusUnauthorized)
+	}
+
+	k, err := s.kr.GetByPrefix(prefix)
+	switch {
+	case err == ErrNoKeyFound:
+		return auth.Claims{}, web.NewRequestError(ErrInvalidKey, http.StatusUnauthorized)
+	case err != nil:
+		return auth.Claims{}, err
+	}
+
+	now := time.Now().UTC()
+
+	switch {
+	case subtle.ConstantTimeCompare(k.Hash, hashKey(raw)) != 1, k.RevokedAt != nil:
+		return auth.Claims{}, web.NewRequestError(ErrInvalidKey, http.StatusUnauthorized)
+	case !now.Before(k.ExpiresAt):
+		return auth.Claims{}, web.NewRequestError(ErrKeyExpired, http.StatusUnauthorized)
+	}
+
+	u, err := s.ur.GetById(k.UserID)
+	switch {
+	case err == user.ErrNoUserFound:
+		return auth.Claims{}, web.NewRequestError(ErrInvalidKey, http.StatusUnauthorized)
+	case err != nil:
+		return auth.Claims{}, err
+	}
+
+	roles := []string{}
+	for _, sc := range k.Scopes {
+		if auth.HasRole(u.Roles, sc) {
+			roles = append(roles, sc)
+		}
+	}
+
+	s.record(k.ID, now)
+
+	claims := auth.Claims{
+		UserID:      u.ID,
+		Roles:       roles,
+		Permissions: auth.PermissionsFor(roles),
+		APIKeyID:    k.ID,
+	}
+	claims.Subject = u.ID
+	claims.ExpiresAt = k.ExpiresAt.Unix()
+
+	return claims, nil
+}
+
+func (s *service) record(id string, at time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	u := s.usage[id]
+	u.count++
+	u.last = at
+	s.usage[id] = u
+}
+
+// Flush writes the uses counted since the last call and returns the number
+// of keys updated. Counts that fail to write are kept for the next call.
+func (s *service) Flush() (int, error) {
+	s.mu.Lock()
+	pending := s.usage
+	s.usage = map[string]usage{}
+	s.mu.Unlock()
+
+	n := 0
+	for id, u := range pending {
+		if err := s.kr.RecordUsage(id, u.last, u.count); err != nil {
+			s.mu.Lock()
+			for id, u := range pending {
+				cur := s.usage[id]
+				cur.count += u.count
+				if u.last.After(cur.last) {
+					cur.last = u.last
+				}
+				s.usage[id] = cur
+			}
+			s.mu.Unlock()
+			return n, err
+		}
+		delete(pending, id)
+		n++
+	}
+
+	return n, nil
+}
+
+// newKey returns a new key and its prefix.
+func newKey() (string, string, error) {
+	p := make([]byte, prefixLen/2)
+	b := make([]byte, 32)
+	if _, err := rand.Read(p); err != nil {
+		return "", "", fmt.Errorf("Generating API key: %w", err)
+	}
+	if _, err := rand.Read(b); err != nil {
+		return "", "", fmt.Errorf("Generating API key: %w", err)
+	}
+
+	prefix := hex.EncodeToString(p)
+	return keyTag + prefix + "_" + base64.RawURLEncoding.EncodeToString(b), prefix, nil
+}
+
+// parseKey returns the prefix of a well-formed key.
+func parseKey(raw string) (string, bool) {
+	if !strings.HasPrefix(raw, keyTag) || len(raw) <= len(keyTag)+prefixLen+1 || raw[len(keyTag)+prefixLen] != '_' {
+		return "", false
+	}
+	return raw[len(keyTag) : len(keyTag)+prefixLen], true
+}
+
+// hashKey needs no salt for the same reason refresh tokens do not: the
+// secret is random and long.
+func hashKey(raw string) []byte {
+	h := sha256.Sum256([]byte(raw))
+	return h[:]
+}
@@ -0,0 +1,135 @@
+package apikey_test
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/axwilliams/book-api/internal/business/apikey"
+	"github.com/axwilliams/book-api/internal/platform/auth"
+	"github.com/axwilliams/book-api/internal/platform/web"
+	"github.com/axwilliams/book-api/internal/test"
+	"github.com/axwilliams/book-api/internal/test/mock"
+)
+
+const (
+	authorID = "69a47775-6d89-4d38-ad38-acdb2928f6a1"
+	adminID  = "a72bec75-0a5f-49af-a844-5763d188788e"
+)
+
+func status(err error) int {
+	if re, ok := err.(*web.RequestError); ok {
+		return re.Status
+	}
+	if err != nil {
+		return http.StatusInternalServerError
+	}
+	return http.StatusOK
+}
+
+func TestCreate(t *testing.T) {
+	ks := apikey.NewService(mock.NewMockAPIKey(), mock.NewMockUser())
+
+	past := time.Now().Add(-time.Hour)
+	far := time.Now().Add(2 * apikey.MaxLifetime)
+
+	samples := []struct {
+		name       string
+		na         apikey.NewAPIKey
+		statusCode int
+	}{
+		{"Unknown user", apikey.NewAPIKey{Name: "import", UserID: "562e1fe0-0dde-4717-a008-cd2a699301d3", Scopes: []string{"AUTHOR"}}, http.StatusUnprocessableEntity},
+		{"Invalid user", apikey.NewAPIKey{Name: "import", UserID: "author", Scopes: []string{"AUTHOR"}}, http.StatusUnprocessableEntity},
+		{"Scope the user lacks", apikey.NewAPIKey{Name: "import", UserID: authorID, Scopes: []string{"ADMIN"}}, http.StatusUnprocessableEntity},
+		{"No scopes", apikey.NewAPIKey{Name: "import", UserID: authorID, Scopes: []string{}}, http.StatusUnprocessableEntity},
+		{"Expired", apikey.NewAPIKey{Name: "import", UserID: authorID, Scopes: []string{"AUTHOR"}, ExpiresAt: &past}, http.StatusUnprocessableEntity},
+		{"Too long", apikey.NewAPIKey{Name: "import", UserID: authorID, Scopes: []string{"AUTHOR"}, ExpiresAt: &far}, http.StatusUnprocessableEntity},
+		{"Created", apikey.NewAPIKey{Name: "import", UserID: authorID, Scopes: []string{"author", "AUTHOR"}}, http.StatusOK},
+	}
+
+	for _, sample := range samples {
+		k, err := ks.Create(sample.na, adminID)
+
+		if got := status(err); got != sample.statusCode {
+			t.Fatalf("\t%s\t%s: want %d got %v", test.Failed, sample.name, sample.statusCode, err)
+		}
+		if err == nil {
+			switch {
+			case !strings.HasPrefix(k.Key, "bk_"+k.Prefix+"_"):
+				t.Fatalf("\t%s\tKey does not start with its prefix: %s %s", test.Failed, k.Key, k.Prefix)
+			case len(k.Scopes) != 1 || k.CreatedBy != adminID:
+				t.Fatalf("\t%s\tWrong key: %+v", test.Failed, k.APIKey)
+			case time.Until(k.ExpiresAt) < apikey.DefaultLifetime-time.Minute:
+				t.Fatalf("\t%s\tWrong default expiry: %v", test.Failed, k.ExpiresAt)
+			}
+		}
+		t.Logf("\t%s\t%s", test.Success, sample.name)
+	}
+
+	ks2, _ := ks.FindAll()
+	if len(ks2) != 1 || string(ks2[0].Hash) == "" {
+		t.Fatalf("\t%s\tKey not stored: %+v", test.Failed, ks2)
+	}
+	t.Logf("\t%s\tOnly the hash is stored", test.Success)
+}
+
+func TestAuthenticate(t *testing.T) {
+	ks := apikey.NewService(mock.NewMockAPIKey(), mock.NewMockUser())
+
+	k, err := ks.Create(apikey.NewAPIKey{Name: "import", Scopes: []string{"AUTHOR"}}, authorID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	claims, err := ks.Authenticate(k.Key)
+	if err != nil || claims.UserID != authorID || claims.APIKeyID != k.ID || !auth.HasRole(claims.Roles, auth.RoleAuthor) {
+		t.Fatalf("\t%s\tWrong claims: %v %+v", test.Failed, err, claims)
+	}
+	t.Logf("\t%s\tKey acts as its user", test.Success)
+
+	samples := []struct {
+		name string
+		key  string
+	}{
+		{"Malformed", "not-a-key"},
+		{"Unknown prefix", "bk_00000000_" + k.Key[12:]},
+		{"Wrong secret", k.Key[:len(k.Key)-4] + "AAAA"},
+	}
+
+	for _, sample := range samples {
+		if _, err := ks.Authenticate(sample.key); status(err) != http.StatusUnauthorized {
+			t.Fatalf("\t%s\t%s: want 401 got %v", test.Failed, sample.name, err)
+		}
+		t.Logf("\t%s\t%s rejected", test.Success, sample.name)
+	}
+
+	ks.Authenticate(k.Key)
+	if n, err := ks.Flush(); err != nil || n != 1 {
+		t.Fatalf("\t%s\tWrong flush: %d %v", test.Failed, n, err)
+	}
+	all, _ := ks.FindAll()
+	if all[0].UseCount != 2 || all[0].LastUsedAt == nil {
+		t.Fatalf("\t%s\tUsage not recorded: %+v", test.Failed, all[0])
+	}
+	t.Logf("\t%s\tUsage recorded", test.Success)
+
+	if err := ks.Revoke(k.ID); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ks.Authenticate(k.Key); status(err) != http.StatusUnauthorized {
+		t.Fatalf("\t%s\tRevoked key accepted: %v", test.Failed, err)
+	}
+	if err := ks.Revoke(k.ID); status(err) != http.StatusNotFound {
+		t.Fatalf("\t%s\tRevoking twice: want 404 got %v", test.Failed, err)
+	}
+	t.Logf("\t%s\tRevoked key rejected", test.Success)
+
+	soon := time.Now().Add(20 * time.Millisecond)
+	k, _ = ks.Create(apikey.NewAPIKey{Name: "cron", Scopes: []string{"AUTHOR"}, ExpiresAt: &soon}, authorID)
+	time.Sleep(30 * time.Millisecond)
+	if _, err := ks.Authenticate(k.Key); err == nil || err.(*web.RequestError).Err != apikey.ErrKeyExpired {
+		t.Fatalf("\t%s\tExpired key accepted: %v", test.Failed, err)
+	}
+	t.Logf("\t%s\tExpired key rejected", test.Success)
+}
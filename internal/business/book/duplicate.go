@@ -0,0 +1,239 @@
+package book
+
+import (
+	"sort"
+	"strings"
+	"unicode"
+)
+
+const (
+	ReasonISBN   = "isbn"
+	ReasonTitle  = "title"
+	ReasonAuthor = "author"
+)
+
+const (
+	weightTitle  = 0.6
+	weightAuthor = 0.4
+)
+
+// Duplicate is a pair of books that probably describe the same edition.
+type Duplicate struct {
+	BookID      string   `json:"book_id"`
+	DuplicateID string   `json:"duplicate_id"`
+	Score       float64  `json:"score"`
+	Reasons     []string `json:"reasons"`
+}
+
+// NormalizeISBN strips separators and converts ISBN-10 to ISBN-13, so that
+// both forms of the same number compare equal. Anything that is not a valid
+// ISBN is returned empty.
+func NormalizeISBN(isbn string) string {
+	digits := make([]byte, 0, 13)
+	for _, c := range strings.ToUpper(isbn) {
+		switch {
+		case c >= '0' && c <= '9':
+			digits = append(digits, byte(c))
+		case c == 'X' && len(digits) == 9:
+			digits = append(digits, byte(c))
+		}
+	}
+
+	switch len(digits) {
+	case 10:
+		if !validISBN10(digits) {
+			return ""
+		}
+		isbn13 := append([]byte("978"), digits[:9]...)
+		return string(append(isbn13, isbn13Check(isbn13)))
+	case 13:
+		if isbn13Check(digits[:12]) != digits[12] {
+			return ""
+		}
+		return string(digits)
+	}
+
+	return ""
+}
+
+// isbnForms lists the separator-free spellings of an ISBN as it may be stored:
+// the ISBN-13 and, for 978 numbers, the ISBN-10 it was converted from.
+func isbnForms(isbn string) []string {
+	isbn13 := NormalizeISBN(isbn)
+	if isbn13 == "" {
+		return nil
+	}
+
+	forms := []string{isbn13}
+	if strings.HasPrefix(isbn13, "978") {
+		digits := []byte(isbn13[3:12])
+		sum := 0
+		for i, c := range digits {
+			sum += int(c-'0') * (10 - i)
+		}
+		check := byte('0' + (11-sum%11)%11)
+		if check == '0'+10 {
+			check = 'X'
+		}
+		forms = append(forms, string(append(digits, check)))
+	}
+
+	return forms
+}
+
+func validISBN10(digits []byte) bool {
+	sum := 0
+	for i, c := range digits {
+		v := int(c - '0')
+		if c == 'X' {
+			v = 10
+		}
+		sum += v * (10 - i)
+	}
+	return sum%11 == 0
+}
+
+func isbn13Check(digits []byte) byte {
+	sum := 0
+	for i, c := range digits {
+		v := int(c - '0')
+		if i%2 == 1 {
+			v *= 3
+		}
+		sum += v
+	}
+	return byte('0' + (10-sum%10)%10)
+}
+
+// words lowercases s and splits it on anything that is not a letter or a
+// digit, so punctuation and spacing differences disappear.
+func words(s string) []string {
+	return strings.FieldsFunc(strings.ToLower(s), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsNumber(r)
+	})
+}
+
+// bigrams returns the character bigrams of the normalized words of s.
+func bigrams(s string) map[string]int {
+	joined := []rune(strings.Join(words(s), " "))
+
+	bg := make(map[string]int, len(joined))
+	for i := 0; i+1 < len(joined); i++ {
+		bg[string(joined[i:i+2])]++
+	}
+	return bg
+}
+
+// Similarity is the Dice coefficient of the character bigrams of a and b,
+// from 0 for nothing in common to 1 for the same normalized text.
+func Similarity(a, b string) float64 {
+	ba, bb := bigrams(a), bigrams(b)
+	if len(ba) == 0 || len(bb) == 0 {
+		return 0
+	}
+
+	total, shared := 0, 0
+	for g, n := range ba {
+		total += n
+		if m := bb[g]; m > 0 {
+			if m < n {
+				shared += m
+			} else {
+				shared += n
+			}
+		}
+	}
+	for _, n := range bb {
+		total += n
+	}
+
+	return 2 * float64(shared) / float64(total)
+}
+
+// authorSimilarity ignores the order of name parts, so "Kafka, Franz" and
+// "Franz Kafka" match.
+func authorSimilarity(a, b string) float64 {
+	wa, wb := words(a), words(b)
+	sort.Strings(wa)
+	sort.Strings(wb)
+	return Similarity(strings.Join(wa, " "), strings.Join(wb, " "))
+}
+
+// titleArticles are skipped at the start of a title by titleKey.
+var titleArticles = map[string]bool{"the": true, "a": true, "an": true}
+
+// titleKey is the first normalized word of a title after any leading
+// article. Books with different keys are not compared by title.
+func titleKey(title string) string {
+	for _, w := range words(title) {
+		if !titleArticles[w] {
+			return w
+		}
+	}
+	return ""
+}
+
+// FindDuplicates keeps the pairs of books scoring at or above minScore,
+// best first. Books with the same normalized ISBN always score 1. Other
+// pairs are only scored when their titles share a titleKey, so the work
+// grows with the size of those blocks rather than with every pair.
+func FindDuplicates(bks []Book, minScore float64) []Duplicate {
+	dups := []Duplicate{}
+	seen := map[[2]int]bool{}
+
+	add := func(i, j int, score float64, reasons []string) {
+		if i > j {
+			i, j = j, i
+		}
+		key := [2]int{i, j}
+		if seen[key] || score < minScore {
+			return
+		}
+		seen[key] = true
+		dups = append(dups, Duplicate{
+			BookID:      bks[i].ID,
+			DuplicateID: bks[j].ID,
+			Score:       score,
+			Reasons:     reasons,
+		})
+	}
+
+	byISBN := map[string][]int{}
+	byTitle := map[string][]int{}
+
+	for i, bk := range bks {
+		if isbn := NormalizeISBN(bk.ISBN); isbn != "" {
+			for _, j := range byISBN[isbn] {
+				add(j, i, 1, []string{ReasonISBN})
+			}
+			byISBN[isbn] = append(byISBN[isbn], i)
+		}
+
+		key := titleKey(bk.Title)
+		if key == "" {
+			continue
+		}
+
+		for _, j := range byTitle[key] {
+			title := Similarity(bk.Title, bks[j].Title)
+			author := authorSimilarity(bk.Author, bks[j].Author)
+
+			reasons := []string{}
+			if title >= minScore {
+				reasons = append(reasons, ReasonTitle)
+			}
+			if author >= minScore {
+				reasons = append(reasons, ReasonAuthor)
+			}
+
+			add(j, i, weightTitle*title+weightAuthor*author, reasons)
+		}
+		byTitle[key] = append(byTitle[key], i)
+	}
+
+	sort.SliceStable(dups, func(i, j int) bool {
+		return dups[i].Score > dups[j].Score
+	})
+
+	return dups
+}
@@ -0,0 +1,56 @@
+package book_test
+
+import (
+	"testing"
+
+	"github.com/axwilliams/book-api/internal/business/book"
+	"github.com/axwilliams/book-api/internal/test"
+)
+
+func TestNormalizeISBN(t *testing.T) {
+	samples := []struct {
+		isbn     string
+		expected string
+	}{
+		{"978-0-241-37257-9", "9780241372579"},
+		{"0-306-40615-2", "9780306406157"},
+		{"080442957X", "9780804429573"},
+		{"978-0241372578", ""},
+		{"0-306-40615-3", ""},
+		{"not an isbn", ""},
+	}
+
+	for _, sample := range samples {
+		if res := book.NormalizeISBN(sample.isbn); res != sample.expected {
+			t.Fatalf("\t%s\tWrong ISBN for %s: want %v got %v", test.Failed, sample.isbn, sample.expected, res)
+		}
+		t.Logf("\t%s\tNormalized %s", test.Success, sample.isbn)
+	}
+}
+
+func TestFindDuplicates(t *testing.T) {
+	bks := []book.Book{
+		{ID: "1", ISBN: "978-0306406157", Title: "Some Title", Author: "Some Author"},
+		{ID: "2", ISBN: "0306406152", Title: "Another Title", Author: "Another Author"},
+		{ID: "3", ISBN: "978-0241372579", Title: "The Castle", Author: "Franz Kafka"},
+		{ID: "4", ISBN: "", Title: "The castle.", Author: "Kafka, Franz"},
+		{ID: "5", ISBN: "", Title: "The Trial", Author: "Franz Kafka"},
+		{ID: "6", ISBN: "", Title: "Fahrenheit 451", Author: "Ray Bradbury"},
+	}
+
+	dups := book.FindDuplicates(bks, book.DefaultDuplicateScore)
+
+	if len(dups) != 2 {
+		t.Fatalf("\t%s\tWrong number of duplicates: want 2 got %+v", test.Failed, dups)
+	}
+
+	if dups[0].BookID != "1" || dups[0].DuplicateID != "2" || dups[0].Score != 1 || dups[0].Reasons[0] != book.ReasonISBN {
+		t.Fatalf("\t%s\tISBN-10 and ISBN-13 not matched: got %+v", test.Failed, dups[0])
+	}
+	t.Logf("\t%s\tSame ISBN in both forms matched", test.Success)
+
+	if dups[1].BookID != "3" || dups[1].DuplicateID != "4" || len(dups[1].Reasons) != 2 {
+		t.Fatalf("\t%s\tSimilar title and author not matched: got %+v", test.Failed, dups[1])
+	}
+	t.Logf("\t%s\tSimilar title and author matched", test.Success)
+}
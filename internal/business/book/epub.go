@@ -0,0 +1,93 @@
+package book
+
+import (
+	"html"
+	"regexp"
+	"strings"
+
+	"github.com/axwilliams/book-api/internal/platform/epub"
+)
+
+// EPUBImport is what an EPUB says about itself. Book is ready to be sent to
+// POST /books as it is, or after corrections; the rest of the metadata has
+// no place on a book yet and is only shown for reference.
+type EPUBImport struct {
+	Book        NewBook  `json:"book"`
+	Languages   []string `json:"languages,omitempty"`
+	Subjects    []string `json:"subjects,omitempty"`
+	Identifiers []string `json:"identifiers,omitempty"`
+	Cover       bool     `json:"cover"`
+	Created     *Book    `json:"created,omitempty"`
+}
+
+var (
+	blockMarkup = regexp.MustCompile(`(?i)</?(p|br|div|li|ul|ol|h[1-6])\b[^>]*>`)
+	markup      = regexp.MustCompile(`<[^>]*>`)
+)
+
+// PlainText flattens the HTML that EPUB and Calibre descriptions often
+// carry. Block elements separate words; inline elements such as <em> just
+// disappear.
+func PlainText(s string) string {
+	s = markup.ReplaceAllString(blockMarkup.ReplaceAllString(s, " "), "")
+	return strings.Join(strings.Fields(html.UnescapeString(s)), " ")
+}
+
+func trimISBNURN(s string) string {
+	if len(s) > len("urn:isbn:") && strings.EqualFold(s[:len("urn:isbn:")], "urn:isbn:") {
+		return s[len("urn:isbn:"):]
+	}
+	return s
+}
+
+// isbnFromEPUB prefers identifiers declared as ISBNs, then any identifier
+// that holds a valid ISBN, such as a urn:isbn: URN.
+func isbnFromEPUB(ids []epub.Identifier) string {
+	for _, id := range ids {
+		if strings.EqualFold(id.Scheme, "isbn") || strings.EqualFold(id.Scheme, "15") {
+			return trimISBNURN(id.Value)
+		}
+	}
+
+	for _, id := range ids {
+		v := trimISBNURN(id.Value)
+		if NormalizeISBN(v) != "" {
+			return v
+		}
+	}
+
+	return ""
+}
+
+// FromEPUB maps the package metadata onto a new book. Authors are joined
+// with semicolons, and the first subject becomes the category.
+func FromEPUB(p *epub.Package) *EPUBImport {
+	imp := &EPUBImport{
+		Languages: p.Languages,
+		Subjects:  p.Subjects,
+		Cover:     p.Cover != nil && coverTypes[p.Cover.MediaType],
+	}
+
+	if len(p.Titles) > 0 {
+		imp.Book.Title = p.Titles[0]
+	}
+
+	authors := []string{}
+	for _, a := range p.Authors() {
+		authors = append(authors, a.Name)
+	}
+	imp.Book.Author = strings.Join(authors, "; ")
+
+	if len(p.Subjects) > 0 {
+		imp.Book.Category = p.Subjects[0]
+	}
+
+	imp.Book.Description = PlainText(p.Description)
+	imp.Book.ISBN = isbnFromEPUB(p.Identifiers)
+
+	for _, id := range p.Identifiers {
+		imp.Identifiers = append(imp.Identifiers, id.Value)
+	}
+
+	return imp
+}
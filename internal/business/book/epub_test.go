@@ -0,0 +1,95 @@
+package book_test
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/axwilliams/book-api/internal/business/book"
+	"github.com/axwilliams/book-api/internal/platform/epub"
+	"github.com/axwilliams/book-api/internal/test"
+)
+
+func TestFromEPUB(t *testing.T) {
+	samples := []struct {
+		name     string
+		pkg      *epub.Package
+		expected *book.EPUBImport
+	}{
+		{
+			name: "Declared ISBN",
+			pkg: &epub.Package{
+				Titles: []string{"Six Easy Pieces", "Essentials of Physics"},
+				Creators: []epub.Creator{
+					{Name: "Richard P. Feynman", Role: "aut"},
+					{Name: "Robert B. Leighton"},
+					{Name: "Paul Davies", Role: "aui"},
+				},
+				Identifiers: []epub.Identifier{
+					{Value: "urn:uuid:0f1e2d3c-4b5a-6978-8796-a5b4c3d2e1f0"},
+					{Scheme: "ISBN", Value: "978-0465025275"},
+				},
+				Languages:   []string{"en"},
+				Subjects:    []string{"Science", "Physics"},
+				Description: "<p>Six chapters &amp; <em>more</em>.</p><p>Read by</p>",
+				Cover:       &epub.Resource{Href: "cover.jpg", MediaType: "image/jpeg"},
+			},
+			expected: &book.EPUBImport{
+				Book: book.NewBook{
+					ISBN:        "978-0465025275",
+					Title:       "Six Easy Pieces",
+					Author:      "Richard P. Feynman; Robert B. Leighton",
+					Category:    "Science",
+					Description: "Six chapters & more. Read by",
+				},
+				Languages:   []string{"en"},
+				Subjects:    []string{"Science", "Physics"},
+				Identifiers: []string{"urn:uuid:0f1e2d3c-4b5a-6978-8796-a5b4c3d2e1f0", "978-0465025275"},
+				Cover:       true,
+			},
+		},
+		{
+			name: "ISBN URN",
+			pkg: &epub.Package{
+				Titles:      []string{"Fahrenheit 451"},
+				Creators:    []epub.Creator{{Name: "Ray Bradbury"}},
+				Identifiers: []epub.Identifier{{Value: "calibre:42"}, {Value: "urn:isbn:9781451673319"}},
+			},
+			expected: &book.EPUBImport{
+				Book: book.NewBook{
+					ISBN:   "9781451673319",
+					Title:  "Fahrenheit 451",
+					Author: "Ray Bradbury",
+				},
+				Identifiers: []string{"calibre:42", "urn:isbn:9781451673319"},
+			},
+		},
+		{
+			name: "SVG cover",
+			pkg: &epub.Package{
+				Titles: []string{"The Trial"},
+				Cover:  &epub.Resource{Href: "cover.svg", MediaType: "image/svg+xml"},
+			},
+			expected: &book.EPUBImport{
+				Book: book.NewBook{Title: "The Trial"},
+			},
+		},
+		{
+			name: "No ISBN",
+			pkg: &epub.Package{
+				Titles:      []string{"The Castle"},
+				Identifiers: []epub.Identifier{{Value: "urn:uuid:0f1e2d3c-4b5a-6978-8796-a5b4c3d2e1f0"}},
+			},
+			expected: &book.EPUBImport{
+				Book:        book.NewBook{Title: "The Castle"},
+				Identifiers: []string{"urn:uuid:0f1e2d3c-4b5a-6978-8796-a5b4c3d2e1f0"},
+			},
+		},
+	}
+
+	for _, sample := range samples {
+		if res := book.FromEPUB(sample.pkg); !reflect.DeepEqual(res, sample.expected) {
+			t.Fatalf("\t%s\tWrong mapping for %s: want %+v got %+v", test.Failed, sample.name, sample.expected, res)
+		}
+		t.Logf("\t%s\t%s mapped to a book", test.Success, sample.name)
+	}
+}
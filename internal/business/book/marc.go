@@ -0,0 +1,148 @@
+package book
+
+import (
+	"strings"
+
+	"github.com/axwilliams/book-api/internal/platform/marc"
+)
+
+// MARC fields mapped onto a book. Everything else in an imported record is
+// kept as it was and written back on export.
+const (
+	tagControlNumber = "001"
+	tagISBN          = "020"
+	tagAuthor        = "100"
+	tagTitle         = "245"
+	tagSubject       = "650"
+)
+
+type ImportError struct {
+	Record  int    `json:"record"`
+	Message string `json:"message"`
+}
+
+type ImportReport struct {
+	Imported []string      `json:"imported"`
+	Failed   []ImportError `json:"failed"`
+}
+
+// trimISBD drops the trailing punctuation cataloguers put between subfields.
+func trimISBD(s string) string {
+	return strings.TrimSpace(strings.TrimRight(strings.TrimSpace(s), " /:;=,."))
+}
+
+// isbnFrom drops qualifiers such as "(pbk.)" from 020 $a.
+func isbnFrom(f *marc.Field) string {
+	if f == nil {
+		return ""
+	}
+
+	parts := strings.Fields(f.Subfield("a"))
+	if len(parts) == 0 {
+		return ""
+	}
+	return parts[0]
+}
+
+// authorFrom turns a surname-first heading such as "Kafka, Franz," into
+// "Franz Kafka".
+func authorFrom(f *marc.Field) string {
+	if f == nil {
+		return ""
+	}
+
+	name := trimISBD(f.Subfield("a"))
+	if f.Ind1 == "1" {
+		if i := strings.Index(name, ", "); i > 0 {
+			name = name[i+2:] + " " + name[:i]
+		}
+	}
+	return name
+}
+
+func titleFrom(f *marc.Field) string {
+	if f == nil {
+		return ""
+	}
+
+	title := trimISBD(f.Subfield("a"))
+	if sub := trimISBD(f.Subfield("b")); sub != "" {
+		title += ": " + sub
+	}
+	return title
+}
+
+func categoryFrom(f *marc.Field) string {
+	if f == nil {
+		return ""
+	}
+	return trimISBD(f.Subfield("a"))
+}
+
+// FromMARC maps 020 $a, 100 $a, 245 $a $b and the first 650 $a of rec to a
+// new book.
+func FromMARC(rec *marc.Record) *NewBook {
+	return &NewBook{
+		ISBN:     isbnFrom(rec.Field(tagISBN)),
+		Title:    titleFrom(rec.Field(tagTitle)),
+		Author:   authorFrom(rec.Field(tagAuthor)),
+		Category: categoryFrom(rec.Field(tagSubject)),
+	}
+}
+
+// ToMARC builds the record for bk on top of the raw record it was imported
+// from, if any. Mapped fields are only rewritten when the book no longer
+// matches them, so untouched records export exactly as they came in.
+func ToMARC(bk *Book, raw *marc.Record) *marc.Record {
+	rec := marc.NewRecord()
+	if raw != nil {
+		rec.Leader = raw.Leader
+		rec.Fields = append(rec.Fields, raw.Fields...)
+	}
+
+	if rec.Field(tagControlNumber) == nil {
+		rec.Add(marc.Field{Tag: tagControlNumber, Value: bk.ID})
+	}
+
+	if isbnFrom(rec.Field(tagISBN)) != bk.ISBN {
+		replaceField(rec, marc.Field{Tag: tagISBN, Ind1: " ", Ind2: " ",
+			Subfields: []marc.Subfield{{Code: "a", Value: bk.ISBN}}})
+	}
+
+	if authorFrom(rec.Field(tagAuthor)) != bk.Author {
+		ind1, name := "0", bk.Author
+		if i := strings.LastIndex(name, " "); i > 0 {
+			ind1, name = "1", name[i+1:]+", "+name[:i]
+		}
+		replaceField(rec, marc.Field{Tag: tagAuthor, Ind1: ind1, Ind2: " ",
+			Subfields: []marc.Subfield{{Code: "a", Value: name}}})
+	}
+
+	if titleFrom(rec.Field(tagTitle)) != bk.Title {
+		replaceField(rec, marc.Field{Tag: tagTitle, Ind1: "1", Ind2: "0",
+			Subfields: []marc.Subfield{{Code: "a", Value: bk.Title}}})
+	}
+
+	if categoryFrom(rec.Field(tagSubject)) != bk.Category {
+		if bk.Category == "" {
+			rec.Remove(tagSubject)
+		} else {
+			replaceField(rec, marc.Field{Tag: tagSubject, Ind1: " ", Ind2: "4",
+				Subfields: []marc.Subfield{{Code: "a", Value: bk.Category}}})
+		}
+	}
+
+	return rec
+}
+
+// replaceField swaps the first field with f's tag for f, or adds f.
+func replaceField(rec *marc.Record, f marc.Field) {
+	if old := rec.Field(f.Tag); old != nil {
+		*old = f
+		return
+	}
+	if len(f.Subfields) > 0 && f.Subfields[0].Value == "" {
+		return
+	}
+	rec.Add(f)
+}
@@ -0,0 +1,76 @@
+package book_test
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/axwilliams/book-api/internal/business/book"
+	"github.com/axwilliams/book-api/internal/platform/marc"
+	"github.com/axwilliams/book-api/internal/test"
+)
+
+func sampleRecord() *marc.Record {
+	rec := marc.NewRecord()
+	rec.Fields = []marc.Field{
+		{Tag: "001", Value: "12345678"},
+		{Tag: "020", Ind1: " ", Ind2: " ", Subfields: []marc.Subfield{{Code: "a", Value: "9780805211061 (pbk.)"}}},
+		{Tag: "100", Ind1: "1", Ind2: " ", Subfields: []marc.Subfield{{Code: "a", Value: "Kafka, Franz,"}, {Code: "d", Value: "1883-1924."}}},
+		{Tag: "245", Ind1: "1", Ind2: "4", Subfields: []marc.Subfield{
+			{Code: "a", Value: "The castle :"},
+			{Code: "b", Value: "a new translation based on the restored text /"},
+			{Code: "c", Value: "Franz Kafka ; translated by Mark Harman."},
+		}},
+		{Tag: "260", Ind1: " ", Ind2: " ", Subfields: []marc.Subfield{{Code: "b", Value: "Schocken Books,"}}},
+		{Tag: "650", Ind1: " ", Ind2: "0", Subfields: []marc.Subfield{{Code: "a", Value: "Fiction."}}},
+	}
+	return rec
+}
+
+func TestFromMARC(t *testing.T) {
+	nb := book.FromMARC(sampleRecord())
+
+	expected := &book.NewBook{
+		ISBN:     "9780805211061",
+		Title:    "The castle: a new translation based on the restored text",
+		Author:   "Franz Kafka",
+		Category: "Fiction",
+	}
+
+	if !reflect.DeepEqual(nb, expected) {
+		t.Fatalf("\t%s\tWrong mapping: want %+v got %+v", test.Failed, expected, nb)
+	}
+	t.Logf("\t%s\tRecord mapped to a book", test.Success)
+}
+
+func TestToMARC(t *testing.T) {
+	raw := sampleRecord()
+	nb := book.FromMARC(raw)
+
+	bk := &book.Book{ID: "f4ac7e14-fc8e-4096-b956-34e5a33040f2", ISBN: nb.ISBN, Title: nb.Title, Author: nb.Author, Category: nb.Category}
+
+	if rec := book.ToMARC(bk, raw); !reflect.DeepEqual(rec, sampleRecord()) {
+		t.Fatalf("\t%s\tUnchanged book altered its record: %+v", test.Failed, rec)
+	}
+	t.Logf("\t%s\tUnchanged book exports its raw record", test.Success)
+
+	bk.Title = "The Castle"
+	rec := book.ToMARC(bk, raw)
+
+	if f := rec.Field("245"); f == nil || f.Subfield("a") != "The Castle" || f.Subfield("c") != "" {
+		t.Fatalf("\t%s\tEdited title not exported: got %+v", test.Failed, f)
+	}
+
+	if f := rec.Field("100"); f == nil || f.Subfield("d") != "1883-1924." {
+		t.Fatalf("\t%s\tUnchanged author heading lost: got %+v", test.Failed, f)
+	}
+
+	if f := rec.Field("260"); f == nil || f.Subfield("b") != "Schocken Books," {
+		t.Fatalf("\t%s\tUnmapped field lost: got %+v", test.Failed, f)
+	}
+	t.Logf("\t%s\tEdited fields replaced, others kept", test.Success)
+
+	if f := raw.Field("245"); f.Subfield("a") != "The castle :" {
+		t.Fatalf("\t%s\tRaw record modified: got %+v", test.Failed, f)
+	}
+	t.Logf("\t%s\tRaw record left alone", test.Success)
+}
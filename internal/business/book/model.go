@@ -1,23 +1,274 @@
 package book
 
+import (
+	"time"
+
+	"github.com/axwilliams/book-api/internal/platform/policy"
+)
+
+const (
+	StatusDraft     = "draft"
+	StatusInReview  = "in_review"
+	StatusPublished = "published"
+	StatusRejected  = "rejected"
+)
+
+const (
+	RelationSequelOf         = "sequel_of"
+	RelationPrequelOf        = "prequel_of"
+	RelationTranslationOf    = "translation_of"
+	RelationTranslatedAs     = "translated_as"
+	RelationAdaptationOf     = "adaptation_of"
+	RelationAdaptedAs        = "adapted_as"
+	RelationRevisedEditionOf = "revised_edition_of"
+	RelationRevisedAs        = "revised_as"
+	RelationCompanionTo      = "companion_to"
+)
+
+// relationInverses declares the inverse of every stored relation type. Only
+// these types are stored; their inverses are derived when reading from the
+// other side. A type that is its own inverse is symmetric.
+var relationInverses = map[string]string{
+	RelationSequelOf:         RelationPrequelOf,
+	RelationTranslationOf:    RelationTranslatedAs,
+	RelationAdaptationOf:     RelationAdaptedAs,
+	RelationRevisedEditionOf: RelationRevisedAs,
+	RelationCompanionTo:      RelationCompanionTo,
+}
+
+const (
+	ActionCreate  = "create"
+	ActionSubmit  = "submit"
+	ActionApprove = "approve"
+	ActionReject  = "reject"
+	ActionMerge   = "merge"
+	ActionRevise  = "revise"
+)
+
+// ActionUpdate, ActionDelete and ActionTag are checked against access
+// policies, like the workflow actions, but are not recorded in the history.
+const (
+	ActionUpdate = "update"
+	ActionDelete = "delete"
+	ActionTag    = "tag"
+)
+
+// ResourceBook is the resource type of books in access policies.
+const ResourceBook = "book"
+
 type Book struct {
-	ID       string `db:"id" json:"id"`
-	ISBN     string `db:"isbn" json:"isbn"`
-	Title    string `db:"title" json:"title"`
-	Author   string `db:"author" json:"author"`
-	Category string `db:"category" json:"category"`
+	ID             string     `db:"id" json:"id"`
+	ISBN           string     `db:"isbn" json:"isbn"`
+	Title          string     `db:"title" json:"title"`
+	Author         string     `db:"author" json:"author"`
+	Category       string     `db:"category" json:"category"`
+	Description    string     `db:"description" json:"description,omitempty"`
+	Status         string     `db:"status" json:"status"`
+	SeriesID       string     `db:"series_id" json:"series_id,omitempty"`
+	SeriesPosition *float64   `db:"series_position" json:"series_position,omitempty"`
+	NextInSeries   string     `db:"-" json:"next_in_series,omitempty"`
+	Relations      []Relation `db:"-" json:"relations,omitempty"`
+	CreatedAt      time.Time  `db:"created_at" json:"-"`
+	UpdatedAt      time.Time  `db:"updated_at" json:"-"`
+}
+
+// PublicBook is the reduced view of a book served to anonymous clients.
+type PublicBook struct {
+	ID             string           `json:"id"`
+	ISBN           string           `json:"isbn"`
+	Title          string           `json:"title"`
+	Author         string           `json:"author"`
+	Category       string           `json:"category"`
+	Description    string           `json:"description,omitempty"`
+	SeriesID       string           `json:"series_id,omitempty"`
+	SeriesPosition *float64         `json:"series_position,omitempty"`
+	NextInSeries   string           `json:"next_in_series,omitempty"`
+	Relations      []PublicRelation `json:"relations,omitempty"`
+}
+
+// Resource describes the book to access policies.
+func (bk Book) Resource() policy.Resource {
+	return policy.Resource{
+		Type: ResourceBook,
+		ID:   bk.ID,
+		Attributes: map[string]interface{}{
+			"isbn":      bk.ISBN,
+			"title":     bk.Title,
+			"author":    bk.Author,
+			"category":  bk.Category,
+			"status":    bk.Status,
+			"series_id": bk.SeriesID,
+		},
+	}
+}
+
+func (bk Book) Public() PublicBook {
+	return PublicBook{
+		ID:             bk.ID,
+		ISBN:           bk.ISBN,
+		Title:          bk.Title,
+		Author:         bk.Author,
+		Category:       bk.Category,
+		Description:    bk.Description,
+		SeriesID:       bk.SeriesID,
+		SeriesPosition: bk.SeriesPosition,
+		NextInSeries:   bk.NextInSeries,
+		Relations:      PublicRelations(bk.Relations),
+	}
+}
+
+func Public(bks []Book) []PublicBook {
+	pbs := make([]PublicBook, 0, len(bks))
+	for _, bk := range bks {
+		pbs = append(pbs, bk.Public())
+	}
+	return pbs
 }
 
 type NewBook struct {
-	ISBN     string `json:"isbn" validate:"required"`
-	Title    string `json:"title" validate:"required"`
-	Author   string `json:"author" validate:"required"`
-	Category string `json:"category"`
+	ISBN           string   `json:"isbn" validate:"required"`
+	Title          string   `json:"title" validate:"required"`
+	Author         string   `json:"author" validate:"required"`
+	Category       string   `json:"category"`
+	Description    string   `json:"description"`
+	SeriesID       string   `json:"series_id"`
+	SeriesPosition *float64 `json:"series_position"`
 }
 
+// UpdateBook leaves nil fields untouched. An empty series_id takes the book
+// out of its series.
 type UpdateBook struct {
-	ISBN     string  `json:"isbn"`
-	Title    string  `json:"title"`
-	Author   string  `json:"author"`
-	Category *string `json:"category"`
+	ISBN           string   `json:"isbn"`
+	Title          string   `json:"title"`
+	Author         string   `json:"author"`
+	Category       *string  `json:"category"`
+	Description    *string  `json:"description"`
+	SeriesID       *string  `json:"series_id"`
+	SeriesPosition *float64 `json:"series_position"`
+}
+
+type Transition struct {
+	ID        string    `db:"id" json:"id"`
+	BookID    string    `db:"book_id" json:"book_id"`
+	Action    string    `db:"action" json:"action"`
+	From      string    `db:"from_status" json:"from"`
+	To        string    `db:"to_status" json:"to"`
+	ActorID   string    `db:"actor_id" json:"actor_id"`
+	Comment   string    `db:"comment" json:"comment,omitempty"`
+	CreatedAt time.Time `db:"created_at" json:"created_at"`
+}
+
+type Review struct {
+	Comment string `json:"comment"`
+}
+
+// Relation is a typed link from one book to another, read from the side of
+// the book it is attached to.
+type Relation struct {
+	ID     string `db:"id" json:"id"`
+	Type   string `db:"type" json:"type"`
+	BookID string `db:"related_id" json:"book_id"`
+	Book   *Book  `db:"-" json:"book,omitempty"`
+}
+
+type PublicRelation struct {
+	Type   string      `json:"type"`
+	BookID string      `json:"book_id"`
+	Book   *PublicBook `json:"book,omitempty"`
+}
+
+func PublicRelations(rls []Relation) []PublicRelation {
+	if rls == nil {
+		return nil
+	}
+
+	prs := make([]PublicRelation, 0, len(rls))
+	for _, rl := range rls {
+		pr := PublicRelation{Type: rl.Type, BookID: rl.BookID}
+		if rl.Book != nil {
+			pb := rl.Book.Public()
+			pr.Book = &pb
+		}
+		prs = append(prs, pr)
+	}
+	return prs
+}
+
+type NewRelation struct {
+	Type   string `json:"type" validate:"required"`
+	BookID string `json:"book_id" validate:"required"`
+}
+
+// Merge records a book folded into another one. Source keeps a copy of the
+// merged book as it was before deletion.
+type Merge struct {
+	ID        string    `db:"id" json:"id"`
+	SourceID  string    `db:"source_id" json:"source_id"`
+	TargetID  string    `db:"target_id" json:"target_id"`
+	ActorID   string    `db:"actor_id" json:"actor_id"`
+	Source    Book      `db:"source" json:"source"`
+	CreatedAt time.Time `db:"created_at" json:"created_at"`
+}
+
+type NewMerge struct {
+	Source string `json:"source" validate:"required"`
+}
+
+const (
+	FacetCategory = "category"
+	FacetAuthor   = "author"
+)
+
+// Facet is a distinct category or author with the number of books under it.
+type Facet struct {
+	Name  string `json:"name"`
+	Count int    `json:"count"`
+}
+
+// Harvest selects books updated within [From, Until), oldest first. Paging
+// resumes after the book at AfterTime and AfterID rather than at an offset,
+// so books updated mid-harvest are neither skipped nor repeated.
+type Harvest struct {
+	Status    string
+	Category  string
+	From      time.Time
+	Until     time.Time
+	AfterTime time.Time
+	AfterID   string
+}
+
+const (
+	AttachmentCover = "cover"
+	AttachmentEPUB  = "epub"
+)
+
+// Attachment is a file kept with a book, such as its cover or the EPUB it
+// was created from. Data is only loaded when the file itself is requested.
+type Attachment struct {
+	ID          string    `json:"id"`
+	BookID      string    `json:"book_id"`
+	Kind        string    `json:"kind"`
+	Filename    string    `json:"filename"`
+	ContentType string    `json:"content_type"`
+	Size        int       `json:"size"`
+	Data        []byte    `json:"-"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+// maxFilename is the longest attachment filename that can be stored.
+const maxFilename = 255
+
+// coverTypes are the image types kept as covers. Covers are served inline,
+// so formats that can carry scripts, such as SVG, are left out.
+var coverTypes = map[string]bool{
+	"image/jpeg": true,
+	"image/png":  true,
+	"image/gif":  true,
+	"image/webp": true,
+}
+
+// Inline reports whether an attachment of the content type may be shown by
+// the browser rather than downloaded.
+func Inline(contentType string) bool {
+	return coverTypes[contentType]
 }
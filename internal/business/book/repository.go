@@ -2,26 +2,53 @@ package book
 
 import (
 	"database/sql"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"net/http"
 	"strconv"
+	"time"
 
 	"github.com/axwilliams/book-api/internal/platform/web"
+	"github.com/lib/pq"
 )
 
 var (
-	ErrNoAffect    = errors.New("No rows affected")
-	ErrNoBookFound = errors.New("No book found")
+	ErrNoAffect     = errors.New("No rows affected")
+	ErrNoBookFound  = errors.New("No book found")
+	ErrNoAttachment = errors.New("No attachment found")
 )
 
+const bookColumns = `id, isbn, title, author, category, description, status,
+	COALESCE(series_id::text, ''), series_position, created_at, updated_at`
+
 type Repository interface {
-	GetAll() ([]Book, error)
+	GetAll(status string) ([]Book, error)
 	GetById(id string) (*Book, error)
+	GetByIds(ids []string) ([]Book, error)
+	GetByISBN(isbn string) (*Book, error)
 	Search(sp SearchParams, sortOrder string, limit, offset int) ([]Book, error)
-	Create(bk *Book) error
-	Update(bk *Book) error
+	Create(bk *Book, t *Transition, as []Attachment, marc []byte) error
+	Update(bk *Book, t *Transition) error
 	Destroy(id string) error
+	UpdateStatus(bk *Book, t *Transition) error
+	GetTransitions(bookID string) ([]Transition, error)
+	NextInSeries(bk *Book) (*Book, error)
+	SeriesExists(id string) bool
+	GetRelations(bookID, status string) ([]Relation, error)
+	AddRelation(bookID string, rl *Relation) error
+	RemoveRelation(bookID, relationID string) error
+	RelationExists(bookID, relationType, relatedID string) (bool, error)
+	InSequelChain(fromID, toID string) (bool, error)
+	Merge(m *Merge, t *Transition) error
+	Redirect(id string) (string, error)
+	GetMARC(bookID string) ([]byte, error)
+	GetAllMARC(status string) (map[string][]byte, error)
+	Facets(field, status string) ([]Facet, error)
+	Harvest(h Harvest, limit int) ([]Book, error)
+	GetAttachments(bookID string) ([]Attachment, error)
+	GetAttachment(bookID, attachmentID string) (*Attachment, error)
+	GetCover(bookID string) (*Attachment, error)
 }
 
 type repository struct {
@@ -34,33 +61,59 @@ func NewRepository(db *sql.DB) Repository {
 	}
 }
 
-func (r *repository) GetAll() ([]Book, error) {
-	rows, err := r.db.Query("SELECT id, isbn, title, author, category FROM book")
-	if err != nil {
-		return nil, fmt.Errorf("Retrieving books: %w", err)
-	}
+type scanner interface {
+	Scan(dest ...interface{}) error
+}
+
+// bookFields lists the scan destinations matching bookColumns.
+func bookFields(bk *Book) []interface{} {
+	return []interface{}{&bk.ID, &bk.ISBN, &bk.Title, &bk.Author, &bk.Category, &bk.Description,
+		&bk.Status, &bk.SeriesID, &bk.SeriesPosition, &bk.CreatedAt, &bk.UpdatedAt}
+}
+
+func scanBook(row scanner, bk *Book) error {
+	return row.Scan(bookFields(bk)...)
+}
+
+func scanBooks(rows *sql.Rows) ([]Book, error) {
 	defer rows.Close()
 
 	bks := []Book{}
 	for rows.Next() {
 		bk := Book{}
-		if err = rows.Scan(&bk.ID, &bk.ISBN, &bk.Title, &bk.Author, &bk.Category); err != nil {
+		if err := scanBook(rows, &bk); err != nil {
 			return nil, fmt.Errorf("Scanning book rows: %w", err)
 		}
 		bks = append(bks, bk)
 	}
-	if err = rows.Err(); err != nil {
+	if err := rows.Err(); err != nil {
 		return nil, fmt.Errorf("Iterating book rows: %w", err)
 	}
 
 	return bks, nil
 }
 
+func (r *repository) GetAll(status string) ([]Book, error) {
+	q := "SELECT " + bookColumns + " FROM book"
+	args := []interface{}{}
+
+	if status != "" {
+		q += " WHERE status = $1"
+		args = append(args, status)
+	}
+
+	rows, err := r.db.Query(q, args...)
+	if err != nil {
+		return nil, fmt.Errorf("Retrieving books: %w", err)
+	}
+
+	return scanBooks(rows)
+}
+
 func (r *repository) GetById(id string) (*Book, error) {
 	bk := &Book{}
 
-	err := r.db.QueryRow("SELECT id, isbn, title, author, category FROM book where id=$1",
-		id).Scan(&bk.ID, &bk.ISBN, &bk.Title, &bk.Author, &bk.Category)
+	err := scanBook(r.db.QueryRow("SELECT "+bookColumns+" FROM book where id=$1", id), bk)
 
 	switch {
 	case err == sql.ErrNoRows:
@@ -72,11 +125,52 @@ func (r *repository) GetById(id string) (*Book, error) {
 	return bk, nil
 }
 
+// GetByIds loads the books with the given IDs in one query, in no
+// particular order. Unknown IDs are left out.
+func (r *repository) GetByIds(ids []string) ([]Book, error) {
+	rows, err := r.db.Query("SELECT "+bookColumns+" FROM book WHERE id = ANY($1)", pq.StringArray(ids))
+	if err != nil {
+		return nil, fmt.Errorf("Retrieving books: %w", err)
+	}
+
+	return scanBooks(rows)
+}
+
+// GetByISBN finds the oldest book with the same ISBN, ignoring separators and
+// whether it was stored as an ISBN-10 or ISBN-13.
+func (r *repository) GetByISBN(isbn string) (*Book, error) {
+	forms := isbnForms(isbn)
+	if len(forms) == 0 {
+		return nil, ErrNoBookFound
+	}
+
+	bk := &Book{}
+
+	err := scanBook(r.db.QueryRow("SELECT "+bookColumns+` FROM book
+		WHERE regexp_replace(upper(isbn), '[^0-9X]', '', 'g') = ANY($1) ORDER BY created_at, id LIMIT 1`,
+		pq.StringArray(forms)), bk)
+
+	switch {
+	case err == sql.ErrNoRows:
+		return nil, ErrNoBookFound
+	case err != nil:
+		return nil, fmt.Errorf("Retrieving book by ISBN: %w", err)
+	}
+
+	return bk, nil
+}
+
 func (r *repository) Search(sp SearchParams, sortOrder string, limit, offset int) ([]Book, error) {
 	where := ""
 	args := []interface{}{}
 
-	q := `SELECT * FROM book `
+	q := "SELECT " + bookColumns + " FROM book "
+
+	if sp.Query != "" {
+		args = append(args, "%"+sp.Query+"%")
+		n := strconv.Itoa(len(args))
+		where += " (title ILIKE $" + n + " OR author ILIKE $" + n + ") AND "
+	}
 
 	if sp.ISBN != "" {
 		args = append(args, sp.ISBN)
@@ -98,12 +192,42 @@ func (r *repository) Search(sp SearchParams, sortOrder string, limit, offset int
 		where += " category = $" + strconv.Itoa(len(args)) + " AND "
 	}
 
+	if sp.SeriesID != "" {
+		args = append(args, sp.SeriesID)
+		where += " series_id = $" + strconv.Itoa(len(args)) + " AND "
+	}
+
+	if sp.Status != "" {
+		args = append(args, sp.Status)
+		where += " status = $" + strconv.Itoa(len(args)) + " AND "
+	}
+
+	if len(sp.Tags) > 0 {
+		args = append(args, pq.StringArray(sp.Tags))
+		tags := "$" + strconv.Itoa(len(args))
+
+		// Tags are matched by name or synonym; "all" needs every requested
+		// name to match one of the book's tags.
+		sub := `SELECT bt.book_id FROM book_tag bt JOIN tag t ON t.id = bt.tag_id
+			LEFT JOIN tag_synonym ts ON ts.tag_id = t.id
+			JOIN unnest(` + tags + `::text[]) AS q(name) ON q.name = t.name OR q.name = ts.name`
+
+		if sp.TagMatch == MatchAll {
+			args = append(args, len(sp.Tags))
+			sub += " GROUP BY bt.book_id HAVING count(DISTINCT q.name) = $" + strconv.Itoa(len(args))
+		}
+
+		where += " id IN (" + sub + ") AND "
+	}
+
 	if wlen := len(where); wlen > 0 {
 		where = "WHERE " + where[:wlen-len(" AND ")]
 	}
 
 	if sortOrder != "" {
 		where += fmt.Sprintf(" ORDER BY %s", sortOrder)
+	} else if sp.SeriesID != "" {
+		where += " ORDER BY series_position NULLS LAST, title"
 	}
 
 	if limit != 0 {
@@ -118,42 +242,84 @@ func (r *repository) Search(sp SearchParams, sortOrder string, limit, offset int
 	if err != nil {
 		return nil, fmt.Errorf("Searching books: %w", err)
 	}
-	defer rows.Close()
-
-	bks := make([]Book, 0)
-	for rows.Next() {
-		bk := Book{}
-		if err = rows.Scan(&bk.ID, &bk.ISBN, &bk.Title, &bk.Author, &bk.Category); err != nil {
-			return nil, fmt.Errorf("Scanning book rows: %w", err)
-		}
-		bks = append(bks, bk)
-	}
-	if err = rows.Err(); err != nil {
-		return nil, fmt.Errorf("Iterating book rows: %w", err)
-	}
 
-	return bks, nil
+	return scanBooks(rows)
 }
 
-func (r *repository) Create(bk *Book) error {
-	_, err := r.db.Exec("INSERT INTO book (id, isbn, title, author, category) VALUES ($1, $2, $3, $4, $5)",
-		bk.ID, bk.ISBN, bk.Title, bk.Author, bk.Category)
+// Create adds a book together with the transition that records who created
+// it and the book's attachments.
+// Create adds a book with its first transition, its attachments and, when
+// marc is not nil, the raw MARC record it was imported from.
+func (r *repository) Create(bk *Book, t *Transition, as []Attachment, marc []byte) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec(`INSERT INTO book (id, isbn, title, author, category, description, status,
+		series_id, series_position, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, NULLIF($8, '')::uuid, $9, $10, $11)`,
+		bk.ID, bk.ISBN, bk.Title, bk.Author, bk.Category, bk.Description, bk.Status,
+		bk.SeriesID, bk.SeriesPosition, bk.CreatedAt, bk.UpdatedAt)
 
 	if err != nil {
 		return fmt.Errorf("Creating book: %w", err)
 	}
 
+	if err := insertTransition(tx, t); err != nil {
+		return err
+	}
+
+	for i := range as {
+		if err := insertAttachment(tx, &as[i]); err != nil {
+			return err
+		}
+	}
+
+	if marc != nil {
+		_, err := tx.Exec("INSERT INTO book_marc (book_id, record, updated_at) VALUES ($1, $2, $3)",
+			bk.ID, marc, bk.CreatedAt)
+		if err != nil {
+			return fmt.Errorf("Saving MARC record: %w", err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("Committing book: %w", err)
+	}
+
 	return nil
 }
 
-func (r *repository) Update(bk *Book) error {
-	_, err := r.db.Exec("UPDATE book SET isbn=$1, title=$2, author=$3, category=$4 WHERE id=$5;",
-		bk.ISBN, bk.Title, bk.Author, bk.Category, bk.ID)
+// Update saves the fields of a book. When t is given the book also moves
+// along it, as UpdateStatus does.
+func (r *repository) Update(bk *Book, t *Transition) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec(`UPDATE book SET isbn=$1, title=$2, author=$3, category=$4, description=$5,
+		series_id=NULLIF($6, '')::uuid, series_position=$7, updated_at=$8 WHERE id=$9;`,
+		bk.ISBN, bk.Title, bk.Author, bk.Category, bk.Description,
+		bk.SeriesID, bk.SeriesPosition, bk.UpdatedAt, bk.ID)
 
 	if err != nil {
 		return fmt.Errorf("Updating book: %w", err)
 	}
 
+	if t != nil {
+		if err := setStatus(tx, bk, t); err != nil {
+			return err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("Committing book: %w", err)
+	}
+
 	return nil
 }
 
@@ -174,3 +340,575 @@ func (r *repository) Destroy(id string) error {
 
 	return nil
 }
+
+// UpdateStatus moves a book along a transition. It returns
+// ErrInvalidTransition when the book is no longer in the transition's from
+// status, e.g. because a concurrent request moved it first.
+func (r *repository) UpdateStatus(bk *Book, t *Transition) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := setStatus(tx, bk, t); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("Committing book status: %w", err)
+	}
+
+	return nil
+}
+
+func setStatus(tx *sql.Tx, bk *Book, t *Transition) error {
+	res, err := tx.Exec("UPDATE book SET status=$1, updated_at=$2 WHERE id=$3 AND status=$4;", t.To, bk.UpdatedAt, bk.ID, t.From)
+	if err != nil {
+		return fmt.Errorf("Updating book status: %w", err)
+	}
+
+	count, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("Counting affected books: %w", err)
+	}
+
+	if count <= 0 {
+		return ErrInvalidTransition
+	}
+
+	return insertTransition(tx, t)
+}
+
+type execer interface {
+	Exec(query string, args ...interface{}) (sql.Result, error)
+}
+
+func insertTransition(db execer, t *Transition) error {
+	_, err := db.Exec(`INSERT INTO book_transition (id, book_id, action, from_status, to_status, actor_id, comment, created_at)
+		VALUES ($1, $2, $3, $4, $5, NULLIF($6, '')::uuid, $7, $8)`,
+		t.ID, t.BookID, t.Action, t.From, t.To, t.ActorID, t.Comment, t.CreatedAt)
+
+	if err != nil {
+		return fmt.Errorf("Recording book transition: %w", err)
+	}
+
+	return nil
+}
+
+func (r *repository) GetTransitions(bookID string) ([]Transition, error) {
+	rows, err := r.db.Query(`SELECT id, book_id, action, from_status, to_status, COALESCE(actor_id::text, ''), comment, created_at
+		FROM book_transition WHERE book_id = $1 ORDER BY created_at`, bookID)
+	if err != nil {
+		return nil, fmt.Errorf("Retrieving book transitions: %w", err)
+	}
+	defer rows.Close()
+
+	ts := []Transition{}
+	for rows.Next() {
+		t := Transition{}
+		if err = rows.Scan(&t.ID, &t.BookID, &t.Action, &t.From, &t.To, &t.ActorID, &t.Comment, &t.CreatedAt); err != nil {
+			return nil, fmt.Errorf("Scanning transition rows: %w", err)
+		}
+		ts = append(ts, t)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("Iterating transition rows: %w", err)
+	}
+
+	return ts, nil
+}
+
+// NextInSeries returns the published book that follows bk in its series, or
+// ErrNoBookFound when bk is the last one or has no position.
+func (r *repository) NextInSeries(bk *Book) (*Book, error) {
+	if bk.SeriesID == "" || bk.SeriesPosition == nil {
+		return nil, ErrNoBookFound
+	}
+
+	next := &Book{}
+
+	err := scanBook(r.db.QueryRow(`SELECT `+bookColumns+` FROM book
+		WHERE series_id = $1 AND series_position > $2 AND status = $3
+		ORDER BY series_position, title LIMIT 1`, bk.SeriesID, *bk.SeriesPosition, StatusPublished), next)
+
+	switch {
+	case err == sql.ErrNoRows:
+		return nil, ErrNoBookFound
+	case err != nil:
+		return nil, fmt.Errorf("Retrieving next book in series: %w", err)
+	}
+
+	return next, nil
+}
+
+func (r *repository) SeriesExists(id string) bool {
+	var exists bool
+
+	err := r.db.QueryRow("SELECT EXISTS (SELECT 1 FROM series WHERE id = $1)", id).Scan(&exists)
+
+	return err == nil && exists
+}
+
+// GetRelations returns the relations of a book in both directions, each with
+// the related book. Relations stored on the other book are reported with the
+// inverse type. A non-empty status only keeps related books in that status.
+func (r *repository) GetRelations(bookID, status string) ([]Relation, error) {
+	q := `SELECT rel.rid, rel.rtype, rel.outgoing, ` + bookColumns + ` FROM book
+		JOIN (SELECT id AS rid, type AS rtype, book_id = $1 AS outgoing,
+			CASE WHEN book_id = $1 THEN related_id ELSE book_id END AS other
+			FROM book_relation WHERE book_id = $1 OR related_id = $1) rel ON rel.other = book.id`
+	args := []interface{}{bookID}
+
+	if status != "" {
+		q += " WHERE status = $2"
+		args = append(args, status)
+	}
+
+	q += " ORDER BY rel.rtype, title"
+
+	rows, err := r.db.Query(q, args...)
+	if err != nil {
+		return nil, fmt.Errorf("Retrieving book relations: %w", err)
+	}
+	defer rows.Close()
+
+	rls := []Relation{}
+	for rows.Next() {
+		rl := Relation{Book: &Book{}}
+		outgoing := false
+
+		dest := append([]interface{}{&rl.ID, &rl.Type, &outgoing}, bookFields(rl.Book)...)
+		if err = rows.Scan(dest...); err != nil {
+			return nil, fmt.Errorf("Scanning relation rows: %w", err)
+		}
+
+		if !outgoing {
+			rl.Type = relationInverses[rl.Type]
+		}
+		rl.BookID = rl.Book.ID
+
+		rls = append(rls, rl)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("Iterating relation rows: %w", err)
+	}
+
+	return rls, nil
+}
+
+// AddRelation stores rl from bookID. rl.Type must be a stored type.
+func (r *repository) AddRelation(bookID string, rl *Relation) error {
+	_, err := r.db.Exec(`INSERT INTO book_relation (id, book_id, type, related_id, created_at)
+		VALUES ($1, $2, $3, $4, $5)`,
+		rl.ID, bookID, rl.Type, rl.BookID, time.Now().UTC())
+
+	if err != nil {
+		return fmt.Errorf("Creating book relation: %w", err)
+	}
+
+	return nil
+}
+
+func (r *repository) RemoveRelation(bookID, relationID string) error {
+	res, err := r.db.Exec("DELETE FROM book_relation WHERE id = $1 AND (book_id = $2 OR related_id = $2);",
+		relationID, bookID)
+	if err != nil {
+		return fmt.Errorf("Removing book relation: %w", err)
+	}
+
+	count, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("Counting affected relations: %w", err)
+	}
+
+	if count <= 0 {
+		return web.NewRequestError(ErrNoAffect, http.StatusGone)
+	}
+
+	return nil
+}
+
+// RelationExists also looks at the reverse direction for symmetric types.
+func (r *repository) RelationExists(bookID, relationType, relatedID string) (bool, error) {
+	var exists bool
+
+	err := r.db.QueryRow(`SELECT EXISTS (SELECT 1 FROM book_relation WHERE type = $2 AND
+		((book_id = $1 AND related_id = $3) OR ($4 AND book_id = $3 AND related_id = $1)))`,
+		bookID, relationType, relatedID, relationInverses[relationType] == relationType).Scan(&exists)
+	if err != nil {
+		return false, fmt.Errorf("Checking book relation: %w", err)
+	}
+
+	return exists, nil
+}
+
+// InSequelChain reports whether toID can be reached from fromID by following
+// sequel_of relations.
+func (r *repository) InSequelChain(fromID, toID string) (bool, error) {
+	var found bool
+
+	err := r.db.QueryRow(`WITH RECURSIVE chain(id) AS (
+			SELECT related_id FROM book_relation WHERE book_id = $1 AND type = $3
+			UNION
+			SELECT rel.related_id FROM book_relation rel JOIN chain ON rel.book_id = chain.id AND rel.type = $3
+		)
+		SELECT EXISTS (SELECT 1 FROM chain WHERE id = $2)`, fromID, toID, RelationSequelOf).Scan(&found)
+	if err != nil {
+		return false, fmt.Errorf("Following sequel chain: %w", err)
+	}
+
+	return found, nil
+}
+
+// Merge moves everything that points at the source book over to the target,
+// records the merge and a redirect, and deletes the source. Links the target
+// already has, links between the two books, and sequel relations that would
+// loop back on themselves are dropped with the source. The source's raw MARC
+// record moves to the target unless it has its own, in which case it is kept
+// on the merge record.
+func (r *repository) Merge(m *Merge, t *Transition) error {
+	source, err := json.Marshal(m.Source)
+	if err != nil {
+		return fmt.Errorf("Encoding merged book: %w", err)
+	}
+
+	tx, err := r.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	from, to := m.SourceID, m.TargetID
+
+	if err := dropSequelCycles(tx, from, to); err != nil {
+		return err
+	}
+
+	steps := []struct {
+		what string
+		q    string
+		args []interface{}
+	}{
+		{"tags", `INSERT INTO book_tag (book_id, tag_id, user_id, created_at)
+			SELECT $2, tag_id, user_id, created_at FROM book_tag WHERE book_id = $1
+			ON CONFLICT DO NOTHING`, []interface{}{from, to}},
+		{"relations", `UPDATE book_relation rel SET book_id = $2 WHERE book_id = $1 AND related_id <> $2
+			AND NOT EXISTS (SELECT 1 FROM book_relation o WHERE o.book_id = $2 AND o.type = rel.type AND o.related_id = rel.related_id)`,
+			[]interface{}{from, to}},
+		{"inverse relations", `UPDATE book_relation rel SET related_id = $2 WHERE related_id = $1 AND book_id <> $2
+			AND NOT EXISTS (SELECT 1 FROM book_relation o WHERE o.related_id = $2 AND o.type = rel.type AND o.book_id = rel.book_id)`,
+			[]interface{}{from, to}},
+		{"transitions", "UPDATE book_transition SET book_id = $2 WHERE book_id = $1", []interface{}{from, to}},
+		{"attachments", "UPDATE book_attachment SET book_id = $2 WHERE book_id = $1", []interface{}{from, to}},
+		{"import records", "UPDATE import_record SET book_id = $2 WHERE book_id = $1", []interface{}{from, to}},
+		{"MARC record", `UPDATE book_marc SET book_id = $2 WHERE book_id = $1
+			AND NOT EXISTS (SELECT 1 FROM book_marc o WHERE o.book_id = $2)`, []interface{}{from, to}},
+		{"ratings", `INSERT INTO book_rating (book_id, user_id, rating, updated_at)
+			SELECT $2, user_id, rating, updated_at FROM book_rating WHERE book_id = $1
+			ON CONFLICT DO NOTHING`, []interface{}{from, to}},
+		{"shelves", `INSERT INTO book_shelf (book_id, user_id, shelf, created_at)
+			SELECT $2, user_id, shelf, created_at FROM book_shelf WHERE book_id = $1
+			ON CONFLICT DO NOTHING`, []interface{}{from, to}},
+		{"similar books", "DELETE FROM book_similar WHERE book_id = $1 OR similar_id = $1", []interface{}{from}},
+		{"redirects", "UPDATE book_redirect SET to_id = $2 WHERE to_id = $1", []interface{}{from, to}},
+		{"redirect", "INSERT INTO book_redirect (from_id, to_id, created_at) VALUES ($1, $2, $3)", []interface{}{from, to, m.CreatedAt}},
+	}
+
+	for _, step := range steps {
+		if _, err := tx.Exec(step.q, step.args...); err != nil {
+			return fmt.Errorf("Merging book: %s: %w", step.what, err)
+		}
+	}
+
+	// The source's MARC record is only left when the target has its own, so
+	// keep it with the merge.
+	_, err = tx.Exec(`INSERT INTO book_merge (id, source_id, target_id, actor_id, source, source_marc, created_at)
+		VALUES ($1, $2, $3, NULLIF($4, '')::uuid, $5, (SELECT record FROM book_marc WHERE book_id = $2), $6)`,
+		m.ID, m.SourceID, m.TargetID, m.ActorID, source, m.CreatedAt)
+	if err != nil {
+		return fmt.Errorf("Recording book merge: %w", err)
+	}
+
+	if err := insertTransition(tx, t); err != nil {
+		return err
+	}
+
+	if _, err := tx.Exec("DELETE FROM book WHERE id = $1", m.SourceID); err != nil {
+		return fmt.Errorf("Deleting merged book: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("Committing book merge: %w", err)
+	}
+
+	return nil
+}
+
+// mergedSequelChain is InSequelChain over the graph as it will look once the
+// source ($3) is folded into the target ($4): it reports whether $2 can be
+// reached from $1.
+const mergedSequelChain = `WITH RECURSIVE edge(book_id, related_id) AS (
+		SELECT CASE WHEN book_id = $3 THEN $4 ELSE book_id END,
+			CASE WHEN related_id = $3 THEN $4 ELSE related_id END
+		FROM book_relation
+		WHERE type = $5 AND NOT (book_id IN ($3, $4) AND related_id IN ($3, $4))
+	), chain(id) AS (
+		SELECT related_id FROM edge WHERE book_id = $1
+		UNION
+		SELECT edge.related_id FROM edge JOIN chain ON edge.book_id = chain.id
+	)
+	SELECT EXISTS (SELECT 1 FROM chain WHERE id = $2)`
+
+// dropSequelCycles deletes the source's sequel_of relations that would close
+// a loop in the sequel chain once they are moved onto the target.
+func dropSequelCycles(tx *sql.Tx, from, to string) error {
+	rows, err := tx.Query(`SELECT book_id, related_id FROM book_relation
+		WHERE type = $1 AND (book_id = $2 OR related_id = $2) AND book_id <> $3 AND related_id <> $3`,
+		RelationSequelOf, from, to)
+	if err != nil {
+		return fmt.Errorf("Merging book: sequel relations: %w", err)
+	}
+
+	var rels [][2]string
+	for rows.Next() {
+		var rel [2]string
+		if err := rows.Scan(&rel[0], &rel[1]); err != nil {
+			rows.Close()
+			return fmt.Errorf("Merging book: sequel relations: %w", err)
+		}
+		rels = append(rels, rel)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("Merging book: sequel relations: %w", err)
+	}
+
+	// Each relation is checked against the graph left by the ones already
+	// dropped, so only as many are removed as it takes to break every loop.
+	for _, rel := range rels {
+		start, end := rel[1], to
+		if rel[1] == from {
+			start, end = to, rel[0]
+		}
+
+		var cycle bool
+		err := tx.QueryRow(mergedSequelChain, start, end, from, to, RelationSequelOf).Scan(&cycle)
+		if err != nil {
+			return fmt.Errorf("Merging book: following sequel chain: %w", err)
+		}
+		if !cycle {
+			continue
+		}
+
+		_, err = tx.Exec("DELETE FROM book_relation WHERE type = $1 AND book_id = $2 AND related_id = $3",
+			RelationSequelOf, rel[0], rel[1])
+		if err != nil {
+			return fmt.Errorf("Merging book: dropping sequel relation: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// Redirect returns the book a merged book now lives on.
+func (r *repository) Redirect(id string) (string, error) {
+	var to string
+
+	err := r.db.QueryRow("SELECT to_id FROM book_redirect WHERE from_id = $1", id).Scan(&to)
+
+	switch {
+	case err == sql.ErrNoRows:
+		return "", ErrNoBookFound
+	case err != nil:
+		return "", fmt.Errorf("Retrieving book redirect: %w", err)
+	}
+
+	return to, nil
+}
+
+// GetMARC returns the raw record a book was imported from, or nil when the
+// book was not imported.
+func (r *repository) GetMARC(bookID string) ([]byte, error) {
+	var raw []byte
+
+	err := r.db.QueryRow("SELECT record FROM book_marc WHERE book_id = $1", bookID).Scan(&raw)
+
+	switch {
+	case err == sql.ErrNoRows:
+		return nil, nil
+	case err != nil:
+		return nil, fmt.Errorf("Retrieving MARC record: %w", err)
+	}
+
+	return raw, nil
+}
+
+// GetAllMARC returns the raw records by book ID, for books in status when it
+// is not empty.
+func (r *repository) GetAllMARC(status string) (map[string][]byte, error) {
+	q := "SELECT m.book_id, m.record FROM book_marc m JOIN book b ON b.id = m.book_id"
+	args := []interface{}{}
+
+	if status != "" {
+		q += " WHERE b.status = $1"
+		args = append(args, status)
+	}
+
+	rows, err := r.db.Query(q, args...)
+	if err != nil {
+		return nil, fmt.Errorf("Retrieving MARC records: %w", err)
+	}
+	defer rows.Close()
+
+	raws := map[string][]byte{}
+	for rows.Next() {
+		var id string
+		var raw []byte
+		if err = rows.Scan(&id, &raw); err != nil {
+			return nil, fmt.Errorf("Scanning MARC rows: %w", err)
+		}
+		raws[id] = raw
+	}
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("Iterating MARC rows: %w", err)
+	}
+
+	return raws, nil
+}
+
+// Facets counts books per distinct value of field, which must be one of the
+// Facet constants.
+func (r *repository) Facets(field, status string) ([]Facet, error) {
+	q := "SELECT " + field + ", count(*) FROM book WHERE " + field + " <> ''"
+	args := []interface{}{}
+
+	if status != "" {
+		q += " AND status = $1"
+		args = append(args, status)
+	}
+
+	q += " GROUP BY " + field + " ORDER BY " + field
+
+	rows, err := r.db.Query(q, args...)
+	if err != nil {
+		return nil, fmt.Errorf("Retrieving book facets: %w", err)
+	}
+	defer rows.Close()
+
+	fs := []Facet{}
+	for rows.Next() {
+		f := Facet{}
+		if err = rows.Scan(&f.Name, &f.Count); err != nil {
+			return nil, fmt.Errorf("Scanning facet rows: %w", err)
+		}
+		fs = append(fs, f)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("Iterating facet rows: %w", err)
+	}
+
+	return fs, nil
+}
+
+func (r *repository) Harvest(h Harvest, limit int) ([]Book, error) {
+	where := ""
+	args := []interface{}{}
+
+	if h.Status != "" {
+		args = append(args, h.Status)
+		where += " status = $" + strconv.Itoa(len(args)) + " AND "
+	}
+
+	if h.Category != "" {
+		args = append(args, h.Category)
+		where += " category = $" + strconv.Itoa(len(args)) + " AND "
+	}
+
+	if !h.From.IsZero() {
+		args = append(args, h.From)
+		where += " updated_at >= $" + strconv.Itoa(len(args)) + " AND "
+	}
+
+	if !h.Until.IsZero() {
+		args = append(args, h.Until)
+		where += " updated_at < $" + strconv.Itoa(len(args)) + " AND "
+	}
+
+	if h.AfterID != "" {
+		args = append(args, h.AfterTime, h.AfterID)
+		where += " (updated_at, id) > ($" + strconv.Itoa(len(args)-1) + ", $" + strconv.Itoa(len(args)) + "::uuid) AND "
+	}
+
+	if wlen := len(where); wlen > 0 {
+		where = "WHERE " + where[:wlen-len(" AND ")]
+	}
+
+	rows, err := r.db.Query("SELECT "+bookColumns+" FROM book "+where+fmt.Sprintf(" ORDER BY updated_at, id LIMIT %d", limit), args...)
+	if err != nil {
+		return nil, fmt.Errorf("Harvesting books: %w", err)
+	}
+
+	return scanBooks(rows)
+}
+
+func insertAttachment(db execer, a *Attachment) error {
+	_, err := db.Exec(`INSERT INTO book_attachment (id, book_id, kind, filename, content_type, size, data, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)`,
+		a.ID, a.BookID, a.Kind, a.Filename, a.ContentType, a.Size, a.Data, a.CreatedAt)
+	if err != nil {
+		return fmt.Errorf("Inserting book attachment: %w", err)
+	}
+
+	return nil
+}
+
+// GetAttachments lists the attachments of a book without their data.
+func (r *repository) GetAttachments(bookID string) ([]Attachment, error) {
+	rows, err := r.db.Query(`SELECT id, book_id, kind, filename, content_type, size, created_at
+		FROM book_attachment WHERE book_id = $1 ORDER BY created_at, id`, bookID)
+	if err != nil {
+		return nil, fmt.Errorf("Retrieving book attachments: %w", err)
+	}
+	defer rows.Close()
+
+	as := []Attachment{}
+	for rows.Next() {
+		a := Attachment{}
+		if err := rows.Scan(&a.ID, &a.BookID, &a.Kind, &a.Filename, &a.ContentType, &a.Size, &a.CreatedAt); err != nil {
+			return nil, fmt.Errorf("Scanning attachment rows: %w", err)
+		}
+		as = append(as, a)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("Iterating attachment rows: %w", err)
+	}
+
+	return as, nil
+}
+
+func (r *repository) getAttachment(q string, args ...interface{}) (*Attachment, error) {
+	a := &Attachment{}
+
+	err := r.db.QueryRow(`SELECT id, book_id, kind, filename, content_type, size, data, created_at
+		FROM book_attachment WHERE `+q, args...).
+		Scan(&a.ID, &a.BookID, &a.Kind, &a.Filename, &a.ContentType, &a.Size, &a.Data, &a.CreatedAt)
+
+	switch {
+	case err == sql.ErrNoRows:
+		return nil, ErrNoAttachment
+	case err != nil:
+		return nil, fmt.Errorf("Retrieving book attachment: %w", err)
+	}
+
+	return a, nil
+}
+
+func (r *repository) GetAttachment(bookID, attachmentID string) (*Attachment, error) {
+	return r.getAttachment("book_id = $1 AND id = $2", bookID, attachmentID)
+}
+
+// GetCover returns the most recent cover of a book.
+func (r *repository) GetCover(bookID string) (*Attachment, error) {
+	return r.getAttachment("book_id = $1 AND kind = $2 ORDER BY created_at DESC LIMIT 1", bookID, AttachmentCover)
+}
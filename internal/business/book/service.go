@@ -1,48 +1,138 @@
 package book
 
 import (
+	"bytes"
 	"errors"
+	"fmt"
+	"log"
 	"net/http"
+	"path"
 	"strconv"
 	"strings"
+	"time"
+	"unicode/utf8"
 
+	"github.com/axwilliams/book-api/internal/platform/auth"
+	"github.com/axwilliams/book-api/internal/platform/epub"
+	"github.com/axwilliams/book-api/internal/platform/marc"
+	"github.com/axwilliams/book-api/internal/platform/policy"
 	"github.com/axwilliams/book-api/internal/platform/web"
 	"github.com/google/uuid"
 )
 
 var (
-	ErrInvalidID   = errors.New("ID is not in the correct form")
-	ErrInvalidSort = errors.New("invalid sort field")
+	ErrInvalidID         = errors.New("ID is not in the correct form")
+	ErrInvalidSort       = errors.New("invalid sort field")
+	ErrInvalidStatus     = errors.New("invalid status")
+	ErrInvalidTransition = errors.New("Transition not allowed from the current status")
+	ErrCommentRequired   = errors.New("A comment is required when rejecting a book")
+	ErrInvalidTagMatch   = errors.New("tags_match must be any or all")
+	ErrNoSeriesFound     = errors.New("No series found")
+	ErrPositionNoSeries  = errors.New("series_position requires a series_id")
+	ErrInvalidRelation   = errors.New("invalid relation type")
+	ErrSelfRelation      = errors.New("A book cannot be related to itself")
+	ErrNoRelatedBook     = errors.New("No related book found")
+	ErrRelationExists    = errors.New("Relation already exists")
+	ErrSequelCycle       = errors.New("Relation would create a cycle in the sequel chain")
+	ErrInvalidScore      = errors.New("min_score must be a number between 0 and 1")
+	ErrMergeSelf         = errors.New("A book cannot be merged into itself")
+	ErrNoMergeSource     = errors.New("No book found to merge")
+	ErrIncompleteRecord  = errors.New("Record has no ISBN (020), title (245) or main author (100)")
+	ErrRecordNotSaved    = errors.New("Record could not be saved")
+	ErrInvalidFormat     = errors.New("format must be marc or marcxml")
+	ErrInvalidMARC       = errors.New("Unable to read MARC records")
+	ErrInvalidFacet      = errors.New("facet must be category or author")
+	ErrInvalidEPUB       = errors.New("Unable to read EPUB file")
+	ErrIncompleteEPUB    = errors.New("EPUB has no ISBN, title or author")
+	ErrAttachNoCreate    = errors.New("attach requires create")
+	ErrFilenameTooLong   = errors.New("Attachment filenames must be at most 255 characters")
 )
 
+// DefaultDuplicateScore is the lowest score reported as a probable duplicate
+// unless the caller asks for another threshold.
+const DefaultDuplicateScore = 0.75
+
 type Service interface {
-	GetAll() ([]Book, error)
+	GetAll(status string) ([]Book, error)
 	GetById(id string) (*Book, error)
 	Search(sp SearchParams, sort, order, limitStr, offsetStr string) ([]Book, error)
-	Create(nb *NewBook) (*Book, error)
-	Update(id string, ub UpdateBook) error
-	Destroy(id string) error
+	Create(nb *NewBook, sub policy.Subject) (*Book, error)
+	Update(id string, ub UpdateBook, sub policy.Subject) error
+	Destroy(id string, sub policy.Subject) error
+	Transition(id, action string, sub policy.Subject, comment string) error
+	History(id string) ([]Transition, error)
+	Relations(id, status string) ([]Relation, error)
+	Relate(id string, nr NewRelation, sub policy.Subject) (*Relation, error)
+	Unrelate(id, relationID string, sub policy.Subject) error
+	Duplicates(minScoreStr, limitStr string) ([]Duplicate, error)
+	Merge(id, sourceID string, sub policy.Subject) (*Merge, error)
+	Redirect(id string) (string, error)
+	Import(recs []*marc.Record, sub policy.Subject) (*ImportReport, error)
+	MARC(id string) (*Book, *marc.Record, error)
+	ExportMARC(status string) ([]*marc.Record, error)
+	Facets(field, status string) ([]Facet, error)
+	FromEPUB(raw []byte, filename string, create, attach bool, sub policy.Subject) (*EPUBImport, error)
+	Attachments(id string) (*Book, []Attachment, error)
+	Attachment(id, attachmentID string) (*Book, *Attachment, error)
+	Cover(id string) (*Book, *Attachment, error)
+}
+
+// workflow lists the statuses each action may be taken from and the status
+// it moves the book to.
+var workflow = map[string]struct {
+	from []string
+	to   string
+}{
+	ActionSubmit:  {from: []string{StatusDraft, StatusRejected}, to: StatusInReview},
+	ActionApprove: {from: []string{StatusInReview}, to: StatusPublished},
+	ActionReject:  {from: []string{StatusInReview}, to: StatusRejected},
 }
 
 type service struct {
 	br Repository
+	pe *policy.Engine
 }
 
-func NewService(br Repository) Service {
+// NewService returns a service that asks pe whether the callers of the
+// methods taking a policy.Subject may act on the book.
+func NewService(br Repository, pe *policy.Engine) Service {
 	return &service{
 		br,
+		pe,
 	}
 }
 
+const (
+	MatchAny = "any"
+	MatchAll = "all"
+)
+
 type SearchParams struct {
+	Query    string
 	ISBN     string
 	Title    string
 	Author   string
 	Category string
+	Status   string
+	SeriesID string
+	Tags     []string
+	TagMatch string
 }
 
-func (s *service) GetAll() ([]Book, error) {
-	return s.br.GetAll()
+func ValidStatus(status string) bool {
+	switch status {
+	case StatusDraft, StatusInReview, StatusPublished, StatusRejected:
+		return true
+	}
+	return false
+}
+
+func (s *service) GetAll(status string) ([]Book, error) {
+	if status != "" && !ValidStatus(status) {
+		return nil, web.NewRequestError(ErrInvalidStatus, http.StatusBadRequest)
+	}
+
+	return s.br.GetAll(status)
 }
 
 func (s *service) GetById(id string) (*Book, error) {
@@ -50,15 +140,47 @@ func (s *service) GetById(id string) (*Book, error) {
 		return nil, web.NewRequestError(ErrInvalidID, http.StatusBadRequest)
 	}
 
-	return s.br.GetById(id)
+	bk, err := s.br.GetById(id)
+	if err != nil {
+		return nil, err
+	}
+
+	next, err := s.br.NextInSeries(bk)
+	switch {
+	case err == nil:
+		bk.NextInSeries = next.ID
+	case err != ErrNoBookFound:
+		return nil, err
+	}
+
+	return bk, nil
 }
 
 func (s *service) Search(sp SearchParams, sort, order, limitStr, offsetStr string) ([]Book, error) {
+	if sp.Status != "" && !ValidStatus(sp.Status) {
+		return nil, web.NewRequestError(ErrInvalidStatus, http.StatusBadRequest)
+	}
+
+	if sp.SeriesID != "" {
+		if _, err := uuid.Parse(sp.SeriesID); err != nil {
+			return nil, web.NewRequestError(ErrInvalidID, http.StatusBadRequest)
+		}
+	}
+
+	switch sp.TagMatch {
+	case "":
+		sp.TagMatch = MatchAny
+	case MatchAny, MatchAll:
+	default:
+		return nil, web.NewRequestError(ErrInvalidTagMatch, http.StatusBadRequest)
+	}
+
 	sort = strings.ToLower(sort)
 	order = strings.ToLower(order)
 
 	sortOrder := ""
-	if sort == "id" || sort == "isbn" || sort == "title" || sort == "author" {
+	if sort == "id" || sort == "isbn" || sort == "title" || sort == "author" || sort == "created_at" || sort == "updated_at" ||
+		sort == "series_position" {
 		if order == "asc" || order == "desc" {
 			sortOrder = sort + " " + order
 		}
@@ -77,19 +199,69 @@ func (s *service) Search(sp SearchParams, sort, order, limitStr, offsetStr strin
 	return s.br.Search(sp, sortOrder, limit, offset)
 }
 
-func (s *service) Create(nb *NewBook) (*Book, error) {
+func (s *service) Create(nb *NewBook, sub policy.Subject) (*Book, error) {
+	return s.create(nb, sub, nil, nil)
+}
+
+// create adds a draft book together with its attachments and the MARC
+// record it was imported from, so that a book is not left behind when one
+// of them cannot be stored. The policies are checked against the book as it
+// would be created.
+func (s *service) create(nb *NewBook, sub policy.Subject, as []Attachment, raw []byte) (*Book, error) {
+	now := time.Now().UTC()
+
 	bk := &Book{
-		ID:       uuid.New().String(),
-		ISBN:     strings.TrimSpace(nb.ISBN),
-		Title:    strings.TrimSpace(nb.Title),
-		Author:   strings.TrimSpace(nb.Author),
-		Category: strings.TrimSpace(nb.Category),
+		ID:             uuid.New().String(),
+		ISBN:           strings.TrimSpace(nb.ISBN),
+		Title:          strings.TrimSpace(nb.Title),
+		Author:         strings.TrimSpace(nb.Author),
+		Category:       strings.TrimSpace(nb.Category),
+		Description:    strings.TrimSpace(nb.Description),
+		Status:         StatusDraft,
+		SeriesID:       strings.TrimSpace(nb.SeriesID),
+		SeriesPosition: nb.SeriesPosition,
+		CreatedAt:      now,
+		UpdatedAt:      now,
+	}
+
+	if err := s.validSeries(bk); err != nil {
+		return nil, err
+	}
+
+	if err := s.pe.Authorize(sub, ActionCreate, bk.Resource()); err != nil {
+		return nil, err
+	}
+
+	t := &Transition{
+		ID:        uuid.New().String(),
+		BookID:    bk.ID,
+		Action:    ActionCreate,
+		To:        StatusDraft,
+		ActorID:   sub.ID,
+		CreatedAt: now,
 	}
 
-	return bk, s.br.Create(bk)
+	for i := range as {
+		// Unnamed files are named after the book, e.g. <id>.epub.
+		if as[i].Filename == "" {
+			as[i].Filename = bk.ID + "." + as[i].Kind
+		}
+		as[i].ID = uuid.New().String()
+		as[i].BookID = bk.ID
+		as[i].CreatedAt = now
+	}
+
+	if err := s.br.Create(bk, t, as, raw); err != nil {
+		return nil, err
+	}
+
+	return bk, nil
 }
 
-func (s *service) Update(id string, ub UpdateBook) error {
+// Update checks the policies against the book as it is and as it would be,
+// so that a book can neither be edited nor moved out of reach of the policies.
+// A published book edited by someone who cannot review goes back to review.
+func (s *service) Update(id string, ub UpdateBook, sub policy.Subject) error {
 	if _, err := uuid.Parse(id); err != nil {
 		return web.NewRequestError(ErrInvalidID, http.StatusBadRequest)
 	}
@@ -102,6 +274,14 @@ func (s *service) Update(id string, ub UpdateBook) error {
 		return err
 	}
 
+	if sub, err = s.pe.Resolve(sub); err != nil {
+		return err
+	}
+
+	if err := s.pe.Authorize(sub, ActionUpdate, bk.Resource()); err != nil {
+		return err
+	}
+
 	if ub.ISBN != "" {
 		bk.ISBN = strings.TrimSpace(ub.ISBN)
 	}
@@ -114,14 +294,642 @@ func (s *service) Update(id string, ub UpdateBook) error {
 	if ub.Category != nil {
 		bk.Category = strings.TrimSpace(*ub.Category)
 	}
+	if ub.Description != nil {
+		bk.Description = strings.TrimSpace(*ub.Description)
+	}
+	if ub.SeriesID != nil {
+		bk.SeriesID = strings.TrimSpace(*ub.SeriesID)
+		if bk.SeriesID == "" {
+			bk.SeriesPosition = nil
+		}
+	}
+	if ub.SeriesPosition != nil {
+		bk.SeriesPosition = ub.SeriesPosition
+	}
+
+	if err := s.validSeries(bk); err != nil {
+		return err
+	}
+
+	if err := s.pe.Authorize(sub, ActionUpdate, bk.Resource()); err != nil {
+		return err
+	}
+
+	bk.UpdatedAt = time.Now().UTC()
+
+	var t *Transition
+	if bk.Status == StatusPublished && !auth.HasPermission(sub.Permissions, auth.PermBooksReview) {
+		t = &Transition{
+			ID:        uuid.New().String(),
+			BookID:    bk.ID,
+			Action:    ActionRevise,
+			From:      bk.Status,
+			To:        StatusInReview,
+			ActorID:   sub.ID,
+			CreatedAt: bk.UpdatedAt,
+		}
+		bk.Status = t.To
+	}
+
+	err = s.br.Update(bk, t)
+	if err == ErrInvalidTransition {
+		return web.NewRequestError(ErrInvalidTransition, http.StatusConflict)
+	}
+	return err
+}
+
+func (s *service) validSeries(bk *Book) error {
+	if bk.SeriesID == "" {
+		if bk.SeriesPosition != nil {
+			return web.NewRequestError(ErrPositionNoSeries, http.StatusUnprocessableEntity)
+		}
+		return nil
+	}
+
+	if _, err := uuid.Parse(bk.SeriesID); err != nil {
+		return web.NewRequestError(ErrInvalidID, http.StatusBadRequest)
+	}
+
+	if !s.br.SeriesExists(bk.SeriesID) {
+		return web.NewRequestError(ErrNoSeriesFound, http.StatusUnprocessableEntity)
+	}
 
-	return s.br.Update(bk)
+	return nil
 }
 
-func (s *service) Destroy(id string) error {
+func (s *service) Destroy(id string, sub policy.Subject) error {
 	if _, err := uuid.Parse(id); err != nil {
 		return web.NewRequestError(ErrInvalidID, http.StatusBadRequest)
 	}
 
+	bk, err := s.br.GetById(id)
+	switch {
+	case err == ErrNoBookFound:
+		return web.NewRequestError(ErrNoAffect, http.StatusGone)
+	case err != nil:
+		return err
+	}
+
+	if err := s.pe.Authorize(sub, ActionDelete, bk.Resource()); err != nil {
+		return err
+	}
+
 	return s.br.Destroy(id)
 }
+
+func (s *service) Transition(id, action string, sub policy.Subject, comment string) error {
+	if _, err := uuid.Parse(id); err != nil {
+		return web.NewRequestError(ErrInvalidID, http.StatusBadRequest)
+	}
+
+	step, ok := workflow[action]
+	if !ok {
+		return web.NewRequestError(ErrInvalidTransition, http.StatusBadRequest)
+	}
+
+	comment = strings.TrimSpace(comment)
+	if action == ActionReject && comment == "" {
+		return web.NewRequestError(ErrCommentRequired, http.StatusUnprocessableEntity)
+	}
+
+	bk, err := s.br.GetById(id)
+	switch {
+	case err == ErrNoBookFound:
+		return web.NewRequestError(ErrNoAffect, http.StatusGone)
+	case err != nil:
+		return err
+	}
+
+	allowed := false
+	for _, from := range step.from {
+		if bk.Status == from {
+			allowed = true
+			break
+		}
+	}
+	if !allowed {
+		return web.NewRequestError(ErrInvalidTransition, http.StatusConflict)
+	}
+
+	if err := s.pe.Authorize(sub, action, bk.Resource()); err != nil {
+		return err
+	}
+
+	t := &Transition{
+		ID:        uuid.New().String(),
+		BookID:    bk.ID,
+		Action:    action,
+		From:      bk.Status,
+		To:        step.to,
+		ActorID:   sub.ID,
+		Comment:   comment,
+		CreatedAt: time.Now().UTC(),
+	}
+
+	bk.Status = step.to
+	bk.UpdatedAt = t.CreatedAt
+
+	err = s.br.UpdateStatus(bk, t)
+	if err == ErrInvalidTransition {
+		return web.NewRequestError(ErrInvalidTransition, http.StatusConflict)
+	}
+	return err
+}
+
+func (s *service) History(id string) ([]Transition, error) {
+	if _, err := uuid.Parse(id); err != nil {
+		return nil, web.NewRequestError(ErrInvalidID, http.StatusBadRequest)
+	}
+
+	return s.br.GetTransitions(id)
+}
+
+// ValidRelation reports whether t is a relation type or the inverse of one.
+func ValidRelation(t string) bool {
+	for stored, inverse := range relationInverses {
+		if t == stored || t == inverse {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *service) Relations(id, status string) ([]Relation, error) {
+	if _, err := uuid.Parse(id); err != nil {
+		return nil, web.NewRequestError(ErrInvalidID, http.StatusBadRequest)
+	}
+
+	return s.br.GetRelations(id, status)
+}
+
+// Relate links book id to another book. Inverse types are accepted and
+// stored from the other book, so that each link is only kept once. As the
+// link shows on both books, the policies must allow updating both.
+func (s *service) Relate(id string, nr NewRelation, sub policy.Subject) (*Relation, error) {
+	relatedID := strings.TrimSpace(nr.BookID)
+
+	for _, v := range []string{id, relatedID} {
+		if _, err := uuid.Parse(v); err != nil {
+			return nil, web.NewRequestError(ErrInvalidID, http.StatusBadRequest)
+		}
+	}
+
+	typ := strings.ToLower(strings.TrimSpace(nr.Type))
+	if !ValidRelation(typ) {
+		return nil, web.NewRequestError(ErrInvalidRelation, http.StatusBadRequest)
+	}
+
+	if id == relatedID {
+		return nil, web.NewRequestError(ErrSelfRelation, http.StatusUnprocessableEntity)
+	}
+
+	bk, err := s.br.GetById(id)
+	switch {
+	case err == ErrNoBookFound:
+		return nil, web.NewRequestError(ErrNoAffect, http.StatusGone)
+	case err != nil:
+		return nil, err
+	}
+
+	related, err := s.br.GetById(relatedID)
+	switch {
+	case err == ErrNoBookFound:
+		return nil, web.NewRequestError(ErrNoRelatedBook, http.StatusUnprocessableEntity)
+	case err != nil:
+		return nil, err
+	}
+
+	if sub, err = s.pe.Resolve(sub); err != nil {
+		return nil, err
+	}
+
+	for _, b := range []*Book{bk, related} {
+		if err := s.pe.Authorize(sub, ActionUpdate, b.Resource()); err != nil {
+			return nil, err
+		}
+	}
+
+	from, to, stored := bk.ID, related.ID, typ
+	if _, ok := relationInverses[typ]; !ok {
+		for k, v := range relationInverses {
+			if v == typ {
+				stored = k
+			}
+		}
+		from, to = to, from
+	}
+
+	exists, err := s.br.RelationExists(from, stored, to)
+	if err != nil {
+		return nil, err
+	}
+	if exists {
+		return nil, web.NewRequestError(ErrRelationExists, http.StatusConflict)
+	}
+
+	if stored == RelationSequelOf {
+		cycle, err := s.br.InSequelChain(to, from)
+		if err != nil {
+			return nil, err
+		}
+		if cycle {
+			return nil, web.NewRequestError(ErrSequelCycle, http.StatusUnprocessableEntity)
+		}
+	}
+
+	rl := &Relation{
+		ID:     uuid.New().String(),
+		Type:   stored,
+		BookID: to,
+	}
+
+	if err := s.br.AddRelation(from, rl); err != nil {
+		return nil, err
+	}
+
+	return &Relation{ID: rl.ID, Type: typ, BookID: related.ID}, nil
+}
+
+// Unrelate removes a link of book id, when the policies allow updating the
+// books on both sides of it.
+func (s *service) Unrelate(id, relationID string, sub policy.Subject) error {
+	for _, v := range []string{id, relationID} {
+		if _, err := uuid.Parse(v); err != nil {
+			return web.NewRequestError(ErrInvalidID, http.StatusBadRequest)
+		}
+	}
+
+	bk, err := s.br.GetById(id)
+	switch {
+	case err == ErrNoBookFound:
+		return web.NewRequestError(ErrNoAffect, http.StatusGone)
+	case err != nil:
+		return err
+	}
+
+	rls, err := s.br.GetRelations(id, "")
+	if err != nil {
+		return err
+	}
+
+	if sub, err = s.pe.Resolve(sub); err != nil {
+		return err
+	}
+
+	for _, rl := range rls {
+		if rl.ID != relationID {
+			continue
+		}
+		for _, b := range []*Book{bk, rl.Book} {
+			if err := s.pe.Authorize(sub, ActionUpdate, b.Resource()); err != nil {
+				return err
+			}
+		}
+		return s.br.RemoveRelation(id, relationID)
+	}
+
+	return web.NewRequestError(ErrNoAffect, http.StatusGone)
+}
+
+func (s *service) Duplicates(minScoreStr, limitStr string) ([]Duplicate, error) {
+	minScore := DefaultDuplicateScore
+	if minScoreStr != "" {
+		v, err := strconv.ParseFloat(minScoreStr, 64)
+		if err != nil || v <= 0 || v > 1 {
+			return nil, web.NewRequestError(ErrInvalidScore, http.StatusBadRequest)
+		}
+		minScore = v
+	}
+
+	limit, err := strconv.Atoi(limitStr)
+	if err != nil {
+		limit = 0
+	}
+
+	bks, err := s.br.GetAll("")
+	if err != nil {
+		return nil, err
+	}
+
+	dups := FindDuplicates(bks, minScore)
+	if limit > 0 && len(dups) > limit {
+		dups = dups[:limit]
+	}
+
+	return dups, nil
+}
+
+// Merge folds the source book into book id and deletes the source. Requests
+// for the source ID are redirected to id afterwards. The policies must allow
+// merging into the target and deleting the source.
+func (s *service) Merge(id, sourceID string, sub policy.Subject) (*Merge, error) {
+	sourceID = strings.TrimSpace(sourceID)
+
+	for _, v := range []string{id, sourceID} {
+		if _, err := uuid.Parse(v); err != nil {
+			return nil, web.NewRequestError(ErrInvalidID, http.StatusBadRequest)
+		}
+	}
+
+	if id == sourceID {
+		return nil, web.NewRequestError(ErrMergeSelf, http.StatusUnprocessableEntity)
+	}
+
+	target, err := s.br.GetById(id)
+	switch {
+	case err == ErrNoBookFound:
+		return nil, web.NewRequestError(ErrNoAffect, http.StatusGone)
+	case err != nil:
+		return nil, err
+	}
+
+	source, err := s.br.GetById(sourceID)
+	switch {
+	case err == ErrNoBookFound:
+		return nil, web.NewRequestError(ErrNoMergeSource, http.StatusUnprocessableEntity)
+	case err != nil:
+		return nil, err
+	}
+
+	if sub, err = s.pe.Resolve(sub); err != nil {
+		return nil, err
+	}
+
+	if err := s.pe.Authorize(sub, ActionMerge, target.Resource()); err != nil {
+		return nil, err
+	}
+	if err := s.pe.Authorize(sub, ActionDelete, source.Resource()); err != nil {
+		return nil, err
+	}
+
+	m := &Merge{
+		ID:        uuid.New().String(),
+		SourceID:  source.ID,
+		TargetID:  target.ID,
+		ActorID:   sub.ID,
+		Source:    *source,
+		CreatedAt: time.Now().UTC(),
+	}
+
+	t := &Transition{
+		ID:        uuid.New().String(),
+		BookID:    target.ID,
+		Action:    ActionMerge,
+		From:      target.Status,
+		To:        target.Status,
+		ActorID:   sub.ID,
+		Comment:   "Merged " + source.ID + " (" + source.Title + ")",
+		CreatedAt: m.CreatedAt,
+	}
+
+	if err := s.br.Merge(m, t); err != nil {
+		return nil, err
+	}
+
+	return m, nil
+}
+
+func (s *service) Redirect(id string) (string, error) {
+	if _, err := uuid.Parse(id); err != nil {
+		return "", web.NewRequestError(ErrInvalidID, http.StatusBadRequest)
+	}
+
+	return s.br.Redirect(id)
+}
+
+// Import creates a draft book for every record and keeps the record so that
+// fields the book does not map are exported again. Records that cannot be
+// mapped are reported and skipped.
+func (s *service) Import(recs []*marc.Record, sub policy.Subject) (*ImportReport, error) {
+	sub, err := s.pe.Resolve(sub)
+	if err != nil {
+		return nil, err
+	}
+
+	rep := &ImportReport{Imported: []string{}, Failed: []ImportError{}}
+
+	for i, rec := range recs {
+		nb := FromMARC(rec)
+		if nb.ISBN == "" || nb.Title == "" || nb.Author == "" {
+			rep.Failed = append(rep.Failed, ImportError{Record: i + 1, Message: ErrIncompleteRecord.Error()})
+			continue
+		}
+
+		raw, err := marc.Encode(rec)
+		if err != nil {
+			rep.Failed = append(rep.Failed, ImportError{Record: i + 1, Message: err.Error()})
+			continue
+		}
+
+		bk, err := s.create(nb, sub, nil, raw)
+		if err != nil {
+			msg := ErrRecordNotSaved.Error()
+			if re, ok := err.(*web.RequestError); ok {
+				msg = re.Err.Error()
+			} else {
+				log.Printf("[book] Importing record %d: %v", i+1, err)
+			}
+			rep.Failed = append(rep.Failed, ImportError{Record: i + 1, Message: msg})
+			continue
+		}
+
+		rep.Imported = append(rep.Imported, bk.ID)
+	}
+
+	return rep, nil
+}
+
+func (s *service) MARC(id string) (*Book, *marc.Record, error) {
+	if _, err := uuid.Parse(id); err != nil {
+		return nil, nil, web.NewRequestError(ErrInvalidID, http.StatusBadRequest)
+	}
+
+	bk, err := s.br.GetById(id)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	raw, err := s.br.GetMARC(id)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	rec, err := rawRecord(raw)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return bk, ToMARC(bk, rec), nil
+}
+
+func (s *service) ExportMARC(status string) ([]*marc.Record, error) {
+	if status != "" && !ValidStatus(status) {
+		return nil, web.NewRequestError(ErrInvalidStatus, http.StatusBadRequest)
+	}
+
+	bks, err := s.br.GetAll(status)
+	if err != nil {
+		return nil, err
+	}
+
+	raws, err := s.br.GetAllMARC(status)
+	if err != nil {
+		return nil, err
+	}
+
+	recs := make([]*marc.Record, 0, len(bks))
+	for i := range bks {
+		rec, err := rawRecord(raws[bks[i].ID])
+		if err != nil {
+			return nil, err
+		}
+		recs = append(recs, ToMARC(&bks[i], rec))
+	}
+
+	return recs, nil
+}
+
+func rawRecord(raw []byte) (*marc.Record, error) {
+	if raw == nil {
+		return nil, nil
+	}
+
+	rec, err := marc.Decode(raw)
+	if err != nil {
+		return nil, fmt.Errorf("Decoding stored MARC record: %w", err)
+	}
+
+	return rec, nil
+}
+
+func (s *service) Facets(field, status string) ([]Facet, error) {
+	if field != FacetCategory && field != FacetAuthor {
+		return nil, web.NewRequestError(ErrInvalidFacet, http.StatusBadRequest)
+	}
+
+	if status != "" && !ValidStatus(status) {
+		return nil, web.NewRequestError(ErrInvalidStatus, http.StatusBadRequest)
+	}
+
+	return s.br.Facets(field, status)
+}
+
+// FromEPUB reads the metadata of an EPUB. Unless create is set it only
+// returns the book for confirmation; otherwise the book is created as a
+// draft with the EPUB's cover, and with the EPUB itself when attach is set.
+func (s *service) FromEPUB(raw []byte, filename string, create, attach bool, sub policy.Subject) (*EPUBImport, error) {
+	if attach && !create {
+		return nil, web.NewRequestError(ErrAttachNoCreate, http.StatusBadRequest)
+	}
+
+	p, err := epub.Read(bytes.NewReader(raw), int64(len(raw)))
+	if err != nil {
+		return nil, web.NewRequestError(ErrInvalidEPUB, http.StatusBadRequest)
+	}
+
+	imp := FromEPUB(p)
+	if !create {
+		return imp, nil
+	}
+
+	if imp.Book.ISBN == "" || imp.Book.Title == "" || imp.Book.Author == "" {
+		return nil, web.NewRequestError(ErrIncompleteEPUB, http.StatusUnprocessableEntity)
+	}
+
+	as := []Attachment{}
+
+	// Covers of other types are dropped rather than served as images.
+	if p.Cover != nil && coverTypes[p.Cover.MediaType] {
+		as = append(as, Attachment{
+			Kind:        AttachmentCover,
+			Filename:    path.Base(p.Cover.Href),
+			ContentType: p.Cover.MediaType,
+			Size:        len(p.Cover.Data),
+			Data:        p.Cover.Data,
+		})
+	}
+
+	if attach {
+		if filename != "" {
+			filename = path.Base(filename)
+		}
+
+		as = append(as, Attachment{
+			Kind:        AttachmentEPUB,
+			Filename:    filename,
+			ContentType: epub.ContentType,
+			Size:        len(raw),
+			Data:        raw,
+		})
+	}
+
+	for _, a := range as {
+		if utf8.RuneCountInString(a.Filename) > maxFilename {
+			return nil, web.NewRequestError(ErrFilenameTooLong, http.StatusUnprocessableEntity)
+		}
+	}
+
+	bk, err := s.create(&imp.Book, sub, as, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	imp.Created = bk
+
+	return imp, nil
+}
+
+func (s *service) Attachments(id string) (*Book, []Attachment, error) {
+	if _, err := uuid.Parse(id); err != nil {
+		return nil, nil, web.NewRequestError(ErrInvalidID, http.StatusBadRequest)
+	}
+
+	bk, err := s.br.GetById(id)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	as, err := s.br.GetAttachments(id)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return bk, as, nil
+}
+
+func (s *service) Attachment(id, attachmentID string) (*Book, *Attachment, error) {
+	if _, err := uuid.Parse(attachmentID); err != nil {
+		return nil, nil, web.NewRequestError(ErrInvalidID, http.StatusBadRequest)
+	}
+
+	return s.attachment(id, func() (*Attachment, error) {
+		return s.br.GetAttachment(id, attachmentID)
+	})
+}
+
+func (s *service) Cover(id string) (*Book, *Attachment, error) {
+	return s.attachment(id, func() (*Attachment, error) {
+		return s.br.GetCover(id)
+	})
+}
+
+func (s *service) attachment(id string, get func() (*Attachment, error)) (*Book, *Attachment, error) {
+	if _, err := uuid.Parse(id); err != nil {
+		return nil, nil, web.NewRequestError(ErrInvalidID, http.StatusBadRequest)
+	}
+
+	bk, err := s.br.GetById(id)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	a, err := get()
+	if err == ErrNoAttachment {
+		return nil, nil, web.NewRequestError(ErrNoAttachment, http.StatusNotFound)
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return bk, a, nil
+}
@@ -5,18 +5,24 @@ import (
 	"os"
 	"reflect"
 	"testing"
+	"time"
 
 	"github.com/axwilliams/book-api/internal/business/book"
+	"github.com/axwilliams/book-api/internal/platform/auth"
+	"github.com/axwilliams/book-api/internal/platform/policy"
 	"github.com/axwilliams/book-api/internal/test"
 )
 
-var bookService book.Service
+var (
+	bookRepository book.Repository
+	bookService    book.Service
+)
 
 func TestMain(m *testing.M) {
 	db, container := test.Setup()
 
-	bookRepository := book.NewRepository(db)
-	bookService = book.NewService(bookRepository)
+	bookRepository = book.NewRepository(db)
+	bookService = book.NewService(bookRepository, policy.NewEngine(""))
 
 	e := m.Run()
 
@@ -24,6 +30,15 @@ func TestMain(m *testing.M) {
 	os.Exit(e)
 }
 
+// clearTimestamps zeroes the timestamps set by the database so results can be
+// compared with fixtures.
+func clearTimestamps(bks ...*book.Book) {
+	for _, bk := range bks {
+		bk.CreatedAt = time.Time{}
+		bk.UpdatedAt = time.Time{}
+	}
+}
+
 func TestGetById(t *testing.T) {
 	bk := &book.Book{
 		ID:       "f4ac7e14-fc8e-4096-b956-34e5a33040f2",
@@ -31,6 +46,7 @@ func TestGetById(t *testing.T) {
 		Title:    "The Castle",
 		Author:   "Franz Kafka",
 		Category: "Fiction",
+		Status:   book.StatusPublished,
 	}
 
 	res, err := bookService.GetById(bk.ID)
@@ -38,6 +54,8 @@ func TestGetById(t *testing.T) {
 		t.Fatal(err)
 	}
 
+	clearTimestamps(res)
+
 	if ok := reflect.DeepEqual(res, bk); !ok {
 		t.Fatalf("\t%s\tError finding book: want %v got %v", test.Failed, bk, res)
 	}
@@ -70,8 +88,13 @@ func TestSearch(t *testing.T) {
 		Title:    "The Castle",
 		Author:   "Franz Kafka",
 		Category: "Fiction",
+		Status:   book.StatusPublished,
 	})
 
+	for i := range res {
+		clearTimestamps(&res[i])
+	}
+
 	if ok := reflect.DeepEqual(res, expected); !ok {
 		t.Fatalf("\t%s\tError searching books: want %v got %v", test.Failed, expected, res)
 	}
@@ -86,7 +109,7 @@ func TestCreate(t *testing.T) {
 		Category: "Fiction",
 	}
 
-	bk, err := bookService.Create(nb)
+	bk, err := bookService.Create(nb, policy.Subject{ID: "69a47775-6d89-4d38-ad38-acdb2928f6a1"})
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -102,8 +125,11 @@ func TestCreate(t *testing.T) {
 		Title:    "The Wind-Up Bird Chronicle",
 		Author:   "Haruki Murakami",
 		Category: "Fiction",
+		Status:   book.StatusDraft,
 	}
 
+	clearTimestamps(res)
+
 	if ok := reflect.DeepEqual(expected, res); !ok {
 		t.Fatalf("\t%s\tError creating book: want %v got %v", test.Failed, expected, res)
 	}
@@ -121,7 +147,9 @@ func TestUpdate(t *testing.T) {
 		Category: &c,
 	}
 
-	if err := bookService.Update(ID, ub); err != nil {
+	reviewer := policy.Subject{Permissions: []string{auth.PermBooksReview}}
+
+	if err := bookService.Update(ID, ub, reviewer); err != nil {
 		t.Fatal(err)
 	}
 
@@ -136,8 +164,11 @@ func TestUpdate(t *testing.T) {
 		Title:    "Six Not-So-Easy Pieces",
 		Author:   "Richard Feynman",
 		Category: "Physics",
+		Status:   book.StatusPublished,
 	}
 
+	clearTimestamps(res)
+
 	if ok := reflect.DeepEqual(expected, res); !ok {
 		t.Fatalf("\t%s\tError updating book: want %v got %v", test.Failed, expected, res)
 	}
@@ -147,7 +178,7 @@ func TestUpdate(t *testing.T) {
 func TestDestroy(t *testing.T) {
 	ID := "71432eb9-58da-4eae-aa20-ccc49064246f"
 
-	if err := bookService.Destroy(ID); err != nil {
+	if err := bookService.Destroy(ID, policy.Subject{}); err != nil {
 		t.Fatal(err)
 	}
 
@@ -156,3 +187,312 @@ func TestDestroy(t *testing.T) {
 	}
 	t.Logf("\t%s\tBook destroyed", test.Success)
 }
+
+func TestTransition(t *testing.T) {
+	nb := &book.NewBook{
+		ISBN:     "978-0141182803",
+		Title:    "Nineteen Eighty-Four",
+		Author:   "George Orwell",
+		Category: "Fiction",
+	}
+
+	authorID := "69a47775-6d89-4d38-ad38-acdb2928f6a1"
+	adminID := "a72bec75-0a5f-49af-a844-5763d188788e"
+
+	bk, err := bookService.Create(nb, policy.Subject{ID: authorID})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := bookService.Transition(bk.ID, book.ActionApprove, policy.Subject{ID: adminID}, ""); err == nil {
+		t.Fatalf("\t%s\tApproved a book that was not in review", test.Failed)
+	}
+	t.Logf("\t%s\tDraft approval refused", test.Success)
+
+	steps := []struct {
+		action  string
+		actorID string
+		comment string
+		status  string
+	}{
+		{book.ActionSubmit, authorID, "", book.StatusInReview},
+		{book.ActionReject, adminID, "Needs a category", book.StatusRejected},
+		{book.ActionSubmit, authorID, "", book.StatusInReview},
+		{book.ActionApprove, adminID, "", book.StatusPublished},
+	}
+
+	for _, step := range steps {
+		if err := bookService.Transition(bk.ID, step.action, policy.Subject{ID: step.actorID}, step.comment); err != nil {
+			t.Fatal(err)
+		}
+
+		res, err := bookService.GetById(bk.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if res.Status != step.status {
+			t.Fatalf("\t%s\tWrong status after %s: want %v got %v", test.Failed, step.action, step.status, res.Status)
+		}
+		t.Logf("\t%s\tBook moved to %s", test.Success, step.status)
+	}
+
+	ts, err := bookService.History(bk.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(ts) != len(steps)+1 {
+		t.Fatalf("\t%s\tWrong number of transitions: want %v got %v", test.Failed, len(steps)+1, len(ts))
+	}
+
+	if ts[2].ActorID != adminID || ts[2].Comment != "Needs a category" {
+		t.Fatalf("\t%s\tRejection not recorded: got %+v", test.Failed, ts[2])
+	}
+	t.Logf("\t%s\tTransitions recorded", test.Success)
+
+	stale := &book.Transition{ID: "0b8f6c2e-4d1a-4e3b-9c5d-7a6f8e9d0c1b", BookID: bk.ID, Action: book.ActionApprove,
+		From: book.StatusInReview, To: book.StatusPublished, ActorID: adminID, CreatedAt: time.Now().UTC()}
+	if err := bookRepository.UpdateStatus(bk, stale); err != book.ErrInvalidTransition {
+		t.Fatalf("\t%s\tStale transition applied: %v", test.Failed, err)
+	}
+	t.Logf("\t%s\tStale transition refused", test.Success)
+
+	d := "Revised edition"
+	if err := bookService.Update(bk.ID, book.UpdateBook{Description: &d}, policy.Subject{ID: authorID}); err != nil {
+		t.Fatal(err)
+	}
+
+	res, err := bookService.GetById(bk.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if res.Status != book.StatusInReview {
+		t.Fatalf("\t%s\tPublished book edited without review: status %v", test.Failed, res.Status)
+	}
+	t.Logf("\t%s\tEdited book back in review", test.Success)
+}
+
+func TestRelations(t *testing.T) {
+	titles := []string{"Dune", "Dune Messiah", "Children of Dune"}
+
+	ids := make([]string, 0, len(titles))
+	for _, title := range titles {
+		bk, err := bookService.Create(&book.NewBook{ISBN: "978-0441172719", Title: title, Author: "Frank Herbert"}, policy.Subject{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		ids = append(ids, bk.ID)
+	}
+
+	if _, err := bookService.Relate(ids[1], book.NewRelation{Type: book.RelationSequelOf, BookID: ids[0]}, policy.Subject{}); err != nil {
+		t.Fatal(err)
+	}
+
+	// Stored from the later book as sequel_of.
+	if _, err := bookService.Relate(ids[1], book.NewRelation{Type: book.RelationPrequelOf, BookID: ids[2]}, policy.Subject{}); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := bookService.Relate(ids[0], book.NewRelation{Type: book.RelationSequelOf, BookID: ids[2]}, policy.Subject{}); err == nil {
+		t.Fatalf("\t%s\tSequel cycle accepted", test.Failed)
+	}
+	t.Logf("\t%s\tSequel cycle refused", test.Success)
+
+	rls, err := bookService.Relations(ids[1], "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	types := map[string]string{}
+	for _, rl := range rls {
+		types[rl.BookID] = rl.Type
+	}
+
+	if types[ids[0]] != book.RelationSequelOf || types[ids[2]] != book.RelationPrequelOf {
+		t.Fatalf("\t%s\tWrong relations: got %+v", test.Failed, types)
+	}
+	t.Logf("\t%s\tRelations read in both directions", test.Success)
+
+	if err := bookService.Unrelate(ids[1], rls[0].ID, policy.Subject{}); err != nil {
+		t.Fatal(err)
+	}
+
+	rls, err = bookService.Relations(ids[1], "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(rls) != 1 {
+		t.Fatalf("\t%s\tWrong number of relations: want 1 got %v", test.Failed, len(rls))
+	}
+	t.Logf("\t%s\tRelation removed", test.Success)
+}
+
+func TestMerge(t *testing.T) {
+	ids := []string{}
+	for _, title := range []string{"Brave New World", "Brave new world", "Island"} {
+		bk, err := bookService.Create(&book.NewBook{ISBN: "978-0099518471", Title: title, Author: "Aldous Huxley"}, policy.Subject{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		ids = append(ids, bk.ID)
+	}
+
+	if _, err := bookService.Relate(ids[1], book.NewRelation{Type: book.RelationCompanionTo, BookID: ids[2]}, policy.Subject{}); err != nil {
+		t.Fatal(err)
+	}
+
+	dups, err := bookService.Duplicates("", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	found := false
+	for _, d := range dups {
+		if d.BookID == ids[0] && d.DuplicateID == ids[1] {
+			found = true
+		}
+	}
+	if !found {
+		t.Fatalf("\t%s\tDuplicate not detected: got %+v", test.Failed, dups)
+	}
+	t.Logf("\t%s\tDuplicate detected", test.Success)
+
+	if _, err := bookService.Merge(ids[0], ids[1], policy.Subject{ID: "a72bec75-0a5f-49af-a844-5763d188788e"}); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := bookService.GetById(ids[1]); err != book.ErrNoBookFound {
+		t.Fatalf("\t%s\tMerged book still exists: %v", test.Failed, err)
+	}
+
+	to, err := bookService.Redirect(ids[1])
+	if err != nil || to != ids[0] {
+		t.Fatalf("\t%s\tWrong redirect: want %v got %v (%v)", test.Failed, ids[0], to, err)
+	}
+	t.Logf("\t%s\tMerged book redirects to the survivor", test.Success)
+
+	rls, err := bookService.Relations(ids[0], "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(rls) != 1 || rls[0].BookID != ids[2] {
+		t.Fatalf("\t%s\tRelation not moved: got %+v", test.Failed, rls)
+	}
+	t.Logf("\t%s\tRelations moved to the survivor", test.Success)
+
+	ts, err := bookService.History(ids[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if ts[len(ts)-1].Action != book.ActionMerge {
+		t.Fatalf("\t%s\tMerge not in history: got %+v", test.Failed, ts)
+	}
+	t.Logf("\t%s\tMerge recorded in history", test.Success)
+}
+
+func TestHarvest(t *testing.T) {
+	h := book.Harvest{Status: book.StatusPublished}
+
+	first, err := bookRepository.Harvest(h, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(first) != 1 {
+		t.Fatalf("\t%s\tWrong page size: want 1 got %d", test.Failed, len(first))
+	}
+	t.Logf("\t%s\tFirst page harvested", test.Success)
+
+	h.AfterTime, h.AfterID = first[0].UpdatedAt, first[0].ID
+
+	rest, err := bookRepository.Harvest(h, 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, bk := range rest {
+		if bk.ID == first[0].ID {
+			t.Fatalf("\t%s\tResumed harvest repeated %s", test.Failed, bk.ID)
+		}
+		if bk.UpdatedAt.Before(first[0].UpdatedAt) {
+			t.Fatalf("\t%s\tResumed harvest went back in time: %v before %v", test.Failed, bk.UpdatedAt, first[0].UpdatedAt)
+		}
+	}
+	t.Logf("\t%s\tHarvest resumed after the first page", test.Success)
+
+	h = book.Harvest{Status: book.StatusPublished, From: time.Now().Add(time.Hour)}
+
+	none, err := bookRepository.Harvest(h, 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(none) != 0 {
+		t.Fatalf("\t%s\tBooks updated in the future: %v", test.Failed, none)
+	}
+	t.Logf("\t%s\tDate range applied", test.Success)
+}
+
+func TestGetByISBN(t *testing.T) {
+	samples := []struct {
+		isbn  string
+		found bool
+	}{
+		{"9780241372579", true},
+		{"0241372577", true},
+		{"978-0-241-37257-9", true},
+		{"9780000000002", false},
+		{"not an isbn", false},
+	}
+
+	for _, sample := range samples {
+		bk, err := bookRepository.GetByISBN(sample.isbn)
+		if sample.found && (err != nil || bk.Title != "The Castle") {
+			t.Fatalf("\t%s\tBook not found by %s: %v", test.Failed, sample.isbn, err)
+		}
+		if !sample.found && err != book.ErrNoBookFound {
+			t.Fatalf("\t%s\tWrong result for %s: %v %v", test.Failed, sample.isbn, bk, err)
+		}
+	}
+	t.Logf("\t%s\tBooks matched by either ISBN form", test.Success)
+}
+
+func TestMergeSequelCycle(t *testing.T) {
+	ids := []string{}
+	for _, title := range []string{"Foundation", "Foundation and Empire", "Foundation (1951)"} {
+		bk, err := bookService.Create(&book.NewBook{ISBN: "978-0553293357", Title: title, Author: "Isaac Asimov"}, policy.Subject{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		ids = append(ids, bk.ID)
+	}
+
+	if _, err := bookService.Relate(ids[1], book.NewRelation{Type: book.RelationSequelOf, BookID: ids[0]}, policy.Subject{}); err != nil {
+		t.Fatal(err)
+	}
+
+	// Once the duplicate is folded into the first book this would read as
+	// the first book being a sequel of its own sequel.
+	if _, err := bookService.Relate(ids[2], book.NewRelation{Type: book.RelationSequelOf, BookID: ids[1]}, policy.Subject{}); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := bookService.Merge(ids[0], ids[2], policy.Subject{}); err != nil {
+		t.Fatal(err)
+	}
+
+	rls, err := bookService.Relations(ids[0], "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(rls) != 1 || rls[0].BookID != ids[1] || rls[0].Type != book.RelationPrequelOf {
+		t.Fatalf("\t%s\tWrong relations after merge: got %+v", test.Failed, rls)
+	}
+	t.Logf("\t%s\tSequel relation that would loop dropped", test.Success)
+}
@@ -0,0 +1,122 @@
+package citation
+
+import (
+	"regexp"
+	"strings"
+)
+
+const (
+	StyleAPA     = "apa"
+	StyleMLA     = "mla"
+	StyleChicago = "chicago"
+)
+
+const (
+	FormatBibTeX  = "bibtex"
+	FormatRIS     = "ris"
+	FormatCSLJSON = "csljson"
+)
+
+const (
+	ContentTypeText    = "text/plain; charset=utf-8"
+	ContentTypeHTML    = "text/html; charset=utf-8"
+	ContentTypeBibTeX  = "application/x-bibtex; charset=utf-8"
+	ContentTypeRIS     = "application/x-research-info-systems"
+	ContentTypeCSLJSON = "application/vnd.citationstyles.csl+json"
+)
+
+// Citation is a rendered citation or bibliography, ready to be written out.
+type Citation struct {
+	ContentType string
+	Body        []byte
+}
+
+// Request selects either a citation style or a machine readable format. HTML
+// only applies to styles.
+type Request struct {
+	Style  string
+	Format string
+	HTML   bool
+}
+
+type NewBibliography struct {
+	IDs    []string `json:"ids" validate:"required"`
+	Style  string   `json:"style"`
+	Format string   `json:"format"`
+}
+
+// Name is one author, split into the parts citation styles order
+// differently. A name without a given part, such as an organisation, only
+// has Family.
+type Name struct {
+	Family string `json:"family,omitempty"`
+	Given  string `json:"given,omitempty"`
+}
+
+var authorSeparator = regexp.MustCompile(`\s*(?:;|&|\band\b)\s*`)
+
+// Authors splits the author field of a book into names. Authors are
+// separated by semicolons, "and" or "&", and each may be written either
+// "Given Family" or "Family, Given".
+func Authors(author string) []Name {
+	names := []Name{}
+
+	for _, part := range authorSeparator.Split(author, -1) {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+
+		if i := strings.Index(part, ","); i > 0 {
+			names = append(names, Name{
+				Family: strings.TrimSpace(part[:i]),
+				Given:  strings.TrimSpace(part[i+1:]),
+			})
+			continue
+		}
+
+		words := strings.Fields(part)
+		names = append(names, Name{
+			Family: words[len(words)-1],
+			Given:  strings.Join(words[:len(words)-1], " "),
+		})
+	}
+
+	return names
+}
+
+// Inverted is "Family, Given", used for the first author in most styles.
+func (n Name) Inverted() string {
+	if n.Given == "" {
+		return n.Family
+	}
+	return n.Family + ", " + n.Given
+}
+
+// Direct is "Given Family".
+func (n Name) Direct() string {
+	if n.Given == "" {
+		return n.Family
+	}
+	return n.Given + " " + n.Family
+}
+
+// Initials is "Family, G. M." as APA writes authors.
+func (n Name) Initials() string {
+	if n.Given == "" {
+		return n.Family
+	}
+
+	initials := []string{}
+	for _, g := range strings.Fields(n.Given) {
+		parts := []string{}
+		for _, p := range strings.Split(g, "-") {
+			if r := []rune(p); len(r) > 0 {
+				parts = append(parts, string(r[0])+".")
+			}
+		}
+		initials = append(initials, strings.Join(parts, "-"))
+	}
+
+	return n.Family + ", " + strings.Join(initials, " ")
+}
@@ -0,0 +1,331 @@
+package citation
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"html"
+	"sort"
+	"strings"
+	"unicode"
+
+	"github.com/axwilliams/book-api/internal/business/book"
+)
+
+// noDate stands in for the publication year, which the catalog does not
+// record yet.
+const noDate = "n.d."
+
+// Render cites bks in the requested style or format. Styles are sorted into
+// a bibliography; machine formats keep the given order.
+func Render(bks []book.Book, req Request) (*Citation, error) {
+	switch req.Format {
+	case FormatBibTeX:
+		return &Citation{ContentType: ContentTypeBibTeX, Body: bibtex(bks)}, nil
+	case FormatRIS:
+		return &Citation{ContentType: ContentTypeRIS, Body: ris(bks)}, nil
+	case FormatCSLJSON:
+		body, err := cslJSON(bks)
+		if err != nil {
+			return nil, err
+		}
+		return &Citation{ContentType: ContentTypeCSLJSON, Body: body}, nil
+	}
+
+	var cite func(authors []Name, title string, f formatter) string
+	switch req.Style {
+	case StyleAPA:
+		cite = apa
+	case StyleMLA:
+		cite = mla
+	case StyleChicago:
+		cite = chicago
+	default:
+		return nil, ErrInvalidStyle
+	}
+
+	sorted := make([]book.Book, len(bks))
+	copy(sorted, bks)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return sortKey(sorted[i]) < sortKey(sorted[j])
+	})
+
+	f := formatter{req.HTML}
+
+	entries := make([]string, 0, len(sorted))
+	for _, bk := range sorted {
+		entries = append(entries, cite(Authors(bk.Author), bk.Title, f))
+	}
+
+	if !req.HTML {
+		return &Citation{ContentType: ContentTypeText, Body: []byte(strings.Join(entries, "\n") + "\n")}, nil
+	}
+
+	var buf bytes.Buffer
+	buf.WriteString(`<div class="csl-bib-body">` + "\n")
+	for _, e := range entries {
+		buf.WriteString(`  <div class="csl-entry">` + e + "</div>\n")
+	}
+	buf.WriteString("</div>\n")
+
+	return &Citation{ContentType: ContentTypeHTML, Body: buf.Bytes()}, nil
+}
+
+func sortKey(bk book.Book) string {
+	key := bk.Title
+	if names := Authors(bk.Author); len(names) > 0 {
+		key = names[0].Inverted() + " " + bk.Title
+	}
+	return strings.ToLower(key)
+}
+
+// formatter escapes text and italicizes titles for HTML output.
+type formatter struct {
+	html bool
+}
+
+func (f formatter) text(s string) string {
+	if f.html {
+		return html.EscapeString(s)
+	}
+	return s
+}
+
+func (f formatter) title(s string) string {
+	if f.html {
+		return "<i>" + html.EscapeString(s) + "</i>"
+	}
+	return s
+}
+
+// period ends s with a full stop unless it already ends in punctuation.
+func period(s string) string {
+	if s == "" || strings.ContainsAny(s[len(s)-1:], ".?!") {
+		return s
+	}
+	return s + "."
+}
+
+// apa: Family, G., & Family, G. (n.d.). Title.
+func apa(authors []Name, title string, f formatter) string {
+	names := make([]string, 0, len(authors))
+	for _, n := range authors {
+		names = append(names, n.Initials())
+	}
+
+	by := ""
+	switch len(names) {
+	case 0:
+	case 1:
+		by = names[0]
+	case 2:
+		by = names[0] + ", & " + names[1]
+	default:
+		if len(names) > 20 {
+			names = append(names[:19], "... "+names[len(names)-1])
+			by = strings.Join(names, ", ")
+		} else {
+			by = strings.Join(names[:len(names)-1], ", ") + ", & " + names[len(names)-1]
+		}
+	}
+
+	if by == "" {
+		return f.title(period(title)) + " (" + noDate + ")."
+	}
+
+	return f.text(period(by)) + " (" + noDate + "). " + f.title(period(title))
+}
+
+// mla: Family, Given, and Given Family. Title.
+func mla(authors []Name, title string, f formatter) string {
+	by := ""
+	switch len(authors) {
+	case 0:
+	case 1:
+		by = authors[0].Inverted()
+	case 2:
+		by = authors[0].Inverted() + ", and " + authors[1].Direct()
+	default:
+		by = authors[0].Inverted() + ", et al"
+	}
+
+	if by == "" {
+		return f.title(period(title))
+	}
+
+	return f.text(period(by)) + " " + f.title(period(title))
+}
+
+// chicago: Family, Given, Given Family, and Given Family. Title. n.d.
+func chicago(authors []Name, title string, f formatter) string {
+	names := make([]string, 0, len(authors))
+	for i, n := range authors {
+		if i == 0 {
+			names = append(names, n.Inverted())
+		} else {
+			names = append(names, n.Direct())
+		}
+	}
+
+	by := ""
+	switch len(names) {
+	case 0:
+	case 1:
+		by = names[0]
+	case 2:
+		by = names[0] + ", and " + names[1]
+	default:
+		if len(names) > 10 {
+			names = append(names[:7], "et al")
+			by = strings.Join(names, ", ")
+		} else {
+			by = strings.Join(names[:len(names)-1], ", ") + ", and " + names[len(names)-1]
+		}
+	}
+
+	if by == "" {
+		return f.title(period(title)) + " " + noDate
+	}
+
+	return f.text(period(by)) + " " + f.title(period(title)) + " " + noDate
+}
+
+var bibtexEscaper = strings.NewReplacer(
+	`\`, `\textbackslash{}`, "{", `\{`, "}", `\}`, "&", `\&`, "%", `\%`,
+	"$", `\$`, "#", `\#`, "_", `\_`, "~", `\textasciitilde{}`, "^", `\textasciicircum{}`,
+)
+
+// bibtexKey is the first author's family name and the first significant
+// word of the title, e.g. kafka_castle. Duplicates get a number suffix.
+func bibtexKey(bk book.Book, used map[string]bool) string {
+	clean := func(s string) string {
+		return strings.Map(func(r rune) rune {
+			if r < unicode.MaxASCII && (unicode.IsLetter(r) || unicode.IsDigit(r)) {
+				return unicode.ToLower(r)
+			}
+			return -1
+		}, s)
+	}
+
+	family := "anon"
+	if names := Authors(bk.Author); len(names) > 0 {
+		if c := clean(names[0].Family); c != "" {
+			family = c
+		}
+	}
+
+	word := ""
+	for _, w := range strings.Fields(bk.Title) {
+		lw := strings.ToLower(w)
+		if lw == "a" || lw == "an" || lw == "the" {
+			continue
+		}
+		if word = clean(w); word != "" {
+			break
+		}
+	}
+
+	key := family
+	if word != "" {
+		key += "_" + word
+	}
+
+	base := key
+	for i := 2; used[key]; i++ {
+		key = fmt.Sprintf("%s%d", base, i)
+	}
+	used[key] = true
+
+	return key
+}
+
+func bibtex(bks []book.Book) []byte {
+	var buf bytes.Buffer
+	used := map[string]bool{}
+
+	for i, bk := range bks {
+		if i > 0 {
+			buf.WriteString("\n")
+		}
+
+		authors := []string{}
+		for _, n := range Authors(bk.Author) {
+			authors = append(authors, n.Inverted())
+		}
+
+		fmt.Fprintf(&buf, "@book{%s,\n", bibtexKey(bk, used))
+		fields := [][2]string{
+			{"author", strings.Join(authors, " and ")},
+			{"title", bk.Title},
+			{"isbn", bk.ISBN},
+			{"keywords", bk.Category},
+			{"abstract", bk.Description},
+		}
+		for _, fl := range fields {
+			if fl[1] == "" {
+				continue
+			}
+			fmt.Fprintf(&buf, "  %s = {%s},\n", fl[0], bibtexEscaper.Replace(fl[1]))
+		}
+		buf.WriteString("}\n")
+	}
+
+	return buf.Bytes()
+}
+
+func ris(bks []book.Book) []byte {
+	var buf bytes.Buffer
+
+	line := func(tag, value string) {
+		if value != "" {
+			fmt.Fprintf(&buf, "%s  - %s\r\n", tag, strings.ReplaceAll(value, "\n", " "))
+		}
+	}
+
+	for _, bk := range bks {
+		buf.WriteString("TY  - BOOK\r\n")
+		line("ID", bk.ID)
+		for _, n := range Authors(bk.Author) {
+			line("AU", n.Inverted())
+		}
+		line("TI", bk.Title)
+		line("SN", bk.ISBN)
+		line("KW", bk.Category)
+		line("AB", bk.Description)
+		buf.WriteString("ER  - \r\n")
+	}
+
+	return buf.Bytes()
+}
+
+type cslItem struct {
+	ID       string `json:"id"`
+	Type     string `json:"type"`
+	Title    string `json:"title"`
+	Author   []Name `json:"author,omitempty"`
+	ISBN     string `json:"ISBN,omitempty"`
+	Genre    string `json:"genre,omitempty"`
+	Abstract string `json:"abstract,omitempty"`
+}
+
+func cslJSON(bks []book.Book) ([]byte, error) {
+	items := make([]cslItem, 0, len(bks))
+	for _, bk := range bks {
+		items = append(items, cslItem{
+			ID:       bk.ID,
+			Type:     "book",
+			Title:    bk.Title,
+			Author:   Authors(bk.Author),
+			ISBN:     bk.ISBN,
+			Genre:    bk.Category,
+			Abstract: bk.Description,
+		})
+	}
+
+	body, err := json.MarshalIndent(items, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("Encoding CSL-JSON: %w", err)
+	}
+
+	return append(body, '\n'), nil
+}
@@ -0,0 +1,148 @@
+package citation_test
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	"github.com/axwilliams/book-api/internal/business/book"
+	"github.com/axwilliams/book-api/internal/business/citation"
+	"github.com/axwilliams/book-api/internal/test"
+)
+
+var books = []book.Book{
+	{
+		ID:       "f4ac7e14-fc8e-4096-b956-34e5a33040f2",
+		ISBN:     "978-0241372579",
+		Title:    "The Castle",
+		Author:   "Franz Kafka",
+		Category: "Fiction",
+	},
+	{
+		ID:     "562e1fe0-0dde-4717-a008-cd2a699301d2",
+		ISBN:   "978-0465025275",
+		Title:  "Six Easy Pieces",
+		Author: "Feynman, Richard P.; Robert B. Leighton & Matthew Sands",
+	},
+	{
+		ID:     "9e8d7c6b-5a49-4382-9170-6e5d4c3b2a19",
+		ISBN:   "978-0262510875",
+		Title:  "Structure & Interpretation of Computer Programs",
+		Author: "Harold Abelson and Gerald Jay Sussman",
+	},
+}
+
+func TestAuthors(t *testing.T) {
+	samples := []struct {
+		author   string
+		expected []citation.Name
+	}{
+		{"Franz Kafka", []citation.Name{{Family: "Kafka", Given: "Franz"}}},
+		{"Kafka, Franz", []citation.Name{{Family: "Kafka", Given: "Franz"}}},
+		{"Harold Abelson and Gerald Jay Sussman", []citation.Name{{Family: "Abelson", Given: "Harold"}, {Family: "Sussman", Given: "Gerald Jay"}}},
+		{"Plato", []citation.Name{{Family: "Plato"}}},
+	}
+
+	for _, sample := range samples {
+		if res := citation.Authors(sample.author); !reflect.DeepEqual(res, sample.expected) {
+			t.Fatalf("\t%s\tWrong names for %q: want %+v got %+v", test.Failed, sample.author, sample.expected, res)
+		}
+		t.Logf("\t%s\tSplit %q", test.Success, sample.author)
+	}
+}
+
+func TestStyles(t *testing.T) {
+	samples := []struct {
+		req      citation.Request
+		expected string
+	}{
+		{
+			req: citation.Request{Style: citation.StyleAPA},
+			expected: "Abelson, H., & Sussman, G. J. (n.d.). Structure & Interpretation of Computer Programs.\n" +
+				"Feynman, R. P., Leighton, R. B., & Sands, M. (n.d.). Six Easy Pieces.\n" +
+				"Kafka, F. (n.d.). The Castle.\n",
+		},
+		{
+			req: citation.Request{Style: citation.StyleMLA},
+			expected: "Abelson, Harold, and Gerald Jay Sussman. Structure & Interpretation of Computer Programs.\n" +
+				"Feynman, Richard P., et al. Six Easy Pieces.\n" +
+				"Kafka, Franz. The Castle.\n",
+		},
+		{
+			req: citation.Request{Style: citation.StyleChicago},
+			expected: "Abelson, Harold, and Gerald Jay Sussman. Structure & Interpretation of Computer Programs. n.d.\n" +
+				"Feynman, Richard P., Robert B. Leighton, and Matthew Sands. Six Easy Pieces. n.d.\n" +
+				"Kafka, Franz. The Castle. n.d.\n",
+		},
+		{
+			req: citation.Request{Style: citation.StyleMLA, HTML: true},
+			expected: "<div class=\"csl-bib-body\">\n" +
+				"  <div class=\"csl-entry\">Abelson, Harold, and Gerald Jay Sussman. <i>Structure &amp; Interpretation of Computer Programs.</i></div>\n" +
+				"  <div class=\"csl-entry\">Feynman, Richard P., et al. <i>Six Easy Pieces.</i></div>\n" +
+				"  <div class=\"csl-entry\">Kafka, Franz. <i>The Castle.</i></div>\n" +
+				"</div>\n",
+		},
+	}
+
+	for _, sample := range samples {
+		c, err := citation.Render(books, sample.req)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if string(c.Body) != sample.expected {
+			t.Fatalf("\t%s\tWrong %s bibliography:\nwant\n%s\ngot\n%s", test.Failed, sample.req.Style, sample.expected, c.Body)
+		}
+		t.Logf("\t%s\t%s bibliography rendered", test.Success, sample.req.Style)
+	}
+}
+
+func TestFormats(t *testing.T) {
+	c, err := citation.Render(books[:1], citation.Request{Format: citation.FormatBibTeX})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := "@book{kafka_castle,\n  author = {Kafka, Franz},\n  title = {The Castle},\n  isbn = {978-0241372579},\n  keywords = {Fiction},\n}\n"
+	if string(c.Body) != expected {
+		t.Fatalf("\t%s\tWrong BibTeX:\nwant\n%s\ngot\n%s", test.Failed, expected, c.Body)
+	}
+	t.Logf("\t%s\tBibTeX rendered", test.Success)
+
+	c, err = citation.Render(books[2:], citation.Request{Format: citation.FormatBibTeX})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected = "@book{abelson_structure,\n  author = {Abelson, Harold and Sussman, Gerald Jay},\n  title = {Structure \\& Interpretation of Computer Programs},\n  isbn = {978-0262510875},\n}\n"
+	if string(c.Body) != expected {
+		t.Fatalf("\t%s\tWrong BibTeX:\nwant\n%s\ngot\n%s", test.Failed, expected, c.Body)
+	}
+	t.Logf("\t%s\tBibTeX escaped", test.Success)
+
+	c, err = citation.Render(books[:1], citation.Request{Format: citation.FormatRIS})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected = "TY  - BOOK\r\nID  - f4ac7e14-fc8e-4096-b956-34e5a33040f2\r\nAU  - Kafka, Franz\r\nTI  - The Castle\r\nSN  - 978-0241372579\r\nKW  - Fiction\r\nER  - \r\n"
+	if string(c.Body) != expected {
+		t.Fatalf("\t%s\tWrong RIS:\nwant\n%q\ngot\n%q", test.Failed, expected, c.Body)
+	}
+	t.Logf("\t%s\tRIS rendered", test.Success)
+
+	c, err = citation.Render(books[1:2], citation.Request{Format: citation.FormatCSLJSON})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var items []map[string]interface{}
+	if err := json.Unmarshal(c.Body, &items); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(items) != 1 || items[0]["type"] != "book" || len(items[0]["author"].([]interface{})) != 3 {
+		t.Fatalf("\t%s\tWrong CSL-JSON: got %s", test.Failed, c.Body)
+	}
+	t.Logf("\t%s\tCSL-JSON rendered", test.Success)
+}
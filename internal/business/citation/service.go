@@ -0,0 +1,132 @@
+package citation
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/axwilliams/book-api/internal/business/book"
+	"github.com/axwilliams/book-api/internal/platform/web"
+	"github.com/google/uuid"
+)
+
+// MaxBibliography caps the number of books in one batch request.
+const MaxBibliography = 500
+
+var (
+	ErrInvalidStyle  = errors.New("style must be apa, mla or chicago")
+	ErrInvalidFormat = errors.New("format must be bibtex, ris or csljson")
+	ErrStyleOrFormat = errors.New("Use either style or format, not both")
+	ErrNoBooks       = errors.New("At least one book ID is required")
+	ErrTooManyBooks  = errors.New("Too many books for one bibliography")
+	ErrUnknownBooks  = errors.New("Some books were not found")
+)
+
+type Service interface {
+	Cite(id string, req Request, status string) (*Citation, error)
+	Bibliography(ids []string, req Request, status string) (*Citation, error)
+}
+
+type service struct {
+	br book.Repository
+}
+
+func NewService(br book.Repository) Service {
+	return &service{
+		br,
+	}
+}
+
+// validRequest normalizes req, defaulting to APA when neither a style nor a
+// format is given.
+func validRequest(req *Request) error {
+	req.Style = strings.ToLower(strings.TrimSpace(req.Style))
+	req.Format = strings.ToLower(strings.TrimSpace(req.Format))
+
+	switch {
+	case req.Style != "" && req.Format != "":
+		return web.NewRequestError(ErrStyleOrFormat, http.StatusBadRequest)
+	case req.Format != "":
+		switch req.Format {
+		case FormatBibTeX, FormatRIS, FormatCSLJSON:
+			return nil
+		}
+		return web.NewRequestError(ErrInvalidFormat, http.StatusBadRequest)
+	case req.Style == "":
+		req.Style = StyleAPA
+	}
+
+	switch req.Style {
+	case StyleAPA, StyleMLA, StyleChicago:
+		return nil
+	}
+	return web.NewRequestError(ErrInvalidStyle, http.StatusBadRequest)
+}
+
+func (s *service) Cite(id string, req Request, status string) (*Citation, error) {
+	if err := validRequest(&req); err != nil {
+		return nil, err
+	}
+
+	if _, err := uuid.Parse(id); err != nil {
+		return nil, web.NewRequestError(book.ErrInvalidID, http.StatusBadRequest)
+	}
+
+	bk, err := s.br.GetById(id)
+	if err == nil && status != "" && bk.Status != status {
+		err = book.ErrNoBookFound
+	}
+	switch {
+	case err == book.ErrNoBookFound:
+		return nil, web.NewRequestError(book.ErrNoBookFound, http.StatusNotFound)
+	case err != nil:
+		return nil, err
+	}
+
+	return Render([]book.Book{*bk}, req)
+}
+
+// Bibliography cites every book in ids. Unknown IDs, and books hidden by
+// status, fail the whole request rather than silently leaving entries out.
+func (s *service) Bibliography(ids []string, req Request, status string) (*Citation, error) {
+	if err := validRequest(&req); err != nil {
+		return nil, err
+	}
+
+	switch {
+	case len(ids) == 0:
+		return nil, web.NewRequestError(ErrNoBooks, http.StatusUnprocessableEntity)
+	case len(ids) > MaxBibliography:
+		return nil, web.NewRequestError(ErrTooManyBooks, http.StatusUnprocessableEntity)
+	}
+
+	seen := map[string]bool{}
+	bks := make([]book.Book, 0, len(ids))
+
+	for _, id := range ids {
+		id = strings.TrimSpace(id)
+		if seen[id] {
+			continue
+		}
+		seen[id] = true
+
+		if _, err := uuid.Parse(id); err != nil {
+			return nil, web.NewRequestError(book.ErrInvalidID, http.StatusBadRequest)
+		}
+
+		bk, err := s.br.GetById(id)
+		if err == nil && status != "" && bk.Status != status {
+			err = book.ErrNoBookFound
+		}
+		switch {
+		case err == book.ErrNoBookFound:
+			return nil, web.NewRequestError(ErrUnknownBooks, http.StatusUnprocessableEntity)
+		case err != nil:
+			return nil, err
+		}
+
+		bks = append(bks, *bk)
+	}
+
+	return Render(bks, req)
+}
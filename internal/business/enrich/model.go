@@ -0,0 +1,46 @@
+package enrich
+
+const (
+	FieldTitle       = "title"
+	FieldAuthor      = "author"
+	FieldCategory    = "category"
+	FieldDescription = "description"
+)
+
+// Fields lists the book fields a provider can suggest values for, in the
+// order suggestions are shown.
+var Fields = []string{FieldTitle, FieldAuthor, FieldCategory, FieldDescription}
+
+// Metadata is what a provider knows about an edition.
+type Metadata struct {
+	ISBN        string   `json:"isbn"`
+	Title       string   `json:"title"`
+	Authors     []string `json:"authors,omitempty"`
+	Subjects    []string `json:"subjects,omitempty"`
+	Description string   `json:"description,omitempty"`
+	Publisher   string   `json:"publisher,omitempty"`
+	PublishDate string   `json:"publish_date,omitempty"`
+}
+
+// Suggestion is a fetched value that differs from the book's current one.
+type Suggestion struct {
+	Field     string `json:"field"`
+	Current   string `json:"current"`
+	Suggested string `json:"suggested"`
+}
+
+// Enrichment lists the suggestions for a book and the fields that were
+// accepted. Error is set when the lookup failed while creating a book, which
+// does not stop the book from being created.
+type Enrichment struct {
+	BookID      string       `json:"book_id,omitempty"`
+	ISBN        string       `json:"isbn"`
+	Provider    string       `json:"provider"`
+	Suggestions []Suggestion `json:"suggestions"`
+	Applied     []string     `json:"applied"`
+	Error       string       `json:"error,omitempty"`
+}
+
+type Accept struct {
+	Fields []string `json:"accept"`
+}
@@ -0,0 +1,109 @@
+package enrich
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// DefaultOpenLibraryURL is the public Open Library instance.
+const DefaultOpenLibraryURL = "https://openlibrary.org"
+
+type openLibrary struct {
+	baseURL string
+	client  *http.Client
+}
+
+// NewOpenLibrary reads the books API of an Open Library instance at baseURL.
+func NewOpenLibrary(baseURL string, timeout time.Duration) MetadataProvider {
+	return &openLibrary{
+		baseURL: strings.TrimRight(baseURL, "/"),
+		client:  &http.Client{Timeout: timeout},
+	}
+}
+
+func (ol *openLibrary) Name() string {
+	return "openlibrary"
+}
+
+// olText is a field that Open Library returns either as a plain string or
+// as {"type": "/type/text", "value": "..."}.
+type olText string
+
+func (t *olText) UnmarshalJSON(b []byte) error {
+	var s string
+	if err := json.Unmarshal(b, &s); err == nil {
+		*t = olText(s)
+		return nil
+	}
+
+	var v struct {
+		Value string `json:"value"`
+	}
+	if err := json.Unmarshal(b, &v); err != nil {
+		return err
+	}
+	*t = olText(v.Value)
+	return nil
+}
+
+type olEdition struct {
+	Details struct {
+		Title       string   `json:"title"`
+		Authors     []olName `json:"authors"`
+		Subjects    []string `json:"subjects"`
+		Description olText   `json:"description"`
+		Publishers  []string `json:"publishers"`
+		PublishDate string   `json:"publish_date"`
+	} `json:"details"`
+}
+
+type olName struct {
+	Name string `json:"name"`
+}
+
+func (ol *openLibrary) Lookup(isbn string) (*Metadata, error) {
+	key := "ISBN:" + isbn
+	q := url.Values{"bibkeys": {key}, "format": {"json"}, "jscmd": {"details"}}
+
+	res, err := ol.client.Get(ol.baseURL + "/api/books?" + q.Encode())
+	if err != nil {
+		return nil, fmt.Errorf("Querying Open Library: %w", err)
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("Querying Open Library: unexpected status %s", res.Status)
+	}
+
+	editions := map[string]olEdition{}
+	if err := json.NewDecoder(res.Body).Decode(&editions); err != nil {
+		return nil, fmt.Errorf("Decoding Open Library response: %w", err)
+	}
+
+	ed, ok := editions[key]
+	if !ok {
+		return nil, ErrNotFound
+	}
+
+	d := ed.Details
+	md := &Metadata{
+		ISBN:        isbn,
+		Title:       d.Title,
+		Subjects:    d.Subjects,
+		Description: strings.TrimSpace(string(d.Description)),
+		PublishDate: d.PublishDate,
+	}
+
+	for _, a := range d.Authors {
+		md.Authors = append(md.Authors, a.Name)
+	}
+	if len(d.Publishers) > 0 {
+		md.Publisher = d.Publishers[0]
+	}
+
+	return md, nil
+}
@@ -0,0 +1,75 @@
+package enrich_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/axwilliams/book-api/internal/business/enrich"
+	"github.com/axwilliams/book-api/internal/test"
+)
+
+const openLibraryResponse = `{"ISBN:9780241372579": {
+	"bib_key": "ISBN:9780241372579",
+	"details": {
+		"title": "The Castle",
+		"authors": [{"key": "/authors/OL22258A", "name": "Franz Kafka"}],
+		"subjects": ["Fiction"],
+		"description": {"type": "/type/text", "value": "A land surveyor arrives in a village."},
+		"publishers": ["Penguin Classics"],
+		"publish_date": "2019"
+	}
+}}`
+
+func TestOpenLibrary(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		if r.URL.Path != "/api/books" || q.Get("jscmd") != "details" || q.Get("format") != "json" {
+			http.Error(w, "bad request", http.StatusBadRequest)
+			return
+		}
+
+		switch q.Get("bibkeys") {
+		case "ISBN:9780241372579":
+			w.Write([]byte(openLibraryResponse))
+		case "ISBN:9781451673319":
+			w.Write([]byte(`{}`))
+		default:
+			http.Error(w, "unavailable", http.StatusServiceUnavailable)
+		}
+	}))
+	defer srv.Close()
+
+	ol := enrich.NewOpenLibrary(srv.URL+"/", time.Second)
+
+	md, err := ol.Lookup("9780241372579")
+	if err != nil {
+		t.Fatalf("\t%s\tLookup failed: %v", test.Failed, err)
+	}
+
+	expected := &enrich.Metadata{
+		ISBN:        "9780241372579",
+		Title:       "The Castle",
+		Authors:     []string{"Franz Kafka"},
+		Subjects:    []string{"Fiction"},
+		Description: "A land surveyor arrives in a village.",
+		Publisher:   "Penguin Classics",
+		PublishDate: "2019",
+	}
+	if !reflect.DeepEqual(md, expected) {
+		t.Fatalf("\t%s\tWrong metadata: want %+v got %+v", test.Failed, expected, md)
+	}
+	t.Logf("\t%s\tEdition details mapped", test.Success)
+
+	if _, err := ol.Lookup("9781451673319"); err != enrich.ErrNotFound {
+		t.Fatalf("\t%s\tWrong error for an unknown ISBN: %v", test.Failed, err)
+	}
+	t.Logf("\t%s\tUnknown ISBN not found", test.Success)
+
+	if _, err := ol.Lookup("9780465025275"); err == nil || err == enrich.ErrNotFound {
+		t.Fatalf("\t%s\tA server error should be returned: %v", test.Failed, err)
+	}
+	t.Logf("\t%s\tServer error returned", test.Success)
+}
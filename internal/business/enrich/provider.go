@@ -0,0 +1,149 @@
+package enrich
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"sync"
+	"time"
+
+	"github.com/axwilliams/book-api/internal/business/book"
+)
+
+var ErrNotFound = errors.New("No metadata found for this ISBN")
+
+// MetadataProvider looks editions up by ISBN. Lookup gets a normalized
+// ISBN-13 and returns ErrNotFound when the provider has no record of it.
+type MetadataProvider interface {
+	Name() string
+	Lookup(isbn string) (*Metadata, error)
+}
+
+type cacheEntry struct {
+	md      *Metadata
+	expires time.Time
+}
+
+// cache remembers lookups, including misses, for ttl. Failures are not
+// cached so that a provider outage does not outlive itself.
+type cache struct {
+	p    MetadataProvider
+	ttl  time.Duration
+	size int
+
+	mu      sync.Mutex
+	entries map[string]cacheEntry
+}
+
+// NewCache wraps p with an in-memory cache of at most size ISBNs. When it is
+// full, expired entries are dropped first and then the one closest to
+// expiring.
+func NewCache(p MetadataProvider, ttl time.Duration, size int) MetadataProvider {
+	return &cache{
+		p:       p,
+		ttl:     ttl,
+		size:    size,
+		entries: map[string]cacheEntry{},
+	}
+}
+
+func (c *cache) Name() string {
+	return c.p.Name()
+}
+
+func (c *cache) Lookup(isbn string) (*Metadata, error) {
+	now := time.Now()
+
+	c.mu.Lock()
+	e, ok := c.entries[isbn]
+	c.mu.Unlock()
+
+	if ok && now.Before(e.expires) {
+		if e.md == nil {
+			return nil, ErrNotFound
+		}
+		md := *e.md
+		return &md, nil
+	}
+
+	md, err := c.p.Lookup(isbn)
+	if err != nil && err != ErrNotFound {
+		return nil, err
+	}
+
+	c.mu.Lock()
+	c.evict(now)
+	c.entries[isbn] = cacheEntry{md: md, expires: now.Add(c.ttl)}
+	c.mu.Unlock()
+
+	if md == nil {
+		return nil, ErrNotFound
+	}
+
+	cp := *md
+	return &cp, nil
+}
+
+// evict makes room for one more entry. The caller holds the lock.
+func (c *cache) evict(now time.Time) {
+	if len(c.entries) < c.size {
+		return
+	}
+
+	oldest := ""
+	for isbn, e := range c.entries {
+		if now.After(e.expires) {
+			delete(c.entries, isbn)
+			continue
+		}
+		if oldest == "" || e.expires.Before(c.entries[oldest].expires) {
+			oldest = isbn
+		}
+	}
+
+	if len(c.entries) >= c.size && oldest != "" {
+		delete(c.entries, oldest)
+	}
+}
+
+type fixtures struct {
+	records map[string]Metadata
+}
+
+// NewFixtureProvider serves the given records, keyed by any form of their
+// ISBN. It stands in for a remote provider in tests and offline setups.
+func NewFixtureProvider(records []Metadata) MetadataProvider {
+	f := &fixtures{records: map[string]Metadata{}}
+	for _, md := range records {
+		f.records[book.NormalizeISBN(md.ISBN)] = md
+	}
+	return f
+}
+
+// LoadFixtures reads a JSON array of metadata records from a file.
+func LoadFixtures(path string) (MetadataProvider, error) {
+	raw, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("Reading metadata fixtures: %w", err)
+	}
+
+	records := []Metadata{}
+	if err := json.Unmarshal(raw, &records); err != nil {
+		return nil, fmt.Errorf("Decoding metadata fixtures: %w", err)
+	}
+
+	return NewFixtureProvider(records), nil
+}
+
+func (f *fixtures) Name() string {
+	return "fixtures"
+}
+
+func (f *fixtures) Lookup(isbn string) (*Metadata, error) {
+	md, ok := f.records[book.NormalizeISBN(isbn)]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return &md, nil
+}
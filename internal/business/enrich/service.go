@@ -0,0 +1,212 @@
+package enrich
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/axwilliams/book-api/internal/business/book"
+	"github.com/axwilliams/book-api/internal/platform/policy"
+	"github.com/axwilliams/book-api/internal/platform/web"
+)
+
+var (
+	ErrDisabled     = errors.New("Metadata enrichment is disabled")
+	ErrNoISBN       = errors.New("Book has no valid ISBN to look up")
+	ErrInvalidField = errors.New("accept may only list title, author, category and description")
+	ErrProvider     = errors.New("Metadata provider is unavailable")
+)
+
+type Service interface {
+	Enrich(id string, accept []string, sub policy.Subject) (*Enrichment, error)
+	Create(nb *book.NewBook, sub policy.Subject) (*book.Book, *Enrichment, error)
+}
+
+type service struct {
+	bs book.Service
+	p  MetadataProvider
+}
+
+// NewService enriches books from p. A nil provider disables enrichment.
+func NewService(bs book.Service, p MetadataProvider) Service {
+	return &service{
+		bs,
+		p,
+	}
+}
+
+// values maps metadata onto book fields the way the other imports do:
+// authors are joined with semicolons and the first subject is the category.
+func values(md *Metadata) map[string]string {
+	v := map[string]string{
+		FieldTitle:       strings.TrimSpace(md.Title),
+		FieldAuthor:      strings.Join(md.Authors, "; "),
+		FieldDescription: book.PlainText(md.Description),
+	}
+	if len(md.Subjects) > 0 {
+		v[FieldCategory] = strings.TrimSpace(md.Subjects[0])
+	}
+	return v
+}
+
+func current(bk *book.Book) map[string]string {
+	return map[string]string{
+		FieldTitle:       bk.Title,
+		FieldAuthor:      bk.Author,
+		FieldCategory:    bk.Category,
+		FieldDescription: bk.Description,
+	}
+}
+
+// suggest lists the fetched values that are set and differ from the current
+// ones, leaving out the fields in skip.
+func suggest(cur, fetched map[string]string, skip map[string]bool) []Suggestion {
+	ss := []Suggestion{}
+	for _, f := range Fields {
+		if fetched[f] != "" && fetched[f] != cur[f] && !skip[f] {
+			ss = append(ss, Suggestion{Field: f, Current: cur[f], Suggested: fetched[f]})
+		}
+	}
+	return ss
+}
+
+func (s *service) lookup(isbn string) (*Metadata, error) {
+	if s.p == nil {
+		return nil, web.NewRequestError(ErrDisabled, http.StatusServiceUnavailable)
+	}
+
+	normalized := book.NormalizeISBN(isbn)
+	if normalized == "" {
+		return nil, web.NewRequestError(ErrNoISBN, http.StatusUnprocessableEntity)
+	}
+
+	md, err := s.p.Lookup(normalized)
+	switch {
+	case err == ErrNotFound:
+		return nil, web.NewRequestError(ErrNotFound, http.StatusNotFound)
+	case err != nil:
+		return nil, web.NewRequestError(fmt.Errorf("%w: %v", ErrProvider, err), http.StatusBadGateway)
+	}
+
+	return md, nil
+}
+
+// Enrich looks the book up and applies the accepted fields. Without any
+// accepted fields it only lists the suggestions.
+func (s *service) Enrich(id string, accept []string, sub policy.Subject) (*Enrichment, error) {
+	accepted := map[string]bool{}
+	for _, f := range accept {
+		f = strings.ToLower(strings.TrimSpace(f))
+		if !validField(f) {
+			return nil, web.NewRequestError(ErrInvalidField, http.StatusBadRequest)
+		}
+		accepted[f] = true
+	}
+
+	bk, err := s.bs.GetById(id)
+	switch {
+	case err == book.ErrNoBookFound:
+		return nil, web.NewRequestError(book.ErrNoBookFound, http.StatusNotFound)
+	case err != nil:
+		return nil, err
+	}
+
+	md, err := s.lookup(bk.ISBN)
+	if err != nil {
+		return nil, err
+	}
+
+	fetched := values(md)
+	en := &Enrichment{
+		BookID:      bk.ID,
+		ISBN:        bk.ISBN,
+		Provider:    s.p.Name(),
+		Suggestions: suggest(current(bk), fetched, nil),
+		Applied:     []string{},
+	}
+
+	ub := book.UpdateBook{}
+	applied := map[string]bool{}
+
+	for _, sg := range en.Suggestions {
+		if !accepted[sg.Field] {
+			continue
+		}
+
+		v := sg.Suggested
+		switch sg.Field {
+		case FieldTitle:
+			ub.Title = v
+		case FieldAuthor:
+			ub.Author = v
+		case FieldCategory:
+			ub.Category = &v
+		case FieldDescription:
+			ub.Description = &v
+		}
+
+		applied[sg.Field] = true
+		en.Applied = append(en.Applied, sg.Field)
+	}
+
+	if len(en.Applied) == 0 {
+		return en, nil
+	}
+
+	if err := s.bs.Update(bk.ID, ub, sub); err != nil {
+		return nil, err
+	}
+
+	en.Suggestions = suggest(current(bk), fetched, applied)
+
+	return en, nil
+}
+
+// Create fills the fields a new book leaves empty and suggests the rest. A
+// failed lookup is reported on the enrichment; the book is created anyway.
+func (s *service) Create(nb *book.NewBook, sub policy.Subject) (*book.Book, *Enrichment, error) {
+	en := &Enrichment{ISBN: nb.ISBN, Suggestions: []Suggestion{}, Applied: []string{}}
+	if s.p != nil {
+		en.Provider = s.p.Name()
+	}
+
+	var fetched map[string]string
+
+	md, err := s.lookup(nb.ISBN)
+	if err != nil {
+		en.Error = err.Error()
+	} else {
+		fetched = values(md)
+
+		if nb.Category == "" && fetched[FieldCategory] != "" {
+			nb.Category = fetched[FieldCategory]
+			en.Applied = append(en.Applied, FieldCategory)
+		}
+		if nb.Description == "" && fetched[FieldDescription] != "" {
+			nb.Description = fetched[FieldDescription]
+			en.Applied = append(en.Applied, FieldDescription)
+		}
+	}
+
+	bk, err := s.bs.Create(nb, sub)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	en.BookID = bk.ID
+	if fetched != nil {
+		en.Suggestions = suggest(current(bk), fetched, nil)
+	}
+
+	return bk, en, nil
+}
+
+func validField(f string) bool {
+	for _, field := range Fields {
+		if f == field {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,198 @@
+package enrich_test
+
+import (
+	"errors"
+	"net/http"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/axwilliams/book-api/internal/business/book"
+	"github.com/axwilliams/book-api/internal/business/enrich"
+	"github.com/axwilliams/book-api/internal/platform/policy"
+	"github.com/axwilliams/book-api/internal/platform/web"
+	"github.com/axwilliams/book-api/internal/test"
+	"github.com/axwilliams/book-api/internal/test/mock"
+)
+
+func newService(t *testing.T) enrich.Service {
+	p, err := enrich.LoadFixtures("testdata/fixtures.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return enrich.NewService(book.NewService(mock.NewMockBook(), policy.NewEngine("")), p)
+}
+
+func TestEnrich(t *testing.T) {
+	es := newService(t)
+
+	samples := []struct {
+		name        string
+		id          string
+		accept      []string
+		statusCode  int
+		suggestions []string
+		applied     []string
+	}{
+		{
+			name:        "Suggestions only",
+			id:          "f4ac7e14-fc8e-4096-b956-34e5a33040f2",
+			statusCode:  http.StatusOK,
+			suggestions: []string{enrich.FieldCategory, enrich.FieldDescription},
+			applied:     []string{},
+		},
+		{
+			name:        "Accept one field",
+			id:          "f4ac7e14-fc8e-4096-b956-34e5a33040f2",
+			accept:      []string{"Description"},
+			statusCode:  http.StatusOK,
+			suggestions: []string{enrich.FieldCategory},
+			applied:     []string{enrich.FieldDescription},
+		},
+		{
+			name:        "Accept a field without a suggestion",
+			id:          "f4ac7e14-fc8e-4096-b956-34e5a33040f2",
+			accept:      []string{enrich.FieldTitle},
+			statusCode:  http.StatusOK,
+			suggestions: []string{enrich.FieldCategory, enrich.FieldDescription},
+			applied:     []string{},
+		},
+		{
+			name:       "Unknown field",
+			id:         "f4ac7e14-fc8e-4096-b956-34e5a33040f2",
+			accept:     []string{"isbn"},
+			statusCode: http.StatusBadRequest,
+		},
+		{
+			name:       "No metadata",
+			id:         "d2b4a1c7-5e33-4b8a-9c1e-6f0d3a2b7c91",
+			statusCode: http.StatusNotFound,
+		},
+		{
+			name:       "No book",
+			id:         "562e1fe0-0dde-4717-a008-cd2a699301d3",
+			statusCode: http.StatusNotFound,
+		},
+	}
+
+	for _, sample := range samples {
+		en, err := es.Enrich(sample.id, sample.accept, policy.Subject{})
+
+		if sample.statusCode != http.StatusOK {
+			if re, ok := err.(*web.RequestError); !ok || re.Status != sample.statusCode {
+				t.Fatalf("\t%s\tWrong error for %s: want %d got %v", test.Failed, sample.name, sample.statusCode, err)
+			}
+			t.Logf("\t%s\t%s rejected", test.Success, sample.name)
+			continue
+		}
+
+		if err != nil {
+			t.Fatalf("\t%s\t%s failed: %v", test.Failed, sample.name, err)
+		}
+
+		fields := []string{}
+		for _, sg := range en.Suggestions {
+			fields = append(fields, sg.Field)
+		}
+
+		if !reflect.DeepEqual(fields, sample.suggestions) || !reflect.DeepEqual(en.Applied, sample.applied) {
+			t.Fatalf("\t%s\tWrong enrichment for %s: %+v", test.Failed, sample.name, en)
+		}
+		t.Logf("\t%s\t%s", test.Success, sample.name)
+	}
+
+	en, _ := es.Enrich("f4ac7e14-fc8e-4096-b956-34e5a33040f2", nil, policy.Subject{})
+	expected := enrich.Suggestion{
+		Field:     enrich.FieldDescription,
+		Current:   "",
+		Suggested: "A land surveyor is summoned to a village below a castle.",
+	}
+	if en.Suggestions[1] != expected {
+		t.Fatalf("\t%s\tWrong suggestion: want %+v got %+v", test.Failed, expected, en.Suggestions[1])
+	}
+	t.Logf("\t%s\tSuggestions compare fetched and current values", test.Success)
+}
+
+func TestCreate(t *testing.T) {
+	es := newService(t)
+
+	nb := &book.NewBook{ISBN: "978-0099448792", Title: "The Wind-Up Bird Chronicle", Author: "Haruki Murakami"}
+
+	bk, en, err := es.Create(nb, policy.Subject{ID: "bad069ce-4afa-4a53-a673-14ae7b627d06"})
+	if err != nil {
+		t.Fatalf("\t%s\tCreating failed: %v", test.Failed, err)
+	}
+
+	if bk.Category != "Fiction" || bk.Description != "Toru Okada's cat has disappeared." {
+		t.Fatalf("\t%s\tEmpty fields were not filled: %+v", test.Failed, bk)
+	}
+	if !reflect.DeepEqual(en.Applied, []string{enrich.FieldCategory, enrich.FieldDescription}) ||
+		len(en.Suggestions) != 1 || en.Suggestions[0].Suggested != "Haruki Murakami; Jay Rubin" {
+		t.Fatalf("\t%s\tWrong enrichment: %+v", test.Failed, en)
+	}
+	t.Logf("\t%s\tEmpty fields filled and the rest suggested", test.Success)
+
+	nb = &book.NewBook{ISBN: "978-0465025275", Title: "Six Easy Pieces", Author: "Richard Feynman"}
+
+	bk, en, err = es.Create(nb, policy.Subject{ID: "bad069ce-4afa-4a53-a673-14ae7b627d06"})
+	if err != nil || bk == nil || en.Error != enrich.ErrNotFound.Error() {
+		t.Fatalf("\t%s\tA failed lookup should not stop creation: %v %+v", test.Failed, err, en)
+	}
+	t.Logf("\t%s\tCreated without metadata", test.Success)
+}
+
+// countingProvider counts lookups and fails while down is set.
+type countingProvider struct {
+	calls int
+	down  bool
+}
+
+func (p *countingProvider) Name() string {
+	return "counting"
+}
+
+func (p *countingProvider) Lookup(isbn string) (*enrich.Metadata, error) {
+	p.calls++
+	if p.down {
+		return nil, errors.New("connection refused")
+	}
+	if isbn == "9780241372579" {
+		return &enrich.Metadata{ISBN: isbn, Title: "The Castle"}, nil
+	}
+	return nil, enrich.ErrNotFound
+}
+
+func TestCache(t *testing.T) {
+	p := &countingProvider{}
+	c := enrich.NewCache(p, time.Hour, 2)
+
+	for i := 0; i < 3; i++ {
+		if md, err := c.Lookup("9780241372579"); err != nil || md.Title != "The Castle" {
+			t.Fatalf("\t%s\tWrong lookup: %v %v", test.Failed, md, err)
+		}
+		if _, err := c.Lookup("9781451673319"); err != enrich.ErrNotFound {
+			t.Fatalf("\t%s\tWrong miss: %v", test.Failed, err)
+		}
+	}
+
+	if p.calls != 2 {
+		t.Fatalf("\t%s\tHits and misses should be cached: %d lookups", test.Failed, p.calls)
+	}
+	t.Logf("\t%s\tHits and misses cached", test.Success)
+
+	p.down = true
+	if _, err := c.Lookup("9780465025275"); err == nil || err == enrich.ErrNotFound {
+		t.Fatalf("\t%s\tProvider failure should be returned: %v", test.Failed, err)
+	}
+	p.down = false
+	if _, err := c.Lookup("9780465025275"); err != enrich.ErrNotFound || p.calls != 4 {
+		t.Fatalf("\t%s\tFailures should not be cached: %v, %d lookups", test.Failed, err, p.calls)
+	}
+	t.Logf("\t%s\tFailures not cached", test.Success)
+
+	if _, err := c.Lookup("9780241372579"); err != nil || p.calls != 5 {
+		t.Fatalf("\t%s\tThe oldest entry should have been evicted: %d lookups", test.Failed, p.calls)
+	}
+	t.Logf("\t%s\tCache size bounded", test.Success)
+}
@@ -0,0 +1,153 @@
+package label
+
+import (
+	"sort"
+
+	"github.com/axwilliams/book-api/internal/platform/pdf"
+)
+
+const (
+	KindBarcode = "barcode"
+	KindSpine   = "spine"
+)
+
+const (
+	FormatSVG = "svg"
+	FormatPNG = "png"
+)
+
+const (
+	ContentTypeSVG = "image/svg+xml"
+	ContentTypePNG = "image/png"
+)
+
+// File is a rendered barcode, QR code or label sheet, ready to be written
+// out.
+type File struct {
+	ContentType string
+	Body        []byte
+}
+
+// NewSheet selects the books to label. Copies prints that many labels for
+// every book, and Skip leaves the first positions of the sheet empty so a
+// partly used sheet can be fed again.
+type NewSheet struct {
+	Template string   `json:"template" validate:"required"`
+	Kind     string   `json:"kind"`
+	IDs      []string `json:"ids" validate:"required"`
+	Copies   int      `json:"copies" validate:"omitempty,min=1,max=100"`
+	Skip     int      `json:"skip" validate:"omitempty,min=0"`
+}
+
+const (
+	inch = 72.0
+	mm   = 72.0 / 25.4
+)
+
+// Template describes a sheet of labels. Lengths are in points; Left and Top
+// place the first label and PitchX and PitchY the distance from one label
+// to the next.
+type Template struct {
+	Name        string  `json:"name"`
+	Description string  `json:"description"`
+	PageWidth   float64 `json:"page_width"`
+	PageHeight  float64 `json:"page_height"`
+	Columns     int     `json:"columns"`
+	Rows        int     `json:"rows"`
+	Width       float64 `json:"width"`
+	Height      float64 `json:"height"`
+	Left        float64 `json:"left"`
+	Top         float64 `json:"top"`
+	PitchX      float64 `json:"pitch_x"`
+	PitchY      float64 `json:"pitch_y"`
+}
+
+// PerSheet is the number of labels on one sheet.
+func (t Template) PerSheet() int {
+	return t.Columns * t.Rows
+}
+
+var templates = map[string]Template{
+	"avery-5160": {
+		Name:        "avery-5160",
+		Description: "Letter, 30 labels of 2 5/8 x 1 in",
+		PageWidth:   pdf.LetterWidth,
+		PageHeight:  pdf.LetterHeight,
+		Columns:     3,
+		Rows:        10,
+		Width:       2.625 * inch,
+		Height:      1 * inch,
+		Left:        0.1875 * inch,
+		Top:         0.5 * inch,
+		PitchX:      2.75 * inch,
+		PitchY:      1 * inch,
+	},
+	"avery-5163": {
+		Name:        "avery-5163",
+		Description: "Letter, 10 labels of 4 x 2 in",
+		PageWidth:   pdf.LetterWidth,
+		PageHeight:  pdf.LetterHeight,
+		Columns:     2,
+		Rows:        5,
+		Width:       4 * inch,
+		Height:      2 * inch,
+		Left:        0.15625 * inch,
+		Top:         0.5 * inch,
+		PitchX:      4.1875 * inch,
+		PitchY:      2 * inch,
+	},
+	"avery-5167": {
+		Name:        "avery-5167",
+		Description: "Letter, 80 labels of 1 3/4 x 1/2 in",
+		PageWidth:   pdf.LetterWidth,
+		PageHeight:  pdf.LetterHeight,
+		Columns:     4,
+		Rows:        20,
+		Width:       1.75 * inch,
+		Height:      0.5 * inch,
+		Left:        0.3 * inch,
+		Top:         0.5 * inch,
+		PitchX:      2.05 * inch,
+		PitchY:      0.5 * inch,
+	},
+	"avery-l7160": {
+		Name:        "avery-l7160",
+		Description: "A4, 21 labels of 63.5 x 38.1 mm",
+		PageWidth:   pdf.A4Width,
+		PageHeight:  pdf.A4Height,
+		Columns:     3,
+		Rows:        7,
+		Width:       63.5 * mm,
+		Height:      38.1 * mm,
+		Left:        7.21 * mm,
+		Top:         15.15 * mm,
+		PitchX:      66.04 * mm,
+		PitchY:      38.1 * mm,
+	},
+	"avery-l7651": {
+		Name:        "avery-l7651",
+		Description: "A4, 65 labels of 38.1 x 21.2 mm",
+		PageWidth:   pdf.A4Width,
+		PageHeight:  pdf.A4Height,
+		Columns:     5,
+		Rows:        13,
+		Width:       38.1 * mm,
+		Height:      21.2 * mm,
+		Left:        4.67 * mm,
+		Top:         10.7 * mm,
+		PitchX:      40.64 * mm,
+		PitchY:      21.2 * mm,
+	},
+}
+
+// Templates lists the known label templates by name.
+func Templates() []Template {
+	ts := make([]Template, 0, len(templates))
+	for _, t := range templates {
+		ts = append(ts, t)
+	}
+	sort.Slice(ts, func(i, j int) bool {
+		return ts[i].Name < ts[j].Name
+	})
+	return ts
+}
@@ -0,0 +1,123 @@
+package label
+
+import (
+	"math"
+	"strings"
+
+	"github.com/axwilliams/book-api/internal/business/book"
+	"github.com/axwilliams/book-api/internal/business/citation"
+	"github.com/axwilliams/book-api/internal/platform/barcode"
+	"github.com/axwilliams/book-api/internal/platform/pdf"
+)
+
+// item is one label to print.
+type item struct {
+	bk  book.Book
+	ean *barcode.EAN13
+}
+
+// render lays the items out on as many sheets as they need, starting skip
+// positions into the first sheet.
+func render(t Template, kind string, items []item, skip int) []byte {
+	d := pdf.New(t.PageWidth, t.PageHeight)
+
+	var p *pdf.Page
+	for i, it := range items {
+		pos := (skip + i) % t.PerSheet()
+		if p == nil || pos == 0 {
+			p = d.AddPage()
+		}
+
+		x := t.Left + float64(pos%t.Columns)*t.PitchX
+		y := t.Top + float64(pos/t.Columns)*t.PitchY
+
+		switch kind {
+		case KindSpine:
+			drawSpine(p, x, y, t.Width, t.Height, it.bk)
+		default:
+			drawBarcode(p, x, y, t.Width, t.Height, it.bk, it.ean)
+		}
+	}
+
+	return d.Bytes()
+}
+
+// padding keeps the content clear of the label edge, which printers do not
+// hit exactly.
+func padding(w, h float64) float64 {
+	return math.Max(2, math.Min(w, h)*0.08)
+}
+
+// drawBarcode prints the title above an EAN-13 symbol that fills the rest of
+// the label.
+func drawBarcode(p *pdf.Page, x, y, w, h float64, bk book.Book, e *barcode.EAN13) {
+	pad := padding(w, h)
+	inner := w - 2*pad
+
+	title := math.Min(8, h*0.14)
+	p.Text(x+pad, y+pad+title, title, pdf.Fit(bk.Title, title, inner))
+
+	module := inner / barcode.EANWidth
+	digits := math.Min(module*8, 9)
+	left := x + pad
+	top := y + pad + title + 2
+	bars := y + h - pad - digits - top
+
+	for i := 0; i < len(e.Modules); {
+		if !e.Modules[i] {
+			i++
+			continue
+		}
+		j := i
+		for j < len(e.Modules) && e.Modules[j] {
+			j++
+		}
+		height := bars
+		if e.Guard(i) {
+			height += module * barcode.EANGuardExtra
+		}
+		p.Rect(left+float64(barcode.EANQuietLeft+i)*module, top, float64(j-i)*module, height)
+		i = j
+	}
+
+	for i := range e.Digits {
+		d := e.Digits[i : i+1]
+		center := left + (float64(e.DigitX(i))+3.5)*module
+		p.Text(center-pdf.TextWidth(d, digits)/2, y+h-pad, digits, d)
+	}
+}
+
+// drawSpine prints a spine label in the way shelves are usually marked:
+// the category, the first letters of the author's family name and a short
+// title, each centered on its own line.
+func drawSpine(p *pdf.Page, x, y, w, h float64, bk book.Book) {
+	pad := padding(w, h)
+	inner := w - 2*pad
+
+	lines := []string{strings.ToUpper(bk.Category), cutter(bk.Author), bk.Title}
+	if lines[0] == "" {
+		lines = lines[1:]
+	}
+
+	size := math.Min((h-2*pad)/(float64(len(lines))*1.2), 14)
+	for i, l := range lines {
+		l = pdf.Fit(l, size, inner)
+		baseline := y + pad + size*(1.2*float64(i)+1)
+		p.Text(x+(w-pdf.TextWidth(l, size))/2, baseline, size, l)
+	}
+}
+
+// cutter shortens the first author to the three letters shelves are sorted
+// by, e.g. KAF for Franz Kafka.
+func cutter(author string) string {
+	names := citation.Authors(author)
+	if len(names) == 0 {
+		return ""
+	}
+
+	rs := []rune(strings.ToUpper(names[0].Family))
+	if len(rs) > 3 {
+		rs = rs[:3]
+	}
+	return string(rs)
+}
@@ -0,0 +1,186 @@
+package label
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	"image/png"
+	"net/http"
+	"strings"
+
+	"github.com/axwilliams/book-api/internal/business/book"
+	"github.com/axwilliams/book-api/internal/platform/barcode"
+	"github.com/axwilliams/book-api/internal/platform/pdf"
+	"github.com/axwilliams/book-api/internal/platform/web"
+	"github.com/google/uuid"
+)
+
+// MaxLabels caps the number of labels in one request.
+const MaxLabels = 2000
+
+// imageScale is the number of pixels per module in PNG output.
+const imageScale = 4
+
+var (
+	ErrInvalidFormat   = errors.New("format must be svg or png")
+	ErrInvalidKind     = errors.New("kind must be barcode or spine")
+	ErrUnknownTemplate = errors.New("Unknown label template")
+	ErrInvalidSkip     = errors.New("skip must be less than the labels on one sheet")
+	ErrNoBarcode       = errors.New("Book has no valid ISBN for a barcode")
+	ErrNoBooks         = errors.New("At least one book ID is required")
+	ErrTooManyLabels   = errors.New("Too many labels for one request")
+	ErrUnknownBooks    = errors.New("Some books were not found")
+)
+
+type Service interface {
+	Barcode(id, format, status string) (*File, error)
+	QR(id, baseURL, format, status string) (*File, error)
+	Sheet(ns NewSheet, status string) (*File, error)
+}
+
+type service struct {
+	br book.Repository
+}
+
+func NewService(br book.Repository) Service {
+	return &service{
+		br,
+	}
+}
+
+func (s *service) get(id, status string) (*book.Book, error) {
+	if _, err := uuid.Parse(id); err != nil {
+		return nil, web.NewRequestError(book.ErrInvalidID, http.StatusBadRequest)
+	}
+
+	bk, err := s.br.GetById(id)
+	if err == nil && status != "" && bk.Status != status {
+		err = book.ErrNoBookFound
+	}
+	switch {
+	case err == book.ErrNoBookFound:
+		return nil, web.NewRequestError(book.ErrNoBookFound, http.StatusNotFound)
+	case err != nil:
+		return nil, err
+	}
+
+	return bk, nil
+}
+
+// symbol is implemented by both barcode types.
+type symbol interface {
+	SVG() []byte
+	Image(scale int) *image.Gray
+}
+
+func encode(sym symbol, format string) (*File, error) {
+	switch format {
+	case FormatSVG:
+		return &File{ContentType: ContentTypeSVG, Body: sym.SVG()}, nil
+	case FormatPNG:
+		var b bytes.Buffer
+		if err := png.Encode(&b, sym.Image(imageScale)); err != nil {
+			return nil, err
+		}
+		return &File{ContentType: ContentTypePNG, Body: b.Bytes()}, nil
+	}
+	return nil, web.NewRequestError(ErrInvalidFormat, http.StatusBadRequest)
+}
+
+// Barcode renders the EAN-13 of the book's ISBN.
+func (s *service) Barcode(id, format, status string) (*File, error) {
+	bk, err := s.get(id, status)
+	if err != nil {
+		return nil, err
+	}
+
+	e, err := barcode.NewEAN13(book.NormalizeISBN(bk.ISBN))
+	if err != nil {
+		return nil, web.NewRequestError(ErrNoBarcode, http.StatusUnprocessableEntity)
+	}
+
+	return encode(e, format)
+}
+
+// QR renders a QR code of the book's address under baseURL, so that a
+// phone pointed at the shelf lands on the catalog entry.
+func (s *service) QR(id, baseURL, format, status string) (*File, error) {
+	bk, err := s.get(id, status)
+	if err != nil {
+		return nil, err
+	}
+
+	q, err := barcode.NewQR([]byte(strings.TrimRight(baseURL, "/") + "/books/" + bk.ID))
+	if err != nil {
+		return nil, err
+	}
+
+	return encode(q, format)
+}
+
+// Sheet lays out labels for the books in ns on PDF pages of its template.
+// Unknown IDs, hidden books and, for barcodes, books without a valid ISBN
+// fail the whole request rather than leaving gaps in a printed sheet.
+func (s *service) Sheet(ns NewSheet, status string) (*File, error) {
+	t, ok := templates[strings.ToLower(strings.TrimSpace(ns.Template))]
+	if !ok {
+		return nil, web.NewRequestError(ErrUnknownTemplate, http.StatusBadRequest)
+	}
+
+	kind := strings.ToLower(strings.TrimSpace(ns.Kind))
+	switch kind {
+	case "":
+		kind = KindBarcode
+	case KindBarcode, KindSpine:
+	default:
+		return nil, web.NewRequestError(ErrInvalidKind, http.StatusBadRequest)
+	}
+
+	if ns.Skip >= t.PerSheet() {
+		return nil, web.NewRequestError(ErrInvalidSkip, http.StatusUnprocessableEntity)
+	}
+
+	copies := ns.Copies
+	if copies == 0 {
+		copies = 1
+	}
+
+	switch {
+	case len(ns.IDs) == 0:
+		return nil, web.NewRequestError(ErrNoBooks, http.StatusUnprocessableEntity)
+	case len(ns.IDs)*copies > MaxLabels:
+		return nil, web.NewRequestError(ErrTooManyLabels, http.StatusUnprocessableEntity)
+	}
+
+	items := make([]item, 0, len(ns.IDs)*copies)
+	for _, id := range ns.IDs {
+		id = strings.TrimSpace(id)
+		if _, err := uuid.Parse(id); err != nil {
+			return nil, web.NewRequestError(book.ErrInvalidID, http.StatusBadRequest)
+		}
+
+		bk, err := s.br.GetById(id)
+		if err == nil && status != "" && bk.Status != status {
+			err = book.ErrNoBookFound
+		}
+		switch {
+		case err == book.ErrNoBookFound:
+			return nil, web.NewRequestError(ErrUnknownBooks, http.StatusUnprocessableEntity)
+		case err != nil:
+			return nil, err
+		}
+
+		it := item{bk: *bk}
+		if kind == KindBarcode {
+			if it.ean, err = barcode.NewEAN13(book.NormalizeISBN(bk.ISBN)); err != nil {
+				return nil, web.NewRequestError(ErrNoBarcode, http.StatusUnprocessableEntity)
+			}
+		}
+
+		for i := 0; i < copies; i++ {
+			items = append(items, it)
+		}
+	}
+
+	return &File{ContentType: pdf.ContentType, Body: render(t, kind, items, ns.Skip)}, nil
+}
@@ -0,0 +1,123 @@
+package label_test
+
+import (
+	"bytes"
+	"net/http"
+	"testing"
+
+	"github.com/axwilliams/book-api/internal/business/book"
+	"github.com/axwilliams/book-api/internal/business/label"
+	"github.com/axwilliams/book-api/internal/platform/web"
+	"github.com/axwilliams/book-api/internal/test"
+	"github.com/axwilliams/book-api/internal/test/mock"
+)
+
+const castle = "f4ac7e14-fc8e-4096-b956-34e5a33040f2"
+
+func status(err error) int {
+	if re, ok := err.(*web.RequestError); ok {
+		return re.Status
+	}
+	if err != nil {
+		return http.StatusInternalServerError
+	}
+	return http.StatusOK
+}
+
+func TestSymbols(t *testing.T) {
+	ls := label.NewService(mock.NewMockBook())
+
+	samples := []struct {
+		name        string
+		id          string
+		format      string
+		qr          bool
+		statusCode  int
+		contentType string
+	}{
+		{"Barcode SVG", castle, label.FormatSVG, false, http.StatusOK, label.ContentTypeSVG},
+		{"Barcode PNG", castle, label.FormatPNG, false, http.StatusOK, label.ContentTypePNG},
+		{"QR PNG", castle, label.FormatPNG, true, http.StatusOK, label.ContentTypePNG},
+		{"Unknown format", castle, "gif", false, http.StatusBadRequest, ""},
+		{"Invalid ID", "f4ac7e14", label.FormatSVG, false, http.StatusBadRequest, ""},
+		{"Unknown book", "562e1fe0-0dde-4717-a008-cd2a699301d3", label.FormatPNG, true, http.StatusNotFound, ""},
+	}
+
+	for _, sample := range samples {
+		var f *label.File
+		var err error
+		if sample.qr {
+			f, err = ls.QR(sample.id, "https://books.example.org/api/v1", sample.format, book.StatusPublished)
+		} else {
+			f, err = ls.Barcode(sample.id, sample.format, book.StatusPublished)
+		}
+
+		if got := status(err); got != sample.statusCode {
+			t.Fatalf("\t%s\t%s: want %d got %v", test.Failed, sample.name, sample.statusCode, err)
+		}
+		if err == nil && (f.ContentType != sample.contentType || len(f.Body) == 0) {
+			t.Fatalf("\t%s\t%s: wrong file %s", test.Failed, sample.name, f.ContentType)
+		}
+		t.Logf("\t%s\t%s", test.Success, sample.name)
+	}
+
+	f, _ := ls.Barcode(castle, label.FormatSVG, "")
+	if !bytes.Contains(f.Body, []byte(">9</text>")) {
+		t.Fatalf("\t%s\tDigits missing from the barcode", test.Failed)
+	}
+	t.Logf("\t%s\tBarcode has its digits", test.Success)
+}
+
+func TestSheet(t *testing.T) {
+	ls := label.NewService(mock.NewMockBook())
+
+	ids := []string{castle}
+
+	samples := []struct {
+		name       string
+		ns         label.NewSheet
+		statusCode int
+		pages      string
+	}{
+		{"Unknown template", label.NewSheet{Template: "avery-9999", IDs: ids}, http.StatusBadRequest, ""},
+		{"Unknown kind", label.NewSheet{Template: "avery-5160", Kind: "cover", IDs: ids}, http.StatusBadRequest, ""},
+		{"Skip a full sheet", label.NewSheet{Template: "avery-5160", IDs: ids, Skip: 30}, http.StatusUnprocessableEntity, ""},
+		{"No books", label.NewSheet{Template: "avery-5160", IDs: []string{}}, http.StatusUnprocessableEntity, ""},
+		{"Too many labels", label.NewSheet{Template: "avery-5160", IDs: ids, Copies: 2001}, http.StatusUnprocessableEntity, ""},
+		{"Unknown book", label.NewSheet{Template: "avery-5160", IDs: []string{"562e1fe0-0dde-4717-a008-cd2a699301d3"}}, http.StatusUnprocessableEntity, ""},
+		{"Hidden book", label.NewSheet{Template: "avery-5160", IDs: []string{castle, "d2b4a1c7-5e33-4b8a-9c1e-6f0d3a2b7c91"}}, http.StatusUnprocessableEntity, ""},
+		{"Barcodes", label.NewSheet{Template: "avery-5160", IDs: ids}, http.StatusOK, "/Count 1"},
+		{"Spines over two sheets", label.NewSheet{Template: "AVERY-L7160", Kind: "spine", IDs: ids, Copies: 12, Skip: 10}, http.StatusOK, "/Count 2"},
+	}
+
+	for _, sample := range samples {
+		f, err := ls.Sheet(sample.ns, book.StatusPublished)
+
+		if got := status(err); got != sample.statusCode {
+			t.Fatalf("\t%s\t%s: want %d got %v", test.Failed, sample.name, sample.statusCode, err)
+		}
+		if err == nil && (f.ContentType != "application/pdf" || !bytes.Contains(f.Body, []byte(sample.pages))) {
+			t.Fatalf("\t%s\t%s: wrong sheet", test.Failed, sample.name)
+		}
+		t.Logf("\t%s\t%s", test.Success, sample.name)
+	}
+
+	f, _ := ls.Sheet(label.NewSheet{Template: "avery-5167", Kind: label.KindSpine, IDs: ids}, "")
+	for _, s := range []string{"(FICTION)", "(KAF)", "(The Castle)"} {
+		if !bytes.Contains(f.Body, []byte(s)) {
+			t.Fatalf("\t%s\tSpine label is missing %s", test.Failed, s)
+		}
+	}
+	t.Logf("\t%s\tSpine label shows category, author and title", test.Success)
+}
+
+func TestTemplates(t *testing.T) {
+	for _, tp := range label.Templates() {
+		right := tp.Left + float64(tp.Columns-1)*tp.PitchX + tp.Width
+		bottom := tp.Top + float64(tp.Rows-1)*tp.PitchY + tp.Height
+		if right > tp.PageWidth || bottom > tp.PageHeight+0.5 {
+			t.Fatalf("\t%s\t%s does not fit its page: %.1f x %.1f", test.Failed, tp.Name, right, bottom)
+		}
+	}
+	t.Logf("\t%s\tEvery template fits its page", test.Success)
+}
@@ -0,0 +1,177 @@
+package library
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/axwilliams/book-api/internal/business/book"
+	"github.com/axwilliams/book-api/internal/platform/sqlite"
+)
+
+// calibreLinks reads one of Calibre's many-to-many link tables into a map
+// from book ID to the names it links to, in the order they were linked.
+func calibreLinks(db *sqlite.DB, table, column string, names map[int64]string) (map[int64][]string, error) {
+	links := map[int64][]string{}
+	if !db.HasTable(table) {
+		return links, nil
+	}
+
+	rows, err := db.Rows(table)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, r := range rows {
+		if name, ok := names[r.Int(column)]; ok {
+			links[r.Int("book")] = append(links[r.Int("book")], name)
+		}
+	}
+
+	return links, nil
+}
+
+// calibreNames maps the IDs of a lookup table such as authors or tags to the
+// given column.
+func calibreNames(db *sqlite.DB, table, column string) (map[int64]string, error) {
+	names := map[int64]string{}
+	if !db.HasTable(table) {
+		return names, nil
+	}
+
+	rows, err := db.Rows(table)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, r := range rows {
+		switch v := r[column].(type) {
+		case int64:
+			names[r.Int("id")] = strconv.FormatInt(v, 10)
+		default:
+			names[r.Int("id")] = strings.TrimSpace(r.Text(column))
+		}
+	}
+
+	return names, nil
+}
+
+// calibreBookText maps book IDs to a text column of a table keyed by book,
+// such as comments. When filter is set only rows whose type matches it are
+// kept, which picks the ISBN out of the identifiers table.
+func calibreBookText(db *sqlite.DB, table, column, filter string) (map[int64]string, error) {
+	text := map[int64]string{}
+	if !db.HasTable(table) {
+		return text, nil
+	}
+
+	rows, err := db.Rows(table)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, r := range rows {
+		if filter == "" || strings.EqualFold(r.Text("type"), filter) {
+			text[r.Int("book")] = r.Text(column)
+		}
+	}
+
+	return text, nil
+}
+
+// ReadCalibre reads the books of a Calibre library's metadata.db. Calibre
+// rates in half stars from 0 to 10, which are rounded up to whole stars.
+func ReadCalibre(data []byte) ([]Entry, error) {
+	db, err := sqlite.Open(data)
+	if err != nil {
+		return nil, err
+	}
+
+	if !db.HasTable("books") {
+		return nil, fmt.Errorf("%w: no books table", sqlite.ErrNoSuchTable)
+	}
+
+	authors, err := calibreNames(db, "authors", "name")
+	if err != nil {
+		return nil, err
+	}
+	tags, err := calibreNames(db, "tags", "name")
+	if err != nil {
+		return nil, err
+	}
+	series, err := calibreNames(db, "series", "name")
+	if err != nil {
+		return nil, err
+	}
+	ratings, err := calibreNames(db, "ratings", "rating")
+	if err != nil {
+		return nil, err
+	}
+
+	bookAuthors, err := calibreLinks(db, "books_authors_link", "author", authors)
+	if err != nil {
+		return nil, err
+	}
+	bookTags, err := calibreLinks(db, "books_tags_link", "tag", tags)
+	if err != nil {
+		return nil, err
+	}
+	bookSeries, err := calibreLinks(db, "books_series_link", "series", series)
+	if err != nil {
+		return nil, err
+	}
+	bookRatings, err := calibreLinks(db, "books_ratings_link", "rating", ratings)
+	if err != nil {
+		return nil, err
+	}
+
+	isbns, err := calibreBookText(db, "identifiers", "val", "isbn")
+	if err != nil {
+		return nil, err
+	}
+	comments, err := calibreBookText(db, "comments", "text", "")
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := db.Rows("books")
+	if err != nil {
+		return nil, err
+	}
+
+	es := []Entry{}
+	for _, r := range rows {
+		id := r.Int("id")
+
+		e := Entry{
+			SourceID:    r.Text("uuid"),
+			ISBN:        strings.TrimSpace(isbns[id]),
+			Title:       strings.TrimSpace(r.Text("title")),
+			Authors:     bookAuthors[id],
+			Description: book.PlainText(comments[id]),
+			Tags:        bookTags[id],
+		}
+
+		if e.SourceID == "" {
+			e.SourceID = strconv.FormatInt(id, 10)
+		}
+		if e.ISBN == "" {
+			e.ISBN = strings.TrimSpace(r.Text("isbn"))
+		}
+
+		if s := bookSeries[id]; len(s) > 0 {
+			e.Series = s[0]
+			index := r.Float("series_index")
+			e.SeriesIndex = &index
+		}
+
+		if rt := bookRatings[id]; len(rt) > 0 {
+			half, _ := strconv.Atoi(rt[0])
+			e.Rating = (half + 1) / 2
+		}
+
+		es = append(es, e)
+	}
+
+	return es, nil
+}
@@ -0,0 +1,124 @@
+package library
+
+import (
+	"encoding/csv"
+	"errors"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+var ErrNoGoodreadsColumns = errors.New("CSV has no Book Id and Title columns")
+
+// goodreadsSeries matches the series Goodreads appends to titles, as in
+// "The Fellowship of the Ring (The Lord of the Rings, #1)".
+var goodreadsSeries = regexp.MustCompile(`^(.*\S)\s+\(([^()]*[^(),\s]),?\s+#(\d+(?:\.\d+)?)\)$`)
+
+// goodreadsISBN drops the ="..." wrapper Goodreads puts around ISBNs so that
+// spreadsheets keep leading zeros.
+func goodreadsISBN(s string) string {
+	s = strings.TrimSpace(s)
+	if strings.HasPrefix(s, "=") {
+		s = strings.Trim(s[1:], `"`)
+	}
+	return strings.TrimSpace(s)
+}
+
+// goodreadsExclusive are the built-in exclusive shelves. They record whether a
+// book was read rather than how the user sorts their books.
+var goodreadsExclusive = map[string]bool{
+	"read":              true,
+	"currently-reading": true,
+	"to-read":           true,
+}
+
+// splitList splits a comma separated Goodreads field, dropping empty items.
+func splitList(s string) []string {
+	items := []string{}
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// ReadGoodreads reads a Goodreads library export. Exclusive shelves, the
+// built-in ones and the entry's own Exclusive Shelf, are left out.
+func ReadGoodreads(r io.Reader) ([]Entry, error) {
+	cr := csv.NewReader(r)
+	cr.FieldsPerRecord = -1
+
+	header, err := cr.Read()
+	if err != nil {
+		return nil, err
+	}
+
+	cols := map[string]int{}
+	for i, name := range header {
+		cols[strings.TrimSpace(strings.TrimPrefix(name, "\ufeff"))] = i
+	}
+
+	if _, ok := cols["Book Id"]; !ok {
+		return nil, ErrNoGoodreadsColumns
+	}
+	if _, ok := cols["Title"]; !ok {
+		return nil, ErrNoGoodreadsColumns
+	}
+
+	es := []Entry{}
+	for {
+		rec, err := cr.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		field := func(name string) string {
+			if i, ok := cols[name]; ok && i < len(rec) {
+				return strings.TrimSpace(rec[i])
+			}
+			return ""
+		}
+
+		e := Entry{
+			SourceID: field("Book Id"),
+			Title:    field("Title"),
+			ISBN:     goodreadsISBN(field("ISBN13")),
+		}
+
+		if e.ISBN == "" {
+			e.ISBN = goodreadsISBN(field("ISBN"))
+		}
+
+		if m := goodreadsSeries.FindStringSubmatch(e.Title); m != nil {
+			index, _ := strconv.ParseFloat(m[3], 64)
+			e.Title, e.Series, e.SeriesIndex = m[1], m[2], &index
+		}
+
+		if a := field("Author"); a != "" {
+			e.Authors = append(e.Authors, a)
+		}
+		e.Authors = append(e.Authors, splitList(field("Additional Authors"))...)
+
+		exclusive := field("Exclusive Shelf")
+		seen := map[string]bool{}
+		for _, shelf := range splitList(field("Bookshelves")) {
+			if shelf != exclusive && !goodreadsExclusive[shelf] && !seen[shelf] {
+				seen[shelf] = true
+				e.Shelves = append(e.Shelves, shelf)
+			}
+		}
+
+		if rating, err := strconv.Atoi(field("My Rating")); err == nil && rating > 0 && rating <= 5 {
+			e.Rating = rating
+		}
+
+		es = append(es, e)
+	}
+
+	return es, nil
+}
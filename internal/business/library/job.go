@@ -0,0 +1,21 @@
+package library
+
+import (
+	"log"
+)
+
+// Run imports queued exports one at a time until stop is closed.
+func Run(s Service, stop <-chan struct{}, log *log.Logger) {
+	for {
+		j, err := s.Process(stop)
+		switch {
+		case j == nil && err == nil:
+			return
+		case err != nil:
+			log.Printf("[error] Importing library %s: %+v", j.ID, err)
+		default:
+			log.Printf("[library] Imported %s library %s: %d created, %d duplicates, %d skipped",
+				j.Source, j.ID, len(j.Report.Created), len(j.Report.Duplicates), len(j.Report.Skipped))
+		}
+	}
+}
@@ -0,0 +1,71 @@
+package library
+
+import (
+	"time"
+)
+
+const (
+	SourceCalibre   = "calibre"
+	SourceGoodreads = "goodreads"
+)
+
+const (
+	StatusQueued  = "queued"
+	StatusRunning = "running"
+	StatusDone    = "done"
+	StatusFailed  = "failed"
+)
+
+// Entry is one book as an export describes it. Tags are the library's own
+// labels and become tags added by the importing user. Shelves are the lists a
+// user filed the book under and are kept for that user only.
+type Entry struct {
+	SourceID    string
+	ISBN        string
+	Title       string
+	Authors     []string
+	Description string
+	Tags        []string
+	Shelves     []string
+	Series      string
+	SeriesIndex *float64
+	Rating      int // 1 to 5 stars, 0 when unrated
+}
+
+// Result is the outcome of one entry. Entry is its position in the export,
+// starting at 1. Reason says why an entry was skipped; Warning notes tags or
+// a rating that could not be added to a book that was otherwise imported.
+type Result struct {
+	Entry    int    `json:"entry"`
+	SourceID string `json:"source_id"`
+	Title    string `json:"title"`
+	BookID   string `json:"book_id,omitempty"`
+	Reason   string `json:"reason,omitempty"`
+	Warning  string `json:"warning,omitempty"`
+}
+
+// Report sorts the entries of an import. Duplicates matched a book that was
+// already in the catalog by ISBN; the user's tags, shelves and rating are
+// added to that book instead of creating another.
+type Report struct {
+	Created    []Result `json:"created"`
+	Skipped    []Result `json:"skipped"`
+	Duplicates []Result `json:"duplicates"`
+}
+
+func NewReport() Report {
+	return Report{Created: []Result{}, Skipped: []Result{}, Duplicates: []Result{}}
+}
+
+type Job struct {
+	ID        string    `db:"id" json:"id"`
+	UserID    string    `db:"user_id" json:"user_id"`
+	Source    string    `db:"source" json:"source"`
+	Status    string    `db:"status" json:"status"`
+	Total     int       `db:"total" json:"total"`
+	Processed int       `db:"processed" json:"processed"`
+	Report    Report    `db:"report" json:"report"`
+	Error     string    `db:"error" json:"error,omitempty"`
+	CreatedAt time.Time `db:"created_at" json:"created_at"`
+	UpdatedAt time.Time `db:"updated_at" json:"updated_at"`
+}
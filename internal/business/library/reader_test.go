@@ -0,0 +1,142 @@
+package library_test
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/axwilliams/book-api/internal/business/library"
+	"github.com/axwilliams/book-api/internal/test"
+)
+
+func float(f float64) *float64 {
+	return &f
+}
+
+// testdata/metadata.db was created with the sqlite3 shell from the table
+// definitions Calibre uses.
+func TestReadCalibre(t *testing.T) {
+	data, err := ioutil.ReadFile("testdata/metadata.db")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	es, err := library.ReadCalibre(data)
+	if err != nil {
+		t.Fatalf("\t%s\tReading the library failed: %v", test.Failed, err)
+	}
+
+	expected := []library.Entry{
+		{
+			SourceID:    "1b6f3c1e-8f0a-4c55-9a59-0f3c1a2b7d01",
+			ISBN:        "978-0241372579",
+			Title:       "The Castle",
+			Authors:     []string{"Franz Kafka"},
+			Description: "A land surveyor arrives in a village & tries to reach the castle.",
+			Tags:        []string{"Fiction", "Classics"},
+			Rating:      5,
+		},
+		{
+			SourceID:    "2c7a4d2f-9a1b-4d66-8b6a-1a4d2b3c8e02",
+			ISBN:        "0547928211",
+			Title:       "The Fellowship of the Ring",
+			Authors:     []string{"J. R. R. Tolkien"},
+			Tags:        []string{"Fantasy"},
+			Series:      "The Lord of the Rings",
+			SeriesIndex: float(1),
+			Rating:      4,
+		},
+		{
+			SourceID:    "3d8b5e3a-0b2c-4e77-9c7b-2b5e3c4d9f03",
+			ISBN:        "9780547928203",
+			Title:       "The Two Towers",
+			Authors:     []string{"J. R. R. Tolkien"},
+			Tags:        []string{"Fantasy"},
+			Series:      "The Lord of the Rings",
+			SeriesIndex: float(2),
+		},
+		{
+			SourceID: "4e9c6f4b-1c3d-4f88-8d8c-3c6f4d5e0a04",
+			Title:    "Good Omens",
+			Authors:  []string{"Terry Pratchett", "Neil Gaiman"},
+			Tags:     []string{"Fantasy", "Fiction"},
+		},
+		{
+			SourceID: "5fad705c-2d4e-4099-9e9d-4d705e6f1b05",
+			Title:    "Notes",
+		},
+	}
+
+	if len(es) != len(expected) {
+		t.Fatalf("\t%s\tWrong number of entries: want %d got %d", test.Failed, len(expected), len(es))
+	}
+	for i := range expected {
+		if !reflect.DeepEqual(es[i], expected[i]) {
+			t.Fatalf("\t%s\tWrong entry %d: want %+v got %+v", test.Failed, i+1, expected[i], es[i])
+		}
+	}
+	t.Logf("\t%s\tMapped authors, tags, series, ratings and identifiers", test.Success)
+
+	if _, err := library.ReadCalibre([]byte("not a database")); err == nil {
+		t.Fatalf("\t%s\tA file that is not a database should be rejected", test.Failed)
+	}
+	t.Logf("\t%s\tNon-database rejected", test.Success)
+}
+
+func TestReadGoodreads(t *testing.T) {
+	f, err := os.Open("testdata/goodreads_library_export.csv")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	es, err := library.ReadGoodreads(f)
+	if err != nil {
+		t.Fatalf("\t%s\tReading the export failed: %v", test.Failed, err)
+	}
+
+	expected := []library.Entry{
+		{
+			SourceID: "13079982",
+			ISBN:     "9781451673319",
+			Title:    "Fahrenheit 451",
+			Authors:  []string{"Ray Bradbury"},
+			Shelves:  []string{"classics", "favorites"},
+			Rating:   4,
+		},
+		{
+			SourceID:    "34",
+			ISBN:        "9780618346257",
+			Title:       "The Fellowship of the Ring",
+			Authors:     []string{"J.R.R. Tolkien"},
+			Series:      "The Lord of the Rings",
+			SeriesIndex: float(1),
+			Rating:      5,
+		},
+		{
+			SourceID: "7144",
+			Title:    "Good Omens",
+			Authors:  []string{"Terry Pratchett", "Neil Gaiman"},
+		},
+		{
+			SourceID: "5107",
+			ISBN:     "9780316769488",
+			Title:    "The Catcher in the Rye",
+			Authors:  []string{"J.D. Salinger"},
+		},
+	}
+
+	if !reflect.DeepEqual(es, expected) {
+		t.Fatalf("\t%s\tWrong entries: want %+v got %+v", test.Failed, expected, es)
+	}
+	t.Logf("\t%s\tMapped authors, shelves, series, ratings and ISBNs", test.Success)
+
+	_, err = library.ReadGoodreads(strings.NewReader("Name,Value\na,b\n"))
+	if !errors.Is(err, library.ErrNoGoodreadsColumns) {
+		t.Fatalf("\t%s\tWrong error for a CSV that is not a Goodreads export: %v", test.Failed, err)
+	}
+	t.Logf("\t%s\tOther CSV rejected", test.Success)
+}
@@ -0,0 +1,158 @@
+package library
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/lib/pq"
+)
+
+var (
+	ErrNoJobFound = errors.New("No import job found")
+	ErrNoRecord   = errors.New("No import record found")
+)
+
+type Repository interface {
+	CreateJob(j *Job) error
+	UpdateJob(j *Job) error
+	GetJob(id string) (*Job, error)
+	FailUnfinished(message string) (int, error)
+	GetRecord(userID, source, sourceID string) (string, error)
+	AddRecord(userID, source, sourceID, bookID string) error
+	SaveRating(bookID, userID string, rating int) error
+	SaveShelves(bookID, userID string, shelves []string) error
+}
+
+type repository struct {
+	db *sql.DB
+}
+
+func NewRepository(db *sql.DB) Repository {
+	return &repository{
+		db,
+	}
+}
+
+func (r *repository) CreateJob(j *Job) error {
+	report, err := json.Marshal(j.Report)
+	if err != nil {
+		return fmt.Errorf("Encoding import report: %w", err)
+	}
+
+	_, err = r.db.Exec(`INSERT INTO import_job (id, user_id, source, status, total, processed, report, error, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)`,
+		j.ID, j.UserID, j.Source, j.Status, j.Total, j.Processed, report, j.Error, j.CreatedAt, j.UpdatedAt)
+	if err != nil {
+		return fmt.Errorf("Creating import job: %w", err)
+	}
+
+	return nil
+}
+
+func (r *repository) UpdateJob(j *Job) error {
+	report, err := json.Marshal(j.Report)
+	if err != nil {
+		return fmt.Errorf("Encoding import report: %w", err)
+	}
+
+	_, err = r.db.Exec(`UPDATE import_job SET status = $1, processed = $2, report = $3, error = $4, updated_at = $5
+		WHERE id = $6`, j.Status, j.Processed, report, j.Error, j.UpdatedAt, j.ID)
+	if err != nil {
+		return fmt.Errorf("Updating import job: %w", err)
+	}
+
+	return nil
+}
+
+func (r *repository) GetJob(id string) (*Job, error) {
+	j := &Job{}
+	var report []byte
+
+	err := r.db.QueryRow(`SELECT id, user_id, source, status, total, processed, report, error, created_at, updated_at
+		FROM import_job WHERE id = $1`, id).
+		Scan(&j.ID, &j.UserID, &j.Source, &j.Status, &j.Total, &j.Processed, &report, &j.Error, &j.CreatedAt, &j.UpdatedAt)
+
+	switch {
+	case err == sql.ErrNoRows:
+		return nil, ErrNoJobFound
+	case err != nil:
+		return nil, fmt.Errorf("Retrieving import job: %w", err)
+	}
+
+	if err := json.Unmarshal(report, &j.Report); err != nil {
+		return nil, fmt.Errorf("Decoding import report: %w", err)
+	}
+
+	return j, nil
+}
+
+// FailUnfinished marks jobs that were queued or running when the process
+// stopped as failed, since nothing will pick them up again.
+func (r *repository) FailUnfinished(message string) (int, error) {
+	res, err := r.db.Exec(`UPDATE import_job SET status = $1, error = $2, updated_at = now()
+		WHERE status IN ($3, $4)`, StatusFailed, message, StatusQueued, StatusRunning)
+	if err != nil {
+		return 0, fmt.Errorf("Failing unfinished import jobs: %w", err)
+	}
+
+	count, err := res.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("Counting failed import jobs: %w", err)
+	}
+
+	return int(count), nil
+}
+
+// GetRecord returns the book an entry was imported as by the same user.
+func (r *repository) GetRecord(userID, source, sourceID string) (string, error) {
+	var bookID string
+
+	err := r.db.QueryRow(`SELECT book_id FROM import_record WHERE user_id = $1 AND source = $2 AND source_id = $3`,
+		userID, source, sourceID).Scan(&bookID)
+
+	switch {
+	case err == sql.ErrNoRows:
+		return "", ErrNoRecord
+	case err != nil:
+		return "", fmt.Errorf("Retrieving import record: %w", err)
+	}
+
+	return bookID, nil
+}
+
+func (r *repository) AddRecord(userID, source, sourceID, bookID string) error {
+	_, err := r.db.Exec(`INSERT INTO import_record (user_id, source, source_id, book_id, created_at)
+		VALUES ($1, $2, $3, $4, now()) ON CONFLICT DO NOTHING`, userID, source, sourceID, bookID)
+	if err != nil {
+		return fmt.Errorf("Creating import record: %w", err)
+	}
+
+	return nil
+}
+
+// SaveRating keeps one rating per user and book, replacing an earlier one.
+func (r *repository) SaveRating(bookID, userID string, rating int) error {
+	_, err := r.db.Exec(`INSERT INTO book_rating (book_id, user_id, rating, updated_at) VALUES ($1, $2, $3, now())
+		ON CONFLICT (book_id, user_id) DO UPDATE SET rating = EXCLUDED.rating, updated_at = EXCLUDED.updated_at`,
+		bookID, userID, rating)
+	if err != nil {
+		return fmt.Errorf("Saving book rating: %w", err)
+	}
+
+	return nil
+}
+
+// SaveShelves files the book under the user's shelves. Shelves it is already
+// on are kept.
+func (r *repository) SaveShelves(bookID, userID string, shelves []string) error {
+	_, err := r.db.Exec(`INSERT INTO book_shelf (book_id, user_id, shelf, created_at)
+		SELECT $1, $2, shelf, now() FROM unnest($3::text[]) AS shelf
+		ON CONFLICT DO NOTHING`, bookID, userID, pq.StringArray(shelves))
+	if err != nil {
+		return fmt.Errorf("Saving book shelves: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,315 @@
+package library
+
+import (
+	"bytes"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/axwilliams/book-api/internal/business/book"
+	"github.com/axwilliams/book-api/internal/business/series"
+	"github.com/axwilliams/book-api/internal/business/tag"
+	"github.com/axwilliams/book-api/internal/platform/policy"
+	"github.com/axwilliams/book-api/internal/platform/web"
+	"github.com/google/uuid"
+)
+
+// queueSize is how many imports may wait for the worker before new ones are
+// turned away.
+const queueSize = 16
+
+var (
+	ErrInvalidID       = errors.New("ID is not in the correct form")
+	ErrInvalidSource   = errors.New("source must be calibre or goodreads")
+	ErrInvalidFile     = errors.New("Unable to read the library export")
+	ErrQueueFull       = errors.New("Too many imports are waiting, try again later")
+	ErrAlreadyImported = errors.New("Already imported")
+	ErrNoISBN          = errors.New("Entry has no valid ISBN")
+	ErrIncompleteEntry = errors.New("Entry has no title or author")
+	ErrInterrupted     = errors.New("Import was interrupted by a restart")
+)
+
+type Service interface {
+	Start(source string, data []byte, sub policy.Subject) (*Job, error)
+	Job(id, actorID string, admin bool) (*Job, error)
+	Process(stop <-chan struct{}) (*Job, error)
+	FailUnfinished() (int, error)
+}
+
+// task is a queued import. The books are created and tagged as sub, so that
+// the same policies apply as to books added one by one.
+type task struct {
+	job     Job
+	entries []Entry
+	sub     policy.Subject
+}
+
+type service struct {
+	lr    Repository
+	bs    book.Service
+	br    book.Repository
+	ts    tag.Service
+	sr    series.Repository
+	pe    *policy.Engine
+	queue chan task
+}
+
+func NewService(lr Repository, bs book.Service, br book.Repository, ts tag.Service, sr series.Repository, pe *policy.Engine) Service {
+	return &service{
+		lr,
+		bs,
+		br,
+		ts,
+		sr,
+		pe,
+		make(chan task, queueSize),
+	}
+}
+
+// Start reads the export and queues it for the worker. The file is read up
+// front so that a malformed upload is rejected before a job exists, and the
+// attributes of sub are loaded once for all of its entries.
+func (s *service) Start(source string, data []byte, sub policy.Subject) (*Job, error) {
+	var es []Entry
+	var err error
+
+	switch source {
+	case SourceCalibre:
+		es, err = ReadCalibre(data)
+	case SourceGoodreads:
+		es, err = ReadGoodreads(bytes.NewReader(data))
+	default:
+		return nil, web.NewRequestError(ErrInvalidSource, http.StatusBadRequest)
+	}
+	if err != nil {
+		return nil, web.NewRequestError(ErrInvalidFile, http.StatusBadRequest)
+	}
+
+	if len(s.queue) == cap(s.queue) {
+		return nil, web.NewRequestError(ErrQueueFull, http.StatusServiceUnavailable)
+	}
+
+	if sub, err = s.pe.Resolve(sub); err != nil {
+		return nil, err
+	}
+
+	now := time.Now().UTC()
+	j := Job{
+		ID:        uuid.New().String(),
+		UserID:    sub.ID,
+		Source:    source,
+		Status:    StatusQueued,
+		Total:     len(es),
+		Report:    NewReport(),
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+
+	if err := s.lr.CreateJob(&j); err != nil {
+		return nil, err
+	}
+
+	select {
+	case s.queue <- task{j, es, sub}:
+	default:
+		j.Status, j.Error, j.UpdatedAt = StatusFailed, ErrQueueFull.Error(), time.Now().UTC()
+		if err := s.lr.UpdateJob(&j); err != nil {
+			return nil, err
+		}
+		return nil, web.NewRequestError(ErrQueueFull, http.StatusServiceUnavailable)
+	}
+
+	return &j, nil
+}
+
+// Job shows an import to the user who started it, or to an admin.
+func (s *service) Job(id, actorID string, admin bool) (*Job, error) {
+	if _, err := uuid.Parse(id); err != nil {
+		return nil, web.NewRequestError(ErrInvalidID, http.StatusBadRequest)
+	}
+
+	j, err := s.lr.GetJob(id)
+	switch {
+	case err == ErrNoJobFound || (err == nil && j.UserID != actorID && !admin):
+		return nil, web.NewRequestError(ErrNoJobFound, http.StatusNotFound)
+	case err != nil:
+		return nil, err
+	}
+
+	return j, nil
+}
+
+func (s *service) FailUnfinished() (int, error) {
+	return s.lr.FailUnfinished(ErrInterrupted.Error())
+}
+
+// Process waits for the next queued import and runs it, saving progress
+// after every entry. It returns a nil job once stop is closed. An error
+// fails the job; entries imported before it are kept and are skipped as
+// already imported when the export is uploaded again.
+func (s *service) Process(stop <-chan struct{}) (*Job, error) {
+	var t task
+	select {
+	case <-stop:
+		return nil, nil
+	case t = <-s.queue:
+	}
+
+	j := &t.job
+	j.Status = StatusRunning
+	if err := s.save(j); err != nil {
+		return j, err
+	}
+
+	for i, e := range t.entries {
+		res, dup, err := s.importEntry(j, t.sub, i, e)
+		if err != nil {
+			j.Status, j.Error = StatusFailed, err.Error()
+			s.save(j)
+			return j, err
+		}
+
+		switch {
+		case res.Reason != "":
+			j.Report.Skipped = append(j.Report.Skipped, *res)
+		case dup:
+			j.Report.Duplicates = append(j.Report.Duplicates, *res)
+		default:
+			j.Report.Created = append(j.Report.Created, *res)
+		}
+
+		j.Processed = i + 1
+		if err := s.save(j); err != nil {
+			return j, err
+		}
+	}
+
+	j.Status = StatusDone
+	return j, s.save(j)
+}
+
+func (s *service) save(j *Job) error {
+	j.UpdatedAt = time.Now().UTC()
+	return s.lr.UpdateJob(j)
+}
+
+// importEntry finds or creates the book for one entry. Entries are
+// remembered per user, source and source ID, which makes importing the same
+// export twice a no-op. A result with a reason was skipped; dup reports a
+// book that was already in the catalog. Entries the policies do not let the
+// user add are skipped.
+func (s *service) importEntry(j *Job, sub policy.Subject, i int, e Entry) (*Result, bool, error) {
+	res := &Result{Entry: i + 1, SourceID: e.SourceID, Title: e.Title}
+
+	if e.SourceID == "" {
+		e.SourceID = book.NormalizeISBN(e.ISBN)
+		res.SourceID = e.SourceID
+	}
+
+	if e.SourceID != "" {
+		bookID, err := s.lr.GetRecord(j.UserID, j.Source, e.SourceID)
+		switch {
+		case err == nil:
+			res.BookID, res.Reason = bookID, ErrAlreadyImported.Error()
+			return res, false, nil
+		case err != ErrNoRecord:
+			return nil, false, err
+		}
+	}
+
+	if e.Title == "" || len(e.Authors) == 0 {
+		res.Reason = ErrIncompleteEntry.Error()
+		return res, false, nil
+	}
+
+	if book.NormalizeISBN(e.ISBN) == "" {
+		res.Reason = ErrNoISBN.Error()
+		return res, false, nil
+	}
+
+	bk, err := s.br.GetByISBN(e.ISBN)
+	dup := err == nil
+
+	switch {
+	case err == book.ErrNoBookFound:
+		bk, err = s.create(e, sub)
+		if re, ok := err.(*web.RequestError); ok && errors.Is(re.Err, policy.ErrDenied) {
+			res.Reason = re.Err.Error()
+			return res, false, nil
+		}
+		if err != nil {
+			return nil, false, err
+		}
+	case err != nil:
+		return nil, false, err
+	}
+
+	res.BookID = bk.ID
+
+	if err := s.lr.AddRecord(j.UserID, j.Source, e.SourceID, bk.ID); err != nil {
+		return nil, false, err
+	}
+
+	res.Warning = s.annotate(bk.ID, e, sub)
+
+	return res, dup, nil
+}
+
+// create adds the entry as a draft book, putting it in the series of the
+// same name and creating that series when there is none.
+func (s *service) create(e Entry, sub policy.Subject) (*book.Book, error) {
+	nb := &book.NewBook{
+		ISBN:        e.ISBN,
+		Title:       e.Title,
+		Author:      strings.Join(e.Authors, "; "),
+		Description: e.Description,
+	}
+
+	if len(e.Tags) > 0 {
+		nb.Category = e.Tags[0]
+	}
+
+	if e.Series != "" {
+		sr, err := s.sr.GetByName(e.Series)
+		switch {
+		case err == series.ErrNoSeriesFound:
+			sr = &series.Series{ID: uuid.New().String(), Name: e.Series}
+			if err := s.sr.Create(sr); err != nil {
+				return nil, err
+			}
+		case err != nil:
+			return nil, err
+		}
+
+		nb.SeriesID, nb.SeriesPosition = sr.ID, e.SeriesIndex
+	}
+
+	return s.bs.Create(nb, sub)
+}
+
+// annotate adds the user's tags, shelves and rating to a book. They are
+// extras, so a failure is reported on the result instead of failing it.
+func (s *service) annotate(bookID string, e Entry, sub policy.Subject) string {
+	warnings := []string{}
+
+	if len(e.Tags) > 0 {
+		if _, err := s.ts.Tag(bookID, "", e.Tags, sub); err != nil {
+			warnings = append(warnings, "Tagging: "+err.Error())
+		}
+	}
+
+	if len(e.Shelves) > 0 {
+		if err := s.lr.SaveShelves(bookID, sub.ID, e.Shelves); err != nil {
+			warnings = append(warnings, "Shelving: "+err.Error())
+		}
+	}
+
+	if e.Rating > 0 {
+		if err := s.lr.SaveRating(bookID, sub.ID, e.Rating); err != nil {
+			warnings = append(warnings, "Rating: "+err.Error())
+		}
+	}
+
+	return strings.Join(warnings, "; ")
+}
@@ -0,0 +1,138 @@
+package library_test
+
+import (
+	"io/ioutil"
+	"net/http"
+	"testing"
+
+	"github.com/axwilliams/book-api/internal/business/book"
+	"github.com/axwilliams/book-api/internal/business/library"
+	"github.com/axwilliams/book-api/internal/business/tag"
+	"github.com/axwilliams/book-api/internal/platform/policy"
+	"github.com/axwilliams/book-api/internal/platform/web"
+	"github.com/axwilliams/book-api/internal/test"
+	"github.com/axwilliams/book-api/internal/test/mock"
+)
+
+const userID = "bad069ce-4afa-4a53-a673-14ae7b627d06"
+
+func newService() library.Service {
+	mb := mock.NewMockBook()
+	return library.NewService(
+		mock.NewMockLibrary(),
+		book.NewService(mb, policy.NewEngine("")),
+		mb,
+		tag.NewService(mock.NewMockTag(), mb, policy.NewEngine("")),
+		mock.NewMockSeries(),
+		policy.NewEngine(""),
+	)
+}
+
+func run(t *testing.T, ls library.Service, data []byte) *library.Job {
+	j, err := ls.Start(library.SourceGoodreads, data, policy.Subject{ID: userID})
+	if err != nil {
+		t.Fatalf("\t%s\tStarting the import failed: %v", test.Failed, err)
+	}
+	if j.Status != library.StatusQueued || j.Total != 4 {
+		t.Fatalf("\t%s\tWrong queued job: %+v", test.Failed, j)
+	}
+
+	done, err := ls.Process(make(chan struct{}))
+	if err != nil || done.ID != j.ID || done.Status != library.StatusDone || done.Processed != 4 {
+		t.Fatalf("\t%s\tImport did not finish: %v %+v", test.Failed, err, done)
+	}
+
+	saved, err := ls.Job(j.ID, userID, false)
+	if err != nil || saved.Status != library.StatusDone {
+		t.Fatalf("\t%s\tProgress was not saved: %v %+v", test.Failed, err, saved)
+	}
+
+	return saved
+}
+
+func TestImport(t *testing.T) {
+	data, err := ioutil.ReadFile("testdata/goodreads_library_export.csv")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ls := newService()
+
+	first := run(t, ls, data)
+	rep := first.Report
+
+	if len(rep.Created) != 2 || rep.Created[0].Title != "The Fellowship of the Ring" || rep.Created[1].Title != "The Catcher in the Rye" {
+		t.Fatalf("\t%s\tWrong created books: %+v", test.Failed, rep.Created)
+	}
+	if len(rep.Duplicates) != 1 || rep.Duplicates[0].BookID != "71432eb9-58da-4eae-aa20-ccc49064246f" {
+		t.Fatalf("\t%s\tWrong duplicates: %+v", test.Failed, rep.Duplicates)
+	}
+	if len(rep.Skipped) != 1 || rep.Skipped[0].Reason != library.ErrNoISBN.Error() {
+		t.Fatalf("\t%s\tWrong skipped entries: %+v", test.Failed, rep.Skipped)
+	}
+	t.Logf("\t%s\tFirst import created, matched and skipped entries", test.Success)
+
+	second := run(t, ls, data)
+	rep = second.Report
+
+	if len(rep.Created) != 0 || len(rep.Duplicates) != 0 || len(rep.Skipped) != 4 {
+		t.Fatalf("\t%s\tSecond import should skip everything: %+v", test.Failed, rep)
+	}
+	for _, res := range rep.Skipped {
+		if res.Title != "Good Omens" && (res.Reason != library.ErrAlreadyImported.Error() || res.BookID == "") {
+			t.Fatalf("\t%s\tWrong skipped entry: %+v", test.Failed, res)
+		}
+	}
+	t.Logf("\t%s\tSecond import was a no-op", test.Success)
+}
+
+func TestStartAndJob(t *testing.T) {
+	ls := newService()
+
+	samples := []struct {
+		source     string
+		data       string
+		statusCode int
+	}{
+		{"kindle", "", http.StatusBadRequest},
+		{library.SourceCalibre, "not a database", http.StatusBadRequest},
+		{library.SourceGoodreads, "Name,Value\n", http.StatusBadRequest},
+	}
+
+	for _, sample := range samples {
+		_, err := ls.Start(sample.source, []byte(sample.data), policy.Subject{ID: userID})
+		if re, ok := err.(*web.RequestError); !ok || re.Status != sample.statusCode {
+			t.Fatalf("\t%s\tWrong error for %s: %v", test.Failed, sample.source, err)
+		}
+	}
+	t.Logf("\t%s\tInvalid uploads rejected", test.Success)
+
+	jobID := "9b1e4c2d-7a3f-4e6b-8c5d-0f2a1b3c4d5e"
+	other := "0e9a6d55-3c7b-4f2e-8a1d-6b5c4d3e2f10"
+
+	jobs := []struct {
+		id         string
+		actorID    string
+		admin      bool
+		statusCode int
+	}{
+		{"not-a-uuid", userID, false, http.StatusBadRequest},
+		{jobID, other, false, http.StatusNotFound},
+		{jobID, other, true, http.StatusOK},
+		{jobID, userID, false, http.StatusOK},
+	}
+
+	for _, sample := range jobs {
+		j, err := ls.Job(sample.id, sample.actorID, sample.admin)
+		if sample.statusCode == http.StatusOK {
+			if err != nil || j.ID != jobID {
+				t.Fatalf("\t%s\tJob should be visible: %v", test.Failed, err)
+			}
+			continue
+		}
+		if re, ok := err.(*web.RequestError); !ok || re.Status != sample.statusCode {
+			t.Fatalf("\t%s\tWrong error for job %s: %v", test.Failed, sample.id, err)
+		}
+	}
+	t.Logf("\t%s\tJobs only shown to their owner and admins", test.Success)
+}
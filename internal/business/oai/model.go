@@ -0,0 +1,79 @@
+package oai
+
+import (
+	"strings"
+	"unicode"
+)
+
+const (
+	VerbIdentify            = "Identify"
+	VerbListMetadataFormats = "ListMetadataFormats"
+	VerbListSets            = "ListSets"
+	VerbGetRecord           = "GetRecord"
+	VerbListIdentifiers     = "ListIdentifiers"
+	VerbListRecords         = "ListRecords"
+)
+
+// Error codes defined by the protocol. They are reported inside a normal
+// 200 response rather than as HTTP errors.
+const (
+	CodeBadArgument             = "badArgument"
+	CodeBadResumptionToken      = "badResumptionToken"
+	CodeBadVerb                 = "badVerb"
+	CodeCannotDisseminateFormat = "cannotDisseminateFormat"
+	CodeIDDoesNotExist          = "idDoesNotExist"
+	CodeNoRecordsMatch          = "noRecordsMatch"
+)
+
+const (
+	MetadataPrefixDC = "oai_dc"
+
+	ContentType = "text/xml; charset=utf-8"
+
+	// Granularity is the finest datestamp precision; harvesters may also
+	// send plain dates.
+	Granularity = "YYYY-MM-DDThh:mm:ssZ"
+
+	dayLayout    = "2006-01-02"
+	secondLayout = "2006-01-02T15:04:05Z"
+)
+
+// Config describes the repository in Identify responses. Identifier is the
+// namespace of record identifiers, usually the repository's domain name.
+type Config struct {
+	Name       string
+	Identifier string
+	AdminEmail string
+}
+
+// Error is a protocol error.
+type Error struct {
+	Code    string
+	Message string
+}
+
+func (e *Error) Error() string {
+	return e.Code + ": " + e.Message
+}
+
+// SetSpec turns a category into a set name. The protocol restricts set
+// names to a few ASCII characters, so everything else collapses into a
+// dash: "Science Fiction" is science-fiction.
+func SetSpec(category string) string {
+	var b strings.Builder
+	dash := false
+
+	for _, r := range strings.ToLower(category) {
+		if r < unicode.MaxASCII && (unicode.IsLetter(r) || unicode.IsDigit(r)) {
+			if dash && b.Len() > 0 {
+				b.WriteByte('-')
+			}
+			b.WriteRune(r)
+			dash = false
+			continue
+		}
+		dash = true
+	}
+
+	return b.String()
+}
@@ -0,0 +1,28 @@
+package oai_test
+
+import (
+	"testing"
+
+	"github.com/axwilliams/book-api/internal/business/oai"
+	"github.com/axwilliams/book-api/internal/test"
+)
+
+func TestSetSpec(t *testing.T) {
+	samples := []struct {
+		category string
+		expected string
+	}{
+		{"Fiction", "fiction"},
+		{"Science Fiction", "science-fiction"},
+		{"  Arts & Crafts ", "arts-crafts"},
+		{"Café", "caf"},
+		{"日本", ""},
+	}
+
+	for _, sample := range samples {
+		if res := oai.SetSpec(sample.category); res != sample.expected {
+			t.Fatalf("\t%s\tWrong set for %q: want %q got %q", test.Failed, sample.category, sample.expected, res)
+		}
+		t.Logf("\t%s\tSet for %q correct", test.Success, sample.category)
+	}
+}
@@ -0,0 +1,449 @@
+package oai
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/axwilliams/book-api/internal/business/book"
+	"github.com/google/uuid"
+)
+
+// PageSize is the number of headers or records per ListIdentifiers or
+// ListRecords response.
+const PageSize = 100
+
+type Service interface {
+	Handle(args url.Values, baseURL string) (*Response, error)
+}
+
+type service struct {
+	br  book.Repository
+	cfg Config
+}
+
+func NewService(br book.Repository, cfg Config) Service {
+	return &service{
+		br,
+		cfg,
+	}
+}
+
+// arguments lists what each verb accepts. An exclusive argument may only
+// appear alongside the verb.
+var arguments = map[string]struct {
+	required  []string
+	optional  []string
+	exclusive string
+}{
+	VerbIdentify:            {},
+	VerbListMetadataFormats: {optional: []string{"identifier"}},
+	VerbListSets:            {exclusive: "resumptionToken"},
+	VerbGetRecord:           {required: []string{"identifier", "metadataPrefix"}},
+	VerbListIdentifiers:     {required: []string{"metadataPrefix"}, optional: []string{"from", "until", "set"}, exclusive: "resumptionToken"},
+	VerbListRecords:         {required: []string{"metadataPrefix"}, optional: []string{"from", "until", "set"}, exclusive: "resumptionToken"},
+}
+
+// Handle answers one protocol request. Protocol errors are part of the
+// response; the returned error is only set when the catalog can't be read.
+func (s *service) Handle(args url.Values, baseURL string) (*Response, error) {
+	resp := &Response{
+		Xmlns:          nsOAI,
+		XmlnsXSI:       nsXSI,
+		SchemaLocation: nsOAI + " http://www.openarchives.org/OAI/2.0/OAI-PMH.xsd",
+		ResponseDate:   time.Now().UTC().Format(secondLayout),
+		Request:        request{BaseURL: baseURL},
+	}
+
+	if oerr := validArguments(args); oerr != nil {
+		resp.Errors = []xmlError{{Code: oerr.Code, Message: oerr.Message}}
+		return resp, nil
+	}
+
+	resp.Request = request{
+		Verb:            args.Get("verb"),
+		Identifier:      args.Get("identifier"),
+		MetadataPrefix:  args.Get("metadataPrefix"),
+		From:            args.Get("from"),
+		Until:           args.Get("until"),
+		Set:             args.Get("set"),
+		ResumptionToken: args.Get("resumptionToken"),
+		BaseURL:         baseURL,
+	}
+
+	var err error
+	switch args.Get("verb") {
+	case VerbIdentify:
+		err = s.identify(resp, baseURL)
+	case VerbListMetadataFormats:
+		err = s.listMetadataFormats(resp, args)
+	case VerbListSets:
+		err = s.listSets(resp, args)
+	case VerbGetRecord:
+		err = s.getRecord(resp, args)
+	case VerbListIdentifiers, VerbListRecords:
+		err = s.list(resp, args)
+	}
+
+	if oerr, ok := err.(*Error); ok {
+		resp.Errors = []xmlError{{Code: oerr.Code, Message: oerr.Message}}
+		return resp, nil
+	}
+
+	return resp, err
+}
+
+func validArguments(args url.Values) *Error {
+	verb := args["verb"]
+	if len(verb) != 1 {
+		return &Error{CodeBadVerb, "Exactly one verb is required"}
+	}
+
+	spec, ok := arguments[verb[0]]
+	if !ok {
+		return &Error{CodeBadVerb, "Unknown verb " + verb[0]}
+	}
+
+	allowed := map[string]bool{"verb": true, spec.exclusive: spec.exclusive != ""}
+	for _, a := range append(spec.required, spec.optional...) {
+		allowed[a] = true
+	}
+
+	for name, values := range args {
+		if !allowed[name] {
+			return &Error{CodeBadArgument, "Illegal argument " + name}
+		}
+		if len(values) > 1 {
+			return &Error{CodeBadArgument, "Repeated argument " + name}
+		}
+	}
+
+	if spec.exclusive != "" && args.Get(spec.exclusive) != "" {
+		if len(args) > 2 {
+			return &Error{CodeBadArgument, spec.exclusive + " is an exclusive argument"}
+		}
+		return nil
+	}
+
+	for _, a := range spec.required {
+		if args.Get(a) == "" {
+			return &Error{CodeBadArgument, "Missing argument " + a}
+		}
+	}
+
+	return nil
+}
+
+func (s *service) identify(resp *Response, baseURL string) error {
+	earliest := time.Unix(0, 0)
+
+	bks, err := s.br.Harvest(book.Harvest{Status: book.StatusPublished}, 1)
+	if err != nil {
+		return err
+	}
+	if len(bks) > 0 {
+		earliest = bks[0].UpdatedAt
+	}
+
+	resp.Identify = &identify{
+		RepositoryName:    s.cfg.Name,
+		BaseURL:           baseURL,
+		ProtocolVersion:   "2.0",
+		AdminEmail:        s.cfg.AdminEmail,
+		EarliestDatestamp: datestamp(earliest),
+		DeletedRecord:     "no",
+		Granularity:       Granularity,
+	}
+
+	return nil
+}
+
+func (s *service) listMetadataFormats(resp *Response, args url.Values) error {
+	if id := args.Get("identifier"); id != "" {
+		if _, err := s.published(id); err != nil {
+			return err
+		}
+	}
+
+	resp.ListMetadataFormats = &listMetadataFormats{
+		Formats: []metadataFormat{{
+			MetadataPrefix:    MetadataPrefixDC,
+			Schema:            schemaDC,
+			MetadataNamespace: nsOAIDC,
+		}},
+	}
+
+	return nil
+}
+
+func (s *service) listSets(resp *Response, args url.Values) error {
+	if args.Get("resumptionToken") != "" {
+		return &Error{CodeBadResumptionToken, "Sets are listed in one response"}
+	}
+
+	fs, err := s.br.Facets(book.FacetCategory, book.StatusPublished)
+	if err != nil {
+		return err
+	}
+
+	resp.ListSets = &listSets{}
+	for _, f := range fs {
+		if spec := SetSpec(f.Name); spec != "" {
+			resp.ListSets.Sets = append(resp.ListSets.Sets, set{Spec: spec, Name: f.Name})
+		}
+	}
+
+	return nil
+}
+
+func (s *service) getRecord(resp *Response, args url.Values) error {
+	if args.Get("metadataPrefix") != MetadataPrefixDC {
+		return &Error{CodeCannotDisseminateFormat, "Only oai_dc is supported"}
+	}
+
+	bk, err := s.published(args.Get("identifier"))
+	if err != nil {
+		return err
+	}
+
+	resp.GetRecord = &getRecord{s.record(*bk)}
+
+	return nil
+}
+
+// published looks up a published book by its OAI identifier.
+func (s *service) published(identifier string) (*book.Book, error) {
+	notFound := &Error{CodeIDDoesNotExist, "No record " + identifier}
+
+	prefix := "oai:" + s.cfg.Identifier + ":"
+	if !strings.HasPrefix(identifier, prefix) {
+		return nil, notFound
+	}
+
+	id := strings.TrimPrefix(identifier, prefix)
+	if _, err := uuid.Parse(id); err != nil {
+		return nil, notFound
+	}
+
+	bk, err := s.br.GetById(id)
+	switch {
+	case err == book.ErrNoBookFound:
+		return nil, notFound
+	case err != nil:
+		return nil, err
+	case bk.Status != book.StatusPublished:
+		return nil, notFound
+	}
+
+	return bk, nil
+}
+
+// token carries a harvest from one page to the next.
+type token struct {
+	Prefix  string       `json:"p"`
+	Harvest book.Harvest `json:"h"`
+	Cursor  int          `json:"c"`
+}
+
+func (t token) encode() string {
+	b, _ := json.Marshal(t)
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+func decodeToken(s string) (token, bool) {
+	t := token{}
+
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return t, false
+	}
+
+	if err := json.Unmarshal(b, &t); err != nil || t.Prefix != MetadataPrefixDC || t.Cursor < 0 {
+		return t, false
+	}
+
+	// Every token resumes after a book, and its ID goes to the database as is.
+	id, err := uuid.Parse(t.Harvest.AfterID)
+	if err != nil {
+		return t, false
+	}
+	t.Harvest.AfterID = id.String()
+
+	return t, true
+}
+
+func (s *service) list(resp *Response, args url.Values) error {
+	tk, resumed := token{}, args.Get("resumptionToken") != ""
+
+	if resumed {
+		var ok bool
+		if tk, ok = decodeToken(args.Get("resumptionToken")); !ok {
+			return &Error{CodeBadResumptionToken, "Invalid resumption token"}
+		}
+	} else {
+		var err error
+		if tk, err = s.newToken(args); err != nil {
+			return err
+		}
+	}
+
+	tk.Harvest.Status = book.StatusPublished
+
+	bks, err := s.br.Harvest(tk.Harvest, PageSize+1)
+	if err != nil {
+		return err
+	}
+
+	if len(bks) == 0 {
+		return &Error{CodeNoRecordsMatch, "No records match the request"}
+	}
+
+	var rt *resumptionToken
+	if len(bks) > PageSize {
+		bks = bks[:PageSize]
+
+		next := tk
+		next.Harvest.AfterTime = bks[len(bks)-1].UpdatedAt
+		next.Harvest.AfterID = bks[len(bks)-1].ID
+		next.Cursor += PageSize
+
+		rt = &resumptionToken{Cursor: tk.Cursor, Token: next.encode()}
+	} else if resumed {
+		rt = &resumptionToken{Cursor: tk.Cursor}
+	}
+
+	if args.Get("verb") == VerbListIdentifiers {
+		resp.ListIdentifiers = &listIdentifiers{ResumptionToken: rt}
+		for _, bk := range bks {
+			resp.ListIdentifiers.Headers = append(resp.ListIdentifiers.Headers, s.header(bk))
+		}
+		return nil
+	}
+
+	resp.ListRecords = &listRecords{ResumptionToken: rt}
+	for _, bk := range bks {
+		resp.ListRecords.Records = append(resp.ListRecords.Records, s.record(bk))
+	}
+
+	return nil
+}
+
+// newToken starts a harvest from the selective harvesting arguments.
+func (s *service) newToken(args url.Values) (token, error) {
+	tk := token{Prefix: args.Get("metadataPrefix")}
+
+	if tk.Prefix != MetadataPrefixDC {
+		return tk, &Error{CodeCannotDisseminateFormat, "Only oai_dc is supported"}
+	}
+
+	from, fromDay, err := parseDatestamp(args.Get("from"))
+	if err != nil {
+		return tk, &Error{CodeBadArgument, "Invalid from date"}
+	}
+
+	until, untilDay, err := parseDatestamp(args.Get("until"))
+	if err != nil {
+		return tk, &Error{CodeBadArgument, "Invalid until date"}
+	}
+
+	if !from.IsZero() && !until.IsZero() {
+		if fromDay != untilDay {
+			return tk, &Error{CodeBadArgument, "from and until must have the same granularity"}
+		}
+		if from.After(until) {
+			return tk, &Error{CodeBadArgument, "from is later than until"}
+		}
+	}
+
+	// until is inclusive, up to the end of the day or second it names.
+	if !until.IsZero() {
+		if untilDay {
+			until = until.AddDate(0, 0, 1)
+		} else {
+			until = until.Add(time.Second)
+		}
+	}
+
+	tk.Harvest.From, tk.Harvest.Until = from, until
+
+	if spec := args.Get("set"); spec != "" {
+		fs, err := s.br.Facets(book.FacetCategory, book.StatusPublished)
+		if err != nil {
+			return tk, err
+		}
+
+		for _, f := range fs {
+			if SetSpec(f.Name) == spec {
+				tk.Harvest.Category = f.Name
+				break
+			}
+		}
+
+		if tk.Harvest.Category == "" {
+			return tk, &Error{CodeNoRecordsMatch, "No set " + spec}
+		}
+	}
+
+	return tk, nil
+}
+
+// parseDatestamp accepts either granularity and reports whether s was a
+// plain date. An empty s is the zero time.
+func parseDatestamp(s string) (time.Time, bool, error) {
+	if s == "" {
+		return time.Time{}, false, nil
+	}
+
+	if t, err := time.Parse(dayLayout, s); err == nil {
+		return t, true, nil
+	}
+
+	t, err := time.Parse(secondLayout, s)
+	return t, false, err
+}
+
+func datestamp(t time.Time) string {
+	return t.UTC().Format(secondLayout)
+}
+
+func (s *service) header(bk book.Book) header {
+	h := header{
+		Identifier: "oai:" + s.cfg.Identifier + ":" + bk.ID,
+		Datestamp:  datestamp(bk.UpdatedAt),
+	}
+
+	if spec := SetSpec(bk.Category); spec != "" {
+		h.SetSpecs = []string{spec}
+	}
+
+	return h
+}
+
+func (s *service) record(bk book.Book) record {
+	d := dc{
+		XmlnsOAIDC:     nsOAIDC,
+		XmlnsDC:        nsDC,
+		XmlnsXSI:       nsXSI,
+		SchemaLocation: nsOAIDC + " " + schemaDC,
+		Title:          bk.Title,
+		Description:    bk.Description,
+		Type:           "Text",
+		Identifiers:    []string{"urn:uuid:" + bk.ID},
+	}
+
+	if bk.Author != "" {
+		d.Creators = []string{bk.Author}
+	}
+
+	if bk.Category != "" {
+		d.Subjects = []string{bk.Category}
+	}
+
+	if bk.ISBN != "" {
+		d.Identifiers = append(d.Identifiers, "urn:isbn:"+bk.ISBN)
+	}
+
+	return record{Header: s.header(bk), Metadata: metadata{d}}
+}
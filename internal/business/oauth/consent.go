@@ -0,0 +1,67 @@
+package oauth
+
+import (
+	"html/template"
+	"io"
+)
+
+// ContentTypeHTML is the content type of the consent and error pages.
+const ContentTypeHTML = "text/html; charset=utf-8"
+
+// The user logs in on the consent page itself, so the client never sees the
+// password. The request parameters travel in hidden fields and are checked
+// again when the form is posted.
+var consentPage = template.Must(template.New("consent").Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<title>Authorize {{.ClientName}}</title>
+</head>
+<body>
+<main>
+<h1>Authorize {{.ClientName}}</h1>
+<p>{{.ClientName}} would like to use the Books API on your behalf{{if .Scopes}} with the roles{{range .Scopes}} <strong>{{.}}</strong>{{end}}, where you hold them{{end}}.</p>
+{{if .Message}}<p role="alert">{{.Message}}</p>{{end}}
+<form method="post">
+{{range $k, $v := .Values}}<input type="hidden" name="{{$k}}" value="{{index $v 0}}">
+{{end}}<label>Username <input name="username" autocomplete="username" required></label>
+<label>Password <input name="password" type="password" autocomplete="current-password" required></label>
+<button name="decision" value="allow">Allow</button>
+<button name="decision" value="deny" formnovalidate>Deny</button>
+</form>
+</main>
+</body>
+</html>
+`))
+
+var errorPage = template.Must(template.New("error").Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<title>Authorization failed</title>
+</head>
+<body>
+<main>
+<h1>Authorization failed</h1>
+<p>{{.Description}} ({{.Code}})</p>
+</main>
+</body>
+</html>
+`))
+
+// RenderConsent writes the consent page, with message shown above the form,
+// e.g. after a failed login.
+func RenderConsent(w io.Writer, c *Consent, message string) error {
+	return consentPage.Execute(w, struct {
+		*Consent
+		Values  map[string][]string
+		Message string
+	}{c, c.Request.Values(), message})
+}
+
+// RenderError writes the page shown for errors that cannot go back to the
+// client.
+func RenderError(w io.Writer, e *Error) error {
+	return errorPage.Execute(w, e)
+}
@@ -0,0 +1,191 @@
+package oauth
+
+import (
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+const (
+	GrantAuthorizationCode = "authorization_code"
+	GrantClientCredentials = "client_credentials"
+)
+
+// Client is an application registered to use the API. Confidential clients
+// have a secret; public clients, e.g. mobile apps, cannot keep one and may
+// only use the authorization code flow, which PKCE protects.
+type Client struct {
+	ID           string         `db:"id" json:"client_id"`
+	Name         string         `db:"name" json:"name"`
+	SecretHash   []byte         `db:"secret_hash" json:"-"`
+	RedirectURIs pq.StringArray `db:"redirect_uris" json:"redirect_uris"`
+	GrantTypes   pq.StringArray `db:"grant_types" json:"grant_types"`
+	Scopes       pq.StringArray `db:"scopes" json:"scopes"`
+	CreatedBy    string         `db:"created_by" json:"created_by"`
+	CreatedAt    time.Time      `db:"created_at" json:"created_at"`
+}
+
+// Confidential reports whether the client has a secret.
+func (c Client) Confidential() bool {
+	return len(c.SecretHash) > 0
+}
+
+type NewClient struct {
+	Name         string   `json:"name" validate:"required"`
+	RedirectURIs []string `json:"redirect_uris"`
+	GrantTypes   []string `json:"grant_types" validate:"required"`
+	Scopes       []string `json:"scopes" validate:"required"`
+	Confidential bool     `json:"confidential"`
+}
+
+// CreatedClient is the one response that carries the client secret.
+type CreatedClient struct {
+	Client
+	Secret string `json:"client_secret,omitempty"`
+}
+
+// Code is an authorization code waiting to be exchanged for a token. Only a
+// hash of it is stored. TokenID is the jti of the token it was exchanged
+// for, so that the token can be revoked when the code is replayed.
+type Code struct {
+	ID            string
+	Hash          []byte
+	ClientID      string
+	UserID        string
+	RedirectURI   string
+	Scopes        pq.StringArray
+	CodeChallenge string
+	CreatedAt     time.Time
+	ExpiresAt     time.Time
+	UsedAt        *time.Time
+	TokenID       string
+}
+
+// AuthorizeRequest holds the parameters of the authorization endpoint.
+type AuthorizeRequest struct {
+	ResponseType        string
+	ClientID            string
+	RedirectURI         string
+	Scope               string
+	State               string
+	CodeChallenge       string
+	CodeChallengeMethod string
+}
+
+func NewAuthorizeRequest(v url.Values) AuthorizeRequest {
+	return AuthorizeRequest{
+		ResponseType:        v.Get("response_type"),
+		ClientID:            v.Get("client_id"),
+		RedirectURI:         v.Get("redirect_uri"),
+		Scope:               v.Get("scope"),
+		State:               v.Get("state"),
+		CodeChallenge:       v.Get("code_challenge"),
+		CodeChallengeMethod: v.Get("code_challenge_method"),
+	}
+}
+
+// Values returns the parameters again, e.g. for the hidden fields of the
+// consent form.
+func (ar AuthorizeRequest) Values() url.Values {
+	v := url.Values{}
+	for k, s := range map[string]string{
+		"response_type":         ar.ResponseType,
+		"client_id":             ar.ClientID,
+		"redirect_uri":          ar.RedirectURI,
+		"scope":                 ar.Scope,
+		"state":                 ar.State,
+		"code_challenge":        ar.CodeChallenge,
+		"code_challenge_method": ar.CodeChallengeMethod,
+	} {
+		if s != "" {
+			v.Set(k, s)
+		}
+	}
+	return v
+}
+
+// Consent is what the user is asked to approve.
+type Consent struct {
+	Request    AuthorizeRequest
+	ClientName string
+	Scopes     []string
+}
+
+// TokenRequest holds the parameters of the token endpoint.
+type TokenRequest struct {
+	GrantType    string
+	Code         string
+	RedirectURI  string
+	CodeVerifier string
+	Scope        string
+	ClientID     string
+	ClientSecret string
+}
+
+// Token is the token endpoint's response (RFC 6749 section 5.1).
+type Token struct {
+	AccessToken string `json:"access_token"`
+	TokenType   string `json:"token_type"`
+	ExpiresIn   int64  `json:"expires_in"`
+	Scope       string `json:"scope"`
+}
+
+// Introspection describes a token to a resource server (RFC 7662).
+type Introspection struct {
+	Active      bool     `json:"active"`
+	Scope       string   `json:"scope,omitempty"`
+	ClientID    string   `json:"client_id,omitempty"`
+	Subject     string   `json:"sub,omitempty"`
+	Roles       []string `json:"roles,omitempty"`
+	Permissions []string `json:"permissions,omitempty"`
+	TokenType   string   `json:"token_type,omitempty"`
+	ExpiresAt   int64    `json:"exp,omitempty"`
+	IssuedAt    int64    `json:"iat,omitempty"`
+	NotBefore   int64    `json:"nbf,omitempty"`
+	Issuer      string   `json:"iss,omitempty"`
+	Audience    string   `json:"aud,omitempty"`
+	TokenID     string   `json:"jti,omitempty"`
+}
+
+// Error is an OAuth error (RFC 6749 sections 4.1.2.1 and 5.2). Errors of the
+// authorization endpoint go back to the client's redirect URI once that URI
+// is known to be registered; until then they are shown to the user.
+type Error struct {
+	Code        string `json:"error"`
+	Description string `json:"error_description,omitempty"`
+	Status      int    `json:"-"`
+
+	redirectURI string
+	state       string
+}
+
+func (e *Error) Error() string {
+	return e.Description
+}
+
+// Redirect returns where to send the user agent with the error, if
+// anywhere.
+func (e *Error) Redirect() (string, bool) {
+	if e.redirectURI == "" {
+		return "", false
+	}
+
+	v := url.Values{}
+	v.Set("error", e.Code)
+	v.Set("error_description", e.Description)
+	if e.state != "" {
+		v.Set("state", e.state)
+	}
+	return withQuery(e.redirectURI, v), true
+}
+
+// withQuery adds v to the query of uri, keeping any query it already has.
+func withQuery(uri string, v url.Values) string {
+	sep := "?"
+	if strings.Contains(uri, "?") {
+		sep = "&"
+	}
+	return uri + sep + v.Encode()
+}
@@ -0,0 +1,177 @@
+package oauth
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+)
+
+var (
+	ErrNoClientFound = errors.New("No client found")
+	ErrNoCodeFound   = errors.New("No authorization code found")
+)
+
+type Repository interface {
+	CreateClient(c *Client) error
+	GetClient(id string) (*Client, error)
+	GetClients() ([]Client, error)
+	DeleteClient(id string) error
+	CreateCode(c *Code) error
+	GetCode(hash []byte) (*Code, error)
+	UseCode(id, tokenID string, at time.Time) (bool, error)
+	GetUsedCodes(userID string, since time.Time) ([]Code, error)
+}
+
+type repository struct {
+	db *sql.DB
+}
+
+func NewRepository(db *sql.DB) Repository {
+	return &repository{
+		db,
+	}
+}
+
+const clientColumns = "id, name, secret_hash, redirect_uris, grant_types, scopes, created_by, created_at"
+
+func scanClient(row interface{ Scan(...interface{}) error }) (*Client, error) {
+	c := &Client{}
+	err := row.Scan(&c.ID, &c.Name, &c.SecretHash, &c.RedirectURIs, &c.GrantTypes, &c.Scopes, &c.CreatedBy, &c.CreatedAt)
+	return c, err
+}
+
+func (r *repository) CreateClient(c *Client) error {
+	_, err := r.db.Exec("INSERT INTO oauth_client ("+clientColumns+") VALUES ($1, $2, $3, $4, $5, $6, $7, $8)",
+		c.ID, c.Name, c.SecretHash, c.RedirectURIs, c.GrantTypes, c.Scopes, c.CreatedBy, c.CreatedAt)
+	if err != nil {
+		return fmt.Errorf("Creating OAuth client: %w", err)
+	}
+
+	return nil
+}
+
+func (r *repository) GetClient(id string) (*Client, error) {
+	c, err := scanClient(r.db.QueryRow("SELECT "+clientColumns+" FROM oauth_client WHERE id = $1", id))
+
+	switch {
+	case err == sql.ErrNoRows:
+		return nil, ErrNoClientFound
+	case err != nil:
+		return nil, fmt.Errorf("Retrieving OAuth client: %w", err)
+	}
+
+	return c, nil
+}
+
+func (r *repository) GetClients() ([]Client, error) {
+	rows, err := r.db.Query("SELECT " + clientColumns + " FROM oauth_client ORDER BY created_at DESC")
+	if err != nil {
+		return nil, fmt.Errorf("Retrieving OAuth clients: %w", err)
+	}
+	defer rows.Close()
+
+	cs := []Client{}
+	for rows.Next() {
+		c, err := scanClient(rows)
+		if err != nil {
+			return nil, fmt.Errorf("Scanning OAuth client rows: %w", err)
+		}
+		cs = append(cs, *c)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("Iterating OAuth client rows: %w", err)
+	}
+
+	return cs, nil
+}
+
+// DeleteClient also deletes the client's codes. Tokens already issued stay
+// valid until they expire or are revoked.
+func (r *repository) DeleteClient(id string) error {
+	res, err := r.db.Exec("DELETE FROM oauth_client WHERE id = $1", id)
+	if err != nil {
+		return fmt.Errorf("Deleting OAuth client: %w", err)
+	}
+
+	count, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("Counting deleted OAuth clients: %w", err)
+	}
+	if count == 0 {
+		return ErrNoClientFound
+	}
+
+	return nil
+}
+
+const codeColumns = "id, code_hash, client_id, user_id, redirect_uri, scopes, code_challenge, created_at, expires_at, used_at, token_id"
+
+func (r *repository) CreateCode(c *Code) error {
+	_, err := r.db.Exec("INSERT INTO oauth_code ("+codeColumns+") VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)",
+		c.ID, c.Hash, c.ClientID, c.UserID, c.RedirectURI, c.Scopes, c.CodeChallenge, c.CreatedAt, c.ExpiresAt, c.UsedAt, c.TokenID)
+	if err != nil {
+		return fmt.Errorf("Creating authorization code: %w", err)
+	}
+
+	return nil
+}
+
+func (r *repository) GetCode(hash []byte) (*Code, error) {
+	c := &Code{}
+	err := r.db.QueryRow("SELECT "+codeColumns+" FROM oauth_code WHERE code_hash = $1", hash).Scan(
+		&c.ID, &c.Hash, &c.ClientID, &c.UserID, &c.RedirectURI, &c.Scopes, &c.CodeChallenge,
+		&c.CreatedAt, &c.ExpiresAt, &c.UsedAt, &c.TokenID)
+
+	switch {
+	case err == sql.ErrNoRows:
+		return nil, ErrNoCodeFound
+	case err != nil:
+		return nil, fmt.Errorf("Retrieving authorization code: %w", err)
+	}
+
+	return c, nil
+}
+
+// UseCode marks a code as exchanged for the token tokenID. It reports false
+// when the code was already used, so that of two concurrent exchanges only
+// one wins.
+func (r *repository) UseCode(id, tokenID string, at time.Time) (bool, error) {
+	res, err := r.db.Exec("UPDATE oauth_code SET used_at = $1, token_id = $2 WHERE id = $3 AND used_at IS NULL", at, tokenID, id)
+	if err != nil {
+		return false, fmt.Errorf("Using authorization code: %w", err)
+	}
+
+	count, err := res.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("Counting used authorization codes: %w", err)
+	}
+
+	return count == 1, nil
+}
+
+// GetUsedCodes returns the codes of a user exchanged after since, whose
+// tokens may still be valid.
+func (r *repository) GetUsedCodes(userID string, since time.Time) ([]Code, error) {
+	rows, err := r.db.Query("SELECT "+codeColumns+" FROM oauth_code WHERE user_id = $1 AND used_at > $2", userID, since)
+	if err != nil {
+		return nil, fmt.Errorf("Retrieving used authorization codes: %w", err)
+	}
+	defer rows.Close()
+
+	cs := []Code{}
+	for rows.Next() {
+		c := Code{}
+		err := rows.Scan(&c.ID, &c.Hash, &c.ClientID, &c.UserID, &c.RedirectURI, &c.Scopes, &c.CodeChallenge,
+			&c.CreatedAt, &c.ExpiresAt, &c.UsedAt, &c.TokenID)
+		if err != nil {
+			return nil, fmt.Errorf("Scanning authorization code rows: %w", err)
+		}
+		cs = append(cs, c)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("Iterating authorization code rows: %w", err)
+	}
+
+	return cs, nil
+}
@@ -0,0 +1,608 @@
+package oauth
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/axwilliams/book-api/internal/business/session"
+	"github.com/axwilliams/book-api/internal/business/user"
+	"github.com/axwilliams/book-api/internal/platform/auth"
+	"github.com/axwilliams/book-api/internal/platform/web"
+	"github.com/google/uuid"
+)
+
+// CodeLifetime is how long an authorization code can be exchanged.
+const CodeLifetime = 10 * time.Minute
+
+// secretTag starts every client secret, so that one is easy to recognize
+// when it leaks.
+const secretTag = "cs_"
+
+var (
+	ErrInvalidID          = errors.New("ID is not in the correct form")
+	ErrInvalidRedirectURI = errors.New("redirect_uris must be absolute https URLs without a fragment, or http on localhost")
+	ErrInvalidGrantType   = errors.New("grant_types must be authorization_code or client_credentials, which needs a confidential client")
+	ErrNoRedirectURI      = errors.New("authorization_code needs at least one redirect URI")
+	ErrInvalidScope       = errors.New("scopes must be roles")
+)
+
+// roles are the scopes a client can be registered for.
+var roles = []string{auth.RoleAdmin, auth.RoleAuthor, auth.RoleCurator}
+
+type Service interface {
+	Register(nc NewClient, createdBy string) (*CreatedClient, error)
+	FindClients() ([]Client, error)
+	DeleteClient(id string) error
+	Authorize(ar AuthorizeRequest) (*Consent, error)
+	Approve(ar AuthorizeRequest, claims auth.Claims) (string, error)
+	Deny(ar AuthorizeRequest) (string, error)
+	Token(tr TokenRequest) (*Token, error)
+	Introspect(clientID, secret, token string) (*Introspection, error)
+	Revoke(clientID, secret, token string) error
+	RevokeAll(userID string) error
+}
+
+type service struct {
+	or Repository
+	ur user.Repository
+	rl *session.RevocationList
+}
+
+func NewService(or Repository, ur user.Repository, rl *session.RevocationList) Service {
+	return &service{
+		or,
+		ur,
+		rl,
+	}
+}
+
+func (s *service) Register(nc NewClient, createdBy string) (*CreatedClient, error) {
+	grants := []string{}
+	for _, g := range nc.GrantTypes {
+		switch {
+		case g != GrantAuthorizationCode && g != GrantClientCredentials,
+			g == GrantClientCredentials && !nc.Confidential:
+			return nil, web.NewRequestError(ErrInvalidGrantType, http.StatusUnprocessableEntity)
+		}
+		if !contains(grants, g) {
+			grants = append(grants, g)
+		}
+	}
+	if len(grants) == 0 {
+		return nil, web.NewRequestError(ErrInvalidGrantType, http.StatusUnprocessableEntity)
+	}
+
+	uris := []string{}
+	for _, uri := range nc.RedirectURIs {
+		if !validRedirectURI(uri) {
+			return nil, web.NewRequestError(ErrInvalidRedirectURI, http.StatusUnprocessableEntity)
+		}
+		if !contains(uris, uri) {
+			uris = append(uris, uri)
+		}
+	}
+	if contains(grants, GrantAuthorizationCode) && len(uris) == 0 {
+		return nil, web.NewRequestError(ErrNoRedirectURI, http.StatusUnprocessableEntity)
+	}
+
+	scopes := []string{}
+	for _, sc := range nc.Scopes {
+		sc = strings.ToUpper(strings.TrimSpace(sc))
+		if !contains(roles, sc) {
+			return nil, web.NewRequestError(ErrInvalidScope, http.StatusUnprocessableEntity)
+		}
+		if !contains(scopes, sc) {
+			scopes = append(scopes, sc)
+		}
+	}
+	if len(scopes) == 0 {
+		return nil, web.NewRequestError(ErrInvalidScope, http.StatusUnprocessableEntity)
+	}
+
+	c := Client{
+		ID:           uuid.New().String(),
+		Name:         strings.TrimSpace(nc.Name),
+		RedirectURIs: uris,
+		GrantTypes:   grants,
+		Scopes:       scopes,
+		CreatedBy:    createdBy,
+		CreatedAt:    time.Now().UTC(),
+	}
+
+	var secret string
+	if nc.Confidential {
+		var err error
+		if secret, err = newSecret(); err != nil {
+			return nil, err
+		}
+		secret = secretTag + secret
+		c.SecretHash = hashSecret(secret)
+	}
+
+	if err := s.or.CreateClient(&c); err != nil {
+		return nil, err
+	}
+
+	return &CreatedClient{Client: c, Secret: secret}, nil
+}
+
+func (s *service) FindClients() ([]Client, error) {
+	return s.or.GetClients()
+}
+
+func (s *service) DeleteClient(id string) error {
+	if _, err := uuid.Parse(id); err != nil {
+		return web.NewRequestError(ErrInvalidID, http.StatusBadRequest)
+	}
+
+	err := s.or.DeleteClient(id)
+	if err == ErrNoClientFound {
+		return web.NewRequestError(ErrNoClientFound, http.StatusNotFound)
+	}
+	return err
+}
+
+// Authorize checks an authorization request and returns what the user is
+// asked to consent to.
+func (s *service) Authorize(ar AuthorizeRequest) (*Consent, error) {
+	c, redirectURI, err := s.check(ar)
+	if err != nil {
+		return nil, err
+	}
+
+	scopes, err := parseScope(ar.Scope, c.Scopes)
+	if err != nil {
+		return nil, &Error{Code: "invalid_scope", Description: err.Error(), redirectURI: redirectURI, state: ar.State}
+	}
+
+	return &Consent{Request: ar, ClientName: c.Name, Scopes: scopes}, nil
+}
+
+// check validates the client and redirect URI first: until both are known,
+// errors must not be sent to the redirect URI, or the endpoint would
+// redirect anywhere it is told to.
+func (s *service) check(ar AuthorizeRequest) (*Client, string, error) {
+	c, err := s.getClient(ar.ClientID)
+	if err != nil {
+		return nil, "", err
+	}
+
+	redirectURI := ar.RedirectURI
+	switch {
+	case redirectURI == "" && len(c.RedirectURIs) == 1:
+		redirectURI = c.RedirectURIs[0]
+	case !contains(c.RedirectURIs, redirectURI):
+		return nil, "", &Error{Code: "invalid_request", Description: "redirect_uri is not registered for this client", Status: http.StatusBadRequest}
+	}
+
+	fail := func(code, desc string) (*Client, string, error) {
+		return nil, "", &Error{Code: code, Description: desc, redirectURI: redirectURI, state: ar.State}
+	}
+
+	switch {
+	case ar.ResponseType != "code":
+		return fail("unsupported_response_type", "response_type must be code")
+	case !contains(c.GrantTypes, GrantAuthorizationCode):
+		return fail("unauthorized_client", "The client may not use the authorization code flow")
+	case ar.CodeChallenge == "":
+		return fail("invalid_request", "code_challenge is required")
+	case ar.CodeChallengeMethod != "S256":
+		return fail("invalid_request", "code_challenge_method must be S256")
+	case !validChallenge(ar.CodeChallenge):
+		return fail("invalid_request", "code_challenge must be a base64url encoded SHA-256 hash")
+	}
+
+	return c, redirectURI, nil
+}
+
+// Approve issues a code for the user of claims, who has logged in on the
+// consent page, and returns where to send it. The token gets the requested
+// scopes the user holds.
+func (s *service) Approve(ar AuthorizeRequest, claims auth.Claims) (string, error) {
+	c, redirectURI, err := s.check(ar)
+	if err != nil {
+		return "", err
+	}
+
+	scopes, err := parseScope(ar.Scope, c.Scopes)
+	if err != nil {
+		return "", &Error{Code: "invalid_scope", Description: err.Error(), redirectURI: redirectURI, state: ar.State}
+	}
+
+	raw, err := newSecret()
+	if err != nil {
+		return "", err
+	}
+
+	now := time.Now().UTC()
+	code := Code{
+		ID:            uuid.New().String(),
+		Hash:          hashSecret(raw),
+		ClientID:      c.ID,
+		UserID:        claims.UserID,
+		RedirectURI:   ar.RedirectURI,
+		Scopes:        intersect(scopes, claims.Roles),
+		CodeChallenge: ar.CodeChallenge,
+		CreatedAt:     now,
+		ExpiresAt:     now.Add(CodeLifetime),
+	}
+
+	if err := s.or.CreateCode(&code); err != nil {
+		return "", err
+	}
+
+	v := url.Values{}
+	v.Set("code", raw)
+	if ar.State != "" {
+		v.Set("state", ar.State)
+	}
+	return withQuery(redirectURI, v), nil
+}
+
+// Deny returns where to send the user who declined.
+func (s *service) Deny(ar AuthorizeRequest) (string, error) {
+	_, redirectURI, err := s.check(ar)
+	if err != nil {
+		return "", err
+	}
+
+	uri, _ := (&Error{Code: "access_denied", Description: "The user denied the request", redirectURI: redirectURI, state: ar.State}).Redirect()
+	return uri, nil
+}
+
+// Token implements the token endpoint for the authorization code and
+// client credentials grants.
+func (s *service) Token(tr TokenRequest) (*Token, error) {
+	c, err := s.authenticate(tr.ClientID, tr.ClientSecret)
+	if err != nil {
+		return nil, err
+	}
+
+	switch {
+	case tr.GrantType != GrantAuthorizationCode && tr.GrantType != GrantClientCredentials:
+		return nil, &Error{Code: "unsupported_grant_type", Description: "grant_type must be authorization_code or client_credentials", Status: http.StatusBadRequest}
+	case !contains(c.GrantTypes, tr.GrantType):
+		return nil, &Error{Code: "unauthorized_client", Description: "The client may not use this grant type", Status: http.StatusBadRequest}
+	}
+
+	var claims auth.Claims
+	if tr.GrantType == GrantAuthorizationCode {
+		claims, err = s.exchange(c, tr)
+	} else {
+		claims, err = s.credentials(c, tr)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	tkn, err := auth.CreateToken(claims)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Token{
+		AccessToken: tkn,
+		TokenType:   "Bearer",
+		ExpiresIn:   int64(auth.TokenLifetime / time.Second),
+		Scope:       claims.Scope,
+	}, nil
+}
+
+// exchange redeems an authorization code. A code is good for one token;
+// when it comes back, it has leaked, and the token it was exchanged for is
+// revoked (RFC 6749 section 4.1.2).
+func (s *service) exchange(c *Client, tr TokenRequest) (auth.Claims, error) {
+	invalid := &Error{Code: "invalid_grant", Description: "Authorization code is invalid, expired or was used", Status: http.StatusBadRequest}
+
+	code, err := s.or.GetCode(hashSecret(tr.Code))
+	switch {
+	case err == ErrNoCodeFound:
+		return auth.Claims{}, invalid
+	case err != nil:
+		return auth.Claims{}, err
+	}
+
+	now := time.Now().UTC()
+
+	switch {
+	case code.ClientID != c.ID:
+		return auth.Claims{}, invalid
+	case code.UsedAt != nil:
+		return auth.Claims{}, s.replayed(code, invalid)
+	case !now.Before(code.ExpiresAt):
+		return auth.Claims{}, invalid
+	case code.RedirectURI != tr.RedirectURI:
+		return auth.Claims{}, &Error{Code: "invalid_grant", Description: "redirect_uri does not match the authorization request", Status: http.StatusBadRequest}
+	case !verifyChallenge(tr.CodeVerifier, code.CodeChallenge):
+		return auth.Claims{}, &Error{Code: "invalid_grant", Description: "code_verifier does not match the code_challenge", Status: http.StatusBadRequest}
+	}
+
+	// The token is recorded before the user is loaded: RevokeAll running
+	// in between finds the token, and running before it leaves the user
+	// with their new roles, or deleted.
+	tokenID := uuid.New().String()
+	ok, err := s.or.UseCode(code.ID, tokenID, now)
+	switch {
+	case err != nil:
+		return auth.Claims{}, err
+	case !ok:
+		// Another request exchanged the code first.
+		code, err := s.or.GetCode(code.Hash)
+		if err != nil {
+			return auth.Claims{}, err
+		}
+		return auth.Claims{}, s.replayed(code, invalid)
+	}
+
+	// The user may have lost roles since consenting.
+	u, err := s.ur.GetById(code.UserID)
+	switch {
+	case err == user.ErrNoUserFound:
+		return auth.Claims{}, invalid
+	case err != nil:
+		return auth.Claims{}, err
+	}
+
+	scopes := intersect(code.Scopes, u.Roles)
+	claims := auth.NewClaims(u.ID, scopes)
+	claims.Id = tokenID
+	claims.ClientID = c.ID
+	claims.Scope = strings.Join(scopes, " ")
+
+	return claims, nil
+}
+
+func (s *service) replayed(code *Code, err error) error {
+	if code.TokenID != "" && code.UsedAt != nil {
+		if rerr := s.rl.Revoke(code.TokenID, code.UsedAt.Add(auth.TokenLifetime)); rerr != nil {
+			return rerr
+		}
+	}
+	log.Printf("[oauth] Authorization code reused, revoked token of client %s for user %s", code.ClientID, code.UserID)
+
+	return err
+}
+
+// credentials issues a token that acts as the client itself: sub is the
+// client ID and the roles are the requested scopes.
+func (s *service) credentials(c *Client, tr TokenRequest) (auth.Claims, error) {
+	scopes, err := parseScope(tr.Scope, c.Scopes)
+	if err != nil {
+		return auth.Claims{}, &Error{Code: "invalid_scope", Description: err.Error(), Status: http.StatusBadRequest}
+	}
+
+	claims := auth.NewClaims(c.ID, scopes)
+	claims.ClientID = c.ID
+	claims.Scope = strings.Join(scopes, " ")
+
+	return claims, nil
+}
+
+// Introspect tells a confidential client, typically a resource server,
+// whether token is active and what it grants (RFC 7662). Tokens that fail
+// to parse, have expired or were revoked are merely inactive.
+func (s *service) Introspect(clientID, secret, token string) (*Introspection, error) {
+	c, err := s.authenticate(clientID, secret)
+	if err != nil {
+		return nil, err
+	}
+	if !c.Confidential() {
+		return nil, &Error{Code: "invalid_client", Description: "Introspection needs a confidential client", Status: http.StatusUnauthorized}
+	}
+
+	claims, err := auth.ParseWithClaims(token)
+	if err != nil || s.rl.IsRevoked(claims.Id, claims.SessionID) {
+		return &Introspection{Active: false}, nil
+	}
+
+	return &Introspection{
+		Active:      true,
+		Scope:       claims.Scope,
+		ClientID:    claims.ClientID,
+		Subject:     claims.Subject,
+		Roles:       claims.Roles,
+		Permissions: claims.Permissions,
+		TokenType:   "Bearer",
+		ExpiresAt:   claims.ExpiresAt,
+		IssuedAt:    claims.IssuedAt,
+		NotBefore:   claims.NotBefore,
+		Issuer:      claims.Issuer,
+		Audience:    claims.Audience,
+		TokenID:     claims.Id,
+	}, nil
+}
+
+// Revoke revokes a token issued to the client (RFC 7009). Tokens that are
+// invalid or expired already need no revoking and are not an error.
+func (s *service) Revoke(clientID, secret, token string) error {
+	c, err := s.authenticate(clientID, secret)
+	if err != nil {
+		return err
+	}
+
+	claims, err := auth.ParseWithClaims(token)
+	if err != nil {
+		return nil
+	}
+	if claims.ClientID != c.ID {
+		return &Error{Code: "unauthorized_client", Description: "The token was not issued to this client", Status: http.StatusBadRequest}
+	}
+
+	return s.rl.Revoke(claims.Id, time.Unix(claims.ExpiresAt, 0))
+}
+
+// RevokeAll revokes the tokens clients were issued for a user, e.g. when
+// the user loses a role, changes their password or is deleted. It makes
+// oauth a user.Sessions.
+func (s *service) RevokeAll(userID string) error {
+	cs, err := s.or.GetUsedCodes(userID, time.Now().UTC().Add(-auth.TokenLifetime))
+	if err != nil {
+		return err
+	}
+
+	for _, c := range cs {
+		if c.TokenID == "" {
+			continue
+		}
+		if err := s.rl.Revoke(c.TokenID, c.UsedAt.Add(auth.TokenLifetime)); err != nil {
+			return err
+		}
+	}
+
+	if len(cs) > 0 {
+		log.Printf("[oauth] Revoked %d tokens of user %s", len(cs), userID)
+	}
+	return nil
+}
+
+// getClient looks up the client of an authorization request, whose errors
+// are shown to the user.
+func (s *service) getClient(id string) (*Client, error) {
+	unknown := &Error{Code: "invalid_request", Description: "client_id is missing or unknown", Status: http.StatusBadRequest}
+
+	if _, err := uuid.Parse(id); err != nil {
+		return nil, unknown
+	}
+
+	c, err := s.or.GetClient(id)
+	switch {
+	case err == ErrNoClientFound:
+		return nil, unknown
+	case err != nil:
+		return nil, err
+	}
+
+	return c, nil
+}
+
+// authenticate checks the credentials of a client at the token,
+// introspection and revocation endpoints. Public clients identify
+// themselves with their ID alone.
+func (s *service) authenticate(id, secret string) (*Client, error) {
+	invalid := &Error{Code: "invalid_client", Description: "Client authentication failed", Status: http.StatusUnauthorized}
+
+	if _, err := uuid.Parse(id); err != nil {
+		return nil, invalid
+	}
+
+	c, err := s.or.GetClient(id)
+	switch {
+	case err == ErrNoClientFound:
+		return nil, invalid
+	case err != nil:
+		return nil, err
+	}
+
+	switch {
+	case c.Confidential() && subtle.ConstantTimeCompare(c.SecretHash, hashSecret(secret)) != 1,
+		!c.Confidential() && secret != "":
+		return nil, invalid
+	}
+
+	return c, nil
+}
+
+// parseScope reads a space separated scope, defaulting to every scope the
+// client is registered for.
+func parseScope(scope string, allowed []string) ([]string, error) {
+	fields := strings.Fields(scope)
+	if len(fields) == 0 {
+		return append([]string{}, allowed...), nil
+	}
+
+	scopes := []string{}
+	for _, sc := range fields {
+		sc = strings.ToUpper(sc)
+		if !contains(allowed, sc) {
+			return nil, fmt.Errorf("The client may not request the scope %s", sc)
+		}
+		if !contains(scopes, sc) {
+			scopes = append(scopes, sc)
+		}
+	}
+
+	return scopes, nil
+}
+
+// validRedirectURI allows absolute https URLs and, for native apps and
+// development, http on the loopback interface (RFC 8252 section 7.3).
+func validRedirectURI(uri string) bool {
+	u, err := url.Parse(uri)
+	if err != nil || u.Fragment != "" || u.Host == "" {
+		return false
+	}
+
+	switch u.Scheme {
+	case "https":
+		return true
+	case "http":
+		host := u.Hostname()
+		return host == "localhost" || host == "127.0.0.1" || host == "::1"
+	}
+	return false
+}
+
+// validChallenge checks that a challenge is an unpadded base64url SHA-256
+// hash.
+func validChallenge(challenge string) bool {
+	b, err := base64.RawURLEncoding.DecodeString(challenge)
+	return err == nil && len(b) == sha256.Size
+}
+
+// verifyChallenge checks a PKCE code verifier (RFC 7636 section 4.6).
+func verifyChallenge(verifier, challenge string) bool {
+	if len(verifier) < 43 || len(verifier) > 128 {
+		return false
+	}
+	for _, r := range verifier {
+		if !strings.ContainsRune("ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz0123456789-._~", r) {
+			return false
+		}
+	}
+
+	h := sha256.Sum256([]byte(verifier))
+	return subtle.ConstantTimeCompare([]byte(base64.RawURLEncoding.EncodeToString(h[:])), []byte(challenge)) == 1
+}
+
+func newSecret() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("Generating secret: %w", err)
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// hashSecret needs no salt for the same reason refresh tokens do not: the
+// secret is random and long.
+func hashSecret(raw string) []byte {
+	h := sha256.Sum256([]byte(raw))
+	return h[:]
+}
+
+func contains(ss []string, s string) bool {
+	for _, has := range ss {
+		if has == s {
+			return true
+		}
+	}
+	return false
+}
+
+func intersect(a, b []string) []string {
+	out := []string{}
+	for _, s := range a {
+		if contains(b, s) {
+			out = append(out, s)
+		}
+	}
+	return out
+}
@@ -0,0 +1,303 @@
+package oauth_test
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/axwilliams/book-api/internal/business/oauth"
+	"github.com/axwilliams/book-api/internal/business/session"
+	"github.com/axwilliams/book-api/internal/platform/auth"
+	"github.com/axwilliams/book-api/internal/platform/web"
+	"github.com/axwilliams/book-api/internal/test"
+	"github.com/axwilliams/book-api/internal/test/mock"
+)
+
+const (
+	authorID    = "69a47775-6d89-4d38-ad38-acdb2928f6a1"
+	adminID     = "a72bec75-0a5f-49af-a844-5763d188788e"
+	redirectURI = "https://app.example.com/callback"
+	verifier    = "dBjftJeZ4CVP-mB92K27uhbUJU1p1r_wW1gFWFOEjXk"
+)
+
+func newService() (oauth.Service, *session.RevocationList) {
+	rl := session.NewRevocationList(mock.NewMockSession())
+	return oauth.NewService(mock.NewMockOAuth(), mock.NewMockUser(), rl), rl
+}
+
+func challenge(v string) string {
+	h := sha256.Sum256([]byte(v))
+	return base64.RawURLEncoding.EncodeToString(h[:])
+}
+
+// code returns the OAuth error code of err, or the status of other errors.
+func code(err error) string {
+	switch e := err.(type) {
+	case nil:
+		return ""
+	case *oauth.Error:
+		return e.Code
+	case *web.RequestError:
+		return http.StatusText(e.Status)
+	}
+	return err.Error()
+}
+
+func TestRegister(t *testing.T) {
+	oas, _ := newService()
+
+	samples := []struct {
+		name string
+		nc   oauth.NewClient
+		want string
+	}{
+		{"Unknown grant", oauth.NewClient{Name: "app", GrantTypes: []string{"password"}, Scopes: []string{"AUTHOR"}}, "Unprocessable Entity"},
+		{"Public client credentials", oauth.NewClient{Name: "app", GrantTypes: []string{"client_credentials"}, Scopes: []string{"AUTHOR"}}, "Unprocessable Entity"},
+		{"No redirect URI", oauth.NewClient{Name: "app", GrantTypes: []string{"authorization_code"}, Scopes: []string{"AUTHOR"}}, "Unprocessable Entity"},
+		{"Plain http", oauth.NewClient{Name: "app", GrantTypes: []string{"authorization_code"}, RedirectURIs: []string{"http://app.example.com/cb"}, Scopes: []string{"AUTHOR"}}, "Unprocessable Entity"},
+		{"Fragment", oauth.NewClient{Name: "app", GrantTypes: []string{"authorization_code"}, RedirectURIs: []string{"https://app.example.com/cb#x"}, Scopes: []string{"AUTHOR"}}, "Unprocessable Entity"},
+		{"Unknown scope", oauth.NewClient{Name: "app", GrantTypes: []string{"authorization_code"}, RedirectURIs: []string{redirectURI}, Scopes: []string{"READER"}}, "Unprocessable Entity"},
+		{"Public", oauth.NewClient{Name: "app", GrantTypes: []string{"authorization_code"}, RedirectURIs: []string{redirectURI, "http://127.0.0.1:8000/cb"}, Scopes: []string{"author"}}, ""},
+		{"Confidential", oauth.NewClient{Name: "sync", GrantTypes: []string{"client_credentials"}, Scopes: []string{"CURATOR"}, Confidential: true}, ""},
+	}
+
+	for _, sample := range samples {
+		c, err := oas.Register(sample.nc, adminID)
+		if got := code(err); got != sample.want {
+			t.Fatalf("\t%s\t%s: want %q got %q", test.Failed, sample.name, sample.want, got)
+		}
+		if err == nil && sample.nc.Confidential != strings.HasPrefix(c.Secret, "cs_") {
+			t.Fatalf("\t%s\t%s: wrong secret %q", test.Failed, sample.name, c.Secret)
+		}
+		t.Logf("\t%s\t%s", test.Success, sample.name)
+	}
+
+	cs, _ := oas.FindClients()
+	if len(cs) != 2 || !cs[0].Confidential() || cs[1].Confidential() || cs[1].Scopes[0] != "AUTHOR" {
+		t.Fatalf("\t%s\tClients not stored: %+v", test.Failed, cs)
+	}
+	t.Logf("\t%s\tClients stored", test.Success)
+}
+
+func TestAuthorizationCode(t *testing.T) {
+	oas, rl := newService()
+
+	c, err := oas.Register(oauth.NewClient{
+		Name:         "Reading list",
+		GrantTypes:   []string{oauth.GrantAuthorizationCode},
+		RedirectURIs: []string{redirectURI},
+		Scopes:       []string{auth.RoleAuthor, auth.RoleCurator},
+	}, adminID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	valid := oauth.AuthorizeRequest{
+		ResponseType:        "code",
+		ClientID:            c.ID,
+		RedirectURI:         redirectURI,
+		State:               "xyz",
+		CodeChallenge:       challenge(verifier),
+		CodeChallengeMethod: "S256",
+	}
+
+	samples := []struct {
+		name     string
+		change   func(*oauth.AuthorizeRequest)
+		want     string
+		redirect bool
+	}{
+		{"Unknown client", func(ar *oauth.AuthorizeRequest) { ar.ClientID = adminID }, "invalid_request", false},
+		{"Unregistered redirect", func(ar *oauth.AuthorizeRequest) { ar.RedirectURI = "https://evil.example.com/" }, "invalid_request", false},
+		{"Implicit", func(ar *oauth.AuthorizeRequest) { ar.ResponseType = "token" }, "unsupported_response_type", true},
+		{"No PKCE", func(ar *oauth.AuthorizeRequest) { ar.CodeChallenge = "" }, "invalid_request", true},
+		{"Plain PKCE", func(ar *oauth.AuthorizeRequest) { ar.CodeChallengeMethod = "plain" }, "invalid_request", true},
+		{"Scope beyond the client", func(ar *oauth.AuthorizeRequest) { ar.Scope = "ADMIN" }, "invalid_scope", true},
+		{"Valid", func(ar *oauth.AuthorizeRequest) {}, "", false},
+		{"Registered redirect implied", func(ar *oauth.AuthorizeRequest) { ar.RedirectURI = "" }, "", false},
+	}
+
+	for _, sample := range samples {
+		ar := valid
+		sample.change(&ar)
+
+		consent, err := oas.Authorize(ar)
+		if got := code(err); got != sample.want {
+			t.Fatalf("\t%s\t%s: want %q got %q", test.Failed, sample.name, sample.want, got)
+		}
+		if err != nil {
+			uri, ok := err.(*oauth.Error).Redirect()
+			if ok != sample.redirect || (ok && (!strings.HasPrefix(uri, redirectURI+"?") || !strings.Contains(uri, "state=xyz"))) {
+				t.Fatalf("\t%s\t%s: wrong redirect %q", test.Failed, sample.name, uri)
+			}
+		} else if consent.ClientName != "Reading list" || len(consent.Scopes) != 2 {
+			t.Fatalf("\t%s\t%s: wrong consent %+v", test.Failed, sample.name, consent)
+		}
+		t.Logf("\t%s\t%s", test.Success, sample.name)
+	}
+
+	// The author consents to both scopes but only holds AUTHOR.
+	claims := auth.NewClaims(authorID, []string{auth.RoleAuthor})
+	uri, err := oas.Approve(valid, claims)
+	if err != nil {
+		t.Fatal(err)
+	}
+	u, _ := url.Parse(uri)
+	rawCode := u.Query().Get("code")
+	if !strings.HasPrefix(uri, redirectURI+"?") || rawCode == "" || u.Query().Get("state") != "xyz" {
+		t.Fatalf("\t%s\tWrong redirect: %s", test.Failed, uri)
+	}
+	t.Logf("\t%s\tCode issued", test.Success)
+
+	tr := oauth.TokenRequest{
+		GrantType:    oauth.GrantAuthorizationCode,
+		Code:         rawCode,
+		RedirectURI:  redirectURI,
+		CodeVerifier: verifier,
+		ClientID:     c.ID,
+	}
+
+	exchanges := []struct {
+		name   string
+		change func(*oauth.TokenRequest)
+		want   string
+	}{
+		{"Secret for a public client", func(tr *oauth.TokenRequest) { tr.ClientSecret = "cs_x" }, "invalid_client"},
+		{"Wrong verifier", func(tr *oauth.TokenRequest) { tr.CodeVerifier = strings.Repeat("a", 43) }, "invalid_grant"},
+		{"No verifier", func(tr *oauth.TokenRequest) { tr.CodeVerifier = "" }, "invalid_grant"},
+		{"Other redirect", func(tr *oauth.TokenRequest) { tr.RedirectURI = redirectURI + "/" }, "invalid_grant"},
+		{"Unknown code", func(tr *oauth.TokenRequest) { tr.Code = "abc" }, "invalid_grant"},
+		{"Client credentials", func(tr *oauth.TokenRequest) { tr.GrantType = oauth.GrantClientCredentials }, "unauthorized_client"},
+		{"Password", func(tr *oauth.TokenRequest) { tr.GrantType = "password" }, "unsupported_grant_type"},
+	}
+
+	for _, sample := range exchanges {
+		r := tr
+		sample.change(&r)
+		if _, err := oas.Token(r); code(err) != sample.want {
+			t.Fatalf("\t%s\t%s: want %q got %v", test.Failed, sample.name, sample.want, err)
+		}
+		t.Logf("\t%s\t%s rejected", test.Success, sample.name)
+	}
+
+	tkn, err := oas.Token(tr)
+	if err != nil {
+		t.Fatalf("\t%s\tExchange failed: %v", test.Failed, err)
+	}
+
+	issued, err := auth.ParseWithClaims(tkn.AccessToken)
+	switch {
+	case err != nil:
+		t.Fatalf("\t%s\tToken does not parse: %v", test.Failed, err)
+	case issued.UserID != authorID || len(issued.Roles) != 1 || issued.Roles[0] != auth.RoleAuthor:
+		t.Fatalf("\t%s\tWrong user or roles: %+v", test.Failed, issued)
+	case issued.ClientID != c.ID || tkn.Scope != "AUTHOR" || tkn.TokenType != "Bearer":
+		t.Fatalf("\t%s\tWrong client or scope: %+v %+v", test.Failed, issued, tkn)
+	}
+	t.Logf("\t%s\tToken limited to the scopes the user holds", test.Success)
+
+	if _, err := oas.Token(tr); code(err) != "invalid_grant" {
+		t.Fatalf("\t%s\tCode exchanged twice: %v", test.Failed, err)
+	}
+	if !rl.IsRevoked(issued.Id) {
+		t.Fatalf("\t%s\tToken of a replayed code not revoked", test.Failed)
+	}
+	t.Logf("\t%s\tReplayed code revokes its token", test.Success)
+
+	uri, err = oas.Approve(valid, claims)
+	if err != nil {
+		t.Fatal(err)
+	}
+	u, _ = url.Parse(uri)
+	tr.Code = u.Query().Get("code")
+	tkn, err = oas.Token(tr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	issued, _ = auth.ParseWithClaims(tkn.AccessToken)
+
+	if err := oas.RevokeAll(authorID); err != nil || !rl.IsRevoked(issued.Id) {
+		t.Fatalf("\t%s\tToken of the user not revoked: %v", test.Failed, err)
+	}
+	t.Logf("\t%s\tEnding the logins of the user revokes their tokens", test.Success)
+}
+
+func TestClientCredentials(t *testing.T) {
+	oas, rl := newService()
+
+	c, _ := oas.Register(oauth.NewClient{
+		Name:         "sync",
+		GrantTypes:   []string{oauth.GrantClientCredentials},
+		Scopes:       []string{auth.RoleCurator, auth.RoleAuthor},
+		Confidential: true,
+	}, adminID)
+	other, _ := oas.Register(oauth.NewClient{
+		Name:         "reports",
+		GrantTypes:   []string{oauth.GrantClientCredentials},
+		Scopes:       []string{auth.RoleCurator},
+		Confidential: true,
+	}, adminID)
+
+	samples := []struct {
+		name   string
+		tr     oauth.TokenRequest
+		want   string
+		scopes string
+	}{
+		{"No secret", oauth.TokenRequest{GrantType: oauth.GrantClientCredentials, ClientID: c.ID}, "invalid_client", ""},
+		{"Wrong secret", oauth.TokenRequest{GrantType: oauth.GrantClientCredentials, ClientID: c.ID, ClientSecret: other.Secret}, "invalid_client", ""},
+		{"Unregistered scope", oauth.TokenRequest{GrantType: oauth.GrantClientCredentials, ClientID: c.ID, ClientSecret: c.Secret, Scope: "ADMIN"}, "invalid_scope", ""},
+		{"Narrowed", oauth.TokenRequest{GrantType: oauth.GrantClientCredentials, ClientID: c.ID, ClientSecret: c.Secret, Scope: "curator"}, "", "CURATOR"},
+		{"Default scopes", oauth.TokenRequest{GrantType: oauth.GrantClientCredentials, ClientID: c.ID, ClientSecret: c.Secret}, "", "CURATOR AUTHOR"},
+	}
+
+	var token string
+	for _, sample := range samples {
+		tkn, err := oas.Token(sample.tr)
+		if got := code(err); got != sample.want {
+			t.Fatalf("\t%s\t%s: want %q got %q", test.Failed, sample.name, sample.want, got)
+		}
+		if err == nil {
+			if tkn.Scope != sample.scopes {
+				t.Fatalf("\t%s\t%s: wrong scope %q", test.Failed, sample.name, tkn.Scope)
+			}
+			token = tkn.AccessToken
+		}
+		t.Logf("\t%s\t%s", test.Success, sample.name)
+	}
+
+	if in, err := oas.Introspect(other.ID, "", token); code(err) != "invalid_client" {
+		t.Fatalf("\t%s\tIntrospection without a secret: %+v %v", test.Failed, in, err)
+	}
+
+	in, err := oas.Introspect(other.ID, other.Secret, token)
+	if err != nil || !in.Active || in.ClientID != c.ID || in.Subject != c.ID || in.Scope != "CURATOR AUTHOR" {
+		t.Fatalf("\t%s\tWrong introspection: %+v %v", test.Failed, in, err)
+	}
+	if in, _ := oas.Introspect(other.ID, other.Secret, "not.a.token"); in.Active {
+		t.Fatalf("\t%s\tGarbage is active", test.Failed)
+	}
+	t.Logf("\t%s\tToken introspected", test.Success)
+
+	if err := oas.Revoke(other.ID, other.Secret, token); code(err) != "unauthorized_client" {
+		t.Fatalf("\t%s\tToken revoked by another client: %v", test.Failed, err)
+	}
+	if err := oas.Revoke(c.ID, c.Secret, "not.a.token"); err != nil {
+		t.Fatalf("\t%s\tRevoking an invalid token failed: %v", test.Failed, err)
+	}
+	if err := oas.Revoke(c.ID, c.Secret, token); err != nil {
+		t.Fatalf("\t%s\tRevoking failed: %v", test.Failed, err)
+	}
+
+	in, _ = oas.Introspect(other.ID, other.Secret, token)
+	if in.Active || in.ClientID != "" {
+		t.Fatalf("\t%s\tRevoked token is active: %+v", test.Failed, in)
+	}
+	if claims, _ := auth.ParseWithClaims(token); !rl.IsRevoked(claims.Id) {
+		t.Fatalf("\t%s\tToken not on the revocation list", test.Failed)
+	}
+	t.Logf("\t%s\tToken revoked", test.Success)
+}
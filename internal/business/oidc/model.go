@@ -0,0 +1,105 @@
+package oidc
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/axwilliams/book-api/internal/platform/auth"
+)
+
+// DefaultScopes are requested when Config.Scopes is empty.
+var DefaultScopes = []string{"openid", "email", "profile"}
+
+// Config describes the identity provider and how its users become users of
+// the API.
+type Config struct {
+	Issuer       string
+	ClientID     string
+	ClientSecret string
+	RedirectURL  string
+	Scopes       []string
+	// GroupsClaim names the ID token claim that lists the user's groups.
+	GroupsClaim string
+	// GroupRoles maps groups to the roles their members get.
+	GroupRoles map[string][]string
+	Leeway     time.Duration
+}
+
+// ParseGroupRoles reads a mapping like "library-admins=ADMIN,editors=AUTHOR".
+// A group may appear more than once to grant several roles.
+func ParseGroupRoles(s string) (map[string][]string, error) {
+	m := map[string][]string{}
+	for _, pair := range strings.Split(s, ",") {
+		if strings.TrimSpace(pair) == "" {
+			continue
+		}
+
+		kv := strings.SplitN(pair, "=", 2)
+		if len(kv) != 2 {
+			return nil, fmt.Errorf("Parsing group roles: %q is not group=ROLE", pair)
+		}
+
+		group, role := strings.TrimSpace(kv[0]), strings.ToUpper(strings.TrimSpace(kv[1]))
+		switch role {
+		case auth.RoleAdmin, auth.RoleAuthor, auth.RoleCurator:
+		default:
+			return nil, fmt.Errorf("Parsing group roles: unknown role %q", role)
+		}
+
+		if !auth.HasRole(m[group], role) {
+			m[group] = append(m[group], role)
+		}
+	}
+	return m, nil
+}
+
+// Identity links an account at the identity provider, named by issuer and
+// subject, to a user. Provisioned identities created their user on first
+// login; their roles follow the user's groups on every login.
+type Identity struct {
+	Issuer      string    `json:"issuer"`
+	Subject     string    `json:"subject"`
+	UserID      string    `json:"user_id"`
+	Email       string    `json:"email"`
+	Provisioned bool      `json:"provisioned"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+// State is a login in progress, from the redirect to the provider until
+// the callback. Only a hash of the state parameter is stored. UserID is set
+// when an existing user links their account.
+type State struct {
+	Hash         []byte
+	Nonce        string
+	CodeVerifier string
+	UserID       string
+	ExpiresAt    time.Time
+}
+
+// Login is where to send the user agent to log in. State goes into a
+// cookie as well, so that the callback can only complete a login started
+// in the same browser.
+type Login struct {
+	URL   string `json:"authorization_url"`
+	State string `json:"-"`
+}
+
+// Discovery is the part of the provider metadata (OpenID Connect Discovery
+// 1.0) the login needs.
+type Discovery struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	JWKSURI               string `json:"jwks_uri"`
+}
+
+// Claims are the verified claims of an ID token.
+type Claims struct {
+	Subject           string
+	Email             string
+	EmailVerified     bool
+	PreferredUsername string
+	Name              string
+	Groups            []string
+}
@@ -0,0 +1,335 @@
+package oidc
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/axwilliams/book-api/internal/platform/auth"
+	"github.com/dgrijalva/jwt-go"
+)
+
+// jwksMinAge keeps an ID token with an unknown kid from refetching the
+// provider's keys more than once a minute.
+const jwksMinAge = time.Minute
+
+var (
+	errIDTokenSignature = errors.New("ID token signature is invalid")
+	errUnknownKey       = errors.New("ID token is signed with an unknown key")
+)
+
+// provider talks to one OpenID provider. Its keys are cached and refetched
+// when a token names a key not seen before, which is how providers rotate.
+type provider struct {
+	Discovery
+	client *http.Client
+
+	mu      sync.Mutex
+	keys    map[string]auth.JWK
+	fetched time.Time
+}
+
+// discover reads the metadata of the provider at issuer, which must name
+// itself as issuer.
+func discover(issuer string, client *http.Client) (*provider, error) {
+	p := &provider{client: client, keys: map[string]auth.JWK{}}
+
+	if err := p.getJSON(strings.TrimRight(issuer, "/")+"/.well-known/openid-configuration", &p.Discovery); err != nil {
+		return nil, fmt.Errorf("Discovering OpenID provider: %w", err)
+	}
+	if p.Issuer != issuer {
+		return nil, fmt.Errorf("Discovering OpenID provider: issuer %q does not match %q", p.Issuer, issuer)
+	}
+	if p.AuthorizationEndpoint == "" || p.TokenEndpoint == "" || p.JWKSURI == "" {
+		return nil, errors.New("Discovering OpenID provider: endpoints missing")
+	}
+
+	return p, nil
+}
+
+func (p *provider) getJSON(uri string, v interface{}) error {
+	res, err := p.client.Get(uri)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected status %s", res.Status)
+	}
+
+	return json.NewDecoder(io.LimitReader(res.Body, 1<<20)).Decode(v)
+}
+
+// authCodeURL returns the authorization request of the code flow with PKCE.
+func (p *provider) authCodeURL(cfg Config, state, nonce, challenge string) string {
+	scopes := cfg.Scopes
+	if len(scopes) == 0 {
+		scopes = DefaultScopes
+	}
+
+	v := url.Values{
+		"response_type":         {"code"},
+		"client_id":             {cfg.ClientID},
+		"redirect_uri":          {cfg.RedirectURL},
+		"scope":                 {strings.Join(scopes, " ")},
+		"state":                 {state},
+		"nonce":                 {nonce},
+		"code_challenge":        {challenge},
+		"code_challenge_method": {"S256"},
+	}
+
+	sep := "?"
+	if strings.Contains(p.AuthorizationEndpoint, "?") {
+		sep = "&"
+	}
+	return p.AuthorizationEndpoint + sep + v.Encode()
+}
+
+// exchange redeems a code at the token endpoint and returns the ID token.
+func (p *provider) exchange(cfg Config, code, verifier string) (string, error) {
+	v := url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {code},
+		"redirect_uri":  {cfg.RedirectURL},
+		"code_verifier": {verifier},
+	}
+
+	req, err := http.NewRequest("POST", p.TokenEndpoint, strings.NewReader(v.Encode()))
+	if err != nil {
+		return "", fmt.Errorf("Exchanging code: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	req.SetBasicAuth(url.QueryEscape(cfg.ClientID), url.QueryEscape(cfg.ClientSecret))
+
+	res, err := p.client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("Exchanging code: %w", err)
+	}
+	defer res.Body.Close()
+
+	body, err := ioutil.ReadAll(io.LimitReader(res.Body, 1<<20))
+	if err != nil {
+		return "", fmt.Errorf("Exchanging code: %w", err)
+	}
+
+	var tr struct {
+		IDToken          string `json:"id_token"`
+		Error            string `json:"error"`
+		ErrorDescription string `json:"error_description"`
+	}
+	if err := json.Unmarshal(body, &tr); err != nil {
+		return "", fmt.Errorf("Exchanging code: unexpected response %s", res.Status)
+	}
+
+	switch {
+	case tr.Error != "":
+		return "", fmt.Errorf("Exchanging code: %s: %s", tr.Error, tr.ErrorDescription)
+	case res.StatusCode != http.StatusOK || tr.IDToken == "":
+		return "", fmt.Errorf("Exchanging code: no ID token, status %s", res.Status)
+	}
+
+	return tr.IDToken, nil
+}
+
+// verify checks an ID token as OpenID Connect Core 1.0 section 3.1.3.7
+// asks: the signature with the provider's keys, then issuer, audience,
+// authorized party, times and nonce.
+func (p *provider) verify(cfg Config, raw, nonce string, now time.Time) (Claims, error) {
+	mc := jwt.MapClaims{}
+	parser := jwt.Parser{ValidMethods: auth.DefaultAlgorithms, SkipClaimsValidation: true}
+
+	token, err := parser.ParseWithClaims(raw, mc, func(t *jwt.Token) (interface{}, error) {
+		kid, _ := t.Header["kid"].(string)
+
+		jwk, err := p.key(kid)
+		if err != nil {
+			return nil, err
+		}
+		if jwk.Algorithm != "" && jwk.Algorithm != t.Method.Alg() {
+			return nil, errIDTokenSignature
+		}
+		return publicKey(jwk)
+	})
+	if err != nil || !token.Valid {
+		return Claims{}, errIDTokenSignature
+	}
+
+	leeway := int64(cfg.Leeway / time.Second)
+	unix := now.Unix()
+
+	aud := stringsClaim(mc, "aud")
+	azp, _ := mc["azp"].(string)
+	exp, hasExp := mc["exp"].(float64)
+	iat, _ := mc["iat"].(float64)
+	nbf, hasNbf := mc["nbf"].(float64)
+	got, _ := mc["nonce"].(string)
+
+	switch {
+	case mc["iss"] != p.Issuer:
+		return Claims{}, errors.New("ID token was issued by another provider")
+	case !contains(aud, cfg.ClientID):
+		return Claims{}, errors.New("ID token is meant for another client")
+	case len(aud) > 1 && azp != cfg.ClientID, azp != "" && azp != cfg.ClientID:
+		return Claims{}, errors.New("ID token was issued to another client")
+	case !hasExp || unix > int64(exp)+leeway:
+		return Claims{}, errors.New("ID token has expired")
+	case unix < int64(iat)-leeway, hasNbf && unix < int64(nbf)-leeway:
+		return Claims{}, errors.New("ID token is not valid yet")
+	case nonce == "" || got != nonce:
+		return Claims{}, errors.New("ID token nonce does not match")
+	}
+
+	c := Claims{Subject: stringClaim(mc, "sub")}
+	if c.Subject == "" {
+		return Claims{}, errors.New("ID token has no subject")
+	}
+
+	c.Email = stringClaim(mc, "email")
+	c.EmailVerified, _ = mc["email_verified"].(bool)
+	c.PreferredUsername = stringClaim(mc, "preferred_username")
+	c.Name = stringClaim(mc, "name")
+
+	groups := cfg.GroupsClaim
+	if groups == "" {
+		groups = "groups"
+	}
+	c.Groups = stringsClaim(mc, groups)
+
+	return c, nil
+}
+
+// key returns the key kid, refetching the provider's keys when it is not
+// known yet.
+func (p *provider) key(kid string) (auth.JWK, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if k, ok := p.lookup(kid); ok {
+		return k, nil
+	}
+	if time.Since(p.fetched) < jwksMinAge {
+		return auth.JWK{}, errUnknownKey
+	}
+
+	var set auth.JWKS
+	if err := p.getJSON(p.JWKSURI, &set); err != nil {
+		return auth.JWK{}, fmt.Errorf("Fetching provider keys: %w", err)
+	}
+
+	p.fetched = time.Now()
+	p.keys = map[string]auth.JWK{}
+	for _, k := range set.Keys {
+		if k.Use == "" || k.Use == "sig" {
+			p.keys[k.KeyID] = k
+		}
+	}
+
+	if k, ok := p.lookup(kid); ok {
+		return k, nil
+	}
+	return auth.JWK{}, errUnknownKey
+}
+
+// lookup finds kid; a token without kid may use the provider's only key.
+func (p *provider) lookup(kid string) (auth.JWK, bool) {
+	if k, ok := p.keys[kid]; ok {
+		return k, true
+	}
+	if kid == "" && len(p.keys) == 1 {
+		for _, k := range p.keys {
+			return k, true
+		}
+	}
+	return auth.JWK{}, false
+}
+
+// publicKey turns a JWK into the key type jwt-go verifies with.
+func publicKey(k auth.JWK) (interface{}, error) {
+	switch k.KeyType {
+	case "RSA":
+		n, err := base64.RawURLEncoding.DecodeString(k.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := base64.RawURLEncoding.DecodeString(k.E)
+		if err != nil {
+			return nil, err
+		}
+		pub := &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}
+		if pub.N.BitLen() < 2048 {
+			return nil, errors.New("RSA key is too small")
+		}
+		return pub, nil
+	case "EC":
+		if k.Curve != "P-256" {
+			return nil, fmt.Errorf("Unsupported curve %q", k.Curve)
+		}
+		x, err := base64.RawURLEncoding.DecodeString(k.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := base64.RawURLEncoding.DecodeString(k.Y)
+		if err != nil {
+			return nil, err
+		}
+		pub := &ecdsa.PublicKey{Curve: elliptic.P256(), X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}
+		if !pub.Curve.IsOnCurve(pub.X, pub.Y) {
+			return nil, errors.New("EC key is not on its curve")
+		}
+		return pub, nil
+	case "OKP":
+		x, err := base64.RawURLEncoding.DecodeString(k.X)
+		if err != nil || k.Curve != "Ed25519" || len(x) != ed25519.PublicKeySize {
+			return nil, errors.New("Unsupported OKP key")
+		}
+		return ed25519.PublicKey(x), nil
+	}
+	return nil, auth.ErrUnsupportedKey
+}
+
+func stringClaim(mc jwt.MapClaims, name string) string {
+	s, _ := mc[name].(string)
+	return s
+}
+
+// stringsClaim reads a claim that is a string or an array of strings, like
+// aud.
+func stringsClaim(mc jwt.MapClaims, name string) []string {
+	switch v := mc[name].(type) {
+	case string:
+		return []string{v}
+	case []interface{}:
+		ss := []string{}
+		for _, s := range v {
+			if s, ok := s.(string); ok {
+				ss = append(ss, s)
+			}
+		}
+		return ss
+	}
+	return nil
+}
+
+func contains(ss []string, s string) bool {
+	for _, has := range ss {
+		if has == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,90 @@
+package oidc
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+)
+
+var (
+	ErrNoStateFound    = errors.New("No login found")
+	ErrNoIdentityFound = errors.New("No identity found")
+)
+
+type Repository interface {
+	CreateState(st *State) error
+	TakeState(hash []byte) (*State, error)
+	GetIdentity(issuer, subject string) (*Identity, error)
+	CreateIdentity(id *Identity) error
+}
+
+type repository struct {
+	db *sql.DB
+}
+
+func NewRepository(db *sql.DB) Repository {
+	return &repository{
+		db,
+	}
+}
+
+// CreateState also drops logins that were abandoned and have expired.
+func (r *repository) CreateState(st *State) error {
+	if _, err := r.db.Exec("DELETE FROM oidc_state WHERE expires_at < $1", time.Now().UTC()); err != nil {
+		return fmt.Errorf("Deleting expired logins: %w", err)
+	}
+
+	_, err := r.db.Exec("INSERT INTO oidc_state (state_hash, nonce, code_verifier, user_id, expires_at) VALUES ($1, $2, $3, $4, $5)",
+		st.Hash, st.Nonce, st.CodeVerifier, sql.NullString{String: st.UserID, Valid: st.UserID != ""}, st.ExpiresAt)
+	if err != nil {
+		return fmt.Errorf("Creating login: %w", err)
+	}
+
+	return nil
+}
+
+// TakeState returns a login and deletes it in one statement, so that a
+// state can only complete one login.
+func (r *repository) TakeState(hash []byte) (*State, error) {
+	st := &State{}
+	var userID sql.NullString
+
+	err := r.db.QueryRow("DELETE FROM oidc_state WHERE state_hash = $1 RETURNING state_hash, nonce, code_verifier, user_id, expires_at", hash).Scan(
+		&st.Hash, &st.Nonce, &st.CodeVerifier, &userID, &st.ExpiresAt)
+
+	switch {
+	case err == sql.ErrNoRows:
+		return nil, ErrNoStateFound
+	case err != nil:
+		return nil, fmt.Errorf("Retrieving login: %w", err)
+	}
+
+	st.UserID = userID.String
+	return st, nil
+}
+
+func (r *repository) GetIdentity(issuer, subject string) (*Identity, error) {
+	id := &Identity{}
+	err := r.db.QueryRow("SELECT issuer, subject, user_id, email, provisioned, created_at FROM user_identity WHERE issuer = $1 AND subject = $2", issuer, subject).Scan(
+		&id.Issuer, &id.Subject, &id.UserID, &id.Email, &id.Provisioned, &id.CreatedAt)
+
+	switch {
+	case err == sql.ErrNoRows:
+		return nil, ErrNoIdentityFound
+	case err != nil:
+		return nil, fmt.Errorf("Retrieving identity: %w", err)
+	}
+
+	return id, nil
+}
+
+func (r *repository) CreateIdentity(id *Identity) error {
+	_, err := r.db.Exec("INSERT INTO user_identity (issuer, subject, user_id, email, provisioned, created_at) VALUES ($1, $2, $3, $4, $5, $6)",
+		id.Issuer, id.Subject, id.UserID, id.Email, id.Provisioned, id.CreatedAt)
+	if err != nil {
+		return fmt.Errorf("Creating identity: %w", err)
+	}
+
+	return nil
+}
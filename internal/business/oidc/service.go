@@ -0,0 +1,340 @@
+package oidc
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/axwilliams/book-api/internal/business/user"
+	"github.com/axwilliams/book-api/internal/platform/auth"
+	"github.com/axwilliams/book-api/internal/platform/web"
+	"github.com/google/uuid"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// StateLifetime is how long a user has to log in at the provider.
+const StateLifetime = 10 * time.Minute
+
+var (
+	ErrInvalidState   = errors.New("Login is unknown or has expired, please start again")
+	ErrLoginFailed    = errors.New("Login at the identity provider failed")
+	ErrProvider       = errors.New("Identity provider could not be reached")
+	ErrInvalidIDToken = errors.New("Identity provider returned an invalid ID token")
+	ErrNoEmail        = errors.New("Identity provider did not return a verified email address")
+	ErrEmailExists    = errors.New("A user with this email address exists; log in and link the account instead")
+	ErrIdentityLinked = errors.New("This account is linked to another user")
+)
+
+type Service interface {
+	Login(linkUserID string) (*Login, error)
+	Callback(state, code string) (auth.Claims, error)
+}
+
+type service struct {
+	cfg    Config
+	or     Repository
+	ur     user.Repository
+	us     user.Service
+	client *http.Client
+
+	mu sync.Mutex
+	p  *provider
+}
+
+func NewService(cfg Config, or Repository, ur user.Repository, us user.Service) Service {
+	return &service{
+		cfg:    cfg,
+		or:     or,
+		ur:     ur,
+		us:     us,
+		client: &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+// provider discovers the provider on first use, so that the API starts
+// while the provider is down, and tries again on the next login if that
+// fails.
+func (s *service) provider() (*provider, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.p != nil {
+		return s.p, nil
+	}
+
+	p, err := discover(s.cfg.Issuer, s.client)
+	if err != nil {
+		log.Printf("[error] %v", err)
+		return nil, web.NewRequestError(ErrProvider, http.StatusBadGateway)
+	}
+
+	s.p = p
+	return p, nil
+}
+
+// Login starts a login, or with linkUserID the linking of an account to
+// that user.
+func (s *service) Login(linkUserID string) (*Login, error) {
+	p, err := s.provider()
+	if err != nil {
+		return nil, err
+	}
+
+	state, err := random()
+	if err != nil {
+		return nil, err
+	}
+	nonce, err := random()
+	if err != nil {
+		return nil, err
+	}
+	verifier, err := random()
+	if err != nil {
+		return nil, err
+	}
+
+	st := State{
+		Hash:         hash(state),
+		Nonce:        nonce,
+		CodeVerifier: verifier,
+		UserID:       linkUserID,
+		ExpiresAt:    time.Now().UTC().Add(StateLifetime),
+	}
+	if err := s.or.CreateState(&st); err != nil {
+		return nil, err
+	}
+
+	h := sha256.Sum256([]byte(verifier))
+	return &Login{
+		URL:   p.authCodeURL(s.cfg, state, nonce, base64.RawURLEncoding.EncodeToString(h[:])),
+		State: state,
+	}, nil
+}
+
+// Callback completes a login and returns the claims of the user it logged
+// in: the linked user, the user linking their account, or a user
+// provisioned just now.
+func (s *service) Callback(state, code string) (auth.Claims, error) {
+	st, err := s.or.TakeState(hash(state))
+	switch {
+	case err == ErrNoStateFound:
+		return auth.Claims{}, web.NewRequestError(ErrInvalidState, http.StatusBadRequest)
+	case err != nil:
+		return auth.Claims{}, err
+	case !time.Now().Before(st.ExpiresAt):
+		return auth.Claims{}, web.NewRequestError(ErrInvalidState, http.StatusBadRequest)
+	}
+
+	p, err := s.provider()
+	if err != nil {
+		return auth.Claims{}, err
+	}
+
+	raw, err := p.exchange(s.cfg, code, st.CodeVerifier)
+	if err != nil {
+		log.Printf("[error] %v", err)
+		return auth.Claims{}, web.NewRequestError(ErrProvider, http.StatusBadGateway)
+	}
+
+	c, err := p.verify(s.cfg, raw, st.Nonce, time.Now())
+	if err != nil {
+		log.Printf("[oidc] Rejected ID token: %v", err)
+		return auth.Claims{}, web.NewRequestError(ErrInvalidIDToken, http.StatusUnauthorized)
+	}
+
+	id, err := s.or.GetIdentity(p.Issuer, c.Subject)
+	switch {
+	case err == ErrNoIdentityFound:
+		id = nil
+	case err != nil:
+		return auth.Claims{}, err
+	}
+
+	var u *user.User
+	switch {
+	case st.UserID != "":
+		u, err = s.link(id, p.Issuer, c, st.UserID)
+	case id != nil:
+		u, err = s.login(id, c)
+	default:
+		u, err = s.provision(p.Issuer, c)
+	}
+	if err != nil {
+		return auth.Claims{}, err
+	}
+
+	return auth.NewClaims(u.ID, u.Roles), nil
+}
+
+func (s *service) link(id *Identity, issuer string, c Claims, userID string) (*user.User, error) {
+	if id != nil && id.UserID != userID {
+		return nil, web.NewRequestError(ErrIdentityLinked, http.StatusConflict)
+	}
+
+	u, err := s.ur.GetById(userID)
+	switch {
+	case err == user.ErrNoUserFound:
+		return nil, web.NewRequestError(ErrInvalidState, http.StatusBadRequest)
+	case err != nil:
+		return nil, err
+	}
+
+	if id == nil {
+		err := s.or.CreateIdentity(&Identity{
+			Issuer:    issuer,
+			Subject:   c.Subject,
+			UserID:    u.ID,
+			Email:     c.Email,
+			CreatedAt: time.Now().UTC(),
+		})
+		if err != nil {
+			return nil, err
+		}
+		log.Printf("[oidc] Linked %s to user %s", c.Subject, u.ID)
+	}
+
+	return u, nil
+}
+
+// login loads a linked user. Provisioned users get the roles of their
+// groups; when those changed, their other logins end as they would when an
+// admin changes roles. The last ADMIN keeps their roles, so that leaving a
+// group at the provider does not lock everybody out.
+func (s *service) login(id *Identity, c Claims) (*user.User, error) {
+	u, err := s.ur.GetById(id.UserID)
+	if err != nil {
+		return nil, err
+	}
+
+	if !id.Provisioned {
+		return u, nil
+	}
+
+	roles := s.roles(c.Groups)
+	if sameRoles(u.Roles, roles) {
+		return u, nil
+	}
+
+	synced, err := s.us.SetRoles(u.ID, roles, "")
+	if re, ok := err.(*web.RequestError); ok && re.Err == user.ErrLastAdmin {
+		log.Printf("[oidc] User %s is the last ADMIN, kept roles %v", u.ID, u.Roles)
+		return u, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	log.Printf("[oidc] Roles of user %s now %v", u.ID, roles)
+
+	return synced, nil
+}
+
+// provision creates a user for an account logging in for the first time.
+// It does not link to a user with the same email address: that would hand
+// the user to anyone who can get the address into their account at the
+// provider.
+func (s *service) provision(issuer string, c Claims) (*user.User, error) {
+	if c.Email == "" || !c.EmailVerified {
+		return nil, web.NewRequestError(ErrNoEmail, http.StatusUnprocessableEntity)
+	}
+	if !s.ur.EmailAvailable(c.Email, "") {
+		return nil, web.NewRequestError(ErrEmailExists, http.StatusConflict)
+	}
+
+	// SSO users log in at the provider only; nobody knows this password.
+	password, err := random()
+	if err != nil {
+		return nil, err
+	}
+	pwHash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return nil, fmt.Errorf("generating password hash: %w", err)
+	}
+
+	u := &user.User{
+		ID:           uuid.New().String(),
+		Username:     s.username(c),
+		Email:        c.Email,
+		Roles:        s.roles(c.Groups),
+		PasswordHash: pwHash,
+	}
+	if err := s.ur.Create(u, user.DiffRoles(u.ID, "", nil, u.Roles)); err != nil {
+		return nil, err
+	}
+
+	err = s.or.CreateIdentity(&Identity{
+		Issuer:      issuer,
+		Subject:     c.Subject,
+		UserID:      u.ID,
+		Email:       c.Email,
+		Provisioned: true,
+		CreatedAt:   time.Now().UTC(),
+	})
+	if err != nil {
+		return nil, err
+	}
+	log.Printf("[oidc] Provisioned user %s for %s", u.ID, c.Subject)
+
+	return u, nil
+}
+
+// roles maps groups to roles, in the order of the mapping's roles.
+func (s *service) roles(groups []string) []string {
+	roles := []string{}
+	for _, role := range []string{auth.RoleAdmin, auth.RoleAuthor, auth.RoleCurator} {
+		for _, g := range groups {
+			if auth.HasRole(s.cfg.GroupRoles[g], role) {
+				roles = append(roles, role)
+				break
+			}
+		}
+	}
+	return roles
+}
+
+// username prefers the provider's username, then the local part of the
+// email address, and adds a number when the name is taken.
+func (s *service) username(c Claims) string {
+	base := strings.TrimSpace(c.PreferredUsername)
+	if base == "" {
+		base = strings.SplitN(c.Email, "@", 2)[0]
+	}
+
+	name := base
+	for i := 2; !s.ur.UsernameAvailable(name, ""); i++ {
+		name = fmt.Sprintf("%s%d", base, i)
+	}
+	return name
+}
+
+func random() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("Generating random value: %w", err)
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+func hash(s string) []byte {
+	h := sha256.Sum256([]byte(s))
+	return h[:]
+}
+
+// sameRoles reports whether a and b hold the same roles in any order.
+func sameRoles(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for _, r := range b {
+		if !auth.HasRole(a, r) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,299 @@
+package oidc_test
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/axwilliams/book-api/internal/business/oidc"
+	"github.com/axwilliams/book-api/internal/business/role"
+	"github.com/axwilliams/book-api/internal/business/user"
+	"github.com/axwilliams/book-api/internal/platform/auth"
+	"github.com/axwilliams/book-api/internal/platform/web"
+	"github.com/axwilliams/book-api/internal/test"
+	"github.com/axwilliams/book-api/internal/test/mock"
+	"github.com/dgrijalva/jwt-go"
+)
+
+const authorID = "69a47775-6d89-4d38-ad38-acdb2928f6a1"
+
+// users adds the users created by provisioning to the user mock. Like the
+// repository, it refuses to revoke ADMIN from the last user holding it.
+type users struct {
+	mock.MockUser
+	created map[string]*user.User
+}
+
+func (u *users) Create(nu *user.User, cs []user.RoleChange) error {
+	u.created[nu.ID] = nu
+	return nil
+}
+
+func (u *users) GetById(id string) (*user.User, error) {
+	if nu, ok := u.created[id]; ok {
+		c := *nu
+		return &c, nil
+	}
+	return u.MockUser.GetById(id)
+}
+
+func (u *users) Update(nu *user.User, cs []user.RoleChange, revoke func() error) error {
+	if !auth.HasRole(nu.Roles, auth.RoleAdmin) {
+		admins := 0
+		for id, c := range u.created {
+			if id != nu.ID && auth.HasRole(c.Roles, auth.RoleAdmin) {
+				admins++
+			}
+		}
+		if admins == 0 {
+			return web.NewRequestError(user.ErrLastAdmin, http.StatusConflict)
+		}
+	}
+
+	if revoke != nil {
+		if err := revoke(); err != nil {
+			return err
+		}
+	}
+
+	u.created[nu.ID] = nu
+	return nil
+}
+
+type sessions struct {
+	revoked []string
+	err     error
+}
+
+func (s *sessions) RevokeAll(userID string) error {
+	if s.err != nil {
+		return s.err
+	}
+	s.revoked = append(s.revoked, userID)
+	return nil
+}
+
+func status(err error) int {
+	if re, ok := err.(*web.RequestError); ok {
+		return re.Status
+	}
+	if err != nil {
+		return http.StatusInternalServerError
+	}
+	return http.StatusOK
+}
+
+type fixture struct {
+	p   *mock.OIDCProvider
+	srv *httptest.Server
+	os  oidc.Service
+	ur  *users
+	ss  *sessions
+}
+
+func newFixture(t *testing.T) *fixture {
+	p := mock.NewOIDCProvider("book-api", "s3cret")
+	srv := httptest.NewServer(p)
+	p.SetIssuer(srv.URL)
+
+	roles, err := oidc.ParseGroupRoles("library-admins=ADMIN,editors=AUTHOR,editors=CURATOR")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	f := &fixture{p: p, srv: srv, ur: &users{mock.NewMockUser(), map[string]*user.User{}}, ss: &sessions{}}
+	f.os = oidc.NewService(oidc.Config{
+		Issuer:       srv.URL,
+		ClientID:     "book-api",
+		ClientSecret: "s3cret",
+		RedirectURL:  "https://books.example.com/api/v1/oidc/callback",
+		GroupRoles:   roles,
+	}, mock.NewMockOIDC(), f.ur, user.NewService(f.ur, f.ss, role.NewRegistry(mock.NewMockRole())))
+
+	return f
+}
+
+// login runs the code flow for u, optionally linking to linkUserID.
+func (f *fixture) login(t *testing.T, u mock.OIDCUser, linkUserID string) (auth.Claims, error) {
+	f.p.SetUser(u)
+
+	l, err := f.os.Login(linkUserID)
+	if err != nil {
+		t.Fatalf("\t%s\tLogin failed: %v", test.Failed, err)
+	}
+
+	client := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error {
+		return http.ErrUseLastResponse
+	}}
+	res, err := client.Get(l.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+
+	loc, _ := url.Parse(res.Header.Get("Location"))
+	if loc.Query().Get("state") != l.State {
+		t.Fatalf("\t%s\tState not sent back: %v", test.Failed, loc)
+	}
+
+	return f.os.Callback(l.State, loc.Query().Get("code"))
+}
+
+func TestParseGroupRoles(t *testing.T) {
+	m, err := oidc.ParseGroupRoles(" admins = admin, editors=AUTHOR,editors=CURATOR,editors=AUTHOR,")
+	want := map[string][]string{"admins": {"ADMIN"}, "editors": {"AUTHOR", "CURATOR"}}
+	if err != nil || !reflect.DeepEqual(m, want) {
+		t.Fatalf("\t%s\tWrong mapping: %v %v", test.Failed, m, err)
+	}
+
+	for _, s := range []string{"admins", "admins=READER"} {
+		if _, err := oidc.ParseGroupRoles(s); err == nil {
+			t.Fatalf("\t%s\t%q accepted", test.Failed, s)
+		}
+	}
+	t.Logf("\t%s\tGroup roles parsed", test.Success)
+}
+
+func TestProvisioning(t *testing.T) {
+	f := newFixture(t)
+	defer f.srv.Close()
+
+	jane := mock.OIDCUser{Subject: "jane", Email: "jane@example.com", EmailVerified: true, PreferredUsername: "author", Groups: []string{"library-admins", "staff"}}
+
+	samples := []struct {
+		name       string
+		u          mock.OIDCUser
+		statusCode int
+	}{
+		{"Unverified email", mock.OIDCUser{Subject: "x", Email: "x@example.com"}, http.StatusUnprocessableEntity},
+		{"Email of an existing user", mock.OIDCUser{Subject: "x", Email: "author@example.com", EmailVerified: true}, http.StatusConflict},
+		{"Provisioned", jane, http.StatusOK},
+	}
+
+	var claims auth.Claims
+	for _, sample := range samples {
+		c, err := f.login(t, sample.u, "")
+		if got := status(err); got != sample.statusCode {
+			t.Fatalf("\t%s\t%s: want %d got %v", test.Failed, sample.name, sample.statusCode, err)
+		}
+		claims = c
+		t.Logf("\t%s\t%s", test.Success, sample.name)
+	}
+
+	u := f.ur.created[claims.UserID]
+	switch {
+	case u == nil || u.Username != "author2" || u.Email != "jane@example.com":
+		t.Fatalf("\t%s\tWrong user: %+v", test.Failed, u)
+	case !reflect.DeepEqual(claims.Roles, []string{auth.RoleAdmin}):
+		t.Fatalf("\t%s\tWrong roles: %v", test.Failed, claims.Roles)
+	}
+	t.Logf("\t%s\tUser created with the roles of their groups", test.Success)
+
+	if c, err := f.login(t, jane, ""); err != nil || c.UserID != claims.UserID || len(f.ss.revoked) != 0 {
+		t.Fatalf("\t%s\tSecond login: %+v %v", test.Failed, c, err)
+	}
+	t.Logf("\t%s\tSecond login finds the user", test.Success)
+
+	jane.Groups = []string{"editors"}
+	c, err := f.login(t, jane, "")
+	if err != nil || !reflect.DeepEqual(c.Roles, []string{auth.RoleAdmin}) || len(f.ss.revoked) != 0 {
+		t.Fatalf("\t%s\tLast ADMIN lost the role: %+v %v", test.Failed, c, err)
+	}
+	t.Logf("\t%s\tThe last ADMIN keeps their roles", test.Success)
+
+	admin := mock.OIDCUser{Subject: "bob", Email: "bob@example.com", EmailVerified: true, Groups: []string{"library-admins"}}
+	if _, err := f.login(t, admin, ""); err != nil {
+		t.Fatal(err)
+	}
+
+	c, err = f.login(t, jane, "")
+	if err != nil || !reflect.DeepEqual(c.Roles, []string{auth.RoleAuthor, auth.RoleCurator}) || len(f.ss.revoked) != 1 {
+		t.Fatalf("\t%s\tRoles not synchronized: %+v %v %v", test.Failed, c, err, f.ss.revoked)
+	}
+	t.Logf("\t%s\tRoles follow the groups and end other logins", test.Success)
+
+	jane.Groups = []string{"library-admins"}
+	f.ss.err = errors.New("sessions unavailable")
+	if _, err := f.login(t, jane, ""); err == nil {
+		t.Fatalf("\t%s\tRoles changed without ending the logins", test.Failed)
+	}
+
+	saved, err := f.ur.GetById(c.UserID)
+	if err != nil || !reflect.DeepEqual([]string(saved.Roles), []string{auth.RoleAuthor, auth.RoleCurator}) {
+		t.Fatalf("\t%s\tRoles saved without ending the logins: %+v %v", test.Failed, saved, err)
+	}
+	t.Logf("\t%s\tRoles are kept when the logins cannot be ended", test.Success)
+}
+
+func TestLinking(t *testing.T) {
+	f := newFixture(t)
+	defer f.srv.Close()
+
+	sso := mock.OIDCUser{Subject: "author-sso", Email: "a.author@corp.example.com", EmailVerified: true, Groups: []string{"library-admins"}}
+
+	c, err := f.login(t, sso, authorID)
+	if err != nil || c.UserID != authorID {
+		t.Fatalf("\t%s\tLinking failed: %+v %v", test.Failed, c, err)
+	}
+
+	// Linked users keep the roles an admin gave them.
+	c, err = f.login(t, sso, "")
+	if err != nil || c.UserID != authorID || !reflect.DeepEqual(c.Roles, []string{auth.RoleAuthor}) {
+		t.Fatalf("\t%s\tLogin of the linked account: %+v %v", test.Failed, c, err)
+	}
+	t.Logf("\t%s\tAccount linked", test.Success)
+
+	other, err := f.login(t, mock.OIDCUser{Subject: "bob", Email: "bob@example.com", EmailVerified: true}, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := f.login(t, sso, other.UserID); status(err) != http.StatusConflict {
+		t.Fatalf("\t%s\tAccount linked twice: %v", test.Failed, err)
+	}
+	t.Logf("\t%s\tAccount of another user not linked", test.Success)
+}
+
+func TestIDTokenValidation(t *testing.T) {
+	f := newFixture(t)
+	defer f.srv.Close()
+
+	jane := mock.OIDCUser{Subject: "jane", Email: "jane@example.com", EmailVerified: true}
+
+	samples := []struct {
+		name   string
+		tamper func(jwt.MapClaims)
+	}{
+		{"Other issuer", func(c jwt.MapClaims) { c["iss"] = "https://evil.example.com" }},
+		{"Other audience", func(c jwt.MapClaims) { c["aud"] = "other-app" }},
+		{"Other authorized party", func(c jwt.MapClaims) { c["aud"] = []string{"book-api", "other-app"}; c["azp"] = "other-app" }},
+		{"Expired", func(c jwt.MapClaims) { c["exp"] = time.Now().Add(-time.Hour).Unix() }},
+		{"Issued in the future", func(c jwt.MapClaims) { c["iat"] = time.Now().Add(time.Hour).Unix() }},
+		{"Wrong nonce", func(c jwt.MapClaims) { c["nonce"] = "replayed" }},
+		{"No subject", func(c jwt.MapClaims) { delete(c, "sub") }},
+	}
+
+	for _, sample := range samples {
+		f.p.Tamper(sample.tamper)
+		if _, err := f.login(t, jane, ""); status(err) != http.StatusUnauthorized {
+			t.Fatalf("\t%s\t%s: want 401 got %v", test.Failed, sample.name, err)
+		}
+		t.Logf("\t%s\t%s rejected", test.Success, sample.name)
+	}
+
+	f.p.Tamper(func(c jwt.MapClaims) { c["aud"] = []string{"book-api", "other-app"}; c["azp"] = "book-api" })
+	if _, err := f.login(t, jane, ""); err != nil {
+		t.Fatalf("\t%s\tSeveral audiences with azp: %v", test.Failed, err)
+	}
+	t.Logf("\t%s\tSeveral audiences with azp accepted", test.Success)
+
+	f.p.Tamper(nil)
+	l, _ := f.os.Login("")
+	if _, err := f.os.Callback(l.State+"x", "code"); status(err) != http.StatusBadRequest {
+		t.Fatalf("\t%s\tUnknown state: want 400 got %v", test.Failed, err)
+	}
+	t.Logf("\t%s\tUnknown state rejected", test.Success)
+}
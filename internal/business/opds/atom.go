@@ -0,0 +1,173 @@
+package opds
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"strconv"
+	"time"
+)
+
+const (
+	nsAtom       = "http://www.w3.org/2005/Atom"
+	nsOPDS       = "http://opds-spec.org/2010/catalog"
+	nsDC         = "http://purl.org/dc/terms/"
+	nsOpenSearch = "http://a9.com/-/spec/opensearch/1.1/"
+	nsThread     = "http://purl.org/syndication/thread/1.0"
+)
+
+type atomLink struct {
+	Rel   string `xml:"rel,attr,omitempty"`
+	Href  string `xml:"href,attr"`
+	Type  string `xml:"type,attr,omitempty"`
+	Title string `xml:"title,attr,omitempty"`
+	Count string `xml:"thr:count,attr,omitempty"`
+}
+
+type atomAuthor struct {
+	Name string `xml:"name"`
+}
+
+type atomCategory struct {
+	Term  string `xml:"term,attr"`
+	Label string `xml:"label,attr"`
+}
+
+type atomEntry struct {
+	XMLName    xml.Name       `xml:"entry"`
+	Title      string         `xml:"title"`
+	ID         string         `xml:"id"`
+	Updated    string         `xml:"updated"`
+	Authors    []atomAuthor   `xml:"author"`
+	Identifier string         `xml:"dc:identifier,omitempty"`
+	Categories []atomCategory `xml:"category"`
+	Summary    string         `xml:"summary,omitempty"`
+	Links      []atomLink     `xml:"link"`
+}
+
+type atomFeed struct {
+	XMLName      xml.Name    `xml:"feed"`
+	Xmlns        string      `xml:"xmlns,attr"`
+	XmlnsOPDS    string      `xml:"xmlns:opds,attr"`
+	XmlnsDC      string      `xml:"xmlns:dc,attr"`
+	XmlnsSearch  string      `xml:"xmlns:opensearch,attr"`
+	XmlnsThread  string      `xml:"xmlns:thr,attr"`
+	ID           string      `xml:"id"`
+	Title        string      `xml:"title"`
+	Updated      string      `xml:"updated"`
+	Author       atomAuthor  `xml:"author"`
+	ItemsPerPage int         `xml:"opensearch:itemsPerPage,omitempty"`
+	StartIndex   int         `xml:"opensearch:startIndex,omitempty"`
+	Links        []atomLink  `xml:"link"`
+	Entries      []atomEntry `xml:"entry"`
+}
+
+func atomTime(t time.Time) string {
+	if t.IsZero() {
+		t = time.Unix(0, 0)
+	}
+	return t.UTC().Format(time.RFC3339)
+}
+
+func atomLinks(ls []Link) []atomLink {
+	als := make([]atomLink, 0, len(ls))
+	for _, l := range ls {
+		al := atomLink{Rel: l.Rel, Href: l.Href, Type: l.Type, Title: l.Title}
+		if l.Count > 0 {
+			al.Count = strconv.Itoa(l.Count)
+		}
+		als = append(als, al)
+	}
+	return als
+}
+
+// Atom renders f as an OPDS 1.2 catalog feed.
+func Atom(f *Feed) ([]byte, error) {
+	af := atomFeed{
+		Xmlns:       nsAtom,
+		XmlnsOPDS:   nsOPDS,
+		XmlnsDC:     nsDC,
+		XmlnsSearch: nsOpenSearch,
+		XmlnsThread: nsThread,
+		ID:          f.ID,
+		Title:       f.Title,
+		Updated:     atomTime(f.Updated),
+		Author:      atomAuthor{catalogTitle},
+		Links:       atomLinks(f.Links),
+	}
+
+	if f.ItemsPerPage > 0 {
+		af.ItemsPerPage = f.ItemsPerPage
+		af.StartIndex = (f.CurrentPage-1)*f.ItemsPerPage + 1
+	}
+
+	for _, e := range f.Entries {
+		ae := atomEntry{
+			Title:      e.Title,
+			ID:         e.ID,
+			Updated:    atomTime(e.Updated),
+			Identifier: e.Identifier,
+			Summary:    e.Summary,
+			Links:      atomLinks(e.Links),
+		}
+		for _, a := range e.Authors {
+			ae.Authors = append(ae.Authors, atomAuthor{a})
+		}
+		for _, c := range e.Categories {
+			ae.Categories = append(ae.Categories, atomCategory{Term: c, Label: c})
+		}
+		af.Entries = append(af.Entries, ae)
+	}
+
+	var buf bytes.Buffer
+	buf.WriteString(xml.Header)
+
+	enc := xml.NewEncoder(&buf)
+	enc.Indent("", "  ")
+	if err := enc.Encode(af); err != nil {
+		return nil, fmt.Errorf("Encoding OPDS feed: %w", err)
+	}
+	buf.WriteByte('\n')
+
+	return buf.Bytes(), nil
+}
+
+type openSearchURL struct {
+	Type     string `xml:"type,attr"`
+	Template string `xml:"template,attr"`
+}
+
+type openSearchDescription struct {
+	XMLName        xml.Name      `xml:"OpenSearchDescription"`
+	Xmlns          string        `xml:"xmlns,attr"`
+	ShortName      string        `xml:"ShortName"`
+	Description    string        `xml:"Description"`
+	InputEncoding  string        `xml:"InputEncoding"`
+	OutputEncoding string        `xml:"OutputEncoding"`
+	URL            openSearchURL `xml:"Url"`
+}
+
+// OpenSearch describes the search feed, so that clients can fill in
+// searchTerms and startPage themselves.
+func OpenSearch(name, template string) ([]byte, error) {
+	d := openSearchDescription{
+		Xmlns:          nsOpenSearch,
+		ShortName:      name,
+		Description:    "Search " + name + " by title or author",
+		InputEncoding:  "UTF-8",
+		OutputEncoding: "UTF-8",
+		URL:            openSearchURL{Type: ContentTypeAcquisition, Template: template},
+	}
+
+	var buf bytes.Buffer
+	buf.WriteString(xml.Header)
+
+	enc := xml.NewEncoder(&buf)
+	enc.Indent("", "  ")
+	if err := enc.Encode(d); err != nil {
+		return nil, fmt.Errorf("Encoding OpenSearch description: %w", err)
+	}
+	buf.WriteByte('\n')
+
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,134 @@
+package opds
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+type jsonLink struct {
+	Rel        string          `json:"rel,omitempty"`
+	Href       string          `json:"href"`
+	Type       string          `json:"type,omitempty"`
+	Title      string          `json:"title,omitempty"`
+	Templated  bool            `json:"templated,omitempty"`
+	Properties *jsonProperties `json:"properties,omitempty"`
+}
+
+type jsonProperties struct {
+	NumberOfItems int `json:"numberOfItems"`
+}
+
+type jsonContributor struct {
+	Name string `json:"name"`
+}
+
+type jsonPublicationMetadata struct {
+	Type        string            `json:"@type"`
+	Identifier  string            `json:"identifier,omitempty"`
+	Title       string            `json:"title"`
+	Author      []jsonContributor `json:"author,omitempty"`
+	Description string            `json:"description,omitempty"`
+	Subject     []string          `json:"subject,omitempty"`
+	Modified    string            `json:"modified"`
+}
+
+type jsonPublication struct {
+	Metadata jsonPublicationMetadata `json:"metadata"`
+	Links    []jsonLink              `json:"links"`
+	Images   []jsonLink              `json:"images,omitempty"`
+}
+
+type jsonFeedMetadata struct {
+	Title        string `json:"title"`
+	Modified     string `json:"modified"`
+	ItemsPerPage int    `json:"itemsPerPage,omitempty"`
+	CurrentPage  int    `json:"currentPage,omitempty"`
+}
+
+type jsonFeed struct {
+	Metadata     jsonFeedMetadata  `json:"metadata"`
+	Links        []jsonLink        `json:"links"`
+	Navigation   []jsonLink        `json:"navigation,omitempty"`
+	Publications []jsonPublication `json:"publications,omitempty"`
+}
+
+func jsonLinks(ls []Link) []jsonLink {
+	jls := make([]jsonLink, 0, len(ls))
+	for _, l := range ls {
+		jl := jsonLink{Rel: l.Rel, Href: l.Href, Type: opds2Type(l.Type), Title: l.Title}
+		if l.Count > 0 {
+			jl.Properties = &jsonProperties{l.Count}
+		}
+		jls = append(jls, jl)
+	}
+	return jls
+}
+
+// opds2Type points links between feeds at their JSON rendering.
+func opds2Type(t string) string {
+	switch t {
+	case ContentTypeNavigation, ContentTypeAcquisition:
+		return ContentTypeOPDS2
+	}
+	return t
+}
+
+// JSON renders f as an OPDS 2.0 feed.
+func JSON(f *Feed) ([]byte, error) {
+	jf := jsonFeed{
+		Metadata: jsonFeedMetadata{
+			Title:        f.Title,
+			Modified:     atomTime(f.Updated),
+			ItemsPerPage: f.ItemsPerPage,
+			CurrentPage:  f.CurrentPage,
+		},
+		Links: []jsonLink{},
+	}
+
+	for _, l := range jsonLinks(f.Links) {
+		if l.Rel == RelSearch {
+			l.Href, l.Type, l.Templated = searchTemplate, ContentTypeOPDS2, true
+		}
+		jf.Links = append(jf.Links, l)
+	}
+
+	for _, e := range f.Entries {
+		if f.Kind == KindNavigation {
+			for _, l := range jsonLinks(e.Links) {
+				l.Title = e.Title
+				jf.Navigation = append(jf.Navigation, l)
+			}
+			continue
+		}
+
+		p := jsonPublication{
+			Metadata: jsonPublicationMetadata{
+				Type:        "http://schema.org/Book",
+				Identifier:  e.Identifier,
+				Title:       e.Title,
+				Description: e.Summary,
+				Subject:     e.Categories,
+				Modified:    atomTime(e.Updated),
+			},
+			Links: []jsonLink{},
+		}
+		for _, a := range e.Authors {
+			p.Metadata.Author = append(p.Metadata.Author, jsonContributor{a})
+		}
+		for _, l := range jsonLinks(e.Links) {
+			if l.Rel == RelImage || l.Rel == RelThumbnail {
+				p.Images = append(p.Images, l)
+				continue
+			}
+			p.Links = append(p.Links, l)
+		}
+		jf.Publications = append(jf.Publications, p)
+	}
+
+	body, err := json.Marshal(jf)
+	if err != nil {
+		return nil, fmt.Errorf("Encoding OPDS 2 feed: %w", err)
+	}
+
+	return body, nil
+}
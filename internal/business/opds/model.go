@@ -0,0 +1,69 @@
+package opds
+
+import (
+	"time"
+)
+
+const (
+	KindNavigation  = "navigation"
+	KindAcquisition = "acquisition"
+)
+
+const (
+	ContentTypeNavigation  = "application/atom+xml;profile=opds-catalog;kind=navigation"
+	ContentTypeAcquisition = "application/atom+xml;profile=opds-catalog;kind=acquisition"
+	ContentTypeEntry       = "application/atom+xml;type=entry;profile=opds-catalog"
+	ContentTypeOpenSearch  = "application/opensearchdescription+xml"
+	ContentTypeOPDS2       = "application/opds+json"
+	ContentTypeBook        = "application/json"
+)
+
+const (
+	RelSelf        = "self"
+	RelStart       = "start"
+	RelUp          = "up"
+	RelSearch      = "search"
+	RelFirst       = "first"
+	RelPrevious    = "previous"
+	RelNext        = "next"
+	RelSubsection  = "subsection"
+	RelAlternate   = "alternate"
+	RelNew         = "http://opds-spec.org/sort/new"
+	RelAcquisition = "http://opds-spec.org/acquisition"
+	RelImage       = "http://opds-spec.org/image"
+	RelThumbnail   = "http://opds-spec.org/image/thumbnail"
+)
+
+// Feed is a catalog page independent of its serialization, rendered either
+// as an OPDS 1.2 Atom feed or as OPDS 2.0 JSON.
+type Feed struct {
+	ID           string
+	Title        string
+	Kind         string
+	Updated      time.Time
+	Links        []Link
+	Entries      []Entry
+	ItemsPerPage int
+	CurrentPage  int
+}
+
+type Link struct {
+	Rel   string
+	Href  string
+	Type  string
+	Title string
+	Count int
+}
+
+// Entry is a navigation entry pointing at another feed, or a publication
+// when the feed is an acquisition feed.
+type Entry struct {
+	ID         string
+	Title      string
+	Updated    time.Time
+	Authors    []string
+	Summary    string
+	Categories []string
+	Identifier string
+	Links      []Link
+}
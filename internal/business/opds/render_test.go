@@ -0,0 +1,119 @@
+package opds_test
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/axwilliams/book-api/internal/business/opds"
+	"github.com/axwilliams/book-api/internal/test"
+)
+
+var feed = &opds.Feed{
+	ID:           "urn:book-api:opds:books?",
+	Title:        "All books",
+	Kind:         opds.KindAcquisition,
+	Updated:      time.Date(2020, 5, 1, 12, 0, 0, 0, time.UTC),
+	ItemsPerPage: 50,
+	CurrentPage:  2,
+	Links: []opds.Link{
+		{Rel: opds.RelSelf, Href: "/api/v1/opds/books?page=2", Type: opds.ContentTypeAcquisition},
+		{Rel: opds.RelSearch, Href: "/api/v1/opds/opensearch.xml", Type: opds.ContentTypeOpenSearch},
+	},
+	Entries: []opds.Entry{
+		{
+			ID:         "urn:uuid:f4ac7e14-fc8e-4096-b956-34e5a33040f2",
+			Title:      "The Castle",
+			Authors:    []string{"Franz Kafka"},
+			Categories: []string{"Fiction"},
+			Identifier: "urn:isbn:978-0241372579",
+			Links: []opds.Link{
+				{Rel: opds.RelAlternate, Href: "/api/v1/books/f4ac7e14-fc8e-4096-b956-34e5a33040f2", Type: opds.ContentTypeBook},
+				{Rel: opds.RelThumbnail, Href: "/covers/castle.jpg", Type: "image/jpeg"},
+			},
+		},
+	},
+}
+
+func TestAtom(t *testing.T) {
+	body, err := opds.Atom(feed)
+	if err != nil {
+		t.Fatalf("\t%s\tRendering failed: %v", test.Failed, err)
+	}
+
+	var parsed struct {
+		XMLName    xml.Name `xml:"http://www.w3.org/2005/Atom feed"`
+		StartIndex int      `xml:"http://a9.com/-/spec/opensearch/1.1/ startIndex"`
+		Entries    []struct {
+			Title      string `xml:"http://www.w3.org/2005/Atom title"`
+			Identifier string `xml:"http://purl.org/dc/terms/ identifier"`
+		} `xml:"http://www.w3.org/2005/Atom entry"`
+	}
+	if err := xml.Unmarshal(body, &parsed); err != nil {
+		t.Fatalf("\t%s\tFeed is not namespaced XML: %v", test.Failed, err)
+	}
+	t.Logf("\t%s\tFeed parses as Atom", test.Success)
+
+	if parsed.StartIndex != 51 {
+		t.Fatalf("\t%s\tWrong start index: want 51 got %d", test.Failed, parsed.StartIndex)
+	}
+
+	if len(parsed.Entries) != 1 || parsed.Entries[0].Identifier != "urn:isbn:978-0241372579" {
+		t.Fatalf("\t%s\tWrong entries: %+v", test.Failed, parsed.Entries)
+	}
+	t.Logf("\t%s\tEntries correct", test.Success)
+}
+
+func TestJSON(t *testing.T) {
+	body, err := opds.JSON(feed)
+	if err != nil {
+		t.Fatalf("\t%s\tRendering failed: %v", test.Failed, err)
+	}
+
+	var parsed struct {
+		Links []struct {
+			Rel       string `json:"rel"`
+			Href      string `json:"href"`
+			Type      string `json:"type"`
+			Templated bool   `json:"templated"`
+		} `json:"links"`
+		Publications []struct {
+			Metadata struct {
+				Title  string `json:"title"`
+				Author []struct {
+					Name string `json:"name"`
+				} `json:"author"`
+			} `json:"metadata"`
+			Links  []json.RawMessage `json:"links"`
+			Images []json.RawMessage `json:"images"`
+		} `json:"publications"`
+	}
+	if err := json.Unmarshal(body, &parsed); err != nil {
+		t.Fatalf("\t%s\tFeed is not JSON: %v", test.Failed, err)
+	}
+
+	if l := parsed.Links[0]; l.Type != opds.ContentTypeOPDS2 {
+		t.Fatalf("\t%s\tFeed links should point at OPDS 2: got %q", test.Failed, l.Type)
+	}
+
+	if l := parsed.Links[1]; !l.Templated || !strings.Contains(l.Href, "{?q}") {
+		t.Fatalf("\t%s\tSearch link should be a template: got %+v", test.Failed, l)
+	}
+	t.Logf("\t%s\tLinks correct", test.Success)
+
+	if len(parsed.Publications) != 1 {
+		t.Fatalf("\t%s\tWrong publication count: want 1 got %d", test.Failed, len(parsed.Publications))
+	}
+
+	p := parsed.Publications[0]
+	if p.Metadata.Title != "The Castle" || len(p.Metadata.Author) != 1 || p.Metadata.Author[0].Name != "Franz Kafka" {
+		t.Fatalf("\t%s\tWrong metadata: %+v", test.Failed, p.Metadata)
+	}
+
+	if len(p.Links) != 1 || len(p.Images) != 1 {
+		t.Fatalf("\t%s\tImages should be split from links: got %d links and %d images", test.Failed, len(p.Links), len(p.Images))
+	}
+	t.Logf("\t%s\tPublication correct", test.Success)
+}
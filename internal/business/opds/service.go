@@ -0,0 +1,280 @@
+package opds
+
+import (
+	"errors"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/axwilliams/book-api/internal/business/book"
+	"github.com/axwilliams/book-api/internal/platform/web"
+)
+
+// BasePath is where the catalog is mounted. Feeds link to each other with
+// absolute paths so that readers can follow them from any page.
+const BasePath = "/api/v1/opds"
+
+// PageSize is the number of publications in one acquisition feed page.
+const PageSize = 50
+
+const (
+	catalogTitle = "book-api"
+
+	// openSearchTemplate and searchTemplate describe the same search, once
+	// in OpenSearch syntax for OPDS 1.2 and once as a URI template for 2.0.
+	openSearchTemplate = BasePath + "/books?q={searchTerms}&page={startPage?}"
+	searchTemplate     = BasePath + "/books{?q}"
+)
+
+var (
+	ErrInvalidPage    = errors.New("page must be a positive number")
+	ErrInvalidSection = errors.New("section must be categories or authors")
+)
+
+// Query selects the publications of an acquisition feed. Filters combine;
+// an empty Query lists the whole catalog by title.
+type Query struct {
+	Category string
+	Author   string
+	Search   string
+	New      bool
+	Page     string
+}
+
+type Service interface {
+	Root() *Feed
+	Navigation(section string) (*Feed, error)
+	Books(q Query) (*Feed, error)
+	OpenSearch() ([]byte, error)
+}
+
+type service struct {
+	bs book.Service
+}
+
+func NewService(bs book.Service) Service {
+	return &service{
+		bs,
+	}
+}
+
+// commonLinks are the links every feed carries besides its own.
+func commonLinks() []Link {
+	return []Link{
+		{Rel: RelStart, Href: BasePath, Type: ContentTypeNavigation, Title: catalogTitle},
+		{Rel: RelSearch, Href: BasePath + "/opensearch.xml", Type: ContentTypeOpenSearch, Title: "Search"},
+	}
+}
+
+func (s *service) Root() *Feed {
+	f := &Feed{
+		ID:      "urn:book-api:opds",
+		Title:   catalogTitle,
+		Kind:    KindNavigation,
+		Updated: time.Now(),
+		Links:   append([]Link{{Rel: RelSelf, Href: BasePath, Type: ContentTypeNavigation}}, commonLinks()...),
+	}
+
+	sections := []struct {
+		id, title, summary, rel, href, typ string
+	}{
+		{"new", "New arrivals", "Recently added books", RelNew, BasePath + "/books?sort=new", ContentTypeAcquisition},
+		{"categories", "Categories", "Browse books by category", RelSubsection, BasePath + "/categories", ContentTypeNavigation},
+		{"authors", "Authors", "Browse books by author", RelSubsection, BasePath + "/authors", ContentTypeNavigation},
+		{"all", "All books", "Every book by title", RelSubsection, BasePath + "/books", ContentTypeAcquisition},
+	}
+
+	for _, sc := range sections {
+		f.Entries = append(f.Entries, Entry{
+			ID:      "urn:book-api:opds:" + sc.id,
+			Title:   sc.title,
+			Updated: f.Updated,
+			Summary: sc.summary,
+			Links:   []Link{{Rel: sc.rel, Href: sc.href, Type: sc.typ}},
+		})
+	}
+
+	return f
+}
+
+// Navigation lists the categories or authors of published books, each
+// linking to an acquisition feed of their books.
+func (s *service) Navigation(section string) (*Feed, error) {
+	var field, title, param string
+	switch section {
+	case "categories":
+		field, title, param = book.FacetCategory, "Categories", "category"
+	case "authors":
+		field, title, param = book.FacetAuthor, "Authors", "author"
+	default:
+		return nil, web.NewRequestError(ErrInvalidSection, http.StatusNotFound)
+	}
+
+	fs, err := s.bs.Facets(field, book.StatusPublished)
+	if err != nil {
+		return nil, err
+	}
+
+	self := BasePath + "/" + section
+	f := &Feed{
+		ID:      "urn:book-api:opds:" + section,
+		Title:   title,
+		Kind:    KindNavigation,
+		Updated: time.Now(),
+		Links: append([]Link{
+			{Rel: RelSelf, Href: self, Type: ContentTypeNavigation},
+			{Rel: RelUp, Href: BasePath, Type: ContentTypeNavigation},
+		}, commonLinks()...),
+	}
+
+	for _, fc := range fs {
+		href := BasePath + "/books?" + url.Values{param: {fc.Name}}.Encode()
+		f.Entries = append(f.Entries, Entry{
+			ID:      "urn:book-api:opds:" + param + ":" + url.PathEscape(fc.Name),
+			Title:   fc.Name,
+			Updated: f.Updated,
+			Summary: strconv.Itoa(fc.Count) + " books",
+			Links:   []Link{{Rel: RelSubsection, Href: href, Type: ContentTypeAcquisition, Count: fc.Count}},
+		})
+	}
+
+	return f, nil
+}
+
+// Books is a page of published books. One extra row is fetched to tell
+// whether a next page exists without counting the whole result.
+func (s *service) Books(q Query) (*Feed, error) {
+	page := 1
+	if q.Page != "" {
+		p, err := strconv.Atoi(q.Page)
+		if err != nil || p < 1 {
+			return nil, web.NewRequestError(ErrInvalidPage, http.StatusBadRequest)
+		}
+		page = p
+	}
+
+	sp := book.SearchParams{
+		Query:    strings.TrimSpace(q.Search),
+		Author:   q.Author,
+		Category: q.Category,
+		Status:   book.StatusPublished,
+	}
+
+	sort, order := "title", "asc"
+	if q.New {
+		sort, order = "created_at", "desc"
+	}
+
+	bks, err := s.bs.Search(sp, sort, order, strconv.Itoa(PageSize+1), strconv.Itoa((page-1)*PageSize))
+	if err != nil {
+		return nil, err
+	}
+
+	more := len(bks) > PageSize
+	if more {
+		bks = bks[:PageSize]
+	}
+
+	params := url.Values{}
+	title := "All books"
+	switch {
+	case sp.Query != "":
+		params.Set("q", sp.Query)
+		title = "Search results for " + sp.Query
+	case q.Category != "":
+		title = q.Category
+	case q.Author != "":
+		title = q.Author
+	case q.New:
+		title = "New arrivals"
+	}
+	if q.Category != "" {
+		params.Set("category", q.Category)
+	}
+	if q.Author != "" {
+		params.Set("author", q.Author)
+	}
+	if q.New {
+		params.Set("sort", "new")
+	}
+
+	pageHref := func(n int) string {
+		v := url.Values{}
+		for k, vs := range params {
+			v[k] = vs
+		}
+		if n > 1 {
+			v.Set("page", strconv.Itoa(n))
+		}
+		if len(v) == 0 {
+			return BasePath + "/books"
+		}
+		return BasePath + "/books?" + v.Encode()
+	}
+
+	f := &Feed{
+		ID:           "urn:book-api:opds:books?" + params.Encode(),
+		Title:        title,
+		Kind:         KindAcquisition,
+		ItemsPerPage: PageSize,
+		CurrentPage:  page,
+		Links: []Link{
+			{Rel: RelSelf, Href: pageHref(page), Type: ContentTypeAcquisition},
+			{Rel: RelUp, Href: BasePath, Type: ContentTypeNavigation},
+			{Rel: RelFirst, Href: pageHref(1), Type: ContentTypeAcquisition},
+		},
+	}
+	if page > 1 {
+		f.Links = append(f.Links, Link{Rel: RelPrevious, Href: pageHref(page - 1), Type: ContentTypeAcquisition})
+	}
+	if more {
+		f.Links = append(f.Links, Link{Rel: RelNext, Href: pageHref(page + 1), Type: ContentTypeAcquisition})
+	}
+	f.Links = append(f.Links, commonLinks()...)
+
+	for _, bk := range bks {
+		e := publication(bk)
+		if e.Updated.After(f.Updated) {
+			f.Updated = e.Updated
+		}
+		f.Entries = append(f.Entries, e)
+	}
+	if f.Updated.IsZero() {
+		f.Updated = time.Now()
+	}
+
+	return f, nil
+}
+
+// publication describes bk as an acquisition feed entry, linking to the
+// book's JSON record.
+func publication(bk book.Book) Entry {
+	e := Entry{
+		ID:         "urn:uuid:" + bk.ID,
+		Title:      bk.Title,
+		Updated:    bk.UpdatedAt,
+		Summary:    bk.Description,
+		Identifier: "urn:uuid:" + bk.ID,
+		Links: []Link{
+			{Rel: RelAlternate, Href: "/api/v1/books/" + bk.ID, Type: ContentTypeBook, Title: bk.Title},
+		},
+	}
+
+	if bk.ISBN != "" {
+		e.Identifier = "urn:isbn:" + bk.ISBN
+	}
+	if bk.Author != "" {
+		e.Authors = []string{bk.Author}
+	}
+	if bk.Category != "" {
+		e.Categories = []string{bk.Category}
+	}
+
+	return e
+}
+
+func (s *service) OpenSearch() ([]byte, error) {
+	return OpenSearch(catalogTitle, openSearchTemplate)
+}
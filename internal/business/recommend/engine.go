@@ -0,0 +1,293 @@
+package recommend
+
+import (
+	"math"
+	"sort"
+	"strings"
+	"unicode"
+
+	"github.com/axwilliams/book-api/internal/business/book"
+)
+
+const (
+	weightAuthor   = 0.35
+	weightCategory = 0.15
+	weightTerms    = 0.5
+	weightReaders  = 0.5
+)
+
+var stopWords = map[string]bool{
+	"a": true, "an": true, "and": true, "as": true, "at": true, "by": true, "for": true,
+	"from": true, "in": true, "into": true, "is": true, "it": true, "its": true, "of": true,
+	"on": true, "or": true, "that": true, "the": true, "this": true, "to": true, "with": true,
+}
+
+// CoOccurrence reports how many readers of a book also read each other
+// book. The repository counts users who shelved or rated both.
+type CoOccurrence interface {
+	Counts(bookID string) (map[string]int, error)
+}
+
+// Engine scores books against each other from shared authors, category and
+// the TF-IDF cosine similarity of their titles and descriptions.
+type Engine struct {
+	books   []book.Book
+	index   map[string]int
+	authors []map[string]bool
+	vectors []map[string]float64
+	co      CoOccurrence
+	scaled  map[string]map[string]float64
+}
+
+func NewEngine(bks []book.Book, co CoOccurrence) *Engine {
+	e := &Engine{
+		books:   bks,
+		index:   make(map[string]int, len(bks)),
+		authors: make([]map[string]bool, len(bks)),
+		vectors: make([]map[string]float64, len(bks)),
+		co:      co,
+		scaled:  map[string]map[string]float64{},
+	}
+
+	df := map[string]int{}
+	tfs := make([]map[string]float64, len(bks))
+
+	for i, bk := range bks {
+		e.index[bk.ID] = i
+		e.authors[i] = authorSet(bk.Author)
+
+		tf := map[string]float64{}
+		for _, t := range Terms(bk.Title + " " + bk.Description) {
+			tf[t]++
+		}
+		for t := range tf {
+			df[t]++
+		}
+		tfs[i] = tf
+	}
+
+	n := float64(len(bks))
+	for i, tf := range tfs {
+		vec := make(map[string]float64, len(tf))
+		norm := 0.0
+		for t, f := range tf {
+			w := (1 + math.Log(f)) * math.Log(1+n/float64(df[t]))
+			vec[t] = w
+			norm += w * w
+		}
+		norm = math.Sqrt(norm)
+		for t := range vec {
+			vec[t] /= norm
+		}
+		e.vectors[i] = vec
+	}
+
+	return e
+}
+
+func (e *Engine) Has(id string) bool {
+	_, ok := e.index[id]
+	return ok
+}
+
+// SimilarTo ranks every other book against the book with the given ID and
+// returns the best scoring ones.
+func (e *Engine) SimilarTo(id string, limit int) ([]Similar, error) {
+	i, ok := e.index[id]
+	if !ok {
+		return nil, book.ErrNoBookFound
+	}
+
+	readers, err := e.readers(id)
+	if err != nil {
+		return nil, err
+	}
+
+	sims := []Similar{}
+	for j := range e.books {
+		if j == i {
+			continue
+		}
+
+		score, reasons := e.pair(i, j, readers)
+		if score <= 0 {
+			continue
+		}
+
+		sims = append(sims, Similar{
+			BookID:    id,
+			SimilarID: e.books[j].ID,
+			Score:     score,
+			Reasons:   reasons,
+		})
+	}
+
+	return Top(sims, limit), nil
+}
+
+// Pair scores a single pair of books, as seen from the first one.
+func (e *Engine) Pair(id, otherID string) (float64, []string, error) {
+	i, ok := e.index[id]
+	if !ok {
+		return 0, nil, book.ErrNoBookFound
+	}
+
+	j, ok := e.index[otherID]
+	if !ok {
+		return 0, nil, book.ErrNoBookFound
+	}
+
+	readers, err := e.readers(id)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	score, reasons := e.pair(i, j, readers)
+
+	return score, reasons, nil
+}
+
+func (e *Engine) pair(i, j int, readers map[string]float64) (float64, []string) {
+	score := 0.0
+	reasons := []string{}
+
+	if a := jaccard(e.authors[i], e.authors[j]); a > 0 {
+		score += weightAuthor * a
+		reasons = append(reasons, ReasonAuthor)
+	}
+
+	ci := strings.ToLower(strings.TrimSpace(e.books[i].Category))
+	if ci != "" && ci == strings.ToLower(strings.TrimSpace(e.books[j].Category)) {
+		score += weightCategory
+		reasons = append(reasons, ReasonCategory)
+	}
+
+	if c := cosine(e.vectors[i], e.vectors[j]); c > 0 {
+		score += weightTerms * c
+		reasons = append(reasons, ReasonTerms)
+	}
+
+	if r := readers[e.books[j].ID]; r > 0 {
+		score += weightReaders * r
+		reasons = append(reasons, ReasonReaders)
+	}
+
+	return score, reasons
+}
+
+// readers returns the co-occurrence counts for a book scaled to 0..1. They
+// are looked up once per book, as Pair asks for the same book repeatedly.
+func (e *Engine) readers(id string) (map[string]float64, error) {
+	if e.co == nil {
+		return nil, nil
+	}
+
+	if scaled, ok := e.scaled[id]; ok {
+		return scaled, nil
+	}
+
+	counts, err := e.co.Counts(id)
+	if err != nil {
+		return nil, err
+	}
+
+	most := 0
+	for _, c := range counts {
+		if c > most {
+			most = c
+		}
+	}
+
+	scaled := make(map[string]float64, len(counts))
+	for other, c := range counts {
+		scaled[other] = float64(c) / float64(most)
+	}
+	e.scaled[id] = scaled
+
+	return scaled, nil
+}
+
+// Top sorts by descending score and trims the list to limit entries.
+func Top(sims []Similar, limit int) []Similar {
+	sort.SliceStable(sims, func(a, b int) bool {
+		if sims[a].Score == sims[b].Score {
+			return sims[a].SimilarID < sims[b].SimilarID
+		}
+		return sims[a].Score > sims[b].Score
+	})
+
+	if limit > 0 && len(sims) > limit {
+		sims = sims[:limit]
+	}
+
+	return sims
+}
+
+// Terms lower cases and splits text into words, dropping stop words and
+// single characters.
+func Terms(text string) []string {
+	words := strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsNumber(r)
+	})
+
+	terms := make([]string, 0, len(words))
+	for _, w := range words {
+		if len([]rune(w)) < 2 || stopWords[w] {
+			continue
+		}
+		terms = append(terms, w)
+	}
+
+	return terms
+}
+
+// Authors splits a free text author field such as "Terry Pratchett & Neil
+// Gaiman" into its individual names.
+func Authors(author string) []string {
+	author = strings.NewReplacer(" and ", ";", "&", ";", ",", ";").Replace(author)
+
+	names := []string{}
+	for _, name := range strings.Split(author, ";") {
+		if name = strings.TrimSpace(name); name != "" {
+			names = append(names, name)
+		}
+	}
+
+	return names
+}
+
+func authorSet(author string) map[string]bool {
+	set := map[string]bool{}
+	for _, name := range Authors(author) {
+		set[strings.ToLower(strings.Join(strings.Fields(name), " "))] = true
+	}
+	return set
+}
+
+func jaccard(a, b map[string]bool) float64 {
+	if len(a) == 0 || len(b) == 0 {
+		return 0
+	}
+
+	shared := 0
+	for k := range a {
+		if b[k] {
+			shared++
+		}
+	}
+
+	return float64(shared) / float64(len(a)+len(b)-shared)
+}
+
+func cosine(a, b map[string]float64) float64 {
+	if len(b) < len(a) {
+		a, b = b, a
+	}
+
+	dot := 0.0
+	for t, w := range a {
+		dot += w * b[t]
+	}
+
+	return dot
+}
@@ -0,0 +1,117 @@
+package recommend_test
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/axwilliams/book-api/internal/business/book"
+	"github.com/axwilliams/book-api/internal/business/recommend"
+	"github.com/axwilliams/book-api/internal/test"
+)
+
+var catalog = []book.Book{
+	{ID: "f4ac7e14-fc8e-4096-b956-34e5a33040f2", Title: "The Castle", Author: "Franz Kafka", Category: "Fiction"},
+	{ID: "d2b4a1c7-5e33-4b8a-9c1e-6f0d3a2b7c91", Title: "The Trial", Author: "Franz Kafka", Category: "Fiction"},
+	{ID: "71432eb9-58da-4eae-aa20-ccc49064246f", Title: "Fahrenheit 451", Author: "Ray Bradbury", Category: "Fiction",
+		Description: "A fireman burns books in a dystopian future"},
+	{ID: "0c8e4f8a-3d43-4f4e-8a8e-6a1f0f1c9b10", Title: "Nineteen Eighty-Four", Author: "George Orwell", Category: "Fiction",
+		Description: "A dystopian future of surveillance"},
+	{ID: "562e1fe0-0dde-4717-a008-cd2a699301d2", Title: "Six Easy Pieces", Author: "Richard Feynman", Category: "Science"},
+}
+
+type readers map[string]int
+
+func (r readers) Counts(bookID string) (map[string]int, error) {
+	return r, nil
+}
+
+func TestSimilarTo(t *testing.T) {
+	e := recommend.NewEngine(catalog, nil)
+
+	sims, err := e.SimilarTo("f4ac7e14-fc8e-4096-b956-34e5a33040f2", 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(sims) != 2 {
+		t.Fatalf("\t%s\tWrong number of similar books: want %v got %v", test.Failed, 2, len(sims))
+	}
+
+	if sims[0].SimilarID != "d2b4a1c7-5e33-4b8a-9c1e-6f0d3a2b7c91" {
+		t.Fatalf("\t%s\tWrong top match: want The Trial got %v", test.Failed, sims[0].SimilarID)
+	}
+
+	expected := []string{recommend.ReasonAuthor, recommend.ReasonCategory}
+	if ok := reflect.DeepEqual(sims[0].Reasons, expected); !ok {
+		t.Fatalf("\t%s\tWrong reasons: want %v got %v", test.Failed, expected, sims[0].Reasons)
+	}
+	t.Logf("\t%s\tShared author ranked first", test.Success)
+
+	sims, err = e.SimilarTo("71432eb9-58da-4eae-aa20-ccc49064246f", 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if sims[0].SimilarID != "0c8e4f8a-3d43-4f4e-8a8e-6a1f0f1c9b10" {
+		t.Fatalf("\t%s\tWrong top match: want Nineteen Eighty-Four got %v", test.Failed, sims[0].SimilarID)
+	}
+	t.Logf("\t%s\tShared description terms ranked first", test.Success)
+
+	sims, err = e.SimilarTo("562e1fe0-0dde-4717-a008-cd2a699301d2", 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(sims) != 0 {
+		t.Fatalf("\t%s\tUnrelated books returned: %v", test.Failed, sims)
+	}
+	t.Logf("\t%s\tNothing in common returns nothing", test.Success)
+
+	if _, err := e.SimilarTo("7b6807c2-1e11-4e38-bdfd-281186885c3f", 10); err != book.ErrNoBookFound {
+		t.Fatalf("\t%s\tWrong error for unknown book: got %v", test.Failed, err)
+	}
+	t.Logf("\t%s\tUnknown book refused", test.Success)
+}
+
+func TestCoOccurrence(t *testing.T) {
+	e := recommend.NewEngine(catalog, readers{"562e1fe0-0dde-4717-a008-cd2a699301d2": 4})
+
+	sims, err := e.SimilarTo("f4ac7e14-fc8e-4096-b956-34e5a33040f2", 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, sim := range sims {
+		if sim.SimilarID == "562e1fe0-0dde-4717-a008-cd2a699301d2" {
+			if ok := reflect.DeepEqual(sim.Reasons, []string{recommend.ReasonReaders}); !ok {
+				t.Fatalf("\t%s\tWrong reasons: got %v", test.Failed, sim.Reasons)
+			}
+			t.Logf("\t%s\tCo-occurrence scored", test.Success)
+			return
+		}
+	}
+
+	t.Fatalf("\t%s\tBook borrowed by the same readers missing", test.Failed)
+}
+
+func TestAuthors(t *testing.T) {
+	samples := []struct {
+		author   string
+		expected []string
+	}{
+		{"Franz Kafka", []string{"Franz Kafka"}},
+		{"Terry Pratchett & Neil Gaiman", []string{"Terry Pratchett", "Neil Gaiman"}},
+		{"Strunk, White", []string{"Strunk", "White"}},
+		{"Brian Kernighan and Dennis Ritchie", []string{"Brian Kernighan", "Dennis Ritchie"}},
+		{"", []string{}},
+	}
+
+	for _, sample := range samples {
+		res := recommend.Authors(sample.author)
+
+		if ok := reflect.DeepEqual(res, sample.expected); !ok {
+			t.Fatalf("\t%s\tWrong authors for %q: want %v got %v", test.Failed, sample.author, sample.expected, res)
+		}
+		t.Logf("\t%s\tAuthors split", test.Success)
+	}
+}
@@ -0,0 +1,31 @@
+package recommend
+
+import (
+	"log"
+	"time"
+)
+
+// Run refreshes recommendations every interval until stop is closed. The
+// first run and every fullEvery runs after that rebuild all scores so term
+// weights keep up with the catalog; the others are incremental.
+func Run(s Service, interval time.Duration, fullEvery int, stop <-chan struct{}, log *log.Logger) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for run := 0; ; run++ {
+		full := fullEvery > 0 && run%fullEvery == 0
+
+		n, err := s.Refresh(full)
+		if err != nil {
+			log.Printf("[error] Refreshing recommendations: %+v", err)
+		} else if n > 0 {
+			log.Printf("[recommend] Refreshed recommendations for %d books (full: %t)", n, full)
+		}
+
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,46 @@
+package recommend
+
+import (
+	"time"
+
+	"github.com/axwilliams/book-api/internal/business/book"
+)
+
+const (
+	ReasonAuthor   = "same author"
+	ReasonCategory = "same category"
+	ReasonTerms    = "similar title or description"
+	ReasonReaders  = "readers also liked"
+)
+
+type Similar struct {
+	BookID     string    `db:"book_id" json:"book_id"`
+	SimilarID  string    `db:"similar_id" json:"similar_id"`
+	Score      float64   `db:"score" json:"score"`
+	Reasons    []string  `db:"reasons" json:"reasons"`
+	ComputedAt time.Time `db:"computed_at" json:"-"`
+}
+
+type Recommendation struct {
+	Book    book.Book `json:"book"`
+	Score   float64   `json:"score"`
+	Reasons []string  `json:"reasons"`
+}
+
+type PublicRecommendation struct {
+	Book    book.PublicBook `json:"book"`
+	Score   float64         `json:"score"`
+	Reasons []string        `json:"reasons"`
+}
+
+func Public(recs []Recommendation) []PublicRecommendation {
+	prs := make([]PublicRecommendation, 0, len(recs))
+	for _, rec := range recs {
+		prs = append(prs, PublicRecommendation{
+			Book:    rec.Book.Public(),
+			Score:   rec.Score,
+			Reasons: rec.Reasons,
+		})
+	}
+	return prs
+}
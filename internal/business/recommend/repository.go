@@ -0,0 +1,154 @@
+package recommend
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+type Repository interface {
+	Get(bookID string, limit int) ([]Similar, error)
+	GetAll() (map[string][]Similar, error)
+	Save(bookID string, sims []Similar) error
+	Prune(bookIDs []string) error
+	LastComputed() (time.Time, error)
+	Counts(bookID string) (map[string]int, error)
+}
+
+type repository struct {
+	db *sql.DB
+}
+
+func NewRepository(db *sql.DB) Repository {
+	return &repository{
+		db,
+	}
+}
+
+func (r *repository) Get(bookID string, limit int) ([]Similar, error) {
+	rows, err := r.db.Query(`SELECT book_id, similar_id, score, reasons, computed_at FROM book_similar
+		WHERE book_id = $1 ORDER BY score DESC, similar_id LIMIT $2`, bookID, limit)
+	if err != nil {
+		return nil, fmt.Errorf("Retrieving similar books: %w", err)
+	}
+
+	return scanSimilar(rows)
+}
+
+func (r *repository) GetAll() (map[string][]Similar, error) {
+	rows, err := r.db.Query(`SELECT book_id, similar_id, score, reasons, computed_at FROM book_similar
+		ORDER BY book_id, score DESC, similar_id`)
+	if err != nil {
+		return nil, fmt.Errorf("Retrieving similar books: %w", err)
+	}
+
+	sims, err := scanSimilar(rows)
+	if err != nil {
+		return nil, err
+	}
+
+	all := map[string][]Similar{}
+	for _, s := range sims {
+		all[s.BookID] = append(all[s.BookID], s)
+	}
+
+	return all, nil
+}
+
+// Counts implements CoOccurrence: for every other book, the number of users
+// who shelved or rated both it and bookID.
+func (r *repository) Counts(bookID string) (map[string]int, error) {
+	rows, err := r.db.Query(`WITH reader AS (
+			SELECT user_id, book_id FROM book_shelf
+			UNION SELECT user_id, book_id FROM book_rating
+		)
+		SELECT o.book_id, count(*) FROM reader s JOIN reader o ON o.user_id = s.user_id AND o.book_id <> s.book_id
+		WHERE s.book_id = $1 GROUP BY o.book_id`, bookID)
+	if err != nil {
+		return nil, fmt.Errorf("Counting readers: %w", err)
+	}
+	defer rows.Close()
+
+	counts := map[string]int{}
+	for rows.Next() {
+		var id string
+		var n int
+		if err := rows.Scan(&id, &n); err != nil {
+			return nil, fmt.Errorf("Scanning reader counts: %w", err)
+		}
+		counts[id] = n
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("Iterating reader counts: %w", err)
+	}
+
+	return counts, nil
+}
+
+func scanSimilar(rows *sql.Rows) ([]Similar, error) {
+	defer rows.Close()
+
+	sims := []Similar{}
+	for rows.Next() {
+		s := Similar{}
+		var reasons pq.StringArray
+		if err := rows.Scan(&s.BookID, &s.SimilarID, &s.Score, &reasons, &s.ComputedAt); err != nil {
+			return nil, fmt.Errorf("Scanning similar book rows: %w", err)
+		}
+		s.Reasons = reasons
+		sims = append(sims, s)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("Iterating similar book rows: %w", err)
+	}
+
+	return sims, nil
+}
+
+func (r *repository) Save(bookID string, sims []Similar) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec("DELETE FROM book_similar WHERE book_id = $1", bookID); err != nil {
+		return fmt.Errorf("Clearing similar books: %w", err)
+	}
+
+	for _, s := range sims {
+		_, err := tx.Exec(`INSERT INTO book_similar (book_id, similar_id, score, reasons, computed_at)
+			VALUES ($1, $2, $3, $4, $5)`,
+			bookID, s.SimilarID, s.Score, pq.StringArray(s.Reasons), s.ComputedAt)
+		if err != nil {
+			return fmt.Errorf("Saving similar book: %w", err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("Committing similar books: %w", err)
+	}
+
+	return nil
+}
+
+func (r *repository) Prune(bookIDs []string) error {
+	_, err := r.db.Exec(`DELETE FROM book_similar
+		WHERE NOT (book_id::text = ANY($1) AND similar_id::text = ANY($1))`, pq.StringArray(bookIDs))
+	if err != nil {
+		return fmt.Errorf("Pruning similar books: %w", err)
+	}
+
+	return nil
+}
+
+func (r *repository) LastComputed() (time.Time, error) {
+	var last pq.NullTime
+	if err := r.db.QueryRow("SELECT max(computed_at) FROM book_similar").Scan(&last); err != nil {
+		return time.Time{}, fmt.Errorf("Retrieving last recommendation run: %w", err)
+	}
+
+	return last.Time, nil
+}
@@ -0,0 +1,207 @@
+package recommend
+
+import (
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/axwilliams/book-api/internal/business/book"
+	"github.com/axwilliams/book-api/internal/platform/web"
+	"github.com/google/uuid"
+)
+
+const (
+	// stored is how many similar books are kept per book.
+	stored       = 20
+	defaultLimit = 10
+)
+
+type Service interface {
+	Similar(id, status, limitStr string) ([]Recommendation, error)
+	Refresh(full bool) (int, error)
+}
+
+type service struct {
+	rr   Repository
+	br   book.Repository
+	mu   sync.Mutex
+	last time.Time
+}
+
+func NewService(rr Repository, br book.Repository) Service {
+	return &service{
+		rr: rr,
+		br: br,
+	}
+}
+
+// Similar lists the books most like book id. A non empty status hides books
+// in any other status, the book itself included.
+func (s *service) Similar(id, status, limitStr string) ([]Recommendation, error) {
+	if _, err := uuid.Parse(id); err != nil {
+		return nil, web.NewRequestError(book.ErrInvalidID, http.StatusBadRequest)
+	}
+
+	limit, err := strconv.Atoi(limitStr)
+	if err != nil || limit <= 0 || limit > stored {
+		limit = defaultLimit
+	}
+
+	bk, err := s.br.GetById(id)
+	if err == nil && status != "" && bk.Status != status {
+		err = book.ErrNoBookFound
+	}
+	switch {
+	case err == book.ErrNoBookFound:
+		return nil, web.NewRequestError(book.ErrNoBookFound, http.StatusNotFound)
+	case err != nil:
+		return nil, err
+	}
+
+	// Only the precomputed index is served; books the background job has
+	// not scored yet have no recommendations until its next run.
+	sims, err := s.rr.Get(id, stored)
+	if err != nil {
+		return nil, err
+	}
+
+	ids := make([]string, 0, len(sims))
+	for _, sim := range sims {
+		ids = append(ids, sim.SimilarID)
+	}
+
+	bks, err := s.br.GetByIds(ids)
+	if err != nil {
+		return nil, err
+	}
+
+	byID := make(map[string]book.Book, len(bks))
+	for _, bk := range bks {
+		byID[bk.ID] = bk
+	}
+
+	recs := []Recommendation{}
+	for _, sim := range sims {
+		other, ok := byID[sim.SimilarID]
+		if !ok || other.Status != book.StatusPublished {
+			continue
+		}
+
+		recs = append(recs, Recommendation{
+			Book:    other,
+			Score:   sim.Score,
+			Reasons: sim.Reasons,
+		})
+
+		if len(recs) == limit {
+			break
+		}
+	}
+
+	return recs, nil
+}
+
+// Refresh recomputes stored recommendations. An incremental refresh only
+// rescores books published or changed since the previous run against the
+// rest of the catalog; a full refresh rebuilds everything. It returns the
+// number of books whose recommendations were saved.
+func (s *service) Refresh(full bool) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	started := time.Now().UTC()
+
+	bks, err := s.br.GetAll(book.StatusPublished)
+	if err != nil {
+		return 0, err
+	}
+
+	ids := make([]string, 0, len(bks))
+	for _, bk := range bks {
+		ids = append(ids, bk.ID)
+	}
+
+	if err := s.rr.Prune(ids); err != nil {
+		return 0, err
+	}
+
+	if s.last.IsZero() {
+		if s.last, err = s.rr.LastComputed(); err != nil {
+			return 0, err
+		}
+	}
+
+	changed := map[string]bool{}
+	for _, bk := range bks {
+		if full || s.last.IsZero() || bk.UpdatedAt.After(s.last) {
+			changed[bk.ID] = true
+		}
+	}
+
+	if len(changed) == 0 {
+		s.last = started
+		return 0, nil
+	}
+
+	e := NewEngine(bks, s.rr)
+
+	stale := map[string][]Similar{}
+	if len(changed) < len(bks) {
+		if stale, err = s.rr.GetAll(); err != nil {
+			return 0, err
+		}
+	}
+
+	saved := 0
+	for _, bk := range bks {
+		var sims []Similar
+
+		if changed[bk.ID] {
+			if sims, err = e.SimilarTo(bk.ID, stored); err != nil {
+				return saved, err
+			}
+		} else {
+			touched := false
+			for _, sim := range stale[bk.ID] {
+				if changed[sim.SimilarID] {
+					touched = true
+					continue
+				}
+				sims = append(sims, sim)
+			}
+
+			for id := range changed {
+				score, reasons, err := e.Pair(bk.ID, id)
+				if err != nil {
+					return saved, err
+				}
+				if score <= 0 {
+					continue
+				}
+
+				touched = true
+				sims = append(sims, Similar{BookID: bk.ID, SimilarID: id, Score: score, Reasons: reasons})
+			}
+
+			if !touched {
+				continue
+			}
+
+			sims = Top(sims, stored)
+		}
+
+		for i := range sims {
+			sims[i].ComputedAt = started
+		}
+
+		if err := s.rr.Save(bk.ID, sims); err != nil {
+			return saved, err
+		}
+		saved++
+	}
+
+	s.last = started
+
+	return saved, nil
+}
@@ -0,0 +1,25 @@
+package role
+
+import (
+	"log"
+	"time"
+)
+
+// Run reloads the roles every interval until stop is closed, so that roles
+// changed on another instance take effect here too.
+func Run(rg *Registry, interval time.Duration, stop <-chan struct{}, log *log.Logger) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+		}
+
+		if _, err := rg.Load(); err != nil {
+			log.Printf("[error] Loading roles: %+v", err)
+		}
+	}
+}
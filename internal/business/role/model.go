@@ -0,0 +1,74 @@
+package role
+
+import (
+	"sort"
+	"time"
+
+	"github.com/axwilliams/book-api/internal/platform/auth"
+	"github.com/lib/pq"
+)
+
+// Role is a named set of permissions. A role also holds every permission of
+// the roles it inherits, and of the roles those inherit. Built-in roles come
+// with the application and cannot be deleted.
+type Role struct {
+	Name        string         `db:"name" json:"name"`
+	Description string         `db:"description" json:"description"`
+	Permissions pq.StringArray `db:"permissions" json:"permissions"`
+	Inherits    pq.StringArray `db:"inherits" json:"inherits"`
+	BuiltIn     bool           `db:"built_in" json:"built_in"`
+	CreatedAt   time.Time      `db:"created_at" json:"created_at"`
+	UpdatedAt   time.Time      `db:"updated_at" json:"updated_at"`
+
+	// Effective lists the permissions the role grants, inherited ones
+	// included.
+	Effective []string `db:"-" json:"effective_permissions"`
+}
+
+type NewRole struct {
+	Name        string   `json:"name" validate:"required"`
+	Description string   `json:"description"`
+	Permissions []string `json:"permissions"`
+	Inherits    []string `json:"inherits"`
+}
+
+// UpdateRole changes the fields that are given. Permissions and Inherits
+// replace the current lists; an empty list clears them.
+type UpdateRole struct {
+	Description *string  `json:"description"`
+	Permissions []string `json:"permissions"`
+	Inherits    []string `json:"inherits"`
+}
+
+// Permission is one permission a role can grant.
+type Permission struct {
+	Name        string `json:"name"`
+	Description string `json:"description"`
+}
+
+var descriptions = map[string]string{
+	auth.RoleAdmin:   "Administers the library and holds every permission",
+	auth.RoleAuthor:  "Adds and edits books and series",
+	auth.RoleCurator: "Looks after tags",
+}
+
+// Defaults returns the built-in roles with the permissions auth grants them
+// when no roles are loaded.
+func Defaults() []Role {
+	defaults := auth.DefaultRoles()
+
+	rs := make([]Role, 0, len(defaults))
+	for name, perms := range defaults {
+		rs = append(rs, Role{
+			Name:        name,
+			Description: descriptions[name],
+			Permissions: perms,
+			Inherits:    []string{},
+			BuiltIn:     true,
+		})
+	}
+	sort.Slice(rs, func(i, j int) bool {
+		return rs[i].Name < rs[j].Name
+	})
+	return rs
+}
@@ -0,0 +1,124 @@
+package role
+
+import (
+	"sort"
+	"sync"
+)
+
+// Registry resolves roles to permissions from memory, so that checking a
+// permission does not cost a database round trip. Roles are written to
+// Postgres first and other instances pick them up on their next Load.
+type Registry struct {
+	rr Repository
+
+	mu    sync.RWMutex
+	roles map[string]Role
+}
+
+// NewRegistry returns a registry that knows the built-in roles until Load
+// is called.
+func NewRegistry(rr Repository) *Registry {
+	rg := &Registry{rr: rr}
+	rg.set(Defaults())
+	return rg
+}
+
+// Load replaces the roles with those in the database and returns how many
+// there are. On error the current roles stay in use.
+func (rg *Registry) Load() (int, error) {
+	rs, err := rg.rr.GetAll()
+	if err != nil {
+		return 0, err
+	}
+
+	rg.set(rs)
+	return len(rs), nil
+}
+
+func (rg *Registry) set(rs []Role) {
+	roles := make(map[string]Role, len(rs))
+	for _, r := range rs {
+		roles[r.Name] = r
+	}
+
+	rg.mu.Lock()
+	defer rg.mu.Unlock()
+
+	rg.roles = roles
+}
+
+// Exists reports whether a role of that name is defined.
+func (rg *Registry) Exists(name string) bool {
+	rg.mu.RLock()
+	defer rg.mu.RUnlock()
+
+	_, ok := rg.roles[name]
+	return ok
+}
+
+// Permissions returns the sorted permissions roles grant, inherited ones
+// included. Unknown roles grant nothing.
+func (rg *Registry) Permissions(roles []string) []string {
+	rg.mu.RLock()
+	defer rg.mu.RUnlock()
+
+	return resolve(rg.roles, roles)
+}
+
+func resolve(roles map[string]Role, names []string) []string {
+	set := map[string]bool{}
+	seen := map[string]bool{}
+
+	var walk func(name string)
+	walk = func(name string) {
+		if seen[name] {
+			return
+		}
+		seen[name] = true
+
+		r, ok := roles[name]
+		if !ok {
+			return
+		}
+		for _, p := range r.Permissions {
+			set[p] = true
+		}
+		for _, parent := range r.Inherits {
+			walk(parent)
+		}
+	}
+
+	for _, name := range names {
+		walk(name)
+	}
+
+	perms := make([]string, 0, len(set))
+	for p := range set {
+		perms = append(perms, p)
+	}
+	sort.Strings(perms)
+	return perms
+}
+
+// inherits reports whether name inherits from ancestor, directly or through
+// other roles.
+func inherits(roles map[string]Role, name, ancestor string) bool {
+	seen := map[string]bool{}
+
+	var walk func(name string) bool
+	walk = func(name string) bool {
+		if seen[name] {
+			return false
+		}
+		seen[name] = true
+
+		for _, parent := range roles[name].Inherits {
+			if parent == ancestor || walk(parent) {
+				return true
+			}
+		}
+		return false
+	}
+
+	return walk(name)
+}
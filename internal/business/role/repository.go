@@ -0,0 +1,133 @@
+package role
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+)
+
+var ErrNoRoleFound = errors.New("No role found")
+
+type Repository interface {
+	GetAll() ([]Role, error)
+	GetByName(name string) (*Role, error)
+	Create(r *Role) error
+	Update(r *Role) error
+	Delete(name string) error
+	Seed(rs []Role, at time.Time) error
+}
+
+type repository struct {
+	db *sql.DB
+}
+
+func NewRepository(db *sql.DB) Repository {
+	return &repository{
+		db,
+	}
+}
+
+const columns = "name, description, permissions, inherits, built_in, created_at, updated_at"
+
+func scan(row interface{ Scan(...interface{}) error }) (*Role, error) {
+	r := &Role{}
+	err := row.Scan(&r.Name, &r.Description, &r.Permissions, &r.Inherits, &r.BuiltIn, &r.CreatedAt, &r.UpdatedAt)
+	return r, err
+}
+
+func (rr *repository) GetAll() ([]Role, error) {
+	rows, err := rr.db.Query("SELECT " + columns + " FROM role ORDER BY name")
+	if err != nil {
+		return nil, fmt.Errorf("Retrieving roles: %w", err)
+	}
+	defer rows.Close()
+
+	rs := []Role{}
+	for rows.Next() {
+		r, err := scan(rows)
+		if err != nil {
+			return nil, fmt.Errorf("Scanning role rows: %w", err)
+		}
+		rs = append(rs, *r)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("Iterating role rows: %w", err)
+	}
+
+	return rs, nil
+}
+
+func (rr *repository) GetByName(name string) (*Role, error) {
+	r, err := scan(rr.db.QueryRow("SELECT "+columns+" FROM role WHERE name = $1", name))
+
+	switch {
+	case err == sql.ErrNoRows:
+		return nil, ErrNoRoleFound
+	case err != nil:
+		return nil, fmt.Errorf("Retrieving role: %w", err)
+	}
+
+	return r, nil
+}
+
+func (rr *repository) Create(r *Role) error {
+	_, err := rr.db.Exec("INSERT INTO role ("+columns+") VALUES ($1, $2, $3, $4, $5, $6, $7)",
+		r.Name, r.Description, r.Permissions, r.Inherits, r.BuiltIn, r.CreatedAt, r.UpdatedAt)
+	if err != nil {
+		return fmt.Errorf("Creating role: %w", err)
+	}
+
+	return nil
+}
+
+func (rr *repository) Update(r *Role) error {
+	res, err := rr.db.Exec("UPDATE role SET description = $2, permissions = $3, inherits = $4, updated_at = $5 WHERE name = $1",
+		r.Name, r.Description, r.Permissions, r.Inherits, r.UpdatedAt)
+	if err != nil {
+		return fmt.Errorf("Updating role: %w", err)
+	}
+
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrNoRoleFound
+	}
+	return nil
+}
+
+func (rr *repository) Delete(name string) error {
+	res, err := rr.db.Exec("DELETE FROM role WHERE name = $1", name)
+	if err != nil {
+		return fmt.Errorf("Deleting role: %w", err)
+	}
+
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrNoRoleFound
+	}
+	return nil
+}
+
+// Seed adds the built-in roles that are missing. Changes made to AUTHOR and
+// CURATOR are kept, but ADMIN is reset so that it gains the permissions of
+// every new release.
+func (rr *repository) Seed(rs []Role, at time.Time) error {
+	tx, err := rr.db.Begin()
+	if err != nil {
+		return fmt.Errorf("Seeding roles: %w", err)
+	}
+	defer tx.Rollback()
+
+	for _, r := range rs {
+		_, err := tx.Exec(`INSERT INTO role (`+columns+`) VALUES ($1, $2, $3, $4, $5, $6, $6)
+			ON CONFLICT (name) DO UPDATE SET permissions = EXCLUDED.permissions, inherits = EXCLUDED.inherits, built_in = true, updated_at = $6
+			WHERE role.name = 'ADMIN' AND (role.permissions <> EXCLUDED.permissions OR role.inherits <> EXCLUDED.inherits)`,
+			r.Name, r.Description, r.Permissions, r.Inherits, r.BuiltIn, at)
+		if err != nil {
+			return fmt.Errorf("Seeding role %s: %w", r.Name, err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("Seeding roles: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,274 @@
+package role
+
+import (
+	"errors"
+	"net/http"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/axwilliams/book-api/internal/platform/auth"
+	"github.com/axwilliams/book-api/internal/platform/web"
+)
+
+var (
+	ErrInvalidName       = errors.New("Role names must be 2 to 32 capital letters, digits or underscores")
+	ErrRoleExists        = errors.New("A role with that name already exists")
+	ErrUnknownPermission = errors.New("permissions must be known permissions")
+	ErrUnknownRole       = errors.New("inherits must name existing roles")
+	ErrInheritanceCycle  = errors.New("A role cannot inherit from itself, directly or through other roles")
+	ErrAdminRole         = errors.New("ADMIN holds every permission and cannot be changed")
+	ErrBuiltIn           = errors.New("Built-in roles cannot be deleted")
+	ErrInherited         = errors.New("The role is inherited by other roles")
+)
+
+var validName = regexp.MustCompile(`^[A-Z][A-Z0-9_]{1,31}$`)
+
+type Service interface {
+	Permissions() []Permission
+	FindAll() ([]Role, error)
+	FindByName(name string) (*Role, error)
+	Create(nr NewRole) (*Role, error)
+	Update(name string, ur UpdateRole) (*Role, error)
+	Delete(name string) error
+}
+
+type service struct {
+	rr Repository
+	rg *Registry
+}
+
+// NewService returns a service that reloads rg after every change.
+func NewService(rr Repository, rg *Registry) Service {
+	return &service{
+		rr,
+		rg,
+	}
+}
+
+func (s *service) Permissions() []Permission {
+	ps := make([]Permission, 0, len(auth.Permissions))
+	for name, desc := range auth.Permissions {
+		ps = append(ps, Permission{Name: name, Description: desc})
+	}
+	sort.Slice(ps, func(i, j int) bool {
+		return ps[i].Name < ps[j].Name
+	})
+	return ps
+}
+
+// roles returns every role by name.
+func (s *service) roles() (map[string]Role, error) {
+	rs, err := s.rr.GetAll()
+	if err != nil {
+		return nil, err
+	}
+
+	roles := make(map[string]Role, len(rs))
+	for _, r := range rs {
+		roles[r.Name] = r
+	}
+	return roles, nil
+}
+
+func (s *service) FindAll() ([]Role, error) {
+	roles, err := s.roles()
+	if err != nil {
+		return nil, err
+	}
+
+	rs := make([]Role, 0, len(roles))
+	for _, r := range roles {
+		r.Effective = resolve(roles, []string{r.Name})
+		rs = append(rs, r)
+	}
+	sort.Slice(rs, func(i, j int) bool {
+		return rs[i].Name < rs[j].Name
+	})
+	return rs, nil
+}
+
+func (s *service) FindByName(name string) (*Role, error) {
+	roles, err := s.roles()
+	if err != nil {
+		return nil, err
+	}
+
+	r, ok := roles[strings.ToUpper(name)]
+	if !ok {
+		return nil, web.NewRequestError(ErrNoRoleFound, http.StatusNotFound)
+	}
+
+	r.Effective = resolve(roles, []string{r.Name})
+	return &r, nil
+}
+
+func (s *service) Create(nr NewRole) (*Role, error) {
+	name := strings.ToUpper(strings.TrimSpace(nr.Name))
+	if !validName.MatchString(name) {
+		return nil, web.NewRequestError(ErrInvalidName, http.StatusUnprocessableEntity)
+	}
+
+	roles, err := s.roles()
+	if err != nil {
+		return nil, err
+	}
+	if _, ok := roles[name]; ok {
+		return nil, web.NewRequestError(ErrRoleExists, http.StatusConflict)
+	}
+
+	now := time.Now().UTC()
+	r := Role{
+		Name:        name,
+		Description: strings.TrimSpace(nr.Description),
+		CreatedAt:   now,
+		UpdatedAt:   now,
+	}
+
+	if r.Permissions, err = permissions(nr.Permissions); err != nil {
+		return nil, err
+	}
+	if r.Inherits, err = parents(roles, name, nr.Inherits); err != nil {
+		return nil, err
+	}
+
+	if err := s.rr.Create(&r); err != nil {
+		return nil, err
+	}
+
+	roles[name] = r
+	r.Effective = resolve(roles, []string{name})
+
+	return &r, s.reload()
+}
+
+func (s *service) Update(name string, ur UpdateRole) (*Role, error) {
+	name = strings.ToUpper(name)
+
+	roles, err := s.roles()
+	if err != nil {
+		return nil, err
+	}
+
+	r, ok := roles[name]
+	switch {
+	case !ok:
+		return nil, web.NewRequestError(ErrNoRoleFound, http.StatusNotFound)
+	case name == auth.RoleAdmin:
+		return nil, web.NewRequestError(ErrAdminRole, http.StatusConflict)
+	}
+
+	if ur.Description != nil {
+		r.Description = strings.TrimSpace(*ur.Description)
+	}
+	if ur.Permissions != nil {
+		if r.Permissions, err = permissions(ur.Permissions); err != nil {
+			return nil, err
+		}
+	}
+	if ur.Inherits != nil {
+		if r.Inherits, err = parents(roles, name, ur.Inherits); err != nil {
+			return nil, err
+		}
+	}
+	r.UpdatedAt = time.Now().UTC()
+
+	err = s.rr.Update(&r)
+	switch {
+	case err == ErrNoRoleFound:
+		return nil, web.NewRequestError(ErrNoRoleFound, http.StatusNotFound)
+	case err != nil:
+		return nil, err
+	}
+
+	roles[name] = r
+	r.Effective = resolve(roles, []string{name})
+
+	return &r, s.reload()
+}
+
+// Delete removes a role. Users keep the name of a deleted role but it
+// grants them nothing.
+func (s *service) Delete(name string) error {
+	name = strings.ToUpper(name)
+
+	roles, err := s.roles()
+	if err != nil {
+		return err
+	}
+
+	r, ok := roles[name]
+	switch {
+	case !ok:
+		return web.NewRequestError(ErrNoRoleFound, http.StatusNotFound)
+	case r.BuiltIn:
+		return web.NewRequestError(ErrBuiltIn, http.StatusConflict)
+	}
+
+	for _, other := range roles {
+		if contains(other.Inherits, name) {
+			return web.NewRequestError(ErrInherited, http.StatusConflict)
+		}
+	}
+
+	err = s.rr.Delete(name)
+	switch {
+	case err == ErrNoRoleFound:
+		return web.NewRequestError(ErrNoRoleFound, http.StatusNotFound)
+	case err != nil:
+		return err
+	}
+
+	return s.reload()
+}
+
+func (s *service) reload() error {
+	_, err := s.rg.Load()
+	return err
+}
+
+// permissions checks and dedupes perms.
+func permissions(perms []string) ([]string, error) {
+	ps := []string{}
+	for _, p := range perms {
+		p = strings.ToLower(strings.TrimSpace(p))
+		if _, ok := auth.Permissions[p]; !ok {
+			return nil, web.NewRequestError(ErrUnknownPermission, http.StatusUnprocessableEntity)
+		}
+		if !contains(ps, p) {
+			ps = append(ps, p)
+		}
+	}
+	sort.Strings(ps)
+	return ps, nil
+}
+
+// parents checks that name may inherit from names: they must exist and not
+// inherit from name themselves.
+func parents(roles map[string]Role, name string, names []string) ([]string, error) {
+	ps := []string{}
+	for _, p := range names {
+		p = strings.ToUpper(strings.TrimSpace(p))
+		if _, ok := roles[p]; !ok && p != name {
+			return nil, web.NewRequestError(ErrUnknownRole, http.StatusUnprocessableEntity)
+		}
+		if p == name || inherits(roles, p, name) {
+			return nil, web.NewRequestError(ErrInheritanceCycle, http.StatusUnprocessableEntity)
+		}
+		if !contains(ps, p) {
+			ps = append(ps, p)
+		}
+	}
+	sort.Strings(ps)
+	return ps, nil
+}
+
+func contains(ss []string, s string) bool {
+	for _, has := range ss {
+		if has == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,137 @@
+package role_test
+
+import (
+	"net/http"
+	"reflect"
+	"testing"
+
+	"github.com/axwilliams/book-api/internal/business/role"
+	"github.com/axwilliams/book-api/internal/platform/auth"
+	"github.com/axwilliams/book-api/internal/platform/web"
+	"github.com/axwilliams/book-api/internal/test"
+	"github.com/axwilliams/book-api/internal/test/mock"
+)
+
+func status(err error) int {
+	if re, ok := err.(*web.RequestError); ok {
+		return re.Status
+	}
+	if err != nil {
+		return http.StatusInternalServerError
+	}
+	return http.StatusOK
+}
+
+func TestDefaults(t *testing.T) {
+	rg := role.NewRegistry(mock.NewMockRole())
+
+	for name, perms := range auth.DefaultRoles() {
+		if got := rg.Permissions([]string{name}); !reflect.DeepEqual(got, auth.PermissionsFor([]string{name})) || len(got) != len(perms) {
+			t.Fatalf("\t%s\t%s grants %v", test.Failed, name, got)
+		}
+	}
+	if got := rg.Permissions([]string{auth.RoleAdmin}); len(got) != len(auth.Permissions) {
+		t.Fatalf("\t%s\tADMIN lacks permissions: %v", test.Failed, got)
+	}
+	t.Logf("\t%s\tBuilt-in roles grant the default permissions", test.Success)
+
+	if got := rg.Permissions([]string{"UNKNOWN"}); len(got) != 0 {
+		t.Fatalf("\t%s\tUnknown role grants %v", test.Failed, got)
+	}
+	t.Logf("\t%s\tUnknown roles grant nothing", test.Success)
+}
+
+func TestRoles(t *testing.T) {
+	rr := mock.NewMockRole()
+	rg := role.NewRegistry(rr)
+	rs := role.NewService(rr, rg)
+
+	creates := []struct {
+		name       string
+		nr         role.NewRole
+		statusCode int
+	}{
+		{"Invalid name", role.NewRole{Name: "editor!"}, http.StatusUnprocessableEntity},
+		{"Existing role", role.NewRole{Name: "author"}, http.StatusConflict},
+		{"Unknown permission", role.NewRole{Name: "EDITOR", Permissions: []string{"books:burn"}}, http.StatusUnprocessableEntity},
+		{"Unknown parent", role.NewRole{Name: "EDITOR", Inherits: []string{"WRITER"}}, http.StatusUnprocessableEntity},
+		{"Inheriting itself", role.NewRole{Name: "EDITOR", Inherits: []string{"EDITOR"}}, http.StatusUnprocessableEntity},
+		{"Created", role.NewRole{Name: "editor", Permissions: []string{"Books:Review"}, Inherits: []string{"author"}}, http.StatusOK},
+		{"Created child", role.NewRole{Name: "CHIEF_EDITOR", Permissions: []string{auth.PermBooksCurate}, Inherits: []string{"EDITOR"}}, http.StatusOK},
+	}
+
+	for _, sample := range creates {
+		_, err := rs.Create(sample.nr)
+		if got := status(err); got != sample.statusCode {
+			t.Fatalf("\t%s\t%s: want %d got %v", test.Failed, sample.name, sample.statusCode, err)
+		}
+		t.Logf("\t%s\t%s", test.Success, sample.name)
+	}
+
+	// Permissions are inherited through every level, and the registry
+	// picks up new roles at once.
+	want := []string{auth.PermBooksCurate, auth.PermBooksDrafts, auth.PermBooksExport, auth.PermBooksHistory, auth.PermBooksReview, auth.PermBooksWrite, auth.PermLabelsPrint, auth.PermTagsWrite}
+	if got := rg.Permissions([]string{"CHIEF_EDITOR"}); !reflect.DeepEqual(got, want) {
+		t.Fatalf("\t%s\tWrong inherited permissions: %v", test.Failed, got)
+	}
+	if r, err := rs.FindByName("chief_editor"); err != nil || !reflect.DeepEqual(r.Effective, want) {
+		t.Fatalf("\t%s\tWrong effective permissions: %v %v", test.Failed, r, err)
+	}
+	t.Logf("\t%s\tPermissions inherited", test.Success)
+
+	desc := "Edits books"
+	updates := []struct {
+		name       string
+		role       string
+		ur         role.UpdateRole
+		statusCode int
+	}{
+		{"Unknown role", "WRITER", role.UpdateRole{Description: &desc}, http.StatusNotFound},
+		{"ADMIN", auth.RoleAdmin, role.UpdateRole{Permissions: []string{}}, http.StatusConflict},
+		{"Cycle", "EDITOR", role.UpdateRole{Inherits: []string{"CHIEF_EDITOR"}}, http.StatusUnprocessableEntity},
+		{"Built-in role", auth.RoleAuthor, role.UpdateRole{Permissions: []string{auth.PermBooksWrite}}, http.StatusOK},
+		{"Description only", "EDITOR", role.UpdateRole{Description: &desc}, http.StatusOK},
+	}
+
+	for _, sample := range updates {
+		_, err := rs.Update(sample.role, sample.ur)
+		if got := status(err); got != sample.statusCode {
+			t.Fatalf("\t%s\t%s: want %d got %v", test.Failed, sample.name, sample.statusCode, err)
+		}
+		t.Logf("\t%s\t%s", test.Success, sample.name)
+	}
+
+	want = []string{auth.PermBooksCurate, auth.PermBooksReview, auth.PermBooksWrite}
+	if got := rg.Permissions([]string{"CHIEF_EDITOR"}); !reflect.DeepEqual(got, want) {
+		t.Fatalf("\t%s\tChange to a parent not inherited: %v", test.Failed, got)
+	}
+	if r, _ := rs.FindByName("EDITOR"); r.Description != desc || !reflect.DeepEqual([]string(r.Permissions), []string{auth.PermBooksReview}) {
+		t.Fatalf("\t%s\tUpdate changed other fields: %+v", test.Failed, r)
+	}
+	t.Logf("\t%s\tChanges inherited", test.Success)
+
+	deletes := []struct {
+		name       string
+		role       string
+		statusCode int
+	}{
+		{"Built-in role", auth.RoleCurator, http.StatusConflict},
+		{"Inherited role", "EDITOR", http.StatusConflict},
+		{"Unknown role", "WRITER", http.StatusNotFound},
+		{"Deleted", "CHIEF_EDITOR", http.StatusOK},
+		{"Deleted parent", "EDITOR", http.StatusOK},
+	}
+
+	for _, sample := range deletes {
+		err := rs.Delete(sample.role)
+		if got := status(err); got != sample.statusCode {
+			t.Fatalf("\t%s\t%s: want %d got %v", test.Failed, sample.name, sample.statusCode, err)
+		}
+		t.Logf("\t%s\t%s", test.Success, sample.name)
+	}
+
+	if rg.Exists("EDITOR") || len(rg.Permissions([]string{"EDITOR"})) != 0 {
+		t.Fatalf("\t%s\tDeleted role still grants permissions", test.Failed)
+	}
+	t.Logf("\t%s\tDeleted roles grant nothing", test.Success)
+}
@@ -0,0 +1,38 @@
+package series
+
+import (
+	"github.com/axwilliams/book-api/internal/business/book"
+)
+
+type Series struct {
+	ID          string      `db:"id" json:"id"`
+	Name        string      `db:"name" json:"name"`
+	Description string      `db:"description" json:"description"`
+	Books       []book.Book `db:"-" json:"books,omitempty"`
+}
+
+type NewSeries struct {
+	Name        string `json:"name" validate:"required"`
+	Description string `json:"description"`
+}
+
+type UpdateSeries struct {
+	Name        string  `json:"name"`
+	Description *string `json:"description"`
+}
+
+type PublicSeries struct {
+	ID          string            `json:"id"`
+	Name        string            `json:"name"`
+	Description string            `json:"description"`
+	Books       []book.PublicBook `json:"books,omitempty"`
+}
+
+func (sr Series) Public() PublicSeries {
+	return PublicSeries{
+		ID:          sr.ID,
+		Name:        sr.Name,
+		Description: sr.Description,
+		Books:       book.Public(sr.Books),
+	}
+}
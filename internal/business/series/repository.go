@@ -0,0 +1,147 @@
+package series
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/axwilliams/book-api/internal/platform/web"
+)
+
+var (
+	ErrNoAffect      = errors.New("No rows affected")
+	ErrNoSeriesFound = errors.New("No series found")
+)
+
+type Repository interface {
+	GetAll() ([]Series, error)
+	GetById(id string) (*Series, error)
+	GetByName(name string) (*Series, error)
+	Create(sr *Series) error
+	Update(sr *Series) error
+	Destroy(id string) error
+}
+
+type repository struct {
+	db *sql.DB
+}
+
+func NewRepository(db *sql.DB) Repository {
+	return &repository{
+		db,
+	}
+}
+
+func (r *repository) GetAll() ([]Series, error) {
+	rows, err := r.db.Query("SELECT id, name, description FROM series ORDER BY name")
+	if err != nil {
+		return nil, fmt.Errorf("Retrieving series: %w", err)
+	}
+	defer rows.Close()
+
+	srs := []Series{}
+	for rows.Next() {
+		sr := Series{}
+		if err = rows.Scan(&sr.ID, &sr.Name, &sr.Description); err != nil {
+			return nil, fmt.Errorf("Scanning series rows: %w", err)
+		}
+		srs = append(srs, sr)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("Iterating series rows: %w", err)
+	}
+
+	return srs, nil
+}
+
+func (r *repository) GetById(id string) (*Series, error) {
+	sr := &Series{}
+
+	err := r.db.QueryRow("SELECT id, name, description FROM series WHERE id = $1",
+		id).Scan(&sr.ID, &sr.Name, &sr.Description)
+
+	switch {
+	case err == sql.ErrNoRows:
+		return nil, ErrNoSeriesFound
+	case err != nil:
+		return nil, fmt.Errorf("Retrieving series: %w", err)
+	}
+
+	return sr, nil
+}
+
+// GetByName matches the name case-insensitively, so that imports reuse a
+// series that was entered with different capitalization.
+func (r *repository) GetByName(name string) (*Series, error) {
+	sr := &Series{}
+
+	err := r.db.QueryRow("SELECT id, name, description FROM series WHERE lower(name) = lower($1) ORDER BY name LIMIT 1",
+		name).Scan(&sr.ID, &sr.Name, &sr.Description)
+
+	switch {
+	case err == sql.ErrNoRows:
+		return nil, ErrNoSeriesFound
+	case err != nil:
+		return nil, fmt.Errorf("Retrieving series: %w", err)
+	}
+
+	return sr, nil
+}
+
+func (r *repository) Create(sr *Series) error {
+	_, err := r.db.Exec("INSERT INTO series (id, name, description) VALUES ($1, $2, $3)",
+		sr.ID, sr.Name, sr.Description)
+
+	if err != nil {
+		return fmt.Errorf("Creating series: %w", err)
+	}
+
+	return nil
+}
+
+func (r *repository) Update(sr *Series) error {
+	_, err := r.db.Exec("UPDATE series SET name=$1, description=$2 WHERE id=$3;",
+		sr.Name, sr.Description, sr.ID)
+
+	if err != nil {
+		return fmt.Errorf("Updating series: %w", err)
+	}
+
+	return nil
+}
+
+// Destroy takes the books out of the series before deleting it, clearing
+// their positions, which mean nothing without a series.
+func (r *repository) Destroy(id string) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec("UPDATE book SET series_id = NULL, series_position = NULL WHERE series_id = $1;", id)
+	if err != nil {
+		return fmt.Errorf("Removing books from series: %w", err)
+	}
+
+	res, err := tx.Exec("DELETE FROM series WHERE id = $1;", id)
+	if err != nil {
+		return err
+	}
+
+	count, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("Counting affected series: %w", err)
+	}
+
+	if count <= 0 {
+		return web.NewRequestError(ErrNoAffect, http.StatusGone)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("Committing series: %w", err)
+	}
+
+	return nil
+}
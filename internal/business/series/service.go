@@ -0,0 +1,102 @@
+package series
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/axwilliams/book-api/internal/business/book"
+	"github.com/axwilliams/book-api/internal/platform/web"
+	"github.com/google/uuid"
+)
+
+var (
+	ErrInvalidID = errors.New("ID is not in the correct form")
+)
+
+type Service interface {
+	GetAll() ([]Series, error)
+	GetById(id, status string) (*Series, error)
+	Create(ns *NewSeries) (*Series, error)
+	Update(id string, us UpdateSeries) error
+	Destroy(id string) error
+}
+
+type service struct {
+	sr Repository
+	br book.Repository
+}
+
+func NewService(sr Repository, br book.Repository) Service {
+	return &service{
+		sr,
+		br,
+	}
+}
+
+func (s *service) GetAll() ([]Series, error) {
+	return s.sr.GetAll()
+}
+
+// GetById returns the series with its books in reading order, limited to
+// books in the given status when one is set.
+func (s *service) GetById(id, status string) (*Series, error) {
+	if _, err := uuid.Parse(id); err != nil {
+		return nil, web.NewRequestError(ErrInvalidID, http.StatusBadRequest)
+	}
+
+	sr, err := s.sr.GetById(id)
+	if err != nil {
+		return nil, err
+	}
+
+	bks, err := s.br.Search(book.SearchParams{SeriesID: id, Status: status}, "", 0, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	sr.Books = bks
+
+	return sr, nil
+}
+
+func (s *service) Create(ns *NewSeries) (*Series, error) {
+	sr := &Series{
+		ID:          uuid.New().String(),
+		Name:        strings.TrimSpace(ns.Name),
+		Description: strings.TrimSpace(ns.Description),
+	}
+
+	return sr, s.sr.Create(sr)
+}
+
+func (s *service) Update(id string, us UpdateSeries) error {
+	if _, err := uuid.Parse(id); err != nil {
+		return web.NewRequestError(ErrInvalidID, http.StatusBadRequest)
+	}
+
+	sr, err := s.sr.GetById(id)
+	switch {
+	case err == ErrNoSeriesFound:
+		return web.NewRequestError(ErrNoAffect, http.StatusGone)
+	case err != nil:
+		return err
+	}
+
+	if us.Name != "" {
+		sr.Name = strings.TrimSpace(us.Name)
+	}
+	if us.Description != nil {
+		sr.Description = strings.TrimSpace(*us.Description)
+	}
+
+	return s.sr.Update(sr)
+}
+
+func (s *service) Destroy(id string) error {
+	if _, err := uuid.Parse(id); err != nil {
+		return web.NewRequestError(ErrInvalidID, http.StatusBadRequest)
+	}
+
+	return s.sr.Destroy(id)
+}
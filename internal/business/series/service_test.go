@@ -0,0 +1,122 @@
+package series_test
+
+import (
+	"os"
+	"testing"
+
+	"github.com/axwilliams/book-api/internal/business/book"
+	"github.com/axwilliams/book-api/internal/business/series"
+	"github.com/axwilliams/book-api/internal/platform/policy"
+	"github.com/axwilliams/book-api/internal/test"
+)
+
+var (
+	bookService   book.Service
+	seriesService series.Service
+)
+
+func TestMain(m *testing.M) {
+	db, container := test.Setup()
+
+	bookRepository := book.NewRepository(db)
+	bookService = book.NewService(bookRepository, policy.NewEngine(""))
+	seriesService = series.NewService(series.NewRepository(db), bookRepository)
+
+	e := m.Run()
+
+	test.Teardown(db, container)
+	os.Exit(e)
+}
+
+func TestReadingOrder(t *testing.T) {
+	sr, err := seriesService.Create(&series.NewSeries{Name: "Discworld", Description: "Comic fantasy"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	positions := []struct {
+		title    string
+		position float64
+	}{
+		{"Mort", 4},
+		{"The Colour of Magic", 1},
+		{"The Light Fantastic", 2},
+		{"Equal Rites", 2.5},
+	}
+
+	ids := map[string]string{}
+	for _, p := range positions {
+		position := p.position
+
+		bk, err := bookService.Create(&book.NewBook{
+			ISBN:           "978-0552166591",
+			Title:          p.title,
+			Author:         "Terry Pratchett",
+			SeriesID:       sr.ID,
+			SeriesPosition: &position,
+		}, policy.Subject{})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		for _, action := range []string{book.ActionSubmit, book.ActionApprove} {
+			if err := bookService.Transition(bk.ID, action, policy.Subject{}, ""); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		ids[p.title] = bk.ID
+	}
+
+	res, err := seriesService.GetById(sr.ID, book.StatusPublished)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []string{"The Colour of Magic", "The Light Fantastic", "Equal Rites", "Mort"}
+	for i, bk := range res.Books {
+		if bk.Title != expected[i] {
+			t.Fatalf("\t%s\tWrong reading order at %d: want %v got %v", test.Failed, i, expected[i], bk.Title)
+		}
+	}
+	t.Logf("\t%s\tBooks in reading order", test.Success)
+
+	bk, err := bookService.GetById(ids["The Light Fantastic"])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if bk.NextInSeries != ids["Equal Rites"] {
+		t.Fatalf("\t%s\tWrong next in series: want %v got %v", test.Failed, ids["Equal Rites"], bk.NextInSeries)
+	}
+	t.Logf("\t%s\tNext in series linked", test.Success)
+
+	bk, err = bookService.GetById(ids["Mort"])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if bk.NextInSeries != "" {
+		t.Fatalf("\t%s\tLast book has a next in series: %v", test.Failed, bk.NextInSeries)
+	}
+	t.Logf("\t%s\tLast book has no next in series", test.Success)
+
+	if err := seriesService.Destroy(sr.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	bk, err = bookService.GetById(ids["Mort"])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if bk.SeriesID != "" || bk.SeriesPosition != nil {
+		t.Fatalf("\t%s\tBook still in the deleted series: %v %v", test.Failed, bk.SeriesID, bk.SeriesPosition)
+	}
+
+	d := "Death takes an apprentice"
+	if err := bookService.Update(bk.ID, book.UpdateBook{Description: &d}, policy.Subject{}); err != nil {
+		t.Fatalf("\t%s\tBook of a deleted series cannot be edited: %v", test.Failed, err)
+	}
+	t.Logf("\t%s\tDeleting the series clears the positions", test.Success)
+}
@@ -0,0 +1,32 @@
+package session
+
+import (
+	"log"
+	"time"
+)
+
+// Run syncs rl with the database and drops expired revocations every
+// interval until stop is closed.
+func Run(rl *RevocationList, interval time.Duration, stop <-chan struct{}, log *log.Logger) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+		}
+
+		if _, err := rl.Sync(); err != nil {
+			log.Printf("[error] Syncing revoked tokens: %+v", err)
+		}
+
+		n, err := rl.Cleanup()
+		if err != nil {
+			log.Printf("[error] Cleaning up revoked tokens: %+v", err)
+		} else if n > 0 {
+			log.Printf("[session] Removed %d expired revoked tokens", n)
+		}
+	}
+}
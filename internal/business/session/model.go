@@ -0,0 +1,73 @@
+package session
+
+import (
+	"time"
+)
+
+// RefreshToken is one link in a chain of refresh tokens. Every login starts
+// a family; each refresh uses up the current token and adds the next one to
+// the same family. Only a hash of the token is stored.
+type RefreshToken struct {
+	ID              string
+	FamilyID        string
+	UserID          string
+	Hash            []byte
+	Device          string
+	TTL             time.Duration
+	CreatedAt       time.Time
+	ExpiresAt       time.Time
+	FamilyExpiresAt time.Time
+	UsedAt          *time.Time
+	RevokedAt       *time.Time
+}
+
+// Session is one login of a user: a family of refresh tokens seen from the
+// current token. ID is the family ID, which access tokens carry as sid.
+type Session struct {
+	ID         string    `json:"id"`
+	Device     string    `json:"device"`
+	CreatedAt  time.Time `json:"created_at"`
+	LastUsedAt time.Time `json:"last_used_at"`
+	ExpiresAt  time.Time `json:"expires_at"`
+	Current    bool      `json:"current"`
+}
+
+// Revocation keeps an access token or a whole login from being accepted
+// until ExpiresAt, when every token it could cover has expired anyway.
+type Revocation struct {
+	ID        string
+	ExpiresAt time.Time
+}
+
+// Tokens is what a login or a refresh hands back to the client.
+type Tokens struct {
+	Token            string    `json:"token"`
+	RefreshToken     string    `json:"refresh_token"`
+	RefreshExpiresAt time.Time `json:"refresh_expires_at"`
+}
+
+type RefreshRequest struct {
+	RefreshToken string `json:"refresh_token" validate:"required"`
+}
+
+// NewSession names the device a login is made from. TTL may shorten the
+// idle lifetime of its refresh tokens, e.g. for a shared computer.
+type NewSession struct {
+	Device string
+	TTL    time.Duration
+}
+
+// Policy bounds the lifetime of refresh tokens. A token expires when it has
+// not been used for TTL, and a family when MaxAge has passed since the
+// login, however often it was refreshed.
+type Policy struct {
+	TTL    time.Duration
+	MaxAge time.Duration
+}
+
+// DefaultPolicy keeps an idle device signed in for 30 days and asks for the
+// password again after 90.
+var DefaultPolicy = Policy{
+	TTL:    30 * 24 * time.Hour,
+	MaxAge: 90 * 24 * time.Hour,
+}
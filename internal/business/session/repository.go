@@ -0,0 +1,205 @@
+package session
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+)
+
+var (
+	ErrNoTokenFound   = errors.New("No refresh token found")
+	ErrNoSessionFound = errors.New("No session found")
+)
+
+type Repository interface {
+	Create(rt *RefreshToken) error
+	GetByHash(hash []byte) (*RefreshToken, error)
+	MarkUsed(id string, at time.Time) (bool, error)
+	RevokeFamily(familyID string, at time.Time) error
+	FindByUser(userID string, now time.Time) ([]Session, error)
+	RevokeSession(userID, familyID string, at time.Time) error
+	RevokeUser(userID string, at time.Time) ([]string, error)
+	Revoke(rv Revocation) error
+	Revocations(now time.Time) ([]Revocation, error)
+	DeleteRevocations(before time.Time) (int64, error)
+}
+
+type repository struct {
+	db *sql.DB
+}
+
+func NewRepository(db *sql.DB) Repository {
+	return &repository{
+		db,
+	}
+}
+
+func (r *repository) Create(rt *RefreshToken) error {
+	_, err := r.db.Exec(`INSERT INTO refresh_token (id, family_id, user_id, token_hash, device, ttl_seconds, created_at, expires_at, family_expires_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)`,
+		rt.ID, rt.FamilyID, rt.UserID, rt.Hash, rt.Device, int64(rt.TTL/time.Second), rt.CreatedAt, rt.ExpiresAt, rt.FamilyExpiresAt)
+	if err != nil {
+		return fmt.Errorf("Creating refresh token: %w", err)
+	}
+
+	return nil
+}
+
+func (r *repository) GetByHash(hash []byte) (*RefreshToken, error) {
+	rt := &RefreshToken{}
+	var ttl int64
+
+	err := r.db.QueryRow(`SELECT id, family_id, user_id, token_hash, device, ttl_seconds, created_at, expires_at, family_expires_at, used_at, revoked_at
+		FROM refresh_token WHERE token_hash = $1`, hash).
+		Scan(&rt.ID, &rt.FamilyID, &rt.UserID, &rt.Hash, &rt.Device, &ttl, &rt.CreatedAt, &rt.ExpiresAt, &rt.FamilyExpiresAt, &rt.UsedAt, &rt.RevokedAt)
+
+	switch {
+	case err == sql.ErrNoRows:
+		return nil, ErrNoTokenFound
+	case err != nil:
+		return nil, fmt.Errorf("Retrieving refresh token: %w", err)
+	}
+
+	rt.TTL = time.Duration(ttl) * time.Second
+
+	return rt, nil
+}
+
+// MarkUsed uses a token up. It reports false when the token had already been
+// used, so that of two concurrent refreshes with the same token only one
+// wins.
+func (r *repository) MarkUsed(id string, at time.Time) (bool, error) {
+	res, err := r.db.Exec("UPDATE refresh_token SET used_at = $1 WHERE id = $2 AND used_at IS NULL", at, id)
+	if err != nil {
+		return false, fmt.Errorf("Using refresh token: %w", err)
+	}
+
+	count, err := res.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("Counting used refresh tokens: %w", err)
+	}
+
+	return count == 1, nil
+}
+
+func (r *repository) RevokeFamily(familyID string, at time.Time) error {
+	_, err := r.db.Exec("UPDATE refresh_token SET revoked_at = $1 WHERE family_id = $2 AND revoked_at IS NULL", at, familyID)
+	if err != nil {
+		return fmt.Errorf("Revoking refresh tokens: %w", err)
+	}
+
+	return nil
+}
+
+// FindByUser lists the logins of a user that can still be refreshed, most
+// recently used first.
+func (r *repository) FindByUser(userID string, now time.Time) ([]Session, error) {
+	rows, err := r.db.Query(`SELECT t.family_id, t.device, f.created_at, t.created_at, t.expires_at
+		FROM refresh_token t
+		JOIN (SELECT family_id, MIN(created_at) AS created_at FROM refresh_token GROUP BY family_id) f ON f.family_id = t.family_id
+		WHERE t.user_id = $1 AND t.used_at IS NULL AND t.revoked_at IS NULL AND t.expires_at > $2
+		ORDER BY t.created_at DESC`, userID, now)
+	if err != nil {
+		return nil, fmt.Errorf("Retrieving sessions: %w", err)
+	}
+	defer rows.Close()
+
+	ss := []Session{}
+	for rows.Next() {
+		s := Session{}
+		if err := rows.Scan(&s.ID, &s.Device, &s.CreatedAt, &s.LastUsedAt, &s.ExpiresAt); err != nil {
+			return nil, fmt.Errorf("Scanning session: %w", err)
+		}
+		ss = append(ss, s)
+	}
+
+	return ss, rows.Err()
+}
+
+// RevokeSession revokes one login of a user. It returns ErrNoSessionFound
+// when the family does not belong to the user or was already revoked.
+func (r *repository) RevokeSession(userID, familyID string, at time.Time) error {
+	res, err := r.db.Exec("UPDATE refresh_token SET revoked_at = $1 WHERE family_id = $2 AND user_id = $3 AND revoked_at IS NULL", at, familyID, userID)
+	if err != nil {
+		return fmt.Errorf("Revoking session: %w", err)
+	}
+
+	count, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("Counting revoked refresh tokens: %w", err)
+	}
+	if count == 0 {
+		return ErrNoSessionFound
+	}
+
+	return nil
+}
+
+// RevokeUser revokes every login of a user and returns the IDs of the
+// families it revoked.
+func (r *repository) RevokeUser(userID string, at time.Time) ([]string, error) {
+	rows, err := r.db.Query("UPDATE refresh_token SET revoked_at = $1 WHERE user_id = $2 AND revoked_at IS NULL RETURNING family_id", at, userID)
+	if err != nil {
+		return nil, fmt.Errorf("Revoking sessions: %w", err)
+	}
+	defer rows.Close()
+
+	seen := map[string]bool{}
+	ids := []string{}
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return nil, fmt.Errorf("Scanning revoked session: %w", err)
+		}
+		if !seen[id] {
+			seen[id] = true
+			ids = append(ids, id)
+		}
+	}
+
+	return ids, rows.Err()
+}
+
+func (r *repository) Revoke(rv Revocation) error {
+	_, err := r.db.Exec(`INSERT INTO revoked_token (id, expires_at) VALUES ($1, $2)
+		ON CONFLICT (id) DO UPDATE SET expires_at = GREATEST(revoked_token.expires_at, EXCLUDED.expires_at)`, rv.ID, rv.ExpiresAt)
+	if err != nil {
+		return fmt.Errorf("Revoking token: %w", err)
+	}
+
+	return nil
+}
+
+func (r *repository) Revocations(now time.Time) ([]Revocation, error) {
+	rows, err := r.db.Query("SELECT id, expires_at FROM revoked_token WHERE expires_at > $1", now)
+	if err != nil {
+		return nil, fmt.Errorf("Retrieving revoked tokens: %w", err)
+	}
+	defer rows.Close()
+
+	rvs := []Revocation{}
+	for rows.Next() {
+		rv := Revocation{}
+		if err := rows.Scan(&rv.ID, &rv.ExpiresAt); err != nil {
+			return nil, fmt.Errorf("Scanning revoked token: %w", err)
+		}
+		rvs = append(rvs, rv)
+	}
+
+	return rvs, rows.Err()
+}
+
+func (r *repository) DeleteRevocations(before time.Time) (int64, error) {
+	res, err := r.db.Exec("DELETE FROM revoked_token WHERE expires_at <= $1", before)
+	if err != nil {
+		return 0, fmt.Errorf("Deleting expired revoked tokens: %w", err)
+	}
+
+	count, err := res.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("Counting expired revoked tokens: %w", err)
+	}
+
+	return count, nil
+}
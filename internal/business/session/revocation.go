@@ -0,0 +1,93 @@
+package session
+
+import (
+	"sync"
+	"time"
+
+	"github.com/axwilliams/book-api/internal/platform/auth"
+)
+
+// RevocationList answers whether an access token was revoked without a
+// database round trip on every request. Revocations are written to Postgres
+// first, so other instances pick them up on their next Sync.
+type RevocationList struct {
+	sr Repository
+
+	mu  sync.RWMutex
+	ids map[string]time.Time
+}
+
+func NewRevocationList(sr Repository) *RevocationList {
+	return &RevocationList{
+		sr:  sr,
+		ids: map[string]time.Time{},
+	}
+}
+
+// Revoke stores a revoked token or session ID until expiresAt, plus the
+// leeway tokens are accepted for after they expire.
+func (rl *RevocationList) Revoke(id string, expiresAt time.Time) error {
+	expiresAt = expiresAt.Add(auth.Leeway()).UTC()
+	if err := rl.sr.Revoke(Revocation{ID: id, ExpiresAt: expiresAt}); err != nil {
+		return err
+	}
+
+	rl.add(id, expiresAt)
+	return nil
+}
+
+func (rl *RevocationList) add(id string, expiresAt time.Time) {
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+
+	if expiresAt.After(rl.ids[id]) {
+		rl.ids[id] = expiresAt
+	}
+}
+
+// IsRevoked reports whether any of ids was revoked. Empty IDs, e.g. the
+// session of a token issued without a refresh token, are never revoked.
+func (rl *RevocationList) IsRevoked(ids ...string) bool {
+	rl.mu.RLock()
+	defer rl.mu.RUnlock()
+
+	now := time.Now()
+	for _, id := range ids {
+		if id == "" {
+			continue
+		}
+		if exp, ok := rl.ids[id]; ok && now.Before(exp) {
+			return true
+		}
+	}
+	return false
+}
+
+// Sync adds the revocations other instances have stored. It only ever adds,
+// so a revocation made while the query runs is not lost.
+func (rl *RevocationList) Sync() (int, error) {
+	rvs, err := rl.sr.Revocations(time.Now().UTC())
+	if err != nil {
+		return 0, err
+	}
+
+	for _, rv := range rvs {
+		rl.add(rv.ID, rv.ExpiresAt)
+	}
+	return len(rvs), nil
+}
+
+// Cleanup forgets expired revocations, in memory and in the database.
+func (rl *RevocationList) Cleanup() (int64, error) {
+	now := time.Now()
+
+	rl.mu.Lock()
+	for id, exp := range rl.ids {
+		if !now.Before(exp) {
+			delete(rl.ids, id)
+		}
+	}
+	rl.mu.Unlock()
+
+	return rl.sr.DeleteRevocations(now.UTC())
+}
@@ -0,0 +1,266 @@
+package session
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/axwilliams/book-api/internal/business/user"
+	"github.com/axwilliams/book-api/internal/platform/auth"
+	"github.com/axwilliams/book-api/internal/platform/web"
+	"github.com/google/uuid"
+)
+
+// maxDevice caps the length of a device name.
+const maxDevice = 255
+
+var (
+	ErrInvalidRefresh = errors.New("Refresh token is invalid or has expired")
+	ErrRefreshReused  = errors.New("Refresh token was already used; the login has been revoked")
+	ErrInvalidTTL     = errors.New("ttl must be a positive duration")
+	ErrInvalidID      = errors.New("ID is not in the correct form")
+)
+
+type Service interface {
+	Issue(claims auth.Claims, ns NewSession) (*Tokens, error)
+	Refresh(raw string) (*Tokens, error)
+	Logout(claims auth.Claims) error
+	List(userID, currentID string) ([]Session, error)
+	Revoke(userID, id string) error
+	RevokeAll(userID string) error
+}
+
+type service struct {
+	sr Repository
+	ur user.Repository
+	rl *RevocationList
+	p  Policy
+}
+
+func NewService(sr Repository, ur user.Repository, rl *RevocationList, p Policy) Service {
+	return &service{
+		sr,
+		ur,
+		rl,
+		p,
+	}
+}
+
+// Issue starts a new token family for a user who has just authenticated.
+func (s *service) Issue(claims auth.Claims, ns NewSession) (*Tokens, error) {
+	ttl := s.p.TTL
+	switch {
+	case ns.TTL < 0:
+		return nil, web.NewRequestError(ErrInvalidTTL, http.StatusBadRequest)
+	case ns.TTL > 0 && ns.TTL < ttl:
+		ttl = ns.TTL
+	}
+
+	device := strings.TrimSpace(ns.Device)
+	if r := []rune(device); len(r) > maxDevice {
+		device = string(r[:maxDevice])
+	}
+
+	now := time.Now().UTC()
+	rt := &RefreshToken{
+		FamilyID:        uuid.New().String(),
+		UserID:          claims.UserID,
+		Device:          device,
+		TTL:             ttl,
+		FamilyExpiresAt: now.Add(s.p.MaxAge),
+	}
+
+	return s.issue(claims, rt, now)
+}
+
+// issue stores the next token of rt's family and signs an access token to
+// go with it.
+func (s *service) issue(claims auth.Claims, rt *RefreshToken, now time.Time) (*Tokens, error) {
+	raw, hash, err := newRefreshToken()
+	if err != nil {
+		return nil, err
+	}
+
+	rt.ID = uuid.New().String()
+	rt.Hash = hash
+	rt.CreatedAt = now
+	rt.ExpiresAt = now.Add(rt.TTL)
+	if rt.ExpiresAt.After(rt.FamilyExpiresAt) {
+		rt.ExpiresAt = rt.FamilyExpiresAt
+	}
+	rt.UsedAt = nil
+	rt.RevokedAt = nil
+	claims.SessionID = rt.FamilyID
+
+	if err := s.sr.Create(rt); err != nil {
+		return nil, err
+	}
+
+	token, err := auth.CreateToken(claims)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Tokens{
+		Token:            token,
+		RefreshToken:     raw,
+		RefreshExpiresAt: rt.ExpiresAt,
+	}, nil
+}
+
+// Refresh trades a refresh token for a new access token and the next
+// refresh token. A token that was already traded in means it has leaked, so
+// its whole family is revoked and the user has to log in again.
+func (s *service) Refresh(raw string) (*Tokens, error) {
+	rt, err := s.sr.GetByHash(hashToken(raw))
+	switch {
+	case err == ErrNoTokenFound:
+		return nil, web.NewRequestError(ErrInvalidRefresh, http.StatusUnauthorized)
+	case err != nil:
+		return nil, err
+	}
+
+	now := time.Now().UTC()
+
+	if rt.RevokedAt != nil || !now.Before(rt.ExpiresAt) {
+		return nil, web.NewRequestError(ErrInvalidRefresh, http.StatusUnauthorized)
+	}
+
+	if rt.UsedAt != nil {
+		return nil, s.reused(rt, now)
+	}
+
+	ok, err := s.sr.MarkUsed(rt.ID, now)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, s.reused(rt, now)
+	}
+
+	// Roles are read again so that a refresh picks up changes made since
+	// the login.
+	u, err := s.ur.GetById(rt.UserID)
+	switch {
+	case err == user.ErrNoUserFound:
+		return nil, web.NewRequestError(ErrInvalidRefresh, http.StatusUnauthorized)
+	case err != nil:
+		return nil, err
+	}
+
+	return s.issue(auth.NewClaims(u.ID, u.Roles), rt, now)
+}
+
+// Logout ends the login the access token in claims belongs to. The token
+// itself is revoked as well, which covers tokens issued without a session.
+func (s *service) Logout(claims auth.Claims) error {
+	now := time.Now().UTC()
+
+	if claims.Id != "" {
+		if err := s.rl.Revoke(claims.Id, time.Unix(claims.ExpiresAt, 0)); err != nil {
+			return err
+		}
+	}
+
+	if claims.SessionID == "" {
+		return nil
+	}
+
+	if err := s.sr.RevokeSession(claims.UserID, claims.SessionID, now); err != nil && err != ErrNoSessionFound {
+		return err
+	}
+
+	return s.rl.Revoke(claims.SessionID, now.Add(auth.TokenLifetime))
+}
+
+// List returns the logins of a user that can still be refreshed and marks
+// the one with ID currentID as current.
+func (s *service) List(userID, currentID string) ([]Session, error) {
+	ss, err := s.sr.FindByUser(userID, time.Now().UTC())
+	if err != nil {
+		return nil, err
+	}
+
+	for i := range ss {
+		ss[i].Current = ss[i].ID == currentID
+	}
+	return ss, nil
+}
+
+// Revoke ends one login of a user. Access tokens issued to it are refused
+// from now on rather than when they expire.
+func (s *service) Revoke(userID, id string) error {
+	if _, err := uuid.Parse(id); err != nil {
+		return web.NewRequestError(ErrInvalidID, http.StatusBadRequest)
+	}
+
+	now := time.Now().UTC()
+
+	err := s.sr.RevokeSession(userID, id, now)
+	switch {
+	case err == ErrNoSessionFound:
+		return web.NewRequestError(ErrNoSessionFound, http.StatusNotFound)
+	case err != nil:
+		return err
+	}
+
+	return s.rl.Revoke(id, now.Add(auth.TokenLifetime))
+}
+
+// RevokeAll ends every login of a user, e.g. after their password or roles
+// changed.
+func (s *service) RevokeAll(userID string) error {
+	now := time.Now().UTC()
+
+	ids, err := s.sr.RevokeUser(userID, now)
+	if err != nil {
+		return err
+	}
+
+	for _, id := range ids {
+		if err := s.rl.Revoke(id, now.Add(auth.TokenLifetime)); err != nil {
+			return err
+		}
+	}
+
+	if len(ids) > 0 {
+		log.Printf("[session] Revoked %d sessions of user %s", len(ids), userID)
+	}
+	return nil
+}
+
+func (s *service) reused(rt *RefreshToken, now time.Time) error {
+	if err := s.sr.RevokeFamily(rt.FamilyID, now); err != nil {
+		return err
+	}
+	if err := s.rl.Revoke(rt.FamilyID, now.Add(auth.TokenLifetime)); err != nil {
+		return err
+	}
+	log.Printf("[session] Refresh token reused, revoked family %s of user %s", rt.FamilyID, rt.UserID)
+
+	return web.NewRequestError(ErrRefreshReused, http.StatusUnauthorized)
+}
+
+// newRefreshToken returns a random token and the hash it is stored under.
+func newRefreshToken() (string, []byte, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", nil, fmt.Errorf("Generating refresh token: %w", err)
+	}
+
+	raw := base64.RawURLEncoding.EncodeToString(b)
+	return raw, hashToken(raw), nil
+}
+
+// hashToken needs no salt: tokens are random and long enough that a lookup
+// table is out of reach, and an unsalted hash can be looked up directly.
+func hashToken(raw string) []byte {
+	h := sha256.Sum256([]byte(raw))
+	return h[:]
+}
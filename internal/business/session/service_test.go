@@ -0,0 +1,237 @@
+package session_test
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/axwilliams/book-api/internal/business/session"
+	"github.com/axwilliams/book-api/internal/platform/auth"
+	"github.com/axwilliams/book-api/internal/platform/web"
+	"github.com/axwilliams/book-api/internal/test"
+	"github.com/axwilliams/book-api/internal/test/mock"
+)
+
+const authorID = "69a47775-6d89-4d38-ad38-acdb2928f6a1"
+
+func newService(p session.Policy) session.Service {
+	ms := mock.NewMockSession()
+	return session.NewService(ms, mock.NewMockUser(), session.NewRevocationList(ms), p)
+}
+
+func login(t *testing.T, ss session.Service, ns session.NewSession) *session.Tokens {
+	tk, err := ss.Issue(auth.NewClaims(authorID, []string{auth.RoleAuthor}), ns)
+	if err != nil {
+		t.Fatalf("\t%s\tIssuing tokens failed: %v", test.Failed, err)
+	}
+	return tk
+}
+
+func unauthorized(err error, expected error) bool {
+	re, ok := err.(*web.RequestError)
+	return ok && re.Status == http.StatusUnauthorized && re.Err == expected
+}
+
+func TestRotation(t *testing.T) {
+	ss := newService(session.DefaultPolicy)
+
+	first := login(t, ss, session.NewSession{Device: "Kobo Libra"})
+	if first.Token == "" || len(first.RefreshToken) < 40 {
+		t.Fatalf("\t%s\tWrong tokens: %+v", test.Failed, first)
+	}
+
+	second, err := ss.Refresh(first.RefreshToken)
+	if err != nil {
+		t.Fatalf("\t%s\tRefreshing failed: %v", test.Failed, err)
+	}
+	if second.RefreshToken == first.RefreshToken {
+		t.Fatalf("\t%s\tRefresh token was not rotated", test.Failed)
+	}
+
+	claims, err := auth.ParseWithClaims(second.Token)
+	if err != nil || claims.UserID != authorID || !auth.HasRole(claims.Roles, auth.RoleAuthor) {
+		t.Fatalf("\t%s\tWrong access token: %v %+v", test.Failed, err, claims)
+	}
+	t.Logf("\t%s\tRefresh token rotated", test.Success)
+
+	third, err := ss.Refresh(second.RefreshToken)
+	if err != nil {
+		t.Fatalf("\t%s\tRefreshing the rotated token failed: %v", test.Failed, err)
+	}
+
+	// Replaying the first token revokes the family, including the token
+	// the legitimate client holds now.
+	if _, err := ss.Refresh(first.RefreshToken); !unauthorized(err, session.ErrRefreshReused) {
+		t.Fatalf("\t%s\tReuse was not detected: %v", test.Failed, err)
+	}
+	if _, err := ss.Refresh(third.RefreshToken); !unauthorized(err, session.ErrInvalidRefresh) {
+		t.Fatalf("\t%s\tFamily was not revoked: %v", test.Failed, err)
+	}
+	t.Logf("\t%s\tReuse revoked the family", test.Success)
+
+	other := login(t, ss, session.NewSession{Device: "Phone"})
+	if _, err := ss.Refresh(other.RefreshToken); err != nil {
+		t.Fatalf("\t%s\tOther logins should be untouched: %v", test.Failed, err)
+	}
+	t.Logf("\t%s\tOther logins untouched", test.Success)
+
+	if _, err := ss.Refresh("not-a-token"); !unauthorized(err, session.ErrInvalidRefresh) {
+		t.Fatalf("\t%s\tUnknown token accepted: %v", test.Failed, err)
+	}
+	t.Logf("\t%s\tUnknown token rejected", test.Success)
+}
+
+func TestExpiry(t *testing.T) {
+	ss := newService(session.Policy{TTL: time.Hour, MaxAge: 20 * time.Millisecond})
+
+	tk := login(t, ss, session.NewSession{})
+	if time.Until(tk.RefreshExpiresAt) > 20*time.Millisecond {
+		t.Fatalf("\t%s\tToken outlives its family: %v", test.Failed, tk.RefreshExpiresAt)
+	}
+
+	time.Sleep(30 * time.Millisecond)
+	if _, err := ss.Refresh(tk.RefreshToken); !unauthorized(err, session.ErrInvalidRefresh) {
+		t.Fatalf("\t%s\tExpired family accepted: %v", test.Failed, err)
+	}
+	t.Logf("\t%s\tFamily expires after its maximum age", test.Success)
+
+	ss = newService(session.DefaultPolicy)
+
+	tk = login(t, ss, session.NewSession{Device: "Library kiosk", TTL: 10 * time.Millisecond})
+	time.Sleep(20 * time.Millisecond)
+	if _, err := ss.Refresh(tk.RefreshToken); !unauthorized(err, session.ErrInvalidRefresh) {
+		t.Fatalf("\t%s\tIdle token accepted: %v", test.Failed, err)
+	}
+	t.Logf("\t%s\tDevice lifetime shortens the idle expiry", test.Success)
+
+	tk = login(t, ss, session.NewSession{TTL: 365 * 24 * time.Hour})
+	if time.Until(tk.RefreshExpiresAt) > session.DefaultPolicy.TTL {
+		t.Fatalf("\t%s\tDevice lifetime may not exceed the policy: %v", test.Failed, tk.RefreshExpiresAt)
+	}
+	t.Logf("\t%s\tDevice lifetime capped by the policy", test.Success)
+}
+
+func TestSessions(t *testing.T) {
+	ms := mock.NewMockSession()
+	rl := session.NewRevocationList(ms)
+	ss := session.NewService(ms, mock.NewMockUser(), rl, session.DefaultPolicy)
+
+	sessionOf := func(tk *session.Tokens) auth.Claims {
+		claims, err := auth.ParseWithClaims(tk.Token)
+		if err != nil || claims.Id == "" || claims.SessionID == "" {
+			t.Fatalf("\t%s\tAccess token lacks jti or sid: %v %+v", test.Failed, err, claims)
+		}
+		return claims
+	}
+
+	laptop := sessionOf(login(t, ss, session.NewSession{Device: "Laptop"}))
+	phone := sessionOf(login(t, ss, session.NewSession{Device: "Phone"}))
+	kiosk := login(t, ss, session.NewSession{Device: "Kiosk"})
+
+	list, err := ss.List(authorID, laptop.SessionID)
+	if err != nil || len(list) != 3 {
+		t.Fatalf("\t%s\tWrong sessions: %v %+v", test.Failed, err, list)
+	}
+	for _, s := range list {
+		if s.Current != (s.ID == laptop.SessionID) {
+			t.Fatalf("\t%s\tWrong current session: %+v", test.Failed, s)
+		}
+	}
+	t.Logf("\t%s\tSessions listed", test.Success)
+
+	samples := []struct {
+		name       string
+		userID     string
+		id         string
+		statusCode int
+	}{
+		{"Invalid ID", authorID, "phone", http.StatusBadRequest},
+		{"Unknown session", authorID, "562e1fe0-0dde-4717-a008-cd2a699301d3", http.StatusNotFound},
+		{"Session of another user", "bad069ce-4afa-4a53-a673-14ae7b627d06", phone.SessionID, http.StatusNotFound},
+		{"Revoked", authorID, phone.SessionID, http.StatusOK},
+		{"Revoked twice", authorID, phone.SessionID, http.StatusNotFound},
+	}
+
+	for _, sample := range samples {
+		err := ss.Revoke(sample.userID, sample.id)
+		code := http.StatusOK
+		if re, ok := err.(*web.RequestError); ok {
+			code = re.Status
+		} else if err != nil {
+			code = http.StatusInternalServerError
+		}
+		if code != sample.statusCode {
+			t.Fatalf("\t%s\t%s: want %d got %v", test.Failed, sample.name, sample.statusCode, err)
+		}
+		t.Logf("\t%s\t%s", test.Success, sample.name)
+	}
+
+	if !rl.IsRevoked(phone.Id, phone.SessionID) || rl.IsRevoked(laptop.Id, laptop.SessionID) {
+		t.Fatalf("\t%s\tWrong revocations after revoking a session", test.Failed)
+	}
+	t.Logf("\t%s\tRevoking a session revokes its access tokens", test.Success)
+
+	if err := ss.Logout(laptop); err != nil {
+		t.Fatalf("\t%s\tLogging out failed: %v", test.Failed, err)
+	}
+	if !rl.IsRevoked(laptop.Id) || !rl.IsRevoked(laptop.SessionID) {
+		t.Fatalf("\t%s\tLogout left the token valid", test.Failed)
+	}
+	t.Logf("\t%s\tLogout revokes the token and its session", test.Success)
+
+	if err := ss.RevokeAll(authorID); err != nil {
+		t.Fatalf("\t%s\tRevoking all sessions failed: %v", test.Failed, err)
+	}
+	if _, err := ss.Refresh(kiosk.RefreshToken); !unauthorized(err, session.ErrInvalidRefresh) {
+		t.Fatalf("\t%s\tRevoked session refreshed: %v", test.Failed, err)
+	}
+	if list, _ := ss.List(authorID, ""); len(list) != 0 {
+		t.Fatalf("\t%s\tSessions left after revoking all: %+v", test.Failed, list)
+	}
+	t.Logf("\t%s\tAll sessions revoked", test.Success)
+}
+
+func TestRevocationList(t *testing.T) {
+	ms := mock.NewMockSession()
+	rl := session.NewRevocationList(ms)
+
+	if err := rl.Revoke("2c3e8b0a-6f0e-4c55-9a55-0b7b6a0c1a11", time.Now().Add(time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+	if err := rl.Revoke("7d0f4a8e-1b2c-4e5f-8a9b-0c1d2e3f4a5b", time.Now().Add(10*time.Millisecond)); err != nil {
+		t.Fatal(err)
+	}
+
+	other := session.NewRevocationList(ms)
+	if n, err := other.Sync(); err != nil || n != 2 || !other.IsRevoked("2c3e8b0a-6f0e-4c55-9a55-0b7b6a0c1a11") {
+		t.Fatalf("\t%s\tSync missed revocations: %d %v", test.Failed, n, err)
+	}
+	t.Logf("\t%s\tRevocations shared through the repository", test.Success)
+
+	if rl.IsRevoked("", "562e1fe0-0dde-4717-a008-cd2a699301d3") {
+		t.Fatalf("\t%s\tUnrevoked IDs reported as revoked", test.Failed)
+	}
+
+	time.Sleep(20 * time.Millisecond)
+	if rl.IsRevoked("7d0f4a8e-1b2c-4e5f-8a9b-0c1d2e3f4a5b") {
+		t.Fatalf("\t%s\tExpired revocation still applies", test.Failed)
+	}
+	if n, err := rl.Cleanup(); err != nil || n != 1 {
+		t.Fatalf("\t%s\tWrong cleanup: %d %v", test.Failed, n, err)
+	}
+	if n, _ := session.NewRevocationList(ms).Sync(); n != 1 {
+		t.Fatalf("\t%s\tExpired revocation not deleted: %d left", test.Failed, n)
+	}
+	t.Logf("\t%s\tExpired revocations cleaned up", test.Success)
+
+	auth.Configure(auth.Config{Leeway: 30 * time.Second})
+	defer auth.Configure(auth.Config{})
+
+	if err := rl.Revoke("9e8d7c6b-5a4f-4e3d-8c2b-1a0f9e8d7c6b", time.Now().Add(-10*time.Second)); err != nil {
+		t.Fatal(err)
+	}
+	if !rl.IsRevoked("9e8d7c6b-5a4f-4e3d-8c2b-1a0f9e8d7c6b") {
+		t.Fatalf("\t%s\tRevocation dropped while the token is accepted", test.Failed)
+	}
+	t.Logf("\t%s\tRevocations kept for the leeway", test.Success)
+}
@@ -0,0 +1,23 @@
+package tag
+
+type Tag struct {
+	ID    string `db:"id" json:"id"`
+	Name  string `db:"name" json:"name"`
+	Count int    `db:"count" json:"count,omitempty"`
+}
+
+type NewTags struct {
+	Tags []string `json:"tags" validate:"required"`
+}
+
+type UpdateTag struct {
+	Name string `json:"name" validate:"required"`
+}
+
+type MergeTag struct {
+	Into string `json:"into" validate:"required"`
+}
+
+type NewSynonym struct {
+	Name string `json:"name" validate:"required"`
+}
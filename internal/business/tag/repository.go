@@ -0,0 +1,249 @@
+package tag
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/axwilliams/book-api/internal/platform/web"
+)
+
+var (
+	ErrNoAffect   = errors.New("No rows affected")
+	ErrNoTagFound = errors.New("No tag found")
+)
+
+type Repository interface {
+	GetById(id string) (*Tag, error)
+	Resolve(name string) (*Tag, error)
+	Create(t *Tag) error
+	GetByBook(bookID string) ([]Tag, error)
+	AddToBook(bookID, tagID, userID string) error
+	RemoveFromBook(bookID, tagID, userID string) error
+	Popular(limit int) ([]Tag, error)
+	Rename(t *Tag, oldName string) error
+	Merge(from *Tag, into *Tag) error
+	AddSynonym(name, tagID string) error
+}
+
+type repository struct {
+	db *sql.DB
+}
+
+func NewRepository(db *sql.DB) Repository {
+	return &repository{
+		db,
+	}
+}
+
+func (r *repository) GetById(id string) (*Tag, error) {
+	t := &Tag{}
+
+	err := r.db.QueryRow("SELECT id, name FROM tag WHERE id = $1", id).Scan(&t.ID, &t.Name)
+
+	switch {
+	case err == sql.ErrNoRows:
+		return nil, ErrNoTagFound
+	case err != nil:
+		return nil, fmt.Errorf("Retrieving tag: %w", err)
+	}
+
+	return t, nil
+}
+
+// Resolve finds a tag by its name or by one of its synonyms.
+func (r *repository) Resolve(name string) (*Tag, error) {
+	t := &Tag{}
+
+	err := r.db.QueryRow(`SELECT t.id, t.name FROM tag t WHERE t.name = $1
+		UNION SELECT t.id, t.name FROM tag t JOIN tag_synonym s ON s.tag_id = t.id WHERE s.name = $1
+		LIMIT 1`, name).Scan(&t.ID, &t.Name)
+
+	switch {
+	case err == sql.ErrNoRows:
+		return nil, ErrNoTagFound
+	case err != nil:
+		return nil, fmt.Errorf("Resolving tag: %w", err)
+	}
+
+	return t, nil
+}
+
+// Create adds the tag. When a concurrent request created a tag of the same
+// name first, t is set to that tag instead.
+func (r *repository) Create(t *Tag) error {
+	err := r.db.QueryRow(`INSERT INTO tag (id, name, created_at) VALUES ($1, $2, now())
+		ON CONFLICT (name) DO NOTHING RETURNING id`, t.ID, t.Name).Scan(&t.ID)
+
+	switch {
+	case err == sql.ErrNoRows:
+		// A separate statement, so it sees the row the other request committed.
+		err = r.db.QueryRow("SELECT id, name FROM tag WHERE name = $1", t.Name).Scan(&t.ID, &t.Name)
+		if err != nil {
+			return fmt.Errorf("Retrieving created tag: %w", err)
+		}
+	case err != nil:
+		return fmt.Errorf("Creating tag: %w", err)
+	}
+
+	return nil
+}
+
+func (r *repository) GetByBook(bookID string) ([]Tag, error) {
+	rows, err := r.db.Query(`SELECT t.id, t.name FROM tag t JOIN book_tag bt ON bt.tag_id = t.id
+		WHERE bt.book_id = $1 ORDER BY t.name`, bookID)
+	if err != nil {
+		return nil, fmt.Errorf("Retrieving book tags: %w", err)
+	}
+	defer rows.Close()
+
+	ts := []Tag{}
+	for rows.Next() {
+		t := Tag{}
+		if err = rows.Scan(&t.ID, &t.Name); err != nil {
+			return nil, fmt.Errorf("Scanning tag rows: %w", err)
+		}
+		ts = append(ts, t)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("Iterating tag rows: %w", err)
+	}
+
+	return ts, nil
+}
+
+func (r *repository) AddToBook(bookID, tagID, userID string) error {
+	_, err := r.db.Exec(`INSERT INTO book_tag (book_id, tag_id, user_id, created_at)
+		VALUES ($1, $2, NULLIF($3, '')::uuid, now()) ON CONFLICT DO NOTHING`, bookID, tagID, userID)
+	if err != nil {
+		return fmt.Errorf("Tagging book: %w", err)
+	}
+
+	return nil
+}
+
+// RemoveFromBook untags a book. A non empty userID only removes the tag when
+// that user added it.
+func (r *repository) RemoveFromBook(bookID, tagID, userID string) error {
+	res, err := r.db.Exec(`DELETE FROM book_tag WHERE book_id = $1 AND tag_id = $2
+		AND ($3 = '' OR user_id::text = $3)`, bookID, tagID, userID)
+	if err != nil {
+		return fmt.Errorf("Untagging book: %w", err)
+	}
+
+	count, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("Counting affected book tags: %w", err)
+	}
+
+	if count <= 0 {
+		return web.NewRequestError(ErrNoAffect, http.StatusGone)
+	}
+
+	return nil
+}
+
+func (r *repository) Popular(limit int) ([]Tag, error) {
+	rows, err := r.db.Query(`SELECT t.id, t.name, count(bt.book_id) AS count FROM tag t
+		JOIN book_tag bt ON bt.tag_id = t.id JOIN book b ON b.id = bt.book_id AND b.status = 'published'
+		GROUP BY t.id, t.name ORDER BY count DESC, t.name LIMIT $1`, limit)
+	if err != nil {
+		return nil, fmt.Errorf("Retrieving popular tags: %w", err)
+	}
+	defer rows.Close()
+
+	ts := []Tag{}
+	for rows.Next() {
+		t := Tag{}
+		if err = rows.Scan(&t.ID, &t.Name, &t.Count); err != nil {
+			return nil, fmt.Errorf("Scanning tag rows: %w", err)
+		}
+		ts = append(ts, t)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("Iterating tag rows: %w", err)
+	}
+
+	return ts, nil
+}
+
+// Rename changes the tag name and keeps the old name as a synonym so it still
+// resolves to the same tag.
+func (r *repository) Rename(t *Tag, oldName string) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec("DELETE FROM tag_synonym WHERE name = $1", t.Name); err != nil {
+		return fmt.Errorf("Removing tag synonym: %w", err)
+	}
+
+	if _, err := tx.Exec("UPDATE tag SET name = $1 WHERE id = $2", t.Name, t.ID); err != nil {
+		return fmt.Errorf("Renaming tag: %w", err)
+	}
+
+	_, err = tx.Exec("INSERT INTO tag_synonym (name, tag_id) VALUES ($1, $2) ON CONFLICT (name) DO UPDATE SET tag_id = $2",
+		oldName, t.ID)
+	if err != nil {
+		return fmt.Errorf("Adding tag synonym: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("Committing tag rename: %w", err)
+	}
+
+	return nil
+}
+
+// Merge moves every book and synonym of one tag onto another and turns the
+// merged tag's name into a synonym.
+func (r *repository) Merge(from *Tag, into *Tag) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec(`INSERT INTO book_tag (book_id, tag_id, user_id, created_at)
+		SELECT book_id, $2, user_id, created_at FROM book_tag WHERE tag_id = $1
+		ON CONFLICT DO NOTHING`, from.ID, into.ID)
+	if err != nil {
+		return fmt.Errorf("Moving book tags: %w", err)
+	}
+
+	if _, err := tx.Exec("DELETE FROM book_tag WHERE tag_id = $1", from.ID); err != nil {
+		return fmt.Errorf("Removing merged book tags: %w", err)
+	}
+
+	if _, err := tx.Exec("UPDATE tag_synonym SET tag_id = $2 WHERE tag_id = $1", from.ID, into.ID); err != nil {
+		return fmt.Errorf("Moving tag synonyms: %w", err)
+	}
+
+	if _, err := tx.Exec("DELETE FROM tag WHERE id = $1", from.ID); err != nil {
+		return fmt.Errorf("Removing merged tag: %w", err)
+	}
+
+	_, err = tx.Exec("INSERT INTO tag_synonym (name, tag_id) VALUES ($1, $2) ON CONFLICT (name) DO UPDATE SET tag_id = $2",
+		from.Name, into.ID)
+	if err != nil {
+		return fmt.Errorf("Adding tag synonym: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("Committing tag merge: %w", err)
+	}
+
+	return nil
+}
+
+func (r *repository) AddSynonym(name, tagID string) error {
+	_, err := r.db.Exec("INSERT INTO tag_synonym (name, tag_id) VALUES ($1, $2)", name, tagID)
+	if err != nil {
+		return fmt.Errorf("Adding tag synonym: %w", err)
+	}
+
+	return nil
+}
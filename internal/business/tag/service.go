@@ -0,0 +1,268 @@
+package tag
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/axwilliams/book-api/internal/business/book"
+	"github.com/axwilliams/book-api/internal/platform/policy"
+	"github.com/axwilliams/book-api/internal/platform/web"
+	"github.com/google/uuid"
+)
+
+const maxNameLength = 64
+
+var (
+	ErrInvalidID   = errors.New("ID is not in the correct form")
+	ErrInvalidName = errors.New("Tag names must be between 1 and 64 characters")
+	ErrTagExists   = errors.New("A tag or synonym with that name already exists, merge the tags instead")
+	ErrMergeSelf   = errors.New("A tag cannot be merged into itself")
+)
+
+type Service interface {
+	GetByBook(bookID, status string) ([]Tag, error)
+	Tag(bookID, status string, names []string, sub policy.Subject) ([]Tag, error)
+	Untag(bookID, status, name string, sub policy.Subject, curator bool) error
+	Popular(limitStr string) ([]Tag, error)
+	Rename(id string, ut UpdateTag) error
+	Merge(id string, mt MergeTag) error
+	AddSynonym(id string, ns NewSynonym) error
+}
+
+type service struct {
+	tr Repository
+	br book.Repository
+	pe *policy.Engine
+}
+
+// NewService returns a service that asks pe whether a user may change the
+// tags of a book.
+func NewService(tr Repository, br book.Repository, pe *policy.Engine) Service {
+	return &service{
+		tr,
+		br,
+		pe,
+	}
+}
+
+// Normalize folds case, strips a leading '#' and collapses whitespace so
+// "Sci  Fi", "#sci fi" and "sci fi" end up as the same tag.
+func Normalize(name string) string {
+	name = strings.TrimPrefix(strings.TrimSpace(name), "#")
+	return strings.ToLower(strings.Join(strings.Fields(name), " "))
+}
+
+func validName(name string) bool {
+	n := len([]rune(name))
+	return n > 0 && n <= maxNameLength
+}
+
+func (s *service) book(id string) (*book.Book, error) {
+	if _, err := uuid.Parse(id); err != nil {
+		return nil, web.NewRequestError(book.ErrInvalidID, http.StatusBadRequest)
+	}
+
+	bk, err := s.br.GetById(id)
+	switch {
+	case err == book.ErrNoBookFound:
+		return nil, web.NewRequestError(book.ErrNoBookFound, http.StatusNotFound)
+	case err != nil:
+		return nil, err
+	}
+
+	return bk, nil
+}
+
+// visibleBook is book for callers that only see books in status, unless it
+// is empty. Books in any other status are answered as if they did not exist.
+func (s *service) visibleBook(id, status string) (*book.Book, error) {
+	bk, err := s.book(id)
+	if err != nil {
+		return nil, err
+	}
+
+	if status != "" && bk.Status != status {
+		return nil, web.NewRequestError(book.ErrNoBookFound, http.StatusNotFound)
+	}
+
+	return bk, nil
+}
+
+// GetByBook lists the tags of a book.
+func (s *service) GetByBook(bookID, status string) ([]Tag, error) {
+	if _, err := s.visibleBook(bookID, status); err != nil {
+		return nil, err
+	}
+
+	return s.tr.GetByBook(bookID)
+}
+
+func (s *service) Tag(bookID, status string, names []string, sub policy.Subject) ([]Tag, error) {
+	bk, err := s.visibleBook(bookID, status)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.pe.Authorize(sub, book.ActionTag, bk.Resource()); err != nil {
+		return nil, err
+	}
+
+	for _, name := range names {
+		if !validName(Normalize(name)) {
+			return nil, web.NewRequestError(ErrInvalidName, http.StatusUnprocessableEntity)
+		}
+	}
+
+	for _, name := range names {
+		t, err := s.resolveOrCreate(Normalize(name))
+		if err != nil {
+			return nil, err
+		}
+
+		if err := s.tr.AddToBook(bookID, t.ID, sub.ID); err != nil {
+			return nil, err
+		}
+	}
+
+	return s.tr.GetByBook(bookID)
+}
+
+func (s *service) resolveOrCreate(name string) (*Tag, error) {
+	t, err := s.tr.Resolve(name)
+	switch {
+	case err == ErrNoTagFound:
+		t = &Tag{
+			ID:   uuid.New().String(),
+			Name: name,
+		}
+		return t, s.tr.Create(t)
+	case err != nil:
+		return nil, err
+	}
+
+	return t, nil
+}
+
+// Untag removes a tag from a book. Curators may remove any tag, everyone
+// else only the ones they added.
+func (s *service) Untag(bookID, status, name string, sub policy.Subject, curator bool) error {
+	bk, err := s.visibleBook(bookID, status)
+	if err != nil {
+		return err
+	}
+
+	if err := s.pe.Authorize(sub, book.ActionTag, bk.Resource()); err != nil {
+		return err
+	}
+
+	t, err := s.tr.Resolve(Normalize(name))
+	switch {
+	case err == ErrNoTagFound:
+		return web.NewRequestError(ErrNoAffect, http.StatusGone)
+	case err != nil:
+		return err
+	}
+
+	actorID := sub.ID
+	if curator {
+		actorID = ""
+	}
+
+	return s.tr.RemoveFromBook(bookID, t.ID, actorID)
+}
+
+func (s *service) Popular(limitStr string) ([]Tag, error) {
+	limit, err := strconv.Atoi(limitStr)
+	if err != nil || limit <= 0 || limit > 100 {
+		limit = 20
+	}
+
+	return s.tr.Popular(limit)
+}
+
+func (s *service) get(id string) (*Tag, error) {
+	if _, err := uuid.Parse(id); err != nil {
+		return nil, web.NewRequestError(ErrInvalidID, http.StatusBadRequest)
+	}
+
+	t, err := s.tr.GetById(id)
+	switch {
+	case err == ErrNoTagFound:
+		return nil, web.NewRequestError(ErrNoAffect, http.StatusGone)
+	case err != nil:
+		return nil, err
+	}
+
+	return t, nil
+}
+
+func (s *service) Rename(id string, ut UpdateTag) error {
+	t, err := s.get(id)
+	if err != nil {
+		return err
+	}
+
+	name := Normalize(ut.Name)
+	if !validName(name) {
+		return web.NewRequestError(ErrInvalidName, http.StatusUnprocessableEntity)
+	}
+
+	if name == t.Name {
+		return nil
+	}
+
+	other, err := s.tr.Resolve(name)
+	switch {
+	case err == nil && other.ID != t.ID:
+		return web.NewRequestError(ErrTagExists, http.StatusConflict)
+	case err != nil && err != ErrNoTagFound:
+		return err
+	}
+
+	oldName := t.Name
+	t.Name = name
+
+	return s.tr.Rename(t, oldName)
+}
+
+func (s *service) Merge(id string, mt MergeTag) error {
+	from, err := s.get(id)
+	if err != nil {
+		return err
+	}
+
+	into, err := s.get(mt.Into)
+	if err != nil {
+		return err
+	}
+
+	if from.ID == into.ID {
+		return web.NewRequestError(ErrMergeSelf, http.StatusUnprocessableEntity)
+	}
+
+	return s.tr.Merge(from, into)
+}
+
+func (s *service) AddSynonym(id string, ns NewSynonym) error {
+	t, err := s.get(id)
+	if err != nil {
+		return err
+	}
+
+	name := Normalize(ns.Name)
+	if !validName(name) {
+		return web.NewRequestError(ErrInvalidName, http.StatusUnprocessableEntity)
+	}
+
+	_, err = s.tr.Resolve(name)
+	switch {
+	case err == nil:
+		return web.NewRequestError(ErrTagExists, http.StatusConflict)
+	case err != ErrNoTagFound:
+		return err
+	}
+
+	return s.tr.AddSynonym(name, t.ID)
+}
@@ -0,0 +1,131 @@
+package tag_test
+
+import (
+	"os"
+	"reflect"
+	"testing"
+
+	"github.com/axwilliams/book-api/internal/business/book"
+	"github.com/axwilliams/book-api/internal/business/tag"
+	"github.com/axwilliams/book-api/internal/platform/policy"
+	"github.com/axwilliams/book-api/internal/test"
+)
+
+var (
+	bookService book.Service
+	tagService  tag.Service
+)
+
+func TestMain(m *testing.M) {
+	db, container := test.Setup()
+
+	bookRepository := book.NewRepository(db)
+	bookService = book.NewService(bookRepository, policy.NewEngine(""))
+	tagService = tag.NewService(tag.NewRepository(db), bookRepository, policy.NewEngine(""))
+
+	e := m.Run()
+
+	test.Teardown(db, container)
+	os.Exit(e)
+}
+
+func names(ts []tag.Tag) []string {
+	ns := []string{}
+	for _, t := range ts {
+		ns = append(ns, t.Name)
+	}
+	return ns
+}
+
+func titles(bks []book.Book) []string {
+	ts := []string{}
+	for _, bk := range bks {
+		ts = append(ts, bk.Title)
+	}
+	return ts
+}
+
+func TestTagAndSearch(t *testing.T) {
+	castle := "f4ac7e14-fc8e-4096-b956-34e5a33040f2"
+	fahrenheit := "71432eb9-58da-4eae-aa20-ccc49064246f"
+	userID := "bad069ce-4afa-4a53-a673-14ae7b627d06"
+
+	ts, err := tagService.Tag(castle, "", []string{"Bureaucracy", "  classic "}, policy.Subject{ID: userID})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if ok := reflect.DeepEqual(names(ts), []string{"bureaucracy", "classic"}); !ok {
+		t.Fatalf("\t%s\tWrong tags: got %v", test.Failed, names(ts))
+	}
+	t.Logf("\t%s\tTags normalized", test.Success)
+
+	if _, err := tagService.Tag(fahrenheit, "", []string{"#Classic", "Dystopia"}, policy.Subject{ID: userID}); err != nil {
+		t.Fatal(err)
+	}
+
+	samples := []struct {
+		tags     []string
+		match    string
+		expected []string
+	}{
+		{[]string{"classic"}, book.MatchAny, []string{"Fahrenheit 451", "The Castle"}},
+		{[]string{"bureaucracy", "dystopia"}, book.MatchAny, []string{"Fahrenheit 451", "The Castle"}},
+		{[]string{"classic", "dystopia"}, book.MatchAll, []string{"Fahrenheit 451"}},
+		{[]string{"bureaucracy", "dystopia"}, book.MatchAll, []string{}},
+	}
+
+	for _, sample := range samples {
+		bks, err := bookService.Search(book.SearchParams{Tags: sample.tags, TagMatch: sample.match}, "title", "asc", "", "")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if ok := reflect.DeepEqual(titles(bks), sample.expected); !ok {
+			t.Fatalf("\t%s\tWrong books for %v (%s): want %v got %v", test.Failed, sample.tags, sample.match, sample.expected, titles(bks))
+		}
+		t.Logf("\t%s\tSearch by %v (%s)", test.Success, sample.tags, sample.match)
+	}
+}
+
+func TestMerge(t *testing.T) {
+	sixEasy := "562e1fe0-0dde-4717-a008-cd2a699301d2"
+
+	if _, err := tagService.Tag(sixEasy, "", []string{"physics", "phys"}, policy.Subject{}); err != nil {
+		t.Fatal(err)
+	}
+
+	pop, err := tagService.Popular("")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ids := map[string]string{}
+	for _, p := range pop {
+		ids[p.Name] = p.ID
+	}
+
+	if err := tagService.Merge(ids["phys"], tag.MergeTag{Into: ids["physics"]}); err != nil {
+		t.Fatal(err)
+	}
+
+	ts, err := tagService.GetByBook(sixEasy, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if ok := reflect.DeepEqual(names(ts), []string{"physics"}); !ok {
+		t.Fatalf("\t%s\tWrong tags after merge: got %v", test.Failed, names(ts))
+	}
+	t.Logf("\t%s\tTags merged", test.Success)
+
+	bks, err := bookService.Search(book.SearchParams{Tags: []string{"phys"}}, "", "", "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(bks) != 1 || bks[0].ID != sixEasy {
+		t.Fatalf("\t%s\tMerged name does not resolve: got %v", test.Failed, titles(bks))
+	}
+	t.Logf("\t%s\tMerged name kept as synonym", test.Success)
+}
@@ -1,27 +1,73 @@
 package user
 
 import (
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"time"
+
 	"github.com/lib/pq"
 )
 
+const (
+	RoleGranted = "grant"
+	RoleRevoked = "revoke"
+)
+
 type User struct {
 	ID           string         `db:"id" json:"id"`
 	Username     string         `db:"username" json:"username"`
 	Email        string         `db:"email" json:"email"`
 	Roles        pq.StringArray `db:"roles" json:"roles"`
+	Attributes   Attributes     `db:"attributes" json:"attributes"`
 	PasswordHash []byte         `db:"password" json:"-"`
 }
 
 type NewUser struct {
-	Username string   `json:"username" validate:"required"`
-	Email    string   `json:"email" validate:"required,email"`
-	Roles    []string `json:"roles"`
-	Password string   `json:"password" validate:"required,password"`
+	Username   string     `json:"username" validate:"required"`
+	Email      string     `json:"email" validate:"required,email"`
+	Roles      []string   `json:"roles"`
+	Attributes Attributes `json:"attributes"`
+	Password   string     `json:"password" validate:"required,password"`
 }
 
+// UpdateUser changes the fields that are given. Attributes replace the
+// current ones; an empty object clears them.
 type UpdateUser struct {
-	Username string   `json:"username"`
-	Email    string   `json:"email" validate:"omitempty,email"`
-	Roles    []string `json:"roles"`
-	Password string   `json:"password" validate:"omitempty,password"`
+	Username   string     `json:"username"`
+	Email      string     `json:"email" validate:"omitempty,email"`
+	Roles      []string   `json:"roles"`
+	Attributes Attributes `json:"attributes"`
+	Password   string     `json:"password" validate:"omitempty,password"`
+}
+
+// RoleChange records a role being granted to or revoked from a user. An
+// empty ActorID means the change was made by the system, e.g. when syncing
+// the groups of a single sign-on account.
+type RoleChange struct {
+	ID        string    `db:"id" json:"id"`
+	UserID    string    `db:"user_id" json:"user_id"`
+	Role      string    `db:"role" json:"role"`
+	Action    string    `db:"action" json:"action"`
+	ActorID   string    `db:"actor_id" json:"actor_id"`
+	CreatedAt time.Time `db:"created_at" json:"created_at"`
+}
+
+// Attributes describe a user to access policies, e.g. the categories they
+// curate. They are stored as a JSON object.
+type Attributes map[string]interface{}
+
+func (a Attributes) Value() (driver.Value, error) {
+	if a == nil {
+		return []byte("{}"), nil
+	}
+	return json.Marshal(a)
+}
+
+func (a *Attributes) Scan(src interface{}) error {
+	b, ok := src.([]byte)
+	if !ok {
+		return errors.New("Scanning attributes: not a JSON object")
+	}
+	return json.Unmarshal(b, a)
 }
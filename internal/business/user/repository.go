@@ -6,6 +6,7 @@ import (
 	"fmt"
 	"net/http"
 
+	"github.com/axwilliams/book-api/internal/platform/auth"
 	"github.com/axwilliams/book-api/internal/platform/web"
 )
 
@@ -17,12 +18,13 @@ var (
 
 type Repository interface {
 	GetById(id string) (*User, error)
-	Create(u *User) error
-	Update(u *User) error
-	Destroy(id string) error
+	Create(u *User, cs []RoleChange) error
+	Update(u *User, cs []RoleChange, revoke func() error) error
+	Destroy(id string, cs []RoleChange, revoke func() error) error
 	GetByUsername(username string) (*User, error)
 	UsernameAvailable(username, cuurentID string) bool
 	EmailAvailable(username, cuurentID string) bool
+	GetRoleChanges(userID string) ([]RoleChange, error)
 }
 
 type repository struct {
@@ -38,8 +40,8 @@ func NewRepository(db *sql.DB) Repository {
 func (r *repository) GetById(id string) (*User, error) {
 	u := &User{}
 
-	err := r.db.QueryRow("SELECT id, username, email, roles, password FROM users where id=$1",
-		id).Scan(&u.ID, &u.Username, &u.Email, &u.Roles, &u.PasswordHash)
+	err := r.db.QueryRow("SELECT id, username, email, roles, attributes, password FROM users where id=$1",
+		id).Scan(&u.ID, &u.Username, &u.Email, &u.Roles, &u.Attributes, &u.PasswordHash)
 
 	switch {
 	case err == sql.ErrNoRows:
@@ -51,30 +53,93 @@ func (r *repository) GetById(id string) (*User, error) {
 	return u, nil
 }
 
-func (r *repository) Create(u *User) error {
-	_, err := r.db.Exec("INSERT INTO users (id, username, email, roles, password) VALUES ($1, $2, $3, $4, $5)",
-		u.ID, u.Username, u.Email, u.Roles, u.PasswordHash)
+// Create saves a new user together with the roles it was granted.
+func (r *repository) Create(u *User, cs []RoleChange) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec("INSERT INTO users (id, username, email, roles, attributes, password) VALUES ($1, $2, $3, $4, $5, $6)",
+		u.ID, u.Username, u.Email, u.Roles, u.Attributes, u.PasswordHash)
 
 	if err != nil {
 		return fmt.Errorf("Creating user: %w", err)
 	}
 
+	if err := insertRoleChanges(tx, cs); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("Committing user: %w", err)
+	}
+
 	return nil
 }
 
-func (r *repository) Update(u *User) error {
-	_, err := r.db.Exec("UPDATE users SET username=$1, email=$2, roles=$3, password=$4 WHERE id=$5;",
-		u.Username, u.Email, u.Roles, u.PasswordHash, u.ID)
+// Update saves a user and records the role changes cs made to it. It
+// refuses with ErrLastAdmin to revoke ADMIN from the last user holding it.
+// A non nil revoke ends the user's logins once that check passed and before
+// the change is committed, so a change is never saved with the old logins
+// still valid and a refused change ends none.
+func (r *repository) Update(u *User, cs []RoleChange, revoke func() error) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := keepAdmin(tx, u.ID, cs); err != nil {
+		return err
+	}
+
+	_, err = tx.Exec("UPDATE users SET username=$1, email=$2, roles=$3, attributes=$4, password=$5 WHERE id=$6;",
+		u.Username, u.Email, u.Roles, u.Attributes, u.PasswordHash, u.ID)
 
 	if err != nil {
 		return fmt.Errorf("Updating user: %w", err)
 	}
 
+	if err := insertRoleChanges(tx, cs); err != nil {
+		return err
+	}
+
+	if revoke != nil {
+		if err := revoke(); err != nil {
+			return err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("Committing user: %w", err)
+	}
+
 	return nil
 }
 
-func (r *repository) Destroy(id string) error {
-	res, err := r.db.Exec("DELETE FROM users WHERE id = $1;", id)
+// Destroy deletes a user and records the roles it held as revoked, with
+// the same check for the last ADMIN as Update. revoke runs before the delete,
+// as deleting the user also deletes the refresh tokens it revokes.
+func (r *repository) Destroy(id string, cs []RoleChange, revoke func() error) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := keepAdmin(tx, id, cs); err != nil {
+		return err
+	}
+
+	if revoke != nil {
+		if err := revoke(); err != nil {
+			return err
+		}
+	}
+
+	res, err := tx.Exec("DELETE FROM users WHERE id = $1;", id)
 	if err != nil {
 		return err
 	}
@@ -88,14 +153,22 @@ func (r *repository) Destroy(id string) error {
 		return web.NewRequestError(ErrNoAffect, http.StatusGone)
 	}
 
+	if err := insertRoleChanges(tx, cs); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("Committing user: %w", err)
+	}
+
 	return nil
 }
 
 func (r *repository) GetByUsername(username string) (*User, error) {
 	u := &User{}
 
-	err := r.db.QueryRow("SELECT id, username, email, roles, password FROM users WHERE username = $1",
-		username).Scan(&u.ID, &u.Username, &u.Email, &u.Roles, &u.PasswordHash)
+	err := r.db.QueryRow("SELECT id, username, email, roles, attributes, password FROM users WHERE username = $1",
+		username).Scan(&u.ID, &u.Username, &u.Email, &u.Roles, &u.Attributes, &u.PasswordHash)
 
 	switch {
 	case err == sql.ErrNoRows:
@@ -132,3 +205,85 @@ func (r *repository) EmailAvailable(email, currentID string) bool {
 
 	return false
 }
+
+func (r *repository) GetRoleChanges(userID string) ([]RoleChange, error) {
+	rows, err := r.db.Query(`SELECT id, user_id, role, action, COALESCE(actor_id::text, ''), created_at
+		FROM user_role_change WHERE user_id = $1 ORDER BY created_at`, userID)
+	if err != nil {
+		return nil, fmt.Errorf("Retrieving role changes: %w", err)
+	}
+	defer rows.Close()
+
+	cs := []RoleChange{}
+	for rows.Next() {
+		c := RoleChange{}
+		if err = rows.Scan(&c.ID, &c.UserID, &c.Role, &c.Action, &c.ActorID, &c.CreatedAt); err != nil {
+			return nil, fmt.Errorf("Scanning role change rows: %w", err)
+		}
+		cs = append(cs, c)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("Iterating role change rows: %w", err)
+	}
+
+	return cs, nil
+}
+
+// keepAdmin refuses to revoke ADMIN from the user id when no other user
+// holds it, as nobody could manage users and roles any more. The ADMIN
+// rows stay locked until tx ends, so that two admins cannot demote each
+// other at the same time.
+func keepAdmin(tx *sql.Tx, id string, cs []RoleChange) error {
+	revoked := false
+	for _, c := range cs {
+		if c.Role == auth.RoleAdmin && c.Action == RoleRevoked {
+			revoked = true
+		}
+	}
+	if !revoked {
+		return nil
+	}
+
+	rows, err := tx.Query("SELECT id FROM users WHERE $1 = ANY(roles) FOR UPDATE", auth.RoleAdmin)
+	if err != nil {
+		return fmt.Errorf("Locking admins: %w", err)
+	}
+	defer rows.Close()
+
+	others := 0
+	for rows.Next() {
+		var adminID string
+		if err = rows.Scan(&adminID); err != nil {
+			return fmt.Errorf("Scanning admin rows: %w", err)
+		}
+		if adminID != id {
+			others++
+		}
+	}
+	if err = rows.Err(); err != nil {
+		return fmt.Errorf("Iterating admin rows: %w", err)
+	}
+
+	if others == 0 {
+		return web.NewRequestError(ErrLastAdmin, http.StatusConflict)
+	}
+	return nil
+}
+
+type execer interface {
+	Exec(query string, args ...interface{}) (sql.Result, error)
+}
+
+func insertRoleChanges(db execer, cs []RoleChange) error {
+	for _, c := range cs {
+		_, err := db.Exec(`INSERT INTO user_role_change (id, user_id, role, action, actor_id, created_at)
+			VALUES ($1, $2, $3, $4, NULLIF($5, '')::uuid, $6)`,
+			c.ID, c.UserID, c.Role, c.Action, c.ActorID, c.CreatedAt)
+
+		if err != nil {
+			return fmt.Errorf("Recording role change: %w", err)
+		}
+	}
+
+	return nil
+}
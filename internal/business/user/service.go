@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"net/http"
 	"strings"
+	"time"
 
 	"github.com/axwilliams/book-api/internal/platform/auth"
 	"github.com/axwilliams/book-api/internal/platform/web"
@@ -17,23 +18,61 @@ var (
 	ErrInvalidID      = errors.New("ID is not in the correct form")
 	ErrUsernameExists = errors.New("username is already taken")
 	ErrEmailExists    = errors.New("email is already taken")
+	ErrUnknownRole    = errors.New("roles must name existing roles")
+	ErrLastAdmin      = errors.New("The last ADMIN cannot lose the role")
 )
 
 type Service interface {
 	GetById(id string) (*User, error)
-	Create(nu *NewUser) (*User, error)
-	Update(id string, uu UpdateUser) error
-	Destroy(id string) error
+	Create(nu *NewUser, actorID string) (*User, error)
+	Update(id string, uu UpdateUser, actorID string) error
+	Destroy(id, actorID string) error
+	Grant(id, role, actorID string) (*User, error)
+	Revoke(id, role, actorID string) (*User, error)
+	SetRoles(id string, roles []string, actorID string) (*User, error)
+	RoleChanges(id string) ([]RoleChange, error)
 	Authenticate(username, password string) (auth.Claims, error)
 }
 
+// Sessions ends the logins of a user whose password or roles changed, so
+// that tokens issued before the change stop working.
+type Sessions interface {
+	RevokeAll(userID string) error
+}
+
+// JoinSessions returns Sessions that end the logins of a user in each of
+// ss, e.g. their refresh tokens and the tokens OAuth clients hold for them.
+func JoinSessions(ss ...Sessions) Sessions {
+	return joined(ss)
+}
+
+type joined []Sessions
+
+func (j joined) RevokeAll(userID string) error {
+	for _, s := range j {
+		if err := s.RevokeAll(userID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Roles tells which roles are defined. role.Registry implements it.
+type Roles interface {
+	Exists(name string) bool
+}
+
 type service struct {
 	ur Repository
+	ss Sessions
+	rs Roles
 }
 
-func NewService(ur Repository) Service {
+func NewService(ur Repository, ss Sessions, rs Roles) Service {
 	return &service{
 		ur,
+		ss,
+		rs,
 	}
 }
 
@@ -45,7 +84,12 @@ func (s *service) GetById(id string) (*User, error) {
 	return s.ur.GetById(id)
 }
 
-func (s *service) Create(nu *NewUser) (*User, error) {
+func (s *service) Create(nu *NewUser, actorID string) (*User, error) {
+	roles, err := s.roles(nu.Roles)
+	if err != nil {
+		return nil, err
+	}
+
 	hash, err := bcrypt.GenerateFromPassword([]byte(nu.Password), bcrypt.DefaultCost)
 	if err != nil {
 		return nil, fmt.Errorf("generating password hash: %w", err)
@@ -55,7 +99,8 @@ func (s *service) Create(nu *NewUser) (*User, error) {
 		ID:           uuid.New().String(),
 		Username:     strings.TrimSpace(nu.Username),
 		Email:        strings.TrimSpace(nu.Email),
-		Roles:        nu.Roles,
+		Roles:        roles,
+		Attributes:   nu.Attributes,
 		PasswordHash: hash,
 	}
 
@@ -67,10 +112,14 @@ func (s *service) Create(nu *NewUser) (*User, error) {
 		return nil, web.NewRequestError(ErrEmailExists, http.StatusNotAcceptable)
 	}
 
-	return u, s.ur.Create(u)
+	if err := s.ur.Create(u, DiffRoles(u.ID, actorID, nil, u.Roles)); err != nil {
+		return nil, err
+	}
+
+	return u, nil
 }
 
-func (s *service) Update(id string, uu UpdateUser) error {
+func (s *service) Update(id string, uu UpdateUser, actorID string) error {
 	if _, err := uuid.Parse(id); err != nil {
 		return web.NewRequestError(ErrInvalidID, http.StatusBadRequest)
 	}
@@ -97,8 +146,21 @@ func (s *service) Update(id string, uu UpdateUser) error {
 		}
 	}
 
+	revoke := false
+	var changes []RoleChange
+
 	if len(uu.Roles) != 0 {
-		u.Roles = uu.Roles
+		roles, err := s.roles(uu.Roles)
+		if err != nil {
+			return err
+		}
+		changes = DiffRoles(u.ID, actorID, u.Roles, roles)
+		revoke = len(changes) != 0
+		u.Roles = roles
+	}
+
+	if uu.Attributes != nil {
+		u.Attributes = uu.Attributes
 	}
 
 	if uu.Password != "" {
@@ -107,17 +169,179 @@ func (s *service) Update(id string, uu UpdateUser) error {
 			return fmt.Errorf("generating password hash: %w", err)
 		}
 		u.PasswordHash = hash
+		revoke = true
+	}
+
+	var end func() error
+	if revoke {
+		end = s.revoke(u.ID)
 	}
 
-	return s.ur.Update(u)
+	return s.ur.Update(u, changes, end)
 }
 
-func (s *service) Destroy(id string) error {
+// Destroy ends the user's logins and deletes them, recording the roles they
+// held as revoked. The last ADMIN is refused before any login ends.
+func (s *service) Destroy(id, actorID string) error {
 	if _, err := uuid.Parse(id); err != nil {
 		return web.NewRequestError(ErrInvalidID, http.StatusBadRequest)
 	}
 
-	return s.ur.Destroy(id)
+	u, err := s.ur.GetById(id)
+	switch {
+	case err == ErrNoUserFound:
+		return web.NewRequestError(ErrNoAffect, http.StatusGone)
+	case err != nil:
+		return err
+	}
+
+	return s.ur.Destroy(id, DiffRoles(u.ID, actorID, u.Roles, nil), s.revoke(id))
+}
+
+// Grant adds a role to a user's roles. Granting a role the user already
+// holds changes nothing.
+func (s *service) Grant(id, role, actorID string) (*User, error) {
+	roles, err := s.roles([]string{role})
+	if err != nil {
+		return nil, err
+	}
+
+	return s.changeRoles(id, actorID, func(u *User) ([]string, error) {
+		if auth.HasRole(u.Roles, roles[0]) {
+			return u.Roles, nil
+		}
+		return append(append([]string{}, u.Roles...), roles[0]), nil
+	})
+}
+
+// Revoke removes a role from a user's roles. The role need not exist any
+// more, so that the names of deleted roles can be cleaned up.
+func (s *service) Revoke(id, role, actorID string) (*User, error) {
+	role = strings.ToUpper(strings.TrimSpace(role))
+
+	return s.changeRoles(id, actorID, func(u *User) ([]string, error) {
+		roles := []string{}
+		for _, r := range u.Roles {
+			if r != role {
+				roles = append(roles, r)
+			}
+		}
+
+		return roles, nil
+	})
+}
+
+// SetRoles replaces the roles of a user, e.g. with those of the groups of
+// a single sign-on account.
+func (s *service) SetRoles(id string, roles []string, actorID string) (*User, error) {
+	roles, err := s.roles(roles)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.changeRoles(id, actorID, func(u *User) ([]string, error) {
+		return roles, nil
+	})
+}
+
+// changeRoles replaces the roles of a user with those change returns,
+// records the difference and ends the user's logins if there is one.
+func (s *service) changeRoles(id, actorID string, change func(u *User) ([]string, error)) (*User, error) {
+	if _, err := uuid.Parse(id); err != nil {
+		return nil, web.NewRequestError(ErrInvalidID, http.StatusBadRequest)
+	}
+
+	u, err := s.ur.GetById(id)
+	switch {
+	case err == ErrNoUserFound:
+		return nil, web.NewRequestError(ErrNoUserFound, http.StatusNotFound)
+	case err != nil:
+		return nil, err
+	}
+
+	roles, err := change(u)
+	if err != nil {
+		return nil, err
+	}
+
+	changes := DiffRoles(u.ID, actorID, u.Roles, roles)
+	if len(changes) == 0 {
+		return u, nil
+	}
+
+	u.Roles = roles
+	if err := s.ur.Update(u, changes, s.revoke(u.ID)); err != nil {
+		return nil, err
+	}
+
+	return u, nil
+}
+
+// revoke returns the function the repository calls to end a user's logins
+// within the transaction that changes the user.
+func (s *service) revoke(id string) func() error {
+	return func() error {
+		return s.ss.RevokeAll(id)
+	}
+}
+
+// RoleChanges returns the roles granted to and revoked from a user, oldest
+// first. They outlive the user, so the changes of deleted users can still
+// be looked up.
+func (s *service) RoleChanges(id string) ([]RoleChange, error) {
+	if _, err := uuid.Parse(id); err != nil {
+		return nil, web.NewRequestError(ErrInvalidID, http.StatusBadRequest)
+	}
+
+	return s.ur.GetRoleChanges(id)
+}
+
+// roles upper-cases and de-duplicates role names and refuses names no role
+// is defined for, so that a typo does not silently grant nothing.
+func (s *service) roles(names []string) ([]string, error) {
+	roles := []string{}
+	for _, name := range names {
+		name = strings.ToUpper(strings.TrimSpace(name))
+		if !s.rs.Exists(name) {
+			return nil, web.NewRequestError(fmt.Errorf("%w: %q", ErrUnknownRole, name), http.StatusUnprocessableEntity)
+		}
+		if !auth.HasRole(roles, name) {
+			roles = append(roles, name)
+		}
+	}
+
+	return roles, nil
+}
+
+// DiffRoles returns the changes that take a user's roles from from to to,
+// made by actorID.
+func DiffRoles(userID, actorID string, from, to []string) []RoleChange {
+	now := time.Now().UTC()
+	cs := []RoleChange{}
+
+	add := func(role, action string) {
+		cs = append(cs, RoleChange{
+			ID:        uuid.New().String(),
+			UserID:    userID,
+			Role:      role,
+			Action:    action,
+			ActorID:   actorID,
+			CreatedAt: now,
+		})
+	}
+
+	for _, r := range from {
+		if !auth.HasRole(to, r) {
+			add(r, RoleRevoked)
+		}
+	}
+	for _, r := range to {
+		if !auth.HasRole(from, r) {
+			add(r, RoleGranted)
+		}
+	}
+
+	return cs
 }
 
 func (s *service) Authenticate(username, password string) (auth.Claims, error) {
@@ -5,6 +5,8 @@ import (
 	"reflect"
 	"testing"
 
+	"github.com/axwilliams/book-api/internal/business/role"
+	"github.com/axwilliams/book-api/internal/business/session"
 	"github.com/axwilliams/book-api/internal/business/user"
 	"github.com/axwilliams/book-api/internal/test"
 	"github.com/lib/pq"
@@ -17,7 +19,9 @@ func TestMain(m *testing.M) {
 	db, container := test.Setup()
 
 	userRepository := user.NewRepository(db)
-	userService = user.NewService(userRepository)
+	sessionRepository := session.NewRepository(db)
+	sessionService := session.NewService(sessionRepository, userRepository, session.NewRevocationList(sessionRepository), session.DefaultPolicy)
+	userService = user.NewService(userRepository, sessionService, role.NewRegistry(role.NewRepository(db)))
 
 	e := m.Run()
 
@@ -31,6 +35,7 @@ func TestGetById(t *testing.T) {
 		Username:     "author",
 		Email:        "author@example.com",
 		Roles:        pq.StringArray([]string{"AUTHOR"}),
+		Attributes:   user.Attributes{},
 		PasswordHash: []byte("$2a$10$ExnMCA7MuOwW.s8Ss0BvSuGNCHawMIpqMmyJ4Oa9sTCTKKw2x445e"),
 	}
 
@@ -53,7 +58,7 @@ func TestCreate(t *testing.T) {
 		Password: "Admin#1",
 	}
 
-	u, err := userService.Create(nu)
+	u, err := userService.Create(nu, "a72bec75-0a5f-49af-a844-5763d188788e")
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -68,6 +73,7 @@ func TestCreate(t *testing.T) {
 		Username:     "newadmin",
 		Email:        "newadmin@example.com",
 		Roles:        pq.StringArray([]string{"ADMIN", "AUTHOR"}),
+		Attributes:   user.Attributes{},
 		PasswordHash: []byte("$2a$10$IUs9j88n5g5pthZXNmU9tei2mhIX7MWTvk39AjWUx40juWOrrPOzi"),
 	}
 
@@ -91,7 +97,7 @@ func TestUpdate(t *testing.T) {
 		Password: "Author#1",
 	}
 
-	if err := userService.Update(ID, uu); err != nil {
+	if err := userService.Update(ID, uu, "a72bec75-0a5f-49af-a844-5763d188788e"); err != nil {
 		t.Fatal(err)
 	}
 
@@ -105,6 +111,7 @@ func TestUpdate(t *testing.T) {
 		Username:     "newauthor",
 		Email:        "newauthor@example.com",
 		Roles:        pq.StringArray([]string{"AUTHOR"}),
+		Attributes:   user.Attributes{},
 		PasswordHash: []byte("$2a$10$ExnMCA7MuOwW.s8Ss0BvSuGNCHawMIpqMmyJ4Oa9sTCTKKw2x445e"),
 	}
 
@@ -121,7 +128,7 @@ func TestUpdate(t *testing.T) {
 func TestDestroy(t *testing.T) {
 	ID := "bad069ce-4afa-4a53-a673-14ae7b627d06"
 
-	if err := userService.Destroy(ID); err != nil {
+	if err := userService.Destroy(ID, "a72bec75-0a5f-49af-a844-5763d188788e"); err != nil {
 		t.Fatal(err)
 	}
 
@@ -131,6 +138,41 @@ func TestDestroy(t *testing.T) {
 	t.Logf("\t%s\tUser destroyed", test.Success)
 }
 
+func TestRoles(t *testing.T) {
+	authorID := "69a47775-6d89-4d38-ad38-acdb2928f6a1"
+	adminID := "a72bec75-0a5f-49af-a844-5763d188788e"
+
+	if _, err := userService.Grant(authorID, "AUTHR", adminID); err == nil {
+		t.Fatalf("\t%s\tUnknown role granted", test.Failed)
+	}
+	t.Logf("\t%s\tUnknown role refused", test.Success)
+
+	u, err := userService.Grant(authorID, "curator", adminID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := pq.StringArray([]string{"AUTHOR", "CURATOR"})
+	if ok := reflect.DeepEqual(u.Roles, expected); !ok {
+		t.Fatalf("\t%s\tError granting role: want %v got %v", test.Failed, expected, u.Roles)
+	}
+	t.Logf("\t%s\tRole granted", test.Success)
+
+	if _, err := userService.Revoke(authorID, "CURATOR", adminID); err != nil {
+		t.Fatal(err)
+	}
+
+	cs, err := userService.RoleChanges(authorID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(cs) != 2 || cs[0].Action != user.RoleGranted || cs[1].Action != user.RoleRevoked || cs[1].ActorID != adminID {
+		t.Fatalf("\t%s\tError recording role changes: %+v", test.Failed, cs)
+	}
+	t.Logf("\t%s\tRole changes recorded", test.Success)
+}
+
 func TestAuthenticate(t *testing.T) {
 	claim, err := userService.Authenticate("admin", "Admin#1")
 	if err != nil {
@@ -2,35 +2,144 @@ package middleware
 
 import (
 	"errors"
+	"fmt"
 	"net/http"
 	"strings"
 
 	"github.com/axwilliams/book-api/internal/platform/auth"
 	"github.com/axwilliams/book-api/internal/platform/web"
+	"github.com/gorilla/mux"
 )
 
 var (
 	ErrAuthHeader = errors.New(("Wrong authorization header format"))
 	ErrDenied     = errors.New(("Permission denied"))
+	ErrRevoked    = errors.New("Token has been revoked")
 )
 
-func Authenticate(next http.Handler) http.Handler {
+// realm names the API in WWW-Authenticate challenges.
+const realm = "book-api"
+
+type Policy int
+
+const (
+	// PolicyAuthenticated requires a valid bearer token. Routes without an
+	// explicit policy fall back to this.
+	PolicyAuthenticated Policy = iota
+	// PolicyPublic lets anonymous requests through when the authenticator
+	// runs in public mode. A bearer token is still parsed when one is sent.
+	PolicyPublic
+	// PolicyAnonymous never looks at the Authorization header, e.g. for the
+	// endpoints that hand out tokens.
+	PolicyAnonymous
+)
+
+// Revocations reports whether any of the given token or session IDs was
+// revoked.
+type Revocations interface {
+	IsRevoked(ids ...string) bool
+}
+
+// APIKeys turns an API key into the claims of the user it acts for.
+type APIKeys interface {
+	Authenticate(key string) (auth.Claims, error)
+}
+
+type Authenticator struct {
+	public   bool
+	policies map[*mux.Route]Policy
+	revoked  Revocations
+	apiKeys  APIKeys
+}
+
+func NewAuthenticator(public bool) *Authenticator {
+	return &Authenticator{
+		public:   public,
+		policies: make(map[*mux.Route]Policy),
+	}
+}
+
+// Route sets the policy for a registered route and returns the route so it
+// can be used inline with HandleFunc.
+func (a *Authenticator) Route(route *mux.Route, p Policy) *mux.Route {
+	a.policies[route] = p
+	return route
+}
+
+// UseRevocations makes Authenticate refuse tokens whose jti or session is in
+// rv.
+func (a *Authenticator) UseRevocations(rv Revocations) {
+	a.revoked = rv
+}
+
+// UseAPIKeys makes Authenticate accept API keys, sent as
+// "Authorization: ApiKey <key>" or in an X-API-Key header.
+func (a *Authenticator) UseAPIKeys(ak APIKeys) {
+	a.apiKeys = ak
+}
+
+func (a *Authenticator) policy(r *http.Request) Policy {
+	route := mux.CurrentRoute(r)
+	if route == nil {
+		return PolicyAuthenticated
+	}
+
+	p := a.policies[route]
+	if p == PolicyPublic && !a.public {
+		return PolicyAuthenticated
+	}
+
+	return p
+}
+
+func (a *Authenticator) Authenticate(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		p := a.policy(r)
+
+		if p == PolicyAnonymous {
+			next.ServeHTTP(w, r)
+			return
+		}
 
-		if r.URL.Path == "/api/v1/users/token" {
+		header := r.Header.Get("Authorization")
+		key := r.Header.Get("X-API-Key")
+		if header == "" && key == "" && p == PolicyPublic {
 			next.ServeHTTP(w, r)
 			return
 		}
 
-		parts := strings.Split(r.Header.Get("Authorization"), " ")
+		parts := strings.Split(header, " ")
+		if key == "" && len(parts) == 2 && strings.ToLower(parts[0]) == "apikey" {
+			key = parts[1]
+		}
+
+		if key != "" && a.apiKeys != nil {
+			claims, err := a.apiKeys.Authenticate(key)
+			if err != nil {
+				if re, ok := err.(*web.RequestError); ok {
+					w.Header().Set("WWW-Authenticate", fmt.Sprintf("ApiKey realm=%q, error_description=%q", realm, re.Error()))
+				}
+				web.RespondError(w, err)
+				return
+			}
+
+			next.ServeHTTP(w, r.WithContext(auth.ContextWithUser(r.Context(), claims)))
+			return
+		}
+
 		if len(parts) != 2 || strings.ToLower(parts[0]) != "bearer" {
-			web.RespondError(w, web.NewRequestError(ErrAuthHeader, http.StatusBadRequest))
+			challenge(w, "invalid_request", web.NewRequestError(ErrAuthHeader, http.StatusBadRequest))
 			return
 		}
 
 		claims, err := auth.ParseWithClaims(parts[1])
 		if err != nil {
-			web.RespondError(w, err)
+			challenge(w, "invalid_token", err)
+			return
+		}
+
+		if a.revoked != nil && a.revoked.IsRevoked(claims.Id, claims.SessionID) {
+			challenge(w, "invalid_token", web.NewRequestError(ErrRevoked, http.StatusUnauthorized))
 			return
 		}
 
@@ -40,16 +149,40 @@ func Authenticate(next http.Handler) http.Handler {
 	})
 }
 
-func HasRole(next http.HandlerFunc, role string) http.HandlerFunc {
+// challenge responds with err and a Bearer challenge (RFC 6750) that tells
+// the client why its credentials were refused.
+func challenge(w http.ResponseWriter, code string, err error) {
+	if re, ok := err.(*web.RequestError); ok {
+		w.Header().Set("WWW-Authenticate", fmt.Sprintf("Bearer realm=%q, error=%q, error_description=%q", realm, code, re.Error()))
+	}
+	web.RespondError(w, err)
+}
+
+func HasRole(next http.HandlerFunc, roles ...string) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 
-		roles, ok := auth.RolesFromContext(r.Context())
+		has, ok := auth.RolesFromContext(r.Context())
 		if !ok {
 			web.RespondError(w, web.NewRequestError(ErrDenied, http.StatusForbidden))
 			return
 		}
 
-		if !auth.HasRole(roles, role) {
+		for _, role := range roles {
+			if auth.HasRole(has, role) {
+				next(w, r)
+				return
+			}
+		}
+
+		web.RespondError(w, web.NewRequestError(ErrDenied, http.StatusForbidden))
+	}
+}
+
+// RequirePermission lets a request through when it holds every one of
+// perms, whichever roles granted them.
+func RequirePermission(next http.HandlerFunc, perms ...string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !auth.Can(r.Context(), perms...) {
 			web.RespondError(w, web.NewRequestError(ErrDenied, http.StatusForbidden))
 			return
 		}
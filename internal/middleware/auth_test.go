@@ -0,0 +1,308 @@
+package middleware_test
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/axwilliams/book-api/internal/middleware"
+	"github.com/axwilliams/book-api/internal/platform/auth"
+	"github.com/axwilliams/book-api/internal/platform/web"
+	"github.com/axwilliams/book-api/internal/test"
+	"github.com/gorilla/mux"
+)
+
+func TestAuthenticatePolicies(t *testing.T) {
+	token, err := auth.CreateToken(auth.NewClaims("a72bec75-0a5f-49af-a844-5763d188788e", []string{auth.RoleAdmin}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ok := func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}
+
+	samples := []struct {
+		public     bool
+		method     string
+		path       string
+		token      string
+		statusCode int
+	}{
+		// Public route, public mode off
+		{public: false, method: "GET", path: "/books", statusCode: http.StatusBadRequest},
+		// Public route, public mode on
+		{public: true, method: "GET", path: "/books", statusCode: http.StatusOK},
+		// Public route with a token
+		{public: true, method: "GET", path: "/books", token: token, statusCode: http.StatusOK},
+		// Public route with a malformed token
+		{public: true, method: "GET", path: "/books", token: "bad", statusCode: http.StatusUnauthorized},
+		// Write on a public path
+		{public: true, method: "POST", path: "/books", statusCode: http.StatusBadRequest},
+		// Anonymous route
+		{public: false, method: "POST", path: "/users/token", statusCode: http.StatusOK},
+	}
+
+	for _, sample := range samples {
+		authn := middleware.NewAuthenticator(sample.public)
+
+		router := mux.NewRouter()
+		router.Use(authn.Authenticate)
+
+		authn.Route(router.HandleFunc("/books", ok).Methods("GET"), middleware.PolicyPublic)
+		router.HandleFunc("/books", ok).Methods("POST")
+		authn.Route(router.HandleFunc("/users/token", ok).Methods("POST"), middleware.PolicyAnonymous)
+
+		r, err := http.NewRequest(sample.method, sample.path, nil)
+		if err != nil {
+			t.Errorf("\t%s\tRequest failed: %v\n", test.Failed, err)
+		}
+
+		if sample.token != "" {
+			r.Header.Set("Authorization", "Bearer "+sample.token)
+		}
+
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, r)
+
+		if sample.statusCode != rr.Code {
+			t.Fatalf("\t%s\tWrong status code for %s %s: want %v got %v", test.Failed, sample.method, sample.path, sample.statusCode, rr.Code)
+		}
+		t.Logf("\t%s\tStatus code correct: %v", test.Success, rr.Code)
+	}
+}
+
+func TestRateLimit(t *testing.T) {
+	anonymous := middleware.NewRateLimiter(0.001, 2)
+
+	h := middleware.RateLimit(anonymous, nil)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	expected := []int{http.StatusOK, http.StatusOK, http.StatusTooManyRequests}
+
+	for _, statusCode := range expected {
+		r, err := http.NewRequest("GET", "/books", nil)
+		if err != nil {
+			t.Errorf("\t%s\tRequest failed: %v\n", test.Failed, err)
+		}
+		r.RemoteAddr = "192.0.2.1:1234"
+
+		rr := httptest.NewRecorder()
+		h.ServeHTTP(rr, r)
+
+		if statusCode != rr.Code {
+			t.Fatalf("\t%s\tWrong status code: want %v got %v", test.Failed, statusCode, rr.Code)
+		}
+		t.Logf("\t%s\tStatus code correct: %v", test.Success, rr.Code)
+	}
+
+	r, err := http.NewRequest("GET", "/books", nil)
+	if err != nil {
+		t.Errorf("\t%s\tRequest failed: %v\n", test.Failed, err)
+	}
+	r.RemoteAddr = "192.0.2.1:1234"
+	r = r.WithContext(auth.ContextWithUser(r.Context(), auth.Claims{UserID: "a72bec75-0a5f-49af-a844-5763d188788e"}))
+
+	rr := httptest.NewRecorder()
+	h.ServeHTTP(rr, r)
+
+	if rr.Code != http.StatusOK {
+		t.Fatalf("\t%s\tAuthenticated request limited: got %v", test.Failed, rr.Code)
+	}
+	t.Logf("\t%s\tAuthenticated request not limited", test.Success)
+}
+
+type revocations map[string]bool
+
+func (rv revocations) IsRevoked(ids ...string) bool {
+	for _, id := range ids {
+		if rv[id] {
+			return true
+		}
+	}
+	return false
+}
+
+func TestAuthenticateRevoked(t *testing.T) {
+	claims := auth.NewClaims("a72bec75-0a5f-49af-a844-5763d188788e", []string{auth.RoleAdmin})
+	claims.SessionID = "0e5b7f2c-3c1d-4b8e-9f6a-2d4c6e8a0b1c"
+
+	token, err := auth.CreateToken(claims)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	samples := []struct {
+		name       string
+		revoked    revocations
+		statusCode int
+	}{
+		{"Valid token", revocations{}, http.StatusOK},
+		{"Revoked token", revocations{claims.Id: true}, http.StatusUnauthorized},
+		{"Revoked session", revocations{claims.SessionID: true}, http.StatusUnauthorized},
+	}
+
+	for _, sample := range samples {
+		authn := middleware.NewAuthenticator(false)
+		authn.UseRevocations(sample.revoked)
+
+		router := mux.NewRouter()
+		router.Use(authn.Authenticate)
+		router.HandleFunc("/books", func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusOK)
+		}).Methods("POST")
+
+		r, err := http.NewRequest("POST", "/books", nil)
+		if err != nil {
+			t.Errorf("\t%s\tRequest failed: %v\n", test.Failed, err)
+		}
+		r.Header.Set("Authorization", "Bearer "+token)
+
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, r)
+
+		if sample.statusCode != rr.Code {
+			t.Fatalf("\t%s\t%s: want %v got %v", test.Failed, sample.name, sample.statusCode, rr.Code)
+		}
+		t.Logf("\t%s\t%s", test.Success, sample.name)
+	}
+}
+
+func TestAuthenticateChallenge(t *testing.T) {
+	claims := auth.NewClaims("a72bec75-0a5f-49af-a844-5763d188788e", []string{auth.RoleAdmin})
+	claims.ExpiresAt = time.Now().Add(-time.Hour).Unix()
+
+	token, err := auth.CreateToken(claims)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	authn := middleware.NewAuthenticator(false)
+	router := mux.NewRouter()
+	router.Use(authn.Authenticate)
+	router.HandleFunc("/books", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}).Methods("POST")
+
+	r, err := http.NewRequest("POST", "/books", nil)
+	if err != nil {
+		t.Errorf("\t%s\tRequest failed: %v\n", test.Failed, err)
+	}
+	r.Header.Set("Authorization", "Bearer "+token)
+
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, r)
+
+	expected := `Bearer realm="book-api", error="invalid_token", error_description="` + auth.ErrTokenExpired.Error() + `"`
+	if rr.Code != http.StatusUnauthorized || rr.Header().Get("WWW-Authenticate") != expected {
+		t.Fatalf("\t%s\tWrong challenge: %v %q", test.Failed, rr.Code, rr.Header().Get("WWW-Authenticate"))
+	}
+	t.Logf("\t%s\tExpired token challenged", test.Success)
+}
+
+type apiKeys map[string]string
+
+func (ak apiKeys) Authenticate(key string) (auth.Claims, error) {
+	userID, ok := ak[key]
+	if !ok {
+		return auth.Claims{}, web.NewRequestError(errors.New("API key is invalid or has been revoked"), http.StatusUnauthorized)
+	}
+	return auth.Claims{UserID: userID, Roles: []string{auth.RoleAuthor}}, nil
+}
+
+func TestAuthenticateAPIKey(t *testing.T) {
+	samples := []struct {
+		name       string
+		header     string
+		value      string
+		statusCode int
+	}{
+		{"Authorization header", "Authorization", "ApiKey bk_1234abcd_secret", http.StatusOK},
+		{"X-API-Key header", "X-API-Key", "bk_1234abcd_secret", http.StatusOK},
+		{"Unknown key", "X-API-Key", "bk_1234abcd_wrong", http.StatusUnauthorized},
+	}
+
+	for _, sample := range samples {
+		authn := middleware.NewAuthenticator(false)
+		authn.UseAPIKeys(apiKeys{"bk_1234abcd_secret": "69a47775-6d89-4d38-ad38-acdb2928f6a1"})
+
+		router := mux.NewRouter()
+		router.Use(authn.Authenticate)
+		router.HandleFunc("/books", middleware.HasRole(func(w http.ResponseWriter, r *http.Request) {
+			if id, _ := auth.UserFromContext(r.Context()); id != "69a47775-6d89-4d38-ad38-acdb2928f6a1" {
+				w.WriteHeader(http.StatusInternalServerError)
+				return
+			}
+			w.WriteHeader(http.StatusOK)
+		}, auth.RoleAuthor)).Methods("POST")
+
+		r, err := http.NewRequest("POST", "/books", nil)
+		if err != nil {
+			t.Errorf("\t%s\tRequest failed: %v\n", test.Failed, err)
+		}
+		r.Header.Set(sample.header, sample.value)
+
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, r)
+
+		if sample.statusCode != rr.Code {
+			t.Fatalf("\t%s\t%s: want %v got %v", test.Failed, sample.name, sample.statusCode, rr.Code)
+		}
+		if rr.Code == http.StatusUnauthorized && !strings.HasPrefix(rr.Header().Get("WWW-Authenticate"), "ApiKey ") {
+			t.Fatalf("\t%s\t%s: wrong challenge %q", test.Failed, sample.name, rr.Header().Get("WWW-Authenticate"))
+		}
+		t.Logf("\t%s\t%s", test.Success, sample.name)
+	}
+}
+
+func TestRequirePermission(t *testing.T) {
+	author := auth.NewClaims("69a47775-6d89-4d38-ad38-acdb2928f6a1", []string{auth.RoleAuthor})
+
+	// Permissions the roles no longer grant are dropped, those the token
+	// never carried are not added.
+	stale := author
+	stale.Permissions = []string{auth.PermBooksWrite, auth.PermUsersManage}
+
+	legacy := author
+	legacy.Permissions = nil
+
+	samples := []struct {
+		name       string
+		claims     *auth.Claims
+		perms      []string
+		statusCode int
+	}{
+		{"No token", nil, []string{auth.PermBooksWrite}, http.StatusForbidden},
+		{"Granted", &author, []string{auth.PermBooksWrite, auth.PermBooksExport}, http.StatusOK},
+		{"One of two", &author, []string{auth.PermBooksWrite, auth.PermBooksReview}, http.StatusForbidden},
+		{"No longer granted", &stale, []string{auth.PermUsersManage}, http.StatusForbidden},
+		{"Not in the token", &stale, []string{auth.PermBooksExport}, http.StatusForbidden},
+		{"Token without permissions", &legacy, []string{auth.PermBooksExport}, http.StatusOK},
+	}
+
+	for _, sample := range samples {
+		h := middleware.RequirePermission(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusOK)
+		}, sample.perms...)
+
+		r, err := http.NewRequest("GET", "/books/export", nil)
+		if err != nil {
+			t.Errorf("\t%s\tRequest failed: %v\n", test.Failed, err)
+		}
+		if sample.claims != nil {
+			r = r.WithContext(auth.ContextWithUser(r.Context(), *sample.claims))
+		}
+
+		rr := httptest.NewRecorder()
+		h.ServeHTTP(rr, r)
+
+		if sample.statusCode != rr.Code {
+			t.Fatalf("\t%s\t%s: want %v got %v", test.Failed, sample.name, sample.statusCode, rr.Code)
+		}
+		t.Logf("\t%s\t%s", test.Success, sample.name)
+	}
+}
@@ -0,0 +1,58 @@
+package middleware_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/axwilliams/book-api/internal/middleware"
+	"github.com/axwilliams/book-api/internal/test"
+	"github.com/gorilla/mux"
+)
+
+func TestCORS(t *testing.T) {
+	authn := middleware.NewAuthenticator(false)
+
+	router := mux.NewRouter()
+	router.Use(authn.Authenticate)
+	router.HandleFunc("/books", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}).Methods("GET")
+
+	handler := middleware.CORS([]string{"https://library.example.org"})(router)
+
+	samples := []struct {
+		name       string
+		method     string
+		origin     string
+		preflight  bool
+		statusCode int
+		allowed    bool
+	}{
+		{"Preflight", "OPTIONS", "https://library.example.org", true, http.StatusNoContent, true},
+		{"Rejected request", "GET", "https://library.example.org", false, http.StatusBadRequest, true},
+		{"Other origin", "GET", "https://elsewhere.example.org", false, http.StatusBadRequest, false},
+	}
+
+	for _, sample := range samples {
+		r, err := http.NewRequest(sample.method, "/books", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		r.Header.Set("Origin", sample.origin)
+		if sample.preflight {
+			r.Header.Set("Access-Control-Request-Method", "GET")
+		}
+
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, r)
+
+		if rr.Code != sample.statusCode {
+			t.Fatalf("\t%s\t%s: wrong status code: want %v got %v", test.Failed, sample.name, sample.statusCode, rr.Code)
+		}
+		if got := rr.Header().Get("Access-Control-Allow-Origin") == sample.origin; got != sample.allowed {
+			t.Fatalf("\t%s\t%s: wrong Access-Control-Allow-Origin: %q", test.Failed, sample.name, rr.Header().Get("Access-Control-Allow-Origin"))
+		}
+		t.Logf("\t%s\t%s", test.Success, sample.name)
+	}
+}
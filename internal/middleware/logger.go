@@ -24,8 +24,7 @@ func Logger(next http.Handler) http.Handler {
 
 		UserID, ok := auth.UserFromContext(r.Context())
 		if !ok {
-			next.ServeHTTP(w, r)
-			return
+			UserID = "anonymous"
 		}
 
 		rw := &loggingResponseWriter{
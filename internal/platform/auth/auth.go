@@ -2,60 +2,147 @@ package auth
 
 import (
 	"errors"
-	"fmt"
 	"net/http"
-	"os"
+	"sync"
 	"time"
 
 	"github.com/axwilliams/book-api/internal/platform/web"
 	"github.com/dgrijalva/jwt-go"
+	"github.com/google/uuid"
 )
 
-var ErrInvalidToken = errors.New("Invalid token")
+// TokenLifetime is how long an access token is valid for.
+const TokenLifetime = time.Hour
 
+var (
+	ErrInvalidToken     = errors.New("Token signature is invalid")
+	ErrTokenMalformed   = errors.New("Token is malformed")
+	ErrTokenExpired     = errors.New("Token has expired")
+	ErrTokenNotYetValid = errors.New("Token is not valid yet")
+	ErrTokenIssuer      = errors.New("Token was issued by an unknown issuer")
+	ErrTokenAudience    = errors.New("Token is meant for another audience")
+)
+
+// Config sets the issuer and audience of new tokens, which ParseWithClaims
+// then requires, and how far clocks may drift apart. An empty Issuer or
+// Audience is neither set nor checked.
+type Config struct {
+	Issuer   string
+	Audience string
+	Leeway   time.Duration
+}
+
+var (
+	configMu sync.RWMutex
+	config   Config
+)
+
+// Leeway is how long after they expire tokens are still accepted.
+// Revocations have to be kept as long.
+func Leeway() time.Duration {
+	return currentConfig().Leeway
+}
+
+// Configure sets the Config used by NewClaims and ParseWithClaims.
+func Configure(c Config) {
+	configMu.Lock()
+	defer configMu.Unlock()
+
+	config = c
+}
+
+func currentConfig() Config {
+	configMu.RLock()
+	defer configMu.RUnlock()
+
+	return config
+}
+
+// Claims identify a token by its jti (StandardClaims.Id) and, for tokens
+// issued with a refresh token, the login it belongs to, so that either can
+// be revoked before the token expires. The user is named in both sub and
+// userid; userid stays for clients written before sub was set. Tokens issued
+// through OAuth name their client and the scope granted to it. Permissions
+// are those the roles granted when the token was issued. APIKeyID is only
+// set for requests made with an API key and never goes into a token.
 type Claims struct {
-	UserID string   `json:"userid"`
-	Roles  []string `json:"roles"`
+	UserID      string   `json:"userid"`
+	Roles       []string `json:"roles"`
+	Permissions []string `json:"permissions,omitempty"`
+	SessionID   string   `json:"sid,omitempty"`
+	ClientID    string   `json:"client_id,omitempty"`
+	Scope       string   `json:"scope,omitempty"`
+	APIKeyID    string   `json:"-"`
 	jwt.StandardClaims
 }
 
 func NewClaims(userid string, roles []string) Claims {
+	cfg := currentConfig()
+	now := time.Now()
+
 	c := Claims{
-		UserID: userid,
-		Roles:  roles,
+		UserID:      userid,
+		Roles:       roles,
+		Permissions: PermissionsFor(roles),
 		StandardClaims: jwt.StandardClaims{
-			IssuedAt:  time.Now().Unix(),
-			ExpiresAt: time.Now().Add(time.Hour * 1).Unix(),
+			Id:        uuid.New().String(),
+			Subject:   userid,
+			Issuer:    cfg.Issuer,
+			Audience:  cfg.Audience,
+			IssuedAt:  now.Unix(),
+			NotBefore: now.Unix(),
+			ExpiresAt: now.Add(TokenLifetime).Unix(),
 		},
 	}
 
 	return c
 }
 
-func CreateToken(claims Claims) (string, error) {
-	tkn := jwt.NewWithClaims(jwt.GetSigningMethod("HS256"), claims)
+// validate checks the time, issuer and audience claims against cfg, and
+// fills in UserID from sub for tokens that only carry the latter. Tokens
+// without an expiry are refused, as they would be valid forever.
+func (c *Claims) validate(cfg Config, now time.Time) error {
+	leeway := int64(cfg.Leeway / time.Second)
+	unix := now.Unix()
 
-	str, err := tkn.SignedString([]byte(os.Getenv("API_KEY")))
-	if err != nil {
-		return "", fmt.Errorf("generating token: %w", err)
+	switch {
+	case c.Subject != "" && c.UserID != "" && c.Subject != c.UserID:
+		return ErrTokenMalformed
+	case c.ExpiresAt == 0:
+		return ErrTokenMalformed
+	case unix > c.ExpiresAt+leeway:
+		return ErrTokenExpired
+	case c.NotBefore != 0 && unix < c.NotBefore-leeway:
+		return ErrTokenNotYetValid
+	case c.IssuedAt != 0 && unix < c.IssuedAt-leeway:
+		return ErrTokenNotYetValid
+	case cfg.Issuer != "" && c.Issuer != cfg.Issuer:
+		return ErrTokenIssuer
+	case cfg.Audience != "" && c.Audience != cfg.Audience:
+		return ErrTokenAudience
 	}
 
-	return str, nil
+	if c.UserID == "" {
+		c.UserID = c.Subject
+	}
+	return nil
 }
 
-func ParseWithClaims(tokenStr string) (Claims, error) {
-	claims := Claims{}
-
-	token, err := jwt.ParseWithClaims(tokenStr, &claims, func(t *jwt.Token) (interface{}, error) {
-		return []byte(os.Getenv("API_KEY")), nil
-	})
+// CreateToken signs claims with the key set by UseKeys.
+func CreateToken(claims Claims) (string, error) {
+	return currentKeys().Sign(claims)
+}
 
-	if err != nil {
-		return Claims{}, web.NewRequestError(ErrInvalidToken, http.StatusBadRequest)
+// ParseWithClaims verifies a token with the keys set by UseKeys and
+// validates its claims. Every failure is a 401 whose error names the
+// reason.
+func ParseWithClaims(tokenStr string) (Claims, error) {
+	claims, err := currentKeys().Parse(tokenStr)
+	if err == nil {
+		err = claims.validate(currentConfig(), time.Now())
 	}
-
-	if !token.Valid {
-		return Claims{}, web.NewRequestError(ErrInvalidToken, http.StatusBadRequest)
+	if err != nil {
+		return Claims{}, web.NewRequestError(err, http.StatusUnauthorized)
 	}
 
 	return claims, nil
@@ -2,18 +2,18 @@ package auth_test
 
 import (
 	"context"
+	"net/http"
 	"reflect"
 	"testing"
+	"time"
 
 	"github.com/axwilliams/book-api/internal/platform/auth"
+	"github.com/axwilliams/book-api/internal/platform/web"
 	"github.com/axwilliams/book-api/internal/test"
 )
 
 func TestClaims(t *testing.T) {
-	claim := auth.Claims{
-		UserID: "a72bec75-0a5f-49af-a844-5763d188788e",
-		Roles:  []string{auth.RoleAdmin},
-	}
+	claim := auth.NewClaims("a72bec75-0a5f-49af-a844-5763d188788e", []string{auth.RoleAdmin})
 
 	token, err := auth.CreateToken(claim)
 	if err != nil {
@@ -133,3 +133,66 @@ func TestHasRole(t *testing.T) {
 		t.Logf("\t%s\tRole check sucess", test.Success)
 	}
 }
+
+func TestValidation(t *testing.T) {
+	auth.Configure(auth.Config{Issuer: "https://books.example.org", Audience: "book-api", Leeway: 30 * time.Second})
+	defer auth.Configure(auth.Config{})
+
+	const userID = "a72bec75-0a5f-49af-a844-5763d188788e"
+	now := time.Now()
+
+	claims := func(change func(c *auth.Claims)) string {
+		c := auth.NewClaims(userID, []string{auth.RoleAdmin})
+		change(&c)
+
+		token, err := auth.CreateToken(c)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return token
+	}
+
+	samples := []struct {
+		name     string
+		token    string
+		expected error
+	}{
+		{"Valid", claims(func(c *auth.Claims) {}), nil},
+		{"Expired", claims(func(c *auth.Claims) { c.ExpiresAt = now.Add(-time.Minute).Unix() }), auth.ErrTokenExpired},
+		{"Expired within leeway", claims(func(c *auth.Claims) { c.ExpiresAt = now.Add(-10 * time.Second).Unix() }), nil},
+		{"No expiry", claims(func(c *auth.Claims) { c.ExpiresAt = 0 }), auth.ErrTokenMalformed},
+		{"Not valid yet", claims(func(c *auth.Claims) { c.NotBefore = now.Add(time.Minute).Unix() }), auth.ErrTokenNotYetValid},
+		{"Issued by a fast clock", claims(func(c *auth.Claims) { c.IssuedAt = now.Add(10 * time.Second).Unix() }), nil},
+		{"Wrong issuer", claims(func(c *auth.Claims) { c.Issuer = "https://evil.example.org" }), auth.ErrTokenIssuer},
+		{"Wrong audience", claims(func(c *auth.Claims) { c.Audience = "search-api" }), auth.ErrTokenAudience},
+		{"Subject differs from userid", claims(func(c *auth.Claims) { c.Subject = "bad069ce-4afa-4a53-a673-14ae7b627d06" }), auth.ErrTokenMalformed},
+		{"Subject only", claims(func(c *auth.Claims) { c.UserID = "" }), nil},
+		{"Malformed", "not.a.token", auth.ErrTokenMalformed},
+		{"Truncated", claims(func(c *auth.Claims) {})[:20] + "x", auth.ErrTokenMalformed},
+	}
+
+	for _, sample := range samples {
+		c, err := auth.ParseWithClaims(sample.token)
+
+		if sample.expected == nil {
+			if err != nil || c.UserID != userID || c.Subject != userID {
+				t.Fatalf("\t%s\t%s: rejected: %v %+v", test.Failed, sample.name, err, c)
+			}
+			t.Logf("\t%s\t%s accepted", test.Success, sample.name)
+			continue
+		}
+
+		re, ok := err.(*web.RequestError)
+		if !ok || re.Status != http.StatusUnauthorized || re.Err != sample.expected {
+			t.Fatalf("\t%s\t%s: want %v got %v", test.Failed, sample.name, sample.expected, err)
+		}
+		t.Logf("\t%s\t%s rejected: %v", test.Success, sample.name, err)
+	}
+
+	token := claims(func(c *auth.Claims) {})
+	forged := token[:len(token)-6] + "AAAAAA"
+	if _, err := auth.ParseWithClaims(forged); err == nil || err.(*web.RequestError).Err != auth.ErrInvalidToken {
+		t.Fatalf("\t%s\tForged signature: want %v got %v", test.Failed, auth.ErrInvalidToken, err)
+	}
+	t.Logf("\t%s\tForged signature rejected", test.Success)
+}
@@ -0,0 +1,360 @@
+package auth
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/dgrijalva/jwt-go"
+)
+
+const (
+	AlgHS256 = "HS256"
+	AlgRS256 = "RS256"
+	AlgES256 = "ES256"
+	AlgEdDSA = "EdDSA"
+)
+
+// minRSABits is the smallest RSA key accepted for RS256.
+const minRSABits = 2048
+
+// DefaultAlgorithms are accepted when no allow-list is configured. HS256 is
+// left out: anyone who can verify a token signed with a shared secret can
+// also sign one.
+var DefaultAlgorithms = []string{AlgRS256, AlgES256, AlgEdDSA}
+
+var (
+	ErrNoSigningKey   = errors.New("No signing key")
+	ErrUnknownKey     = errors.New("Unknown key")
+	ErrKeyAlgorithm   = errors.New("Key algorithm not allowed")
+	ErrUnsupportedKey = errors.New("Unsupported key type")
+)
+
+// Key is one signing key. Keys without a private part only verify, e.g. a
+// retired key kept until the last token it signed has expired.
+type Key struct {
+	ID        string
+	Algorithm string
+	private   interface{}
+	public    interface{}
+}
+
+// NewHMACKey returns a shared secret key for HS256.
+func NewHMACKey(kid string, secret []byte) *Key {
+	return &Key{
+		ID:        kid,
+		Algorithm: AlgHS256,
+		private:   secret,
+		public:    secret,
+	}
+}
+
+// CanSign reports whether the key has a private part.
+func (k *Key) CanSign() bool {
+	return k.private != nil
+}
+
+// ParseKey reads the first key in PEM data. Private keys may be PKCS #8,
+// PKCS #1 (RSA) or SEC 1 (EC); public keys PKIX or PKCS #1. The algorithm
+// follows from the key type: RSA signs RS256, P-256 ES256 and Ed25519
+// EdDSA.
+func ParseKey(kid string, data []byte) (*Key, error) {
+	for {
+		var block *pem.Block
+		block, data = pem.Decode(data)
+		if block == nil {
+			return nil, fmt.Errorf("Parsing key %s: no PEM key found", kid)
+		}
+
+		var key interface{}
+		var err error
+
+		switch block.Type {
+		case "PRIVATE KEY":
+			key, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+		case "RSA PRIVATE KEY":
+			key, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+		case "EC PRIVATE KEY":
+			key, err = x509.ParseECPrivateKey(block.Bytes)
+		case "PUBLIC KEY":
+			key, err = x509.ParsePKIXPublicKey(block.Bytes)
+		case "RSA PUBLIC KEY":
+			key, err = x509.ParsePKCS1PublicKey(block.Bytes)
+		default:
+			// e.g. the EC PARAMETERS block openssl writes before an EC key
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("Parsing key %s: %w", kid, err)
+		}
+
+		k, err := newKey(kid, key)
+		if err != nil {
+			return nil, fmt.Errorf("Parsing key %s: %w", kid, err)
+		}
+		return k, nil
+	}
+}
+
+func newKey(kid string, key interface{}) (*Key, error) {
+	k := &Key{ID: kid}
+
+	switch key := key.(type) {
+	case *rsa.PrivateKey:
+		k.Algorithm, k.private, k.public = AlgRS256, key, &key.PublicKey
+	case *rsa.PublicKey:
+		k.Algorithm, k.public = AlgRS256, key
+	case *ecdsa.PrivateKey:
+		k.Algorithm, k.private, k.public = AlgES256, key, &key.PublicKey
+	case *ecdsa.PublicKey:
+		k.Algorithm, k.public = AlgES256, key
+	case ed25519.PrivateKey:
+		k.Algorithm, k.private, k.public = AlgEdDSA, key, key.Public()
+	case ed25519.PublicKey:
+		k.Algorithm, k.public = AlgEdDSA, key
+	default:
+		return nil, ErrUnsupportedKey
+	}
+
+	switch pub := k.public.(type) {
+	case *rsa.PublicKey:
+		if pub.N.BitLen() < minRSABits {
+			return nil, fmt.Errorf("RSA keys need at least %d bits", minRSABits)
+		}
+	case *ecdsa.PublicKey:
+		if pub.Curve != elliptic.P256() {
+			return nil, errors.New("ES256 needs a P-256 key")
+		}
+	}
+
+	return k, nil
+}
+
+// KeyManager signs tokens with one key and verifies them with any of its
+// keys, picked by the kid header. A token is only accepted when its alg is
+// on the allow-list and matches the algorithm of the key it names, so a
+// public key can never be used as an HMAC secret.
+type KeyManager struct {
+	allowed map[string]bool
+
+	mu      sync.RWMutex
+	keys    map[string]*Key
+	signing *Key
+}
+
+// NewKeyManager returns an empty manager that accepts the given
+// algorithms.
+func NewKeyManager(allowed []string) *KeyManager {
+	km := &KeyManager{
+		allowed: map[string]bool{},
+		keys:    map[string]*Key{},
+	}
+	for _, alg := range allowed {
+		km.allowed[alg] = true
+	}
+	return km
+}
+
+// NewHMACKeyManager signs and verifies HS256 with one shared secret, the way
+// tokens were handled before asymmetric keys.
+func NewHMACKeyManager(secret []byte) *KeyManager {
+	km := NewKeyManager([]string{AlgHS256})
+	km.keys[""] = NewHMACKey("", secret)
+	km.signing = km.keys[""]
+	return km
+}
+
+// Load replaces the keys with the *.pem files in dir, each named after its
+// kid, and signs with signingKID from then on. signingKID may be empty when
+// dir holds exactly one private key. On error the current keys stay in use,
+// so a bad reload does not lock anyone out.
+func (km *KeyManager) Load(dir, signingKID string) error {
+	paths, err := filepath.Glob(filepath.Join(dir, "*.pem"))
+	if err != nil {
+		return fmt.Errorf("Listing keys: %w", err)
+	}
+
+	keys := make([]*Key, 0, len(paths))
+	for _, path := range paths {
+		data, err := ioutil.ReadFile(path)
+		if err != nil {
+			return fmt.Errorf("Reading key: %w", err)
+		}
+
+		k, err := ParseKey(strings.TrimSuffix(filepath.Base(path), ".pem"), data)
+		if err != nil {
+			return err
+		}
+		keys = append(keys, k)
+	}
+
+	return km.SetKeys(keys, signingKID)
+}
+
+// SetKeys replaces the keys in one step, so that requests in flight see
+// either the old or the new set.
+func (km *KeyManager) SetKeys(keys []*Key, signingKID string) error {
+	set := make(map[string]*Key, len(keys))
+	var signers []*Key
+
+	for _, k := range keys {
+		if !km.allowed[k.Algorithm] {
+			return fmt.Errorf("%w: %s uses %s", ErrKeyAlgorithm, k.ID, k.Algorithm)
+		}
+		if _, ok := set[k.ID]; ok {
+			return fmt.Errorf("Duplicate key %s", k.ID)
+		}
+		set[k.ID] = k
+		if k.CanSign() {
+			signers = append(signers, k)
+		}
+	}
+
+	var signing *Key
+	switch {
+	case signingKID != "":
+		signing = set[signingKID]
+	case len(signers) == 1:
+		signing = signers[0]
+	}
+	if signing == nil || !signing.CanSign() {
+		return fmt.Errorf("%w: %q", ErrNoSigningKey, signingKID)
+	}
+
+	km.mu.Lock()
+	defer km.mu.Unlock()
+
+	km.keys = set
+	km.signing = signing
+	return nil
+}
+
+// SigningKey returns the ID of the key new tokens are signed with.
+func (km *KeyManager) SigningKey() string {
+	km.mu.RLock()
+	defer km.mu.RUnlock()
+
+	if km.signing == nil {
+		return ""
+	}
+	return km.signing.ID
+}
+
+// Keys returns the keys sorted by ID.
+func (km *KeyManager) Keys() []*Key {
+	km.mu.RLock()
+	defer km.mu.RUnlock()
+
+	keys := make([]*Key, 0, len(km.keys))
+	for _, k := range km.keys {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		return keys[i].ID < keys[j].ID
+	})
+	return keys
+}
+
+// Sign signs claims with the current signing key and names it in the kid
+// header.
+func (km *KeyManager) Sign(claims Claims) (string, error) {
+	km.mu.RLock()
+	k := km.signing
+	km.mu.RUnlock()
+
+	if k == nil {
+		return "", ErrNoSigningKey
+	}
+
+	tkn := jwt.NewWithClaims(jwt.GetSigningMethod(k.Algorithm), claims)
+	if k.ID != "" {
+		tkn.Header["kid"] = k.ID
+	}
+
+	str, err := tkn.SignedString(k.private)
+	if err != nil {
+		return "", fmt.Errorf("generating token: %w", err)
+	}
+
+	return str, nil
+}
+
+// Parse checks the signature of a token and returns its claims. The claims
+// themselves are validated by ParseWithClaims.
+func (km *KeyManager) Parse(tokenStr string) (Claims, error) {
+	methods := make([]string, 0, len(km.allowed))
+	for alg := range km.allowed {
+		methods = append(methods, alg)
+	}
+
+	claims := Claims{}
+	parser := jwt.Parser{ValidMethods: methods, SkipClaimsValidation: true}
+
+	token, err := parser.ParseWithClaims(tokenStr, &claims, func(t *jwt.Token) (interface{}, error) {
+		kid, _ := t.Header["kid"].(string)
+
+		km.mu.RLock()
+		k, ok := km.keys[kid]
+		km.mu.RUnlock()
+
+		switch {
+		case !ok:
+			return nil, ErrUnknownKey
+		case t.Method.Alg() != k.Algorithm:
+			return nil, ErrKeyAlgorithm
+		}
+		return k.public, nil
+	})
+	if ve, ok := err.(*jwt.ValidationError); ok && ve.Errors&jwt.ValidationErrorMalformed != 0 {
+		return Claims{}, ErrTokenMalformed
+	}
+	if err != nil || !token.Valid {
+		return Claims{}, ErrInvalidToken
+	}
+
+	return claims, nil
+}
+
+var (
+	keysMu sync.RWMutex
+	keys   *KeyManager
+)
+
+// UseKeys makes CreateToken and ParseWithClaims use km.
+func UseKeys(km *KeyManager) {
+	keysMu.Lock()
+	defer keysMu.Unlock()
+
+	keys = km
+}
+
+// currentKeys falls back to HS256 with the API_KEY secret, read once, when
+// UseKeys was not called.
+func currentKeys() *KeyManager {
+	keysMu.RLock()
+	km := keys
+	keysMu.RUnlock()
+
+	if km != nil {
+		return km
+	}
+
+	keysMu.Lock()
+	defer keysMu.Unlock()
+
+	if keys == nil {
+		keys = NewHMACKeyManager([]byte(os.Getenv("API_KEY")))
+	}
+	return keys
+}
@@ -0,0 +1,155 @@
+package auth
+
+import (
+	"context"
+	"sort"
+	"sync"
+)
+
+// Permissions name what a request may do. Roles are sets of them.
+const (
+	PermBooksWrite    = "books:write"
+	PermBooksDrafts   = "books:drafts"
+	PermBooksExport   = "books:export"
+	PermBooksHistory  = "books:history"
+	PermBooksReview   = "books:review"
+	PermBooksCurate   = "books:curate"
+	PermTagsWrite     = "tags:write"
+	PermTagsManage    = "tags:manage"
+	PermLabelsPrint   = "labels:print"
+	PermImportsManage = "imports:manage"
+	PermUsersManage   = "users:manage"
+	PermAPIKeysManage = "apikeys:manage"
+	PermClientsManage = "clients:manage"
+	PermRolesManage   = "roles:manage"
+	PermPolicies      = "policies:explain"
+)
+
+// Permissions describes every permission.
+var Permissions = map[string]string{
+	PermBooksWrite:    "Create, edit, import and delete books and series",
+	PermBooksDrafts:   "See books that are not published",
+	PermBooksExport:   "Export books",
+	PermBooksHistory:  "See the history of a book",
+	PermBooksReview:   "Approve and reject submitted books",
+	PermBooksCurate:   "Relate, merge and deduplicate books",
+	PermTagsWrite:     "Tag books and remove the tags you added",
+	PermTagsManage:    "Edit, merge and remove any tag",
+	PermLabelsPrint:   "Print labels",
+	PermImportsManage: "See every import job",
+	PermUsersManage:   "Create, edit and delete users",
+	PermAPIKeysManage: "Create and revoke API keys",
+	PermClientsManage: "Register OAuth clients",
+	PermRolesManage:   "Define roles",
+	PermPolicies:      "See access policies and explain their decisions",
+}
+
+// DefaultRoles returns the permissions of the built-in roles. ADMIN holds
+// every permission.
+func DefaultRoles() map[string][]string {
+	all := make([]string, 0, len(Permissions))
+	for p := range Permissions {
+		all = append(all, p)
+	}
+	sort.Strings(all)
+
+	return map[string][]string{
+		RoleAdmin:   all,
+		RoleAuthor:  {PermBooksDrafts, PermBooksExport, PermBooksHistory, PermBooksWrite, PermLabelsPrint, PermTagsWrite},
+		RoleCurator: {PermTagsManage, PermTagsWrite},
+	}
+}
+
+// PermissionResolver turns roles into the permissions they grant.
+type PermissionResolver interface {
+	Permissions(roles []string) []string
+}
+
+type staticRoles map[string][]string
+
+func (sr staticRoles) Permissions(roles []string) []string {
+	set := map[string]bool{}
+	for _, r := range roles {
+		for _, p := range sr[r] {
+			set[p] = true
+		}
+	}
+
+	perms := make([]string, 0, len(set))
+	for p := range set {
+		perms = append(perms, p)
+	}
+	sort.Strings(perms)
+	return perms
+}
+
+var (
+	resolverMu sync.RWMutex
+	resolver   PermissionResolver = staticRoles(DefaultRoles())
+)
+
+// UsePermissions makes NewClaims and PermissionsFromContext resolve roles
+// with r instead of the built-in roles.
+func UsePermissions(r PermissionResolver) {
+	resolverMu.Lock()
+	defer resolverMu.Unlock()
+
+	resolver = r
+}
+
+// PermissionsFor returns the permissions roles grant.
+func PermissionsFor(roles []string) []string {
+	resolverMu.RLock()
+	r := resolver
+	resolverMu.RUnlock()
+
+	return r.Permissions(roles)
+}
+
+// PermissionsFromContext returns the permissions of the request: those the
+// token carries that its roles still grant. A permission taken away from a
+// role is lost at once, one added to it with the next token. Tokens issued
+// before tokens carried permissions get whatever their roles grant.
+func PermissionsFromContext(ctx context.Context) ([]string, bool) {
+	claims, ok := ClaimsFromContext(ctx)
+	if !ok {
+		return nil, false
+	}
+
+	granted := PermissionsFor(claims.Roles)
+	if claims.Permissions == nil {
+		return granted, true
+	}
+
+	perms := []string{}
+	for _, p := range claims.Permissions {
+		if HasPermission(granted, p) {
+			perms = append(perms, p)
+		}
+	}
+	return perms, true
+}
+
+// Can reports whether the request holds every one of perms.
+func Can(ctx context.Context, perms ...string) bool {
+	has, ok := PermissionsFromContext(ctx)
+	if !ok {
+		return false
+	}
+
+	for _, p := range perms {
+		if !HasPermission(has, p) {
+			return false
+		}
+	}
+	return true
+}
+
+func HasPermission(perms []string, wanted string) bool {
+	for _, has := range perms {
+		if has == wanted {
+			return true
+		}
+	}
+	return false
+}
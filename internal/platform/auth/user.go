@@ -5,21 +5,31 @@ import (
 )
 
 const (
-	RoleAdmin  = "ADMIN"
-	RoleAuthor = "AUTHOR"
+	RoleAdmin   = "ADMIN"
+	RoleAuthor  = "AUTHOR"
+	RoleCurator = "CURATOR"
 )
 
 type ctxKey int
 
 const userKey ctxKey = 0
 const rolesKey ctxKey = 1
+const claimsKey ctxKey = 2
 
 func ContextWithUser(ctx context.Context, claims Claims) context.Context {
 	ctx = context.WithValue(ctx, userKey, claims.UserID)
 	ctx = context.WithValue(ctx, rolesKey, claims.Roles)
+	ctx = context.WithValue(ctx, claimsKey, claims)
 	return ctx
 }
 
+// ClaimsFromContext returns all claims of the token the request was made
+// with, e.g. to revoke it on logout.
+func ClaimsFromContext(ctx context.Context) (Claims, bool) {
+	claims, ok := ctx.Value(claimsKey).(Claims)
+	return claims, ok
+}
+
 func UserFromContext(ctx context.Context) (string, bool) {
 	id, ok := ctx.Value(userKey).(string)
 	return id, ok
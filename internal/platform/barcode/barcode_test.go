@@ -0,0 +1,252 @@
+package barcode
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/axwilliams/book-api/internal/test"
+)
+
+func TestEAN13(t *testing.T) {
+	samples := []struct {
+		code   string
+		digits string
+		err    error
+	}{
+		{"978024137257", "9780241372579", nil},
+		{"9780241372579", "9780241372579", nil},
+		{"9780241372578", "", ErrInvalidEAN},
+		{"978-0241372579", "", ErrInvalidEAN},
+		{"12345", "", ErrInvalidEAN},
+	}
+
+	for _, sample := range samples {
+		e, err := NewEAN13(sample.code)
+		if err != sample.err {
+			t.Fatalf("\t%s\tWrong error for %s: %v", test.Failed, sample.code, err)
+		}
+		if err == nil && e.Digits != sample.digits {
+			t.Fatalf("\t%s\tWrong digits for %s: %s", test.Failed, sample.code, e.Digits)
+		}
+	}
+	t.Logf("\t%s\tCheck digits added and verified", test.Success)
+
+	e, _ := NewEAN13("4006381333931")
+
+	var b strings.Builder
+	for _, m := range e.Modules {
+		if m {
+			b.WriteByte('1')
+		} else {
+			b.WriteByte('0')
+		}
+	}
+
+	// 4 selects LGLLGG for the left half.
+	expected := "101" + "0001101" + "0100111" + "0101111" + "0111101" + "0001001" + "0110011" +
+		"01010" + "1000010" + "1000010" + "1000010" + "1110100" + "1000010" + "1100110" + "101"
+	if b.String() != expected {
+		t.Fatalf("\t%s\tWrong modules: want %s got %s", test.Failed, expected, b.String())
+	}
+	t.Logf("\t%s\tModules encoded", test.Success)
+
+	img := e.Image(2)
+	if img.Bounds().Dx() != EANWidth*2 || img.Bounds().Dy() != EANHeight*2 {
+		t.Fatalf("\t%s\tWrong image size: %v", test.Failed, img.Bounds())
+	}
+	if img.GrayAt(EANQuietLeft*2, 0).Y != 0 || img.GrayAt((EANQuietLeft+1)*2, 0).Y != 0xff {
+		t.Fatalf("\t%s\tStart guard not drawn", test.Failed)
+	}
+	if !bytes.Contains(e.SVG(), []byte(`<rect x="11" y="0" width="1" height="65"/>`)) {
+		t.Fatalf("\t%s\tStart guard missing from SVG", test.Failed)
+	}
+	t.Logf("\t%s\tSymbol rendered", test.Success)
+}
+
+func TestReedSolomon(t *testing.T) {
+	// Version 1-M "HELLO WORLD" from the standard's worked example.
+	data := []byte{32, 91, 11, 120, 209, 114, 220, 77, 67, 64, 236, 17, 236, 17, 236, 17}
+	expected := []byte{196, 35, 39, 119, 235, 215, 231, 226, 93, 23}
+
+	if ecc := rsRemainder(data, rsDivisor(10)); !reflect.DeepEqual(ecc, expected) {
+		t.Fatalf("\t%s\tWrong error correction: want %v got %v", test.Failed, expected, ecc)
+	}
+	t.Logf("\t%s\tError correction codewords computed", test.Success)
+}
+
+func TestQRTables(t *testing.T) {
+	capacity := map[int]int{1: 16, 7: 124, 10: 216, 40: 2334}
+	for v, n := range capacity {
+		if got := qrDataCodewords(v); got != n {
+			t.Fatalf("\t%s\tWrong capacity of version %d: want %d got %d", test.Failed, v, n, got)
+		}
+	}
+
+	alignment := map[int][]int{2: {6, 18}, 7: {6, 22, 38}, 32: {6, 34, 60, 86, 112, 138}}
+	for v, pos := range alignment {
+		if got := qrAlignmentPositions(v); !reflect.DeepEqual(got, pos) {
+			t.Fatalf("\t%s\tWrong alignment of version %d: want %v got %v", test.Failed, v, pos, got)
+		}
+	}
+	t.Logf("\t%s\tVersion tables correct", test.Success)
+}
+
+func TestQR(t *testing.T) {
+	samples := []struct {
+		data    string
+		version int
+	}{
+		{"https://books.example.org/api/v1/books/f4ac7e14-fc8e-4096-b956-34e5a33040f2", 5},
+		{"9780241372579", 1},
+		{strings.Repeat("x", 300), 13},
+	}
+
+	for _, sample := range samples {
+		q, err := NewQR([]byte(sample.data))
+		if err != nil {
+			t.Fatalf("\t%s\tEncoding failed: %v", test.Failed, err)
+		}
+		if q.Version != sample.version || q.Size != sample.version*4+17 {
+			t.Fatalf("\t%s\tWrong version for %d bytes: want %d got %d", test.Failed, len(sample.data), sample.version, q.Version)
+		}
+
+		if got := readQR(t, q); got != sample.data {
+			t.Fatalf("\t%s\tWrong data read back: want %q got %q", test.Failed, sample.data, got)
+		}
+		t.Logf("\t%s\tVersion %d symbol reads back", test.Success, q.Version)
+	}
+
+	if _, err := NewQR(make([]byte, 2400)); err != ErrTooLong {
+		t.Fatalf("\t%s\tOversized data should fail: %v", test.Failed, err)
+	}
+	t.Logf("\t%s\tOversized data rejected", test.Success)
+
+	q, _ := NewQR([]byte("9780241372579"))
+	for _, c := range [][2]int{{0, 0}, {6, 6}, {q.Size - 1, 0}, {0, q.Size - 1}, {8, q.Size - 8}} {
+		if !q.Dark(c[0], c[1]) {
+			t.Fatalf("\t%s\tModule %v should be dark", test.Failed, c)
+		}
+	}
+	if img := q.Image(3); img.Bounds().Dx() != (q.Size+2*QRQuiet)*3 {
+		t.Fatalf("\t%s\tWrong image size: %v", test.Failed, img.Bounds())
+	}
+	t.Logf("\t%s\tFinder patterns and dark module drawn", test.Success)
+}
+
+// readQR decodes a symbol the way a reader would: it takes the mask from
+// the format information, unmasks, collects the codewords, checks every
+// block and parses the byte mode segment.
+func readQR(t *testing.T, q *QR) string {
+	format := 0
+	for i := 0; i <= 5; i++ {
+		if q.Dark(8, i) {
+			format |= 1 << uint(i)
+		}
+	}
+	if q.Dark(8, 7) {
+		format |= 1 << 6
+	}
+	if q.Dark(8, 8) {
+		format |= 1 << 7
+	}
+	if q.Dark(7, 8) {
+		format |= 1 << 8
+	}
+	for i := 9; i < 15; i++ {
+		if q.Dark(14-i, 8) {
+			format |= 1 << uint(i)
+		}
+	}
+	format ^= 0x5412
+	if format>>13 != qrFormatM || (format>>10)&7 != q.Mask {
+		t.Fatalf("\t%s\tWrong format information: %015b", test.Failed, format)
+	}
+
+	q.applyMask(q.Mask)
+	defer q.applyMask(q.Mask)
+
+	var raw []byte
+	var cur byte
+	n := 0
+	for right := q.Size - 1; right >= 1; right -= 2 {
+		if right == 6 {
+			right = 5
+		}
+		for vert := 0; vert < q.Size; vert++ {
+			for j := 0; j < 2; j++ {
+				x, y := right-j, vert
+				if (right+1)&2 == 0 {
+					y = q.Size - 1 - vert
+				}
+				if q.function[y*q.Size+x] {
+					continue
+				}
+				cur <<= 1
+				if q.Dark(x, y) {
+					cur |= 1
+				}
+				if n++; n%8 == 0 {
+					raw = append(raw, cur)
+					cur = 0
+				}
+			}
+		}
+	}
+
+	numBlocks := qrBlocks[q.Version]
+	eccLen := qrECCPerBlock[q.Version]
+	total := qrRawModules(q.Version) / 8
+	numShort := numBlocks - total%numBlocks
+	shortData := total/numBlocks - eccLen
+
+	blocks := make([][]byte, numBlocks)
+	k := 0
+	for i := 0; i < shortData+1; i++ {
+		for j := range blocks {
+			if i == shortData && j < numShort {
+				continue
+			}
+			blocks[j] = append(blocks[j], raw[k])
+			k++
+		}
+	}
+	for i := 0; i < eccLen; i++ {
+		for j := range blocks {
+			blocks[j] = append(blocks[j], raw[k])
+			k++
+		}
+	}
+
+	divisor := rsDivisor(eccLen)
+	var data []byte
+	for j, b := range blocks {
+		for _, r := range rsRemainder(b, divisor) {
+			if r != 0 {
+				t.Fatalf("\t%s\tBlock %d does not check out", test.Failed, j)
+			}
+		}
+		data = append(data, b[:len(b)-eccLen]...)
+	}
+
+	if data[0]>>4 != 0x4 {
+		t.Fatalf("\t%s\tNot a byte mode segment: %x", test.Failed, data[0])
+	}
+
+	bits := func(from, n int) int {
+		v := 0
+		for i := from; i < from+n; i++ {
+			v = v<<1 | int(data[i/8]>>uint(7-i%8)&1)
+		}
+		return v
+	}
+
+	count := qrCharCountBits(q.Version)
+	length := bits(4, count)
+	out := make([]byte, length)
+	for i := range out {
+		out[i] = byte(bits(4+count+i*8, 8))
+	}
+	return string(out)
+}
@@ -0,0 +1,220 @@
+// Package barcode encodes EAN-13 and QR code symbols and renders them as SVG
+// or as images. Sizes are given in modules, the narrowest bar or smallest
+// square of a symbol, so callers can scale them to any output.
+package barcode
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+)
+
+var ErrInvalidEAN = errors.New("EAN-13 needs 12 or 13 digits with a valid check digit")
+
+const (
+	// EANQuietLeft and EANQuietRight are the light margins around the bars.
+	// The first digit is printed in the left one.
+	EANQuietLeft  = 11
+	EANQuietRight = 7
+
+	// EANWidth is the width of the symbol with its margins.
+	EANWidth = EANQuietLeft + 95 + EANQuietRight
+
+	// EANBarHeight is the height of the bars above the digits. The guard
+	// bars run EANGuardExtra modules further down, between the digits.
+	EANBarHeight  = 60
+	EANGuardExtra = 5
+
+	// EANHeight is the height of the symbol including the digits.
+	EANHeight = EANBarHeight + 9
+)
+
+var (
+	eanL = [10]string{"0001101", "0011001", "0010011", "0111101", "0100011", "0110001", "0101111", "0111011", "0110111", "0001011"}
+	eanG = [10]string{"0100111", "0110011", "0011011", "0100001", "0011101", "0111001", "0000101", "0010001", "0001001", "0010111"}
+	eanR = [10]string{"1110010", "1100110", "1101100", "1000010", "1011100", "1001110", "1010000", "1000100", "1001000", "1110100"}
+
+	// eanParity picks the L or G set for the left half; the first digit is
+	// only encoded by this choice.
+	eanParity = [10]string{"LLLLLL", "LLGLGG", "LLGGLG", "LLGGGL", "LGLLGG", "LGGLLG", "LGGGLL", "LGLGLG", "LGLGGL", "LGGLGL"}
+)
+
+// EAN13 is an encoded EAN-13 symbol. Modules holds the 95 modules from the
+// start guard to the end guard, true for a bar.
+type EAN13 struct {
+	Digits  string
+	Modules []bool
+}
+
+// NewEAN13 encodes a 13 digit code, or a 12 digit one whose check digit is
+// added. An ISBN-13 is a valid EAN-13.
+func NewEAN13(code string) (*EAN13, error) {
+	for _, c := range code {
+		if c < '0' || c > '9' {
+			return nil, ErrInvalidEAN
+		}
+	}
+
+	switch len(code) {
+	case 12:
+		code += string(eanCheck(code))
+	case 13:
+		if eanCheck(code[:12]) != code[12] {
+			return nil, ErrInvalidEAN
+		}
+	default:
+		return nil, ErrInvalidEAN
+	}
+
+	var b bytes.Buffer
+	b.WriteString("101")
+	parity := eanParity[code[0]-'0']
+	for i := 1; i <= 6; i++ {
+		d := code[i] - '0'
+		if parity[i-1] == 'L' {
+			b.WriteString(eanL[d])
+		} else {
+			b.WriteString(eanG[d])
+		}
+	}
+	b.WriteString("01010")
+	for i := 7; i <= 12; i++ {
+		b.WriteString(eanR[code[i]-'0'])
+	}
+	b.WriteString("101")
+
+	e := &EAN13{Digits: code, Modules: make([]bool, b.Len())}
+	for i, c := range b.Bytes() {
+		e.Modules[i] = c == '1'
+	}
+	return e, nil
+}
+
+func eanCheck(digits string) byte {
+	sum := 0
+	for i := 0; i < 12; i++ {
+		d := int(digits[i] - '0')
+		if i%2 == 1 {
+			d *= 3
+		}
+		sum += d
+	}
+	return byte('0' + (10-sum%10)%10)
+}
+
+// Guard reports whether module i belongs to one of the guard patterns,
+// which are drawn longer than the data bars.
+func (e *EAN13) Guard(i int) bool {
+	return i < 3 || (i >= 45 && i < 50) || i >= 92
+}
+
+// DigitX returns the left edge of the box the i-th digit is printed in,
+// counted in modules from the left of the quiet zone. Every box is seven
+// modules wide.
+func (e *EAN13) DigitX(i int) int {
+	switch {
+	case i == 0:
+		return EANQuietLeft - 9
+	case i <= 6:
+		return EANQuietLeft + 3 + 7*(i-1)
+	}
+	return EANQuietLeft + 50 + 7*(i-7)
+}
+
+// SVG draws the symbol with its digits, one user unit per module.
+func (e *EAN13) SVG() []byte {
+	var b bytes.Buffer
+	fmt.Fprintf(&b, `<svg xmlns="http://www.w3.org/2000/svg" viewBox="0 0 %d %d" width="%d" height="%d">`, EANWidth, EANHeight, EANWidth*3, EANHeight*3)
+	fmt.Fprintf(&b, `<rect width="%d" height="%d" fill="#fff"/><g fill="#000">`, EANWidth, EANHeight)
+
+	for i := 0; i < len(e.Modules); {
+		if !e.Modules[i] {
+			i++
+			continue
+		}
+		j := i
+		for j < len(e.Modules) && e.Modules[j] {
+			j++
+		}
+		h := EANBarHeight
+		if e.Guard(i) {
+			h += EANGuardExtra
+		}
+		fmt.Fprintf(&b, `<rect x="%d" y="0" width="%d" height="%d"/>`, EANQuietLeft+i, j-i, h)
+		i = j
+	}
+
+	b.WriteString(`</g><g font-family="monospace" font-size="8" text-anchor="middle">`)
+	for i := range e.Digits {
+		fmt.Fprintf(&b, `<text x="%.1f" y="%d">%c</text>`, float64(e.DigitX(i))+3.5, EANHeight-1, e.Digits[i])
+	}
+	b.WriteString(`</g></svg>`)
+
+	return b.Bytes()
+}
+
+// Image draws the symbol with its digits, scale pixels per module.
+func (e *EAN13) Image(scale int) *image.Gray {
+	if scale < 1 {
+		scale = 1
+	}
+
+	img := blank(EANWidth, EANHeight, scale)
+	for i, dark := range e.Modules {
+		if !dark {
+			continue
+		}
+		h := EANBarHeight
+		if e.Guard(i) {
+			h += EANGuardExtra
+		}
+		fill(img, EANQuietLeft+i, 0, 1, h, scale)
+	}
+
+	for i := range e.Digits {
+		glyph := digitGlyphs[e.Digits[i]-'0']
+		for y, row := range glyph {
+			for x := range row {
+				if row[x] == '1' {
+					fill(img, e.DigitX(i)+1+x, EANBarHeight+1+y, 1, 1, scale)
+				}
+			}
+		}
+	}
+
+	return img
+}
+
+// digitGlyphs is a 5x7 bitmap font for the digits under the bars.
+var digitGlyphs = [10][7]string{
+	{"01110", "10001", "10011", "10101", "11001", "10001", "01110"},
+	{"00100", "01100", "00100", "00100", "00100", "00100", "01110"},
+	{"01110", "10001", "00001", "00010", "00100", "01000", "11111"},
+	{"11111", "00010", "00100", "00010", "00001", "10001", "01110"},
+	{"00010", "00110", "01010", "10010", "11111", "00010", "00010"},
+	{"11111", "10000", "11110", "00001", "00001", "10001", "01110"},
+	{"00110", "01000", "10000", "11110", "10001", "10001", "01110"},
+	{"11111", "00001", "00010", "00100", "01000", "01000", "01000"},
+	{"01110", "10001", "10001", "01110", "10001", "10001", "01110"},
+	{"01110", "10001", "10001", "01111", "00001", "00010", "01100"},
+}
+
+// blank returns a white image of w by h modules.
+func blank(w, h, scale int) *image.Gray {
+	img := image.NewGray(image.Rect(0, 0, w*scale, h*scale))
+	for i := range img.Pix {
+		img.Pix[i] = 0xff
+	}
+	return img
+}
+
+// fill blackens a rectangle given in modules.
+func fill(img *image.Gray, x, y, w, h, scale int) {
+	for py := y * scale; py < (y+h)*scale; py++ {
+		for px := x * scale; px < (x+w)*scale; px++ {
+			img.SetGray(px, py, color.Gray{})
+		}
+	}
+}
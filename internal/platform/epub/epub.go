@@ -0,0 +1,308 @@
+// Package epub reads the package metadata of EPUB 2 and EPUB 3 files: the
+// Dublin Core fields of the OPF package document and the cover image.
+package epub
+
+import (
+	"archive/zip"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/url"
+	"path"
+	"strings"
+)
+
+var (
+	ErrNoContainer = errors.New("EPUB has no META-INF/container.xml")
+	ErrNoPackage   = errors.New("EPUB container names no package document")
+)
+
+// maxResource caps the size of a single file read from the archive, so that
+// a small upload cannot expand into an unbounded amount of memory.
+const maxResource = 20 << 20
+
+const ContentType = "application/epub+zip"
+
+// RoleAuthor is the MARC relator code for authors. Creators without a role
+// are taken to be authors as well.
+const RoleAuthor = "aut"
+
+type Creator struct {
+	Name   string
+	FileAs string
+	Role   string
+}
+
+type Identifier struct {
+	ID     string
+	Scheme string
+	Value  string
+}
+
+type Resource struct {
+	Href      string
+	MediaType string
+	Data      []byte
+}
+
+// Package is the metadata of one publication.
+type Package struct {
+	Version          string
+	UniqueIdentifier string
+	Titles           []string
+	Creators         []Creator
+	Identifiers      []Identifier
+	Languages        []string
+	Subjects         []string
+	Description      string
+	Cover            *Resource
+}
+
+// Authors are the creators credited as authors, in document order.
+func (p *Package) Authors() []Creator {
+	as := []Creator{}
+	for _, c := range p.Creators {
+		if c.Role == "" || c.Role == RoleAuthor {
+			as = append(as, c)
+		}
+	}
+	return as
+}
+
+type container struct {
+	Rootfiles []struct {
+		FullPath  string `xml:"full-path,attr"`
+		MediaType string `xml:"media-type,attr"`
+	} `xml:"rootfiles>rootfile"`
+}
+
+type opfCreator struct {
+	ID     string `xml:"id,attr"`
+	Role   string `xml:"http://www.idpf.org/2007/opf role,attr"`
+	FileAs string `xml:"http://www.idpf.org/2007/opf file-as,attr"`
+	Name   string `xml:",chardata"`
+}
+
+type opfIdentifier struct {
+	ID     string `xml:"id,attr"`
+	Scheme string `xml:"http://www.idpf.org/2007/opf scheme,attr"`
+	Value  string `xml:",chardata"`
+}
+
+// opfMeta is either an EPUB 2 name/content pair or an EPUB 3 property,
+// possibly refining another element.
+type opfMeta struct {
+	Name     string `xml:"name,attr"`
+	Content  string `xml:"content,attr"`
+	Refines  string `xml:"refines,attr"`
+	Property string `xml:"property,attr"`
+	Value    string `xml:",chardata"`
+}
+
+type opfItem struct {
+	ID         string `xml:"id,attr"`
+	Href       string `xml:"href,attr"`
+	MediaType  string `xml:"media-type,attr"`
+	Properties string `xml:"properties,attr"`
+}
+
+type opf struct {
+	Version          string `xml:"version,attr"`
+	UniqueIdentifier string `xml:"unique-identifier,attr"`
+	Metadata         struct {
+		Titles      []string        `xml:"http://purl.org/dc/elements/1.1/ title"`
+		Creators    []opfCreator    `xml:"http://purl.org/dc/elements/1.1/ creator"`
+		Identifiers []opfIdentifier `xml:"http://purl.org/dc/elements/1.1/ identifier"`
+		Languages   []string        `xml:"http://purl.org/dc/elements/1.1/ language"`
+		Subjects    []string        `xml:"http://purl.org/dc/elements/1.1/ subject"`
+		Description string          `xml:"http://purl.org/dc/elements/1.1/ description"`
+		Metas       []opfMeta       `xml:"meta"`
+	} `xml:"metadata"`
+	Items []opfItem `xml:"manifest>item"`
+}
+
+// Read parses the EPUB in r, which is size bytes long.
+func Read(r io.ReaderAt, size int64) (*Package, error) {
+	zr, err := zip.NewReader(r, size)
+	if err != nil {
+		return nil, fmt.Errorf("Opening EPUB: %w", err)
+	}
+
+	files := map[string]*zip.File{}
+	for _, f := range zr.File {
+		files[f.Name] = f
+	}
+
+	cf, ok := files["META-INF/container.xml"]
+	if !ok {
+		return nil, ErrNoContainer
+	}
+
+	c := container{}
+	if err := decodeFile(cf, &c); err != nil {
+		return nil, err
+	}
+
+	opfPath := ""
+	for _, rf := range c.Rootfiles {
+		if rf.MediaType == "" || rf.MediaType == "application/oebps-package+xml" {
+			opfPath = rf.FullPath
+			break
+		}
+	}
+
+	of, ok := files[opfPath]
+	if !ok {
+		return nil, ErrNoPackage
+	}
+
+	o := opf{}
+	if err := decodeFile(of, &o); err != nil {
+		return nil, err
+	}
+
+	p := packageFrom(&o)
+
+	if item := coverItem(&o); item != nil {
+		href, err := url.PathUnescape(item.Href)
+		if err != nil {
+			href = item.Href
+		}
+
+		// A cover the manifest names but the archive lacks is ignored,
+		// since the metadata is still worth having.
+		if cover, ok := files[path.Join(path.Dir(opfPath), href)]; ok {
+			data, err := readFile(cover)
+			if err != nil {
+				return nil, err
+			}
+
+			p.Cover = &Resource{Href: item.Href, MediaType: item.MediaType, Data: data}
+		}
+	}
+
+	return p, nil
+}
+
+func packageFrom(o *opf) *Package {
+	// EPUB 3 moves roles and sort names into meta elements that refine the
+	// creator by ID.
+	refines := map[string]map[string]string{}
+	for _, m := range o.Metadata.Metas {
+		if m.Refines == "" || m.Property == "" {
+			continue
+		}
+		id := strings.TrimPrefix(m.Refines, "#")
+		if refines[id] == nil {
+			refines[id] = map[string]string{}
+		}
+		refines[id][m.Property] = strings.TrimSpace(m.Value)
+	}
+
+	p := &Package{
+		Version:          o.Version,
+		UniqueIdentifier: o.UniqueIdentifier,
+		Description:      strings.TrimSpace(o.Metadata.Description),
+	}
+
+	for _, t := range o.Metadata.Titles {
+		if t = strings.TrimSpace(t); t != "" {
+			p.Titles = append(p.Titles, t)
+		}
+	}
+
+	for _, c := range o.Metadata.Creators {
+		cr := Creator{Name: strings.TrimSpace(c.Name), FileAs: c.FileAs, Role: c.Role}
+		if r, ok := refines[c.ID]; ok && c.ID != "" {
+			if cr.Role == "" {
+				cr.Role = r["role"]
+			}
+			if cr.FileAs == "" {
+				cr.FileAs = r["file-as"]
+			}
+		}
+		if cr.Name != "" {
+			p.Creators = append(p.Creators, cr)
+		}
+	}
+
+	for _, id := range o.Metadata.Identifiers {
+		scheme := id.Scheme
+		if r, ok := refines[id.ID]; ok && id.ID != "" && scheme == "" {
+			scheme = r["identifier-type"]
+		}
+		p.Identifiers = append(p.Identifiers, Identifier{ID: id.ID, Scheme: scheme, Value: strings.TrimSpace(id.Value)})
+	}
+
+	for _, l := range o.Metadata.Languages {
+		if l = strings.TrimSpace(l); l != "" {
+			p.Languages = append(p.Languages, l)
+		}
+	}
+
+	for _, s := range o.Metadata.Subjects {
+		if s = strings.TrimSpace(s); s != "" {
+			p.Subjects = append(p.Subjects, s)
+		}
+	}
+
+	return p
+}
+
+// coverItem finds the cover image, declared by a cover-image property in
+// EPUB 3 and by a meta element naming the manifest item in EPUB 2.
+func coverItem(o *opf) *opfItem {
+	for i, item := range o.Items {
+		for _, prop := range strings.Fields(item.Properties) {
+			if prop == "cover-image" {
+				return &o.Items[i]
+			}
+		}
+	}
+
+	for _, m := range o.Metadata.Metas {
+		if m.Name != "cover" {
+			continue
+		}
+		for i, item := range o.Items {
+			if item.ID == m.Content && strings.HasPrefix(item.MediaType, "image/") {
+				return &o.Items[i]
+			}
+		}
+	}
+
+	return nil
+}
+
+func readFile(f *zip.File) ([]byte, error) {
+	rc, err := f.Open()
+	if err != nil {
+		return nil, fmt.Errorf("Opening %s: %w", f.Name, err)
+	}
+	defer rc.Close()
+
+	data, err := ioutil.ReadAll(io.LimitReader(rc, maxResource+1))
+	if err != nil {
+		return nil, fmt.Errorf("Reading %s: %w", f.Name, err)
+	}
+	if len(data) > maxResource {
+		return nil, fmt.Errorf("Reading %s: file is too large", f.Name)
+	}
+
+	return data, nil
+}
+
+func decodeFile(f *zip.File, v interface{}) error {
+	data, err := readFile(f)
+	if err != nil {
+		return err
+	}
+
+	if err := xml.Unmarshal(data, v); err != nil {
+		return fmt.Errorf("Parsing %s: %w", f.Name, err)
+	}
+
+	return nil
+}
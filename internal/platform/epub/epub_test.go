@@ -0,0 +1,174 @@
+package epub_test
+
+import (
+	"archive/zip"
+	"bytes"
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/axwilliams/book-api/internal/platform/epub"
+	"github.com/axwilliams/book-api/internal/test"
+)
+
+const container = `<?xml version="1.0"?>
+<container version="1.0" xmlns="urn:oasis:names:tc:opendocument:xmlns:container">
+  <rootfiles>
+    <rootfile full-path="OEBPS/content.opf" media-type="application/oebps-package+xml"/>
+  </rootfiles>
+</container>`
+
+const opf2 = `<?xml version="1.0" encoding="UTF-8"?>
+<package xmlns="http://www.idpf.org/2007/opf" version="2.0" unique-identifier="BookId">
+  <metadata xmlns:dc="http://purl.org/dc/elements/1.1/" xmlns:opf="http://www.idpf.org/2007/opf">
+    <dc:title>The Castle</dc:title>
+    <dc:creator opf:role="aut" opf:file-as="Kafka, Franz">Franz Kafka</dc:creator>
+    <dc:creator opf:role="trl">Willa Muir</dc:creator>
+    <dc:identifier id="BookId" opf:scheme="ISBN">978-0241372579</dc:identifier>
+    <dc:language>en</dc:language>
+    <dc:subject>Fiction</dc:subject>
+    <dc:description>&lt;p&gt;A land surveyor&lt;/p&gt;</dc:description>
+    <meta name="cover" content="cover-img"/>
+  </metadata>
+  <manifest>
+    <item id="cover-img" href="images/cover%20front.jpg" media-type="image/jpeg"/>
+  </manifest>
+</package>`
+
+const opf3 = `<?xml version="1.0" encoding="UTF-8"?>
+<package xmlns="http://www.idpf.org/2007/opf" version="3.0" unique-identifier="uid">
+  <metadata xmlns:dc="http://purl.org/dc/elements/1.1/">
+    <dc:identifier id="uid">urn:isbn:9781451673319</dc:identifier>
+    <dc:title>Fahrenheit 451</dc:title>
+    <dc:creator id="c1">Ray Bradbury</dc:creator>
+    <meta refines="#c1" property="role" scheme="marc:relators">aut</meta>
+    <meta refines="#c1" property="file-as">Bradbury, Ray</meta>
+    <dc:creator id="c2">Neil Gaiman</dc:creator>
+    <meta refines="#c2" property="role" scheme="marc:relators">aui</meta>
+    <dc:language>en-US</dc:language>
+  </metadata>
+  <manifest>
+    <item id="c" href="cover.png" media-type="image/png" properties="cover-image"/>
+  </manifest>
+</package>`
+
+func build(t *testing.T, files map[string]string) []byte {
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+
+	for name, content := range files {
+		f, err := zw.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		f.Write([]byte(content))
+	}
+
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	return buf.Bytes()
+}
+
+func TestRead(t *testing.T) {
+	samples := []struct {
+		name     string
+		files    map[string]string
+		expected *epub.Package
+	}{
+		{
+			name: "EPUB 2",
+			files: map[string]string{
+				"META-INF/container.xml":       container,
+				"OEBPS/content.opf":            opf2,
+				"OEBPS/images/cover front.jpg": "jpeg",
+			},
+			expected: &epub.Package{
+				Version:          "2.0",
+				UniqueIdentifier: "BookId",
+				Titles:           []string{"The Castle"},
+				Creators: []epub.Creator{
+					{Name: "Franz Kafka", FileAs: "Kafka, Franz", Role: "aut"},
+					{Name: "Willa Muir", Role: "trl"},
+				},
+				Identifiers: []epub.Identifier{{ID: "BookId", Scheme: "ISBN", Value: "978-0241372579"}},
+				Languages:   []string{"en"},
+				Subjects:    []string{"Fiction"},
+				Description: "<p>A land surveyor</p>",
+				Cover:       &epub.Resource{Href: "images/cover%20front.jpg", MediaType: "image/jpeg", Data: []byte("jpeg")},
+			},
+		},
+		{
+			name: "EPUB 3",
+			files: map[string]string{
+				"META-INF/container.xml": container,
+				"OEBPS/content.opf":      opf3,
+				"OEBPS/cover.png":        "png",
+			},
+			expected: &epub.Package{
+				Version:          "3.0",
+				UniqueIdentifier: "uid",
+				Titles:           []string{"Fahrenheit 451"},
+				Creators: []epub.Creator{
+					{Name: "Ray Bradbury", FileAs: "Bradbury, Ray", Role: "aut"},
+					{Name: "Neil Gaiman", Role: "aui"},
+				},
+				Identifiers: []epub.Identifier{{ID: "uid", Value: "urn:isbn:9781451673319"}},
+				Languages:   []string{"en-US"},
+				Cover:       &epub.Resource{Href: "cover.png", MediaType: "image/png", Data: []byte("png")},
+			},
+		},
+	}
+
+	for _, sample := range samples {
+		raw := build(t, sample.files)
+
+		p, err := epub.Read(bytes.NewReader(raw), int64(len(raw)))
+		if err != nil {
+			t.Fatalf("\t%s\tReading %s failed: %v", test.Failed, sample.name, err)
+		}
+
+		if !reflect.DeepEqual(p, sample.expected) {
+			t.Fatalf("\t%s\tWrong package for %s: want %+v got %+v", test.Failed, sample.name, sample.expected, p)
+		}
+
+		if as := p.Authors(); len(as) != 1 {
+			t.Fatalf("\t%s\tWrong authors for %s: %+v", test.Failed, sample.name, as)
+		}
+		t.Logf("\t%s\tRead %s", test.Success, sample.name)
+	}
+}
+
+func TestReadInvalid(t *testing.T) {
+	samples := []struct {
+		name  string
+		files map[string]string
+		err   error
+	}{
+		{"No container", map[string]string{"OEBPS/content.opf": opf2}, epub.ErrNoContainer},
+		{"No package", map[string]string{"META-INF/container.xml": container}, epub.ErrNoPackage},
+	}
+
+	for _, sample := range samples {
+		raw := build(t, sample.files)
+
+		if _, err := epub.Read(bytes.NewReader(raw), int64(len(raw))); !errors.Is(err, sample.err) {
+			t.Fatalf("\t%s\tWrong error for %s: want %v got %v", test.Failed, sample.name, sample.err, err)
+		}
+		t.Logf("\t%s\t%s rejected", test.Success, sample.name)
+	}
+
+	raw := build(t, map[string]string{"META-INF/container.xml": container, "OEBPS/content.opf": opf3})
+
+	p, err := epub.Read(bytes.NewReader(raw), int64(len(raw)))
+	if err != nil || p.Cover != nil {
+		t.Fatalf("\t%s\tA missing cover should be skipped: got %v, %+v", test.Failed, err, p)
+	}
+	t.Logf("\t%s\tMissing cover skipped", test.Success)
+
+	if _, err := epub.Read(bytes.NewReader([]byte("not a zip")), 9); err == nil {
+		t.Fatalf("\t%s\tA file that is not a zip archive should be rejected", test.Failed)
+	}
+	t.Logf("\t%s\tNon-zip rejected", test.Success)
+}
@@ -0,0 +1,225 @@
+package marc
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+)
+
+const (
+	subfieldDelimiter = 0x1f
+	fieldTerminator   = 0x1e
+	recordTerminator  = 0x1d
+
+	leaderLength = 24
+	entryLength  = 12
+)
+
+// Reader decodes a stream of ISO 2709 records.
+type Reader struct {
+	r *bufio.Reader
+}
+
+func NewReader(r io.Reader) *Reader {
+	return &Reader{bufio.NewReader(r)}
+}
+
+// Read returns the next record, or io.EOF when the stream is exhausted.
+func (rd *Reader) Read() (*Record, error) {
+	// Some exports put line breaks between records.
+	for {
+		b, err := rd.r.Peek(1)
+		if err != nil {
+			return nil, err
+		}
+		if b[0] != '\n' && b[0] != '\r' {
+			break
+		}
+		rd.r.ReadByte()
+	}
+
+	head, err := rd.r.Peek(5)
+	if err != nil {
+		return nil, ErrLeader
+	}
+
+	length, ok := number(head)
+	if !ok || length < leaderLength+1 {
+		return nil, ErrLeader
+	}
+
+	data := make([]byte, length)
+	if _, err := io.ReadFull(rd.r, data); err != nil {
+		return nil, fmt.Errorf("Reading MARC record: %w", err)
+	}
+
+	return Decode(data)
+}
+
+// Decode parses a single ISO 2709 record.
+func Decode(data []byte) (*Record, error) {
+	if len(data) < leaderLength+1 {
+		return nil, ErrLeader
+	}
+
+	rec := &Record{Leader: string(data[:leaderLength])}
+
+	base, ok := number(data[12:17])
+	if !ok || base <= leaderLength || base > len(data) {
+		return nil, ErrLeader
+	}
+
+	dir := data[leaderLength : base-1]
+	if len(dir)%entryLength != 0 || data[base-1] != fieldTerminator {
+		return nil, ErrDirectory
+	}
+
+	for i := 0; i < len(dir); i += entryLength {
+		entry := dir[i : i+entryLength]
+
+		tag := string(entry[:3])
+		length, ok := number(entry[3:7])
+		if !ok {
+			return nil, ErrDirectory
+		}
+		start, ok := number(entry[7:12])
+		if !ok {
+			return nil, ErrDirectory
+		}
+
+		from, to := base+start, base+start+length
+		if length < 1 || from < base || to > len(data) {
+			return nil, ErrDirectory
+		}
+
+		rec.Fields = append(rec.Fields, decodeField(tag, data[from:to-1]))
+	}
+
+	return rec, nil
+}
+
+// number reads a fixed-width decimal field of the leader or directory. Unlike
+// strconv.Atoi it refuses signs, so that offsets cannot point backwards.
+func number(b []byte) (int, bool) {
+	if len(b) == 0 {
+		return 0, false
+	}
+
+	n := 0
+	for _, c := range b {
+		if c < '0' || c > '9' {
+			return 0, false
+		}
+		n = n*10 + int(c-'0')
+	}
+	return n, true
+}
+
+func decodeField(tag string, raw []byte) Field {
+	f := Field{Tag: tag}
+
+	if IsControlTag(tag) {
+		f.Value = string(raw)
+		return f
+	}
+
+	if len(raw) >= 2 {
+		f.Ind1, f.Ind2 = string(raw[0]), string(raw[1])
+		raw = raw[2:]
+	}
+
+	for _, part := range bytes.Split(raw, []byte{subfieldDelimiter}) {
+		if len(part) == 0 {
+			continue
+		}
+		f.Subfields = append(f.Subfields, Subfield{
+			Code:  string(part[:1]),
+			Value: string(part[1:]),
+		})
+	}
+
+	return f
+}
+
+// Writer encodes records as ISO 2709.
+type Writer struct {
+	w io.Writer
+}
+
+func NewWriter(w io.Writer) *Writer {
+	return &Writer{w}
+}
+
+func (wr *Writer) Write(rec *Record) error {
+	data, err := Encode(rec)
+	if err != nil {
+		return err
+	}
+
+	_, err = wr.w.Write(data)
+	return err
+}
+
+// Encode serializes rec as ISO 2709. The record length and base address in
+// the leader are recomputed; the rest of the leader is kept.
+func Encode(rec *Record) ([]byte, error) {
+	leader := []byte(rec.Leader)
+	if len(leader) != leaderLength {
+		leader = []byte(DefaultLeader)
+	}
+
+	var dir, body bytes.Buffer
+
+	for _, f := range rec.Fields {
+		if len(f.Tag) != 3 {
+			return nil, fmt.Errorf("Encoding MARC field %q: %w", f.Tag, ErrDirectory)
+		}
+
+		start := body.Len()
+		if f.IsControl() {
+			body.WriteString(f.Value)
+		} else {
+			body.WriteString(indicator(f.Ind1))
+			body.WriteString(indicator(f.Ind2))
+			for _, sf := range f.Subfields {
+				body.WriteByte(subfieldDelimiter)
+				body.WriteString(sf.Code)
+				body.WriteString(sf.Value)
+			}
+		}
+		body.WriteByte(fieldTerminator)
+
+		length := body.Len() - start
+		if length > 9999 || start > 99999 {
+			return nil, ErrTooLong
+		}
+		fmt.Fprintf(&dir, "%s%04d%05d", f.Tag, length, start)
+	}
+	dir.WriteByte(fieldTerminator)
+	body.WriteByte(recordTerminator)
+
+	base := leaderLength + dir.Len()
+	total := base + body.Len()
+	if total > 99999 {
+		return nil, ErrTooLong
+	}
+
+	copy(leader[0:5], fmt.Sprintf("%05d", total))
+	copy(leader[12:17], fmt.Sprintf("%05d", base))
+	leader[10], leader[11] = '2', '2'
+
+	out := make([]byte, 0, total)
+	out = append(out, leader...)
+	out = append(out, dir.Bytes()...)
+	out = append(out, body.Bytes()...)
+
+	return out, nil
+}
+
+func indicator(ind string) string {
+	if len(ind) != 1 {
+		return " "
+	}
+	return ind
+}
@@ -0,0 +1,197 @@
+package marc_test
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"os"
+	"reflect"
+	"testing"
+
+	"github.com/axwilliams/book-api/internal/platform/marc"
+	"github.com/axwilliams/book-api/internal/test"
+)
+
+func readBinary(t *testing.T, data []byte) []*marc.Record {
+	rd := marc.NewReader(bytes.NewReader(data))
+
+	recs := []*marc.Record{}
+	for {
+		rec, err := rd.Read()
+		if err == io.EOF {
+			return recs
+		}
+		if err != nil {
+			t.Fatalf("\t%s\tReading record: %v", test.Failed, err)
+		}
+		recs = append(recs, rec)
+	}
+}
+
+func TestDecode(t *testing.T) {
+	data, err := ioutil.ReadFile("testdata/records.mrc")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	recs := readBinary(t, data)
+	if len(recs) != 2 {
+		t.Fatalf("\t%s\tWrong number of records: want 2 got %v", test.Failed, len(recs))
+	}
+	t.Logf("\t%s\tRecords read", test.Success)
+
+	samples := []struct {
+		tag      string
+		code     string
+		expected string
+	}{
+		{"020", "a", "9780805211061 (pbk.)"},
+		{"100", "a", "Kafka, Franz,"},
+		{"245", "b", "a new translation based on the restored text /"},
+		{"260", "b", "Schocken Books,"},
+	}
+
+	for _, sample := range samples {
+		f := recs[0].Field(sample.tag)
+		if f == nil || f.Subfield(sample.code) != sample.expected {
+			t.Fatalf("\t%s\tWrong %s $%s: want %v got %+v", test.Failed, sample.tag, sample.code, sample.expected, f)
+		}
+		t.Logf("\t%s\t%s $%s decoded", test.Success, sample.tag, sample.code)
+	}
+
+	if f := recs[0].Field("001"); f == nil || f.Value != "12345678" {
+		t.Fatalf("\t%s\tWrong control field: got %+v", test.Failed, f)
+	}
+	t.Logf("\t%s\tControl field decoded", test.Success)
+
+	if f := recs[1].Field("500"); f == nil || f.Subfield("a") != "Zweisprachig: Café & Straße." {
+		t.Fatalf("\t%s\tMultibyte text not decoded: got %+v", test.Failed, f)
+	}
+	t.Logf("\t%s\tMultibyte text decoded", test.Success)
+}
+
+func TestBinaryRoundTrip(t *testing.T) {
+	data, err := ioutil.ReadFile("testdata/records.mrc")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	w := marc.NewWriter(&buf)
+	for _, rec := range readBinary(t, data) {
+		if err := w.Write(rec); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if !bytes.Equal(buf.Bytes(), data) {
+		t.Fatalf("\t%s\tRe-encoded records differ from the sample", test.Failed)
+	}
+	t.Logf("\t%s\tBinary records survive a round trip", test.Success)
+}
+
+func TestXMLRoundTrip(t *testing.T) {
+	f, err := os.Open("testdata/records.xml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	fromXML, err := marc.DecodeXML(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := ioutil.ReadFile("testdata/records.mrc")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	fromBinary := readBinary(t, data)
+
+	// The sample leaders only differ in the computed length and base address.
+	for _, rec := range fromBinary {
+		rec.Leader = "00000" + rec.Leader[5:12] + "00000" + rec.Leader[17:]
+	}
+
+	if !reflect.DeepEqual(fromXML, fromBinary) {
+		t.Fatalf("\t%s\tMARCXML and binary samples differ:\n%+v\n%+v", test.Failed, fromXML, fromBinary)
+	}
+	t.Logf("\t%s\tMARCXML matches the binary sample", test.Success)
+
+	var buf bytes.Buffer
+	if err := marc.EncodeXML(&buf, fromXML...); err != nil {
+		t.Fatal(err)
+	}
+
+	again, err := marc.DecodeXML(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !reflect.DeepEqual(again, fromXML) {
+		t.Fatalf("\t%s\tMARCXML changed in a round trip:\n%s", test.Failed, buf.String())
+	}
+	t.Logf("\t%s\tMARCXML survives a round trip", test.Success)
+}
+
+func TestAdd(t *testing.T) {
+	rec := marc.NewRecord()
+	rec.Add(marc.Field{Tag: "245", Ind1: "0", Ind2: "0", Subfields: []marc.Subfield{{Code: "a", Value: "Title"}}})
+	rec.Add(marc.Field{Tag: "001", Value: "1"})
+	rec.Add(marc.Field{Tag: "100", Ind1: "1", Ind2: " ", Subfields: []marc.Subfield{{Code: "a", Value: "Author"}}})
+	rec.Remove("245")
+
+	tags := []string{}
+	for _, f := range rec.Fields {
+		tags = append(tags, f.Tag)
+	}
+
+	if !reflect.DeepEqual(tags, []string{"001", "100"}) {
+		t.Fatalf("\t%s\tWrong field order: got %v", test.Failed, tags)
+	}
+	t.Logf("\t%s\tFields kept in tag order", test.Success)
+}
+
+func TestDecodeMalformed(t *testing.T) {
+	data, err := ioutil.ReadFile("testdata/records.mrc")
+	if err != nil {
+		t.Fatal(err)
+	}
+	rec := readBinary(t, data)[0]
+
+	good, err := marc.Encode(rec)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// corrupt overwrites the bytes at off in a copy of the record.
+	corrupt := func(off int, s string) []byte {
+		b := append([]byte(nil), good...)
+		copy(b[off:], s)
+		return b
+	}
+
+	samples := []struct {
+		name     string
+		data     []byte
+		expected error
+	}{
+		{"Signed base address", corrupt(12, "+0100"), marc.ErrLeader},
+		{"Negative field start", corrupt(24+7, "-9958"), marc.ErrDirectory},
+		{"Signed field length", corrupt(24+3, "+001"), marc.ErrDirectory},
+		{"Field past the record", corrupt(24+7, "99999"), marc.ErrDirectory},
+	}
+
+	for _, sample := range samples {
+		if _, err := marc.Decode(sample.data); err != sample.expected {
+			t.Fatalf("\t%s\t%s: want %v got %v", test.Failed, sample.name, sample.expected, err)
+		}
+		t.Logf("\t%s\t%s rejected", test.Success, sample.name)
+	}
+
+	if _, err := marc.NewReader(bytes.NewReader(corrupt(0, "+0100"))).Read(); err != marc.ErrLeader {
+		t.Fatalf("\t%s\tSigned record length: want %v got %v", test.Failed, marc.ErrLeader, err)
+	}
+	t.Logf("\t%s\tSigned record length rejected", test.Success)
+}
@@ -0,0 +1,114 @@
+// Package marc reads and writes MARC 21 bibliographic records, both in the
+// ISO 2709 binary transmission format and as MARCXML.
+package marc
+
+import (
+	"errors"
+	"strings"
+)
+
+var (
+	ErrLeader    = errors.New("Invalid MARC leader")
+	ErrDirectory = errors.New("Invalid MARC directory")
+	ErrTooLong   = errors.New("MARC record is longer than 99999 bytes")
+)
+
+// DefaultLeader is used for records built from scratch: a new record for
+// language material, monograph, using the standard entry map.
+const DefaultLeader = "00000nam a2200000 a 4500"
+
+type Subfield struct {
+	Code  string
+	Value string
+}
+
+// Field is a control field when Tag is below 010, with its data in Value,
+// and a data field with indicators and subfields otherwise.
+type Field struct {
+	Tag       string
+	Value     string
+	Ind1      string
+	Ind2      string
+	Subfields []Subfield
+}
+
+type Record struct {
+	Leader string
+	Fields []Field
+}
+
+func NewRecord() *Record {
+	return &Record{Leader: DefaultLeader}
+}
+
+func IsControlTag(tag string) bool {
+	return len(tag) == 3 && strings.HasPrefix(tag, "00")
+}
+
+func (f Field) IsControl() bool {
+	return IsControlTag(f.Tag)
+}
+
+// Subfield returns the first subfield with the given code.
+func (f Field) Subfield(code string) string {
+	for _, sf := range f.Subfields {
+		if sf.Code == code {
+			return sf.Value
+		}
+	}
+	return ""
+}
+
+// Field returns the first field with the given tag, or nil.
+func (r *Record) Field(tag string) *Field {
+	for i := range r.Fields {
+		if r.Fields[i].Tag == tag {
+			return &r.Fields[i]
+		}
+	}
+	return nil
+}
+
+func (r *Record) FieldsByTag(tag string) []Field {
+	fs := []Field{}
+	for _, f := range r.Fields {
+		if f.Tag == tag {
+			fs = append(fs, f)
+		}
+	}
+	return fs
+}
+
+// Remove drops every field with one of the given tags.
+func (r *Record) Remove(tags ...string) {
+	fs := r.Fields[:0]
+	for _, f := range r.Fields {
+		keep := true
+		for _, tag := range tags {
+			if f.Tag == tag {
+				keep = false
+				break
+			}
+		}
+		if keep {
+			fs = append(fs, f)
+		}
+	}
+	r.Fields = fs
+}
+
+// Add inserts f before the first field with a higher tag, so fields stay in
+// tag order.
+func (r *Record) Add(f Field) {
+	i := len(r.Fields)
+	for j, other := range r.Fields {
+		if other.Tag > f.Tag {
+			i = j
+			break
+		}
+	}
+
+	r.Fields = append(r.Fields, Field{})
+	copy(r.Fields[i+1:], r.Fields[i:])
+	r.Fields[i] = f
+}
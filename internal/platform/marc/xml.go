@@ -0,0 +1,173 @@
+package marc
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io"
+)
+
+const Namespace = "http://www.loc.gov/MARC21/slim"
+
+type xmlSubfield struct {
+	Code  string `xml:"code,attr"`
+	Value string `xml:",chardata"`
+}
+
+type xmlControlField struct {
+	Tag   string `xml:"tag,attr"`
+	Value string `xml:",chardata"`
+}
+
+type xmlDataField struct {
+	Tag       string        `xml:"tag,attr"`
+	Ind1      string        `xml:"ind1,attr"`
+	Ind2      string        `xml:"ind2,attr"`
+	Subfields []xmlSubfield `xml:"subfield"`
+}
+
+// xmlRecord keeps control and data fields in one list so that their order
+// survives a round trip.
+type xmlRecord struct {
+	XMLName xml.Name      `xml:"record"`
+	Leader  string        `xml:"leader"`
+	Fields  []interface{} `xml:",any"`
+}
+
+func (xr *xmlRecord) UnmarshalXML(d *xml.Decoder, start xml.StartElement) error {
+	for {
+		tok, err := d.Token()
+		if err != nil {
+			return err
+		}
+
+		switch t := tok.(type) {
+		case xml.StartElement:
+			switch t.Name.Local {
+			case "leader":
+				if err := d.DecodeElement(&xr.Leader, &t); err != nil {
+					return err
+				}
+			case "controlfield":
+				cf := xmlControlField{}
+				if err := d.DecodeElement(&cf, &t); err != nil {
+					return err
+				}
+				xr.Fields = append(xr.Fields, cf)
+			case "datafield":
+				df := xmlDataField{}
+				if err := d.DecodeElement(&df, &t); err != nil {
+					return err
+				}
+				xr.Fields = append(xr.Fields, df)
+			default:
+				if err := d.Skip(); err != nil {
+					return err
+				}
+			}
+		case xml.EndElement:
+			return nil
+		}
+	}
+}
+
+func (xr xmlRecord) record() *Record {
+	rec := &Record{Leader: xr.Leader}
+	if len(rec.Leader) != leaderLength {
+		rec.Leader = DefaultLeader
+	}
+
+	for _, f := range xr.Fields {
+		switch f := f.(type) {
+		case xmlControlField:
+			rec.Fields = append(rec.Fields, Field{Tag: f.Tag, Value: f.Value})
+		case xmlDataField:
+			df := Field{Tag: f.Tag, Ind1: indicator(f.Ind1), Ind2: indicator(f.Ind2)}
+			for _, sf := range f.Subfields {
+				df.Subfields = append(df.Subfields, Subfield{Code: sf.Code, Value: sf.Value})
+			}
+			rec.Fields = append(rec.Fields, df)
+		}
+	}
+
+	return rec
+}
+
+func toXML(rec *Record) xmlRecord {
+	xr := xmlRecord{Leader: rec.Leader}
+
+	for _, f := range rec.Fields {
+		if f.IsControl() {
+			xr.Fields = append(xr.Fields, struct {
+				XMLName xml.Name `xml:"controlfield"`
+				xmlControlField
+			}{xmlControlField: xmlControlField{Tag: f.Tag, Value: f.Value}})
+			continue
+		}
+
+		df := xmlDataField{Tag: f.Tag, Ind1: indicator(f.Ind1), Ind2: indicator(f.Ind2)}
+		for _, sf := range f.Subfields {
+			df.Subfields = append(df.Subfields, xmlSubfield{Code: sf.Code, Value: sf.Value})
+		}
+		xr.Fields = append(xr.Fields, struct {
+			XMLName xml.Name `xml:"datafield"`
+			xmlDataField
+		}{xmlDataField: df})
+	}
+
+	return xr
+}
+
+// DecodeXML reads every record of a MARCXML document, whether it holds a
+// single <record> or a <collection>.
+func DecodeXML(r io.Reader) ([]*Record, error) {
+	d := xml.NewDecoder(r)
+
+	recs := []*Record{}
+	for {
+		tok, err := d.Token()
+		if err == io.EOF {
+			return recs, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("Reading MARCXML: %w", err)
+		}
+
+		start, ok := tok.(xml.StartElement)
+		if !ok || start.Name.Local != "record" {
+			continue
+		}
+
+		xr := xmlRecord{}
+		if err := d.DecodeElement(&xr, &start); err != nil {
+			return nil, fmt.Errorf("Reading MARCXML record: %w", err)
+		}
+		recs = append(recs, xr.record())
+	}
+}
+
+// EncodeXML writes recs as a MARCXML collection.
+func EncodeXML(w io.Writer, recs ...*Record) error {
+	collection := struct {
+		XMLName xml.Name    `xml:"collection"`
+		Xmlns   string      `xml:"xmlns,attr"`
+		Records []xmlRecord `xml:"record"`
+	}{Xmlns: Namespace}
+
+	for _, rec := range recs {
+		collection.Records = append(collection.Records, toXML(rec))
+	}
+
+	var buf bytes.Buffer
+	buf.WriteString(xml.Header)
+
+	enc := xml.NewEncoder(&buf)
+	enc.Indent("", "  ")
+	if err := enc.Encode(collection); err != nil {
+		return fmt.Errorf("Writing MARCXML: %w", err)
+	}
+	buf.WriteByte('\n')
+
+	_, err := w.Write(buf.Bytes())
+	return err
+}
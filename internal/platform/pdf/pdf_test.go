@@ -0,0 +1,74 @@
+package pdf_test
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+	"strconv"
+	"testing"
+
+	"github.com/axwilliams/book-api/internal/platform/pdf"
+	"github.com/axwilliams/book-api/internal/test"
+)
+
+func TestDocument(t *testing.T) {
+	d := pdf.New(pdf.LetterWidth, pdf.LetterHeight)
+	p := d.AddPage()
+	p.Rect(10, 20, 5, 30)
+	p.Text(36, 50.5, 9, "Kafka (1926) \\ Das Schloß – Roman")
+	d.AddPage()
+
+	out := d.Bytes()
+
+	if !bytes.HasPrefix(out, []byte("%PDF-1.4\n")) || !bytes.HasSuffix(out, []byte("%%EOF\n")) {
+		t.Fatalf("\t%s\tMissing header or trailer", test.Failed)
+	}
+
+	for _, s := range []string{
+		"/Count 2 /MediaBox [0 0 612 792]",
+		"10 742 5 30 re f\n",
+		`BT /F1 9 Tf 36 741.5 Td (Kafka \(1926\) \\ Das Schlo\337 ? Roman) Tj ET`,
+	} {
+		if !bytes.Contains(out, []byte(s)) {
+			t.Fatalf("\t%s\tDocument does not contain %q:\n%s", test.Failed, s, out)
+		}
+	}
+	t.Logf("\t%s\tContent written from the top left", test.Success)
+
+	m := regexp.MustCompile(`startxref\n(\d+)\n`).FindSubmatch(out)
+	if m == nil {
+		t.Fatalf("\t%s\tNo startxref", test.Failed)
+	}
+	xref, _ := strconv.Atoi(string(m[1]))
+
+	entries := regexp.MustCompile(`(\d{10}) 00000 n `).FindAllSubmatch(out[xref:], -1)
+	if len(entries) != 7 {
+		t.Fatalf("\t%s\tWrong number of objects: %d", test.Failed, len(entries))
+	}
+	for i, e := range entries {
+		offset, _ := strconv.Atoi(string(e[1]))
+		if !bytes.HasPrefix(out[offset:], []byte(fmt.Sprintf("%d 0 obj\n", i+1))) {
+			t.Fatalf("\t%s\tCross reference of object %d is off", test.Failed, i+1)
+		}
+	}
+	t.Logf("\t%s\tCross reference table correct", test.Success)
+}
+
+func TestFit(t *testing.T) {
+	samples := []struct {
+		s        string
+		width    float64
+		expected string
+	}{
+		{"The Castle", 100, "The Castle"},
+		{"The Wind-Up Bird Chronicle", 60, "The Wind-..."},
+		{"Anything", 1, ""},
+	}
+
+	for _, sample := range samples {
+		if got := pdf.Fit(sample.s, 10, sample.width); got != sample.expected {
+			t.Fatalf("\t%s\tWrong fit for %q: want %q got %q", test.Failed, sample.s, sample.expected, got)
+		}
+	}
+	t.Logf("\t%s\tText shortened to fit", test.Success)
+}
@@ -0,0 +1,482 @@
+package policy
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// Conditions are boolean expressions over the attributes of a request:
+//
+//	resource.category in subject.categories and not resource.status == 'published'
+//
+// Operands are paths starting at subject, resource or action, string
+// literals in single or double quotes, numbers, true, false, null and lists
+// in brackets. The operators are ==, !=, <, <=, >, >=, in, not in and
+// contains, combined with and, or, not and parentheses. A path that leads
+// nowhere is null.
+
+type node interface {
+	eval(env map[string]interface{}) (interface{}, error)
+}
+
+type literal struct {
+	v interface{}
+}
+
+func (n literal) eval(map[string]interface{}) (interface{}, error) {
+	return n.v, nil
+}
+
+type path []string
+
+func (n path) eval(env map[string]interface{}) (interface{}, error) {
+	var v interface{} = env
+	for _, key := range n {
+		m, ok := v.(map[string]interface{})
+		if !ok {
+			return nil, nil
+		}
+		v = m[key]
+	}
+	return normalize(v), nil
+}
+
+type list []node
+
+func (n list) eval(env map[string]interface{}) (interface{}, error) {
+	vs := make([]interface{}, 0, len(n))
+	for _, item := range n {
+		v, err := item.eval(env)
+		if err != nil {
+			return nil, err
+		}
+		vs = append(vs, v)
+	}
+	return vs, nil
+}
+
+type not struct {
+	x node
+}
+
+func (n not) eval(env map[string]interface{}) (interface{}, error) {
+	b, err := boolean(n.x, env)
+	if err != nil {
+		return nil, err
+	}
+	return !b, nil
+}
+
+type logical struct {
+	op   string
+	x, y node
+}
+
+// eval short-circuits, so "subject.branch != null and subject.branch ==
+// resource.branch" never compares with a missing branch.
+func (n logical) eval(env map[string]interface{}) (interface{}, error) {
+	x, err := boolean(n.x, env)
+	if err != nil {
+		return nil, err
+	}
+	if (n.op == "and" && !x) || (n.op == "or" && x) {
+		return x, nil
+	}
+	return boolean(n.y, env)
+}
+
+type comparison struct {
+	op   string
+	x, y node
+}
+
+func (n comparison) eval(env map[string]interface{}) (interface{}, error) {
+	x, err := n.x.eval(env)
+	if err != nil {
+		return nil, err
+	}
+	y, err := n.y.eval(env)
+	if err != nil {
+		return nil, err
+	}
+
+	switch n.op {
+	case "==":
+		return reflect.DeepEqual(x, y), nil
+	case "!=":
+		return !reflect.DeepEqual(x, y), nil
+	case "in":
+		return member(x, y, n.op)
+	case "not in":
+		in, err := member(x, y, n.op)
+		return !in, err
+	case "contains":
+		if s, ok := x.(string); ok {
+			sub, ok := y.(string)
+			if !ok {
+				return nil, fmt.Errorf("contains needs a string to look for in a string, got %s", typeName(y))
+			}
+			return strings.Contains(s, sub), nil
+		}
+		return member(y, x, n.op)
+	}
+
+	return order(n.op, x, y)
+}
+
+// member reports whether x is an element of the list y. Nothing is in null.
+func member(x, y interface{}, op string) (bool, error) {
+	switch y := y.(type) {
+	case nil:
+		return false, nil
+	case []interface{}:
+		for _, v := range y {
+			if reflect.DeepEqual(x, v) {
+				return true, nil
+			}
+		}
+		return false, nil
+	}
+	return false, fmt.Errorf("%s needs a list, got %s", op, typeName(y))
+}
+
+func order(op string, x, y interface{}) (bool, error) {
+	var c int
+	switch x := x.(type) {
+	case float64:
+		y, ok := y.(float64)
+		if !ok {
+			return false, fmt.Errorf("%s compares a number with %s", op, typeName(y))
+		}
+		switch {
+		case x < y:
+			c = -1
+		case x > y:
+			c = 1
+		}
+	case string:
+		y, ok := y.(string)
+		if !ok {
+			return false, fmt.Errorf("%s compares a string with %s", op, typeName(y))
+		}
+		c = strings.Compare(x, y)
+	default:
+		return false, fmt.Errorf("%s cannot order %s", op, typeName(x))
+	}
+
+	switch op {
+	case "<":
+		return c < 0, nil
+	case "<=":
+		return c <= 0, nil
+	case ">":
+		return c > 0, nil
+	}
+	return c >= 0, nil
+}
+
+func boolean(n node, env map[string]interface{}) (bool, error) {
+	v, err := n.eval(env)
+	if err != nil {
+		return false, err
+	}
+	b, ok := v.(bool)
+	if !ok {
+		return false, fmt.Errorf("expected true or false, got %s", typeName(v))
+	}
+	return b, nil
+}
+
+// normalize turns attribute values into the types expressions work with:
+// float64 for numbers and []interface{} for lists.
+func normalize(v interface{}) interface{} {
+	switch v := v.(type) {
+	case int:
+		return float64(v)
+	case int64:
+		return float64(v)
+	case []string:
+		vs := make([]interface{}, len(v))
+		for i, s := range v {
+			vs[i] = s
+		}
+		return vs
+	case []interface{}:
+		vs := make([]interface{}, len(v))
+		for i, item := range v {
+			vs[i] = normalize(item)
+		}
+		return vs
+	}
+	return v
+}
+
+func typeName(v interface{}) string {
+	switch v.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "a boolean"
+	case float64:
+		return "a number"
+	case string:
+		return "a string"
+	case []interface{}:
+		return "a list"
+	}
+	return "an object"
+}
+
+// roots are the names a path can start with.
+var roots = map[string]bool{"subject": true, "resource": true, "action": true}
+
+var errEmpty = errors.New("empty condition")
+
+type token struct {
+	kind string // ident, string, number, op or eof
+	text string
+	pos  int
+}
+
+func tokenize(src string) ([]token, error) {
+	var ts []token
+	i := 0
+	for i < len(src) {
+		c := rune(src[i])
+		switch {
+		case unicode.IsSpace(c):
+			i++
+		case c == '\'' || c == '"':
+			end := strings.IndexRune(src[i+1:], c)
+			if end < 0 {
+				return nil, fmt.Errorf("unterminated string at %d", i)
+			}
+			ts = append(ts, token{"string", src[i+1 : i+1+end], i})
+			i += end + 2
+		case unicode.IsDigit(c) || (c == '-' && i+1 < len(src) && unicode.IsDigit(rune(src[i+1]))):
+			j := i + 1
+			for j < len(src) && (unicode.IsDigit(rune(src[j])) || src[j] == '.') {
+				j++
+			}
+			ts = append(ts, token{"number", src[i:j], i})
+			i = j
+		case unicode.IsLetter(c) || c == '_':
+			j := i
+			for j < len(src) && (unicode.IsLetter(rune(src[j])) || unicode.IsDigit(rune(src[j])) || src[j] == '_' || src[j] == '.') {
+				j++
+			}
+			ts = append(ts, token{"ident", src[i:j], i})
+			i = j
+		default:
+			op := ""
+			for _, o := range []string{"==", "!=", "<=", ">=", "<", ">", "(", ")", "[", "]", ","} {
+				if strings.HasPrefix(src[i:], o) {
+					op = o
+					break
+				}
+			}
+			if op == "" {
+				return nil, fmt.Errorf("unexpected %q at %d", c, i)
+			}
+			ts = append(ts, token{"op", op, i})
+			i += len(op)
+		}
+	}
+	return append(ts, token{"eof", "", len(src)}), nil
+}
+
+type parser struct {
+	ts  []token
+	pos int
+}
+
+// parse compiles a condition.
+func parse(src string) (node, error) {
+	if strings.TrimSpace(src) == "" {
+		return nil, errEmpty
+	}
+
+	ts, err := tokenize(src)
+	if err != nil {
+		return nil, err
+	}
+
+	p := &parser{ts: ts}
+	n, err := p.or()
+	if err != nil {
+		return nil, err
+	}
+	if t := p.peek(); t.kind != "eof" {
+		return nil, fmt.Errorf("unexpected %q at %d", t.text, t.pos)
+	}
+	return n, nil
+}
+
+func (p *parser) peek() token {
+	return p.ts[p.pos]
+}
+
+func (p *parser) next() token {
+	t := p.ts[p.pos]
+	if t.kind != "eof" {
+		p.pos++
+	}
+	return t
+}
+
+// punct reports whether t is the punctuation op, so a string such as "]" is
+// never taken for one.
+func (t token) punct(op string) bool {
+	return t.kind == "op" && t.text == op
+}
+
+func (p *parser) keyword(word string) bool {
+	if t := p.peek(); t.kind == "ident" && t.text == word {
+		p.pos++
+		return true
+	}
+	return false
+}
+
+func (p *parser) or() (node, error) {
+	x, err := p.and()
+	if err != nil {
+		return nil, err
+	}
+	for p.keyword("or") {
+		y, err := p.and()
+		if err != nil {
+			return nil, err
+		}
+		x = logical{"or", x, y}
+	}
+	return x, nil
+}
+
+func (p *parser) and() (node, error) {
+	x, err := p.not()
+	if err != nil {
+		return nil, err
+	}
+	for p.keyword("and") {
+		y, err := p.not()
+		if err != nil {
+			return nil, err
+		}
+		x = logical{"and", x, y}
+	}
+	return x, nil
+}
+
+func (p *parser) not() (node, error) {
+	if p.keyword("not") {
+		x, err := p.not()
+		if err != nil {
+			return nil, err
+		}
+		return not{x}, nil
+	}
+	return p.comparison()
+}
+
+func (p *parser) comparison() (node, error) {
+	x, err := p.operand()
+	if err != nil {
+		return nil, err
+	}
+
+	op := ""
+	switch t := p.peek(); {
+	case t.kind == "op" && strings.ContainsAny(t.text, "=<>!"):
+		op = p.next().text
+	case p.keyword("in"):
+		op = "in"
+	case p.keyword("contains"):
+		op = "contains"
+	case t.kind == "ident" && t.text == "not" && p.ts[p.pos+1].kind == "ident" && p.ts[p.pos+1].text == "in":
+		p.pos += 2
+		op = "not in"
+	default:
+		return x, nil
+	}
+
+	y, err := p.operand()
+	if err != nil {
+		return nil, err
+	}
+	return comparison{op, x, y}, nil
+}
+
+func (p *parser) operand() (node, error) {
+	t := p.next()
+	switch t.kind {
+	case "string":
+		return literal{t.text}, nil
+	case "number":
+		f, err := strconv.ParseFloat(t.text, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid number %q at %d", t.text, t.pos)
+		}
+		return literal{f}, nil
+	case "ident":
+		switch t.text {
+		case "true":
+			return literal{true}, nil
+		case "false":
+			return literal{false}, nil
+		case "null":
+			return literal{nil}, nil
+		case "and", "or", "not", "in", "contains":
+			return nil, fmt.Errorf("unexpected %q at %d", t.text, t.pos)
+		}
+		keys := strings.Split(t.text, ".")
+		if !roots[keys[0]] {
+			return nil, fmt.Errorf("unknown name %q at %d, paths start with subject, resource or action", keys[0], t.pos)
+		}
+		for _, k := range keys {
+			if k == "" {
+				return nil, fmt.Errorf("invalid path %q at %d", t.text, t.pos)
+			}
+		}
+		return path(keys), nil
+	case "op":
+		switch t.text {
+		case "(":
+			x, err := p.or()
+			if err != nil {
+				return nil, err
+			}
+			if t := p.next(); !t.punct(")") {
+				return nil, fmt.Errorf("expected ) at %d", t.pos)
+			}
+			return x, nil
+		case "[":
+			l := list{}
+			if p.peek().punct("]") {
+				p.next()
+				return l, nil
+			}
+			for {
+				item, err := p.operand()
+				if err != nil {
+					return nil, err
+				}
+				l = append(l, item)
+				t := p.next()
+				if t.punct("]") {
+					return l, nil
+				}
+				if !t.punct(",") {
+					return nil, fmt.Errorf("expected , or ] at %d", t.pos)
+				}
+			}
+		}
+	case "eof":
+		return nil, errors.New("unexpected end of condition")
+	}
+	return nil, fmt.Errorf("unexpected %q at %d", t.text, t.pos)
+}
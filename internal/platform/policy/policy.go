@@ -0,0 +1,413 @@
+// Package policy decides requests by attribute-based rules that sit on top
+// of roles and permissions: permissions say who may edit books at all,
+// policies which books, e.g. only those in the categories a user curates.
+package policy
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+
+	"github.com/axwilliams/book-api/internal/platform/web"
+)
+
+const (
+	EffectAllow = "allow"
+	EffectDeny  = "deny"
+)
+
+// Any matches every action or resource type.
+const Any = "*"
+
+var ErrDenied = errors.New("Denied by policy")
+
+// Policy allows or denies actions on one type of resource when its
+// condition holds. A policy without a condition always holds.
+type Policy struct {
+	ID          string   `json:"id"`
+	Description string   `json:"description,omitempty"`
+	Effect      string   `json:"effect"`
+	Actions     []string `json:"actions"`
+	Resource    string   `json:"resource"`
+	Condition   string   `json:"condition,omitempty"`
+	File        string   `json:"file"`
+
+	cond node
+}
+
+// File is the content of a policy file.
+type File struct {
+	Policies []Policy `json:"policies"`
+}
+
+func (p *Policy) applies(action, resource string) bool {
+	if p.Resource != Any && p.Resource != resource {
+		return false
+	}
+	for _, a := range p.Actions {
+		if a == Any || a == action {
+			return true
+		}
+	}
+	return false
+}
+
+// Subject is who makes a request. Attributes are loaded with the engine's
+// AttributeSource when they are nil.
+type Subject struct {
+	ID          string                 `json:"id"`
+	Roles       []string               `json:"roles"`
+	Permissions []string               `json:"permissions"`
+	Attributes  map[string]interface{} `json:"attributes,omitempty"`
+}
+
+// Resource is what a request acts on.
+type Resource struct {
+	Type       string                 `json:"type"`
+	ID         string                 `json:"id,omitempty"`
+	Attributes map[string]interface{} `json:"attributes,omitempty"`
+}
+
+type Input struct {
+	Subject  Subject  `json:"subject"`
+	Action   string   `json:"action"`
+	Resource Resource `json:"resource"`
+}
+
+// Result is how one policy that applied to a request evaluated.
+type Result struct {
+	ID     string `json:"id"`
+	Effect string `json:"effect"`
+	Holds  bool   `json:"holds"`
+	Error  string `json:"error,omitempty"`
+}
+
+// Decision explains why a request was allowed or denied.
+type Decision struct {
+	Allowed  bool     `json:"allowed"`
+	Reason   string   `json:"reason"`
+	Input    Input    `json:"input"`
+	Policies []Result `json:"policies"`
+}
+
+// AttributeSource returns the attributes of a subject, e.g. from the user
+// record.
+type AttributeSource func(subjectID string) (map[string]interface{}, error)
+
+// Engine evaluates the policies in the *.json files of a directory. It
+// combines them like this:
+//
+//   - a deny policy that holds denies the request
+//   - otherwise, when allow policies apply, one of them has to hold
+//   - otherwise the request is allowed: permissions alone decide
+//
+// A condition that fails to evaluate, e.g. comparing a number with a
+// string, holds for deny policies and not for allow policies.
+type Engine struct {
+	dir string
+
+	mu       sync.RWMutex
+	policies []*Policy
+	stamp    string
+	attrs    AttributeSource
+}
+
+// NewEngine returns an engine without policies, which allows everything
+// until Load is called. An engine without a directory never has policies.
+func NewEngine(dir string) *Engine {
+	return &Engine{dir: dir}
+}
+
+// UseAttributes makes the engine load subject attributes from src.
+func (e *Engine) UseAttributes(src AttributeSource) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	e.attrs = src
+}
+
+// Policies returns the loaded policies in the order they were read.
+func (e *Engine) Policies() []Policy {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+
+	ps := make([]Policy, 0, len(e.policies))
+	for _, p := range e.policies {
+		ps = append(ps, *p)
+	}
+	return ps
+}
+
+// Load replaces the policies with those in the directory and returns how
+// many there are. On error the current policies stay in use, so a typo in
+// a file does not open or lock up the API.
+func (e *Engine) Load() (int, error) {
+	stamp, err := e.fingerprint()
+	if err != nil {
+		return 0, err
+	}
+
+	paths, err := e.files()
+	if err != nil {
+		return 0, err
+	}
+
+	ids := map[string]string{}
+	var policies []*Policy
+	for _, path := range paths {
+		ps, err := parseFile(path)
+		if err != nil {
+			return 0, err
+		}
+		for _, p := range ps {
+			if other, ok := ids[p.ID]; ok {
+				return 0, fmt.Errorf("Loading policies: %s: policy %q is also defined in %s", p.File, p.ID, other)
+			}
+			ids[p.ID] = p.File
+			policies = append(policies, p)
+		}
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	e.policies = policies
+	e.stamp = stamp
+	return len(policies), nil
+}
+
+// Reload loads the policies again when a file was added, changed or
+// removed since the last Load, and reports whether it did.
+func (e *Engine) Reload() (bool, error) {
+	stamp, err := e.fingerprint()
+	if err != nil {
+		return false, err
+	}
+
+	e.mu.RLock()
+	same := stamp == e.stamp
+	e.mu.RUnlock()
+
+	if same {
+		return false, nil
+	}
+
+	_, err = e.Load()
+	return err == nil, err
+}
+
+// fingerprint sums up the names, sizes and modification times of the
+// policy files.
+func (e *Engine) fingerprint() (string, error) {
+	paths, err := e.files()
+	if err != nil {
+		return "", err
+	}
+
+	var b bytes.Buffer
+	for _, path := range paths {
+		fi, err := os.Stat(path)
+		if err != nil {
+			return "", fmt.Errorf("Reading policy: %w", err)
+		}
+		fmt.Fprintf(&b, "%s %d %d\n", path, fi.Size(), fi.ModTime().UnixNano())
+	}
+	return b.String(), nil
+}
+
+func (e *Engine) files() ([]string, error) {
+	if e.dir == "" {
+		return nil, nil
+	}
+	if _, err := os.Stat(e.dir); err != nil {
+		return nil, fmt.Errorf("Listing policies: %w", err)
+	}
+
+	paths, err := filepath.Glob(filepath.Join(e.dir, "*.json"))
+	if err != nil {
+		return nil, fmt.Errorf("Listing policies: %w", err)
+	}
+	sort.Strings(paths)
+	return paths, nil
+}
+
+func parseFile(path string) ([]*Policy, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("Reading policy: %w", err)
+	}
+
+	name := filepath.Base(path)
+
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+
+	var f File
+	if err := dec.Decode(&f); err != nil {
+		return nil, fmt.Errorf("Loading policies: %s: %w", name, err)
+	}
+
+	ps := make([]*Policy, 0, len(f.Policies))
+	for i := range f.Policies {
+		p := f.Policies[i]
+		p.File = name
+
+		switch {
+		case p.ID == "":
+			return nil, fmt.Errorf("Loading policies: %s: policy %d has no id", name, i+1)
+		case p.Effect != EffectAllow && p.Effect != EffectDeny:
+			return nil, fmt.Errorf("Loading policies: %s: %s: effect must be allow or deny", name, p.ID)
+		case len(p.Actions) == 0:
+			return nil, fmt.Errorf("Loading policies: %s: %s: no actions", name, p.ID)
+		case p.Resource == "":
+			return nil, fmt.Errorf("Loading policies: %s: %s: no resource", name, p.ID)
+		}
+
+		if p.Condition != "" {
+			if p.cond, err = parse(p.Condition); err != nil {
+				return nil, fmt.Errorf("Loading policies: %s: %s: %w", name, p.ID, err)
+			}
+		}
+		ps = append(ps, &p)
+	}
+	return ps, nil
+}
+
+// Resolve returns sub with its attributes loaded, so that a request
+// checked several times loads them only once. A subject that already has
+// attributes is returned as it is.
+func (e *Engine) Resolve(sub Subject) (Subject, error) {
+	e.mu.RLock()
+	attrs := e.attrs
+	e.mu.RUnlock()
+
+	if sub.Attributes != nil || sub.ID == "" || attrs == nil {
+		return sub, nil
+	}
+
+	a, err := attrs(sub.ID)
+	if err != nil {
+		return sub, fmt.Errorf("Loading subject attributes: %w", err)
+	}
+	if a == nil {
+		a = map[string]interface{}{}
+	}
+	sub.Attributes = a
+	return sub, nil
+}
+
+// Evaluate decides in. It only fails when the subject's attributes cannot
+// be loaded.
+func (e *Engine) Evaluate(in Input) (*Decision, error) {
+	sub, err := e.Resolve(in.Subject)
+	if err != nil {
+		return nil, err
+	}
+	in.Subject = sub
+
+	e.mu.RLock()
+	policies := e.policies
+	e.mu.RUnlock()
+
+	d := &Decision{Input: in, Policies: []Result{}}
+	env := environment(in)
+
+	var denied, allowed string
+	allows := 0
+
+	for _, p := range policies {
+		if !p.applies(in.Action, in.Resource.Type) {
+			continue
+		}
+
+		r := Result{ID: p.ID, Effect: p.Effect, Holds: true}
+		if p.cond != nil {
+			holds, err := boolean(p.cond, env)
+			if err != nil {
+				r.Error = err.Error()
+				holds = p.Effect == EffectDeny
+			}
+			r.Holds = holds
+		}
+		d.Policies = append(d.Policies, r)
+
+		switch {
+		case p.Effect == EffectDeny && r.Holds && denied == "":
+			denied = p.ID
+		case p.Effect == EffectAllow:
+			allows++
+			if r.Holds && allowed == "" {
+				allowed = p.ID
+			}
+		}
+	}
+
+	switch {
+	case denied != "":
+		d.Reason = fmt.Sprintf("%s denies %s on %s", denied, in.Action, in.Resource.Type)
+	case allowed != "":
+		d.Allowed = true
+		d.Reason = fmt.Sprintf("%s allows %s on %s", allowed, in.Action, in.Resource.Type)
+	case allows > 0:
+		d.Reason = fmt.Sprintf("no policy allows %s on %s", in.Action, in.Resource.Type)
+	default:
+		d.Allowed = true
+		d.Reason = "no policy applies"
+	}
+
+	return d, nil
+}
+
+// environment is what paths in conditions look up. The attributes of the
+// subject and the resource sit next to their id, roles and type, which
+// take precedence.
+func environment(in Input) map[string]interface{} {
+	subject := map[string]interface{}{}
+	for k, v := range in.Subject.Attributes {
+		subject[k] = v
+	}
+	subject["id"] = in.Subject.ID
+	subject["roles"] = stringList(in.Subject.Roles)
+	subject["permissions"] = stringList(in.Subject.Permissions)
+
+	resource := map[string]interface{}{}
+	for k, v := range in.Resource.Attributes {
+		resource[k] = v
+	}
+	resource["type"] = in.Resource.Type
+	resource["id"] = in.Resource.ID
+
+	return map[string]interface{}{
+		"subject":  subject,
+		"resource": resource,
+		"action":   in.Action,
+	}
+}
+
+func stringList(ss []string) []interface{} {
+	vs := make([]interface{}, len(ss))
+	for i, s := range ss {
+		vs[i] = s
+	}
+	return vs
+}
+
+// Authorize returns a 403 RequestError when the policies deny sub action
+// on res.
+func (e *Engine) Authorize(sub Subject, action string, res Resource) error {
+	d, err := e.Evaluate(Input{Subject: sub, Action: action, Resource: res})
+	if err != nil {
+		return err
+	}
+	if !d.Allowed {
+		return web.NewRequestError(fmt.Errorf("%w: %s", ErrDenied, d.Reason), http.StatusForbidden)
+	}
+	return nil
+}
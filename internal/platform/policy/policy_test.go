@@ -0,0 +1,266 @@
+package policy
+
+import (
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/axwilliams/book-api/internal/platform/web"
+	"github.com/axwilliams/book-api/internal/test"
+)
+
+func TestConditions(t *testing.T) {
+	env := environment(Input{
+		Subject: Subject{
+			ID:         "69a47775-6d89-4d38-ad38-acdb2928f6a1",
+			Roles:      []string{"AUTHOR"},
+			Attributes: map[string]interface{}{"categories": []interface{}{"Physics", "Poetry"}, "branch": "north", "level": 3},
+		},
+		Action:   "update",
+		Resource: Resource{Type: "book", Attributes: map[string]interface{}{"category": "Physics", "status": "draft", "title": "Six Easy Pieces"}},
+	})
+
+	samples := []struct {
+		cond  string
+		holds bool
+	}{
+		{"resource.category in subject.categories", true},
+		{"resource.category not in subject.categories", false},
+		{"subject.categories contains 'Poetry'", true},
+		{"resource.title contains \"Easy\"", true},
+		{"'ADMIN' in subject.roles or resource.status == 'draft'", true},
+		{"not (resource.status == 'published') and action == 'update'", true},
+		{"subject.level >= 3 and subject.level < 4", true},
+		{"resource.status in ['draft', 'rejected']", true},
+		{"subject.branch == resource.branch", false},
+		{"resource.branch == null", true},
+		{"resource.branch in subject.branches", false},
+		{"subject.missing.deeper == null", true},
+		{"subject.branch != null and subject.branch > 'm'", true},
+	}
+
+	for _, sample := range samples {
+		n, err := parse(sample.cond)
+		if err != nil {
+			t.Fatalf("\t%s\t%s: %v", test.Failed, sample.cond, err)
+		}
+		holds, err := boolean(n, env)
+		if err != nil || holds != sample.holds {
+			t.Fatalf("\t%s\t%s: want %v got %v %v", test.Failed, sample.cond, sample.holds, holds, err)
+		}
+		t.Logf("\t%s\t%s", test.Success, sample.cond)
+	}
+
+	// Conditions that parse but cannot be evaluated on these attributes.
+	for _, cond := range []string{"subject.level > 'two'", "resource.category in resource.title", "resource.category", "subject.level and true"} {
+		n, err := parse(cond)
+		if err != nil {
+			t.Fatalf("\t%s\t%s: %v", test.Failed, cond, err)
+		}
+		if _, err := boolean(n, env); err == nil {
+			t.Fatalf("\t%s\t%s evaluated", test.Failed, cond)
+		}
+		t.Logf("\t%s\t%s fails to evaluate", test.Success, cond)
+	}
+
+	for _, cond := range []string{"", "user.id == 'x'", "resource.category ==", "(action == 'update'", "action = 'update'", "'unterminated", "resource..id == 1", "[1, 2 == action", "resource.category in ['a' ']'", "resource.category in [']'", "(action == 'update' ')'", "resource.category in ['a' ',' 'b']"} {
+		if _, err := parse(cond); err == nil {
+			t.Fatalf("\t%s\t%q parsed", test.Failed, cond)
+		}
+		t.Logf("\t%s\t%q rejected", test.Success, cond)
+	}
+}
+
+const bookPolicies = `{
+	"policies": [
+		{
+			"id": "authors-edit-their-categories",
+			"effect": "allow",
+			"actions": ["update", "delete"],
+			"resource": "book",
+			"condition": "resource.category in subject.categories"
+		},
+		{
+			"id": "admins-edit-everything",
+			"effect": "allow",
+			"actions": ["*"],
+			"resource": "book",
+			"condition": "'ADMIN' in subject.roles"
+		},
+		{
+			"id": "published-books-are-not-deleted",
+			"effect": "deny",
+			"actions": ["delete"],
+			"resource": "book",
+			"condition": "resource.status == 'published'"
+		},
+		{
+			"id": "broken",
+			"effect": "deny",
+			"actions": ["reject"],
+			"resource": "*",
+			"condition": "subject.level > 'two'"
+		}
+	]
+}`
+
+func writePolicies(t *testing.T, dir, name, content string) {
+	if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestEngine(t *testing.T) {
+	dir, err := ioutil.TempDir("", "policies")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	writePolicies(t, dir, "books.json", bookPolicies)
+
+	e := NewEngine(dir)
+	loads := 0
+	e.UseAttributes(func(id string) (map[string]interface{}, error) {
+		loads++
+		if id == "curator" {
+			return map[string]interface{}{"categories": []string{"Physics"}}, nil
+		}
+		return nil, nil
+	})
+	if n, err := e.Load(); err != nil || n != 4 {
+		t.Fatalf("\t%s\tLoading failed: %d %v", test.Failed, n, err)
+	}
+
+	physics := Resource{Type: "book", Attributes: map[string]interface{}{"category": "Physics", "status": "draft"}}
+	poetry := Resource{Type: "book", Attributes: map[string]interface{}{"category": "Poetry", "status": "draft"}}
+	published := Resource{Type: "book", Attributes: map[string]interface{}{"category": "Physics", "status": "published"}}
+
+	curator := Subject{ID: "curator", Roles: []string{"AUTHOR"}}
+	admin := Subject{ID: "admin", Roles: []string{"ADMIN"}}
+
+	samples := []struct {
+		name    string
+		in      Input
+		allowed bool
+		reason  string
+	}{
+		{"Category the user curates", Input{curator, "update", physics}, true, "authors-edit-their-categories allows update on book"},
+		{"Other category", Input{curator, "update", poetry}, false, "no policy allows update on book"},
+		{"Admin", Input{admin, "update", poetry}, true, "admins-edit-everything allows update on book"},
+		{"Deny overrides allow", Input{admin, "delete", published}, false, "published-books-are-not-deleted denies delete on book"},
+		{"No policy applies", Input{curator, "update", Resource{Type: "series"}}, true, "no policy applies"},
+		{"Failing deny holds", Input{admin, "reject", physics}, false, "broken denies reject on book"},
+	}
+
+	for _, sample := range samples {
+		d, err := e.Evaluate(sample.in)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if d.Allowed != sample.allowed || d.Reason != sample.reason {
+			t.Fatalf("\t%s\t%s: want %v %q got %v %q", test.Failed, sample.name, sample.allowed, sample.reason, d.Allowed, d.Reason)
+		}
+		t.Logf("\t%s\t%s", test.Success, sample.name)
+	}
+
+	d, _ := e.Evaluate(Input{admin, "reject", physics})
+	if len(d.Policies) != 2 || d.Policies[1].ID != "broken" || d.Policies[1].Error == "" {
+		t.Fatalf("\t%s\tWrong explanation: %+v", test.Failed, d.Policies)
+	}
+	t.Logf("\t%s\tExplanation lists the policies that applied", test.Success)
+
+	err = e.Authorize(curator, "update", poetry)
+	if re, ok := err.(*web.RequestError); !ok || re.Status != http.StatusForbidden || !errors.Is(re.Err, ErrDenied) {
+		t.Fatalf("\t%s\tWant 403 got %v", test.Failed, err)
+	}
+	if err := e.Authorize(curator, "update", physics); err != nil {
+		t.Fatalf("\t%s\tAllowed request refused: %v", test.Failed, err)
+	}
+	t.Logf("\t%s\tAuthorize enforces decisions", test.Success)
+
+	loads = 0
+	sub, err := e.Resolve(admin)
+	if err != nil || sub.Attributes == nil {
+		t.Fatalf("\t%s\tResolving the subject failed: %+v %v", test.Failed, sub, err)
+	}
+	for _, res := range []Resource{physics, poetry} {
+		if err := e.Authorize(sub, "update", res); err != nil {
+			t.Fatalf("\t%s\tAllowed request refused: %v", test.Failed, err)
+		}
+	}
+	if loads != 1 {
+		t.Fatalf("\t%s\tWant attributes loaded once got %d", test.Failed, loads)
+	}
+	t.Logf("\t%s\tA resolved subject keeps its attributes", test.Success)
+}
+
+func TestReload(t *testing.T) {
+	dir, err := ioutil.TempDir("", "policies")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	writePolicies(t, dir, "books.json", bookPolicies)
+
+	e := NewEngine(dir)
+	if _, err := e.Load(); err != nil {
+		t.Fatal(err)
+	}
+	if reloaded, err := e.Reload(); reloaded || err != nil {
+		t.Fatalf("\t%s\tReloaded unchanged files: %v", test.Failed, err)
+	}
+	t.Logf("\t%s\tUnchanged files not reloaded", test.Success)
+
+	broken := []struct {
+		name    string
+		content string
+	}{
+		{"Invalid JSON", `{"policies": [`},
+		{"Unknown field", `{"policies": [{"id": "x", "effect": "allow", "actions": ["update"], "resource": "book", "when": "true"}]}`},
+		{"Unknown effect", `{"policies": [{"id": "x", "effect": "permit", "actions": ["update"], "resource": "book"}]}`},
+		{"No actions", `{"policies": [{"id": "x", "effect": "allow", "resource": "book"}]}`},
+		{"Bad condition", `{"policies": [{"id": "x", "effect": "allow", "actions": ["update"], "resource": "book", "condition": "resource.category in"}]}`},
+		{"Duplicate ID", `{"policies": [{"id": "admins-edit-everything", "effect": "allow", "actions": ["update"], "resource": "book"}]}`},
+	}
+
+	for _, sample := range broken {
+		writePolicies(t, dir, "extra.json", sample.content)
+		// Make sure the modification time moves on coarse file systems.
+		os.Chtimes(filepath.Join(dir, "extra.json"), time.Now(), time.Now().Add(time.Duration(len(sample.name))*time.Second))
+
+		if _, err := e.Reload(); err == nil {
+			t.Fatalf("\t%s\t%s loaded", test.Failed, sample.name)
+		}
+		if len(e.Policies()) != 4 {
+			t.Fatalf("\t%s\t%s changed the policies", test.Failed, sample.name)
+		}
+		t.Logf("\t%s\t%s rejected, policies kept", test.Success, sample.name)
+	}
+
+	writePolicies(t, dir, "extra.json", `{"policies": [{"id": "no-rejections", "effect": "deny", "actions": ["reject"], "resource": "book"}]}`)
+	os.Chtimes(filepath.Join(dir, "extra.json"), time.Now(), time.Now().Add(time.Minute))
+	if reloaded, err := e.Reload(); !reloaded || err != nil || len(e.Policies()) != 5 {
+		t.Fatalf("\t%s\tNew file not loaded: %v", test.Failed, err)
+	}
+	t.Logf("\t%s\tNew file loaded", test.Success)
+
+	os.Remove(filepath.Join(dir, "extra.json"))
+	if reloaded, err := e.Reload(); !reloaded || err != nil || len(e.Policies()) != 4 {
+		t.Fatalf("\t%s\tRemoved file still loaded: %v", test.Failed, err)
+	}
+	t.Logf("\t%s\tRemoved file unloaded", test.Success)
+
+	if _, err := NewEngine(filepath.Join(dir, "missing")).Load(); err == nil {
+		t.Fatalf("\t%s\tMissing directory loaded", test.Failed)
+	}
+	if n, err := NewEngine("").Load(); n != 0 || err != nil {
+		t.Fatalf("\t%s\tEngine without a directory failed: %v", test.Failed, err)
+	}
+	t.Logf("\t%s\tDirectories checked", test.Success)
+}
@@ -0,0 +1,503 @@
+// Package sqlite reads the tables of an SQLite 3 database file held in
+// memory. It only walks table b-trees: indexes, views and write-ahead logs
+// are ignored, which is enough to pull the rows out of an exported file
+// without a cgo driver.
+package sqlite
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+)
+
+var (
+	ErrNotSQLite   = errors.New("File is not an SQLite 3 database")
+	ErrEncoding    = errors.New("Only UTF-8 databases are supported")
+	ErrCorrupt     = errors.New("Database file is malformed")
+	ErrNoSuchTable = errors.New("No such table")
+)
+
+const (
+	headerMagic  = "SQLite format 3\x00"
+	headerLength = 100
+
+	pageInterior = 0x05
+	pageLeaf     = 0x0d
+
+	// maxDepth bounds the b-tree walk. Pages reached twice are refused as
+	// well, so that pages pointing at each other cannot loop forever or
+	// make the walk grow exponentially.
+	maxDepth = 64
+)
+
+// Row maps column names to values. Values are int64, float64, string,
+// []byte or nil.
+type Row map[string]interface{}
+
+// Int returns the column as an integer, or 0 when it holds something else.
+func (r Row) Int(col string) int64 {
+	switch v := r[col].(type) {
+	case int64:
+		return v
+	case float64:
+		return int64(v)
+	}
+	return 0
+}
+
+// Float returns the column as a float, or 0 when it is not a number.
+func (r Row) Float(col string) float64 {
+	switch v := r[col].(type) {
+	case int64:
+		return float64(v)
+	case float64:
+		return v
+	}
+	return 0
+}
+
+// Text returns the column as a string, or "" when it is NULL or a number.
+func (r Row) Text(col string) string {
+	switch v := r[col].(type) {
+	case string:
+		return v
+	case []byte:
+		return string(v)
+	}
+	return ""
+}
+
+type table struct {
+	root    uint32
+	columns []string
+	rowid   int // index of the INTEGER PRIMARY KEY column, or -1
+}
+
+// DB is an opened database file.
+type DB struct {
+	data     []byte
+	pageSize int
+	usable   int
+	tables   map[string]table
+}
+
+// Open checks the header and reads the schema.
+func Open(data []byte) (*DB, error) {
+	if len(data) < headerLength || string(data[:16]) != headerMagic {
+		return nil, ErrNotSQLite
+	}
+
+	pageSize := int(binary.BigEndian.Uint16(data[16:18]))
+	if pageSize == 1 {
+		pageSize = 65536
+	}
+	if pageSize < 512 || pageSize&(pageSize-1) != 0 {
+		return nil, ErrCorrupt
+	}
+
+	if enc := binary.BigEndian.Uint32(data[56:60]); enc != 0 && enc != 1 {
+		return nil, ErrEncoding
+	}
+
+	db := &DB{
+		data:     data,
+		pageSize: pageSize,
+		usable:   pageSize - int(data[20]),
+		tables:   map[string]table{},
+	}
+
+	master := table{root: 1, columns: []string{"type", "name", "tbl_name", "rootpage", "sql"}, rowid: -1}
+
+	err := db.walk(master, func(r Row) error {
+		// WITHOUT ROWID tables are stored as index b-trees, which are not read.
+		sql := r.Text("sql")
+		if r.Text("type") != "table" || strings.Contains(strings.ToUpper(sql), "WITHOUT ROWID") {
+			return nil
+		}
+		cols, rowid := columns(sql)
+		db.tables[strings.ToLower(r.Text("name"))] = table{root: uint32(r.Int("rootpage")), columns: cols, rowid: rowid}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("Reading schema: %w", err)
+	}
+
+	return db, nil
+}
+
+// HasTable reports whether the schema declares a table of that name.
+func (db *DB) HasTable(name string) bool {
+	_, ok := db.tables[strings.ToLower(name)]
+	return ok
+}
+
+// Rows returns every row of a table in rowid order.
+func (db *DB) Rows(name string) ([]Row, error) {
+	t, ok := db.tables[strings.ToLower(name)]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrNoSuchTable, name)
+	}
+
+	rows := []Row{}
+	err := db.walk(t, func(r Row) error {
+		rows = append(rows, r)
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("Reading table %s: %w", name, err)
+	}
+
+	return rows, nil
+}
+
+func (db *DB) page(n uint32) ([]byte, error) {
+	start := int(n-1) * db.pageSize
+	if n == 0 || start+db.pageSize > len(db.data) {
+		return nil, ErrCorrupt
+	}
+	return db.data[start : start+db.pageSize], nil
+}
+
+func (db *DB) walk(t table, fn func(Row) error) error {
+	return db.walkPage(t, t.root, 0, map[uint32]bool{}, fn)
+}
+
+func (db *DB) walkPage(t table, n uint32, depth int, seen map[uint32]bool, fn func(Row) error) error {
+	if depth > maxDepth || seen[n] {
+		return ErrCorrupt
+	}
+	seen[n] = true
+
+	p, err := db.page(n)
+	if err != nil {
+		return err
+	}
+
+	// Page 1 starts with the database header.
+	hdr := 0
+	if n == 1 {
+		hdr = headerLength
+	}
+	if len(p) < hdr+12 {
+		return ErrCorrupt
+	}
+
+	kind := p[hdr]
+	cells := int(binary.BigEndian.Uint16(p[hdr+3:]))
+
+	ptrs := hdr + 8
+	if kind == pageInterior {
+		ptrs = hdr + 12
+	} else if kind != pageLeaf {
+		return ErrCorrupt
+	}
+	if ptrs+2*cells > len(p) {
+		return ErrCorrupt
+	}
+
+	for i := 0; i < cells; i++ {
+		off := int(binary.BigEndian.Uint16(p[ptrs+2*i:]))
+		if off >= db.usable {
+			return ErrCorrupt
+		}
+
+		if kind == pageInterior {
+			if off+4 > len(p) {
+				return ErrCorrupt
+			}
+			if err := db.walkPage(t, binary.BigEndian.Uint32(p[off:]), depth+1, seen, fn); err != nil {
+				return err
+			}
+			continue
+		}
+
+		r, err := db.leafCell(t, p, off)
+		if err != nil {
+			return err
+		}
+		if err := fn(r); err != nil {
+			return err
+		}
+	}
+
+	if kind == pageInterior {
+		return db.walkPage(t, binary.BigEndian.Uint32(p[hdr+8:]), depth+1, seen, fn)
+	}
+
+	return nil
+}
+
+func (db *DB) leafCell(t table, p []byte, off int) (Row, error) {
+	size, n := varint(p[off:])
+	if n == 0 || size > uint64(len(db.data)) {
+		return nil, ErrCorrupt
+	}
+	off += n
+
+	rowid, n := varint(p[off:])
+	if n == 0 {
+		return nil, ErrCorrupt
+	}
+	off += n
+
+	payload, err := db.payload(p, off, int(size))
+	if err != nil {
+		return nil, err
+	}
+
+	vals, err := record(payload)
+	if err != nil {
+		return nil, err
+	}
+
+	r := Row{}
+	for i, col := range t.columns {
+		// Columns added by ALTER TABLE are missing from older records.
+		if i < len(vals) {
+			r[col] = vals[i]
+		} else {
+			r[col] = nil
+		}
+	}
+	if t.rowid >= 0 {
+		r[t.columns[t.rowid]] = int64(rowid)
+	}
+
+	return r, nil
+}
+
+// payload gathers a cell's record, following the overflow chain when it
+// does not fit on the page.
+func (db *DB) payload(p []byte, off, size int) ([]byte, error) {
+	if size < 0 || size > len(db.data) {
+		return nil, ErrCorrupt
+	}
+
+	u := db.usable
+	max := u - 35
+
+	local := size
+	if size > max {
+		min := (u-12)*32/255 - 23
+		local = min + (size-min)%(u-4)
+		if local > max {
+			local = min
+		}
+	}
+
+	if off+local > len(p) {
+		return nil, ErrCorrupt
+	}
+	if local == size {
+		return p[off : off+size], nil
+	}
+
+	if off+local+4 > len(p) {
+		return nil, ErrCorrupt
+	}
+
+	out := make([]byte, 0, size)
+	out = append(out, p[off:off+local]...)
+	next := binary.BigEndian.Uint32(p[off+local:])
+
+	for len(out) < size {
+		op, err := db.page(next)
+		if err != nil {
+			return nil, err
+		}
+
+		chunk := size - len(out)
+		if chunk > u-4 {
+			chunk = u - 4
+		}
+		out = append(out, op[4:4+chunk]...)
+		next = binary.BigEndian.Uint32(op)
+
+		if next == 0 && len(out) < size {
+			return nil, ErrCorrupt
+		}
+	}
+
+	return out, nil
+}
+
+// varint decodes a big-endian variable length integer of up to nine bytes.
+// It returns 0 bytes read when b is too short.
+func varint(b []byte) (uint64, int) {
+	var v uint64
+	for i := 0; i < 9; i++ {
+		if i >= len(b) {
+			return 0, 0
+		}
+		if i == 8 {
+			return v<<8 | uint64(b[i]), 9
+		}
+		v = v<<7 | uint64(b[i]&0x7f)
+		if b[i]&0x80 == 0 {
+			return v, i + 1
+		}
+	}
+	return v, 9
+}
+
+// record decodes the values of a record in column order.
+func record(b []byte) ([]interface{}, error) {
+	size, n := varint(b)
+	if n == 0 || size > uint64(len(b)) {
+		return nil, ErrCorrupt
+	}
+	hdrSize := int(size)
+
+	types := []uint64{}
+	for off := n; off < hdrSize; {
+		st, n := varint(b[off:hdrSize])
+		if n == 0 {
+			return nil, ErrCorrupt
+		}
+		types = append(types, st)
+		off += n
+	}
+
+	vals := make([]interface{}, 0, len(types))
+	body := b[hdrSize:]
+
+	for _, st := range types {
+		size := serialSize(st)
+		if size > uint64(len(body)) {
+			return nil, ErrCorrupt
+		}
+		v := body[:size]
+		body = body[size:]
+
+		switch {
+		case st == 0:
+			vals = append(vals, nil)
+		case st <= 6:
+			vals = append(vals, signed(v))
+		case st == 7:
+			vals = append(vals, math.Float64frombits(binary.BigEndian.Uint64(v)))
+		case st == 8:
+			vals = append(vals, int64(0))
+		case st == 9:
+			vals = append(vals, int64(1))
+		case st >= 12 && st%2 == 0:
+			vals = append(vals, append([]byte(nil), v...))
+		case st >= 13:
+			vals = append(vals, string(v))
+		default:
+			return nil, ErrCorrupt
+		}
+	}
+
+	return vals, nil
+}
+
+// serialSize returns the length of a value of serial type st. It is left
+// unsigned so that callers compare it before using it as an index.
+func serialSize(st uint64) uint64 {
+	switch {
+	case st <= 4:
+		return st
+	case st == 5:
+		return 6
+	case st == 6 || st == 7:
+		return 8
+	case st >= 12:
+		return (st - 12) / 2
+	}
+	return 0
+}
+
+func signed(b []byte) int64 {
+	var v int64
+	if len(b) > 0 && b[0]&0x80 != 0 {
+		v = -1
+	}
+	for _, c := range b {
+		v = v<<8 | int64(c)
+	}
+	return v
+}
+
+// columns lists the column names of a CREATE TABLE statement and the
+// position of the column that aliases the rowid, if any.
+func columns(sql string) ([]string, int) {
+	start, end := strings.Index(sql, "("), strings.LastIndex(sql, ")")
+	if start < 0 || end <= start {
+		return nil, -1
+	}
+
+	cols := []string{}
+	rowid := -1
+
+	for _, def := range splitDefinitions(sql[start+1 : end]) {
+		fields := strings.Fields(def)
+		if len(fields) == 0 {
+			continue
+		}
+
+		switch strings.ToUpper(fields[0]) {
+		case "CONSTRAINT", "PRIMARY", "UNIQUE", "CHECK", "FOREIGN":
+			continue
+		}
+
+		upper := strings.ToUpper(strings.Join(fields, " "))
+		if len(fields) > 1 && strings.ToUpper(fields[1]) == "INTEGER" && strings.Contains(upper, "PRIMARY KEY") &&
+			!strings.Contains(upper, "PRIMARY KEY DESC") {
+			rowid = len(cols)
+		}
+
+		cols = append(cols, unquote(fields[0]))
+	}
+
+	return cols, rowid
+}
+
+// splitDefinitions splits a table body on the commas that are not inside
+// parentheses or quotes.
+func splitDefinitions(body string) []string {
+	defs := []string{}
+	depth, last := 0, 0
+	var quote byte
+
+	for i := 0; i < len(body); i++ {
+		c := body[i]
+		switch {
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case c == '\'' || c == '"' || c == '`':
+			quote = c
+		case c == '[':
+			quote = ']'
+		case c == '(':
+			depth++
+		case c == ')':
+			depth--
+		case c == ',' && depth == 0:
+			defs = append(defs, body[last:i])
+			last = i + 1
+		}
+	}
+
+	return append(defs, body[last:])
+}
+
+func unquote(name string) string {
+	if len(name) >= 2 {
+		switch name[0] {
+		case '"', '`', '\'':
+			if name[len(name)-1] == name[0] {
+				return name[1 : len(name)-1]
+			}
+		case '[':
+			if name[len(name)-1] == ']' {
+				return name[1 : len(name)-1]
+			}
+		}
+	}
+	return name
+}
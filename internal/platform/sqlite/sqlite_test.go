@@ -0,0 +1,148 @@
+package sqlite_test
+
+import (
+	"errors"
+	"io/ioutil"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/axwilliams/book-api/internal/platform/sqlite"
+	"github.com/axwilliams/book-api/internal/test"
+)
+
+// testdata/test.db uses 512 byte pages so that its 200 items span interior
+// pages and the long note spills onto overflow pages.
+func open(t *testing.T) *sqlite.DB {
+	data, err := ioutil.ReadFile("testdata/test.db")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	db, err := sqlite.Open(data)
+	if err != nil {
+		t.Fatalf("\t%s\tOpening database failed: %v", test.Failed, err)
+	}
+
+	return db
+}
+
+func TestRows(t *testing.T) {
+	db := open(t)
+
+	items, err := db.Rows("item")
+	if err != nil {
+		t.Fatalf("\t%s\tReading items failed: %v", test.Failed, err)
+	}
+
+	if len(items) != 200 {
+		t.Fatalf("\t%s\tWrong number of items: want 200 got %d", test.Failed, len(items))
+	}
+	for i, r := range items {
+		if r.Int("id") != int64(i+1) {
+			t.Fatalf("\t%s\tItems out of rowid order at %d: %v", test.Failed, i, r)
+		}
+	}
+	t.Logf("\t%s\tRead all items across interior pages", test.Success)
+
+	samples := []struct {
+		row      sqlite.Row
+		expected sqlite.Row
+	}{
+		{items[0], sqlite.Row{"id": int64(1), "name": "item 1", "price": 1.5, "qty": int64(100000), "data": nil}},
+		{items[6], sqlite.Row{"id": int64(7), "name": "item 7", "price": 10.5, "qty": int64(-5), "data": []byte{0x00, 0xff}}},
+		{items[7], sqlite.Row{"id": int64(8), "name": "item 8", "price": nil, "qty": int64(800000), "data": nil}},
+	}
+
+	for _, sample := range samples {
+		if !reflect.DeepEqual(sample.row, sample.expected) {
+			t.Fatalf("\t%s\tWrong row: want %v got %v", test.Failed, sample.expected, sample.row)
+		}
+	}
+	t.Logf("\t%s\tDecoded integers, floats, blobs and nulls", test.Success)
+
+	notes, err := db.Rows("NOTE")
+	if err != nil {
+		t.Fatalf("\t%s\tReading notes failed: %v", test.Failed, err)
+	}
+
+	if len(notes) != 3 {
+		t.Fatalf("\t%s\tWrong number of notes: want 3 got %d", test.Failed, len(notes))
+	}
+
+	long := notes[0].Text("body")
+	if len(long) != 3003 || !strings.HasSuffix(long, "end") {
+		t.Fatalf("\t%s\tWrong overflowing note: %d bytes", test.Failed, len(long))
+	}
+	t.Logf("\t%s\tFollowed overflow pages", test.Success)
+
+	if notes[1]["extra"] != nil || notes[2].Int("extra") != 3000000000 || notes[2].Text("key") != "new" {
+		t.Fatalf("\t%s\tWrong added column: %v %v", test.Failed, notes[1], notes[2])
+	}
+	t.Logf("\t%s\tColumns added later read as null on older rows", test.Success)
+}
+
+func TestOpenInvalid(t *testing.T) {
+	if _, err := sqlite.Open([]byte("not a database")); err != sqlite.ErrNotSQLite {
+		t.Fatalf("\t%s\tWrong error for a file that is not a database: %v", test.Failed, err)
+	}
+	t.Logf("\t%s\tNon-database rejected", test.Success)
+
+	db := open(t)
+	if _, err := db.Rows("missing"); !errors.Is(err, sqlite.ErrNoSuchTable) {
+		t.Fatalf("\t%s\tWrong error for a missing table: %v", test.Failed, err)
+	}
+	if db.HasTable("item_name") {
+		t.Fatalf("\t%s\tIndexes should not be listed as tables", test.Failed)
+	}
+	t.Logf("\t%s\tMissing table reported", test.Success)
+
+	data, _ := ioutil.ReadFile("testdata/test.db")
+	truncated := data[:len(data)/2]
+	if db, err := sqlite.Open(truncated); err == nil {
+		if _, err := db.Rows("item"); err == nil {
+			t.Fatalf("\t%s\tA truncated file should fail to read", test.Failed)
+		}
+	}
+	t.Logf("\t%s\tTruncated file rejected", test.Success)
+}
+
+// build returns a database of 512 byte pages whose first page holds the
+// given b-tree page header and cell pointers after the file header, and the
+// given cell at offset 300. More pages are appended empty.
+func build(pages int, hdr []byte, cell []byte) []byte {
+	data := make([]byte, 512*pages)
+	copy(data, "SQLite format 3\x00")
+	data[16], data[17] = 0x02, 0x00
+	data[59] = 1
+	copy(data[100:], hdr)
+	copy(data[300:], cell)
+
+	// Every other page is an empty leaf.
+	for i := 1; i < pages; i++ {
+		data[512*i] = 0x0d
+	}
+	return data
+}
+
+func TestOpenMalformed(t *testing.T) {
+	ff := []byte{0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff}
+	leaf := []byte{0x0d, 0, 0, 0, 1, 0, 0, 0, 0x01, 0x2c}
+
+	samples := []struct {
+		name string
+		data []byte
+	}{
+		{"Negative payload size", build(1, leaf, append(append([]byte{}, ff...), 0x01))},
+		{"Header larger than the record", build(1, leaf, append([]byte{0x0a, 0x01}, append(ff, 0x00)...))},
+		{"Value larger than the record", build(1, leaf, append([]byte{0x0a, 0x01, 0x0a}, ff...))},
+		{"Page reached twice", build(2, []byte{0x05, 0, 0, 0, 1, 0, 0, 0, 0, 0, 0, 2, 0x01, 0x2c}, []byte{0, 0, 0, 2})},
+	}
+
+	for _, sample := range samples {
+		if _, err := sqlite.Open(sample.data); !errors.Is(err, sqlite.ErrCorrupt) {
+			t.Fatalf("\t%s\t%s: want %v got %v", test.Failed, sample.name, sqlite.ErrCorrupt, err)
+		}
+		t.Logf("\t%s\t%s rejected", test.Success, sample.name)
+	}
+}
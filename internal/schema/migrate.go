@@ -49,6 +49,465 @@ func Migrate(db *sql.DB) error {
 		}
 	}
 
+	_, err = tx.Exec(`ALTER TABLE book ADD COLUMN IF NOT EXISTS status varchar(32) NOT NULL DEFAULT 'published';`)
+	if err != nil {
+		return fmt.Errorf("Altering table: book: status: %w", err)
+	}
+
+	_, err = tx.Exec(`ALTER TABLE book
+						ADD COLUMN IF NOT EXISTS description text NOT NULL DEFAULT '',
+						ADD COLUMN IF NOT EXISTS created_at timestamp NOT NULL DEFAULT now(),
+						ADD COLUMN IF NOT EXISTS updated_at timestamp NOT NULL DEFAULT now();`)
+	if err != nil {
+		return fmt.Errorf("Altering table: book: timestamps: %w", err)
+	}
+
+	_, err = tx.Exec(`CREATE INDEX IF NOT EXISTS book_updated_at ON book (updated_at, id);`)
+	if err != nil {
+		return fmt.Errorf("Creating index: book_updated_at: %w", err)
+	}
+
+	var series string
+	_ = tx.QueryRow("SELECT to_regclass('series')").Scan(&series)
+
+	if series == "" {
+		q := `CREATE TABLE IF NOT EXISTS series(
+						id UUID,
+						name varchar(255) NOT NULL,
+						description text NOT NULL DEFAULT '',
+						PRIMARY KEY (id)
+					);`
+
+		_, err := tx.Exec(q)
+		if err != nil {
+			return fmt.Errorf("Creating table: series: %w", err)
+		}
+	}
+
+	_, err = tx.Exec(`ALTER TABLE book
+						ADD COLUMN IF NOT EXISTS series_id UUID NULL REFERENCES series (id) ON DELETE SET NULL,
+						ADD COLUMN IF NOT EXISTS series_position double precision NULL;`)
+	if err != nil {
+		return fmt.Errorf("Altering table: book: series: %w", err)
+	}
+
+	// Series deleted before Destroy cleared positions left them behind.
+	_, err = tx.Exec("UPDATE book SET series_position = NULL WHERE series_id IS NULL AND series_position IS NOT NULL;")
+	if err != nil {
+		return fmt.Errorf("Clearing positions outside a series: %w", err)
+	}
+
+	var transition string
+	_ = tx.QueryRow("SELECT to_regclass('book_transition')").Scan(&transition)
+
+	if transition == "" {
+		q := `CREATE TABLE IF NOT EXISTS book_transition(
+						id UUID,
+						book_id UUID NOT NULL,
+						action varchar(32) NOT NULL,
+						from_status varchar(32) NOT NULL DEFAULT '',
+						to_status varchar(32) NOT NULL,
+						actor_id UUID NULL,
+						comment text NOT NULL DEFAULT '',
+						created_at timestamp NOT NULL,
+						PRIMARY KEY (id)
+					);
+					CREATE INDEX IF NOT EXISTS book_transition_book_id ON book_transition (book_id, created_at);`
+
+		_, err := tx.Exec(q)
+		if err != nil {
+			return fmt.Errorf("Creating table: book_transition: %w", err)
+		}
+	}
+
+	var similar string
+	_ = tx.QueryRow("SELECT to_regclass('book_similar')").Scan(&similar)
+
+	if similar == "" {
+		q := `CREATE TABLE IF NOT EXISTS book_similar(
+						book_id UUID NOT NULL,
+						similar_id UUID NOT NULL,
+						score double precision NOT NULL,
+						reasons varchar(255)[],
+						computed_at timestamp NOT NULL,
+						PRIMARY KEY (book_id, similar_id)
+					);`
+
+		_, err := tx.Exec(q)
+		if err != nil {
+			return fmt.Errorf("Creating table: book_similar: %w", err)
+		}
+	}
+
+	var tag string
+	_ = tx.QueryRow("SELECT to_regclass('tag')").Scan(&tag)
+
+	if tag == "" {
+		q := `CREATE TABLE IF NOT EXISTS tag(
+						id UUID,
+						name varchar(64) UNIQUE NOT NULL,
+						created_at timestamp NOT NULL,
+						PRIMARY KEY (id)
+					);
+					CREATE TABLE IF NOT EXISTS tag_synonym(
+						name varchar(64) NOT NULL,
+						tag_id UUID NOT NULL REFERENCES tag (id) ON DELETE CASCADE,
+						PRIMARY KEY (name)
+					);
+					CREATE TABLE IF NOT EXISTS book_tag(
+						book_id UUID NOT NULL REFERENCES book (id) ON DELETE CASCADE,
+						tag_id UUID NOT NULL REFERENCES tag (id) ON DELETE CASCADE,
+						user_id UUID NULL,
+						created_at timestamp NOT NULL,
+						PRIMARY KEY (book_id, tag_id)
+					);
+					CREATE INDEX IF NOT EXISTS book_tag_tag_id ON book_tag (tag_id);`
+
+		_, err := tx.Exec(q)
+		if err != nil {
+			return fmt.Errorf("Creating table: tag: %w", err)
+		}
+	}
+
+	var relation string
+	_ = tx.QueryRow("SELECT to_regclass('book_relation')").Scan(&relation)
+
+	if relation == "" {
+		q := `CREATE TABLE IF NOT EXISTS book_relation(
+						id UUID,
+						book_id UUID NOT NULL REFERENCES book (id) ON DELETE CASCADE,
+						type varchar(32) NOT NULL,
+						related_id UUID NOT NULL REFERENCES book (id) ON DELETE CASCADE,
+						created_at timestamp NOT NULL,
+						PRIMARY KEY (id),
+						UNIQUE (book_id, type, related_id)
+					);
+					CREATE INDEX IF NOT EXISTS book_relation_related_id ON book_relation (related_id);`
+
+		_, err := tx.Exec(q)
+		if err != nil {
+			return fmt.Errorf("Creating table: book_relation: %w", err)
+		}
+	}
+
+	var merge string
+	_ = tx.QueryRow("SELECT to_regclass('book_merge')").Scan(&merge)
+
+	if merge == "" {
+		q := `CREATE TABLE IF NOT EXISTS book_merge(
+						id UUID,
+						source_id UUID NOT NULL,
+						target_id UUID NOT NULL,
+						actor_id UUID NULL,
+						source jsonb NOT NULL,
+						created_at timestamp NOT NULL,
+						PRIMARY KEY (id)
+					);
+					CREATE TABLE IF NOT EXISTS book_redirect(
+						from_id UUID,
+						to_id UUID NOT NULL REFERENCES book (id) ON DELETE CASCADE,
+						created_at timestamp NOT NULL,
+						PRIMARY KEY (from_id)
+					);`
+
+		_, err := tx.Exec(q)
+		if err != nil {
+			return fmt.Errorf("Creating table: book_merge: %w", err)
+		}
+	}
+
+	var marc string
+	_ = tx.QueryRow("SELECT to_regclass('book_marc')").Scan(&marc)
+
+	if marc == "" {
+		q := `CREATE TABLE IF NOT EXISTS book_marc(
+						book_id UUID REFERENCES book (id) ON DELETE CASCADE,
+						record bytea NOT NULL,
+						updated_at timestamp NOT NULL,
+						PRIMARY KEY (book_id)
+					);`
+
+		_, err := tx.Exec(q)
+		if err != nil {
+			return fmt.Errorf("Creating table: book_marc: %w", err)
+		}
+	}
+
+	_, err = tx.Exec(`ALTER TABLE book_merge ADD COLUMN IF NOT EXISTS source_marc bytea NULL;`)
+	if err != nil {
+		return fmt.Errorf("Altering table: book_merge: source_marc: %w", err)
+	}
+
+	var attachment string
+	_ = tx.QueryRow("SELECT to_regclass('book_attachment')").Scan(&attachment)
+
+	if attachment == "" {
+		q := `CREATE TABLE IF NOT EXISTS book_attachment(
+						id UUID,
+						book_id UUID REFERENCES book (id) ON DELETE CASCADE,
+						kind varchar(16) NOT NULL,
+						filename varchar(255) NOT NULL,
+						content_type varchar(255) NOT NULL,
+						size integer NOT NULL,
+						data bytea NOT NULL,
+						created_at timestamp NOT NULL,
+						PRIMARY KEY (id)
+					);
+					CREATE INDEX IF NOT EXISTS book_attachment_book_id ON book_attachment (book_id, kind, created_at);`
+
+		_, err := tx.Exec(q)
+		if err != nil {
+			return fmt.Errorf("Creating table: book_attachment: %w", err)
+		}
+	}
+
+	var importJob string
+	_ = tx.QueryRow("SELECT to_regclass('import_job')").Scan(&importJob)
+
+	if importJob == "" {
+		q := `CREATE TABLE IF NOT EXISTS import_job(
+						id UUID,
+						user_id UUID NOT NULL,
+						source varchar(16) NOT NULL,
+						status varchar(16) NOT NULL,
+						total integer NOT NULL,
+						processed integer NOT NULL,
+						report jsonb NOT NULL,
+						error text NOT NULL DEFAULT '',
+						created_at timestamp NOT NULL,
+						updated_at timestamp NOT NULL,
+						PRIMARY KEY (id)
+					);
+					CREATE TABLE IF NOT EXISTS import_record(
+						user_id UUID,
+						source varchar(16),
+						source_id varchar(255),
+						book_id UUID NOT NULL REFERENCES book (id) ON DELETE CASCADE,
+						created_at timestamp NOT NULL,
+						PRIMARY KEY (user_id, source, source_id)
+					);
+					CREATE TABLE IF NOT EXISTS book_rating(
+						book_id UUID REFERENCES book (id) ON DELETE CASCADE,
+						user_id UUID,
+						rating smallint NOT NULL CHECK (rating BETWEEN 1 AND 5),
+						updated_at timestamp NOT NULL,
+						PRIMARY KEY (book_id, user_id)
+					);`
+
+		_, err := tx.Exec(q)
+		if err != nil {
+			return fmt.Errorf("Creating table: import_job: %w", err)
+		}
+	}
+
+	var refreshToken string
+	_ = tx.QueryRow("SELECT to_regclass('refresh_token')").Scan(&refreshToken)
+
+	if refreshToken == "" {
+		q := `CREATE TABLE IF NOT EXISTS refresh_token(
+						id UUID,
+						family_id UUID NOT NULL,
+						user_id UUID NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+						token_hash bytea UNIQUE NOT NULL,
+						device varchar(255) NOT NULL DEFAULT '',
+						ttl_seconds bigint NOT NULL,
+						created_at timestamp NOT NULL,
+						expires_at timestamp NOT NULL,
+						family_expires_at timestamp NOT NULL,
+						used_at timestamp,
+						revoked_at timestamp,
+						PRIMARY KEY (id)
+					);
+					CREATE INDEX IF NOT EXISTS refresh_token_family ON refresh_token (family_id);`
+
+		_, err := tx.Exec(q)
+		if err != nil {
+			return fmt.Errorf("Creating table: refresh_token: %w", err)
+		}
+	}
+
+	var revokedToken string
+	_ = tx.QueryRow("SELECT to_regclass('revoked_token')").Scan(&revokedToken)
+
+	if revokedToken == "" {
+		q := `CREATE TABLE IF NOT EXISTS revoked_token(
+						id UUID,
+						expires_at timestamp NOT NULL,
+						PRIMARY KEY (id)
+					);
+					CREATE INDEX IF NOT EXISTS revoked_token_expires ON revoked_token (expires_at);`
+
+		_, err := tx.Exec(q)
+		if err != nil {
+			return fmt.Errorf("Creating table: revoked_token: %w", err)
+		}
+	}
+
+	var apiKey string
+	_ = tx.QueryRow("SELECT to_regclass('api_key')").Scan(&apiKey)
+
+	if apiKey == "" {
+		q := `CREATE TABLE IF NOT EXISTS api_key(
+						id UUID,
+						name varchar(255) NOT NULL,
+						prefix varchar(16) UNIQUE NOT NULL,
+						key_hash bytea NOT NULL,
+						user_id UUID NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+						scopes varchar(255)[] NOT NULL,
+						created_by UUID,
+						created_at timestamp NOT NULL,
+						expires_at timestamp NOT NULL,
+						last_used_at timestamp,
+						use_count bigint NOT NULL DEFAULT 0,
+						revoked_at timestamp,
+						PRIMARY KEY (id)
+					);`
+
+		_, err := tx.Exec(q)
+		if err != nil {
+			return fmt.Errorf("Creating table: api_key: %w", err)
+		}
+	}
+
+	var oauthClient string
+	_ = tx.QueryRow("SELECT to_regclass('oauth_client')").Scan(&oauthClient)
+
+	if oauthClient == "" {
+		q := `CREATE TABLE IF NOT EXISTS oauth_client(
+						id UUID,
+						name varchar(255) NOT NULL,
+						secret_hash bytea,
+						redirect_uris text[] NOT NULL,
+						grant_types varchar(64)[] NOT NULL,
+						scopes varchar(255)[] NOT NULL,
+						created_by UUID,
+						created_at timestamp NOT NULL,
+						PRIMARY KEY (id)
+					);
+					CREATE TABLE IF NOT EXISTS oauth_code(
+						id UUID,
+						code_hash bytea UNIQUE NOT NULL,
+						client_id UUID NOT NULL REFERENCES oauth_client (id) ON DELETE CASCADE,
+						user_id UUID NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+						redirect_uri text NOT NULL,
+						scopes varchar(255)[] NOT NULL,
+						code_challenge varchar(64) NOT NULL,
+						created_at timestamp NOT NULL,
+						expires_at timestamp NOT NULL,
+						used_at timestamp,
+						token_id varchar(64) NOT NULL DEFAULT '',
+						PRIMARY KEY (id)
+					);`
+
+		_, err := tx.Exec(q)
+		if err != nil {
+			return fmt.Errorf("Creating table: oauth_client: %w", err)
+		}
+	}
+
+	var userIdentity string
+	_ = tx.QueryRow("SELECT to_regclass('user_identity')").Scan(&userIdentity)
+
+	if userIdentity == "" {
+		q := `CREATE TABLE IF NOT EXISTS user_identity(
+						issuer varchar(255) NOT NULL,
+						subject varchar(255) NOT NULL,
+						user_id UUID NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+						email varchar(255) NOT NULL,
+						provisioned boolean NOT NULL DEFAULT false,
+						created_at timestamp NOT NULL,
+						PRIMARY KEY (issuer, subject)
+					);
+					CREATE TABLE IF NOT EXISTS oidc_state(
+						state_hash bytea,
+						nonce varchar(64) NOT NULL,
+						code_verifier varchar(128) NOT NULL,
+						user_id UUID REFERENCES users (id) ON DELETE CASCADE,
+						expires_at timestamp NOT NULL,
+						PRIMARY KEY (state_hash)
+					);`
+
+		_, err := tx.Exec(q)
+		if err != nil {
+			return fmt.Errorf("Creating table: user_identity: %w", err)
+		}
+	}
+
+	_, err = tx.Exec(`ALTER TABLE users ADD COLUMN IF NOT EXISTS attributes jsonb NOT NULL DEFAULT '{}';`)
+	if err != nil {
+		return fmt.Errorf("Altering table: users: attributes: %w", err)
+	}
+
+	var role string
+	_ = tx.QueryRow("SELECT to_regclass('role')").Scan(&role)
+
+	if role == "" {
+		q := `CREATE TABLE IF NOT EXISTS role(
+						name varchar(32),
+						description text NOT NULL DEFAULT '',
+						permissions varchar(64)[] NOT NULL,
+						inherits varchar(32)[] NOT NULL,
+						built_in boolean NOT NULL DEFAULT false,
+						created_at timestamp NOT NULL,
+						updated_at timestamp NOT NULL,
+						PRIMARY KEY (name)
+					);`
+
+		_, err := tx.Exec(q)
+		if err != nil {
+			return fmt.Errorf("Creating table: role: %w", err)
+		}
+	}
+
+	// Tagging needs tags:write since it was added. The built-in roles that
+	// could tag before get it once, while no role holds it yet.
+	_, err = tx.Exec(`UPDATE role SET permissions = array_append(permissions, 'tags:write')
+		WHERE name IN ('AUTHOR', 'CURATOR')
+		AND NOT EXISTS (SELECT 1 FROM role WHERE 'tags:write' = ANY(permissions))`)
+	if err != nil {
+		return fmt.Errorf("Updating table: role: tags:write: %w", err)
+	}
+
+	var roleChange string
+	_ = tx.QueryRow("SELECT to_regclass('user_role_change')").Scan(&roleChange)
+
+	if roleChange == "" {
+		q := `CREATE TABLE IF NOT EXISTS user_role_change(
+						id UUID,
+						user_id UUID NOT NULL,
+						role varchar(32) NOT NULL,
+						action varchar(16) NOT NULL,
+						actor_id UUID NULL,
+						created_at timestamp NOT NULL,
+						PRIMARY KEY (id)
+					);
+					CREATE INDEX IF NOT EXISTS user_role_change_user_id ON user_role_change (user_id, created_at);`
+
+		_, err := tx.Exec(q)
+		if err != nil {
+			return fmt.Errorf("Creating table: user_role_change: %w", err)
+		}
+	}
+
+	var bookShelf string
+	_ = tx.QueryRow("SELECT to_regclass('book_shelf')").Scan(&bookShelf)
+
+	if bookShelf == "" {
+		q := `CREATE TABLE IF NOT EXISTS book_shelf(
+						book_id UUID REFERENCES book (id) ON DELETE CASCADE,
+						user_id UUID,
+						shelf varchar(255),
+						created_at timestamp NOT NULL,
+						PRIMARY KEY (book_id, user_id, shelf)
+					);
+					CREATE INDEX IF NOT EXISTS book_shelf_user_id ON book_shelf (user_id, shelf);`
+
+		_, err := tx.Exec(q)
+		if err != nil {
+			return fmt.Errorf("Creating table: book_shelf: %w", err)
+		}
+	}
+
 	err = tx.Commit()
 	if err != nil {
 		return fmt.Errorf("Committing: %w", err)
@@ -0,0 +1,86 @@
+package mock
+
+import (
+	"sync"
+	"time"
+
+	"github.com/axwilliams/book-api/internal/business/apikey"
+)
+
+type MockAPIKey interface {
+	Create(k *apikey.APIKey) error
+	GetAll() ([]apikey.APIKey, error)
+	GetByPrefix(prefix string) (*apikey.APIKey, error)
+	Revoke(id string, at time.Time) error
+	RecordUsage(id string, at time.Time, count int64) error
+}
+
+// mockAPIKey keeps keys in memory so that creating, using and revoking a
+// key can be followed across calls.
+type mockAPIKey struct {
+	mu   sync.Mutex
+	keys []apikey.APIKey
+}
+
+func NewMockAPIKey() MockAPIKey {
+	return &mockAPIKey{}
+}
+
+func (mk *mockAPIKey) Create(k *apikey.APIKey) error {
+	mk.mu.Lock()
+	defer mk.mu.Unlock()
+
+	mk.keys = append(mk.keys, *k)
+	return nil
+}
+
+func (mk *mockAPIKey) GetAll() ([]apikey.APIKey, error) {
+	mk.mu.Lock()
+	defer mk.mu.Unlock()
+
+	ks := []apikey.APIKey{}
+	for i := len(mk.keys) - 1; i >= 0; i-- {
+		ks = append(ks, mk.keys[i])
+	}
+	return ks, nil
+}
+
+func (mk *mockAPIKey) GetByPrefix(prefix string) (*apikey.APIKey, error) {
+	mk.mu.Lock()
+	defer mk.mu.Unlock()
+
+	for _, k := range mk.keys {
+		if k.Prefix == prefix {
+			return &k, nil
+		}
+	}
+	return nil, apikey.ErrNoKeyFound
+}
+
+func (mk *mockAPIKey) Revoke(id string, at time.Time) error {
+	mk.mu.Lock()
+	defer mk.mu.Unlock()
+
+	for i, k := range mk.keys {
+		if k.ID == id && k.RevokedAt == nil {
+			mk.keys[i].RevokedAt = &at
+			return nil
+		}
+	}
+	return apikey.ErrNoKeyFound
+}
+
+func (mk *mockAPIKey) RecordUsage(id string, at time.Time, count int64) error {
+	mk.mu.Lock()
+	defer mk.mu.Unlock()
+
+	for i, k := range mk.keys {
+		if k.ID == id {
+			mk.keys[i].UseCount += count
+			if k.LastUsedAt == nil || at.After(*k.LastUsedAt) {
+				mk.keys[i].LastUsedAt = &at
+			}
+		}
+	}
+	return nil
+}
@@ -2,18 +2,39 @@ package mock
 
 import (
 	"net/http"
+	"time"
 
 	"github.com/axwilliams/book-api/internal/business/book"
 	"github.com/axwilliams/book-api/internal/platform/web"
 )
 
 type MockBook interface {
-	GetAll() ([]book.Book, error)
+	GetAll(status string) ([]book.Book, error)
 	GetById(id string) (*book.Book, error)
+	GetByIds(ids []string) ([]book.Book, error)
+	GetByISBN(isbn string) (*book.Book, error)
 	Search(sp book.SearchParams, sortOrder string, limit, offset int) ([]book.Book, error)
-	Create(bk *book.Book) error
-	Update(bk *book.Book) error
+	Create(bk *book.Book, t *book.Transition, as []book.Attachment, marc []byte) error
+	Update(bk *book.Book, t *book.Transition) error
 	Destroy(id string) error
+	UpdateStatus(bk *book.Book, t *book.Transition) error
+	GetTransitions(bookID string) ([]book.Transition, error)
+	NextInSeries(bk *book.Book) (*book.Book, error)
+	SeriesExists(id string) bool
+	GetRelations(bookID, status string) ([]book.Relation, error)
+	AddRelation(bookID string, rl *book.Relation) error
+	RemoveRelation(bookID, relationID string) error
+	RelationExists(bookID, relationType, relatedID string) (bool, error)
+	InSequelChain(fromID, toID string) (bool, error)
+	Merge(m *book.Merge, t *book.Transition) error
+	Redirect(id string) (string, error)
+	GetMARC(bookID string) ([]byte, error)
+	GetAllMARC(status string) (map[string][]byte, error)
+	Facets(field, status string) ([]book.Facet, error)
+	Harvest(h book.Harvest, limit int) ([]book.Book, error)
+	GetAttachments(bookID string) ([]book.Attachment, error)
+	GetAttachment(bookID, attachmentID string) (*book.Attachment, error)
+	GetCover(bookID string) (*book.Attachment, error)
 }
 
 type mockBook struct{}
@@ -22,7 +43,7 @@ func NewMockBook() MockBook {
 	return &mockBook{}
 }
 
-func (mb *mockBook) GetAll() ([]book.Book, error) {
+func (mb *mockBook) GetAll(status string) ([]book.Book, error) {
 	bs := make([]book.Book, 0)
 
 	bs = append(bs, book.Book{
@@ -31,6 +52,7 @@ func (mb *mockBook) GetAll() ([]book.Book, error) {
 		Title:    "The Castle",
 		Author:   "Franz Kafka",
 		Category: "Fiction",
+		Status:   book.StatusPublished,
 	})
 
 	bs = append(bs, book.Book{
@@ -39,6 +61,7 @@ func (mb *mockBook) GetAll() ([]book.Book, error) {
 		Title:    "Fahrenheit 451",
 		Author:   "Ray Bradbury",
 		Category: "Fiction",
+		Status:   book.StatusPublished,
 	})
 
 	bs = append(bs, book.Book{
@@ -47,6 +70,7 @@ func (mb *mockBook) GetAll() ([]book.Book, error) {
 		Title:    "Six Easy Pieces",
 		Author:   "Richard Feynman",
 		Category: "Science",
+		Status:   book.StatusPublished,
 	})
 
 	return bs, nil
@@ -60,6 +84,63 @@ func (mb *mockBook) GetById(id string) (*book.Book, error) {
 			Title:    "The Castle",
 			Author:   "Franz Kafka",
 			Category: "Fiction",
+			Status:   book.StatusPublished,
+		}, nil
+	}
+
+	if id == "562e1fe0-0dde-4717-a008-cd2a699301d2" {
+		return &book.Book{
+			ID:       "562e1fe0-0dde-4717-a008-cd2a699301d2",
+			ISBN:     "978-0465025275",
+			Title:    "Six Easy Pieces",
+			Author:   "Richard Feynman",
+			Category: "Science",
+			Status:   book.StatusPublished,
+		}, nil
+	}
+
+	if id == "d2b4a1c7-5e33-4b8a-9c1e-6f0d3a2b7c91" {
+		return &book.Book{
+			ID:       "d2b4a1c7-5e33-4b8a-9c1e-6f0d3a2b7c91",
+			ISBN:     "978-0241372586",
+			Title:    "The Trial",
+			Author:   "Franz Kafka",
+			Category: "Fiction",
+			Status:   book.StatusInReview,
+		}, nil
+	}
+
+	return nil, book.ErrNoBookFound
+}
+
+func (mb *mockBook) GetByIds(ids []string) ([]book.Book, error) {
+	bks := []book.Book{}
+	for _, id := range ids {
+		bk, err := mb.GetById(id)
+		switch {
+		case err == book.ErrNoBookFound:
+			continue
+		case err != nil:
+			return nil, err
+		}
+		bks = append(bks, *bk)
+	}
+
+	return bks, nil
+}
+
+func (mb *mockBook) GetByISBN(isbn string) (*book.Book, error) {
+	switch book.NormalizeISBN(isbn) {
+	case "9780241372579":
+		return mb.GetById("f4ac7e14-fc8e-4096-b956-34e5a33040f2")
+	case "9781451673319":
+		return &book.Book{
+			ID:       "71432eb9-58da-4eae-aa20-ccc49064246f",
+			ISBN:     "978-1451673319",
+			Title:    "Fahrenheit 451",
+			Author:   "Ray Bradbury",
+			Category: "Fiction",
+			Status:   book.StatusPublished,
 		}, nil
 	}
 
@@ -76,6 +157,18 @@ func (mb *mockBook) Search(sp book.SearchParams, sortOrder string, limit, offset
 			Title:    "The Castle",
 			Author:   "Franz Kafka",
 			Category: "Fiction",
+			Status:   book.StatusPublished,
+		})
+	}
+
+	if sp.Query == "Kafka" {
+		bs = append(bs, book.Book{
+			ID:       "f4ac7e14-fc8e-4096-b956-34e5a33040f2",
+			ISBN:     "978-0241372579",
+			Title:    "The Castle",
+			Author:   "Franz Kafka",
+			Category: "Fiction",
+			Status:   book.StatusPublished,
 		})
 	}
 
@@ -86,6 +179,7 @@ func (mb *mockBook) Search(sp book.SearchParams, sortOrder string, limit, offset
 			Title:    "The Castle",
 			Author:   "Franz Kafka",
 			Category: "Fiction",
+			Status:   book.StatusPublished,
 		})
 	}
 
@@ -96,6 +190,7 @@ func (mb *mockBook) Search(sp book.SearchParams, sortOrder string, limit, offset
 			Title:    "The Castle",
 			Author:   "Franz Kafka",
 			Category: "Fiction",
+			Status:   book.StatusPublished,
 		})
 	}
 
@@ -106,6 +201,7 @@ func (mb *mockBook) Search(sp book.SearchParams, sortOrder string, limit, offset
 			Title:    "The Castle",
 			Author:   "Franz Kafka",
 			Category: "Fiction",
+			Status:   book.StatusPublished,
 		})
 
 		bs = append(bs, book.Book{
@@ -114,6 +210,7 @@ func (mb *mockBook) Search(sp book.SearchParams, sortOrder string, limit, offset
 			Title:    "Fahrenheit 451",
 			Author:   "Ray Bradbury",
 			Category: "Fiction",
+			Status:   book.StatusPublished,
 		})
 	}
 
@@ -124,6 +221,7 @@ func (mb *mockBook) Search(sp book.SearchParams, sortOrder string, limit, offset
 			Title:    "The Castle",
 			Author:   "Franz Kafka",
 			Category: "Fiction",
+			Status:   book.StatusPublished,
 		})
 
 		bs = append(bs, book.Book{
@@ -132,6 +230,7 @@ func (mb *mockBook) Search(sp book.SearchParams, sortOrder string, limit, offset
 			Title:    "Six Easy Pieces",
 			Author:   "Richard Feynman",
 			Category: "Science",
+			Status:   book.StatusPublished,
 		})
 
 		bs = append(bs, book.Book{
@@ -140,6 +239,7 @@ func (mb *mockBook) Search(sp book.SearchParams, sortOrder string, limit, offset
 			Title:    "Fahrenheit 451",
 			Author:   "Ray Bradbury",
 			Category: "Fiction",
+			Status:   book.StatusPublished,
 		})
 	}
 
@@ -150,6 +250,7 @@ func (mb *mockBook) Search(sp book.SearchParams, sortOrder string, limit, offset
 			Title:    "Fahrenheit 451",
 			Author:   "Ray Bradbury",
 			Category: "Fiction",
+			Status:   book.StatusPublished,
 		})
 
 		bs = append(bs, book.Book{
@@ -158,17 +259,18 @@ func (mb *mockBook) Search(sp book.SearchParams, sortOrder string, limit, offset
 			Title:    "Six Easy Pieces",
 			Author:   "Richard Feynman",
 			Category: "Science",
+			Status:   book.StatusPublished,
 		})
 	}
 
 	return bs, nil
 }
 
-func (mb *mockBook) Create(bk *book.Book) error {
+func (mb *mockBook) Create(bk *book.Book, t *book.Transition, as []book.Attachment, marc []byte) error {
 	return nil
 }
 
-func (mb *mockBook) Update(bk *book.Book) error {
+func (mb *mockBook) Update(bk *book.Book, t *book.Transition) error {
 	return nil
 }
 
@@ -179,3 +281,191 @@ func (mb *mockBook) Destroy(id string) error {
 
 	return web.NewRequestError(book.ErrNoAffect, http.StatusGone)
 }
+
+func (mb *mockBook) UpdateStatus(bk *book.Book, t *book.Transition) error {
+	return nil
+}
+
+func (mb *mockBook) GetTransitions(bookID string) ([]book.Transition, error) {
+	return []book.Transition{}, nil
+}
+
+func (mb *mockBook) NextInSeries(bk *book.Book) (*book.Book, error) {
+	return nil, book.ErrNoBookFound
+}
+
+func (mb *mockBook) SeriesExists(id string) bool {
+	return id == "3c9d2e71-6b4a-4f8e-9d0c-1a2b3c4d5e6f"
+}
+
+func (mb *mockBook) GetRelations(bookID, status string) ([]book.Relation, error) {
+	rls := make([]book.Relation, 0)
+
+	if bookID != "f4ac7e14-fc8e-4096-b956-34e5a33040f2" {
+		return rls, nil
+	}
+
+	rls = append(rls, book.Relation{
+		ID:     "5b1e9c0a-2f4d-4c3b-8a6e-7d9f0e1a2b3c",
+		Type:   book.RelationCompanionTo,
+		BookID: "71432eb9-58da-4eae-aa20-ccc49064246f",
+		Book: &book.Book{
+			ID:       "71432eb9-58da-4eae-aa20-ccc49064246f",
+			ISBN:     "978-1451673319",
+			Title:    "Fahrenheit 451",
+			Author:   "Ray Bradbury",
+			Category: "Fiction",
+			Status:   book.StatusPublished,
+		},
+	})
+
+	if status == "" {
+		rls = append(rls, book.Relation{
+			ID:     "0c8f7e6d-5b4a-4392-8170-6f5e4d3c2b1a",
+			Type:   book.RelationCompanionTo,
+			BookID: "d2b4a1c7-5e33-4b8a-9c1e-6f0d3a2b7c91",
+			Book: &book.Book{
+				ID:       "d2b4a1c7-5e33-4b8a-9c1e-6f0d3a2b7c91",
+				ISBN:     "978-0241372586",
+				Title:    "The Trial",
+				Author:   "Franz Kafka",
+				Category: "Fiction",
+				Status:   book.StatusInReview,
+			},
+		})
+	}
+
+	return rls, nil
+}
+
+func (mb *mockBook) AddRelation(bookID string, rl *book.Relation) error {
+	return nil
+}
+
+func (mb *mockBook) RemoveRelation(bookID, relationID string) error {
+	if relationID == "5b1e9c0a-2f4d-4c3b-8a6e-7d9f0e1a2b3c" {
+		return nil
+	}
+
+	return web.NewRequestError(book.ErrNoAffect, http.StatusGone)
+}
+
+// RelationExists reports the companion relation to "The Trial" returned by
+// GetRelations.
+func (mb *mockBook) RelationExists(bookID, relationType, relatedID string) (bool, error) {
+	return bookID == "f4ac7e14-fc8e-4096-b956-34e5a33040f2" && relationType == book.RelationCompanionTo &&
+		relatedID == "d2b4a1c7-5e33-4b8a-9c1e-6f0d3a2b7c91", nil
+}
+
+// InSequelChain pretends "The Trial" is already a sequel of "The Castle".
+func (mb *mockBook) InSequelChain(fromID, toID string) (bool, error) {
+	return fromID == "d2b4a1c7-5e33-4b8a-9c1e-6f0d3a2b7c91" && toID == "f4ac7e14-fc8e-4096-b956-34e5a33040f2", nil
+}
+
+func (mb *mockBook) Merge(m *book.Merge, t *book.Transition) error {
+	return nil
+}
+
+// Redirect pretends a copy of "The Castle" was merged into it.
+func (mb *mockBook) Redirect(id string) (string, error) {
+	if id == "9a3f5c2e-8b1d-4e6f-a7c9-0d2e4f6a8b1c" {
+		return "f4ac7e14-fc8e-4096-b956-34e5a33040f2", nil
+	}
+
+	return "", book.ErrNoBookFound
+}
+
+func (mb *mockBook) GetMARC(bookID string) ([]byte, error) {
+	return nil, nil
+}
+
+func (mb *mockBook) GetAllMARC(status string) (map[string][]byte, error) {
+	return map[string][]byte{}, nil
+}
+
+func (mb *mockBook) Facets(field, status string) ([]book.Facet, error) {
+	if field == book.FacetAuthor {
+		return []book.Facet{
+			{Name: "Franz Kafka", Count: 1},
+			{Name: "Ray Bradbury", Count: 1},
+			{Name: "Richard Feynman", Count: 1},
+		}, nil
+	}
+
+	return []book.Facet{
+		{Name: "Fiction", Count: 2},
+		{Name: "Science", Count: 1},
+	}, nil
+}
+
+func (mb *mockBook) Harvest(h book.Harvest, limit int) ([]book.Book, error) {
+	all, _ := mb.GetAll(book.StatusPublished)
+	all[0].UpdatedAt = time.Date(2020, 1, 10, 10, 0, 0, 0, time.UTC)
+	all[1].UpdatedAt = time.Date(2020, 2, 1, 8, 30, 0, 0, time.UTC)
+	all[2].UpdatedAt = time.Date(2020, 3, 1, 12, 0, 0, 0, time.UTC)
+
+	bs := make([]book.Book, 0)
+	for _, bk := range all {
+		switch {
+		case h.Category != "" && bk.Category != h.Category:
+		case !h.From.IsZero() && bk.UpdatedAt.Before(h.From):
+		case !h.Until.IsZero() && !bk.UpdatedAt.Before(h.Until):
+		case h.AfterID != "" && !bk.UpdatedAt.After(h.AfterTime):
+		case len(bs) == limit:
+		default:
+			bs = append(bs, bk)
+		}
+	}
+
+	return bs, nil
+}
+
+var castleCover = book.Attachment{
+	ID:          "3c1f9a4e-2b7d-4d8e-9f6a-5e0c8b1d2a37",
+	BookID:      "f4ac7e14-fc8e-4096-b956-34e5a33040f2",
+	Kind:        book.AttachmentCover,
+	Filename:    "cover.png",
+	ContentType: "image/png",
+	Size:        8,
+	Data:        []byte("\x89PNG\r\n\x1a\n"),
+}
+
+func (mb *mockBook) GetAttachments(bookID string) ([]book.Attachment, error) {
+	as := make([]book.Attachment, 0)
+
+	if bookID == castleCover.BookID {
+		a := castleCover
+		a.Data = nil
+		as = append(as, a)
+	}
+
+	return as, nil
+}
+
+// svgCover was stored before covers were limited to raster images.
+var svgCover = book.Attachment{
+	ID:          "8e2d4f6a-1c3b-4a5d-8e7f-9a0b1c2d3e4f",
+	BookID:      "562e1fe0-0dde-4717-a008-cd2a699301d2",
+	Kind:        book.AttachmentCover,
+	Filename:    "cover.svg",
+	ContentType: "image/svg+xml",
+	Size:        56,
+	Data:        []byte(`<svg xmlns="http://www.w3.org/2000/svg"><script/></svg>`),
+}
+
+func (mb *mockBook) GetAttachment(bookID, attachmentID string) (*book.Attachment, error) {
+	for _, a := range []book.Attachment{castleCover, svgCover} {
+		if bookID == a.BookID && attachmentID == a.ID {
+			return &a, nil
+		}
+	}
+
+	return nil, book.ErrNoAttachment
+}
+
+func (mb *mockBook) GetCover(bookID string) (*book.Attachment, error) {
+	if bookID == svgCover.BookID {
+		return mb.GetAttachment(bookID, svgCover.ID)
+	}
+	return mb.GetAttachment(bookID, castleCover.ID)
+}
@@ -0,0 +1,132 @@
+package mock
+
+import (
+	"sync"
+	"time"
+
+	"github.com/axwilliams/book-api/internal/business/library"
+)
+
+type MockLibrary interface {
+	CreateJob(j *library.Job) error
+	UpdateJob(j *library.Job) error
+	GetJob(id string) (*library.Job, error)
+	FailUnfinished(message string) (int, error)
+	GetRecord(userID, source, sourceID string) (string, error)
+	AddRecord(userID, source, sourceID, bookID string) error
+	SaveRating(bookID, userID string, rating int) error
+	SaveShelves(bookID, userID string, shelves []string) error
+}
+
+// mockLibrary keeps jobs and import records in memory so that running an
+// import twice can be observed.
+type mockLibrary struct {
+	mu      sync.Mutex
+	jobs    map[string]library.Job
+	records map[string]string
+	ratings map[string]int
+	shelves map[string][]string
+}
+
+func NewMockLibrary() MockLibrary {
+	finished := time.Date(2020, 4, 1, 12, 0, 0, 0, time.UTC)
+
+	return &mockLibrary{
+		jobs: map[string]library.Job{
+			"9b1e4c2d-7a3f-4e6b-8c5d-0f2a1b3c4d5e": {
+				ID:        "9b1e4c2d-7a3f-4e6b-8c5d-0f2a1b3c4d5e",
+				UserID:    "bad069ce-4afa-4a53-a673-14ae7b627d06",
+				Source:    library.SourceGoodreads,
+				Status:    library.StatusDone,
+				Total:     1,
+				Processed: 1,
+				Report: library.Report{
+					Created: []library.Result{},
+					Skipped: []library.Result{},
+					Duplicates: []library.Result{
+						{Entry: 1, SourceID: "13079982", Title: "Fahrenheit 451", BookID: "71432eb9-58da-4eae-aa20-ccc49064246f"},
+					},
+				},
+				CreatedAt: finished,
+				UpdatedAt: finished,
+			},
+		},
+		records: map[string]string{},
+		ratings: map[string]int{},
+		shelves: map[string][]string{},
+	}
+}
+
+func (ml *mockLibrary) CreateJob(j *library.Job) error {
+	return ml.UpdateJob(j)
+}
+
+func (ml *mockLibrary) UpdateJob(j *library.Job) error {
+	ml.mu.Lock()
+	defer ml.mu.Unlock()
+
+	cp := *j
+	cp.Report.Created = append([]library.Result{}, j.Report.Created...)
+	cp.Report.Skipped = append([]library.Result{}, j.Report.Skipped...)
+	cp.Report.Duplicates = append([]library.Result{}, j.Report.Duplicates...)
+	ml.jobs[j.ID] = cp
+
+	return nil
+}
+
+func (ml *mockLibrary) GetJob(id string) (*library.Job, error) {
+	ml.mu.Lock()
+	defer ml.mu.Unlock()
+
+	j, ok := ml.jobs[id]
+	if !ok {
+		return nil, library.ErrNoJobFound
+	}
+
+	return &j, nil
+}
+
+func (ml *mockLibrary) FailUnfinished(message string) (int, error) {
+	return 0, nil
+}
+
+func (ml *mockLibrary) GetRecord(userID, source, sourceID string) (string, error) {
+	ml.mu.Lock()
+	defer ml.mu.Unlock()
+
+	bookID, ok := ml.records[userID+"/"+source+"/"+sourceID]
+	if !ok {
+		return "", library.ErrNoRecord
+	}
+
+	return bookID, nil
+}
+
+func (ml *mockLibrary) AddRecord(userID, source, sourceID, bookID string) error {
+	ml.mu.Lock()
+	defer ml.mu.Unlock()
+
+	if _, ok := ml.records[userID+"/"+source+"/"+sourceID]; !ok {
+		ml.records[userID+"/"+source+"/"+sourceID] = bookID
+	}
+
+	return nil
+}
+
+func (ml *mockLibrary) SaveRating(bookID, userID string, rating int) error {
+	ml.mu.Lock()
+	defer ml.mu.Unlock()
+
+	ml.ratings[bookID+"/"+userID] = rating
+
+	return nil
+}
+
+func (ml *mockLibrary) SaveShelves(bookID, userID string, shelves []string) error {
+	ml.mu.Lock()
+	defer ml.mu.Unlock()
+
+	ml.shelves[bookID+"/"+userID] = append(ml.shelves[bookID+"/"+userID], shelves...)
+
+	return nil
+}
@@ -0,0 +1,123 @@
+package mock
+
+import (
+	"bytes"
+	"sync"
+	"time"
+
+	"github.com/axwilliams/book-api/internal/business/oauth"
+)
+
+type MockOAuth interface {
+	CreateClient(c *oauth.Client) error
+	GetClient(id string) (*oauth.Client, error)
+	GetClients() ([]oauth.Client, error)
+	DeleteClient(id string) error
+	CreateCode(c *oauth.Code) error
+	GetCode(hash []byte) (*oauth.Code, error)
+	UseCode(id, tokenID string, at time.Time) (bool, error)
+	GetUsedCodes(userID string, since time.Time) ([]oauth.Code, error)
+}
+
+// mockOAuth keeps clients and codes in memory so that a whole authorization
+// can be followed across calls.
+type mockOAuth struct {
+	mu      sync.Mutex
+	clients []oauth.Client
+	codes   []oauth.Code
+}
+
+func NewMockOAuth() MockOAuth {
+	return &mockOAuth{}
+}
+
+func (mo *mockOAuth) CreateClient(c *oauth.Client) error {
+	mo.mu.Lock()
+	defer mo.mu.Unlock()
+
+	mo.clients = append(mo.clients, *c)
+	return nil
+}
+
+func (mo *mockOAuth) GetClient(id string) (*oauth.Client, error) {
+	mo.mu.Lock()
+	defer mo.mu.Unlock()
+
+	for _, c := range mo.clients {
+		if c.ID == id {
+			return &c, nil
+		}
+	}
+	return nil, oauth.ErrNoClientFound
+}
+
+func (mo *mockOAuth) GetClients() ([]oauth.Client, error) {
+	mo.mu.Lock()
+	defer mo.mu.Unlock()
+
+	cs := []oauth.Client{}
+	for i := len(mo.clients) - 1; i >= 0; i-- {
+		cs = append(cs, mo.clients[i])
+	}
+	return cs, nil
+}
+
+func (mo *mockOAuth) DeleteClient(id string) error {
+	mo.mu.Lock()
+	defer mo.mu.Unlock()
+
+	for i, c := range mo.clients {
+		if c.ID == id {
+			mo.clients = append(mo.clients[:i], mo.clients[i+1:]...)
+			return nil
+		}
+	}
+	return oauth.ErrNoClientFound
+}
+
+func (mo *mockOAuth) CreateCode(c *oauth.Code) error {
+	mo.mu.Lock()
+	defer mo.mu.Unlock()
+
+	mo.codes = append(mo.codes, *c)
+	return nil
+}
+
+func (mo *mockOAuth) GetCode(hash []byte) (*oauth.Code, error) {
+	mo.mu.Lock()
+	defer mo.mu.Unlock()
+
+	for _, c := range mo.codes {
+		if bytes.Equal(c.Hash, hash) {
+			return &c, nil
+		}
+	}
+	return nil, oauth.ErrNoCodeFound
+}
+
+func (mo *mockOAuth) UseCode(id, tokenID string, at time.Time) (bool, error) {
+	mo.mu.Lock()
+	defer mo.mu.Unlock()
+
+	for i, c := range mo.codes {
+		if c.ID == id && c.UsedAt == nil {
+			mo.codes[i].UsedAt = &at
+			mo.codes[i].TokenID = tokenID
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func (mo *mockOAuth) GetUsedCodes(userID string, since time.Time) ([]oauth.Code, error) {
+	mo.mu.Lock()
+	defer mo.mu.Unlock()
+
+	cs := []oauth.Code{}
+	for _, c := range mo.codes {
+		if c.UserID == userID && c.UsedAt != nil && c.UsedAt.After(since) {
+			cs = append(cs, c)
+		}
+	}
+	return cs, nil
+}
@@ -0,0 +1,67 @@
+package mock
+
+import (
+	"bytes"
+	"sync"
+
+	"github.com/axwilliams/book-api/internal/business/oidc"
+)
+
+type MockOIDC interface {
+	CreateState(st *oidc.State) error
+	TakeState(hash []byte) (*oidc.State, error)
+	GetIdentity(issuer, subject string) (*oidc.Identity, error)
+	CreateIdentity(id *oidc.Identity) error
+}
+
+// mockOIDC keeps logins in progress and identities in memory.
+type mockOIDC struct {
+	mu         sync.Mutex
+	states     []oidc.State
+	identities []oidc.Identity
+}
+
+func NewMockOIDC() MockOIDC {
+	return &mockOIDC{}
+}
+
+func (mo *mockOIDC) CreateState(st *oidc.State) error {
+	mo.mu.Lock()
+	defer mo.mu.Unlock()
+
+	mo.states = append(mo.states, *st)
+	return nil
+}
+
+func (mo *mockOIDC) TakeState(hash []byte) (*oidc.State, error) {
+	mo.mu.Lock()
+	defer mo.mu.Unlock()
+
+	for i, st := range mo.states {
+		if bytes.Equal(st.Hash, hash) {
+			mo.states = append(mo.states[:i], mo.states[i+1:]...)
+			return &st, nil
+		}
+	}
+	return nil, oidc.ErrNoStateFound
+}
+
+func (mo *mockOIDC) GetIdentity(issuer, subject string) (*oidc.Identity, error) {
+	mo.mu.Lock()
+	defer mo.mu.Unlock()
+
+	for _, id := range mo.identities {
+		if id.Issuer == issuer && id.Subject == subject {
+			return &id, nil
+		}
+	}
+	return nil, oidc.ErrNoIdentityFound
+}
+
+func (mo *mockOIDC) CreateIdentity(id *oidc.Identity) error {
+	mo.mu.Lock()
+	defer mo.mu.Unlock()
+
+	mo.identities = append(mo.identities, *id)
+	return nil
+}
@@ -0,0 +1,57 @@
+package mock
+
+import (
+	"time"
+
+	"github.com/axwilliams/book-api/internal/business/recommend"
+)
+
+type MockRecommend interface {
+	Get(bookID string, limit int) ([]recommend.Similar, error)
+	GetAll() (map[string][]recommend.Similar, error)
+	Save(bookID string, sims []recommend.Similar) error
+	Prune(bookIDs []string) error
+	LastComputed() (time.Time, error)
+	Counts(bookID string) (map[string]int, error)
+}
+
+type mockRecommend struct{}
+
+func NewMockRecommend() MockRecommend {
+	return &mockRecommend{}
+}
+
+func (mr *mockRecommend) Get(bookID string, limit int) ([]recommend.Similar, error) {
+	sims := make([]recommend.Similar, 0)
+
+	if bookID == "562e1fe0-0dde-4717-a008-cd2a699301d2" {
+		sims = append(sims, recommend.Similar{
+			BookID:    "562e1fe0-0dde-4717-a008-cd2a699301d2",
+			SimilarID: "f4ac7e14-fc8e-4096-b956-34e5a33040f2",
+			Score:     0.5,
+			Reasons:   []string{recommend.ReasonAuthor, recommend.ReasonCategory},
+		})
+	}
+
+	return sims, nil
+}
+
+func (mr *mockRecommend) GetAll() (map[string][]recommend.Similar, error) {
+	return map[string][]recommend.Similar{}, nil
+}
+
+func (mr *mockRecommend) Save(bookID string, sims []recommend.Similar) error {
+	return nil
+}
+
+func (mr *mockRecommend) Prune(bookIDs []string) error {
+	return nil
+}
+
+func (mr *mockRecommend) LastComputed() (time.Time, error) {
+	return time.Time{}, nil
+}
+
+func (mr *mockRecommend) Counts(bookID string) (map[string]int, error) {
+	return map[string]int{}, nil
+}
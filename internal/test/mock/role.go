@@ -0,0 +1,99 @@
+package mock
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/axwilliams/book-api/internal/business/role"
+)
+
+type MockRole interface {
+	GetAll() ([]role.Role, error)
+	GetByName(name string) (*role.Role, error)
+	Create(r *role.Role) error
+	Update(r *role.Role) error
+	Delete(name string) error
+	Seed(rs []role.Role, at time.Time) error
+}
+
+// mockRole keeps roles in memory and starts out with the built-in ones.
+type mockRole struct {
+	mu    sync.Mutex
+	roles map[string]role.Role
+}
+
+func NewMockRole() MockRole {
+	mr := &mockRole{roles: map[string]role.Role{}}
+	mr.Seed(role.Defaults(), time.Now().UTC())
+	return mr
+}
+
+func (mr *mockRole) GetAll() ([]role.Role, error) {
+	mr.mu.Lock()
+	defer mr.mu.Unlock()
+
+	rs := make([]role.Role, 0, len(mr.roles))
+	for _, r := range mr.roles {
+		rs = append(rs, r)
+	}
+	sort.Slice(rs, func(i, j int) bool {
+		return rs[i].Name < rs[j].Name
+	})
+	return rs, nil
+}
+
+func (mr *mockRole) GetByName(name string) (*role.Role, error) {
+	mr.mu.Lock()
+	defer mr.mu.Unlock()
+
+	r, ok := mr.roles[name]
+	if !ok {
+		return nil, role.ErrNoRoleFound
+	}
+	return &r, nil
+}
+
+func (mr *mockRole) Create(r *role.Role) error {
+	mr.mu.Lock()
+	defer mr.mu.Unlock()
+
+	mr.roles[r.Name] = *r
+	return nil
+}
+
+func (mr *mockRole) Update(r *role.Role) error {
+	mr.mu.Lock()
+	defer mr.mu.Unlock()
+
+	if _, ok := mr.roles[r.Name]; !ok {
+		return role.ErrNoRoleFound
+	}
+	mr.roles[r.Name] = *r
+	return nil
+}
+
+func (mr *mockRole) Delete(name string) error {
+	mr.mu.Lock()
+	defer mr.mu.Unlock()
+
+	if _, ok := mr.roles[name]; !ok {
+		return role.ErrNoRoleFound
+	}
+	delete(mr.roles, name)
+	return nil
+}
+
+func (mr *mockRole) Seed(rs []role.Role, at time.Time) error {
+	mr.mu.Lock()
+	defer mr.mu.Unlock()
+
+	for _, r := range rs {
+		if _, ok := mr.roles[r.Name]; ok && r.Name != "ADMIN" {
+			continue
+		}
+		r.CreatedAt, r.UpdatedAt = at, at
+		mr.roles[r.Name] = r
+	}
+	return nil
+}
@@ -0,0 +1,68 @@
+package mock
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/axwilliams/book-api/internal/business/series"
+	"github.com/axwilliams/book-api/internal/platform/web"
+)
+
+type MockSeries interface {
+	GetAll() ([]series.Series, error)
+	GetById(id string) (*series.Series, error)
+	GetByName(name string) (*series.Series, error)
+	Create(sr *series.Series) error
+	Update(sr *series.Series) error
+	Destroy(id string) error
+}
+
+type mockSeries struct{}
+
+func NewMockSeries() MockSeries {
+	return &mockSeries{}
+}
+
+var lordOfTheRings = series.Series{
+	ID:          "3c9d2e71-6b4a-4f8e-9d0c-1a2b3c4d5e6f",
+	Name:        "The Lord of the Rings",
+	Description: "Tolkien's epic in three volumes",
+}
+
+func (ms *mockSeries) GetAll() ([]series.Series, error) {
+	return []series.Series{lordOfTheRings}, nil
+}
+
+func (ms *mockSeries) GetById(id string) (*series.Series, error) {
+	if id == lordOfTheRings.ID {
+		sr := lordOfTheRings
+		return &sr, nil
+	}
+
+	return nil, series.ErrNoSeriesFound
+}
+
+func (ms *mockSeries) GetByName(name string) (*series.Series, error) {
+	if strings.EqualFold(name, lordOfTheRings.Name) {
+		sr := lordOfTheRings
+		return &sr, nil
+	}
+
+	return nil, series.ErrNoSeriesFound
+}
+
+func (ms *mockSeries) Create(sr *series.Series) error {
+	return nil
+}
+
+func (ms *mockSeries) Update(sr *series.Series) error {
+	return nil
+}
+
+func (ms *mockSeries) Destroy(id string) error {
+	if id == lordOfTheRings.ID {
+		return nil
+	}
+
+	return web.NewRequestError(series.ErrNoAffect, http.StatusGone)
+}
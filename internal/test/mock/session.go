@@ -0,0 +1,190 @@
+package mock
+
+import (
+	"bytes"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/axwilliams/book-api/internal/business/session"
+)
+
+type MockSession interface {
+	Create(rt *session.RefreshToken) error
+	GetByHash(hash []byte) (*session.RefreshToken, error)
+	MarkUsed(id string, at time.Time) (bool, error)
+	RevokeFamily(familyID string, at time.Time) error
+	FindByUser(userID string, now time.Time) ([]session.Session, error)
+	RevokeSession(userID, familyID string, at time.Time) error
+	RevokeUser(userID string, at time.Time) ([]string, error)
+	Revoke(rv session.Revocation) error
+	Revocations(now time.Time) ([]session.Revocation, error)
+	DeleteRevocations(before time.Time) (int64, error)
+}
+
+// mockSession keeps refresh tokens and revocations in memory so that
+// rotation, reuse and logouts can be followed across calls.
+type mockSession struct {
+	mu      sync.Mutex
+	tokens  map[string]session.RefreshToken
+	revoked map[string]time.Time
+}
+
+func NewMockSession() MockSession {
+	return &mockSession{
+		tokens:  map[string]session.RefreshToken{},
+		revoked: map[string]time.Time{},
+	}
+}
+
+func (ms *mockSession) Create(rt *session.RefreshToken) error {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	ms.tokens[rt.ID] = *rt
+	return nil
+}
+
+func (ms *mockSession) GetByHash(hash []byte) (*session.RefreshToken, error) {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	for _, rt := range ms.tokens {
+		if bytes.Equal(rt.Hash, hash) {
+			return &rt, nil
+		}
+	}
+	return nil, session.ErrNoTokenFound
+}
+
+func (ms *mockSession) MarkUsed(id string, at time.Time) (bool, error) {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	rt, ok := ms.tokens[id]
+	if !ok || rt.UsedAt != nil {
+		return false, nil
+	}
+	rt.UsedAt = &at
+	ms.tokens[id] = rt
+	return true, nil
+}
+
+func (ms *mockSession) RevokeFamily(familyID string, at time.Time) error {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	for id, rt := range ms.tokens {
+		if rt.FamilyID == familyID && rt.RevokedAt == nil {
+			rt.RevokedAt = &at
+			ms.tokens[id] = rt
+		}
+	}
+	return nil
+}
+
+func (ms *mockSession) FindByUser(userID string, now time.Time) ([]session.Session, error) {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	created := map[string]time.Time{}
+	for _, rt := range ms.tokens {
+		if c, ok := created[rt.FamilyID]; !ok || rt.CreatedAt.Before(c) {
+			created[rt.FamilyID] = rt.CreatedAt
+		}
+	}
+
+	ss := []session.Session{}
+	for _, rt := range ms.tokens {
+		if rt.UserID != userID || rt.UsedAt != nil || rt.RevokedAt != nil || !now.Before(rt.ExpiresAt) {
+			continue
+		}
+		ss = append(ss, session.Session{
+			ID:         rt.FamilyID,
+			Device:     rt.Device,
+			CreatedAt:  created[rt.FamilyID],
+			LastUsedAt: rt.CreatedAt,
+			ExpiresAt:  rt.ExpiresAt,
+		})
+	}
+
+	sort.Slice(ss, func(i, j int) bool {
+		return ss[i].LastUsedAt.After(ss[j].LastUsedAt)
+	})
+	return ss, nil
+}
+
+func (ms *mockSession) RevokeSession(userID, familyID string, at time.Time) error {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	count := 0
+	for id, rt := range ms.tokens {
+		if rt.FamilyID == familyID && rt.UserID == userID && rt.RevokedAt == nil {
+			rt.RevokedAt = &at
+			ms.tokens[id] = rt
+			count++
+		}
+	}
+	if count == 0 {
+		return session.ErrNoSessionFound
+	}
+	return nil
+}
+
+func (ms *mockSession) RevokeUser(userID string, at time.Time) ([]string, error) {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	seen := map[string]bool{}
+	ids := []string{}
+	for id, rt := range ms.tokens {
+		if rt.UserID != userID || rt.RevokedAt != nil {
+			continue
+		}
+		rt.RevokedAt = &at
+		ms.tokens[id] = rt
+		if !seen[rt.FamilyID] {
+			seen[rt.FamilyID] = true
+			ids = append(ids, rt.FamilyID)
+		}
+	}
+	return ids, nil
+}
+
+func (ms *mockSession) Revoke(rv session.Revocation) error {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	if rv.ExpiresAt.After(ms.revoked[rv.ID]) {
+		ms.revoked[rv.ID] = rv.ExpiresAt
+	}
+	return nil
+}
+
+func (ms *mockSession) Revocations(now time.Time) ([]session.Revocation, error) {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	rvs := []session.Revocation{}
+	for id, exp := range ms.revoked {
+		if now.Before(exp) {
+			rvs = append(rvs, session.Revocation{ID: id, ExpiresAt: exp})
+		}
+	}
+	return rvs, nil
+}
+
+func (ms *mockSession) DeleteRevocations(before time.Time) (int64, error) {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	var count int64
+	for id, exp := range ms.revoked {
+		if !before.Before(exp) {
+			delete(ms.revoked, id)
+			count++
+		}
+	}
+	return count, nil
+}
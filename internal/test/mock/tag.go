@@ -0,0 +1,94 @@
+package mock
+
+import (
+	"net/http"
+
+	"github.com/axwilliams/book-api/internal/business/tag"
+	"github.com/axwilliams/book-api/internal/platform/web"
+)
+
+type MockTag interface {
+	GetById(id string) (*tag.Tag, error)
+	Resolve(name string) (*tag.Tag, error)
+	Create(t *tag.Tag) error
+	GetByBook(bookID string) ([]tag.Tag, error)
+	AddToBook(bookID, tagID, userID string) error
+	RemoveFromBook(bookID, tagID, userID string) error
+	Popular(limit int) ([]tag.Tag, error)
+	Rename(t *tag.Tag, oldName string) error
+	Merge(from *tag.Tag, into *tag.Tag) error
+	AddSynonym(name, tagID string) error
+}
+
+type mockTag struct{}
+
+func NewMockTag() MockTag {
+	return &mockTag{}
+}
+
+func (mt *mockTag) GetById(id string) (*tag.Tag, error) {
+	switch id {
+	case "5f0c3a44-9e0b-4c3f-8a61-2d7e1c7b9a01":
+		return &tag.Tag{ID: id, Name: "dystopia"}, nil
+	case "8e2d1b6f-4a7c-4f0e-b3d5-9c1a2e4f6b02":
+		return &tag.Tag{ID: id, Name: "science fiction"}, nil
+	}
+
+	return nil, tag.ErrNoTagFound
+}
+
+func (mt *mockTag) Resolve(name string) (*tag.Tag, error) {
+	switch name {
+	case "dystopia":
+		return &tag.Tag{ID: "5f0c3a44-9e0b-4c3f-8a61-2d7e1c7b9a01", Name: "dystopia"}, nil
+	case "science fiction", "sci fi":
+		return &tag.Tag{ID: "8e2d1b6f-4a7c-4f0e-b3d5-9c1a2e4f6b02", Name: "science fiction"}, nil
+	}
+
+	return nil, tag.ErrNoTagFound
+}
+
+func (mt *mockTag) Create(t *tag.Tag) error {
+	return nil
+}
+
+func (mt *mockTag) GetByBook(bookID string) ([]tag.Tag, error) {
+	ts := make([]tag.Tag, 0)
+
+	if bookID == "f4ac7e14-fc8e-4096-b956-34e5a33040f2" {
+		ts = append(ts, tag.Tag{ID: "5f0c3a44-9e0b-4c3f-8a61-2d7e1c7b9a01", Name: "dystopia"})
+	}
+
+	return ts, nil
+}
+
+func (mt *mockTag) AddToBook(bookID, tagID, userID string) error {
+	return nil
+}
+
+func (mt *mockTag) RemoveFromBook(bookID, tagID, userID string) error {
+	if bookID == "f4ac7e14-fc8e-4096-b956-34e5a33040f2" && tagID == "5f0c3a44-9e0b-4c3f-8a61-2d7e1c7b9a01" {
+		return nil
+	}
+
+	return web.NewRequestError(tag.ErrNoAffect, http.StatusGone)
+}
+
+func (mt *mockTag) Popular(limit int) ([]tag.Tag, error) {
+	return []tag.Tag{
+		{ID: "5f0c3a44-9e0b-4c3f-8a61-2d7e1c7b9a01", Name: "dystopia", Count: 2},
+		{ID: "8e2d1b6f-4a7c-4f0e-b3d5-9c1a2e4f6b02", Name: "science fiction", Count: 1},
+	}, nil
+}
+
+func (mt *mockTag) Rename(t *tag.Tag, oldName string) error {
+	return nil
+}
+
+func (mt *mockTag) Merge(from *tag.Tag, into *tag.Tag) error {
+	return nil
+}
+
+func (mt *mockTag) AddSynonym(name, tagID string) error {
+	return nil
+}
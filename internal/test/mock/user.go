@@ -4,56 +4,129 @@ import (
 	"net/http"
 
 	"github.com/axwilliams/book-api/internal/business/user"
+	"github.com/axwilliams/book-api/internal/platform/auth"
 	"github.com/axwilliams/book-api/internal/platform/web"
 	"github.com/lib/pq"
 )
 
 type MockUser interface {
 	GetById(id string) (*user.User, error)
-	Create(u *user.User) error
-	Update(u *user.User) error
-	Destroy(id string) error
+	Create(u *user.User, cs []user.RoleChange) error
+	Update(u *user.User, cs []user.RoleChange, revoke func() error) error
+	Destroy(id string, cs []user.RoleChange, revoke func() error) error
 	GetByUsername(username string) (*user.User, error)
 	UsernameAvailable(username, cuurentID string) bool
 	EmailAvailable(username, cuurentID string) bool
+	GetRoleChanges(userID string) ([]user.RoleChange, error)
 }
 
-type mockUser struct{}
+// mockUser keeps the roles users are updated with, so that granting and
+// revoking roles can be followed. Other changes are not kept.
+type mockUser struct {
+	roles   map[string]pq.StringArray
+	changes []user.RoleChange
+}
 
 func NewMockUser() MockUser {
-	return &mockUser{}
+	return &mockUser{roles: map[string]pq.StringArray{}}
 }
 
-func (mu *mockUser) GetById(id string) (*user.User, error) {
-	if id == "69a47775-6d89-4d38-ad38-acdb2928f6a1" {
-		return &user.User{
+func (mu *mockUser) users() []user.User {
+	us := []user.User{
+		{
 			ID:           "69a47775-6d89-4d38-ad38-acdb2928f6a1",
 			Username:     "author",
 			Email:        "author@example.com",
 			Roles:        pq.StringArray([]string{"AUTHOR"}),
 			PasswordHash: []byte("$2a$10$ExnMCA7MuOwW.s8Ss0BvSuGNCHawMIpqMmyJ4Oa9sTCTKKw2x445e"),
-		}, nil
+		},
+		{
+			ID:           "bad069ce-4afa-4a53-a673-14ae7b627d06",
+			Username:     "user",
+			Email:        "user@example.com",
+			Roles:        pq.StringArray([]string{}),
+			PasswordHash: []byte("$2a$10$PH3juwOeFvwr0auAgrUOy.PeCOGT/oRZevj7I5urM7tcOhsw0bdIi"),
+		},
+	}
+
+	for i, u := range us {
+		if roles, ok := mu.roles[u.ID]; ok {
+			us[i].Roles = roles
+		}
+	}
+	return us
+}
+
+func (mu *mockUser) GetById(id string) (*user.User, error) {
+	for _, u := range mu.users() {
+		if u.ID == id {
+			return &u, nil
+		}
 	}
 
 	return nil, user.ErrNoUserFound
 }
 
-func (mu *mockUser) Create(u *user.User) error {
+func (mu *mockUser) Create(u *user.User, cs []user.RoleChange) error {
+	mu.changes = append(mu.changes, cs...)
 	return nil
 }
 
-func (mu *mockUser) Update(u *user.User) error {
+func (mu *mockUser) Update(u *user.User, cs []user.RoleChange, revoke func() error) error {
+	if err := mu.keepAdmin(u.ID, cs); err != nil {
+		return err
+	}
+
+	if revoke != nil {
+		if err := revoke(); err != nil {
+			return err
+		}
+	}
+
+	mu.roles[u.ID] = u.Roles
+	mu.changes = append(mu.changes, cs...)
 	return nil
 }
 
-func (mu *mockUser) Destroy(id string) error {
+func (mu *mockUser) Destroy(id string, cs []user.RoleChange, revoke func() error) error {
+	if err := mu.keepAdmin(id, cs); err != nil {
+		return err
+	}
+
 	if id == "bad069ce-4afa-4a53-a673-14ae7b627d06" {
+		if revoke != nil {
+			if err := revoke(); err != nil {
+				return err
+			}
+		}
+		mu.changes = append(mu.changes, cs...)
 		return nil
 	}
 
 	return web.NewRequestError(user.ErrNoAffect, http.StatusGone)
 }
 
+// keepAdmin refuses to revoke ADMIN from the last user holding it, as the
+// repository does.
+func (mu *mockUser) keepAdmin(id string, cs []user.RoleChange) error {
+	revoked := false
+	for _, c := range cs {
+		if c.Role == auth.RoleAdmin && c.Action == user.RoleRevoked {
+			revoked = true
+		}
+	}
+	if !revoked {
+		return nil
+	}
+
+	for _, u := range mu.users() {
+		if u.ID != id && auth.HasRole(u.Roles, auth.RoleAdmin) {
+			return nil
+		}
+	}
+	return web.NewRequestError(user.ErrLastAdmin, http.StatusConflict)
+}
+
 func (mu *mockUser) GetByUsername(username string) (*user.User, error) {
 	if username == "author" {
 		return &user.User{
@@ -83,3 +156,14 @@ func (mu *mockUser) EmailAvailable(email, currentID string) bool {
 
 	return false
 }
+
+func (mu *mockUser) GetRoleChanges(userID string) ([]user.RoleChange, error) {
+	cs := []user.RoleChange{}
+	for _, c := range mu.changes {
+		if c.UserID == userID {
+			cs = append(cs, c)
+		}
+	}
+
+	return cs, nil
+}